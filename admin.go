@@ -0,0 +1,89 @@
+package veneur
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+
+	"github.com/stripe/veneur/samplers"
+	"github.com/stripe/veneur/sinks"
+	"goji.io"
+	"goji.io/pat"
+	"golang.org/x/net/context"
+)
+
+// AdminHandler returns the handler of the admin listener, which serves
+// the endpoints that are too revealing or too costly for the main HTTP
+// listener:
+//
+// GET /debug/state returns the state of the series that the workers
+// have aggregated since the last flush, as JSON. name selects series
+// by a glob pattern, and limit caps the number of series, which
+// defaults to 1000.
+//
+// GET /debug/metric?name=<name> returns the state of every tag set of
+// the metric that the workers have aggregated since the last flush,
+// including the sum and percentiles of histograms and timers, as JSON.
+// limit caps the number of tag sets, which defaults to 100.
+func (s *Server) AdminHandler() http.Handler {
+	mux := goji.NewMux()
+
+	mux.HandleFuncC(pat.Get("/debug/state"), func(c context.Context, w http.ResponseWriter, r *http.Request) {
+		limit, err := stateLimit(r, defaultStateLimit)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var accept func(string) bool
+		if name := r.URL.Query().Get("name"); name != "" {
+			filter := sinks.NewMetricFilter([]string{name}, nil, nil, nil)
+			accept = func(n string) bool {
+				return filter.Accept(samplers.InterMetric{Name: n})
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(s.State(accept, limit))
+	})
+
+	mux.HandleFuncC(pat.Get("/debug/metric"), func(c context.Context, w http.ResponseWriter, r *http.Request) {
+		name := r.URL.Query().Get("name")
+		if name == "" {
+			http.Error(w, "name is required", http.StatusBadRequest)
+			return
+		}
+		limit, err := stateLimit(r, defaultMetricLimit)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		dump := s.MetricState(name, limit)
+		if len(dump.Series) == 0 {
+			http.Error(w, "no such metric since the last flush", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(dump)
+	})
+
+	return mux
+}
+
+// startAdmin listens on the admin address, and serves AdminHandler on
+// it until the server shuts down.
+func (s *Server) startAdmin() {
+	listener, err := net.Listen("tcp", s.adminAddr)
+	if err != nil {
+		log.WithError(err).WithField("address", s.adminAddr).Fatal("Error listening on the admin address")
+	}
+	s.adminListener = listener
+	log.WithField("address", listener.Addr().String()).Info("Admin server listening")
+
+	go func() {
+		err := http.Serve(listener, s.AdminHandler())
+		select {
+		case <-s.shutdown:
+		default:
+			log.WithError(err).Error("Admin server shut down due to error")
+		}
+	}()
+}
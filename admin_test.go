@@ -0,0 +1,122 @@
+package veneur
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stripe/veneur/samplers"
+)
+
+func TestAdminDebugMetric(t *testing.T) {
+	w := NewWorker(0, nil, logrus.New(), nil, nil, 0)
+	s := &Server{Workers: []*Worker{w}, HistogramPercentiles: []float64{0.5, 0.99}}
+	for _, host := range []string{"a", "b"} {
+		for i := 1; i <= 100; i++ {
+			tags := []string{"host:" + host}
+			w.ProcessMetric(&samplers.UDPMetric{
+				MetricKey:  samplers.MetricKey{Name: "api.latency", Type: histogramTypeName, JoinedTags: tags[0]},
+				Tags:       tags,
+				Value:      float64(i),
+				SampleRate: 1.0,
+			})
+		}
+	}
+	w.ProcessMetric(&samplers.UDPMetric{
+		MetricKey:  samplers.MetricKey{Name: "api.users", Type: setTypeName},
+		Value:      "alice",
+		SampleRate: 1.0,
+	})
+	handler := s.AdminHandler()
+
+	get := func(url string) (int, StateDump) {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, url, nil))
+		var dump StateDump
+		if rec.Code == http.StatusOK {
+			require.NoError(t, json.NewDecoder(rec.Body).Decode(&dump))
+		}
+		return rec.Code, dump
+	}
+
+	code, dump := get("/debug/metric?name=api.latency")
+	require.Equal(t, http.StatusOK, code)
+	require.Len(t, dump.Series, 2)
+	for i, host := range []string{"a", "b"} {
+		series := dump.Series[i]
+		assert.Equal(t, "api.latency", series.Name)
+		assert.Equal(t, []string{"host:" + host}, series.Tags)
+		assert.Equal(t, 100.0, *series.Count)
+		assert.Equal(t, 5050.0, *series.Sum)
+		assert.Equal(t, 1.0, *series.Min)
+		assert.Equal(t, 100.0, *series.Max)
+		assert.InDelta(t, 50, series.Percentiles["p50"], 2)
+		assert.InDelta(t, 99, series.Percentiles["p99"], 2)
+	}
+
+	code, dump = get("/debug/metric?name=api.users")
+	require.Equal(t, http.StatusOK, code)
+	require.Len(t, dump.Series, 1)
+	assert.Equal(t, uint64(1), *dump.Series[0].Cardinality)
+
+	code, dump = get("/debug/metric?name=api.latency&limit=1")
+	require.Equal(t, http.StatusOK, code)
+	assert.Len(t, dump.Series, 1)
+	assert.True(t, dump.Truncated)
+
+	code, _ = get("/debug/metric?name=api.unknown")
+	assert.Equal(t, http.StatusNotFound, code)
+	code, _ = get("/debug/metric")
+	assert.Equal(t, http.StatusBadRequest, code)
+}
+
+func TestAdminDebugMetricReservoir(t *testing.T) {
+	w := NewWorker(0, nil, logrus.New(), nil, nil, 0)
+	w.reservoirs = samplers.HistogramReservoirs{{Pattern: "api.*", Size: 10}}
+	s := &Server{Workers: []*Worker{w}}
+	for _, name := range []string{"api.latency", "db.latency"} {
+		for i := 1; i <= 100; i++ {
+			w.ProcessMetric(&samplers.UDPMetric{
+				MetricKey:  samplers.MetricKey{Name: name, Type: timerTypeName},
+				Value:      float64(i),
+				SampleRate: 1.0,
+			})
+		}
+	}
+
+	dump := s.MetricState("api.latency", defaultMetricLimit)
+	require.Len(t, dump.Series, 1)
+	reservoir := dump.Series[0].Reservoir
+	assert.Len(t, reservoir, 10)
+	assert.True(t, sort.Float64sAreSorted(reservoir))
+	for _, v := range reservoir {
+		assert.True(t, v >= 1 && v <= 100, "%v should be a sampled value", v)
+	}
+
+	dump = s.MetricState("db.latency", defaultMetricLimit)
+	require.Len(t, dump.Series, 1)
+	assert.Nil(t, dump.Series[0].Reservoir, "reservoirs should only be kept for the configured metrics")
+}
+
+func TestAdminListener(t *testing.T) {
+	config := localConfig()
+	config.AdminAddress = "127.0.0.1:0"
+	s := setupVeneurServer(t, config, nil, nil, nil)
+	defer s.Shutdown()
+	require.NotNil(t, s.adminListener)
+
+	rec := httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/metric?name=a", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code, "the main listener shouldn't serve admin endpoints")
+
+	resp, err := http.Get(fmt.Sprintf("http://%s/debug/metric", s.adminListener.Addr()))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "the admin listener should serve /debug/metric")
+}
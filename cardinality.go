@@ -0,0 +1,135 @@
+package veneur
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/segmentio/fasthash/fnv1a"
+	"github.com/stripe/veneur/samplers"
+)
+
+// cardinalityLimiterShards is the number of independently locked
+// shards that a cardinalityLimiter spreads metric names over, so that
+// workers processing different metrics rarely contend.
+const cardinalityLimiterShards = 64
+
+// defaultCardinalityOverflowTag is the tag that replaces the tags of
+// the series over a metric's cardinality limit, unless configured
+// otherwise.
+const defaultCardinalityOverflowTag = "__overflow__"
+
+// cardinalityMagicTagPrefixes are the prefixes of the tags that tell
+// veneur where to aggregate a metric or which sinks to send it to.
+// They are kept on the overflow series, so that it is routed like the
+// series it replaces.
+var cardinalityMagicTagPrefixes = []string{"veneursinkonly:", "veneurlocalonly", "veneurglobalonly"}
+
+type cardinalityLimiterShard struct {
+	mtx sync.Mutex
+	// tagSets holds the hashes of the tag sets that each metric
+	// name was seen with in the current interval.
+	tagSets map[string]map[uint32]struct{}
+	// overflowed counts the samples of each metric name that were
+	// folded into its overflow series in the current interval.
+	overflowed map[string]int64
+}
+
+// cardinalityLimiter caps the number of distinct tag sets (series)
+// that each metric name has in a flush interval. It is shared by all
+// workers, since the series of a metric name are spread over them.
+type cardinalityLimiter struct {
+	max         int
+	overflowTag string
+	shards      [cardinalityLimiterShards]cardinalityLimiterShard
+}
+
+// newCardinalityLimiter creates a limiter that admits up to max tag
+// sets per metric name, and folds further ones into a series tagged
+// only with overflowTag.
+func newCardinalityLimiter(max int, overflowTag string) *cardinalityLimiter {
+	if overflowTag == "" {
+		overflowTag = defaultCardinalityOverflowTag
+	}
+	l := &cardinalityLimiter{max: max, overflowTag: overflowTag}
+	for i := range l.shards {
+		l.shards[i].tagSets = map[string]map[uint32]struct{}{}
+		l.shards[i].overflowed = map[string]int64{}
+	}
+	return l
+}
+
+// limit checks the metric's tag set against the limit of its name. If
+// the name already has the maximum number of other tag sets in this
+// interval, limit replaces the metric's tags with the overflow tag,
+// keeping only the magic tags, like veneursinkonly:, that route it,
+// and recomputes its digest, so that all of the name's overflowing
+// samples go to the same worker.
+//
+// Tag sets are told apart by a 32-bit hash, so two tag sets that
+// collide count as one.
+func (l *cardinalityLimiter) limit(m *samplers.UDPMetric) {
+	for _, tag := range m.Tags {
+		if tag == l.overflowTag {
+			return
+		}
+	}
+	shard := &l.shards[fnv1a.HashString32(m.Name)%cardinalityLimiterShards]
+	hash := fnv1a.HashString32(m.JoinedTags)
+	shard.mtx.Lock()
+	defer shard.mtx.Unlock()
+
+	seen, ok := shard.tagSets[m.Name]
+	if !ok {
+		seen = map[uint32]struct{}{}
+		shard.tagSets[m.Name] = seen
+	}
+	if _, ok := seen[hash]; ok || len(seen) < l.max {
+		seen[hash] = struct{}{}
+		return
+	}
+	shard.overflowed[m.Name]++
+	tags := []string{l.overflowTag}
+	for _, tag := range m.Tags {
+		for _, prefix := range cardinalityMagicTagPrefixes {
+			if strings.HasPrefix(tag, prefix) {
+				tags = append(tags, tag)
+				break
+			}
+		}
+	}
+	sort.Strings(tags)
+	m.Tags = tags
+	m.JoinedTags = strings.Join(tags, ",")
+	h := fnv1a.AddString32(fnv1a.Init32, m.Name)
+	h = fnv1a.AddString32(h, m.Type)
+	m.Digest = fnv1a.AddString32(h, m.JoinedTags)
+}
+
+// reset starts a new interval, and returns the number of samples of
+// each metric name that overflowed in the last one.
+func (l *cardinalityLimiter) reset() map[string]int64 {
+	overflowed := map[string]int64{}
+	for i := range l.shards {
+		shard := &l.shards[i]
+		shard.mtx.Lock()
+		for name, n := range shard.overflowed {
+			overflowed[name] = n
+		}
+		shard.tagSets = map[string]map[uint32]struct{}{}
+		shard.overflowed = map[string]int64{}
+		shard.mtx.Unlock()
+	}
+	return overflowed
+}
+
+// reportCardinality starts a new interval of the server's cardinality
+// limit, and reports the samples that overflowed the last one.
+func (s *Server) reportCardinality() {
+	if s.cardinalityLimiter == nil {
+		return
+	}
+	for name, n := range s.cardinalityLimiter.reset() {
+		s.Statsd.Count("worker.cardinality_overflow_total", n, []string{"metric:" + name}, 1.0)
+	}
+}
@@ -0,0 +1,141 @@
+package veneur
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stripe/veneur/samplers"
+)
+
+func cardinalityTestCounter(name string, tags ...string) *samplers.UDPMetric {
+	return &samplers.UDPMetric{
+		MetricKey: samplers.MetricKey{
+			Name:       name,
+			Type:       "counter",
+			JoinedTags: strings.Join(tags, ","),
+		},
+		Value:      1.0,
+		Tags:       tags,
+		SampleRate: 1.0,
+	}
+}
+
+// cardinalityTestServer returns a server with n workers, whose metrics
+// are limited to max series per name, and a function that processes a
+// metric like the server's listeners would.
+func cardinalityTestServer(n, max int) (*Server, func(*samplers.UDPMetric)) {
+	s := &Server{cardinalityLimiter: newCardinalityLimiter(max, "")}
+	for i := 0; i < n; i++ {
+		s.Workers = append(s.Workers, NewWorker(i+1, nil, nullLogger(), nil, nil, 0))
+	}
+	return s, func(m *samplers.UDPMetric) {
+		s.workerFor(m).ProcessMetric(m)
+	}
+}
+
+func TestCardinalityLimitOverflows(t *testing.T) {
+	s, process := cardinalityTestServer(1, 3)
+	w := s.Workers[0]
+
+	for i := 0; i < 3; i++ {
+		process(cardinalityTestCounter("api.requests", fmt.Sprintf("user_id:%d", i)))
+	}
+	// tag sets that were seen already are still admitted:
+	process(cardinalityTestCounter("api.requests", "user_id:0"))
+	// other metric names have their own limit:
+	process(cardinalityTestCounter("api.errors", "user_id:3"))
+
+	process(cardinalityTestCounter("api.requests", "user_id:3"))
+	process(cardinalityTestCounter("api.requests", "user_id:4"))
+
+	wm := w.Flush()
+	series := map[string]float64{}
+	for key, c := range wm.counters {
+		series[key.Name+"|"+key.JoinedTags] = c.Flush(0)[0].Value
+	}
+	assert.Equal(t, map[string]float64{
+		"api.requests|user_id:0":    2,
+		"api.requests|user_id:1":    1,
+		"api.requests|user_id:2":    1,
+		"api.requests|__overflow__": 2,
+		"api.errors|user_id:3":      1,
+	}, series)
+
+	overflow := wm.counters[samplers.MetricKey{Name: "api.requests", Type: "counter", JoinedTags: "__overflow__"}]
+	require.NotNil(t, overflow)
+	assert.Equal(t, []string{"__overflow__"}, overflow.Tags)
+
+	assert.Equal(t, map[string]int64{"api.requests": 2}, s.cardinalityLimiter.reset())
+	process(cardinalityTestCounter("api.requests", "user_id:4"))
+	_, ok := w.Flush().counters[samplers.MetricKey{Name: "api.requests", Type: "counter", JoinedTags: "user_id:4"}]
+	assert.True(t, ok, "a new interval should admit new tag sets")
+}
+
+func TestCardinalityLimitOverflowTag(t *testing.T) {
+	l := newCardinalityLimiter(1, "cardinality:exceeded")
+	first := cardinalityTestCounter("a.b.c", "x:1")
+	l.limit(first)
+	assert.Equal(t, "x:1", first.JoinedTags)
+
+	second := cardinalityTestCounter("a.b.c", "x:2")
+	l.limit(second)
+	assert.Equal(t, "cardinality:exceeded", second.JoinedTags)
+	assert.Equal(t, []string{"cardinality:exceeded"}, second.Tags)
+}
+
+func TestCardinalityLimitOverflowsAcrossWorkers(t *testing.T) {
+	s, process := cardinalityTestServer(8, 1)
+
+	for i := 0; i < 100; i++ {
+		m, err := samplers.ParseMetric([]byte(fmt.Sprintf("api.requests:1|c|#user_id:%d", i)))
+		require.NoError(t, err)
+		process(m)
+	}
+
+	overflows := 0
+	var total float64
+	for _, w := range s.Workers {
+		for key, c := range w.Flush().counters {
+			if key.JoinedTags == "__overflow__" {
+				overflows++
+				total += c.Flush(0)[0].Value
+			}
+		}
+	}
+	assert.Equal(t, 1, overflows, "all workers' overflowing samples should go to one series")
+	assert.Equal(t, float64(99), total)
+}
+
+func TestCardinalityLimitDigest(t *testing.T) {
+	l := newCardinalityLimiter(1, "")
+	l.limit(cardinalityTestCounter("a.b.c", "x:1"))
+	m, err := samplers.ParseMetric([]byte("a.b.c:1|c|#x:2"))
+	require.NoError(t, err)
+	l.limit(m)
+
+	expected, err := samplers.ParseMetric([]byte("a.b.c:1|c|#__overflow__"))
+	require.NoError(t, err)
+	assert.Equal(t, expected.Digest, m.Digest,
+		"the overflow series should have the digest of its tags")
+}
+
+func TestCardinalityLimitKeepsSinkOnlyTags(t *testing.T) {
+	s, process := cardinalityTestServer(1, 1)
+	w := s.Workers[0]
+
+	process(cardinalityTestCounter("a.b.c", "user_id:1", "veneursinkonly:datadog"))
+	process(cardinalityTestCounter("a.b.c", "user_id:2", "veneursinkonly:datadog"))
+
+	key := samplers.MetricKey{Name: "a.b.c", Type: "counter", JoinedTags: "__overflow__,veneursinkonly:datadog"}
+	overflow := w.Flush().counters[key]
+	require.NotNil(t, overflow, "the overflow series should keep the veneursinkonly: tag")
+	assert.Equal(t, []string{"__overflow__", "veneursinkonly:datadog"}, overflow.Tags)
+
+	metrics := overflow.Flush(0)
+	require.Len(t, metrics, 1)
+	assert.Equal(t, samplers.RouteInformation{"datadog": struct{}{}}, metrics[0].Sinks,
+		"the overflow series should only go to its sink")
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"flag"
 	"os"
+	"syscall"
 	"time"
 
 	"github.com/getsentry/raven-go"
@@ -89,10 +90,7 @@ func main() {
 		trace.DefaultClient = server.TraceClient
 	}
 	server.Start()
+	go server.ReloadConfigOnSignal(*configFile, syscall.SIGHUP)
 
-	if conf.HTTPAddress != "" || conf.GrpcAddress != "" {
-		server.Serve()
-	} else {
-		select {}
-	}
+	server.Serve()
 }
@@ -1,98 +1,214 @@
 package veneur
 
 type Config struct {
-	Aggregates                    []string  `yaml:"aggregates"`
-	AwsAccessKeyID                string    `yaml:"aws_access_key_id"`
-	AwsRegion                     string    `yaml:"aws_region"`
-	AwsS3Bucket                   string    `yaml:"aws_s3_bucket"`
-	AwsSecretAccessKey            string    `yaml:"aws_secret_access_key"`
-	BlockProfileRate              int       `yaml:"block_profile_rate"`
-	DatadogAPIHostname            string    `yaml:"datadog_api_hostname"`
-	DatadogAPIKey                 string    `yaml:"datadog_api_key"`
-	DatadogFlushMaxPerBody        int       `yaml:"datadog_flush_max_per_body"`
-	DatadogSpanBufferSize         int       `yaml:"datadog_span_buffer_size"`
-	DatadogTraceAPIAddress        string    `yaml:"datadog_trace_api_address"`
-	Debug                         bool      `yaml:"debug"`
-	DebugFlushedMetrics           bool      `yaml:"debug_flushed_metrics"`
-	DebugIngestedSpans            bool      `yaml:"debug_ingested_spans"`
-	EnableProfiling               bool      `yaml:"enable_profiling"`
-	FalconerAddress               string    `yaml:"falconer_address"`
-	FlushFile                     string    `yaml:"flush_file"`
-	FlushMaxPerBody               int       `yaml:"flush_max_per_body"`
-	ForwardAddress                string    `yaml:"forward_address"`
-	ForwardUseGrpc                bool      `yaml:"forward_use_grpc"`
-	GrpcAddress                   string    `yaml:"grpc_address"`
-	Hostname                      string    `yaml:"hostname"`
-	HTTPAddress                   string    `yaml:"http_address"`
-	IndicatorSpanTimerName        string    `yaml:"indicator_span_timer_name"`
-	Interval                      string    `yaml:"interval"`
-	KafkaBroker                   string    `yaml:"kafka_broker"`
-	KafkaCheckTopic               string    `yaml:"kafka_check_topic"`
-	KafkaEventTopic               string    `yaml:"kafka_event_topic"`
-	KafkaMetricBufferBytes        int       `yaml:"kafka_metric_buffer_bytes"`
-	KafkaMetricBufferFrequency    string    `yaml:"kafka_metric_buffer_frequency"`
-	KafkaMetricBufferMessages     int       `yaml:"kafka_metric_buffer_messages"`
-	KafkaMetricRequireAcks        string    `yaml:"kafka_metric_require_acks"`
-	KafkaMetricTopic              string    `yaml:"kafka_metric_topic"`
-	KafkaPartitioner              string    `yaml:"kafka_partitioner"`
-	KafkaRetryMax                 int       `yaml:"kafka_retry_max"`
-	KafkaSpanBufferBytes          int       `yaml:"kafka_span_buffer_bytes"`
-	KafkaSpanBufferFrequency      string    `yaml:"kafka_span_buffer_frequency"`
-	KafkaSpanBufferMesages        int       `yaml:"kafka_span_buffer_mesages"`
-	KafkaSpanRequireAcks          string    `yaml:"kafka_span_require_acks"`
-	KafkaSpanSampleRatePercent    int       `yaml:"kafka_span_sample_rate_percent"`
-	KafkaSpanSampleTag            string    `yaml:"kafka_span_sample_tag"`
-	KafkaSpanSerializationFormat  string    `yaml:"kafka_span_serialization_format"`
-	KafkaSpanTopic                string    `yaml:"kafka_span_topic"`
-	LightstepAccessToken          string    `yaml:"lightstep_access_token"`
-	LightstepCollectorHost        string    `yaml:"lightstep_collector_host"`
-	LightstepMaximumSpans         int       `yaml:"lightstep_maximum_spans"`
-	LightstepNumClients           int       `yaml:"lightstep_num_clients"`
-	LightstepReconnectPeriod      string    `yaml:"lightstep_reconnect_period"`
-	MetricMaxLength               int       `yaml:"metric_max_length"`
-	MutexProfileFraction          int       `yaml:"mutex_profile_fraction"`
-	NumReaders                    int       `yaml:"num_readers"`
-	NumSpanWorkers                int       `yaml:"num_span_workers"`
-	NumWorkers                    int       `yaml:"num_workers"`
-	OmitEmptyHostname             bool      `yaml:"omit_empty_hostname"`
-	Percentiles                   []float64 `yaml:"percentiles"`
-	ReadBufferSizeBytes           int       `yaml:"read_buffer_size_bytes"`
-	SentryDsn                     string    `yaml:"sentry_dsn"`
-	SignalfxAPIKey                string    `yaml:"signalfx_api_key"`
-	SignalfxEndpointBase          string    `yaml:"signalfx_endpoint_base"`
-	SignalfxHostnameTag           string    `yaml:"signalfx_hostname_tag"`
-	SignalfxMetricNamePrefixDrops []string  `yaml:"signalfx_metric_name_prefix_drops"`
-	SignalfxMetricTagPrefixDrops  []string  `yaml:"signalfx_metric_tag_prefix_drops"`
+	AdminAddress                       string   `yaml:"admin_address"`
+	Aggregates                         []string `yaml:"aggregates"`
+	AwsAccessKeyID                     string   `yaml:"aws_access_key_id"`
+	AwsRegion                          string   `yaml:"aws_region"`
+	AwsS3Bucket                        string   `yaml:"aws_s3_bucket"`
+	AwsS3Format                        string   `yaml:"aws_s3_format"`
+	AwsS3ParquetColumns                []string `yaml:"aws_s3_parquet_columns"`
+	AwsS3ParquetCompression            string   `yaml:"aws_s3_parquet_compression"`
+	AwsSecretAccessKey                 string   `yaml:"aws_secret_access_key"`
+	BlockProfileRate                   int      `yaml:"block_profile_rate"`
+	CounterRates                       string   `yaml:"counter_rates"`
+	DatadogAPIHostname                 string   `yaml:"datadog_api_hostname"`
+	DatadogAPIKey                      string   `yaml:"datadog_api_key"`
+	DatadogCompression                 string   `yaml:"datadog_compression"`
+	DatadogFlushMaxPerBody             int      `yaml:"datadog_flush_max_per_body"`
+	DatadogSpanBufferSize              int      `yaml:"datadog_span_buffer_size"`
+	DatadogTraceAPIAddress             string   `yaml:"datadog_trace_api_address"`
+	Debug                              bool     `yaml:"debug"`
+	DebugFlushedMetrics                bool     `yaml:"debug_flushed_metrics"`
+	DebugIngestedSpans                 bool     `yaml:"debug_ingested_spans"`
+	EnableProfiling                    bool     `yaml:"enable_profiling"`
+	FalconerAddress                    string   `yaml:"falconer_address"`
+	FlushFile                          string   `yaml:"flush_file"`
+	FlushMaxConcurrency                int      `yaml:"flush_max_concurrency"`
+	FlushMinMax                        bool     `yaml:"flush_min_max"`
+	FlushMaxPerBody                    int      `yaml:"flush_max_per_body"`
+	FlushTimeout                       string   `yaml:"flush_timeout"`
+	ForwardAddress                     string   `yaml:"forward_address"`
+	ForwardDigestEncoding              string   `yaml:"forward_digest_encoding"`
+	ForwardTLSAuthorityCertificateFile string   `yaml:"forward_tls_authority_certificate_file"`
+	ForwardTLSCertificateFile          string   `yaml:"forward_tls_certificate_file"`
+	ForwardTLSKeyFile                  string   `yaml:"forward_tls_key_file"`
+	ForwardUseGrpc                     bool     `yaml:"forward_use_grpc"`
+	GaugeTTL                           string   `yaml:"gauge_ttl"`
+	GraphiteAddress                    string   `yaml:"graphite_address"`
+	GraphiteBufferSize                 int      `yaml:"graphite_buffer_size"`
+	GraphitePathSeparator              string   `yaml:"graphite_path_separator"`
+	GraphiteTagOrder                   []string `yaml:"graphite_tag_order"`
+	GrpcAddress                        string   `yaml:"grpc_address"`
+	GrpcTLS                            bool     `yaml:"grpc_tls"`
+	HistogramAggregatesOverrides       []struct {
+		Aggregates []string `yaml:"aggregates"`
+		Name       string   `yaml:"name"`
+	} `yaml:"histogram_aggregates_overrides"`
+	HistogramBuckets              []float64 `yaml:"histogram_buckets"`
+	HistogramCompression          float64   `yaml:"histogram_compression"`
+	HistogramCompressionOverrides overrides `yaml:"histogram_compression_overrides"`
+	HistogramMaxExemplars         int       `yaml:"histogram_max_exemplars"`
+	HistogramReservoirs           []struct {
+		Name string `yaml:"name"`
+		Size int    `yaml:"size"`
+	} `yaml:"histogram_reservoirs"`
+	Hostname                      string                       `yaml:"hostname"`
+	HostnameEnv                   string                       `yaml:"hostname_env"`
+	HostnameFile                  string                       `yaml:"hostname_file"`
+	HostnameMetadata              string                       `yaml:"hostname_metadata"`
+	HTTPAddress                   string                       `yaml:"http_address"`
+	HTTPDisableKeepAlives         bool                         `yaml:"http_disable_keep_alives"`
+	HTTPIdleConnTimeout           string                       `yaml:"http_idle_conn_timeout"`
+	HTTPMaxIdleConnsPerHost       int                          `yaml:"http_max_idle_conns_per_host"`
+	HTTPTLS                       bool                         `yaml:"http_tls"`
+	HTTPSamplesMaxBodyBytes       int64                        `yaml:"http_samples_max_body_bytes"`
+	ImportDedupeMaxKeys           int                          `yaml:"import_dedupe_max_keys"`
+	ImportDedupeWindow            string                       `yaml:"import_dedupe_window"`
+	IndicatorSpanTimerName        string                       `yaml:"indicator_span_timer_name"`
+	InfluxdbAddress               string                       `yaml:"influxdb_address"`
+	InfluxdbDatabase              string                       `yaml:"influxdb_database"`
+	InfluxdbRetentionPolicy       string                       `yaml:"influxdb_retention_policy"`
+	IngestDropWhenFull            bool                         `yaml:"ingest_drop_when_full"`
+	Interval                      string                       `yaml:"interval"`
+	HoneycombAPIHost              string                       `yaml:"honeycomb_api_host"`
+	HoneycombBatchSize            int                          `yaml:"honeycomb_batch_size"`
+	HoneycombDataset              string                       `yaml:"honeycomb_dataset"`
+	HoneycombWriteKey             string                       `yaml:"honeycomb_write_key"`
+	JaegerAddress                 string                       `yaml:"jaeger_address"`
+	JaegerBatchSize               int                          `yaml:"jaeger_batch_size"`
+	JaegerProtocol                string                       `yaml:"jaeger_protocol"`
+	KafkaBroker                   string                       `yaml:"kafka_broker"`
+	KafkaCheckTopic               string                       `yaml:"kafka_check_topic"`
+	KafkaEventTopic               string                       `yaml:"kafka_event_topic"`
+	KafkaMetricBufferBytes        int                          `yaml:"kafka_metric_buffer_bytes"`
+	KafkaMetricBufferFrequency    string                       `yaml:"kafka_metric_buffer_frequency"`
+	KafkaMetricBufferMessages     int                          `yaml:"kafka_metric_buffer_messages"`
+	KafkaMetricPartitionKey       string                       `yaml:"kafka_metric_partition_key"`
+	KafkaMetricPartitionKeyTag    string                       `yaml:"kafka_metric_partition_key_tag"`
+	KafkaMetricRequireAcks        string                       `yaml:"kafka_metric_require_acks"`
+	KafkaMetricTopic              string                       `yaml:"kafka_metric_topic"`
+	KafkaPartitioner              string                       `yaml:"kafka_partitioner"`
+	KafkaRetryMax                 int                          `yaml:"kafka_retry_max"`
+	KafkaSpanBufferBytes          int                          `yaml:"kafka_span_buffer_bytes"`
+	KafkaSpanBufferFrequency      string                       `yaml:"kafka_span_buffer_frequency"`
+	KafkaSpanBufferMesages        int                          `yaml:"kafka_span_buffer_mesages"`
+	KafkaSpanRequireAcks          string                       `yaml:"kafka_span_require_acks"`
+	KafkaSpanSampleRatePercent    int                          `yaml:"kafka_span_sample_rate_percent"`
+	KafkaSpanSampleTag            string                       `yaml:"kafka_span_sample_tag"`
+	KafkaSpanSerializationFormat  string                       `yaml:"kafka_span_serialization_format"`
+	KafkaSpanTopic                string                       `yaml:"kafka_span_topic"`
+	LightstepAccessToken          string                       `yaml:"lightstep_access_token"`
+	LightstepCollectorHost        string                       `yaml:"lightstep_collector_host"`
+	LightstepMaximumSpans         int                          `yaml:"lightstep_maximum_spans"`
+	LightstepNumClients           int                          `yaml:"lightstep_num_clients"`
+	LightstepReconnectPeriod      string                       `yaml:"lightstep_reconnect_period"`
+	MetricCardinalityOverflowTag  string                       `yaml:"metric_cardinality_overflow_tag"`
+	MetricDefaultRoute            []string                     `yaml:"metric_default_route"`
+	MetricMaxCardinality          int                          `yaml:"metric_max_cardinality"`
+	MetricMaxLength               int                          `yaml:"metric_max_length"`
+	MetricMaxValues               int                          `yaml:"metric_max_values"`
+	MetricRoutes                  []MetricRoute                `yaml:"metric_routes"`
+	MetricSinkOptions             map[string]MetricSinkOptions `yaml:"metric_sink_options"`
+	MetricSinks                   []RegisteredSinkConfig       `yaml:"metric_sinks"`
+	MutexProfileFraction          int                          `yaml:"mutex_profile_fraction"`
+	NumReaders                    int                          `yaml:"num_readers"`
+	NumSpanWorkers                int                          `yaml:"num_span_workers"`
+	NumWorkers                    int                          `yaml:"num_workers"`
+	OmitEmptyHostname             bool                         `yaml:"omit_empty_hostname"`
+	NewrelicAPIKey                string                       `yaml:"newrelic_api_key"`
+	NewrelicEndpoint              string                       `yaml:"newrelic_endpoint"`
+	OtlpMetricsAddress            string                       `yaml:"otlp_metrics_address"`
+	OtlpTLS                       bool                         `yaml:"otlp_tls"`
+	OtlpTLSAuthorityCertificate   string                       `yaml:"otlp_tls_authority_certificate"`
+	OtlpTracesAddress             string                       `yaml:"otlp_traces_address"`
+	OtlpTracesBatchSize           int                          `yaml:"otlp_traces_batch_size"`
+	PercentileNaming              string                       `yaml:"percentile_naming"`
+	Percentiles                   []float64                    `yaml:"percentiles"`
+	PrometheusRwAddress           string                       `yaml:"prometheus_rw_address"`
+	PrometheusRwBasicAuthPassword string                       `yaml:"prometheus_rw_basic_auth_password"`
+	PrometheusRwBasicAuthUsername string                       `yaml:"prometheus_rw_basic_auth_username"`
+	PrometheusRwBearerToken       string                       `yaml:"prometheus_rw_bearer_token"`
+	PrometheusRwFlushMaxPerBody   int                          `yaml:"prometheus_rw_flush_max_per_body"`
+	ReadBufferSizeBytes           int                          `yaml:"read_buffer_size_bytes"`
+	SentryDsn                     string                       `yaml:"sentry_dsn"`
+	SetPrecision                  int                          `yaml:"set_precision"`
+	ShutdownDrainTimeout          string                       `yaml:"shutdown_drain_timeout"`
+	SignalfxAPIKey                string                       `yaml:"signalfx_api_key"`
+	SignalfxCompression           string                       `yaml:"signalfx_compression"`
+	SignalfxEndpointBase          string                       `yaml:"signalfx_endpoint_base"`
+	SignalfxHostnameTag           string                       `yaml:"signalfx_hostname_tag"`
+	SignalfxMetricNamePrefixDrops []string                     `yaml:"signalfx_metric_name_prefix_drops"`
+	SignalfxMetricTagPrefixDrops  []string                     `yaml:"signalfx_metric_tag_prefix_drops"`
 	SignalfxPerTagAPIKeys         []struct {
 		APIKey string `yaml:"api_key"`
 		Name   string `yaml:"name"`
 	} `yaml:"signalfx_per_tag_api_keys"`
-	SignalfxVaryKeyBy                 string   `yaml:"signalfx_vary_key_by"`
-	SpanChannelCapacity               int      `yaml:"span_channel_capacity"`
-	SplunkHecAddress                  string   `yaml:"splunk_hec_address"`
-	SplunkHecBatchSize                int      `yaml:"splunk_hec_batch_size"`
-	SplunkHecConnectionLifetimeJitter string   `yaml:"splunk_hec_connection_lifetime_jitter"`
-	SplunkHecIngestTimeout            string   `yaml:"splunk_hec_ingest_timeout"`
-	SplunkHecMaxConnectionLifetime    string   `yaml:"splunk_hec_max_connection_lifetime"`
-	SplunkHecSendTimeout              string   `yaml:"splunk_hec_send_timeout"`
-	SplunkHecSubmissionWorkers        int      `yaml:"splunk_hec_submission_workers"`
-	SplunkHecTLSValidateHostname      string   `yaml:"splunk_hec_tls_validate_hostname"`
-	SplunkHecToken                    string   `yaml:"splunk_hec_token"`
-	SplunkSpanSampleRate              int      `yaml:"splunk_span_sample_rate"`
-	SsfBufferSize                     int      `yaml:"ssf_buffer_size"`
-	SsfListenAddresses                []string `yaml:"ssf_listen_addresses"`
-	StatsAddress                      string   `yaml:"stats_address"`
-	StatsdListenAddresses             []string `yaml:"statsd_listen_addresses"`
-	SynchronizeWithInterval           bool     `yaml:"synchronize_with_interval"`
-	Tags                              []string `yaml:"tags"`
-	TagsExclude                       []string `yaml:"tags_exclude"`
-	TLSAuthorityCertificate           string   `yaml:"tls_authority_certificate"`
-	TLSCertificate                    string   `yaml:"tls_certificate"`
-	TLSKey                            string   `yaml:"tls_key"`
-	TraceLightstepAccessToken         string   `yaml:"trace_lightstep_access_token"`
-	TraceLightstepCollectorHost       string   `yaml:"trace_lightstep_collector_host"`
-	TraceLightstepMaximumSpans        int      `yaml:"trace_lightstep_maximum_spans"`
-	TraceLightstepNumClients          int      `yaml:"trace_lightstep_num_clients"`
-	TraceLightstepReconnectPeriod     string   `yaml:"trace_lightstep_reconnect_period"`
-	TraceMaxLengthBytes               int      `yaml:"trace_max_length_bytes"`
+	SignalfxVaryKeyBy    string  `yaml:"signalfx_vary_key_by"`
+	SourceRateLimit      float64 `yaml:"source_rate_limit"`
+	SourceRateLimitBurst int     `yaml:"source_rate_limit_burst"`
+	SpanChannelCapacity  int     `yaml:"span_channel_capacity"`
+	SpanMaxTagLength     int     `yaml:"span_max_tag_length"`
+	SpanMaxTags          int     `yaml:"span_max_tags"`
+	SpanMetricRules      []struct {
+		Match map[string]string `yaml:"match"`
+		Name  string            `yaml:"name"`
+		Tags  []string          `yaml:"tags"`
+		Type  string            `yaml:"type"`
+		Unit  string            `yaml:"unit"`
+	} `yaml:"span_metric_rules"`
+	SpanSinks                         []RegisteredSinkConfig `yaml:"span_sinks"`
+	SpanTailSampling                  bool                   `yaml:"span_tail_sampling"`
+	SpanTailSamplingKeepErrors        bool                   `yaml:"span_tail_sampling_keep_errors"`
+	SpanTailSamplingMaxSpans          int                    `yaml:"span_tail_sampling_max_spans"`
+	SpanTailSamplingMinDuration       string                 `yaml:"span_tail_sampling_min_duration"`
+	SpanTailSamplingRate              float64                `yaml:"span_tail_sampling_rate"`
+	SpanTailSamplingWait              string                 `yaml:"span_tail_sampling_wait"`
+	SpanValidation                    string                 `yaml:"span_validation"`
+	SplunkHecAddress                  string                 `yaml:"splunk_hec_address"`
+	SplunkHecBatchSize                int                    `yaml:"splunk_hec_batch_size"`
+	SplunkHecConnectionLifetimeJitter string                 `yaml:"splunk_hec_connection_lifetime_jitter"`
+	SplunkHecIngestTimeout            string                 `yaml:"splunk_hec_ingest_timeout"`
+	SplunkHecMaxConnectionLifetime    string                 `yaml:"splunk_hec_max_connection_lifetime"`
+	SplunkHecSendTimeout              string                 `yaml:"splunk_hec_send_timeout"`
+	SplunkHecSubmissionWorkers        int                    `yaml:"splunk_hec_submission_workers"`
+	SplunkHecTLSValidateHostname      string                 `yaml:"splunk_hec_tls_validate_hostname"`
+	SplunkHecToken                    string                 `yaml:"splunk_hec_token"`
+	SplunkSpanSampleRate              int                    `yaml:"splunk_span_sample_rate"`
+	SsfBufferSize                     int                    `yaml:"ssf_buffer_size"`
+	SsfListenAddresses                []string               `yaml:"ssf_listen_addresses"`
+	StatsAddress                      string                 `yaml:"stats_address"`
+	StatsdListenAddresses             []string               `yaml:"statsd_listen_addresses"`
+	SynchronizeWithInterval           bool                   `yaml:"synchronize_with_interval"`
+	Tags                              []string               `yaml:"tags"`
+	TagsExclude                       []string               `yaml:"tags_exclude"`
+	TCPConnectionRateLimit            float64                `yaml:"tcp_connection_rate_limit"`
+	TCPMaxLineLength                  int                    `yaml:"tcp_max_line_length"`
+	TCPReadTimeout                    string                 `yaml:"tcp_read_timeout"`
+	TLSAuthorityCertificate           string                 `yaml:"tls_authority_certificate"`
+	TLSAuthorityCertificateFile       string                 `yaml:"tls_authority_certificate_file"`
+	TLSCertificate                    string                 `yaml:"tls_certificate"`
+	TLSCertificateFile                string                 `yaml:"tls_certificate_file"`
+	TLSKey                            string                 `yaml:"tls_key"`
+	TLSKeyFile                        string                 `yaml:"tls_key_file"`
+	TraceLightstepAccessToken         string                 `yaml:"trace_lightstep_access_token"`
+	TraceLightstepCollectorHost       string                 `yaml:"trace_lightstep_collector_host"`
+	TraceLightstepMaximumSpans        int                    `yaml:"trace_lightstep_maximum_spans"`
+	TraceLightstepNumClients          int                    `yaml:"trace_lightstep_num_clients"`
+	TraceLightstepReconnectPeriod     string                 `yaml:"trace_lightstep_reconnect_period"`
+	TraceMaxLengthBytes               int                    `yaml:"trace_max_length_bytes"`
+	WavefrontAddress                  string                 `yaml:"wavefront_address"`
+	WavefrontAPIToken                 string                 `yaml:"wavefront_api_token"`
+	WavefrontProtocol                 string                 `yaml:"wavefront_protocol"`
+	WavefrontSource                   string                 `yaml:"wavefront_source"`
+	WavefrontSourceTag                string                 `yaml:"wavefront_source_tag"`
+	ZipkinAddress                     string                 `yaml:"zipkin_address"`
+	ZipkinBatchSize                   int                    `yaml:"zipkin_batch_size"`
+}
+
+// overrides are the t-digest compressions of the histograms and timers
+// whose names match, in the order that they are tried.
+type overrides []struct {
+	Compression float64 `yaml:"compression"`
+	Name        string  `yaml:"name"`
 }
@@ -14,8 +14,10 @@ import (
 var defaultConfig = Config{
 	Aggregates:                     []string{"min", "max", "count"},
 	DatadogFlushMaxPerBody:         25000,
+	HTTPSamplesMaxBodyBytes:        1048576, // 1 MiB
 	Interval:                       "10s",
 	MetricMaxLength:                4096,
+	MetricMaxValues:                64,
 	ReadBufferSizeBytes:            1048576 * 2, // 2 MiB
 	SpanChannelCapacity:            100,
 	SplunkHecBatchSize:             100,
@@ -23,6 +25,10 @@ var defaultConfig = Config{
 }
 
 var defaultProxyConfig = ProxyConfig{
+	ForwardHealthCheckPath:       "/healthcheck",
+	ForwardHealthCheckThreshold:  3,
+	ForwardTransport:             "http",
+	HashRingReplicas:             100,
 	MaxIdleConnsPerHost:          100,
 	TracingClientCapacity:        1024,
 	TracingClientFlushInterval:   "500ms",
@@ -52,6 +58,18 @@ func (c *ProxyConfig) applyDefaults() {
 		).Warn("max_idle_conns_per_host being unset may lead to unsafe operations, defaulting!")
 		c.MaxIdleConnsPerHost = defaultProxyConfig.MaxIdleConnsPerHost
 	}
+	if c.ForwardHealthCheckPath == "" {
+		c.ForwardHealthCheckPath = defaultProxyConfig.ForwardHealthCheckPath
+	}
+	if c.ForwardHealthCheckThreshold == 0 {
+		c.ForwardHealthCheckThreshold = defaultProxyConfig.ForwardHealthCheckThreshold
+	}
+	if c.ForwardTransport == "" {
+		c.ForwardTransport = defaultProxyConfig.ForwardTransport
+	}
+	if c.HashRingReplicas == 0 {
+		c.HashRingReplicas = defaultProxyConfig.HashRingReplicas
+	}
 	if c.TracingClientCapacity == 0 {
 		c.TracingClientCapacity = defaultProxyConfig.TracingClientCapacity
 	}
@@ -153,8 +171,9 @@ func (c *Config) applyDefaults() {
 	if len(c.Aggregates) == 0 {
 		c.Aggregates = defaultConfig.Aggregates
 	}
-	if c.Hostname == "" && !c.OmitEmptyHostname {
-		c.Hostname, _ = os.Hostname()
+	c.Hostname = c.resolveHostname()
+	if c.HTTPSamplesMaxBodyBytes == 0 {
+		c.HTTPSamplesMaxBodyBytes = defaultConfig.HTTPSamplesMaxBodyBytes
 	}
 	if c.Interval == "" {
 		c.Interval = defaultConfig.Interval
@@ -162,6 +181,9 @@ func (c *Config) applyDefaults() {
 	if c.MetricMaxLength == 0 {
 		c.MetricMaxLength = defaultConfig.MetricMaxLength
 	}
+	if c.MetricMaxValues == 0 {
+		c.MetricMaxValues = defaultConfig.MetricMaxValues
+	}
 	if c.ReadBufferSizeBytes == 0 {
 		c.ReadBufferSizeBytes = defaultConfig.ReadBufferSizeBytes
 	}
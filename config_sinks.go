@@ -0,0 +1,161 @@
+package veneur
+
+import "github.com/stripe/veneur/sinks"
+
+// MetricSinkOptions holds the options that apply to any metric sink,
+// keyed by the sink's name in the metric_sink_options section of the
+// config.
+type MetricSinkOptions struct {
+	// AllowNames are glob patterns of the metric names that the sink
+	// receives. If empty, it receives metrics of any name.
+	AllowNames []string `yaml:"allow_names"`
+	// DenyNames are glob patterns of metric names that the sink
+	// doesn't receive, even if they match AllowNames.
+	DenyNames []string `yaml:"deny_names"`
+	// RequireTags are glob patterns of tags; the sink only receives
+	// metrics with a tag matching each of them.
+	RequireTags []string `yaml:"require_tags"`
+	// ForbidTags are glob patterns of tags; the sink doesn't receive
+	// metrics with a tag matching any of them.
+	ForbidTags []string `yaml:"forbid_tags"`
+
+	// AddTags are tags added to each metric that the sink receives,
+	// as a map from tag keys to values. Tags with an empty value are
+	// added without one.
+	AddTags map[string]string `yaml:"add_tags"`
+	// Overwrite makes AddTags replace the metrics' own tags with the
+	// same keys. Otherwise, metrics keep their own tags.
+	Overwrite bool `yaml:"overwrite"`
+
+	// RetryMaxAttempts is the number of times that a flush to the
+	// sink is attempted in total. Flushes are not retried if it is
+	// less than 2.
+	RetryMaxAttempts int `yaml:"retry_max_attempts"`
+	// RetryBackoff is the time to wait before the first retry, as a
+	// duration string. Each retry waits twice as long as the
+	// previous one.
+	RetryBackoff string `yaml:"retry_backoff"`
+	// RetryMaxBackoff is the longest time to wait between retries.
+	RetryMaxBackoff string `yaml:"retry_max_backoff"`
+	// RetryTimeout bounds the time that all attempts of a flush may
+	// take. It defaults to the flush interval.
+	RetryTimeout string `yaml:"retry_timeout"`
+	// RetryFallbackFile is the path of a file that batches are
+	// appended to, as gzipped TSV, once all attempts to flush them
+	// have failed.
+	RetryFallbackFile string `yaml:"retry_fallback_file"`
+
+	// SpillDirectory is a directory that the batches that the sink
+	// fails to flush (after any retries) are written to, and replayed
+	// from once the sink recovers.
+	SpillDirectory string `yaml:"spill_directory"`
+	// SpillMaxBytes caps the size of the batches in SpillDirectory;
+	// the oldest are deleted to stay within it. It defaults to 100MiB.
+	SpillMaxBytes int64 `yaml:"spill_max_bytes"`
+
+	// AsyncQueueSize makes flushes to the sink asynchronous, with up
+	// to this many batches waiting to be flushed. Batches that don't
+	// fit in the queue are dropped.
+	AsyncQueueSize int `yaml:"async_queue_size"`
+	// AsyncWorkers is the number of goroutines that flush queued
+	// batches to the sink. It defaults to 1.
+	AsyncWorkers int `yaml:"async_workers"`
+
+	// FlushInterval is how often the sink is flushed, as a duration
+	// string. It is rounded up to a multiple of the server's flush
+	// interval, and the metrics of the flushes in between are
+	// re-aggregated; see sinks.BufferingSink for how. It defaults to
+	// the server's flush interval.
+	FlushInterval string `yaml:"flush_interval"`
+
+	// Sanitize configures how the names and tags of the metrics that
+	// the sink receives are sanitized, replacing the sink's own
+	// sanitizer, if it has one.
+	Sanitize *MetricSanitizeOptions `yaml:"sanitize"`
+
+	// HTTP gives the sink an HTTP client of its own, instead of the
+	// one that all sinks share. Its options that aren't set are those
+	// of the shared client. It applies to the span sink of the same
+	// name too, like the datadog, honeycomb or zipkin span sinks.
+	HTTP *HTTPClientOptions `yaml:"http"`
+}
+
+// HTTPClientOptions tune the connection pool of an HTTP client: the
+// one that HTTP sinks share, configured by the http_* settings, or one
+// of a metric sink's own.
+type HTTPClientOptions struct {
+	// MaxIdleConnsPerHost is the number of idle connections to each
+	// host that are kept open to be reused. It defaults to 16.
+	MaxIdleConnsPerHost int `yaml:"max_idle_conns_per_host"`
+	// IdleConnTimeout is how long an idle connection is kept open,
+	// as a duration string. It defaults to twice the flush interval.
+	IdleConnTimeout string `yaml:"idle_conn_timeout"`
+	// DisableKeepAlives closes each connection after one request.
+	DisableKeepAlives bool `yaml:"disable_keep_alives"`
+}
+
+// MetricSanitizeOptions configure the rules that a metric sink's
+// sanitizer applies to metric names, and to the keys and values of
+// tags. Without any of them set, metrics are left unchanged.
+type MetricSanitizeOptions struct {
+	// Lowercase converts names and tags to lower case.
+	Lowercase bool `yaml:"lowercase"`
+	// ReplaceDisallowed replaces any character other than the ASCII
+	// letters and digits, '.', '_', '-' and '/' with Replacement.
+	ReplaceDisallowed bool `yaml:"replace_disallowed"`
+	// Replacement is the character that replaces disallowed ones. It
+	// defaults to '_'.
+	Replacement string `yaml:"replacement"`
+	// CollapseSeparators replaces runs of '.', '_' or '-' with one,
+	// and trims them from the ends of names, tag keys and values.
+	CollapseSeparators bool `yaml:"collapse_separators"`
+	// StripEmptyTags drops tags without a key.
+	StripEmptyTags bool `yaml:"strip_empty_tags"`
+}
+
+func (o *MetricSanitizeOptions) rules() sinks.SanitizeRules {
+	rules := sinks.SanitizeRules{
+		Lowercase:          o.Lowercase,
+		CollapseSeparators: o.CollapseSeparators,
+		StripEmptyTags:     o.StripEmptyTags,
+	}
+	if o.ReplaceDisallowed {
+		rules.Allowed = sinks.ASCIIAllowed
+	}
+	for _, r := range o.Replacement {
+		rules.Replacement = r
+		break
+	}
+	return rules
+}
+
+// MetricRoute sends the metrics that match it to a set of metric sinks
+// or plugins, in the metric_routes section of the config. A metric
+// matches a route under the same rules as the filters of
+// MetricSinkOptions; a route without any patterns matches every
+// metric.
+type MetricRoute struct {
+	AllowNames  []string `yaml:"allow_names"`
+	DenyNames   []string `yaml:"deny_names"`
+	RequireTags []string `yaml:"require_tags"`
+	ForbidTags  []string `yaml:"forbid_tags"`
+
+	// Sinks are the names of the metric sinks and plugins that
+	// receive the matching metrics. Metrics that match a route
+	// without any sinks are dropped.
+	Sinks []string `yaml:"sinks"`
+}
+
+// RegisteredSinkConfig configures a sink of a kind that was registered
+// with sinks.RegisterMetricSink or sinks.RegisterSpanSink, in the
+// metric_sinks and span_sinks sections of the config.
+type RegisteredSinkConfig struct {
+	// Kind is the name that the sink's factory was registered under.
+	Kind string `yaml:"kind"`
+	// Name is the name of the sink, which defaults to Kind. Sinks of
+	// the same kind need distinct names.
+	Name string `yaml:"name"`
+	// Config is passed on to the sink's factory, which decodes it
+	// with sinks.SinkConfig.Decode.
+	Config map[string]interface{} `yaml:"config"`
+}
@@ -1,12 +1,18 @@
 package veneur
 
 import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestReadConfig(t *testing.T) {
@@ -89,6 +95,72 @@ func TestHostname(t *testing.T) {
 	assert.Equal(t, c.Hostname, "", "Should have respected omit_empty_hostname")
 }
 
+func TestHostnameSources(t *testing.T) {
+	currentHost, err := os.Hostname()
+	require.NoError(t, err)
+
+	metadata := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/token" && r.Method == http.MethodPut:
+			w.Write([]byte("secret"))
+		case r.URL.Path == "/ec2" && r.Header.Get("X-aws-ec2-metadata-token") == "secret":
+			w.Write([]byte("ip-10-0-0-1.ec2.internal\n"))
+		case r.URL.Path == "/gce" && r.Header.Get("Metadata-Flavor") == "Google":
+			w.Write([]byte("instance-1.c.project.internal"))
+		default:
+			w.WriteHeader(http.StatusForbidden)
+		}
+	}))
+	defer metadata.Close()
+	defer func(endpoints map[string]metadataEndpoint) {
+		hostnameMetadataEndpoints = endpoints
+	}(hostnameMetadataEndpoints)
+	hostnameMetadataEndpoints = map[string]metadataEndpoint{
+		"ec2":    {url: metadata.URL + "/ec2", tokenURL: metadata.URL + "/token"},
+		"gce":    {url: metadata.URL + "/gce", header: map[string]string{"Metadata-Flavor": "Google"}},
+		"broken": {url: metadata.URL + "/broken"},
+	}
+
+	dir, err := ioutil.TempDir("", "veneur-hostname")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "hostname")
+	require.NoError(t, ioutil.WriteFile(path, []byte("from-file\n"), 0644))
+
+	const envVar = "VENEUR_TEST_HOSTNAME"
+	os.Setenv(envVar, "from-env")
+	defer os.Unsetenv(envVar)
+
+	tests := []struct {
+		name     string
+		conf     Config
+		hostname string
+	}{
+		{"static", Config{Hostname: "static", HostnameEnv: envVar}, "static"},
+		{"env", Config{HostnameEnv: envVar, HostnameFile: path}, "from-env"},
+		{"unset env", Config{HostnameEnv: "VENEUR_TEST_UNSET", HostnameFile: path}, "from-file"},
+		{"file", Config{HostnameFile: path, HostnameMetadata: "gce"}, "from-file"},
+		{"missing file", Config{HostnameFile: filepath.Join(dir, "missing"), HostnameMetadata: "gce"}, "instance-1.c.project.internal"},
+		{"ec2", Config{HostnameMetadata: "ec2"}, "ip-10-0-0-1.ec2.internal"},
+		{"failing metadata", Config{HostnameMetadata: "broken"}, currentHost},
+		{"failing metadata, omitted", Config{HostnameMetadata: "broken", OmitEmptyHostname: true}, ""},
+		{"none", Config{}, currentHost},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.hostname, test.conf.resolveHostname())
+		})
+	}
+}
+
+func TestHostnameMetadataUnknownProvider(t *testing.T) {
+	conf := localConfig()
+	conf.HostnameMetadata = "nimbus"
+	_, err := NewFromConfig(logrus.New(), conf)
+	assert.Error(t, err)
+}
+
 func TestConfigDefaults(t *testing.T) {
 	const emptyConfig = "---"
 	r := strings.NewReader(emptyConfig)
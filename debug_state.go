@@ -0,0 +1,256 @@
+package veneur
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/stripe/veneur/samplers"
+)
+
+// defaultStateLimit and maxStateLimit bound the number of series that
+// /debug/state returns. Each worker stalls while it copies its share of
+// the series, so the maximum also bounds the stall.
+const (
+	defaultStateLimit = 1000
+	maxStateLimit     = 10000
+)
+
+// defaultMetricLimit is the number of tag sets that /debug/metric
+// returns, unless asked for more.
+const defaultMetricLimit = 100
+
+// defaultStatePercentiles are the percentiles that /debug/metric
+// reports if the server has none configured.
+var defaultStatePercentiles = []float64{0.5, 0.75, 0.99}
+
+// SeriesState is a snapshot of one series that a worker is aggregating,
+// as served by /debug/state and /debug/metric. Only the fields that
+// apply to the series' type are set: the value of counters and gauges,
+// the count, min and max of histograms and timers (and, for
+// /debug/metric, their sum, percentiles and reservoir of raw values),
+// and the cardinality of sets.
+type SeriesState struct {
+	Name   string   `json:"name"`
+	Tags   []string `json:"tags,omitempty"`
+	Type   string   `json:"type"`
+	Scope  string   `json:"scope"`
+	Worker int      `json:"worker"`
+	Value  *float64 `json:"value,omitempty"`
+	Count  *float64 `json:"count,omitempty"`
+	Min    *float64 `json:"min,omitempty"`
+	Max    *float64 `json:"max,omitempty"`
+	Sum    *float64 `json:"sum,omitempty"`
+	// Percentiles maps names like "p99" or "p99_9" to the estimated
+	// percentile.
+	Percentiles map[string]float64 `json:"percentiles,omitempty"`
+	// Reservoir is the sample of raw values that a histogram or timer
+	// retains, if histogram_reservoirs configures one for it, in
+	// ascending order.
+	Reservoir   []float64 `json:"reservoir,omitempty"`
+	Cardinality *uint64   `json:"cardinality,omitempty"`
+}
+
+// StateDump is the state of the series that the workers have
+// aggregated since the last flush, sorted by name, or by tags if they
+// are all of one metric.
+type StateDump struct {
+	Time   time.Time     `json:"time"`
+	Series []SeriesState `json:"series"`
+	// Truncated is set if more series matched than the limit allows.
+	Truncated bool `json:"truncated"`
+}
+
+// State returns a snapshot of the series that the workers have
+// aggregated since the last flush, whose names accept allows (all of
+// them if it is nil), up to limit series.
+func (s *Server) State(accept func(name string) bool, limit int) StateDump {
+	dump := StateDump{Time: time.Now(), Series: []SeriesState{}}
+	for _, w := range s.Workers {
+		var truncated bool
+		dump.Series, truncated = w.State(dump.Series, accept, limit, nil)
+		if truncated {
+			dump.Truncated = true
+			break
+		}
+	}
+	sort.SliceStable(dump.Series, func(i, j int) bool { return dump.Series[i].Name < dump.Series[j].Name })
+	return dump
+}
+
+// MetricState returns a snapshot of the series named name, across all
+// of their tag sets, up to limit series. Histograms and timers include
+// their sum, the server's percentiles and their reservoir.
+func (s *Server) MetricState(name string, limit int) StateDump {
+	percentiles := s.HistogramPercentiles
+	if len(percentiles) == 0 {
+		percentiles = defaultStatePercentiles
+	}
+	accept := func(n string) bool { return n == name }
+	dump := StateDump{Time: time.Now(), Series: []SeriesState{}}
+	for _, w := range s.Workers {
+		var truncated bool
+		dump.Series, truncated = w.State(dump.Series, accept, limit, percentiles)
+		if truncated {
+			dump.Truncated = true
+			break
+		}
+	}
+	sort.SliceStable(dump.Series, func(i, j int) bool {
+		return strings.Join(dump.Series[i].Tags, ",") < strings.Join(dump.Series[j].Tags, ",")
+	})
+	return dump
+}
+
+// seriesSummary is what Worker.State copies of a series while it holds
+// the worker's lock. It is turned into a SeriesState after the lock is
+// released.
+type seriesSummary struct {
+	name  string
+	tags  []string
+	typ   string
+	scope samplers.MetricScope
+	// value is the value of a counter or gauge.
+	value                float64
+	count, min, max, sum float64
+	cardinality          uint64
+	percentiles          []float64
+	reservoir            []float64
+}
+
+// State appends a snapshot of the worker's series whose names accept
+// allows to series, until there are limit of them, and returns whether
+// it stopped at the limit. If percentiles are given, histograms and
+// timers include their sum and those percentiles.
+//
+// The worker can't process metrics while its lock is held, so only the
+// numbers of each sampler are copied under the lock, and at most limit
+// of them; the snapshot is formatted after the lock is released.
+func (w *Worker) State(series []SeriesState, accept func(name string) bool, limit int, percentiles []float64) ([]SeriesState, bool) {
+	summaries, truncated := w.summarize(accept, limit-len(series), percentiles)
+	for i := range summaries {
+		sum := &summaries[i]
+		st := SeriesState{
+			Name:   sum.name,
+			Tags:   sum.tags,
+			Type:   sum.typ,
+			Scope:  scopeName(sum.scope),
+			Worker: w.id,
+		}
+		switch sum.typ {
+		case counterTypeName, gaugeTypeName:
+			st.Value = &sum.value
+		case histogramTypeName, timerTypeName:
+			st.Count = &sum.count
+			if sum.count > 0 {
+				st.Min, st.Max = &sum.min, &sum.max
+				if percentiles != nil {
+					st.Sum = &sum.sum
+					st.Percentiles = make(map[string]float64, len(percentiles))
+					for j, p := range percentiles {
+						st.Percentiles[samplers.PercentileNamingShort.Suffix(p)] = sum.percentiles[j]
+					}
+					st.Reservoir = sum.reservoir
+				}
+			}
+		case setTypeName:
+			st.Cardinality = &sum.cardinality
+		}
+		series = append(series, st)
+	}
+	return series, truncated
+}
+
+// summarize copies the numbers of up to limit of the worker's series
+// whose names accept allows, and returns whether there were more.
+func (w *Worker) summarize(accept func(name string) bool, limit int, percentiles []float64) ([]seriesSummary, bool) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	var summaries []seriesSummary
+	add := func(sum seriesSummary) bool {
+		if accept != nil && !accept(sum.name) {
+			return true
+		}
+		if len(summaries) >= limit {
+			return false
+		}
+		summaries = append(summaries, sum)
+		return true
+	}
+	counters := func(ms map[samplers.MetricKey]*samplers.Counter, scope samplers.MetricScope) bool {
+		for _, c := range ms {
+			if !add(seriesSummary{name: c.Name, tags: c.Tags, typ: counterTypeName, scope: scope, value: float64(c.Value())}) {
+				return false
+			}
+		}
+		return true
+	}
+	gauges := func(ms map[samplers.MetricKey]*samplers.Gauge, scope samplers.MetricScope) bool {
+		for _, g := range ms {
+			if !add(seriesSummary{name: g.Name, tags: g.Tags, typ: gaugeTypeName, scope: scope, value: g.Value()}) {
+				return false
+			}
+		}
+		return true
+	}
+	histos := func(ms map[samplers.MetricKey]*samplers.Histo, typ string, scope samplers.MetricScope) bool {
+		for _, h := range ms {
+			// skip the percentiles of the series that aren't asked for:
+			if accept != nil && !accept(h.Name) {
+				continue
+			}
+			sum := seriesSummary{name: h.Name, tags: h.Tags, typ: typ, scope: scope, count: h.Value.Count()}
+			if sum.count > 0 {
+				sum.min, sum.max = h.Value.Min(), h.Value.Max()
+				if percentiles != nil {
+					sum.sum = h.Value.Sum()
+					sum.percentiles = make([]float64, len(percentiles))
+					for i, p := range percentiles {
+						sum.percentiles[i] = h.Value.Quantile(p)
+					}
+					if h.Reservoir != nil {
+						sum.reservoir = h.Reservoir.Values()
+					}
+				}
+			}
+			if !add(sum) {
+				return false
+			}
+		}
+		return true
+	}
+	sets := func(ms map[samplers.MetricKey]*samplers.Set, scope samplers.MetricScope) bool {
+		for _, set := range ms {
+			if !add(seriesSummary{name: set.Name, tags: set.Tags, typ: setTypeName, scope: scope, cardinality: set.Hll.Estimate()}) {
+				return false
+			}
+		}
+		return true
+	}
+
+	wm := w.wm
+	complete := counters(wm.counters, samplers.MixedScope) &&
+		counters(wm.globalCounters, samplers.GlobalOnly) &&
+		gauges(wm.gauges, samplers.MixedScope) &&
+		gauges(wm.globalGauges, samplers.GlobalOnly) &&
+		histos(wm.histograms, histogramTypeName, samplers.MixedScope) &&
+		histos(wm.globalHistograms, histogramTypeName, samplers.GlobalOnly) &&
+		histos(wm.localHistograms, histogramTypeName, samplers.LocalOnly) &&
+		histos(wm.timers, timerTypeName, samplers.MixedScope) &&
+		histos(wm.globalTimers, timerTypeName, samplers.GlobalOnly) &&
+		histos(wm.localTimers, timerTypeName, samplers.LocalOnly) &&
+		sets(wm.sets, samplers.MixedScope) &&
+		sets(wm.localSets, samplers.LocalOnly)
+	return summaries, !complete
+}
+
+func scopeName(scope samplers.MetricScope) string {
+	switch scope {
+	case samplers.LocalOnly:
+		return "local"
+	case samplers.GlobalOnly:
+		return "global"
+	}
+	return "mixed"
+}
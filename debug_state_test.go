@@ -0,0 +1,106 @@
+package veneur
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stripe/veneur/samplers"
+)
+
+func TestServerState(t *testing.T) {
+	w := NewWorker(1, nil, logrus.New(), nil, nil, 0)
+	s := &Server{Workers: []*Worker{w}}
+
+	process := func(name, typ string, value interface{}, scope samplers.MetricScope, tags ...string) {
+		w.ProcessMetric(&samplers.UDPMetric{
+			MetricKey:  samplers.MetricKey{Name: name, Type: typ, JoinedTags: fmt.Sprint(tags)},
+			Tags:       tags,
+			Value:      value,
+			SampleRate: 1.0,
+			Scope:      scope,
+		})
+	}
+	process("a.counter", counterTypeName, 2.0, samplers.MixedScope, "env:prod")
+	process("a.counter", counterTypeName, 3.0, samplers.MixedScope, "env:prod")
+	process("b.gauge", gaugeTypeName, 7.5, samplers.GlobalOnly)
+	process("c.histogram", histogramTypeName, 1.0, samplers.MixedScope)
+	process("c.histogram", histogramTypeName, 4.0, samplers.MixedScope)
+	process("d.set", setTypeName, "x", samplers.LocalOnly)
+	process("d.set", setTypeName, "y", samplers.LocalOnly)
+	process("d.set", setTypeName, "x", samplers.LocalOnly)
+
+	value := func(f float64) *float64 { return &f }
+	cardinality := uint64(2)
+	dump := s.State(nil, defaultStateLimit)
+	assert.False(t, dump.Truncated)
+	assert.Equal(t, []SeriesState{
+		{Name: "a.counter", Tags: []string{"env:prod"}, Type: "counter", Scope: "mixed", Worker: 1, Value: value(5)},
+		{Name: "b.gauge", Type: "gauge", Scope: "global", Worker: 1, Value: value(7.5)},
+		{Name: "c.histogram", Type: "histogram", Scope: "mixed", Worker: 1, Count: value(2), Min: value(1), Max: value(4)},
+		{Name: "d.set", Type: "set", Scope: "local", Worker: 1, Cardinality: &cardinality},
+	}, dump.Series)
+
+	dump = s.State(func(name string) bool { return name == "b.gauge" }, defaultStateLimit)
+	require.Len(t, dump.Series, 1)
+	assert.Equal(t, "b.gauge", dump.Series[0].Name)
+
+	dump = s.State(nil, 2)
+	assert.True(t, dump.Truncated)
+	assert.Len(t, dump.Series, 2)
+
+	w.Flush()
+	assert.Empty(t, s.State(nil, defaultStateLimit).Series, "flushed series shouldn't be in the state")
+}
+
+func TestDebugStateEndpoint(t *testing.T) {
+	w := NewWorker(0, nil, logrus.New(), nil, nil, 0)
+	s := &Server{Workers: []*Worker{w}}
+	for _, name := range []string{"api.requests", "api.errors", "db.queries"} {
+		w.ProcessMetric(&samplers.UDPMetric{
+			MetricKey:  samplers.MetricKey{Name: name, Type: counterTypeName},
+			Value:      1.0,
+			SampleRate: 1.0,
+		})
+	}
+	handler := s.AdminHandler()
+
+	get := func(url string) (int, StateDump) {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, url, nil))
+		var dump StateDump
+		if rec.Code == http.StatusOK {
+			assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+			require.NoError(t, json.NewDecoder(rec.Body).Decode(&dump))
+		}
+		return rec.Code, dump
+	}
+
+	code, dump := get("/debug/state")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Len(t, dump.Series, 3)
+
+	code, dump = get("/debug/state?name=api.*")
+	assert.Equal(t, http.StatusOK, code)
+	if assert.Len(t, dump.Series, 2) {
+		assert.Equal(t, "api.errors", dump.Series[0].Name)
+		assert.Equal(t, "api.requests", dump.Series[1].Name)
+	}
+
+	code, dump = get("/debug/state?limit=1")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Len(t, dump.Series, 1)
+	assert.True(t, dump.Truncated)
+
+	code, _ = get("/debug/state?limit=zero")
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	rec := httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/state", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code, "the state should only be served on the admin listener")
+}
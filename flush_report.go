@@ -0,0 +1,65 @@
+package veneur
+
+import (
+	"sort"
+	"time"
+)
+
+// SinkFlushResult is the outcome of passing a flush's metrics to one
+// metric sink. A sink accepts or rejects its metrics as a whole, so
+// either all of them succeeded or all of them failed.
+type SinkFlushResult struct {
+	Sink      string        `json:"sink"`
+	Attempted int           `json:"attempted"`
+	Succeeded int           `json:"succeeded"`
+	Failed    int           `json:"failed"`
+	Duration  time.Duration `json:"duration_ns"`
+	Error     string        `json:"error,omitempty"`
+}
+
+// FlushReport summarizes a flush to the metric sinks. The last one is
+// served as JSON at /flush/last.
+type FlushReport struct {
+	Time     time.Time     `json:"time"`
+	Duration time.Duration `json:"duration_ns"`
+	// Metrics is the number of metrics that the flush produced, before
+	// they were routed and filtered for each sink.
+	Metrics     int               `json:"metrics"`
+	FailedSinks int               `json:"failed_sinks"`
+	Sinks       []SinkFlushResult `json:"sinks"`
+}
+
+// newFlushReport returns the report of a flush that started at start,
+// with the results sorted by sink name.
+func newFlushReport(start time.Time, metrics int, results []SinkFlushResult) FlushReport {
+	sort.Slice(results, func(i, j int) bool { return results[i].Sink < results[j].Sink })
+	report := FlushReport{
+		Time:     start,
+		Duration: time.Since(start),
+		Metrics:  metrics,
+		Sinks:    results,
+	}
+	for _, result := range results {
+		if result.Failed > 0 {
+			report.FailedSinks++
+		}
+	}
+	return report
+}
+
+// LastFlush returns the report of the most recent flush to the metric
+// sinks, and false if there hasn't been one.
+func (s *Server) LastFlush() (FlushReport, bool) {
+	s.lastFlushMtx.Lock()
+	defer s.lastFlushMtx.Unlock()
+	if s.lastFlush == nil {
+		return FlushReport{}, false
+	}
+	return *s.lastFlush, true
+}
+
+func (s *Server) setLastFlush(report FlushReport) {
+	s.lastFlushMtx.Lock()
+	defer s.lastFlushMtx.Unlock()
+	s.lastFlush = &report
+}
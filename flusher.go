@@ -14,6 +14,7 @@ import (
 	"github.com/sirupsen/logrus"
 	"github.com/stripe/veneur/forwardrpc"
 	vhttp "github.com/stripe/veneur/http"
+	"github.com/stripe/veneur/internal/idempotency"
 	"github.com/stripe/veneur/samplers"
 	"github.com/stripe/veneur/samplers/metricpb"
 	"github.com/stripe/veneur/sinks"
@@ -25,26 +26,32 @@ import (
 
 // Flush collects sampler's metrics and passes them to sinks.
 func (s *Server) Flush(ctx context.Context) {
+	s.flush(ctx)
+}
+
+// flush is Flush, and returns the number of metrics that it passed to
+// the sinks. The traces, forwarded metrics and plugins are flushed in
+// the background; wait on s.flushes for them to finish.
+func (s *Server) flush(ctx context.Context) int {
 	span := tracer.StartSpan("flush").(*trace.Span)
 	defer span.ClientFinish(s.TraceClient)
 
 	mem := &runtime.MemStats{}
 	runtime.ReadMemStats(mem)
 
-	s.Statsd.Gauge("worker.span_chan.total_elements", float64(len(s.SpanChan)), nil, 1.0)
-	s.Statsd.Gauge("worker.span_chan.total_capacity", float64(cap(s.SpanChan)), nil, 1.0)
+	s.reportIngestQueues()
 	s.Statsd.Gauge("gc.number", float64(mem.NumGC), nil, 1.0)
 	s.Statsd.Gauge("gc.pause_total_ns", float64(mem.PauseTotalNs), nil, 1.0)
 	s.Statsd.Gauge("mem.heap_alloc_bytes", float64(mem.HeapAlloc), nil, 1.0)
 
 	samples := s.EventWorker.Flush()
+	s.flushOtherSamples(span.Attach(ctx), samples)
 
-	// TODO Concurrency
-	for _, sink := range s.metricSinks {
-		sink.FlushOtherSamples(span.Attach(ctx), samples)
-	}
-
-	go s.flushTraces(span.Attach(ctx))
+	s.flushes.Add(1)
+	go func() {
+		defer s.flushes.Done()
+		s.flushTraces(span.Attach(ctx))
+	}()
 
 	var finalMetrics []samplers.InterMetric
 
@@ -64,6 +71,8 @@ func (s *Server) Flush(ctx context.Context) {
 	}
 
 	tempMetrics, ms := s.tallyMetrics(percentiles)
+	s.reportCardinality()
+	s.Statsd.Gauge("mem.histogram_bytes", float64(ms.histogramBytes), nil, 1.0)
 
 	finalMetrics = s.generateInterMetrics(span.Attach(ctx), percentiles, aggregates, tempMetrics, ms)
 
@@ -71,48 +80,231 @@ func (s *Server) Flush(ctx context.Context) {
 
 	if s.IsLocal() {
 		// Forward over gRPC or HTTP depending on the configuration
-		if s.forwardUseGRPC {
-			go s.forwardGRPC(span.Attach(ctx), tempMetrics)
-		} else {
-			go s.flushForward(span.Attach(ctx), tempMetrics)
-		}
+		s.flushes.Add(1)
+		go func() {
+			defer s.flushes.Done()
+			if s.forwardUseGRPC {
+				s.forwardGRPC(span.Attach(ctx), tempMetrics)
+			} else {
+				s.flushForward(span.Attach(ctx), tempMetrics)
+			}
+		}()
 	} else {
 		s.reportGlobalMetricsFlushCounts(ms)
 	}
 
 	// If there's nothing to flush, don't bother calling the plugins and stuff.
 	if len(finalMetrics) == 0 {
-		return
+		return 0
 	}
 
-	wg := sync.WaitGroup{}
-	for _, sink := range s.metricSinks {
-		wg.Add(1)
-		go func(ms sinks.MetricSink) {
-			err := ms.Flush(span.Attach(ctx), finalMetrics)
-			if err != nil {
-				log.WithError(err).WithField("sink", ms.Name()).Warn("Error flushing sink")
-			}
-			wg.Done()
-		}(sink)
-	}
-	wg.Wait()
+	s.setLastFlush(s.flushSinks(span.Attach(ctx), finalMetrics))
 
+	s.flushes.Add(1)
 	go func() {
+		defer s.flushes.Done()
 		samples := &ssf.Samples{}
 		defer metrics.Report(s.TraceClient, samples)
 
+		var routed map[string][]samplers.InterMetric
+		if router := s.currentSinks().metricRouter; router != nil {
+			routed = router.Route(finalMetrics)
+		}
+
 		tags := map[string]string{"part": "post"}
 		for _, p := range s.getPlugins() {
+			pluginMetrics := finalMetrics
+			if routed != nil {
+				pluginMetrics = routed[p.Name()]
+				if len(pluginMetrics) == 0 {
+					continue
+				}
+			}
 			start := time.Now()
-			err := p.Flush(span.Attach(ctx), finalMetrics)
+			err := p.Flush(span.Attach(ctx), pluginMetrics)
 			samples.Add(ssf.Timing(fmt.Sprintf("flush.plugins.%s.total_duration_ns", p.Name()), time.Since(start), time.Nanosecond, tags))
 			if err != nil {
 				samples.Add(ssf.Count(fmt.Sprintf("flush.plugins.%s.error_total", p.Name()), 1, nil))
 			}
-			samples.Add(ssf.Gauge(fmt.Sprintf("flush.plugins.%s.post_metrics_total", p.Name()), float32(len(finalMetrics)), nil))
+			samples.Add(ssf.Gauge(fmt.Sprintf("flush.plugins.%s.post_metrics_total", p.Name()), float32(len(pluginMetrics)), nil))
+		}
+	}()
+	return len(finalMetrics)
+}
+
+// flushSemaphore bounds the number of sinks that flush at once. A nil
+// one doesn't.
+type flushSemaphore chan struct{}
+
+func newFlushSemaphore(max int) flushSemaphore {
+	if max < 1 {
+		return nil
+	}
+	return make(flushSemaphore, max)
+}
+
+// acquire waits for a slot, and returns ctx's error if ctx is done
+// first.
+func (fs flushSemaphore) acquire(ctx context.Context) error {
+	if fs == nil {
+		return nil
+	}
+	select {
+	case fs <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (fs flushSemaphore) release() {
+	if fs != nil {
+		<-fs
+	}
+}
+
+// flushOtherSamples passes the events and service checks to each metric
+// sink concurrently, up to flush_max_concurrency at once, and waits for
+// them to finish.
+func (s *Server) flushOtherSamples(ctx context.Context, samples []ssf.SSFSample) {
+	sem := newFlushSemaphore(s.flushMaxConcurrency)
+	wg := sync.WaitGroup{}
+	for _, sink := range s.currentSinks().metricSinks {
+		wg.Add(1)
+		go func(ms sinks.MetricSink) {
+			defer wg.Done()
+			if sem.acquire(ctx) != nil {
+				return
+			}
+			defer sem.release()
+			ms.FlushOtherSamples(ctx, samples)
+		}(sink)
+	}
+	wg.Wait()
+}
+
+// flushSinks passes the metrics to each metric sink concurrently, up to
+// flush_max_concurrency at once, and waits for them to finish, for up
+// to the flush timeout. A sink that is still waiting for its turn at
+// the timeout fails. Each sink receives only the metrics that are
+// routed to it, if routes are configured, and that pass its filter, if
+// it has one, with its configured tags added to copies of them. It
+// returns a report of how each sink fared.
+func (s *Server) flushSinks(ctx context.Context, metrics []samplers.InterMetric) FlushReport {
+	start := time.Now()
+	if s.flushTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.flushTimeout)
+		defer cancel()
+	}
+	set := s.currentSinks()
+	var routed map[string][]samplers.InterMetric
+	if set.metricRouter != nil {
+		routed = set.metricRouter.Route(metrics)
+	}
+	sem := newFlushSemaphore(s.flushMaxConcurrency)
+	wg := sync.WaitGroup{}
+	results := make(chan SinkFlushResult, len(set.metricSinks))
+	for _, sink := range set.metricSinks {
+		sinkMetrics := metrics
+		if routed != nil {
+			sinkMetrics = routed[sink.Name()]
+			if len(sinkMetrics) == 0 {
+				continue
+			}
+		}
+		if filter, ok := set.metricSinkFilters[sink.Name()]; ok {
+			sinkMetrics = filter.Filter(sinkMetrics)
+			if len(sinkMetrics) == 0 {
+				continue
+			}
 		}
+		if injector, ok := set.metricSinkTags[sink.Name()]; ok {
+			sinkMetrics = injector.Inject(sinkMetrics)
+		}
+		if sanitizer, ok := set.metricSinkSanitizers[sink.Name()]; ok {
+			sinkMetrics = sinks.Sanitize(sanitizer, sinkMetrics)
+		}
+		wg.Add(1)
+		go func(ms sinks.MetricSink, metrics []samplers.InterMetric) {
+			err := sem.acquire(ctx)
+			start := time.Now()
+			if err == nil {
+				err = flushSink(ctx, ms, metrics)
+				sem.release()
+			}
+			took := time.Since(start)
+			result := SinkFlushResult{
+				Sink:      ms.Name(),
+				Attempted: len(metrics),
+				Succeeded: len(metrics),
+				Duration:  took,
+			}
+			if err != nil {
+				log.WithError(err).WithField("sink", ms.Name()).Warn("Error flushing sink")
+				result.Succeeded = 0
+				result.Failed = len(metrics)
+				result.Error = err.Error()
+			}
+			s.reportSinkFlush(ms.Name(), metrics, took, err)
+			results <- result
+			wg.Done()
+		}(sink, sinkMetrics)
+	}
+	wg.Wait()
+	close(results)
+
+	report := make([]SinkFlushResult, 0, len(results))
+	for result := range results {
+		report = append(report, result)
+	}
+	return newFlushReport(start, len(metrics), report)
+}
+
+// flushSink flushes the metrics to the sink, and gives up once ctx is
+// done, even if the sink doesn't notice: a sink that hangs keeps its
+// Flush running in the background, but doesn't hold up the others or
+// the next flush.
+func flushSink(ctx context.Context, sink sinks.MetricSink, metrics []samplers.InterMetric) error {
+	errs := make(chan error, 1)
+	go func() {
+		errs <- sink.Flush(ctx, metrics)
 	}()
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+		select {
+		case err := <-errs:
+			return err
+		default:
+			return ctx.Err()
+		}
+	}
+}
+
+// reportSinkFlush reports how long a metric sink took to flush, how
+// many metrics of each type it was passed and whether it failed.
+func (s *Server) reportSinkFlush(name string, flushed []samplers.InterMetric, took time.Duration, err error) {
+	samples := &ssf.Samples{}
+	defer metrics.Report(s.TraceClient, samples)
+
+	tags := map[string]string{"sink": name}
+	samples.Add(ssf.Timing(sinks.MetricKeySinkFlushDuration, took, time.Nanosecond, tags))
+	if err != nil {
+		samples.Add(ssf.Count(sinks.MetricKeySinkFlushErrors, 1, tags))
+	}
+
+	counts := map[samplers.MetricType]int{}
+	for _, m := range flushed {
+		counts[m.Type]++
+	}
+	for typ, n := range counts {
+		// "CounterMetric" becomes "counter":
+		typeName := strings.ToLower(strings.TrimSuffix(typ.String(), "Metric"))
+		samples.Add(ssf.Count(sinks.MetricKeySinkMetricsFlushed, float32(n),
+			map[string]string{"sink": name, "metric_type": typeName}))
+	}
 }
 
 type metricsSummary struct {
@@ -133,6 +325,10 @@ type metricsSummary struct {
 	totalLocalStatusChecks int
 
 	totalLength int
+
+	// histogramBytes estimates the memory that the t-digests of all
+	// histograms and timers took up.
+	histogramBytes int
 }
 
 // tallyMetrics gives a slight overestimate of the number
@@ -167,9 +363,15 @@ func (s *Server) tallyMetrics(percentiles []float64) ([]WorkerMetrics, metricsSu
 		ms.totalLocalTimers += len(wm.localTimers)
 
 		ms.totalLocalStatusChecks += len(wm.localStatusChecks)
+
+		ms.histogramBytes += wm.histogramBytes()
 	}
 
-	ms.totalLength = ms.totalCounters + ms.totalGauges +
+	counters := ms.totalCounters
+	if s.counterRates == samplers.CounterRatesAlongside {
+		counters *= 2
+	}
+	ms.totalLength = counters + ms.totalGauges +
 		// histograms and timers each report a metric point for each percentile
 		// plus a point for each of their aggregates
 		(ms.totalTimers+ms.totalHistograms)*(s.HistogramAggregates.Count+len(percentiles)) +
@@ -178,6 +380,10 @@ func (s *Server) tallyMetrics(percentiles []float64) ([]WorkerMetrics, metricsSu
 		// remember that both the global veneur and the local instances have
 		// 'local-only' histograms.
 		ms.totalLocalSets + (ms.totalLocalTimers+ms.totalLocalHistograms)*(s.HistogramAggregates.Count+len(s.HistogramPercentiles))
+	if len(s.HistogramBuckets) > 0 {
+		// plus the buckets, and the +Inf bucket
+		ms.totalLength += (ms.totalTimers + ms.totalHistograms + ms.totalLocalTimers + ms.totalLocalHistograms) * (len(s.HistogramBuckets) + 1)
+	}
 
 	// Global instances also flush sets and global counters, so be sure and add
 	// them to the total size
@@ -187,6 +393,9 @@ func (s *Server) tallyMetrics(percentiles []float64) ([]WorkerMetrics, metricsSu
 		ms.totalLength += ms.totalGlobalGauges
 		ms.totalLength += ms.totalGlobalHistograms * (s.HistogramAggregates.Count + len(s.HistogramPercentiles))
 		ms.totalLength += ms.totalGlobalTimers * (s.HistogramAggregates.Count + len(s.HistogramPercentiles))
+		if len(s.HistogramBuckets) > 0 {
+			ms.totalLength += (ms.totalGlobalHistograms + ms.totalGlobalTimers) * (len(s.HistogramBuckets) + 1)
+		}
 	}
 
 	return tempMetrics, ms
@@ -200,10 +409,17 @@ func (s *Server) generateInterMetrics(ctx context.Context, percentiles []float64
 	span, _ := trace.StartSpanFromContext(ctx, "")
 	defer span.ClientFinish(s.TraceClient)
 
+	// buckets, like percentiles, are only accurate when aggregated
+	// globally
+	var buckets []float64
+	if !s.IsLocal() {
+		buckets = s.HistogramBuckets
+	}
+
 	finalMetrics := make([]samplers.InterMetric, 0, ms.totalLength)
 	for _, wm := range tempMetrics {
 		for _, c := range wm.counters {
-			finalMetrics = append(finalMetrics, c.Flush(s.interval)...)
+			finalMetrics = append(finalMetrics, s.flushCounter(c, wm.elapsed)...)
 		}
 		for _, g := range wm.gauges {
 			finalMetrics = append(finalMetrics, g.Flush()...)
@@ -213,10 +429,14 @@ func (s *Server) generateInterMetrics(ctx context.Context, percentiles []float64
 		//
 		// if we're a global veneur, aggregates will be nil.
 		for _, h := range wm.histograms {
-			finalMetrics = append(finalMetrics, h.Flush(s.interval, percentiles, s.HistogramAggregates, false)...)
+			aggregates, percentiles := s.histogramAggregates(h.Name, percentiles, true)
+			finalMetrics = append(finalMetrics, h.Flush(s.interval, percentiles, aggregates, false)...)
+			finalMetrics = append(finalMetrics, h.FlushBuckets(buckets)...)
 		}
 		for _, t := range wm.timers {
-			finalMetrics = append(finalMetrics, t.Flush(s.interval, percentiles, s.HistogramAggregates, false)...)
+			aggregates, percentiles := s.histogramAggregates(t.Name, percentiles, true)
+			finalMetrics = append(finalMetrics, t.Flush(s.interval, percentiles, aggregates, false)...)
+			finalMetrics = append(finalMetrics, t.FlushBuckets(buckets)...)
 		}
 
 		// local-only samplers should be flushed in their entirety, since they
@@ -224,13 +444,17 @@ func (s *Server) generateInterMetrics(ctx context.Context, percentiles []float64
 		// we still want percentiles for these, even if we're a local veneur, so
 		// we use the original percentile list when flushing them
 		for _, h := range wm.localHistograms {
-			finalMetrics = append(finalMetrics, h.Flush(s.interval, s.HistogramPercentiles, s.HistogramAggregates, false)...)
+			aggregates, percentiles := s.histogramAggregates(h.Name, s.HistogramPercentiles, false)
+			finalMetrics = append(finalMetrics, h.Flush(s.interval, percentiles, aggregates, false)...)
+			finalMetrics = append(finalMetrics, h.FlushBuckets(s.HistogramBuckets)...)
 		}
 		for _, s := range wm.localSets {
 			finalMetrics = append(finalMetrics, s.Flush()...)
 		}
 		for _, t := range wm.localTimers {
-			finalMetrics = append(finalMetrics, t.Flush(s.interval, s.HistogramPercentiles, s.HistogramAggregates, false)...)
+			aggregates, percentiles := s.histogramAggregates(t.Name, s.HistogramPercentiles, false)
+			finalMetrics = append(finalMetrics, t.Flush(s.interval, percentiles, aggregates, false)...)
+			finalMetrics = append(finalMetrics, t.FlushBuckets(s.HistogramBuckets)...)
 		}
 
 		for _, status := range wm.localStatusChecks {
@@ -250,7 +474,7 @@ func (s *Server) generateInterMetrics(ctx context.Context, percentiles []float64
 			// global counters have no local parts, so if we're a local veneur,
 			// there's nothing to flush
 			for _, gc := range wm.globalCounters {
-				finalMetrics = append(finalMetrics, gc.Flush(s.interval)...)
+				finalMetrics = append(finalMetrics, s.flushCounter(gc, wm.elapsed)...)
 			}
 
 			// and global gauges
@@ -259,10 +483,14 @@ func (s *Server) generateInterMetrics(ctx context.Context, percentiles []float64
 			}
 
 			for _, h := range wm.globalHistograms {
-				finalMetrics = append(finalMetrics, h.Flush(s.interval, s.HistogramPercentiles, s.HistogramAggregates, true)...)
+				aggregates, percentiles := s.histogramAggregates(h.Name, s.HistogramPercentiles, false)
+				finalMetrics = append(finalMetrics, h.Flush(s.interval, percentiles, aggregates, true)...)
+				finalMetrics = append(finalMetrics, h.FlushBuckets(s.HistogramBuckets)...)
 			}
 			for _, h := range wm.globalTimers {
-				finalMetrics = append(finalMetrics, h.Flush(s.interval, s.HistogramPercentiles, s.HistogramAggregates, true)...)
+				aggregates, percentiles := s.histogramAggregates(h.Name, s.HistogramPercentiles, false)
+				finalMetrics = append(finalMetrics, h.Flush(s.interval, percentiles, aggregates, true)...)
+				finalMetrics = append(finalMetrics, h.FlushBuckets(s.HistogramBuckets)...)
 			}
 		}
 	}
@@ -270,6 +498,40 @@ func (s *Server) generateInterMetrics(ctx context.Context, percentiles []float64
 	return finalMetrics
 }
 
+// histogramAggregates returns the aggregates and percentiles that the
+// histogram or timer named name flushes, out of the configured aggregates
+// and the given percentiles. Percentiles of mixed-scope histograms are
+// only accurate once they're aggregated globally, so a local veneur
+// flushes none for them, even if an override lists some.
+func (s *Server) histogramAggregates(name string, percentiles []float64, mixed bool) (samplers.HistogramAggregates, []float64) {
+	aggregates, percentiles := s.HistogramAggregates.ForName(name, percentiles)
+	if mixed && s.IsLocal() {
+		percentiles = nil
+	}
+	return aggregates, percentiles
+}
+
+// flushCounter generates the InterMetrics for a counter's total, its
+// per-second rate over the elapsed time, or both, as configured.
+func (s *Server) flushCounter(c *samplers.Counter, elapsed time.Duration) []samplers.InterMetric {
+	if s.counterRates == samplers.CounterRatesNone {
+		return c.Flush(s.interval)
+	}
+	// Flushes that cover less than an interval (the first one, if
+	// we're synchronizing with the interval, or the last one on
+	// shutdown) are averaged over a whole interval, so that a few
+	// increments in a short time don't show up as a spike in the
+	// rate. Longer flushes get averaged over the time they took.
+	if elapsed < s.interval {
+		elapsed = s.interval
+	}
+	rate := c.FlushRate(elapsed)
+	if s.counterRates == samplers.CounterRatesInstead {
+		return rate
+	}
+	return append(c.Flush(s.interval), rate...)
+}
+
 const flushTotalMetric = "worker.metrics_flushed_total"
 
 // reportMetricsFlushCounts reports the counts of
@@ -348,7 +610,7 @@ func (s *Server) flushForward(ctx context.Context, wms []WorkerMetrics) {
 			jsonMetrics = append(jsonMetrics, jm)
 		}
 		for _, histo := range wm.histograms {
-			jm, err := histo.Export()
+			jm, err := histo.ExportDigest(s.forwardDigestEncoding)
 			if err != nil {
 				log.WithFields(logrus.Fields{
 					logrus.ErrorKey: err,
@@ -372,7 +634,7 @@ func (s *Server) flushForward(ctx context.Context, wms []WorkerMetrics) {
 			jsonMetrics = append(jsonMetrics, jm)
 		}
 		for _, timer := range wm.timers {
-			jm, err := timer.Export()
+			jm, err := timer.ExportDigest(s.forwardDigestEncoding)
 			if err != nil {
 				log.WithFields(logrus.Fields{
 					logrus.ErrorKey: err,
@@ -396,7 +658,8 @@ func (s *Server) flushForward(ctx context.Context, wms []WorkerMetrics) {
 	// the error has already been logged (if there was one), so we only care
 	// about the success case
 	endpoint := fmt.Sprintf("%s/import", s.ForwardAddr)
-	if vhttp.PostHelper(span.Attach(ctx), s.HTTPClient, s.TraceClient, http.MethodPost, endpoint, jsonMetrics, "forward", true, nil, log) == nil {
+	ctx = idempotency.WithKey(ctx, idempotency.NewKey())
+	if vhttp.PostHelper(span.Attach(ctx), s.forwardHTTPClient, s.TraceClient, http.MethodPost, endpoint, jsonMetrics, "forward", true, nil, log) == nil {
 		log.WithFields(logrus.Fields{
 			"metrics":     len(jsonMetrics),
 			"endpoint":    endpoint,
@@ -437,6 +700,18 @@ func (s *Server) flushTraces(ctx context.Context) {
 		spansRootReceivedTotal := atomic.SwapInt64(&value.ssfRootSpansReceivedTotal, 0)
 		s.Statsd.Count("ssf.spans.received_total", spansReceivedTotal, tags, 1.0)
 		s.Statsd.Count("ssf.spans.root.received_total", spansRootReceivedTotal, append(tags, "veneurglobalonly:true"), 1.0)
+		if dropped := atomic.SwapInt64(&value.ssfTagsDroppedTotal, 0); dropped > 0 {
+			s.Statsd.Count("ssf.spans.tags_dropped_total", dropped, tags, 1.0)
+		}
+		if truncated := atomic.SwapInt64(&value.ssfTagsTruncatedTotal, 0); truncated > 0 {
+			s.Statsd.Count("ssf.spans.tags_truncated_total", truncated, tags, 1.0)
+		}
+		if invalid := atomic.SwapInt64(&value.ssfSpansInvalidTotal, 0); invalid > 0 {
+			s.Statsd.Count("ssf.spans.invalid_total", invalid, tags, 1.0)
+		}
+		if repaired := atomic.SwapInt64(&value.ssfSpansRepairedTotal, 0); repaired > 0 {
+			s.Statsd.Count("ssf.spans.repaired_total", repaired, tags, 1.0)
+		}
 		return true
 	})
 
@@ -480,6 +755,7 @@ func (s *Server) forwardGRPC(ctx context.Context, wms []WorkerMetrics) {
 	c := forwardrpc.NewForwardClient(s.grpcForwardConn)
 
 	grpcStart := time.Now()
+	ctx = idempotency.WithKey(ctx, idempotency.NewKey())
 	_, err := c.SendMetrics(ctx, &forwardrpc.MetricList{Metrics: metrics})
 	if err != nil {
 		if statErr, ok := status.FromError(err); ok && (statErr.Message() == "all SubConns are in TransientFailure" || statErr.Message() == "transport is closing") {
@@ -2,15 +2,22 @@ package veneur
 
 import (
 	"context"
+	"errors"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/stripe/veneur/samplers"
 
+	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/stripe/veneur/internal/forwardtest"
 	"github.com/stripe/veneur/samplers/metricpb"
+	"github.com/stripe/veneur/sinks"
+	"github.com/stripe/veneur/ssf"
+	"github.com/stripe/veneur/trace"
+	"github.com/stripe/veneur/trace/testbackend"
 )
 
 func TestServerFlushGRPC(t *testing.T) {
@@ -105,3 +112,448 @@ func TestGlobalAcceptsHistogramsOverUDP(t *testing.T) {
 		t.Fatal("timed out waiting for global veneur flush")
 	}
 }
+
+func TestFlushCounterRates(t *testing.T) {
+	const interval = 10 * time.Second
+	counter := func() *samplers.Counter {
+		c := samplers.NewCounter("a.b.c", []string{"foo:bar"})
+		c.Sample(50, 1.0)
+		return c
+	}
+
+	tests := []struct {
+		name    string
+		rates   samplers.CounterRates
+		elapsed time.Duration
+		want    map[string]float64
+	}{
+		{"none", samplers.CounterRatesNone, interval,
+			map[string]float64{"a.b.c": 50}},
+		{"alongside", samplers.CounterRatesAlongside, interval,
+			map[string]float64{"a.b.c": 50, "a.b.c.rate": 5}},
+		{"instead", samplers.CounterRatesInstead, interval,
+			map[string]float64{"a.b.c.rate": 5}},
+		{"long interval", samplers.CounterRatesInstead, 2 * interval,
+			map[string]float64{"a.b.c.rate": 2.5}},
+		{"short final flush", samplers.CounterRatesInstead, interval / 5,
+			map[string]float64{"a.b.c.rate": 5}},
+		{"first flush", samplers.CounterRatesInstead, 0,
+			map[string]float64{"a.b.c.rate": 5}},
+	}
+	for _, elt := range tests {
+		test := elt
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			s := &Server{interval: interval, counterRates: test.rates}
+			got := map[string]float64{}
+			for _, m := range s.flushCounter(counter(), test.elapsed) {
+				got[m.Name] = m.Value
+				if m.Name == "a.b.c.rate" {
+					assert.Equal(t, samplers.GaugeMetric, m.Type)
+					assert.Equal(t, []string{"foo:bar"}, m.Tags)
+				}
+			}
+			assert.Equal(t, test.want, got)
+		})
+	}
+}
+
+func TestWorkerMetricsElapsed(t *testing.T) {
+	w := NewWorker(1, nil, logrus.New(), nil, nil, 0)
+	time.Sleep(10 * time.Millisecond)
+	wm := w.Flush()
+	assert.True(t, wm.elapsed >= 10*time.Millisecond, "elapsed %v is too short", wm.elapsed)
+}
+
+func TestFlushSinksFilters(t *testing.T) {
+	paid := &channelMetricSink{metricsChannel: make(chan []samplers.InterMetric, 1), name: "paid"}
+	debug := &channelMetricSink{metricsChannel: make(chan []samplers.InterMetric, 1), name: "debug"}
+	quiet := &channelMetricSink{metricsChannel: make(chan []samplers.InterMetric, 1), name: "quiet"}
+	s := &Server{
+		metricSinks: []sinks.MetricSink{paid, debug, quiet},
+		metricSinkFilters: newMetricSinkFilters(map[string]MetricSinkOptions{
+			"paid":  {DenyNames: []string{"debug.*"}, ForbidTags: []string{"user_id:*"}},
+			"quiet": {AllowNames: []string{"nothing.*"}},
+		}, nil),
+	}
+
+	metrics := []samplers.InterMetric{
+		{Name: "api.requests", Tags: []string{"env:prod"}},
+		{Name: "debug.allocs"},
+		{Name: "api.latency", Tags: []string{"user_id:1234"}},
+	}
+	s.flushSinks(context.Background(), metrics)
+
+	got := <-paid.metricsChannel
+	require.Len(t, got, 1)
+	assert.Equal(t, "api.requests", got[0].Name)
+	assert.Equal(t, metrics, <-debug.metricsChannel, "sinks without a filter should receive all metrics")
+	assert.Len(t, quiet.metricsChannel, 0, "sinks whose filter rejects all metrics shouldn't be flushed")
+	assert.Equal(t, "debug.allocs", metrics[1].Name, "filtering must not modify the shared metrics")
+}
+
+func TestFlushSinksAddTags(t *testing.T) {
+	first := &channelMetricSink{metricsChannel: make(chan []samplers.InterMetric, 1), name: "first"}
+	second := &channelMetricSink{metricsChannel: make(chan []samplers.InterMetric, 1), name: "second"}
+	plain := &channelMetricSink{metricsChannel: make(chan []samplers.InterMetric, 1), name: "plain"}
+	options := map[string]MetricSinkOptions{
+		"first":  {AddTags: map[string]string{"sink": "first", "region": "us-east-1"}},
+		"second": {AddTags: map[string]string{"sink": "second"}, Overwrite: true},
+	}
+	s := &Server{
+		metricSinks:    []sinks.MetricSink{first, second, plain},
+		metricSinkTags: newMetricSinkTags(options),
+	}
+
+	// Leave room in the tags slice, so that appending to it in
+	// place would leak into the other sinks' metrics:
+	tags := make([]string, 1, 10)
+	tags[0] = "sink:original"
+	metrics := []samplers.InterMetric{{Name: "a.b.c", Tags: tags}}
+	s.flushSinks(context.Background(), metrics)
+
+	assert.Equal(t, []string{"sink:original", "region:us-east-1"}, (<-first.metricsChannel)[0].Tags)
+	assert.Equal(t, []string{"sink:second"}, (<-second.metricsChannel)[0].Tags)
+	assert.Equal(t, []string{"sink:original"}, (<-plain.metricsChannel)[0].Tags)
+	assert.Equal(t, []string{"sink:original"}, metrics[0].Tags)
+}
+
+func TestFlushSinksSanitize(t *testing.T) {
+	strict := &channelMetricSink{metricsChannel: make(chan []samplers.InterMetric, 1), name: "strict"}
+	plain := &channelMetricSink{metricsChannel: make(chan []samplers.InterMetric, 1), name: "plain"}
+	metricSinks := []sinks.MetricSink{strict, plain}
+	options := map[string]MetricSinkOptions{
+		"strict": {Sanitize: &MetricSanitizeOptions{
+			Lowercase:          true,
+			ReplaceDisallowed:  true,
+			CollapseSeparators: true,
+			StripEmptyTags:     true,
+		}},
+	}
+	s := &Server{
+		metricSinks:          metricSinks,
+		metricSinkTags:       newMetricSinkTags(map[string]MetricSinkOptions{"strict": {AddTags: map[string]string{"Added Tag": "X"}}}),
+		metricSinkSanitizers: newMetricSinkSanitizers(options, metricSinks),
+	}
+
+	metrics := []samplers.InterMetric{{Name: "API..Requests ", Tags: []string{"Env:Prod", ":x"}}}
+	s.flushSinks(context.Background(), metrics)
+
+	flushed := (<-strict.metricsChannel)[0]
+	assert.Equal(t, "api.requests", flushed.Name)
+	assert.Equal(t, []string{"env:prod", "added_tag:x"}, flushed.Tags, "added tags should be sanitized too")
+	assert.Equal(t, metrics, <-plain.metricsChannel, "sinks without a sanitizer should get the metrics unchanged")
+}
+
+func TestFlushSinksRoutes(t *testing.T) {
+	datadog := &channelMetricSink{metricsChannel: make(chan []samplers.InterMetric, 1), name: "datadog"}
+	kafka := &channelMetricSink{metricsChannel: make(chan []samplers.InterMetric, 1), name: "kafka"}
+	graphite := &channelMetricSink{metricsChannel: make(chan []samplers.InterMetric, 1), name: "graphite"}
+	metricSinks := []sinks.MetricSink{datadog, kafka, graphite}
+	conf := Config{
+		MetricRoutes: []MetricRoute{
+			{AllowNames: []string{"*.trace.*"}, Sinks: []string{"graphite"}},
+			{AllowNames: []string{"billing.*"}, Sinks: []string{"datadog", "kafka"}},
+			{RequireTags: []string{"env:prod"}, Sinks: []string{"kafka"}},
+		},
+		MetricDefaultRoute: []string{"datadog"},
+		MetricSinkOptions: map[string]MetricSinkOptions{
+			"kafka": {DenyNames: []string{"billing.refunds"}},
+		},
+	}
+	s := &Server{
+		metricSinks:       metricSinks,
+		metricSinkFilters: newMetricSinkFilters(conf.MetricSinkOptions, metricSinks),
+	}
+	s.metricRouter = s.newMetricRouter(conf, metricSinks)
+
+	metrics := []samplers.InterMetric{
+		{Name: "billing.charges", Tags: []string{"env:prod"}},
+		{Name: "billing.refunds"},
+		{Name: "api.trace.spans", Tags: []string{"env:prod"}},
+		{Name: "api.requests", Tags: []string{"env:prod"}},
+		{Name: "api.errors", Tags: []string{"env:dev"}},
+	}
+	s.flushSinks(context.Background(), metrics)
+
+	names := func(ms []samplers.InterMetric) []string {
+		var names []string
+		for _, m := range ms {
+			names = append(names, m.Name)
+		}
+		return names
+	}
+	assert.Equal(t, []string{"billing.charges", "billing.refunds", "api.errors"}, names(<-datadog.metricsChannel),
+		"metrics that match no route should take the default route")
+	assert.Equal(t, []string{"billing.charges", "api.requests"}, names(<-kafka.metricsChannel),
+		"sink filters should apply to the metrics routed to the sink")
+	assert.Equal(t, []string{"api.trace.spans"}, names(<-graphite.metricsChannel))
+}
+
+func TestFlushSinksDefaultRoute(t *testing.T) {
+	first := &channelMetricSink{metricsChannel: make(chan []samplers.InterMetric, 1), name: "first"}
+	second := &channelMetricSink{metricsChannel: make(chan []samplers.InterMetric, 1), name: "second"}
+	metricSinks := []sinks.MetricSink{first, second}
+	conf := Config{
+		MetricRoutes: []MetricRoute{{AllowNames: []string{"first.*"}, Sinks: []string{"first"}}},
+	}
+	s := &Server{metricSinks: metricSinks}
+	s.metricRouter = s.newMetricRouter(conf, metricSinks)
+
+	metrics := []samplers.InterMetric{{Name: "first.a"}, {Name: "other.b"}}
+	s.flushSinks(context.Background(), metrics)
+
+	assert.Equal(t, metrics, <-first.metricsChannel)
+	assert.Equal(t, metrics[1:], <-second.metricsChannel,
+		"without a default route, unmatched metrics should go to every sink")
+}
+
+// failingMetricSink is a metric sink whose flushes always fail.
+type failingMetricSink struct {
+	name string
+}
+
+func (f *failingMetricSink) Name() string                                       { return f.name }
+func (f *failingMetricSink) Start(*trace.Client) error                          { return nil }
+func (f *failingMetricSink) FlushOtherSamples(context.Context, []ssf.SSFSample) {}
+func (f *failingMetricSink) Flush(context.Context, []samplers.InterMetric) error {
+	return errors.New("the backend is down")
+}
+
+func TestFlushSinksReport(t *testing.T) {
+	working := &channelMetricSink{metricsChannel: make(chan []samplers.InterMetric, 1), name: "working"}
+	broken := &failingMetricSink{name: "broken"}
+	filtered := &channelMetricSink{metricsChannel: make(chan []samplers.InterMetric, 1), name: "filtered"}
+	options := map[string]MetricSinkOptions{"filtered": {DenyNames: []string{"b"}}}
+	s := &Server{
+		metricSinks:       []sinks.MetricSink{working, broken, filtered},
+		metricSinkFilters: newMetricSinkFilters(options, []sinks.MetricSink{working, broken, filtered}),
+	}
+
+	metrics := []samplers.InterMetric{{Name: "a"}, {Name: "b"}}
+	report := s.flushSinks(context.Background(), metrics)
+	<-working.metricsChannel
+	<-filtered.metricsChannel
+
+	assert.Equal(t, 2, report.Metrics)
+	assert.Equal(t, 1, report.FailedSinks)
+	require.Len(t, report.Sinks, 3)
+	for i := range report.Sinks {
+		assert.True(t, report.Sinks[i].Duration >= 0)
+		report.Sinks[i].Duration = 0
+	}
+	assert.Equal(t, []SinkFlushResult{
+		{Sink: "broken", Attempted: 2, Failed: 2, Error: "the backend is down"},
+		{Sink: "filtered", Attempted: 1, Succeeded: 1},
+		{Sink: "working", Attempted: 2, Succeeded: 2},
+	}, report.Sinks)
+}
+
+func TestFlushSinksReportsTelemetry(t *testing.T) {
+	spans := make(chan *ssf.SSFSpan, 2)
+	cl, err := trace.NewBackendClient(testbackend.NewBackend(spans))
+	require.NoError(t, err)
+	defer cl.Close()
+
+	working := &channelMetricSink{metricsChannel: make(chan []samplers.InterMetric, 1), name: "working"}
+	broken := &failingMetricSink{name: "broken"}
+	s := &Server{metricSinks: []sinks.MetricSink{working, broken}, TraceClient: cl}
+
+	metrics := []samplers.InterMetric{
+		{Name: "a", Type: samplers.CounterMetric},
+		{Name: "b", Type: samplers.CounterMetric},
+		{Name: "c", Type: samplers.GaugeMetric},
+	}
+	s.flushSinks(context.Background(), metrics)
+	<-working.metricsChannel
+
+	// sink name -> sample name (and metric type) -> value
+	got := map[string]map[string]float32{"working": {}, "broken": {}}
+	for i := 0; i < 2; i++ {
+		select {
+		case span := <-spans:
+			for _, sample := range span.Metrics {
+				name := sample.Name
+				if typ, ok := sample.Tags["metric_type"]; ok {
+					name += ":" + typ
+				}
+				if sample.Name == sinks.MetricKeySinkFlushDuration {
+					assert.Equal(t, ssf.SSFSample_HISTOGRAM, sample.Metric)
+					assert.True(t, sample.Value >= 0)
+					sample.Value = 0
+				}
+				got[sample.Tags["sink"]][name] = sample.Value
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for the sink telemetry")
+		}
+	}
+
+	want := map[string]float32{
+		sinks.MetricKeySinkFlushDuration:               0,
+		sinks.MetricKeySinkMetricsFlushed + ":counter": 2,
+		sinks.MetricKeySinkMetricsFlushed + ":gauge":   1,
+	}
+	assert.Equal(t, want, got["working"])
+	want[sinks.MetricKeySinkFlushErrors] = 1
+	assert.Equal(t, want, got["broken"])
+}
+
+// hungMetricSink is a metric sink whose Flush blocks until release is
+// closed, regardless of its context.
+type hungMetricSink struct {
+	name    string
+	release chan struct{}
+}
+
+func (h *hungMetricSink) Name() string                                       { return h.name }
+func (h *hungMetricSink) Start(*trace.Client) error                          { return nil }
+func (h *hungMetricSink) FlushOtherSamples(context.Context, []ssf.SSFSample) {}
+func (h *hungMetricSink) Flush(context.Context, []samplers.InterMetric) error {
+	<-h.release
+	return nil
+}
+
+func TestFlushSinksTimeout(t *testing.T) {
+	spans := make(chan *ssf.SSFSpan, 2)
+	cl, err := trace.NewBackendClient(testbackend.NewBackend(spans))
+	require.NoError(t, err)
+	defer cl.Close()
+
+	working := &channelMetricSink{metricsChannel: make(chan []samplers.InterMetric, 1), name: "working"}
+	hung := &hungMetricSink{name: "hung", release: make(chan struct{})}
+	defer close(hung.release)
+	s := &Server{
+		metricSinks:  []sinks.MetricSink{working, hung},
+		flushTimeout: 50 * time.Millisecond,
+		TraceClient:  cl,
+	}
+
+	done := make(chan struct{})
+	go func() {
+		s.flushSinks(context.Background(), []samplers.InterMetric{{Name: "a", Type: samplers.CounterMetric}})
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("a hung sink should not block the flush past its timeout")
+	}
+	assert.Len(t, <-working.metricsChannel, 1, "the other sinks should still be flushed")
+
+	failures := map[string]float32{}
+	for i := 0; i < 2; i++ {
+		select {
+		case span := <-spans:
+			for _, sample := range span.Metrics {
+				if sample.Name == sinks.MetricKeySinkFlushErrors {
+					failures[sample.Tags["sink"]] += sample.Value
+				}
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for the sink telemetry")
+		}
+	}
+	assert.Equal(t, map[string]float32{"hung": 1}, failures, "the timeout should be recorded as a failure")
+}
+
+// slowMetricSink is a metric sink whose Flush takes delay, and that
+// records how many sinks sharing its tracker flush at once.
+type slowMetricSink struct {
+	name    string
+	delay   time.Duration
+	fail    bool
+	tracker *concurrencyTracker
+}
+
+type concurrencyTracker struct {
+	mtx     sync.Mutex
+	current int
+	max     int
+}
+
+func (c *concurrencyTracker) enter() {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.current++
+	if c.current > c.max {
+		c.max = c.current
+	}
+}
+
+func (c *concurrencyTracker) leave() {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.current--
+}
+
+func (c *concurrencyTracker) peak() int {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return c.max
+}
+
+func (sl *slowMetricSink) Name() string              { return sl.name }
+func (sl *slowMetricSink) Start(*trace.Client) error { return nil }
+func (sl *slowMetricSink) FlushOtherSamples(context.Context, []ssf.SSFSample) {
+	sl.tracker.enter()
+	defer sl.tracker.leave()
+	time.Sleep(sl.delay)
+}
+func (sl *slowMetricSink) Flush(context.Context, []samplers.InterMetric) error {
+	sl.tracker.enter()
+	defer sl.tracker.leave()
+	time.Sleep(sl.delay)
+	if sl.fail {
+		return errors.New("the backend is down")
+	}
+	return nil
+}
+
+func TestFlushSinksConcurrency(t *testing.T) {
+	newServer := func(max int) (*Server, *concurrencyTracker) {
+		tracker := &concurrencyTracker{}
+		return &Server{
+			metricSinks: []sinks.MetricSink{
+				&slowMetricSink{name: "fast", delay: 50 * time.Millisecond, tracker: tracker, fail: true},
+				&slowMetricSink{name: "medium", delay: 100 * time.Millisecond, tracker: tracker},
+				&slowMetricSink{name: "slow", delay: 150 * time.Millisecond, tracker: tracker},
+			},
+			flushMaxConcurrency: max,
+		}, tracker
+	}
+	metrics := []samplers.InterMetric{{Name: "a"}}
+
+	s, tracker := newServer(0)
+	start := time.Now()
+	report := s.flushSinks(context.Background(), metrics)
+	took := time.Since(start)
+	assert.Equal(t, 3, tracker.peak(), "all sinks should flush at once")
+	assert.True(t, took < 300*time.Millisecond, "the flush took %v, as long as flushing the sinks in turn", took)
+	require.Len(t, report.Sinks, 3)
+	assert.Equal(t, 1, report.FailedSinks)
+	for _, result := range report.Sinks[1:] {
+		assert.Equal(t, 1, result.Succeeded, "the failure of one sink shouldn't affect %s", result.Sink)
+	}
+
+	s, tracker = newServer(2)
+	start = time.Now()
+	report = s.flushSinks(context.Background(), metrics)
+	took = time.Since(start)
+	assert.Equal(t, 2, tracker.peak(), "no more than two sinks should flush at once")
+	assert.True(t, took < 300*time.Millisecond, "the flush took %v, as long as flushing the sinks in turn", took)
+	assert.Equal(t, 1, report.FailedSinks)
+
+	s, tracker = newServer(2)
+	s.flushOtherSamples(context.Background(), nil)
+	assert.Equal(t, 2, tracker.peak(), "no more than two sinks should flush other samples at once")
+}
+
+func TestFlushSinkCanceled(t *testing.T) {
+	hung := &hungMetricSink{name: "hung", release: make(chan struct{})}
+	defer close(hung.release)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Equal(t, context.Canceled, flushSink(ctx, hung, nil))
+}
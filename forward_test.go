@@ -1,7 +1,9 @@
 package veneur
 
 import (
+	"bytes"
 	"context"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -182,3 +184,141 @@ func TestE2EForwardMetric(t *testing.T) {
 		t.Fatal("Timed out waiting for a metric after 5 seconds")
 	}
 }
+
+// TestForwardGaugeTimestamp checks that a global gauge keeps the time
+// it was sampled at when it is forwarded, over HTTP and gRPC.
+func TestForwardGaugeTimestamp(t *testing.T) {
+	then := time.Now().Add(-1 * time.Hour).Unix()
+	gauge := func() *samplers.UDPMetric {
+		return &samplers.UDPMetric{
+			MetricKey: samplers.MetricKey{
+				Name: "a.b.c",
+				Type: gaugeTypeName,
+			},
+			Value:      3.0,
+			SampleRate: 1.0,
+			Scope:      samplers.GlobalOnly,
+			Timestamp:  then,
+		}
+	}
+	for _, transport := range []string{"http", "grpc"} {
+		t.Run(transport, func(t *testing.T) {
+			ch := make(chan []samplers.InterMetric, 1)
+			sink, _ := NewChannelMetricSink(ch)
+
+			var flush func()
+			if transport == "grpc" {
+				ff := newForwardGRPCFixture(t, localConfig(), sink)
+				defer ff.stop()
+				ff.IngestMetric(gauge())
+				flush = func() {
+					ff.local.Flush(context.TODO())
+					ff.global.Flush(context.TODO())
+				}
+			} else {
+				ff := newForwardingFixture(t, localConfig(), nil, sink)
+				defer ff.Close()
+				ff.IngestMetric(gauge())
+				flush = func() { ff.Flush(context.TODO()) }
+			}
+			flush()
+
+			select {
+			case metrics := <-ch:
+				require.Len(t, metrics, 1)
+				assert.Equal(t, 3.0, metrics[0].Value)
+				assert.Equal(t, then, metrics[0].Timestamp,
+					"the gauge should be flushed with the time it was sampled at")
+			case <-time.After(3 * time.Second):
+				t.Fatal("Timed out waiting for the gauge")
+			}
+		})
+	}
+}
+
+// TestForwardHistogramDigestEncodings forwards a histogram of 100k
+// points with each digest encoding, and checks that the global veneur
+// flushes the same percentiles from either, and that the binary
+// encoding forwards fewer bytes than gob.
+func TestForwardHistogramDigestEncodings(t *testing.T) {
+	const points = 100000
+	sizes := map[string]int64{}
+
+	for _, encoding := range []string{"gob", "binary"} {
+		t.Run(encoding, func(t *testing.T) {
+			ch := make(chan []samplers.InterMetric, 1)
+			sink, _ := NewChannelMetricSink(ch)
+			// The test flushes by itself; periodic flushes would
+			// split the histogram across several forwards.
+			globalCfg := globalConfig()
+			globalCfg.Interval = "1h"
+			global := setupVeneurServer(t, globalCfg, nil, sink, nil)
+			defer global.Shutdown()
+
+			var forwarded int64
+			imported := make(chan struct{}, 1)
+			globalTS := httptest.NewServer(contextHandler(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+				body, err := ioutil.ReadAll(r.Body)
+				if !assert.NoError(t, err) {
+					return
+				}
+				forwarded += int64(len(body))
+				r.Body = ioutil.NopCloser(bytes.NewReader(body))
+				_, jsonMetrics, err := unmarshalMetricsFromHTTP(ctx, nil, w, r)
+				if !assert.NoError(t, err) {
+					return
+				}
+				global.ImportMetrics(ctx, jsonMetrics)
+				imported <- struct{}{}
+			}))
+			defer globalTS.Close()
+
+			cfg := localConfig()
+			cfg.ForwardAddress = globalTS.URL
+			cfg.ForwardDigestEncoding = encoding
+			cfg.Interval = "1h"
+			local := setupVeneurServer(t, cfg, nil, nil, nil)
+			defer local.Shutdown()
+
+			for i := 0; i < points; i++ {
+				local.Workers[0].ProcessMetric(&samplers.UDPMetric{
+					MetricKey:  samplers.MetricKey{Name: "a.b.c", Type: "histogram"},
+					Value:      float64(i),
+					SampleRate: 1.0,
+					Scope:      samplers.MixedScope,
+				})
+			}
+			local.Flush(context.Background())
+			select {
+			case <-imported:
+			case <-time.After(3 * time.Second):
+				t.Fatal("Timed out waiting for the forwarded histogram")
+			}
+			t.Logf("forwarded %d bytes with %s encoding", forwarded, encoding)
+			sizes[encoding] = forwarded
+
+			// The global veneur's workers import the histogram
+			// asynchronously, so flush until it shows up.
+			var metrics []samplers.InterMetric
+			deadline := time.After(3 * time.Second)
+			for metrics == nil {
+				global.Flush(context.Background())
+				select {
+				case metrics = <-ch:
+				case <-time.After(10 * time.Millisecond):
+				case <-deadline:
+					t.Fatal("Timed out waiting for the global veneur to flush")
+				}
+			}
+			found := false
+			for _, m := range metrics {
+				if m.Name == "a.b.c.50percentile" {
+					found = true
+					assert.InEpsilon(t, points/2, m.Value, 0.01)
+				}
+			}
+			assert.True(t, found, "the global veneur should flush the forwarded histogram's percentiles")
+		})
+	}
+	assert.True(t, sizes["binary"] < sizes["gob"], "the binary encoding should be the more compact one: %v", sizes)
+}
@@ -2,6 +2,12 @@ package veneur
 
 //go:generate protoc --gogofaster_out=Mssf/sample.proto=github.com/stripe/veneur/ssf,plugins=grpc:. sinks/grpsink/grpc_sink.proto
 //go:generate protoc --gogofaster_out=. ssf/sample.proto
+//go:generate protoc --gogofaster_out=Mssf/sample.proto=github.com/stripe/veneur/ssf,plugins=grpc:. ssfrpc/ssfrpc.proto
+//go:generate protoc --gogofaster_out=. sinks/prometheus/prompb/remote.proto
+//go:generate protoc --gogofaster_out=. sinks/otlp/otlpcommon/common.proto
+//go:generate protoc --gogofaster_out=Msinks/otlp/otlpcommon/common.proto=github.com/stripe/veneur/sinks/otlp/otlpcommon,plugins=grpc:. sinks/otlp/otlpmetrics/metrics.proto
+//go:generate protoc --gogofaster_out=Msinks/otlp/otlpcommon/common.proto=github.com/stripe/veneur/sinks/otlp/otlpcommon,plugins=grpc:. sinks/otlp/otlptrace/trace.proto
+//go:generate protoc --gogofaster_out=plugins=grpc:. sinks/jaeger/jaegerpb/collector.proto
 //go:generate protoc -I=. -I=$GOPATH/src -I=$GOPATH/src/github.com/gogo/protobuf/protobuf --gogofaster_out=. tdigest/tdigest.proto
 //go:generate protoc -I=. -I=$GOPATH/src -I=$GOPATH/src/github.com/gogo/protobuf/protobuf --gogofaster_out=Mtdigest/tdigest.proto=github.com/stripe/veneur/tdigest:. samplers/metricpb/metric.proto
 //go:generate protoc -I=. -I=$GOPATH/src -I=$GOPATH/src/github.com/gogo/protobuf/protobuf --gogofaster_out=Mtdigest/tdigest.proto=github.com/stripe/veneur/tdigest,Msamplers/metricpb/metric.proto=github.com/stripe/veneur/samplers/metricpb,Mgoogle/protobuf/empty.proto=github.com/golang/protobuf/ptypes/empty,plugins=grpc:. forwardrpc/forward.proto
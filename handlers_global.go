@@ -1,17 +1,23 @@
 package veneur
 
 import (
+	"bytes"
+	"compress/gzip"
 	"compress/zlib"
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
+	"io/ioutil"
 	"net/http"
 	"reflect"
 	"strings"
 	"time"
 
 	"github.com/sirupsen/logrus"
+	"github.com/stripe/veneur/importsrv"
+	"github.com/stripe/veneur/internal/idempotency"
 	"github.com/stripe/veneur/samplers"
 	"github.com/stripe/veneur/ssf"
 	"github.com/stripe/veneur/trace"
@@ -36,9 +42,14 @@ func handleProxy(p *Proxy) http.Handler {
 			log.WithError(err).Error("Error unmarshalling metrics in proxy import")
 			return
 		}
+		key := r.Header.Get(idempotency.HTTPHeader)
+		if p.idempotencyCache.Seen(key) {
+			span.Add(ssf.Count(importsrv.MetricKeyDuplicateBatches, 1, map[string]string{"protocol": "http"}))
+			return
+		}
 		// the server usually waits for this to return before finalizing the
 		// response, so this part must be done asynchronously
-		go p.ProxyMetrics(span.Attach(ctx), jsonMetrics, strings.SplitN(r.RemoteAddr, ":", 2)[0])
+		go p.ProxyMetrics(idempotency.WithKey(span.Attach(ctx), key), jsonMetrics, strings.SplitN(r.RemoteAddr, ":", 2)[0])
 	})
 }
 
@@ -56,7 +67,8 @@ func handleSpans(p *Proxy) http.Handler {
 }
 
 // handleImport generates the handler that responds to POST requests submitting
-// metrics to the global veneur instance.
+// metrics to the global veneur instance. Requests whose idempotency key
+// was seen already are accepted, but their metrics are skipped.
 func handleImport(s *Server) http.Handler {
 	return contextHandler(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
 		span, jsonMetrics, err := unmarshalMetricsFromHTTP(ctx, s.TraceClient, w, r)
@@ -65,12 +77,117 @@ func handleImport(s *Server) http.Handler {
 			span.Add(ssf.Count("import.unmarshal.errors_total", 1, nil))
 			return
 		}
+		if s.idempotencyCache.Seen(r.Header.Get(idempotency.HTTPHeader)) {
+			span.Add(ssf.Count(importsrv.MetricKeyDuplicateBatches, 1, map[string]string{"protocol": "http"}))
+			return
+		}
 		// the server usually waits for this to return before finalizing the
 		// response, so this part must be done asynchronously
 		go s.ImportMetrics(span.Attach(ctx), jsonMetrics)
 	})
 }
 
+// handleImportSamples generates the handler that responds to POST
+// requests submitting SSF samples as JSON, either as an array of
+// samples or as a batch like {"batch": [...]}. It responds with 202
+// once all samples have been parsed, and with 400 if any can't be.
+func handleImportSamples(s *Server) http.Handler {
+	return contextHandler(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		innerLogger := log.WithField("client", r.RemoteAddr)
+		samples, status, cause, err := unmarshalSamplesFromHTTP(r, s.httpSamplesMaxBodyBytes)
+		if err != nil {
+			http.Error(w, err.Error(), status)
+			innerLogger.WithError(err).Warn("Could not decode /import/samples request")
+			metrics.ReportOne(s.TraceClient, ssf.Count("import.request_error_total", 1, map[string]string{"cause": cause, "part": "samples"}))
+			return
+		}
+
+		parsed := make([]samplers.UDPMetric, 0, len(samples))
+		for i, sample := range samples {
+			m, err := samplers.ParseMetricSSF(sample)
+			if err == nil && !samplers.ValidMetric(m) {
+				err = errors.New("a sample needs a name and a value")
+			}
+			if err != nil {
+				http.Error(w, fmt.Sprintf("invalid sample %d: %v", i, err), http.StatusBadRequest)
+				innerLogger.WithError(err).Warn("Could not parse a sample in /import/samples request")
+				metrics.ReportOne(s.TraceClient, ssf.Count("import.request_error_total", 1, map[string]string{"cause": "invalid_sample", "part": "samples"}))
+				return
+			}
+			parsed = append(parsed, m)
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+		metrics.ReportOne(s.TraceClient, ssf.Count("import.samples_total", float32(len(parsed)), nil))
+		// the workers' channels may be backed up, so don't hold up
+		// the response
+		go func() {
+			for i := range parsed {
+				s.workerFor(&parsed[i]).IngestUDP(parsed[i])
+			}
+		}()
+	})
+}
+
+// unmarshalSamplesFromHTTP reads the samples in a request body of at
+// most maxBytes (after decompression). If that fails, it returns the
+// HTTP status to respond with, and the cause of the failure for
+// telemetry.
+func unmarshalSamplesFromHTTP(r *http.Request, maxBytes int64) ([]*ssf.SSFSample, int, string, error) {
+	var body io.Reader
+	switch encoding := r.Header.Get("Content-Encoding"); encoding {
+	case "":
+		body = r.Body
+	case "gzip":
+		gz, err := gzip.NewReader(r.Body)
+		if err != nil {
+			return nil, http.StatusBadRequest, "gzip", err
+		}
+		defer gz.Close()
+		body = gz
+	case "deflate":
+		zr, err := zlib.NewReader(r.Body)
+		if err != nil {
+			return nil, http.StatusBadRequest, "deflate", err
+		}
+		defer zr.Close()
+		body = zr
+	default:
+		return nil, http.StatusUnsupportedMediaType, "unknown_content_encoding",
+			fmt.Errorf("unsupported content encoding %q", encoding)
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(body, maxBytes+1))
+	if err != nil {
+		return nil, http.StatusBadRequest, "io", err
+	}
+	if int64(len(data)) > maxBytes {
+		return nil, http.StatusRequestEntityTooLarge, "too_large",
+			fmt.Errorf("request body exceeds %d bytes", maxBytes)
+	}
+
+	var samples []*ssf.SSFSample
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		var batch ssf.Samples
+		err = json.Unmarshal(trimmed, &batch)
+		samples = batch.Batch
+	} else {
+		err = json.Unmarshal(trimmed, &samples)
+	}
+	if err != nil {
+		return nil, http.StatusBadRequest, "json", err
+	}
+	if len(samples) == 0 {
+		return nil, http.StatusBadRequest, "empty", errors.New("received no samples")
+	}
+	for i, sample := range samples {
+		if sample == nil {
+			return nil, http.StatusBadRequest, "json", fmt.Errorf("sample %d is null", i)
+		}
+	}
+	return samples, 0, "", nil
+}
+
 func handleTraceRequest(ctx context.Context, client *trace.Client, w http.ResponseWriter, r *http.Request) (*trace.Span, []DatadogTraceSpan, error) {
 	var (
 		traces []DatadogTraceSpan
@@ -0,0 +1,65 @@
+// Package hashring maps keys, like the keys of metrics or the IDs of
+// traces, to the members of a set of destinations. Every ring with the
+// same members maps each key to the same member, regardless of the
+// order the members were added in, so that all proxies that know the
+// same destinations route identically.
+package hashring
+
+import (
+	"fmt"
+
+	"stathat.com/c/consistent"
+)
+
+// The algorithms that New can create rings for.
+const (
+	// Ketama places each member on a ring at a number of points
+	// hashed with CRC32, and maps keys to the member at the next
+	// point. It is the default.
+	Ketama = "ketama"
+	// Maglev fills a lookup table with the members' preferences, as
+	// in Google's Maglev load balancer, which spreads keys almost
+	// perfectly evenly.
+	Maglev = "maglev"
+	// XXHash is like Ketama, but hashes with xxHash.
+	XXHash = "xxhash"
+)
+
+// ErrEmpty is returned by Get when the ring has no members.
+var ErrEmpty = consistent.ErrEmptyCircle
+
+// Ring maps keys to the members of a set of destinations. Rings are
+// safe for concurrent use.
+type Ring interface {
+	// Add adds a member to the ring.
+	Add(member string)
+	// Remove removes a member from the ring.
+	Remove(member string)
+	// Set replaces the ring's members.
+	Set(members []string)
+	// Members returns the ring's members.
+	Members() []string
+	// Get returns the member that key maps to, or ErrEmpty if the
+	// ring has no members.
+	Get(key string) (string, error)
+}
+
+var _ Ring = &consistent.Consistent{}
+
+// New returns an empty ring that maps keys with the given algorithm,
+// which defaults to Ketama if empty. Ketama and XXHash rings place each
+// member on the ring at replicas points; more replicas spread keys more
+// evenly, at the cost of a larger ring. Maglev rings ignore replicas.
+func New(algorithm string, replicas int) (Ring, error) {
+	switch algorithm {
+	case "", Ketama:
+		ring := consistent.New()
+		ring.NumberOfReplicas = replicas
+		return ring, nil
+	case Maglev:
+		return NewMaglev(), nil
+	case XXHash:
+		return NewXXHash(replicas), nil
+	}
+	return nil, fmt.Errorf("unknown hash %q, must be %s, %s or %s", algorithm, Ketama, Maglev, XXHash)
+}
@@ -0,0 +1,145 @@
+package hashring
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var algorithms = []string{Ketama, Maglev, XXHash}
+
+func destinations(n int) []string {
+	dests := make([]string, n)
+	for i := range dests {
+		dests[i] = fmt.Sprintf("http://veneur-global-%d:8127", i)
+	}
+	return dests
+}
+
+func testKey(i int) string {
+	return fmt.Sprintf("a.b.c.%d|counter|foo:bar", i)
+}
+
+// TestUniformity checks that each algorithm gives each destination
+// about its share of the keys. Maglev is held to a much tighter bound
+// than the rings that place members at random points.
+func TestUniformity(t *testing.T) {
+	const numKeys = 100000
+	tolerance := map[string]float64{Ketama: 0.35, XXHash: 0.35, Maglev: 0.05}
+	for _, algorithm := range algorithms {
+		for _, n := range []int{3, 10, 25} {
+			algorithm, n := algorithm, n
+			t.Run(fmt.Sprintf("%s/%d destinations", algorithm, n), func(t *testing.T) {
+				t.Parallel()
+				ring, err := New(algorithm, 100)
+				require.NoError(t, err)
+				ring.Set(destinations(n))
+
+				counts := map[string]int{}
+				for i := 0; i < numKeys; i++ {
+					dest, err := ring.Get(testKey(i))
+					require.NoError(t, err)
+					counts[dest]++
+				}
+				require.Len(t, counts, n, "every destination should get keys")
+				expected := float64(numKeys) / float64(n)
+				for dest, count := range counts {
+					assert.InEpsilon(t, expected, float64(count), tolerance[algorithm],
+						"%s got %d keys, expected about %.0f", dest, count, expected)
+				}
+			})
+		}
+	}
+}
+
+// TestDeterministic checks that rings with the same members map keys
+// the same way, however their members were added.
+func TestDeterministic(t *testing.T) {
+	for _, algorithm := range algorithms {
+		dests := destinations(10)
+		a, err := New(algorithm, 100)
+		require.NoError(t, err)
+		a.Set(dests)
+
+		b, err := New(algorithm, 100)
+		require.NoError(t, err)
+		b.Add("http://veneur-global-gone:8127")
+		for _, i := range rand.Perm(len(dests)) {
+			b.Add(dests[i])
+		}
+		b.Remove("http://veneur-global-gone:8127")
+
+		assert.ElementsMatch(t, a.Members(), b.Members(), algorithm)
+		for i := 0; i < 10000; i++ {
+			destA, _ := a.Get(testKey(i))
+			destB, _ := b.Get(testKey(i))
+			require.Equal(t, destA, destB, "%s: key %q", algorithm, testKey(i))
+		}
+	}
+}
+
+// TestRebalance checks that few keys move between the destinations
+// that stay when a destination is added.
+func TestRebalance(t *testing.T) {
+	const numKeys = 100000
+	for _, algorithm := range algorithms {
+		ring, err := New(algorithm, 100)
+		require.NoError(t, err)
+		ring.Set(destinations(10))
+		before := make([]string, numKeys)
+		for i := range before {
+			before[i], _ = ring.Get(testKey(i))
+		}
+
+		ring.Add("http://veneur-global-new:8127")
+		moved, stolen := 0, 0
+		for i := range before {
+			dest, _ := ring.Get(testKey(i))
+			if dest == before[i] {
+				continue
+			}
+			moved++
+			if dest == "http://veneur-global-new:8127" {
+				stolen++
+			}
+		}
+		assert.InEpsilon(t, numKeys/11, moved, 0.5, "%s moved %d keys", algorithm, moved)
+		assert.True(t, moved-stolen < numKeys/50,
+			"%s moved %d keys between the other destinations", algorithm, moved-stolen)
+	}
+}
+
+func TestEmpty(t *testing.T) {
+	for _, algorithm := range algorithms {
+		ring, err := New(algorithm, 100)
+		require.NoError(t, err)
+		_, err = ring.Get("a.b.c")
+		assert.Equal(t, ErrEmpty, err, algorithm)
+
+		ring.Add("a")
+		ring.Remove("a")
+		_, err = ring.Get("a.b.c")
+		assert.Equal(t, ErrEmpty, err, algorithm)
+		assert.Empty(t, ring.Members(), algorithm)
+	}
+}
+
+func TestNewUnknown(t *testing.T) {
+	_, err := New("md5", 100)
+	assert.Error(t, err)
+}
+
+func BenchmarkGet(b *testing.B) {
+	for _, algorithm := range algorithms {
+		ring, _ := New(algorithm, 100)
+		ring.Set(destinations(10))
+		b.Run(algorithm, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				ring.Get(testKey(i))
+			}
+		})
+	}
+}
@@ -0,0 +1,124 @@
+package hashring
+
+import (
+	"sync"
+
+	"github.com/pierrec/xxHash/xxHash32"
+)
+
+// maglevTableSize is the size of a MaglevRing's lookup table. It must
+// be prime, and much larger than the number of members for keys to
+// spread evenly: each member gets within about members/size of its
+// share of the table.
+const maglevTableSize = 65537
+
+// MaglevRing maps keys to members with a lookup table, filled the way
+// that Google's Maglev load balancer fills its table: each member has a
+// permutation of the table's slots, derived from its name, and the
+// members take turns claiming their next preferred free slot until the
+// table is full. Each member ends up with almost exactly its share of
+// the slots, and a member joining or leaving moves few keys between
+// the other members.
+type MaglevRing struct {
+	mtx     sync.RWMutex
+	members map[string]struct{}
+	sorted  []string
+	table   []int32
+}
+
+var _ Ring = &MaglevRing{}
+
+// NewMaglev returns an empty ring.
+func NewMaglev() *MaglevRing {
+	return &MaglevRing{members: map[string]struct{}{}}
+}
+
+// Add adds a member to the ring.
+func (r *MaglevRing) Add(member string) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.members[member] = struct{}{}
+	r.rebuild()
+}
+
+// Remove removes a member from the ring.
+func (r *MaglevRing) Remove(member string) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	delete(r.members, member)
+	r.rebuild()
+}
+
+// Set replaces the ring's members.
+func (r *MaglevRing) Set(members []string) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.members = make(map[string]struct{}, len(members))
+	for _, member := range members {
+		r.members[member] = struct{}{}
+	}
+	r.rebuild()
+}
+
+// Members returns the ring's members, sorted.
+func (r *MaglevRing) Members() []string {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+	return append([]string(nil), r.sorted...)
+}
+
+// Get returns the member that key maps to.
+func (r *MaglevRing) Get(key string) (string, error) {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+	if len(r.sorted) == 0 {
+		return "", ErrEmpty
+	}
+	return r.sorted[r.table[xxHash32.Checksum([]byte(key), 0)%maglevTableSize]], nil
+}
+
+// rebuild fills the lookup table. The members take turns in sorted
+// order, so that the table doesn't depend on the order that they were
+// added in. r.mtx must be held.
+func (r *MaglevRing) rebuild() {
+	r.sorted = sortedMembers(r.members)
+	if len(r.sorted) == 0 {
+		r.table = nil
+		return
+	}
+
+	// Each member's permutation visits the slots offset,
+	// offset+skip, offset+2*skip, ... (mod the table size), which
+	// covers every slot since the size is prime.
+	offsets := make([]uint32, len(r.sorted))
+	skips := make([]uint32, len(r.sorted))
+	next := make([]uint32, len(r.sorted))
+	for i, member := range r.sorted {
+		offsets[i] = xxHash32.Checksum([]byte(member), 0) % maglevTableSize
+		skips[i] = xxHash32.Checksum([]byte(member), 1)%(maglevTableSize-1) + 1
+	}
+
+	slot := func(i int) uint32 {
+		return uint32((uint64(offsets[i]) + uint64(next[i])*uint64(skips[i])) % maglevTableSize)
+	}
+
+	table := make([]int32, maglevTableSize)
+	for i := range table {
+		table[i] = -1
+	}
+	filled := 0
+	for {
+		for i := range r.sorted {
+			for table[slot(i)] >= 0 {
+				next[i]++
+			}
+			table[slot(i)] = int32(i)
+			next[i]++
+			filled++
+			if filled == maglevTableSize {
+				r.table = table
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package hashring
+
+import (
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/pierrec/xxHash/xxHash32"
+)
+
+// XXHashRing is a consistent hash ring that places each member at
+// points hashed with xxHash, and maps each key to the member at the
+// first point after the key's hash.
+type XXHashRing struct {
+	replicas int
+
+	mtx     sync.RWMutex
+	members map[string]struct{}
+	points  []uint32
+	owners  map[uint32]string
+}
+
+var _ Ring = &XXHashRing{}
+
+// NewXXHash returns an empty ring that places each member at replicas
+// points.
+func NewXXHash(replicas int) *XXHashRing {
+	if replicas < 1 {
+		replicas = 1
+	}
+	return &XXHashRing{
+		replicas: replicas,
+		members:  map[string]struct{}{},
+		owners:   map[uint32]string{},
+	}
+}
+
+// Add adds a member to the ring.
+func (r *XXHashRing) Add(member string) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.members[member] = struct{}{}
+	r.rebuild()
+}
+
+// Remove removes a member from the ring.
+func (r *XXHashRing) Remove(member string) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	delete(r.members, member)
+	r.rebuild()
+}
+
+// Set replaces the ring's members.
+func (r *XXHashRing) Set(members []string) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.members = make(map[string]struct{}, len(members))
+	for _, member := range members {
+		r.members[member] = struct{}{}
+	}
+	r.rebuild()
+}
+
+// Members returns the ring's members, sorted.
+func (r *XXHashRing) Members() []string {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+	return sortedMembers(r.members)
+}
+
+// Get returns the member that key maps to.
+func (r *XXHashRing) Get(key string) (string, error) {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+	if len(r.points) == 0 {
+		return "", ErrEmpty
+	}
+	hash := xxHash32.Checksum([]byte(key), 0)
+	i := sort.Search(len(r.points), func(i int) bool { return r.points[i] > hash })
+	if i == len(r.points) {
+		i = 0
+	}
+	return r.owners[r.points[i]], nil
+}
+
+// rebuild places the members on the ring. Points that two members hash
+// to go to the one that sorts first, so that the ring doesn't depend on
+// the order members were added in. r.mtx must be held.
+func (r *XXHashRing) rebuild() {
+	r.owners = make(map[uint32]string, len(r.members)*r.replicas)
+	r.points = r.points[:0]
+	for _, member := range sortedMembers(r.members) {
+		for i := 0; i < r.replicas; i++ {
+			point := xxHash32.Checksum([]byte(strconv.Itoa(i)+member), 0)
+			if _, taken := r.owners[point]; taken {
+				continue
+			}
+			r.owners[point] = member
+			r.points = append(r.points, point)
+		}
+	}
+	sort.Slice(r.points, func(i, j int) bool { return r.points[i] < r.points[j] })
+}
+
+func sortedMembers(members map[string]struct{}) []string {
+	sorted := make([]string, 0, len(members))
+	for member := range members {
+		sorted = append(sorted, member)
+	}
+	sort.Strings(sorted)
+	return sorted
+}
@@ -0,0 +1,143 @@
+package veneur
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// metadataEndpoint is where a cloud provider's metadata service
+// reports the hostname of the instance that queries it.
+type metadataEndpoint struct {
+	url    string
+	header map[string]string
+	// tokenURL, if set, is where a session token is requested with
+	// a PUT before the hostname is fetched, as EC2's IMDSv2 requires.
+	tokenURL string
+}
+
+// hostnameMetadataEndpoints are the metadata services that
+// hostname_metadata can name.
+var hostnameMetadataEndpoints = map[string]metadataEndpoint{
+	"azure": {
+		url:    "http://169.254.169.254/metadata/instance/compute/name?api-version=2021-02-01&format=text",
+		header: map[string]string{"Metadata": "true"},
+	},
+	"ec2": {
+		url:      "http://169.254.169.254/latest/meta-data/local-hostname",
+		tokenURL: "http://169.254.169.254/latest/api/token",
+	},
+	"gce": {
+		url:    "http://metadata.google.internal/computeMetadata/v1/instance/hostname",
+		header: map[string]string{"Metadata-Flavor": "Google"},
+	},
+}
+
+// hostnameMetadataTimeout bounds each request to a metadata service,
+// which doesn't answer at all outside of its cloud.
+var hostnameMetadataTimeout = 2 * time.Second
+
+// resolveHostname returns the hostname that c configures, from the
+// first of these sources that yields one:
+//
+// 1. hostname, set statically,
+// 2. the environment variable named by hostname_env,
+// 3. the contents of the file at hostname_file,
+// 4. the metadata service of the cloud named by hostname_metadata,
+// 5. os.Hostname(), unless omit_empty_hostname is set.
+//
+// Sources that are configured but fail are logged and skipped.
+func (c *Config) resolveHostname() string {
+	if c.Hostname != "" {
+		return c.Hostname
+	}
+	if c.HostnameEnv != "" {
+		if hostname := strings.TrimSpace(os.Getenv(c.HostnameEnv)); hostname != "" {
+			return hostname
+		}
+		log.WithField("variable", c.HostnameEnv).Warn("Hostname environment variable is empty or unset")
+	}
+	if c.HostnameFile != "" {
+		bts, err := ioutil.ReadFile(c.HostnameFile)
+		if hostname := strings.TrimSpace(string(bts)); err == nil && hostname != "" {
+			return hostname
+		}
+		log.WithError(err).WithField("path", c.HostnameFile).Warn("Could not read the hostname from a file")
+	}
+	if c.HostnameMetadata != "" {
+		hostname, err := fetchMetadataHostname(c.HostnameMetadata)
+		if err == nil {
+			return hostname
+		}
+		log.WithError(err).WithField("provider", c.HostnameMetadata).Warn("Could not fetch the hostname from the metadata service")
+	}
+	if c.OmitEmptyHostname {
+		return ""
+	}
+	hostname, _ := os.Hostname()
+	return hostname
+}
+
+// fetchMetadataHostname asks the metadata service of a cloud provider
+// for the instance's hostname.
+func fetchMetadataHostname(provider string) (string, error) {
+	endpoint, ok := hostnameMetadataEndpoints[provider]
+	if !ok {
+		return "", fmt.Errorf("unknown metadata provider %q", provider)
+	}
+	client := &http.Client{Timeout: hostnameMetadataTimeout}
+	header := http.Header{}
+	for k, v := range endpoint.header {
+		header.Set(k, v)
+	}
+	if endpoint.tokenURL != "" {
+		req, err := http.NewRequest(http.MethodPut, endpoint.tokenURL, nil)
+		if err != nil {
+			return "", err
+		}
+		req.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", "60")
+		token, err := metadataRequest(client, req)
+		if err != nil {
+			return "", fmt.Errorf("could not get a metadata token: %v", err)
+		}
+		header.Set("X-aws-ec2-metadata-token", token)
+	}
+	req, err := http.NewRequest(http.MethodGet, endpoint.url, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header = header
+	hostname, err := metadataRequest(client, req)
+	if err != nil {
+		return "", err
+	}
+	if hostname == "" {
+		return "", fmt.Errorf("metadata service returned an empty hostname")
+	}
+	log.WithFields(logrus.Fields{
+		"provider": provider,
+		"hostname": hostname,
+	}).Debug("Fetched the hostname from the metadata service")
+	return hostname, nil
+}
+
+func metadataRequest(client *http.Client, req *http.Request) (string, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	bts, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%s returned status %d", req.URL, resp.StatusCode)
+	}
+	return strings.TrimSpace(string(bts)), nil
+}
@@ -1,12 +1,17 @@
 package veneur
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/pprof"
 	"sort"
+	"strconv"
 	"time"
 
 	"github.com/stripe/veneur/samplers"
+	"github.com/stripe/veneur/sinks"
 	"github.com/stripe/veneur/ssf"
 	"github.com/stripe/veneur/trace"
 	"github.com/stripe/veneur/trace/metrics"
@@ -22,7 +27,7 @@ func (s *Server) Handler() http.Handler {
 	mux := goji.NewMux()
 
 	mux.HandleFuncC(pat.Get("/healthcheck"), func(c context.Context, w http.ResponseWriter, r *http.Request) {
-		w.Write([]byte("ok\n"))
+		w.Write([]byte(s.healthReport()))
 	})
 
 	mux.HandleFuncC(pat.Get("/builddate"), func(c context.Context, w http.ResponseWriter, r *http.Request) {
@@ -38,7 +43,18 @@ func (s *Server) Handler() http.Handler {
 		w.Write([]byte("ok\n"))
 	})
 
+	mux.HandleFuncC(pat.Get("/flush/last"), func(c context.Context, w http.ResponseWriter, r *http.Request) {
+		report, ok := s.LastFlush()
+		if !ok {
+			http.Error(w, "no flush has happened yet", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(report)
+	})
+
 	mux.Handle(pat.Post("/import"), handleImport(s))
+	mux.Handle(pat.Post("/import/samples"), handleImportSamples(s))
 
 	mux.Handle(pat.Get("/debug/pprof/cmdline"), http.HandlerFunc(pprof.Cmdline))
 	mux.Handle(pat.Get("/debug/pprof/profile"), http.HandlerFunc(pprof.Profile))
@@ -50,6 +66,62 @@ func (s *Server) Handler() http.Handler {
 	return mux
 }
 
+// stateLimit returns the limit on the number of series that a request
+// for the aggregation state asks for, or def if it doesn't.
+func stateLimit(r *http.Request, def int) (int, error) {
+	l := r.URL.Query().Get("limit")
+	if l == "" {
+		return def, nil
+	}
+	limit, err := strconv.Atoi(l)
+	if err != nil || limit < 1 {
+		return 0, fmt.Errorf("invalid limit %q", l)
+	}
+	if limit > maxStateLimit {
+		limit = maxStateLimit
+	}
+	return limit, nil
+}
+
+// healthReport returns the body of the health check response: "ok" if
+// all sinks and plugins that can tell are healthy, or "degraded" if any
+// is not, followed by a line with the status of each of them. The
+// response status stays 200 either way, so that a sink's outage
+// doesn't take veneur out of its load balancer.
+func (s *Server) healthReport() string {
+	var buf bytes.Buffer
+	degraded := false
+	check := func(kind, name string, hc sinks.HealthChecker) {
+		status := "ok"
+		if err := hc.Healthy(); err != nil {
+			degraded = true
+			status = err.Error()
+		}
+		fmt.Fprintf(&buf, "%s %s: %s\n", kind, name, status)
+	}
+	current := s.currentSinks()
+	for _, sink := range current.metricSinks {
+		if hc, ok := sink.(sinks.HealthChecker); ok {
+			check("metric sink", sink.Name(), hc)
+		}
+	}
+	for _, sink := range current.spanSinks {
+		if hc, ok := sink.(sinks.HealthChecker); ok {
+			check("span sink", sink.Name(), hc)
+		}
+	}
+	for _, p := range s.getPlugins() {
+		if hc, ok := p.(sinks.HealthChecker); ok {
+			check("plugin", p.Name(), hc)
+		}
+	}
+
+	if degraded {
+		return "degraded\n" + buf.String()
+	}
+	return "ok\n" + buf.String()
+}
+
 // ImportMetrics feeds a slice of json metrics to the server's workers
 func (s *Server) ImportMetrics(ctx context.Context, jsonMetrics []samplers.JSONMetric) {
 	span, _ := trace.StartSpanFromContext(ctx, "veneur.opentracing.import.import_metrics")
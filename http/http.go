@@ -2,10 +2,12 @@ package http
 
 import (
 	"bytes"
+	"compress/gzip"
 	"compress/zlib"
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptrace"
@@ -15,8 +17,10 @@ import (
 	"time"
 
 	"github.com/sirupsen/logrus"
+	"github.com/stripe/veneur/internal/idempotency"
 	"github.com/stripe/veneur/ssf"
 	"github.com/stripe/veneur/trace"
+	"github.com/stripe/veneur/trace/metrics"
 )
 
 var tracer = trace.GlobalTracer
@@ -138,6 +142,42 @@ func (tripper *TraceRoundTripper) RoundTrip(req *http.Request) (*http.Response,
 	return tripper.inner.RoundTrip(req)
 }
 
+// MetricKeyHTTPConnections is reported as a counter by the round
+// tripper that NewConnectionReportingRoundTripper returns, for each
+// request that gets a connection. Tagged with the `client` that made
+// it and with `state:new` or `state:reused`.
+const MetricKeyHTTPConnections = "http.connections_total"
+
+type connectionReportingRoundTripper struct {
+	inner  http.RoundTripper
+	tc     *trace.Client
+	client string
+}
+
+// NewConnectionReportingRoundTripper wraps inner so that it reports
+// whether each request reuses a pooled connection or opens a new one,
+// as MetricKeyHTTPConnections. Unlike a TraceRoundTripper, it reports
+// no spans.
+func NewConnectionReportingRoundTripper(inner http.RoundTripper, tc *trace.Client, client string) http.RoundTripper {
+	return &connectionReportingRoundTripper{inner: inner, tc: tc, client: client}
+}
+
+func (rt *connectionReportingRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	ct := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			state := "new"
+			if info.Reused {
+				state = "reused"
+			}
+			metrics.ReportOne(rt.tc, ssf.Count(MetricKeyHTTPConnections, 1, map[string]string{
+				"client": rt.client,
+				"state":  state,
+			}))
+		},
+	}
+	return rt.inner.RoundTrip(req.WithContext(httptrace.WithClientTrace(req.Context(), ct)))
+}
+
 func mergeTags(tags map[string]string, k, v string) map[string]string {
 	ret := make(map[string]string, len(tags)+1)
 	for k, v := range tags {
@@ -147,6 +187,55 @@ func mergeTags(tags map[string]string, k, v string) map[string]string {
 	return ret
 }
 
+// Compression is a Content-Encoding that request bodies are compressed
+// with.
+type Compression string
+
+const (
+	// CompressionNone sends request bodies uncompressed.
+	CompressionNone Compression = "none"
+	// CompressionDeflate compresses request bodies with zlib.
+	CompressionDeflate Compression = "deflate"
+	// CompressionGzip compresses request bodies with gzip.
+	CompressionGzip Compression = "gzip"
+)
+
+// ParseCompression returns the compression with the given name, as
+// configured, or def if the name is empty.
+func ParseCompression(name string, def Compression) (Compression, error) {
+	switch c := Compression(name); c {
+	case "":
+		return def, nil
+	case CompressionNone, CompressionDeflate, CompressionGzip:
+		return c, nil
+	}
+	return "", fmt.Errorf("unknown compression %q, supported are %q, %q and %q", name, CompressionNone, CompressionDeflate, CompressionGzip)
+}
+
+// compress compresses body with the compression c.
+func (c Compression) compress(body []byte) ([]byte, error) {
+	var (
+		buf bytes.Buffer
+		w   io.WriteCloser
+	)
+	switch c {
+	case CompressionDeflate:
+		w = zlib.NewWriter(&buf)
+	case CompressionGzip:
+		w = gzip.NewWriter(&buf)
+	default:
+		return body, nil
+	}
+	if _, err := w.Write(body); err != nil {
+		return nil, err
+	}
+	// don't forget to flush leftover compressed bytes to the buffer
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
 // PostHelper is shared code for POSTing to an endpoint, that consumes JSON, is zlib-
 // compressed, that returns 202 on success, that has a small response
 // action as a string used for statsd metric names and log messages emitted from
@@ -154,6 +243,20 @@ func mergeTags(tags map[string]string, k, v string) map[string]string {
 // you can disable compression with compress=false for endpoints that don't
 // support it
 func PostHelper(ctx context.Context, httpClient *http.Client, tc *trace.Client, method string, endpoint string, bodyObject interface{}, action string, compress bool, extraTags map[string]string, log *logrus.Logger) error {
+	compression := CompressionNone
+	if compress {
+		compression = CompressionDeflate
+	}
+	return PostCompressed(ctx, httpClient, tc, method, endpoint, bodyObject, action, compression, extraTags, log)
+}
+
+// PostCompressed is PostHelper with a choice of compression. The ratio
+// of the uncompressed to the compressed size of the body is reported
+// as action+".compression_ratio". If the endpoint rejects the
+// compressed body with a 415 (Unsupported Media Type), the body is
+// sent again uncompressed. If ctx carries an idempotency key, it is
+// sent in the Idempotency-Key header.
+func PostCompressed(ctx context.Context, httpClient *http.Client, tc *trace.Client, method string, endpoint string, bodyObject interface{}, action string, compression Compression, extraTags map[string]string, log *logrus.Logger) error {
 	span, _ := trace.StartSpanFromContext(ctx, "")
 	span.SetTag("action", action)
 	for k, v := range extraTags {
@@ -165,40 +268,56 @@ func PostHelper(ctx context.Context, httpClient *http.Client, tc *trace.Client,
 	innerLogger := log.WithField("action", action)
 
 	marshalStart := time.Now()
-	var (
-		bodyBuffer bytes.Buffer
-		encoder    *json.Encoder
-		compressor *zlib.Writer
-	)
-	if compress {
-		compressor = zlib.NewWriter(&bodyBuffer)
-		encoder = json.NewEncoder(compressor)
-	} else {
-		encoder = json.NewEncoder(&bodyBuffer)
-	}
-	if err := encoder.Encode(bodyObject); err != nil {
+	var jsonBuffer bytes.Buffer
+	if err := json.NewEncoder(&jsonBuffer).Encode(bodyObject); err != nil {
 		span.Error(err)
 		span.Add(ssf.Count(action+".error_total", 1, mergeTags(extraTags, "cause", "json")))
 		innerLogger.WithError(err).Error("Could not render JSON")
 		return err
 	}
-	if compress {
-		// don't forget to flush leftover compressed bytes to the buffer
-		if err := compressor.Close(); err != nil {
-			span.Error(err)
-			span.Add(ssf.Count(action+".error_total", 1, mergeTags(extraTags, "cause", "compress")))
-			innerLogger.WithError(err).Error("Could not finalize compression")
-			return err
-		}
+	body, err := compression.compress(jsonBuffer.Bytes())
+	if err != nil {
+		span.Error(err)
+		span.Add(ssf.Count(action+".error_total", 1, mergeTags(extraTags, "cause", "compress")))
+		innerLogger.WithError(err).Error("Could not finalize compression")
+		return err
 	}
 	span.Add(ssf.Timing(action+".duration_ns", time.Since(marshalStart), time.Nanosecond, mergeTags(extraTags, "part", "json")))
+	if compression != CompressionNone && len(body) > 0 {
+		ratio := float32(jsonBuffer.Len()) / float32(len(body))
+		span.Add(ssf.Gauge(action+".compression_ratio", ratio, mergeTags(extraTags, "encoding", string(compression))))
+	}
+
+	err = post(ctx, span, httpClient, tc, method, endpoint, body, compression, action, extraTags, innerLogger)
+	if statusErr, ok := err.(statusError); ok && statusErr == http.StatusUnsupportedMediaType && compression != CompressionNone {
+		span.Add(ssf.Count(action+".compression_rejected_total", 1, mergeTags(extraTags, "encoding", string(compression))))
+		innerLogger.WithField("encoding", compression).Warn("Endpoint rejected the compressed body, sending it uncompressed")
+		err = post(ctx, span, httpClient, tc, method, endpoint, jsonBuffer.Bytes(), CompressionNone, action, extraTags, innerLogger)
+	}
+	if err != nil {
+		return err
+	}
+
+	// make sure the error metric isn't sparse
+	span.Add(ssf.Count(action+".error_total", 0, nil))
+	return nil
+}
+
+// statusError is the error of a request that the endpoint answered
+// with an unsuccessful status code.
+type statusError int
 
-	// Len reports the unread length, so we have to record this before the
-	// http client consumes it
-	bodyLength := bodyBuffer.Len()
+func (e statusError) Error() string {
+	return strconv.Itoa(int(e))
+}
+
+// post sends one request with a body that is compressed with
+// compression, and reports its outcome to span.
+func post(ctx context.Context, span *trace.Span, httpClient *http.Client, tc *trace.Client, method string, endpoint string, body []byte, compression Compression, action string, extraTags map[string]string, innerLogger *logrus.Entry) error {
+	bodyLength := len(body)
 	span.Add(ssf.Count(action+".content_length_bytes", float32(bodyLength), nil))
 
-	req, err := http.NewRequest(method, endpoint, &bodyBuffer)
+	req, err := http.NewRequest(method, endpoint, bytes.NewReader(body))
 	if err != nil {
 		span.Error(err)
 		span.Add(ssf.Count(action+".error_total", 1, mergeTags(extraTags, "cause", "construct")))
@@ -208,8 +327,11 @@ func PostHelper(ctx context.Context, httpClient *http.Client, tc *trace.Client,
 
 	req = req.WithContext(ctx)
 	req.Header.Set("Content-Type", "application/json")
-	if compress {
-		req.Header.Set("Content-Encoding", "deflate")
+	if compression != CompressionNone {
+		req.Header.Set("Content-Encoding", string(compression))
+	}
+	if key := idempotency.FromContext(ctx); key != "" {
+		req.Header.Set(idempotency.HTTPHeader, key)
 	}
 
 	err = tracer.InjectRequest(span.Trace, req)
@@ -261,15 +383,13 @@ func PostHelper(ctx context.Context, httpClient *http.Client, tc *trace.Client,
 	})
 
 	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusAccepted {
-		err := fmt.Errorf("%v", resp.StatusCode)
+		err := statusError(resp.StatusCode)
 		span.Error(err)
 		span.Add(ssf.Count(action+".error_total", 1, mergeTags(extraTags, "cause", strconv.Itoa(resp.StatusCode))))
 		resultLogger.WithError(err).Warn("Could not POST")
 		return err
 	}
 
-	// make sure the error metric isn't sparse
-	span.Add(ssf.Count(action+".error_total", 0, nil))
 	resultLogger.Debug("POSTed successfully")
 	return nil
 }
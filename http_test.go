@@ -14,6 +14,7 @@ import (
 	"path/filepath"
 	"sort"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 
@@ -21,6 +22,9 @@ import (
 
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	vhttp "github.com/stripe/veneur/http"
+	"github.com/stripe/veneur/internal/idempotency"
 	"github.com/stripe/veneur/samplers"
 )
 
@@ -124,6 +128,82 @@ func testServerImport(t *testing.T, filename string, contentEncoding string) {
 	assert.Equal(t, http.StatusAccepted, w.Code, "Test server returned wrong HTTP response code")
 }
 
+func TestServerImportSamples(t *testing.T) {
+	gzipped := func(body string) io.Reader {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		gz.Write([]byte(body))
+		gz.Close()
+		return &buf
+	}
+
+	tests := []struct {
+		name     string
+		body     io.Reader
+		encoding string
+		status   int
+		names    []string
+	}{
+		{
+			"array",
+			strings.NewReader(`[{"metric": "COUNTER", "name": "a.counter", "value": 1, "tags": {"foo": "bar"}}, {"metric": 1, "name": "a.gauge", "double_value": 2.5}]`),
+			"", http.StatusAccepted, []string{"a.counter", "a.gauge"},
+		},
+		{
+			"batch",
+			strings.NewReader(`{"batch": [{"metric": "histogram", "name": "a.histogram", "value": 3, "sample_rate": 1}]}`),
+			"", http.StatusAccepted, []string{"a.histogram"},
+		},
+		{
+			"gzipped",
+			gzipped(`[{"metric": "SET", "name": "a.set", "message": "member"}]`),
+			"gzip", http.StatusAccepted, []string{"a.set"},
+		},
+		{"malformed", strings.NewReader(`[{"metric": "COUNTER", "name": `), "", http.StatusBadRequest, nil},
+		{"unknown type", strings.NewReader(`[{"metric": "TIMER", "name": "a.timer"}]`), "", http.StatusBadRequest, nil},
+		{"nameless", strings.NewReader(`[{"metric": "GAUGE", "value": 1}]`), "", http.StatusBadRequest, nil},
+		{"empty", strings.NewReader(`[]`), "", http.StatusBadRequest, nil},
+		{"corrupt gzip", strings.NewReader(`[]`), "gzip", http.StatusBadRequest, nil},
+		{"unknown encoding", strings.NewReader(`[]`), "br", http.StatusUnsupportedMediaType, nil},
+		{
+			"oversized",
+			strings.NewReader(`[{"metric": "COUNTER", "name": "` + strings.Repeat("a", 1024) + `", "value": 1}]`),
+			"", http.StatusRequestEntityTooLarge, nil,
+		},
+		{
+			"oversized when decompressed",
+			gzipped(`[{"metric": "COUNTER", "name": "` + strings.Repeat("a", 1024) + `", "value": 1}]`),
+			"gzip", http.StatusRequestEntityTooLarge, nil,
+		},
+	}
+	for _, elt := range tests {
+		test := elt
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			s := &Server{
+				httpSamplesMaxBodyBytes: 1000,
+				Workers: []*Worker{
+					&Worker{PacketChan: make(chan samplers.UDPMetric, 10)},
+				},
+			}
+			r := httptest.NewRequest(http.MethodPost, "/import/samples", test.body)
+			r.Header.Set("Content-Encoding", test.encoding)
+			w := httptest.NewRecorder()
+			handleImportSamples(s).ServeHTTP(w, r)
+			assert.Equal(t, test.status, w.Code, "wrong response code; body: %s", w.Body.String())
+
+			for _, name := range test.names {
+				select {
+				case m := <-s.Workers[0].PacketChan:
+					assert.Equal(t, name, m.Name)
+				case <-time.After(5 * time.Second):
+					t.Fatalf("timed out waiting for %s", name)
+				}
+			}
+		})
+	}
+}
+
 func TestServerImportCompressed(t *testing.T) {
 	// Test that the global veneur instance can handle
 	// requests that provide compressed metrics
@@ -165,6 +245,40 @@ func TestServerImportGzip(t *testing.T) {
 	assert.Equal(t, http.StatusUnsupportedMediaType, w.Code, "Test server returned wrong HTTP response code")
 }
 
+func TestServerImportDuplicate(t *testing.T) {
+	ch := make(chan []samplers.InterMetric, 10)
+	sink, _ := NewChannelMetricSink(ch)
+	s := setupVeneurServer(t, globalConfig(), nil, sink, nil)
+	defer s.Shutdown()
+	ts := httptest.NewServer(handleImport(s))
+	defer ts.Close()
+
+	counter := samplers.NewCounter("a.b.c", nil)
+	counter.Sample(5, 1.0)
+	jm, err := counter.Export()
+	require.NoError(t, err)
+	batch := []samplers.JSONMetric{jm}
+
+	ctx := idempotency.WithKey(context.Background(), idempotency.NewKey())
+	for i := 0; i < 2; i++ {
+		require.NoError(t, vhttp.PostHelper(ctx, ts.Client(), s.TraceClient, http.MethodPost, ts.URL+"/import", batch, "forward", true, nil, logrus.New()))
+	}
+
+	deadline := time.After(5 * time.Second)
+	for {
+		s.Flush(context.Background())
+		select {
+		case metrics := <-ch:
+			require.Len(t, metrics, 1)
+			assert.Equal(t, 5.0, metrics[0].Value, "the batch that was sent again should be counted once")
+			return
+		case <-deadline:
+			t.Fatal("timed out waiting for the imported counter")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
 func TestServerImportCompressedInvalid(t *testing.T) {
 	// Test that the global veneur instance
 	// properly responds to invalid zlib-deflated data
@@ -307,6 +421,35 @@ func TestNoTracingConfiguredTraceHealthCheck(t *testing.T) {
 	assert.Equal(t, http.StatusOK, w.Code, "Trace healthcheck reports tracing is enabled")
 }
 
+func TestFlushLast(t *testing.T) {
+	s := &Server{}
+	handler := s.Handler()
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/flush/last", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code, "there is no report before the first flush")
+
+	want := FlushReport{
+		Time:        time.Unix(1500000000, 0).UTC(),
+		Duration:    time.Second,
+		Metrics:     2,
+		FailedSinks: 1,
+		Sinks: []SinkFlushResult{
+			{Sink: "broken", Attempted: 2, Failed: 2, Duration: time.Second, Error: "the backend is down"},
+			{Sink: "working", Attempted: 2, Succeeded: 2, Duration: time.Millisecond},
+		},
+	}
+	s.setLastFlush(want)
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/flush/last", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	var got FlushReport
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&got))
+	assert.Equal(t, want, got)
+}
+
 func TestBuildDate(t *testing.T) {
 	r := httptest.NewRequest(http.MethodGet, "/builddate", nil)
 
@@ -1,6 +1,11 @@
 package importsrv
 
-import "github.com/stripe/veneur/trace"
+import (
+	"crypto/tls"
+
+	"github.com/stripe/veneur/internal/idempotency"
+	"github.com/stripe/veneur/trace"
+)
 
 // WithTraceClient sets the trace client for the server.  Otherwise it uses
 // trace.DefaultClient.
@@ -9,3 +14,37 @@ func WithTraceClient(c *trace.Client) Option {
 		opts.traceClient = c
 	}
 }
+
+// WithSpanIngester enables the ssfrpc.SSFImport service, which sends
+// the spans it receives to ingester.
+func WithSpanIngester(ingester SpanIngester) Option {
+	return func(opts *options) {
+		opts.spanIngester = ingester
+	}
+}
+
+// WithIdempotencyCache makes the server skip the batches of metrics
+// whose idempotency key the cache has seen already.
+func WithIdempotencyCache(cache *idempotency.Cache) Option {
+	return func(opts *options) {
+		opts.idempotencyCache = cache
+	}
+}
+
+// WithAckInterval sets the number of spans after which a stream of
+// spans is acknowledged. Otherwise, streams are acknowledged every 100
+// spans.
+func WithAckInterval(n int64) Option {
+	return func(opts *options) {
+		if n > 0 {
+			opts.ackInterval = n
+		}
+	}
+}
+
+// WithTLSConfig makes the server serve TLS, with the configuration.
+func WithTLSConfig(c *tls.Config) Option {
+	return func(opts *options) {
+		opts.tlsConfig = c
+	}
+}
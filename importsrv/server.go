@@ -3,33 +3,61 @@
 // The Server wraps a grpc.Server, and implements the forwardrpc.Forward
 // service.  It receives batches of metrics, then hashes them to a specific
 // "MetricIngester" and forwards them on.
+//
+// If it has a SpanIngester, the Server also implements the
+// ssfrpc.SSFImport service, which receives streams of SSF spans.
 package importsrv
 
 import (
+	"crypto/tls"
 	"fmt"
+	"io"
 	"net"
 	"time"
 
 	"github.com/golang/protobuf/ptypes/empty"
+	opentracing "github.com/opentracing/opentracing-go"
 	"github.com/segmentio/fasthash/fnv1a"
 	"golang.org/x/net/context" // This can be replace with "context" after Go 1.8 support is dropped
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
 
 	"github.com/stripe/veneur/forwardrpc"
+	"github.com/stripe/veneur/internal/idempotency"
 	"github.com/stripe/veneur/samplers/metricpb"
 	"github.com/stripe/veneur/ssf"
+	"github.com/stripe/veneur/ssfrpc"
 	"github.com/stripe/veneur/trace"
+	"github.com/stripe/veneur/trace/metrics"
 )
 
 const (
 	responseDurationMetric = "import.response_duration_ns"
 )
 
+// MetricKeyDuplicateBatches is reported as a counter for each batch of
+// metrics that is skipped because its idempotency key was seen already.
+// Tagged with the `protocol` that the batch was sent over.
+const MetricKeyDuplicateBatches = "import.duplicate_batches_total"
+
+// defaultAckInterval is the number of spans after which StreamSpans
+// acknowledges the spans it has received, unless WithAckInterval is
+// given.
+const defaultAckInterval = 100
+
 // MetricIngester reads metrics from protobufs
 type MetricIngester interface {
 	IngestMetrics([]*metricpb.Metric)
 }
 
+// SpanIngester reads SSF spans. IngestSpan should block while the
+// ingester can't keep up, so that streaming clients are slowed down
+// by gRPC's flow control.
+type SpanIngester interface {
+	IngestSpan(*ssf.SSFSpan)
+}
+
 // Server wraps a gRPC server and implements the forwardrpc.Forward service.
 // It reads a list of metrics, and based on the provided key chooses a
 // MetricIngester to send it to.  A unique metric (name, tags, and type)
@@ -41,7 +69,11 @@ type Server struct {
 }
 
 type options struct {
-	traceClient *trace.Client
+	traceClient      *trace.Client
+	spanIngester     SpanIngester
+	ackInterval      int64
+	idempotencyCache *idempotency.Cache
+	tlsConfig        *tls.Config
 }
 
 // Option is returned by functions that serve as options to New, like
@@ -52,20 +84,28 @@ type Option func(*options)
 // output to.
 func New(metricOuts []MetricIngester, opts ...Option) *Server {
 	res := &Server{
-		Server:     grpc.NewServer(),
 		metricOuts: metricOuts,
-		opts:       &options{},
+		opts:       &options{ackInterval: defaultAckInterval},
 	}
 
 	for _, opt := range opts {
 		opt(res.opts)
 	}
 
+	var serverOpts []grpc.ServerOption
+	if res.opts.tlsConfig != nil {
+		serverOpts = append(serverOpts, grpc.Creds(credentials.NewTLS(res.opts.tlsConfig)))
+	}
+	res.Server = grpc.NewServer(serverOpts...)
+
 	if res.opts.traceClient == nil {
 		res.opts.traceClient = trace.DefaultClient
 	}
 
 	forwardrpc.RegisterForwardServer(res.Server, res)
+	if res.opts.spanIngester != nil {
+		ssfrpc.RegisterSSFImportServer(res.Server, res)
+	}
 
 	return res
 }
@@ -97,12 +137,18 @@ var (
 )
 
 // SendMetrics takes a list of metrics and hashes each one (based on the
-// metric key) to a specific metric ingester.
+// metric key) to a specific metric ingester. A list whose idempotency
+// key was seen already is acknowledged, but skipped.
 func (s *Server) SendMetrics(ctx context.Context, mlist *forwardrpc.MetricList) (*empty.Empty, error) {
-	span, _ := trace.StartSpanFromContext(ctx, "veneur.opentracing.importsrv.handle_send_metrics")
+	span, _ := trace.StartSpanFromContext(ctx, "veneur.opentracing.importsrv.handle_send_metrics", incomingParent(ctx)...)
 	span.SetTag("protocol", "grpc")
 	defer span.ClientFinish(s.opts.traceClient)
 
+	if s.opts.idempotencyCache.Seen(idempotency.FromIncomingContext(ctx)) {
+		span.Add(ssf.Count(MetricKeyDuplicateBatches, 1, grpcTags))
+		return &empty.Empty{}, nil
+	}
+
 	dests := make([][]*metricpb.Metric, len(s.metricOuts))
 
 	// group metrics by their destination
@@ -131,6 +177,58 @@ func (s *Server) SendMetrics(ctx context.Context, mlist *forwardrpc.MetricList)
 	return &empty.Empty{}, nil
 }
 
+// StreamSpans receives spans from a stream and sends them to the
+// span ingester. It acknowledges the spans it has received every so
+// often, and once the client closes its side of the stream.
+//
+// Since the ingester blocks while it is backed up, StreamSpans stops
+// reading from the stream, and gRPC's flow control in turn keeps the
+// client from sending more than the stream's window.
+func (s *Server) StreamSpans(stream ssfrpc.SSFImport_StreamSpansServer) error {
+	var received int64
+	defer func() {
+		metrics.ReportOne(s.opts.traceClient, ssf.Count("import.spans_total", float32(received), grpcTags))
+	}()
+	for {
+		span, err := stream.Recv()
+		if err == io.EOF {
+			return stream.Send(&ssfrpc.StreamSpansAck{Received: received})
+		}
+		if err != nil {
+			return err
+		}
+		s.opts.spanIngester.IngestSpan(span)
+		received++
+		if received%s.opts.ackInterval == 0 {
+			if err := stream.Send(&ssfrpc.StreamSpansAck{Received: received}); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// incomingParent returns the options that start a span as the child
+// of the span whose context the client sent in the request metadata,
+// in any of the header formats that the trace package extracts, if it
+// sent one.
+func incomingParent(ctx context.Context) []opentracing.StartSpanOption {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return nil
+	}
+	carrier := opentracing.TextMapCarrier{}
+	for k, vs := range md {
+		if len(vs) > 0 {
+			carrier[k] = vs[0]
+		}
+	}
+	parent, err := trace.GlobalTracer.Extract(opentracing.TextMap, carrier)
+	if err != nil {
+		return nil
+	}
+	return []opentracing.StartSpanOption{opentracing.ChildOf(parent)}
+}
+
 // hashMetric returns a 32-bit hash from the input metric based on its name,
 // type, and tags.
 //
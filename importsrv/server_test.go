@@ -3,15 +3,25 @@ package importsrv
 import (
 	"context"
 	"fmt"
+	"io"
 	"math/rand"
+	"net"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/stripe/veneur/forwardrpc"
+	"github.com/stripe/veneur/internal/idempotency"
 	"github.com/stripe/veneur/samplers/metricpb"
 	metrictest "github.com/stripe/veneur/samplers/metricpb/testutils"
+	"github.com/stripe/veneur/ssf"
+	"github.com/stripe/veneur/ssfrpc"
 	"github.com/stripe/veneur/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
 )
 
 type testMetricIngester struct {
@@ -69,6 +79,40 @@ func TestSendMetrics_Empty(t *testing.T) {
 		"any metrics")
 }
 
+func TestSendMetrics_Duplicate(t *testing.T) {
+	ingester := &testMetricIngester{}
+	s := New([]MetricIngester{ingester}, WithIdempotencyCache(idempotency.NewCache(time.Minute, 10)))
+	mlist := &forwardrpc.MetricList{Metrics: []*metricpb.Metric{
+		&metricpb.Metric{Name: "test.counter", Type: metricpb.Type_Counter},
+	}}
+
+	incoming := func(key string) context.Context {
+		return metadata.NewIncomingContext(context.Background(), metadata.Pairs(idempotency.MetadataKey, key))
+	}
+	s.SendMetrics(incoming("first"), mlist)
+	s.SendMetrics(incoming("first"), mlist)
+	assert.Len(t, ingester.metrics, 1, "the list that was sent again should be ingested once")
+
+	s.SendMetrics(incoming("second"), mlist)
+	s.SendMetrics(context.Background(), mlist)
+	s.SendMetrics(context.Background(), mlist)
+	assert.Len(t, ingester.metrics, 4, "lists with other keys, or none, should be ingested")
+}
+
+func TestIncomingParent(t *testing.T) {
+	assert.Nil(t, incomingParent(context.Background()))
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(
+		"x-b3-traceid", "463ac35c9f6413ad",
+		"x-b3-spanid", "00000000000000a1",
+		"x-b3-sampled", "1",
+	))
+	span, _ := trace.StartSpanFromContext(ctx, "test", incomingParent(ctx)...)
+	assert.Equal(t, int64(0x463ac35c9f6413ad), span.TraceID)
+	assert.Equal(t, int64(0xa1), span.ParentID, "the client's span should be the parent")
+	assert.Equal(t, "1", span.Tags[trace.SampledTag])
+}
+
 func TestOptions_WithTraceClient(t *testing.T) {
 	c, err := trace.NewClient(trace.DefaultVeneurAddress)
 	if err != nil {
@@ -80,6 +124,94 @@ func TestOptions_WithTraceClient(t *testing.T) {
 		"set the trace client")
 }
 
+// slowSpanIngester ingests spans only as they are read from its
+// channel.
+type slowSpanIngester struct {
+	spans chan *ssf.SSFSpan
+}
+
+func (si *slowSpanIngester) IngestSpan(span *ssf.SSFSpan) {
+	si.spans <- span
+}
+
+func TestStreamSpans_Backpressure(t *testing.T) {
+	ingester := &slowSpanIngester{spans: make(chan *ssf.SSFSpan)}
+	s := New([]MetricIngester{}, WithSpanIngester(ingester), WithAckInterval(10))
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go s.Server.Serve(ln)
+	defer s.Stop()
+
+	conn, err := grpc.Dial(ln.Addr().String(), grpc.WithInsecure())
+	require.NoError(t, err)
+	defer conn.Close()
+	stream, err := ssfrpc.NewSSFImportClient(conn).StreamSpans(context.Background())
+	require.NoError(t, err)
+
+	// Send far more than fits into gRPC's flow control windows:
+	const total = 200
+	big := strings.Repeat("x", 64*1024)
+	var sent int64
+	sendDone := make(chan error, 1)
+	go func() {
+		for i := int64(1); i <= total; i++ {
+			span := &ssf.SSFSpan{Id: i, TraceId: i, Name: "span", Tags: map[string]string{"big": big}}
+			if err := stream.Send(span); err != nil {
+				sendDone <- err
+				return
+			}
+			atomic.StoreInt64(&sent, i)
+		}
+		sendDone <- stream.CloseSend()
+	}()
+
+	// While the ingester is stalled, the client must be held up:
+	time.Sleep(500 * time.Millisecond)
+	stalled := atomic.LoadInt64(&sent)
+	assert.True(t, stalled < total, "the client should be backpressured, but sent all %d spans", stalled)
+
+	var acks []int64
+	acksDone := make(chan error, 1)
+	go func() {
+		for {
+			ack, err := stream.Recv()
+			if err == io.EOF {
+				acksDone <- nil
+				return
+			}
+			if err != nil {
+				acksDone <- err
+				return
+			}
+			acks = append(acks, ack.Received)
+		}
+	}()
+
+	// Drain slowly, and check that the spans arrive in order:
+	for i := int64(1); i <= total; i++ {
+		select {
+		case span := <-ingester.spans:
+			require.Equal(t, i, span.Id)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for span %d", i)
+		}
+	}
+	require.NoError(t, <-sendDone)
+	require.NoError(t, <-acksDone)
+
+	require.Len(t, acks, total/10+1, "spans should be acknowledged every 10 spans and at the end")
+	for i, ack := range acks[:total/10] {
+		assert.Equal(t, int64(10*(i+1)), ack)
+	}
+	assert.Equal(t, int64(total), acks[len(acks)-1])
+}
+
+func TestStreamSpans_Unregistered(t *testing.T) {
+	s := New([]MetricIngester{})
+	_, ok := s.GetServiceInfo()["ssfrpc.SSFImport"]
+	assert.False(t, ok, "without a span ingester, the SSF import service shouldn't be registered")
+}
+
 type noopChannelMetricIngester struct {
 	in   chan []*metricpb.Metric
 	quit chan struct{}
@@ -0,0 +1,147 @@
+package veneur
+
+import (
+	"sync/atomic"
+
+	"github.com/stripe/veneur/samplers"
+	"github.com/stripe/veneur/ssf"
+)
+
+// The sources that samples are ingested from, as reported in the
+// source tag of veneur.ingest.dropped_total.
+const (
+	ingestSourceStatsd = "statsd"
+	ingestSourceSSF    = "ssf"
+)
+
+// The reasons that samples are dropped on ingestion.
+const (
+	dropReasonQueueFull   = "queue_full"
+	dropReasonParseError  = "parse_error"
+	dropReasonRateLimited = "rate_limited"
+	dropReasonInvalid     = "invalid"
+)
+
+// ingestDropKey identifies a counter of dropped samples.
+type ingestDropKey struct {
+	source string
+	reason string
+}
+
+// countDrop counts a sample from source that was dropped for reason.
+// The counts are flushed as veneur.ingest.dropped_total.
+func (s *Server) countDrop(source, reason string) {
+	key := ingestDropKey{source: source, reason: reason}
+	count, ok := s.ingestDrops.Load(key)
+	if !ok {
+		count, _ = s.ingestDrops.LoadOrStore(key, new(int64))
+	}
+	atomic.AddInt64(count.(*int64), 1)
+}
+
+// workerFor returns the worker that aggregates m. The cardinality limit
+// is applied first, as it can replace m's tags, and with them the
+// worker that m's series belongs to.
+func (s *Server) workerFor(m *samplers.UDPMetric) *Worker {
+	if s.cardinalityLimiter != nil {
+		s.cardinalityLimiter.limit(m)
+	}
+	return s.Workers[m.Digest%uint32(len(s.Workers))]
+}
+
+// limitedProcessor hands the metrics that are extracted from spans to
+// the server's workers, applying the cardinality limit before picking
+// the worker.
+type limitedProcessor struct {
+	s *Server
+}
+
+// IngestUDP hands m to the worker that aggregates its series.
+func (p limitedProcessor) IngestUDP(m samplers.UDPMetric) {
+	p.s.workerFor(&m).IngestUDP(m)
+}
+
+// enqueueMetric hands a statsd sample to a worker. If the worker is
+// backed up, it blocks, unless ingest_drop_when_full is set, in which
+// case the sample is dropped.
+func (s *Server) enqueueMetric(w *Worker, m samplers.UDPMetric) {
+	if !s.ingestDropWhenFull {
+		w.PacketChan <- m
+		return
+	}
+	select {
+	case w.PacketChan <- m:
+	default:
+		s.countDrop(ingestSourceStatsd, dropReasonQueueFull)
+	}
+}
+
+// enqueueSpan hands a span to the span workers. Like enqueueMetric, it
+// drops the span if the span channel is full and ingest_drop_when_full
+// is set; spans received over gRPC always wait, so that clients are
+// slowed down instead.
+func (s *Server) enqueueSpan(span *ssf.SSFSpan, ssfFormat string) {
+	if !s.ingestDropWhenFull || ssfFormat == "grpc" {
+		s.SpanChan <- span
+		return
+	}
+	select {
+	case s.SpanChan <- span:
+	default:
+		s.countDrop(ingestSourceSSF, dropReasonQueueFull)
+	}
+}
+
+// validateSpan checks a span that is part of a trace, after repairing
+// it first if span_validation is "repair", and returns the span to
+// ingest. Invalid spans are dropped, but the metrics that they carry
+// are kept: validateSpan returns a span with just those metrics, or nil
+// if there are none.
+func (s *Server) validateSpan(span *ssf.SSFSpan, counts *ssfServiceSpanMetrics) *ssf.SSFSpan {
+	if !carriesTrace(span) {
+		return span
+	}
+	if s.spanRepair && span.Repair() {
+		atomic.AddInt64(&counts.ssfSpansRepairedTotal, 1)
+	}
+	err := span.Validate()
+	if err == nil {
+		return span
+	}
+	atomic.AddInt64(&counts.ssfSpansInvalidTotal, 1)
+	s.countDrop(ingestSourceSSF, dropReasonInvalid)
+	log.WithError(err).Debug("Dropping invalid span")
+	if len(span.Metrics) == 0 {
+		return nil
+	}
+	return &ssf.SSFSpan{Metrics: span.Metrics, Tags: span.Tags}
+}
+
+// carriesTrace returns whether a span is part of a trace. Spans that
+// only carry metrics have neither IDs nor timestamps.
+func carriesTrace(span *ssf.SSFSpan) bool {
+	return span.Id != 0 || span.TraceId != 0 || span.StartTimestamp != 0 || span.EndTimestamp != 0
+}
+
+// reportIngestQueues reports how full the ingestion queues are, and
+// how many samples were dropped on ingestion since the last flush.
+func (s *Server) reportIngestQueues() {
+	var elements, capacity int
+	for _, w := range s.Workers {
+		elements += len(w.PacketChan)
+		capacity += cap(w.PacketChan)
+	}
+	s.Statsd.Gauge("worker.packet_chan.total_elements", float64(elements), nil, 1.0)
+	s.Statsd.Gauge("worker.packet_chan.total_capacity", float64(capacity), nil, 1.0)
+	s.Statsd.Gauge("worker.span_chan.total_elements", float64(len(s.SpanChan)), nil, 1.0)
+	s.Statsd.Gauge("worker.span_chan.total_capacity", float64(cap(s.SpanChan)), nil, 1.0)
+
+	s.ingestDrops.Range(func(k, v interface{}) bool {
+		key := k.(ingestDropKey)
+		if n := atomic.SwapInt64(v.(*int64), 0); n > 0 {
+			s.Statsd.Count("ingest.dropped_total", n,
+				[]string{"source:" + key.source, "reason:" + key.reason}, 1.0)
+		}
+		return true
+	})
+}
@@ -0,0 +1,153 @@
+// Package idempotency lets the receivers of forwarded batches of metrics
+// recognize the batches that they received already.
+//
+// The sender of a batch gives it a random key, which stays the same if
+// the batch is sent again, and the receiver remembers the keys it has
+// seen for a while, and skips the batches whose key it has seen. Over
+// HTTP the key is sent in the Idempotency-Key header, which also lets
+// net/http retry a POST on a kept-alive connection that broke; over
+// gRPC it is sent in the request metadata. A proxy that splits a batch
+// between destinations derives the keys of the shares it forwards from
+// the key of the batch, with Derive.
+package idempotency
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+	"google.golang.org/grpc/metadata"
+)
+
+// HTTPHeader is the header that carries the key of a batch sent over
+// HTTP.
+const HTTPHeader = "Idempotency-Key"
+
+// MetadataKey is the gRPC metadata key that carries the key of a batch
+// sent over gRPC.
+const MetadataKey = "veneur-idempotency-key"
+
+// NewKey returns a new random key, or "" if no random key could be
+// made. A batch sent without a key is never recognized as a
+// duplicate.
+func NewKey() string {
+	id, err := uuid.NewV4()
+	if err != nil {
+		return ""
+	}
+	return id.String()
+}
+
+// Derive returns the key of the share of a batch with key that is
+// forwarded to dest. It is the same every time the batch is forwarded
+// to dest, even through another proxy, so that the destination
+// recognizes a batch that was sent to the proxy again. If key is "",
+// Derive returns a new random key.
+func Derive(key, dest string) string {
+	if key == "" {
+		return NewKey()
+	}
+	sum := sha256.Sum256([]byte(key + "\x00" + dest))
+	return hex.EncodeToString(sum[:16])
+}
+
+type contextKey struct{}
+
+// WithKey returns a context that sends key with the batch that is sent
+// with it, over HTTP (with the http package's helpers) or gRPC. It
+// replaces any key that ctx had already.
+func WithKey(ctx context.Context, key string) context.Context {
+	if key == "" {
+		return ctx
+	}
+	ctx = context.WithValue(ctx, contextKey{}, key)
+	md, _ := metadata.FromOutgoingContext(ctx)
+	md = md.Copy()
+	md[MetadataKey] = []string{key}
+	return metadata.NewOutgoingContext(ctx, md)
+}
+
+// FromContext returns the key that WithKey added to ctx, if any.
+func FromContext(ctx context.Context) string {
+	key, _ := ctx.Value(contextKey{}).(string)
+	return key
+}
+
+// FromIncomingContext returns the key that the client of a gRPC
+// request sent with it, if any.
+func FromIncomingContext(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+	if keys := md[MetadataKey]; len(keys) > 0 {
+		return keys[0]
+	}
+	return ""
+}
+
+// Cache remembers the keys that it has seen within a window of time, up
+// to a maximum number of them: once it is full, the oldest keys are
+// forgotten early. A nil Cache remembers nothing.
+type Cache struct {
+	window time.Duration
+	size   int
+
+	mtx sync.Mutex
+	// seen holds the keys that were seen within the window, and order
+	// holds them in the order that they were seen in.
+	seen  map[string]*list.Element
+	order *list.List
+	now   func() time.Time
+}
+
+type seenKey struct {
+	key string
+	at  time.Time
+}
+
+// NewCache returns a Cache that remembers up to size keys for window.
+func NewCache(window time.Duration, size int) *Cache {
+	return &Cache{
+		window: window,
+		size:   size,
+		seen:   map[string]*list.Element{},
+		order:  list.New(),
+		now:    time.Now,
+	}
+}
+
+// Seen reports whether key was seen within the window, and remembers
+// it if it wasn't. The empty key is never seen.
+func (c *Cache) Seen(key string) bool {
+	if c == nil || key == "" {
+		return false
+	}
+	now := c.now()
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	for elt := c.order.Front(); elt != nil; elt = c.order.Front() {
+		if now.Sub(elt.Value.(*seenKey).at) <= c.window {
+			break
+		}
+		c.forget(elt)
+	}
+	if _, ok := c.seen[key]; ok {
+		return true
+	}
+	for c.order.Len() >= c.size && c.order.Len() > 0 {
+		c.forget(c.order.Front())
+	}
+	c.seen[key] = c.order.PushBack(&seenKey{key: key, at: now})
+	return false
+}
+
+// forget removes a key from the cache. c.mtx must be held.
+func (c *Cache) forget(elt *list.Element) {
+	delete(c.seen, c.order.Remove(elt).(*seenKey).key)
+}
@@ -0,0 +1,76 @@
+package idempotency
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestCacheWindow(t *testing.T) {
+	now := time.Unix(1000, 0)
+	c := NewCache(time.Minute, 10)
+	c.now = func() time.Time { return now }
+
+	assert.False(t, c.Seen("a"))
+	assert.True(t, c.Seen("a"))
+	assert.False(t, c.Seen(""), "the empty key should never be seen")
+	assert.False(t, c.Seen(""))
+
+	now = now.Add(2 * time.Minute)
+	assert.False(t, c.Seen("a"), "keys should be forgotten after the window")
+	assert.True(t, c.Seen("a"))
+}
+
+func TestCacheSize(t *testing.T) {
+	c := NewCache(time.Minute, 2)
+	assert.False(t, c.Seen("a"))
+	assert.False(t, c.Seen("b"))
+	assert.True(t, c.Seen("a"), "seeing a key again shouldn't evict another")
+	assert.False(t, c.Seen("c"))
+	assert.False(t, c.Seen("a"), "the oldest key should be forgotten once the cache is full")
+	assert.True(t, c.Seen("c"))
+	assert.Len(t, c.seen, 2)
+}
+
+func TestCacheNil(t *testing.T) {
+	var c *Cache
+	assert.False(t, c.Seen("a"))
+	assert.False(t, c.Seen("a"))
+}
+
+func TestWithKey(t *testing.T) {
+	key := NewKey()
+	assert.Len(t, key, 36)
+	assert.NotEqual(t, key, NewKey())
+
+	ctx := WithKey(context.Background(), key)
+	assert.Equal(t, key, FromContext(ctx))
+
+	md, ok := metadata.FromOutgoingContext(ctx)
+	assert.True(t, ok)
+	incoming := metadata.NewIncomingContext(context.Background(), md)
+	assert.Equal(t, key, FromIncomingContext(incoming))
+
+	assert.Equal(t, "", FromContext(context.Background()))
+	assert.Equal(t, "", FromIncomingContext(context.Background()))
+}
+
+func TestWithKeyReplaces(t *testing.T) {
+	ctx := WithKey(context.Background(), "a")
+	ctx = WithKey(ctx, "b")
+	assert.Equal(t, "b", FromContext(ctx))
+
+	md, _ := metadata.FromOutgoingContext(ctx)
+	assert.Equal(t, []string{"b"}, md[MetadataKey])
+}
+
+func TestDerive(t *testing.T) {
+	assert.Equal(t, Derive("a", "dest1"), Derive("a", "dest1"))
+	assert.NotEqual(t, Derive("a", "dest1"), Derive("a", "dest2"))
+	assert.NotEqual(t, Derive("a", "dest1"), Derive("b", "dest1"))
+	assert.NotEqual(t, Derive("", "dest1"), Derive("", "dest1"),
+		"batches without a key should get a new key each time")
+}
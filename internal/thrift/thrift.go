@@ -0,0 +1,164 @@
+// Package thrift writes structs in the thrift compact protocol, which
+// Parquet uses to encode its page headers and file metadata, and the
+// Jaeger agent accepts spans in.
+//
+// It only covers the parts of the protocol that veneur writes, without
+// the code generation that the Apache Thrift library relies on.
+package thrift
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+)
+
+// Type IDs of the thrift compact protocol, for the headers of fields
+// and lists.
+const (
+	TypeI32    byte = 5
+	TypeI64    byte = 6
+	TypeDouble byte = 7
+	TypeBinary byte = 8
+	TypeList   byte = 9
+	TypeStruct byte = 12
+
+	typeTrue  byte = 1
+	typeFalse byte = 2
+)
+
+// Writer writes structs in the thrift compact protocol. Fields must be
+// written in increasing order of their IDs, as the protocol encodes
+// each field's ID relative to the previous one.
+type Writer struct {
+	buf    bytes.Buffer
+	lastID int16
+	stack  []int16
+}
+
+// Bytes returns what was written so far.
+func (w *Writer) Bytes() []byte {
+	return w.buf.Bytes()
+}
+
+// Len returns the number of bytes written so far.
+func (w *Writer) Len() int {
+	return w.buf.Len()
+}
+
+func (w *Writer) uvarint(v uint64) {
+	var b [binary.MaxVarintLen64]byte
+	w.buf.Write(b[:binary.PutUvarint(b[:], v)])
+}
+
+func (w *Writer) varint(v int64) {
+	w.uvarint(uint64((v << 1) ^ (v >> 63)))
+}
+
+func (w *Writer) field(id int16, typ byte) {
+	if delta := id - w.lastID; delta > 0 && delta <= 15 {
+		w.buf.WriteByte(byte(delta)<<4 | typ)
+	} else {
+		w.buf.WriteByte(typ)
+		w.varint(int64(id))
+	}
+	w.lastID = id
+}
+
+// Message writes the header of a oneway call of the method; its
+// arguments follow as a struct, terminated by EndStruct.
+func (w *Writer) Message(method string, seq int32) {
+	const protocolID, version, oneway = 0x82, 1, 4
+	w.buf.WriteByte(protocolID)
+	w.buf.WriteByte(oneway<<5 | version)
+	w.uvarint(uint64(uint32(seq)))
+	w.ListString(method)
+	w.ListStruct()
+}
+
+// Bool writes a bool field.
+func (w *Writer) Bool(id int16, v bool) {
+	if v {
+		w.field(id, typeTrue)
+	} else {
+		w.field(id, typeFalse)
+	}
+}
+
+// I32 writes an i32 field.
+func (w *Writer) I32(id int16, v int32) {
+	w.field(id, TypeI32)
+	w.varint(int64(v))
+}
+
+// I64 writes an i64 field.
+func (w *Writer) I64(id int16, v int64) {
+	w.field(id, TypeI64)
+	w.varint(v)
+}
+
+// Double writes a double field.
+func (w *Writer) Double(id int16, v float64) {
+	w.field(id, TypeDouble)
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], math.Float64bits(v))
+	w.buf.Write(b[:])
+}
+
+// String writes a string field.
+func (w *Writer) String(id int16, s string) {
+	w.field(id, TypeBinary)
+	w.ListString(s)
+}
+
+// Binary writes a binary field.
+func (w *Writer) Binary(id int16, b []byte) {
+	w.field(id, TypeBinary)
+	w.uvarint(uint64(len(b)))
+	w.buf.Write(b)
+}
+
+// List writes the header of a list field with n elements of type typ.
+// The elements follow, written with the List* methods.
+func (w *Writer) List(id int16, typ byte, n int) {
+	w.field(id, TypeList)
+	if n < 15 {
+		w.buf.WriteByte(byte(n)<<4 | typ)
+	} else {
+		w.buf.WriteByte(0xf0 | typ)
+		w.uvarint(uint64(n))
+	}
+}
+
+// ListI32 writes an i32 that is an element of a list.
+func (w *Writer) ListI32(v int32) {
+	w.varint(int64(v))
+}
+
+// ListString writes a string that is an element of a list.
+func (w *Writer) ListString(s string) {
+	w.uvarint(uint64(len(s)))
+	w.buf.WriteString(s)
+}
+
+// BeginStruct starts a struct field; its fields follow, terminated by
+// EndStruct.
+func (w *Writer) BeginStruct(id int16) {
+	w.field(id, TypeStruct)
+	w.ListStruct()
+}
+
+// ListStruct starts a struct that is an element of a list; its fields
+// follow, terminated by EndStruct.
+func (w *Writer) ListStruct() {
+	w.stack = append(w.stack, w.lastID)
+	w.lastID = 0
+}
+
+// EndStruct terminates the struct that was started last.
+func (w *Writer) EndStruct() {
+	w.buf.WriteByte(0)
+	if n := len(w.stack); n > 0 {
+		w.lastID = w.stack[n-1]
+		w.stack = w.stack[:n-1]
+	}
+}
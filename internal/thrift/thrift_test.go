@@ -0,0 +1,163 @@
+package thrift
+
+import (
+	"testing"
+
+	apache "github.com/lightstep/lightstep-tracer-go/thrift_0_9_2/lib/go/thrift"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// The tests check the Writer against the Apache Thrift library's
+// implementation of the compact protocol, by writing the same structs
+// with both.
+
+type reference struct {
+	t   *testing.T
+	buf *apache.TMemoryBuffer
+	p   *apache.TCompactProtocol
+}
+
+func newReference(t *testing.T) *reference {
+	buf := apache.NewTMemoryBuffer()
+	return &reference{t: t, buf: buf, p: apache.NewTCompactProtocol(buf)}
+}
+
+func (r *reference) field(id int16, typ apache.TType) {
+	require.NoError(r.t, r.p.WriteFieldBegin("", typ, id))
+}
+
+func (r *reference) beginStruct() {
+	require.NoError(r.t, r.p.WriteStructBegin(""))
+}
+
+func (r *reference) endStruct() {
+	require.NoError(r.t, r.p.WriteFieldStop())
+	require.NoError(r.t, r.p.WriteStructEnd())
+}
+
+func (r *reference) bytes() []byte {
+	require.NoError(r.t, r.p.Flush())
+	return r.buf.Bytes()
+}
+
+func TestWriterFields(t *testing.T) {
+	w := &Writer{}
+	w.ListStruct()
+	w.Bool(1, true)
+	w.Bool(2, false)
+	w.I32(3, -42)
+	w.I64(5, 1<<40)
+	w.Double(6, -2.5)
+	w.String(7, "hello")
+	w.Binary(8, []byte{0, 1, 2})
+	// Too far from the previous ID to be written as a delta:
+	w.I64(100, -1)
+	w.BeginStruct(101)
+	w.String(1, "nested")
+	w.EndStruct()
+	w.I32(102, 7)
+	w.EndStruct()
+
+	r := newReference(t)
+	r.beginStruct()
+	r.field(1, apache.BOOL)
+	require.NoError(t, r.p.WriteBool(true))
+	r.field(2, apache.BOOL)
+	require.NoError(t, r.p.WriteBool(false))
+	r.field(3, apache.I32)
+	require.NoError(t, r.p.WriteI32(-42))
+	r.field(5, apache.I64)
+	require.NoError(t, r.p.WriteI64(1<<40))
+	r.field(6, apache.DOUBLE)
+	require.NoError(t, r.p.WriteDouble(-2.5))
+	r.field(7, apache.STRING)
+	require.NoError(t, r.p.WriteString("hello"))
+	r.field(8, apache.STRING)
+	require.NoError(t, r.p.WriteBinary([]byte{0, 1, 2}))
+	r.field(100, apache.I64)
+	require.NoError(t, r.p.WriteI64(-1))
+	r.field(101, apache.STRUCT)
+	r.beginStruct()
+	r.field(1, apache.STRING)
+	require.NoError(t, r.p.WriteString("nested"))
+	r.endStruct()
+	r.field(102, apache.I32)
+	require.NoError(t, r.p.WriteI32(7))
+	r.endStruct()
+
+	assert.Equal(t, r.bytes(), w.Bytes())
+	assert.Equal(t, len(w.Bytes()), w.Len())
+}
+
+func TestWriterLists(t *testing.T) {
+	ints := make([]int32, 20)
+	for i := range ints {
+		ints[i] = int32(i - 10)
+	}
+
+	w := &Writer{}
+	w.ListStruct()
+	w.List(1, TypeI32, len(ints))
+	for _, v := range ints {
+		w.ListI32(v)
+	}
+	w.List(2, TypeBinary, 2)
+	w.ListString("a")
+	w.ListString("b")
+	w.List(3, TypeStruct, 2)
+	for i := int64(0); i < 2; i++ {
+		w.ListStruct()
+		w.I64(1, i)
+		w.EndStruct()
+	}
+	w.I32(4, 1)
+	w.EndStruct()
+
+	r := newReference(t)
+	r.beginStruct()
+	r.field(1, apache.LIST)
+	require.NoError(t, r.p.WriteListBegin(apache.I32, len(ints)))
+	for _, v := range ints {
+		require.NoError(t, r.p.WriteI32(v))
+	}
+	r.field(2, apache.LIST)
+	require.NoError(t, r.p.WriteListBegin(apache.STRING, 2))
+	require.NoError(t, r.p.WriteString("a"))
+	require.NoError(t, r.p.WriteString("b"))
+	r.field(3, apache.LIST)
+	require.NoError(t, r.p.WriteListBegin(apache.STRUCT, 2))
+	for i := int64(0); i < 2; i++ {
+		r.beginStruct()
+		r.field(1, apache.I64)
+		require.NoError(t, r.p.WriteI64(i))
+		r.endStruct()
+	}
+	r.field(4, apache.I32)
+	require.NoError(t, r.p.WriteI32(1))
+	r.endStruct()
+
+	assert.Equal(t, r.bytes(), w.Bytes())
+}
+
+func TestWriterMessage(t *testing.T) {
+	w := &Writer{}
+	w.Message("emitBatch", 300)
+	w.BeginStruct(1)
+	w.String(1, "service")
+	w.EndStruct()
+	w.EndStruct()
+
+	r := newReference(t)
+	require.NoError(t, r.p.WriteMessageBegin("emitBatch", apache.ONEWAY, 300))
+	r.beginStruct()
+	r.field(1, apache.STRUCT)
+	r.beginStruct()
+	r.field(1, apache.STRING)
+	require.NoError(t, r.p.WriteString("service"))
+	r.endStruct()
+	r.endStruct()
+	require.NoError(t, r.p.WriteMessageEnd())
+
+	assert.Equal(t, r.bytes(), w.Bytes())
+}
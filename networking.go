@@ -67,6 +67,10 @@ func startProcessingOnUDP(s *Server, protocol string, addr *net.UDPAddr, pool *s
 				// SO_REUSEPORT support
 				panic(fmt.Sprintf("couldn't listen on UDP socket %v: %v", addr, err))
 			}
+			go func() {
+				<-s.shutdown
+				sock.Close()
+			}()
 			// Pass the address that we are listening on
 			// back to whoever spawned this goroutine so
 			// it can return that address.
@@ -140,9 +144,13 @@ func StartSSF(s *Server, a net.Addr, tracePool *sync.Pool) net.Addr {
 	case *net.UDPAddr:
 		a = startSSFUDP(s, addr, tracePool)
 	case *net.UnixAddr:
-		_, a = startSSFUnix(s, addr)
+		if addr.Network() == "unixgram" {
+			_, a = startSSFUnixgram(s, addr)
+		} else {
+			_, a = startSSFUnix(s, addr)
+		}
 	default:
-		panic(fmt.Sprintf("Can't listen for SSF on %v: only udp:// & unix:// are supported", a))
+		panic(fmt.Sprintf("Can't listen for SSF on %v: only udp://, unix:// & unixgram:// are supported", a))
 	}
 	log.WithFields(logrus.Fields{
 		"address": a.String(),
@@ -164,18 +172,7 @@ func startSSFUnix(s *Server, addr *net.UnixAddr) (<-chan struct{}, net.Addr) {
 	if addr.Network() != "unix" {
 		panic(fmt.Sprintf("Can't listen for SSF on %v: only udp:// and unix:// addresses are supported", addr))
 	}
-	// ensure we are the only ones locking this socket:
-	lockname := fmt.Sprintf("%s.lock", addr.String())
-	lock := flock.NewFlock(lockname)
-	locked, err := lock.TryLock()
-	if err != nil {
-		panic(fmt.Sprintf("Could not acquire the lock %q to listen on %v: %v", lockname, addr, err))
-	}
-	if !locked {
-		panic(fmt.Sprintf("Lock file %q for %v is in use by another process already", lockname, addr))
-	}
-	// We have the exclusive use of the socket, clear away any old sockets and listen:
-	_ = os.Remove(addr.String())
+	lock := lockUnixSocket(addr)
 	listener, err := net.ListenUnix(addr.Network(), addr)
 	if err != nil {
 		panic(fmt.Sprintf("Couldn't listen on UNIX socket %v: %v", addr, err))
@@ -221,3 +218,63 @@ func startSSFUnix(s *Server, addr *net.UnixAddr) (<-chan struct{}, net.Addr) {
 	}()
 	return done, listener.Addr()
 }
+
+// lockUnixSocket ensures that this process is the only one listening
+// on the UNIX domain socket address, and removes any socket file that
+// a previous listener left behind. It panics if the lock on the
+// address is held by another process.
+func lockUnixSocket(addr *net.UnixAddr) *flock.Flock {
+	lockname := fmt.Sprintf("%s.lock", addr.String())
+	lock := flock.NewFlock(lockname)
+	locked, err := lock.TryLock()
+	if err != nil {
+		panic(fmt.Sprintf("Could not acquire the lock %q to listen on %v: %v", lockname, addr, err))
+	}
+	if !locked {
+		panic(fmt.Sprintf("Lock file %q for %v is in use by another process already", lockname, addr))
+	}
+	// We have the exclusive use of the socket, clear away any old sockets:
+	_ = os.Remove(addr.String())
+	return lock
+}
+
+// startSSFUnixgram starts reading datagrams of framed SSF spans from
+// a UNIX domain datagram socket address, until the server's shutdown
+// channel is closed. startSSFUnixgram returns a channel that is closed
+// once the socket has been closed and removed.
+func startSSFUnixgram(s *Server, addr *net.UnixAddr) (<-chan struct{}, net.Addr) {
+	done := make(chan struct{})
+	lock := lockUnixSocket(addr)
+	conn, err := net.ListenUnixgram(addr.Network(), addr)
+	if err != nil {
+		panic(fmt.Sprintf("Couldn't listen on UNIX datagram socket %v: %v", addr, err))
+	}
+	if s.RcvbufBytes > 0 {
+		if err := conn.SetReadBuffer(s.RcvbufBytes); err != nil {
+			log.WithError(err).WithField("address", addr).Warn("Couldn't set the read buffer size")
+		}
+	}
+
+	// Make the socket writable by everyone with access to the socket pathname:
+	err = os.Chmod(addr.String(), 0666)
+	if err != nil {
+		panic(fmt.Sprintf("Couldn't set permissions on %v: %v", addr, err))
+	}
+
+	go func() {
+		<-s.shutdown
+		conn.Close()
+		// Unlike stream listeners, datagram sockets don't remove
+		// their socket file when closed:
+		os.Remove(addr.String())
+		lock.Unlock()
+		close(done)
+	}()
+	go func() {
+		defer func() {
+			ConsumePanic(s.Sentry, s.TraceClient, s.Hostname, recover())
+		}()
+		s.ReadSSFDatagramSocket(conn)
+	}()
+	return done, conn.LocalAddr()
+}
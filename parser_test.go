@@ -311,7 +311,7 @@ func TestParseSSFNonIndicatorSpan(t *testing.T) {
 
 func TestParseSSFBadMetric(t *testing.T) {
 	metric := freshSSFMetric()
-	metric.Metric = 5
+	metric.Metric = 99
 
 	trace := &ssf.SSFSpan{}
 
@@ -477,6 +477,95 @@ func TestParserWithTags(t *testing.T) {
 	assert.Contains(t, valueError.Error(), "Invalid number", "Invalid number error missing")
 }
 
+func TestParserDistribution(t *testing.T) {
+	m, err := samplers.ParseMetric([]byte("a.b.c:1.5|d"))
+	assert.NoError(t, err)
+	assert.Equal(t, "histogram", m.Type, "Type")
+	assert.Equal(t, samplers.GlobalOnly, m.Scope, "Scope")
+	assert.Equal(t, 1.5, m.Value, "Value")
+}
+
+func TestParserDistributionWithSampleRateAndTags(t *testing.T) {
+	m, err := samplers.ParseMetric([]byte("metric:1.5|d|@0.5|#a:b"))
+	assert.NoError(t, err)
+	assert.Equal(t, "metric", m.Name, "Name")
+	assert.Equal(t, "histogram", m.Type, "Type")
+	assert.Equal(t, samplers.GlobalOnly, m.Scope, "Scope")
+	assert.Equal(t, 1.5, m.Value, "Value")
+	assert.Equal(t, float32(0.5), m.SampleRate, "Sample Rate")
+	assert.Equal(t, []string{"a:b"}, m.Tags, "Tags")
+
+	h, err := samplers.ParseMetric([]byte("metric:1.5|h|@0.5|#a:b"))
+	assert.NoError(t, err)
+	assert.Equal(t, h.Digest, m.Digest, "distributions should aggregate with histograms of the same name")
+}
+
+func TestParserDistributionMultipleValues(t *testing.T) {
+	ms, err := samplers.ParseMetrics([]byte("metric:1:2:3|d|@0.5|#a:b"), 0)
+	assert.NoError(t, err)
+	if assert.Len(t, ms, 3) {
+		for i, m := range ms {
+			assert.Equal(t, "metric", m.Name, "Name")
+			assert.Equal(t, "histogram", m.Type, "Type")
+			assert.Equal(t, samplers.GlobalOnly, m.Scope, "Scope")
+			assert.Equal(t, float64(i+1), m.Value, "Value")
+			assert.Equal(t, float32(0.5), m.SampleRate, "Sample Rate")
+			assert.Equal(t, []string{"a:b"}, m.Tags, "Tags")
+			assert.Equal(t, ms[0].Digest, m.Digest, "Digest")
+		}
+	}
+
+	_, err = samplers.ParseMetric([]byte("metric:1:2:3|d"))
+	assert.Error(t, err, "ParseMetric only accepts a single value")
+
+	_, err = samplers.ParseMetrics([]byte("metric:1::3|d"), 0)
+	assert.Error(t, err, "empty values are invalid")
+}
+
+func TestParserMultipleValues(t *testing.T) {
+	tests := []struct {
+		packet string
+		values []float64
+		err    string
+	}{
+		{"a.b.c:1|c|@0.1", []float64{1}, ""},
+		{"a.b.c:1:2:3|c|@0.1", []float64{1, 2, 3}, ""},
+		{"a.b.c:1:2:3:4|c|@0.1", nil, "4 values exceed the maximum of 3"},
+		{"a.b.c:1.5|h|#foo:bar", []float64{1.5}, ""},
+		{"a.b.c:1.5:2.5:-3|h|#foo:bar", []float64{1.5, 2.5, -3}, ""},
+		{"a.b.c:1.5:2.5:-3:4|h|#foo:bar", nil, "4 values exceed the maximum of 3"},
+	}
+	for _, elt := range tests {
+		test := elt
+		t.Run(test.packet, func(t *testing.T) {
+			t.Parallel()
+			ms, err := samplers.ParseMetrics([]byte(test.packet), 3)
+			if test.err != "" {
+				if assert.Error(t, err) {
+					assert.Contains(t, err.Error(), test.err)
+				}
+				return
+			}
+			require.NoError(t, err)
+			require.Len(t, ms, len(test.values))
+			for i, m := range ms {
+				assert.Equal(t, "a.b.c", m.Name, "Name")
+				assert.Equal(t, test.values[i], m.Value, "Value")
+				assert.Equal(t, ms[0].Type, m.Type, "Type")
+				assert.Equal(t, ms[0].SampleRate, m.SampleRate, "Sample Rate")
+				assert.Equal(t, ms[0].Tags, m.Tags, "Tags")
+			}
+		})
+	}
+}
+
+func TestParserMultipleValuesSets(t *testing.T) {
+	ms, err := samplers.ParseMetrics([]byte("a.b.c:foo:bar|s"), 1)
+	require.NoError(t, err)
+	require.Len(t, ms, 1)
+	assert.Equal(t, "foo:bar", ms[0].Value, "set members may contain colons")
+}
+
 func TestParserWithSampleRate(t *testing.T) {
 	m, _ := samplers.ParseMetric([]byte("a.b.c:1|c|@0.1"))
 	assert.NotNil(t, m, "Got nil metric!")
@@ -549,6 +638,26 @@ func TestGlobalOnlyEscape(t *testing.T) {
 	assert.Contains(t, m.Tags, "tag2:quacks", "tag2 should be preserved in the list of tags after removing magic tags")
 }
 
+func TestTraceIDExemplarTag(t *testing.T) {
+	m, err := samplers.ParseMetric([]byte("a.b.c:1|ms|#trace_id:1234,tag2:quacks"))
+	assert.NoError(t, err, "should have no error parsing")
+	assert.Equal(t, "1234", m.TraceID)
+	assert.Equal(t, []string{"tag2:quacks"}, m.Tags, "the trace ID should not be a tag of a timer")
+	plain, err := samplers.ParseMetric([]byte("a.b.c:1|ms|#tag2:quacks"))
+	assert.NoError(t, err)
+	assert.Equal(t, plain.Digest, m.Digest, "the trace ID should not make a series of its own")
+
+	m, err = samplers.ParseMetric([]byte("a.b.c:1|c|#trace_id:1234"))
+	assert.NoError(t, err)
+	assert.Empty(t, m.TraceID)
+	assert.Equal(t, []string{"trace_id:1234"}, m.Tags, "counters should keep the tag")
+
+	ssfMetric, err := samplers.ParseMetricSSF(ssf.Timing("a.b.c", time.Second, time.Millisecond, map[string]string{"trace_id": "1234", "tag2": "quacks"}))
+	assert.NoError(t, err)
+	assert.Equal(t, "1234", ssfMetric.TraceID)
+	assert.Equal(t, []string{"tag2:quacks"}, ssfMetric.Tags)
+}
+
 func TestEvents(t *testing.T) {
 	evt, err := samplers.ParseEvent([]byte("_e{3,3}:foo|bar|k:foos|s:test|t:success|p:low|#foo:bar,baz:qux|d:1136239445|h:example.com"))
 	assert.NoError(t, err, "should have parsed correctly")
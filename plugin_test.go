@@ -4,9 +4,13 @@ import (
 	"compress/gzip"
 	"context"
 	"encoding/csv"
+	"errors"
 	"io"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path"
+	"strings"
 	"testing"
 	"time"
 
@@ -14,9 +18,11 @@ import (
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	s3p "github.com/stripe/veneur/plugins/s3"
 	s3Mock "github.com/stripe/veneur/plugins/s3/mock"
 	"github.com/stripe/veneur/samplers"
+	"github.com/stripe/veneur/sinks"
 )
 
 type dummyPlugin struct {
@@ -83,6 +89,47 @@ func TestGlobalServerPluginFlush(t *testing.T) {
 	f.server.Flush(context.Background())
 }
 
+// TestGlobalServerPluginRoutes tests that plugins only receive the
+// metrics that are routed to them.
+func TestGlobalServerPluginRoutes(t *testing.T) {
+	config := globalConfig()
+	f := newFixture(t, config, nil, nil)
+	defer f.Close()
+
+	flushed := make(chan []samplers.InterMetric, 1)
+	dp := &dummyPlugin{logger: log}
+	dp.flush = func(ctx context.Context, metrics []samplers.InterMetric) error {
+		flushed <- metrics
+		return nil
+	}
+	f.server.registerPlugin(dp)
+	config.MetricRoutes = []MetricRoute{{AllowNames: []string{"*.trace.*"}, Sinks: []string{"dummy_plugin"}}}
+	config.MetricDefaultRoute = []string{"blackhole"}
+	f.server.metricRouter = f.server.newMetricRouter(config, f.server.metricSinks)
+
+	for _, name := range []string{"api.trace.spans", "api.requests"} {
+		f.server.Workers[0].ProcessMetric(&samplers.UDPMetric{
+			MetricKey: samplers.MetricKey{
+				Name: name,
+				Type: "gauge",
+			},
+			Value:      1.0,
+			Digest:     12345,
+			SampleRate: 1.0,
+			Scope:      samplers.GlobalOnly,
+		})
+	}
+	f.server.Flush(context.Background())
+
+	select {
+	case metrics := <-flushed:
+		require.Len(t, metrics, 1)
+		assert.Equal(t, "api.trace.spans", metrics[0].Name)
+	case <-time.After(DefaultServerTimeout):
+		assert.Fail(t, "the plugin wasn't flushed")
+	}
+}
+
 // TestLocalFilePluginRegister tests that we are able to register
 // a local file as a flush output for Veneur.
 func TestLocalFilePluginRegister(t *testing.T) {
@@ -192,3 +239,42 @@ func assertCSVFieldsMatch(t *testing.T, expected, actual [][]string, columns []i
 		}
 	}
 }
+
+// TestHealthCheckDegraded tests that a plugin that keeps failing to
+// flush turns the health check to degraded.
+func TestHealthCheckDegraded(t *testing.T) {
+	config := localConfig()
+	f := newFixture(t, config, nil, nil)
+	defer f.Close()
+
+	fail := true
+	client := &s3Mock.MockS3Client{}
+	client.SetPutObject(func(input *s3.PutObjectInput) (*s3.PutObjectOutput, error) {
+		if fail {
+			return nil, errors.New("InternalError: We encountered an internal error")
+		}
+		return &s3.PutObjectOutput{ETag: aws.String("912ec803b2ce49e4a541068d495ab570")}, nil
+	})
+	plugin := &s3p.S3Plugin{Logger: logrus.New(), Svc: client, Hostname: "testbox"}
+	f.server.registerPlugin(plugin)
+
+	healthcheck := func() string {
+		w := httptest.NewRecorder()
+		f.server.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/healthcheck", nil))
+		assert.Equal(t, http.StatusOK, w.Code, "a degraded sink shouldn't fail the health check")
+		return w.Body.String()
+	}
+	metrics := []samplers.InterMetric{{Name: "a.b.c", Value: 1, Type: samplers.GaugeMetric}}
+
+	assert.Equal(t, "ok\nplugin s3: ok\n", healthcheck())
+	for i := 0; i < sinks.DefaultUnhealthyThreshold; i++ {
+		assert.Error(t, plugin.Flush(context.Background(), metrics))
+	}
+	body := healthcheck()
+	assert.True(t, strings.HasPrefix(body, "degraded\n"), "unexpected health check: %q", body)
+	assert.Contains(t, body, "plugin s3: 3 consecutive flushes failed")
+
+	fail = false
+	assert.NoError(t, plugin.Flush(context.Background(), metrics))
+	assert.Equal(t, "ok\nplugin s3: ok\n", healthcheck())
+}
@@ -0,0 +1,445 @@
+package s3
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+
+	"github.com/golang/snappy"
+	"github.com/stripe/veneur/internal/thrift"
+	"github.com/stripe/veneur/samplers"
+)
+
+// The columns that Parquet archives can contain.
+const (
+	// ParquetName is the metric's name.
+	ParquetName = "name"
+	// ParquetType is the metric's type: "counter", "gauge" or
+	// "status".
+	ParquetType = "type"
+	// ParquetValue is the metric's value. Unlike in TSV archives,
+	// counters are not converted to rates.
+	ParquetValue = "value"
+	// ParquetTags is a map of the metric's tags. Tags without a
+	// value map to the empty string.
+	ParquetTags = "tags"
+	// ParquetTimestamp is the metric's timestamp, in milliseconds
+	// since the unix epoch.
+	ParquetTimestamp = "timestamp"
+	// ParquetHostname is the hostname of the veneur server that
+	// flushed the metric.
+	ParquetHostname = "hostname"
+	// ParquetInterval is the flush interval, in seconds.
+	ParquetInterval = "interval"
+)
+
+// DefaultParquetColumns are the columns of Parquet archives, if no
+// others are configured.
+var DefaultParquetColumns = []string{ParquetName, ParquetType, ParquetValue, ParquetTags, ParquetTimestamp}
+
+// DefaultParquetCompression is the compression codec of Parquet
+// archives, if no other codec is configured.
+const DefaultParquetCompression = "snappy"
+
+// Parquet's physical types, repetition types, converted types,
+// encodings and compression codecs, as defined in parquet.thrift.
+const (
+	parquetInt32     int32 = 1
+	parquetInt64     int32 = 2
+	parquetDouble    int32 = 5
+	parquetByteArray int32 = 6
+
+	parquetRequired int32 = 0
+	parquetRepeated int32 = 2
+
+	parquetUTF8            int32 = 0
+	parquetMap             int32 = 1
+	parquetTimestampMillis int32 = 9
+
+	parquetPlain int32 = 0
+	parquetRLE   int32 = 3
+
+	parquetUncompressed int32 = 0
+	parquetSnappy       int32 = 1
+	parquetGzip         int32 = 2
+)
+
+const parquetMagic = "PAR1"
+
+var parquetCodecs = map[string]int32{
+	"uncompressed": parquetUncompressed,
+	"snappy":       parquetSnappy,
+	"gzip":         parquetGzip,
+}
+
+// ParquetSchema describes the Parquet objects that the S3 plugin
+// archives: which columns they contain, in what order, and how their
+// pages are compressed.
+type ParquetSchema struct {
+	columns []string
+	codec   int32
+}
+
+// NewParquetSchema returns a schema with the given columns, in that
+// order, compressed with the named codec ("uncompressed", "snappy" or
+// "gzip"). If columns are empty, DefaultParquetColumns are used; if
+// compression is empty, DefaultParquetCompression is.
+func NewParquetSchema(columns []string, compression string) (*ParquetSchema, error) {
+	if len(columns) == 0 {
+		columns = DefaultParquetColumns
+	}
+	if compression == "" {
+		compression = DefaultParquetCompression
+	}
+	codec, ok := parquetCodecs[strings.ToLower(compression)]
+	if !ok {
+		return nil, fmt.Errorf("unknown parquet compression codec %q", compression)
+	}
+	seen := map[string]bool{}
+	for _, col := range columns {
+		switch col {
+		case ParquetName, ParquetType, ParquetValue, ParquetTags, ParquetTimestamp, ParquetHostname, ParquetInterval:
+		default:
+			return nil, fmt.Errorf("unknown parquet column %q", col)
+		}
+		if seen[col] {
+			return nil, fmt.Errorf("parquet column %q is listed more than once", col)
+		}
+		seen[col] = true
+	}
+	return &ParquetSchema{columns: columns, codec: codec}, nil
+}
+
+// parquetChunk accumulates the levels and PLAIN-encoded values of a
+// single leaf column.
+type parquetChunk struct {
+	path []string
+	typ  int32
+	// nested columns (the tags map's keys and values) have
+	// repetition and definition levels, with a maximum of 1.
+	nested   bool
+	rep, def []int32
+	values   bytes.Buffer
+	// numValues counts the values of flat columns, and the levels of
+	// nested ones, which include an entry for each empty map.
+	numValues int
+}
+
+func newParquetChunk(typ int32, path ...string) *parquetChunk {
+	return &parquetChunk{path: path, typ: typ}
+}
+
+func (c *parquetChunk) level(rep, def int32) {
+	c.rep = append(c.rep, rep)
+	c.def = append(c.def, def)
+	c.numValues++
+}
+
+func (c *parquetChunk) byteArray(s string) {
+	binary.Write(&c.values, binary.LittleEndian, uint32(len(s)))
+	c.values.WriteString(s)
+	if !c.nested {
+		c.numValues++
+	}
+}
+
+func (c *parquetChunk) int32(v int32) {
+	binary.Write(&c.values, binary.LittleEndian, v)
+	c.numValues++
+}
+
+func (c *parquetChunk) int64(v int64) {
+	binary.Write(&c.values, binary.LittleEndian, v)
+	c.numValues++
+}
+
+func (c *parquetChunk) double(v float64) {
+	binary.Write(&c.values, binary.LittleEndian, math.Float64bits(v))
+	c.numValues++
+}
+
+// page returns the uncompressed body of the chunk's single data page:
+// its levels, if any, followed by its values.
+func (c *parquetChunk) page() []byte {
+	var page bytes.Buffer
+	if c.nested {
+		writeLevels(&page, c.rep)
+		writeLevels(&page, c.def)
+	}
+	page.Write(c.values.Bytes())
+	return page.Bytes()
+}
+
+// writeLevels writes levels of bit width 1 in the RLE/bit-packing
+// hybrid encoding, as a sequence of RLE runs prefixed with their
+// total length.
+func writeLevels(w *bytes.Buffer, levels []int32) {
+	var runs bytes.Buffer
+	var b [binary.MaxVarintLen64]byte
+	for i := 0; i < len(levels); {
+		j := i + 1
+		for j < len(levels) && levels[j] == levels[i] {
+			j++
+		}
+		runs.Write(b[:binary.PutUvarint(b[:], uint64(j-i)<<1)])
+		runs.WriteByte(byte(levels[i]))
+		i = j
+	}
+	binary.Write(w, binary.LittleEndian, uint32(runs.Len()))
+	w.Write(runs.Bytes())
+}
+
+func metricTypeName(t samplers.MetricType) string {
+	switch t {
+	case samplers.CounterMetric:
+		return "counter"
+	case samplers.GaugeMetric:
+		return "gauge"
+	case samplers.StatusMetric:
+		return "status"
+	}
+	return t.String()
+}
+
+// chunks encodes the metrics into the schema's leaf columns.
+func (s *ParquetSchema) chunks(metrics []samplers.InterMetric, hostname string, interval int) []*parquetChunk {
+	var chunks []*parquetChunk
+	for _, col := range s.columns {
+		switch col {
+		case ParquetName:
+			c := newParquetChunk(parquetByteArray, col)
+			for _, m := range metrics {
+				c.byteArray(m.Name)
+			}
+			chunks = append(chunks, c)
+		case ParquetType:
+			c := newParquetChunk(parquetByteArray, col)
+			for _, m := range metrics {
+				c.byteArray(metricTypeName(m.Type))
+			}
+			chunks = append(chunks, c)
+		case ParquetValue:
+			c := newParquetChunk(parquetDouble, col)
+			for _, m := range metrics {
+				c.double(m.Value)
+			}
+			chunks = append(chunks, c)
+		case ParquetTags:
+			keys := newParquetChunk(parquetByteArray, col, "key_value", "key")
+			values := newParquetChunk(parquetByteArray, col, "key_value", "value")
+			keys.nested, values.nested = true, true
+			for _, m := range metrics {
+				n := 0
+				seen := map[string]bool{}
+				for _, tag := range m.Tags {
+					kv := strings.SplitN(tag, ":", 2)
+					if seen[kv[0]] {
+						// map keys must be unique
+						continue
+					}
+					seen[kv[0]] = true
+					value := ""
+					if len(kv) == 2 {
+						value = kv[1]
+					}
+					rep := int32(0)
+					if n > 0 {
+						rep = 1
+					}
+					keys.level(rep, 1)
+					keys.byteArray(kv[0])
+					values.level(rep, 1)
+					values.byteArray(value)
+					n++
+				}
+				if n == 0 {
+					// an empty map
+					keys.level(0, 0)
+					values.level(0, 0)
+				}
+			}
+			chunks = append(chunks, keys, values)
+		case ParquetTimestamp:
+			c := newParquetChunk(parquetInt64, col)
+			for _, m := range metrics {
+				c.int64(m.Timestamp * 1000)
+			}
+			chunks = append(chunks, c)
+		case ParquetHostname:
+			c := newParquetChunk(parquetByteArray, col)
+			for range metrics {
+				c.byteArray(hostname)
+			}
+			chunks = append(chunks, c)
+		case ParquetInterval:
+			c := newParquetChunk(parquetInt32, col)
+			for range metrics {
+				c.int32(int32(interval))
+			}
+			chunks = append(chunks, c)
+		}
+	}
+	return chunks
+}
+
+func (s *ParquetSchema) compress(page []byte) ([]byte, error) {
+	switch s.codec {
+	case parquetSnappy:
+		return snappy.Encode(nil, page), nil
+	case parquetGzip:
+		var buf bytes.Buffer
+		gzw := gzip.NewWriter(&buf)
+		if _, err := gzw.Write(page); err != nil {
+			return nil, err
+		}
+		if err := gzw.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+	return page, nil
+}
+
+// writeSchema writes the flattened schema tree of the file metadata.
+func (s *ParquetSchema) writeSchema(w *thrift.Writer) {
+	elements := 1
+	for _, col := range s.columns {
+		if col == ParquetTags {
+			elements += 4
+		} else {
+			elements++
+		}
+	}
+	w.List(2, thrift.TypeStruct, elements)
+
+	w.ListStruct()
+	w.String(4, "veneur_metric")
+	w.I32(5, int32(len(s.columns)))
+	w.EndStruct()
+
+	leaf := func(typ int32, name string, converted int32) {
+		w.ListStruct()
+		w.I32(1, typ)
+		w.I32(3, parquetRequired)
+		w.String(4, name)
+		if converted >= 0 {
+			w.I32(6, converted)
+		}
+		w.EndStruct()
+	}
+	for _, col := range s.columns {
+		switch col {
+		case ParquetName, ParquetType, ParquetHostname:
+			leaf(parquetByteArray, col, parquetUTF8)
+		case ParquetValue:
+			leaf(parquetDouble, col, -1)
+		case ParquetTimestamp:
+			leaf(parquetInt64, col, parquetTimestampMillis)
+		case ParquetInterval:
+			leaf(parquetInt32, col, -1)
+		case ParquetTags:
+			w.ListStruct()
+			w.I32(3, parquetRequired)
+			w.String(4, col)
+			w.I32(5, 1)
+			w.I32(6, parquetMap)
+			w.EndStruct()
+
+			w.ListStruct()
+			w.I32(3, parquetRepeated)
+			w.String(4, "key_value")
+			w.I32(5, 2)
+			w.EndStruct()
+
+			leaf(parquetByteArray, "key", parquetUTF8)
+			leaf(parquetByteArray, "value", parquetUTF8)
+		}
+	}
+}
+
+// EncodeInterMetricsParquet returns a reader containing a Parquet file
+// with the schema's columns, one row per InterMetric. The file has a
+// single row group, with a single PLAIN-encoded data page per column.
+func EncodeInterMetricsParquet(metrics []samplers.InterMetric, schema *ParquetSchema, hostname string, interval int) (io.ReadSeeker, error) {
+	type chunkMeta struct {
+		offset                   int64
+		uncompressed, compressed int64
+	}
+
+	b := &bytes.Buffer{}
+	b.WriteString(parquetMagic)
+
+	chunks := schema.chunks(metrics, hostname, interval)
+	metas := make([]chunkMeta, len(chunks))
+	var totalSize int64
+	for i, c := range chunks {
+		page := c.page()
+		compressed, err := schema.compress(page)
+		if err != nil {
+			return nil, err
+		}
+
+		header := &thrift.Writer{}
+		header.I32(1, 0) // DATA_PAGE
+		header.I32(2, int32(len(page)))
+		header.I32(3, int32(len(compressed)))
+		header.BeginStruct(5)
+		header.I32(1, int32(c.numValues))
+		header.I32(2, parquetPlain)
+		header.I32(3, parquetRLE)
+		header.I32(4, parquetRLE)
+		header.EndStruct()
+		header.EndStruct()
+
+		metas[i] = chunkMeta{
+			offset:       int64(b.Len()),
+			uncompressed: int64(header.Len() + len(page)),
+			compressed:   int64(header.Len() + len(compressed)),
+		}
+		totalSize += metas[i].uncompressed
+		b.Write(header.Bytes())
+		b.Write(compressed)
+	}
+
+	footer := &thrift.Writer{}
+	footer.I32(1, 1)
+	schema.writeSchema(footer)
+	footer.I64(3, int64(len(metrics)))
+	footer.List(4, thrift.TypeStruct, 1)
+	footer.ListStruct()
+	footer.List(1, thrift.TypeStruct, len(chunks))
+	for i, c := range chunks {
+		footer.ListStruct()
+		footer.I64(2, metas[i].offset)
+		footer.BeginStruct(3)
+		footer.I32(1, c.typ)
+		footer.List(2, thrift.TypeI32, 2)
+		footer.ListI32(parquetPlain)
+		footer.ListI32(parquetRLE)
+		footer.List(3, thrift.TypeBinary, len(c.path))
+		for _, p := range c.path {
+			footer.ListString(p)
+		}
+		footer.I32(4, schema.codec)
+		footer.I64(5, int64(c.numValues))
+		footer.I64(6, metas[i].uncompressed)
+		footer.I64(7, metas[i].compressed)
+		footer.I64(9, metas[i].offset)
+		footer.EndStruct()
+		footer.EndStruct()
+	}
+	footer.I64(2, totalSize)
+	footer.I64(3, int64(len(metrics)))
+	footer.EndStruct()
+	footer.String(6, "veneur")
+	footer.EndStruct()
+
+	b.Write(footer.Bytes())
+	binary.Write(b, binary.LittleEndian, uint32(footer.Len()))
+	b.WriteString(parquetMagic)
+	return bytes.NewReader(b.Bytes()), nil
+}
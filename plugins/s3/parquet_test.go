@@ -0,0 +1,352 @@
+package s3
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"io/ioutil"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/golang/snappy"
+	apache "github.com/lightstep/lightstep-tracer-go/thrift_0_9_2/lib/go/thrift"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	s3Mock "github.com/stripe/veneur/plugins/s3/mock"
+	"github.com/stripe/veneur/samplers"
+)
+
+// readThrift decodes a thrift compact protocol struct at the start of
+// b, with the Apache Thrift library, into a map from field IDs to
+// values, which is all that the tests need to inspect Parquet
+// metadata. It also returns the length of the struct.
+func readThrift(t *testing.T, b []byte) (map[int16]interface{}, int) {
+	buf := apache.NewTMemoryBuffer()
+	_, err := buf.Write(b)
+	require.NoError(t, err)
+	fields := readThriftStruct(t, apache.NewTCompactProtocol(buf))
+	return fields, len(b) - buf.Len()
+}
+
+func readThriftStruct(t *testing.T, p apache.TProtocol) map[int16]interface{} {
+	fields := map[int16]interface{}{}
+	_, err := p.ReadStructBegin()
+	require.NoError(t, err)
+	for {
+		_, typ, id, err := p.ReadFieldBegin()
+		require.NoError(t, err)
+		if typ == apache.STOP {
+			break
+		}
+		fields[id] = readThriftValue(t, p, typ)
+		require.NoError(t, p.ReadFieldEnd())
+	}
+	require.NoError(t, p.ReadStructEnd())
+	return fields
+}
+
+func readThriftValue(t *testing.T, p apache.TProtocol, typ apache.TType) interface{} {
+	var v interface{}
+	var err error
+	switch typ {
+	case apache.BOOL:
+		v, err = p.ReadBool()
+	case apache.I32:
+		var i int32
+		i, err = p.ReadI32()
+		v = int64(i)
+	case apache.I64:
+		v, err = p.ReadI64()
+	case apache.STRING:
+		v, err = p.ReadString()
+	case apache.LIST:
+		var elem apache.TType
+		var n int
+		elem, n, err = p.ReadListBegin()
+		require.NoError(t, err)
+		list := make([]interface{}, n)
+		for i := range list {
+			list[i] = readThriftValue(t, p, elem)
+		}
+		v, err = list, p.ReadListEnd()
+	case apache.STRUCT:
+		v = readThriftStruct(t, p)
+	default:
+		t.Fatalf("unexpected thrift type %s", typ)
+	}
+	require.NoError(t, err)
+	return v
+}
+
+func readLevels(t *testing.T, b []byte, n int) ([]int32, []byte) {
+	length := binary.LittleEndian.Uint32(b)
+	runs, rest := b[4:4+length], b[4+length:]
+	var levels []int32
+	for len(runs) > 0 {
+		header, k := binary.Uvarint(runs)
+		require.Equal(t, uint64(0), header&1, "only RLE runs are expected")
+		for i := uint64(0); i < header>>1; i++ {
+			levels = append(levels, int32(runs[k]))
+		}
+		runs = runs[k+1:]
+	}
+	require.Len(t, levels, n)
+	return levels, rest
+}
+
+type parquetRow map[string]interface{}
+
+// readParquet parses a Parquet file as EncodeInterMetricsParquet writes
+// it, and returns its rows.
+func readParquet(t *testing.T, file []byte) []parquetRow {
+	require.True(t, len(file) > 12)
+	require.Equal(t, parquetMagic, string(file[:4]))
+	require.Equal(t, parquetMagic, string(file[len(file)-4:]))
+	footerLen := int(binary.LittleEndian.Uint32(file[len(file)-8:]))
+	meta, n := readThrift(t, file[len(file)-8-footerLen:len(file)-8])
+	require.Equal(t, footerLen, n)
+
+	numRows := int(meta[3].(int64))
+	rows := make([]parquetRow, numRows)
+	for i := range rows {
+		rows[i] = parquetRow{}
+	}
+
+	rowGroups := meta[4].([]interface{})
+	require.Len(t, rowGroups, 1)
+	for _, c := range rowGroups[0].(map[int16]interface{})[1].([]interface{}) {
+		chunk := c.(map[int16]interface{})[3].(map[int16]interface{})
+		var path []string
+		for _, p := range chunk[3].([]interface{}) {
+			path = append(path, p.(string))
+		}
+
+		offset := int(chunk[9].(int64))
+		header, n := readThrift(t, file[offset:])
+		offset += n
+		body := file[offset : offset+int(header[3].(int64))]
+		switch chunk[4].(int64) {
+		case int64(parquetSnappy):
+			var err error
+			body, err = snappy.Decode(nil, body)
+			require.NoError(t, err)
+		case int64(parquetGzip):
+			gzr, err := gzip.NewReader(bytes.NewReader(body))
+			require.NoError(t, err)
+			body, err = ioutil.ReadAll(gzr)
+			require.NoError(t, err)
+		}
+		require.Len(t, body, int(header[2].(int64)))
+
+		numValues := int(header[5].(map[int16]interface{})[1].(int64))
+		var rep, def []int32
+		if len(path) > 1 {
+			rep, body = readLevels(t, body, numValues)
+			def, body = readLevels(t, body, numValues)
+		}
+
+		row := -1
+		for i := 0; i < numValues; i++ {
+			if rep == nil || rep[i] == 0 {
+				row++
+			}
+			if def != nil && def[i] == 0 {
+				continue
+			}
+			var v interface{}
+			switch int32(chunk[1].(int64)) {
+			case parquetByteArray:
+				n := binary.LittleEndian.Uint32(body)
+				v, body = string(body[4:4+n]), body[4+n:]
+			case parquetDouble:
+				v, body = math.Float64frombits(binary.LittleEndian.Uint64(body)), body[8:]
+			case parquetInt64:
+				v, body = int64(binary.LittleEndian.Uint64(body)), body[8:]
+			case parquetInt32:
+				v, body = int32(binary.LittleEndian.Uint32(body)), body[4:]
+			}
+			name := strings.Join(path, ".")
+			if rep != nil {
+				list, _ := rows[row][name].([]string)
+				rows[row][name] = append(list, v.(string))
+			} else {
+				rows[row][name] = v
+			}
+		}
+		require.Empty(t, body)
+		require.Equal(t, numRows-1, row)
+	}
+	return rows
+}
+
+var parquetTestMetrics = []samplers.InterMetric{
+	{
+		Name:      "a.b.c",
+		Timestamp: 1476119058,
+		Value:     100,
+		Tags:      []string{"foo:bar", "baz", "foo:duplicate"},
+		Type:      samplers.CounterMetric,
+	},
+	{
+		Name:      "a.b.d",
+		Timestamp: 1476119059,
+		Value:     -2.5,
+		Type:      samplers.GaugeMetric,
+	},
+	{
+		Name:      "a.b.e",
+		Timestamp: 1476119060,
+		Value:     1,
+		Tags:      []string{"x:y:z"},
+		Type:      samplers.StatusMetric,
+	},
+}
+
+func TestEncodeInterMetricsParquet(t *testing.T) {
+	for _, codec := range []string{"uncompressed", "snappy", "gzip"} {
+		codec := codec
+		t.Run(codec, func(t *testing.T) {
+			t.Parallel()
+			schema, err := NewParquetSchema(nil, codec)
+			require.NoError(t, err)
+			r, err := EncodeInterMetricsParquet(parquetTestMetrics, schema, "testbox", 10)
+			require.NoError(t, err)
+			file, err := ioutil.ReadAll(r)
+			require.NoError(t, err)
+
+			assert.Equal(t, []parquetRow{
+				{
+					"name":                 "a.b.c",
+					"type":                 "counter",
+					"value":                100.0,
+					"tags.key_value.key":   []string{"foo", "baz"},
+					"tags.key_value.value": []string{"bar", ""},
+					"timestamp":            int64(1476119058000),
+				},
+				{
+					"name":      "a.b.d",
+					"type":      "gauge",
+					"value":     -2.5,
+					"timestamp": int64(1476119059000),
+				},
+				{
+					"name":                 "a.b.e",
+					"type":                 "status",
+					"value":                1.0,
+					"tags.key_value.key":   []string{"x"},
+					"tags.key_value.value": []string{"y:z"},
+					"timestamp":            int64(1476119060000),
+				},
+			}, readParquet(t, file))
+		})
+	}
+}
+
+func TestParquetSchemaColumns(t *testing.T) {
+	schema, err := NewParquetSchema([]string{"hostname", "name", "interval"}, "")
+	require.NoError(t, err)
+	r, err := EncodeInterMetricsParquet(parquetTestMetrics[:1], schema, "testbox", 10)
+	require.NoError(t, err)
+	file, err := ioutil.ReadAll(r)
+	require.NoError(t, err)
+
+	assert.Equal(t, []parquetRow{
+		{"hostname": "testbox", "name": "a.b.c", "interval": int32(10)},
+	}, readParquet(t, file))
+
+	footerLen := int(binary.LittleEndian.Uint32(file[len(file)-8:]))
+	meta, _ := readThrift(t, file[len(file)-8-footerLen:len(file)-8])
+	var names []string
+	for _, elt := range meta[2].([]interface{}) {
+		names = append(names, elt.(map[int16]interface{})[4].(string))
+	}
+	assert.Equal(t, []string{"veneur_metric", "hostname", "name", "interval"}, names)
+}
+
+// requireFields checks that a thrift struct has all of the fields
+// with the given IDs.
+func requireFields(t *testing.T, what string, fields map[int16]interface{}, ids ...int16) {
+	for _, id := range ids {
+		require.Contains(t, fields, id, "%s lacks required field %d", what, id)
+	}
+}
+
+// TestParquetRequiredFields checks the metadata for the fields that
+// parquet.thrift marks as required, which readers refuse to do without.
+func TestParquetRequiredFields(t *testing.T) {
+	schema, err := NewParquetSchema(nil, "")
+	require.NoError(t, err)
+	r, err := EncodeInterMetricsParquet(parquetTestMetrics, schema, "testbox", 10)
+	require.NoError(t, err)
+	file, err := ioutil.ReadAll(r)
+	require.NoError(t, err)
+
+	footerLen := int(binary.LittleEndian.Uint32(file[len(file)-8:]))
+	meta, _ := readThrift(t, file[len(file)-8-footerLen:len(file)-8])
+	// version, schema, num_rows, row_groups
+	requireFields(t, "FileMetaData", meta, 1, 2, 3, 4)
+	for _, elt := range meta[2].([]interface{}) {
+		// name
+		requireFields(t, "SchemaElement", elt.(map[int16]interface{}), 4)
+	}
+	for _, rg := range meta[4].([]interface{}) {
+		rowGroup := rg.(map[int16]interface{})
+		// columns, total_byte_size, num_rows
+		requireFields(t, "RowGroup", rowGroup, 1, 2, 3)
+		for _, c := range rowGroup[1].([]interface{}) {
+			chunk := c.(map[int16]interface{})
+			// file_offset
+			requireFields(t, "ColumnChunk", chunk, 2)
+			cmeta := chunk[3].(map[int16]interface{})
+			// type, encodings, path_in_schema, codec, num_values,
+			// total_uncompressed_size, total_compressed_size,
+			// data_page_offset
+			requireFields(t, "ColumnMetaData", cmeta, 1, 2, 3, 4, 5, 6, 7, 9)
+
+			header, _ := readThrift(t, file[cmeta[9].(int64):])
+			// type, uncompressed_page_size, compressed_page_size
+			requireFields(t, "PageHeader", header, 1, 2, 3)
+			// num_values, encoding, definition_level_encoding,
+			// repetition_level_encoding
+			requireFields(t, "DataPageHeader", header[5].(map[int16]interface{}), 1, 2, 3, 4)
+		}
+	}
+}
+
+func TestNewParquetSchemaErrors(t *testing.T) {
+	_, err := NewParquetSchema([]string{"name", "bogus"}, "")
+	assert.Error(t, err)
+	_, err = NewParquetSchema([]string{"name", "name"}, "")
+	assert.Error(t, err)
+	_, err = NewParquetSchema(nil, "lzo")
+	assert.Error(t, err)
+}
+
+func TestS3PostParquet(t *testing.T) {
+	client := &s3Mock.MockS3Client{}
+	var key string
+	var body []byte
+	client.SetPutObject(func(input *s3.PutObjectInput) (*s3.PutObjectOutput, error) {
+		key = *input.Key
+		var err error
+		body, err = ioutil.ReadAll(input.Body)
+		return &s3.PutObjectOutput{ETag: aws.String("912ec803b2ce49e4a541068d495ab570")}, err
+	})
+
+	schema, err := NewParquetSchema(nil, "")
+	require.NoError(t, err)
+	plugin := &S3Plugin{Logger: log, Svc: client, Hostname: "testbox", Interval: 10, Parquet: schema}
+	require.NoError(t, plugin.Flush(context.Background(), parquetTestMetrics))
+
+	assert.True(t, strings.HasSuffix(key, ".parquet"), "unexpected key %q", key)
+	rows := readParquet(t, body)
+	require.Len(t, rows, len(parquetTestMetrics))
+	for i, m := range parquetTestMetrics {
+		assert.Equal(t, m.Name, rows[i]["name"])
+		assert.Equal(t, m.Value, rows[i]["value"])
+	}
+}
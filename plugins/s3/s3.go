@@ -18,6 +18,7 @@ import (
 
 	"github.com/stripe/veneur/plugins"
 	"github.com/stripe/veneur/samplers"
+	"github.com/stripe/veneur/sinks"
 )
 
 // TODO set log level
@@ -30,22 +31,39 @@ type S3Plugin struct {
 	S3Bucket string
 	Hostname string
 	Interval int
+	// Parquet, if set, makes the plugin archive metrics as Parquet
+	// objects with this schema, instead of as gzipped TSV.
+	Parquet *ParquetSchema
+
+	health sinks.FlushHealth
 }
 
+var _ sinks.HealthChecker = &S3Plugin{}
+
 func (p *S3Plugin) Flush(ctx context.Context, metrics []samplers.InterMetric) error {
 	const Delimiter = '\t'
 	const IncludeHeaders = false
 
-	csv, err := EncodeInterMetricsCSV(metrics, Delimiter, IncludeHeaders, p.Hostname, p.Interval)
+	var data io.ReadSeeker
+	var err error
+	var ft filetype = tsvGzFt
+	if p.Parquet != nil {
+		ft = parquetFt
+		data, err = EncodeInterMetricsParquet(metrics, p.Parquet, p.Hostname, p.Interval)
+	} else {
+		data, err = EncodeInterMetricsCSV(metrics, Delimiter, IncludeHeaders, p.Hostname, p.Interval)
+	}
 	if err != nil {
 		p.Logger.WithFields(logrus.Fields{
 			logrus.ErrorKey: err,
 			"metrics":       len(metrics),
 		}).Error("Could not marshal metrics before posting to s3")
+		p.health.Record(err)
 		return err
 	}
 
-	err = p.S3Post(p.Hostname, csv, tsvGzFt)
+	err = p.S3Post(p.Hostname, data, ft)
+	p.health.Record(err)
 	if err != nil {
 		p.Logger.WithFields(logrus.Fields{
 			logrus.ErrorKey: err,
@@ -62,13 +80,20 @@ func (p *S3Plugin) Name() string {
 	return "s3"
 }
 
+// Healthy returns an error if the last few flushes failed to archive
+// metrics to S3.
+func (p *S3Plugin) Healthy() error {
+	return p.health.Healthy()
+}
+
 type filetype string
 
 const (
-	jsonFt  filetype = "json"
-	csvFt            = "csv"
-	tsvFt            = "tsv"
-	tsvGzFt          = "tsv.gz"
+	jsonFt    filetype = "json"
+	csvFt              = "csv"
+	tsvFt              = "tsv"
+	tsvGzFt            = "tsv.gz"
+	parquetFt          = "parquet"
 )
 
 // S3Bucket name of S3 bucket to post to
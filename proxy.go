@@ -1,6 +1,7 @@
 package veneur
 
 import (
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"net/http"
@@ -23,15 +24,18 @@ import (
 	"github.com/hashicorp/consul/api"
 	"github.com/pkg/profile"
 	"github.com/sirupsen/logrus"
+	"github.com/stripe/veneur/hashring"
 	vhttp "github.com/stripe/veneur/http"
+	"github.com/stripe/veneur/internal/idempotency"
 	"github.com/stripe/veneur/proxysrv"
 	"github.com/stripe/veneur/samplers"
+	"github.com/stripe/veneur/samplers/metricpb"
 	"github.com/stripe/veneur/ssf"
+	"github.com/stripe/veneur/tlsconfig"
 	"github.com/stripe/veneur/trace"
 	"github.com/stripe/veneur/trace/metrics"
 	"github.com/zenazn/goji/bind"
 	"github.com/zenazn/goji/graceful"
-	"stathat.com/c/consistent"
 
 	"goji.io"
 	"goji.io/pat"
@@ -40,9 +44,9 @@ import (
 type Proxy struct {
 	Sentry                     *raven.Client
 	Hostname                   string
-	ForwardDestinations        *consistent.Consistent
-	TraceDestinations          *consistent.Consistent
-	ForwardGRPCDestinations    *consistent.Consistent
+	ForwardDestinations        hashring.Ring
+	TraceDestinations          hashring.Ring
+	ForwardGRPCDestinations    hashring.Ring
 	Discoverer                 Discoverer
 	ConsulForwardService       string
 	ConsulTraceService         string
@@ -59,6 +63,32 @@ type Proxy struct {
 	AcceptingGRPCForwards      bool
 	ForwardTimeout             time.Duration
 
+	// forwardHealth, if health checks are enabled, decides which of the
+	// forwarding destinations are on the ForwardDestinations ring.
+	forwardHealth         *destinationHealthChecker
+	forwardHealthInterval time.Duration
+
+	// forwardOverGRPC is set if metrics received over HTTP are forwarded
+	// to the ForwardGRPCDestinations with the gRPC server's client
+	// connections, instead of over HTTP.
+	forwardOverGRPC bool
+
+	// forwardBatcher, if set, coalesces the metrics forwarded over HTTP
+	// into batches per destination, across incoming requests.
+	forwardBatcher *forwardBatcher
+
+	// idempotencyCache, if set, skips the requests whose idempotency key
+	// the proxy has seen already. It is only set when forwards are
+	// batched, as then the batches mix several requests, and can't be
+	// given a key that is derived from theirs.
+	idempotencyCache *idempotency.Cache
+
+	// forwardTLS, if set, secures the connections to the forwarding
+	// destinations, over both HTTP and gRPC.
+	forwardTLS *tlsconfig.Reloadable
+	// listenTLS, if set, secures the HTTP and gRPC listeners.
+	listenTLS *tlsconfig.Reloadable
+
 	usingConsul     bool
 	usingKubernetes bool
 	enableProfiling bool
@@ -111,6 +141,38 @@ func NewProxyFromConfig(logger *logrus.Logger, conf ProxyConfig) (p Proxy, err e
 		MaxIdleConnsPerHost: conf.MaxIdleConnsPerHost,
 	}
 
+	tlsFiles := tlsconfig.Files{
+		Certificate: conf.ForwardTLSCertificateFile,
+		Key:         conf.ForwardTLSKeyFile,
+		Authority:   conf.ForwardTLSAuthorityCertificateFile,
+	}
+	if !tlsFiles.IsZero() {
+		p.forwardTLS, err = tlsconfig.Load(tlsFiles)
+		if err != nil {
+			logger.WithError(err).Error("Improper forwarding TLS configuration")
+			return
+		}
+		transport.TLSClientConfig = p.forwardTLS.ClientConfig()
+	}
+
+	listenTLSFiles := tlsconfig.Files{
+		Certificate: conf.TLSCertificateFile,
+		Key:         conf.TLSKeyFile,
+		Authority:   conf.TLSAuthorityCertificateFile,
+	}
+	if !listenTLSFiles.IsZero() {
+		if listenTLSFiles.Certificate == "" || listenTLSFiles.Key == "" {
+			err = errors.New("tls_certificate_file and tls_key_file must both be set")
+			logger.WithError(err).Error("Improper TLS configuration")
+			return
+		}
+		p.listenTLS, err = tlsconfig.Load(listenTLSFiles)
+		if err != nil {
+			logger.WithError(err).Error("Improper TLS configuration")
+			return
+		}
+	}
+
 	p.HTTPClient = &http.Client{
 		Transport: transport,
 	}
@@ -153,9 +215,16 @@ func NewProxyFromConfig(logger *logrus.Logger, conf ProxyConfig) (p Proxy, err e
 		}
 	}
 
-	p.ForwardDestinations = consistent.New()
-	p.TraceDestinations = consistent.New()
-	p.ForwardGRPCDestinations = consistent.New()
+	replicas := conf.HashRingReplicas
+	if replicas <= 0 {
+		replicas = defaultProxyConfig.HashRingReplicas
+	}
+	for _, ring := range []*hashring.Ring{&p.ForwardDestinations, &p.TraceDestinations, &p.ForwardGRPCDestinations} {
+		*ring, err = hashring.New(conf.Hash, replicas)
+		if err != nil {
+			return
+		}
+	}
 
 	if conf.ForwardTimeout != "" {
 		p.ForwardTimeout, err = time.ParseDuration(conf.ForwardTimeout)
@@ -167,9 +236,48 @@ func NewProxyFromConfig(logger *logrus.Logger, conf ProxyConfig) (p Proxy, err e
 		}
 	}
 
+	if conf.ForwardBatchSize > 0 || conf.ForwardBatchInterval != "" {
+		var interval time.Duration
+		if conf.ForwardBatchInterval != "" {
+			interval, err = time.ParseDuration(conf.ForwardBatchInterval)
+			if err != nil {
+				logger.WithError(err).
+					WithField("value", conf.ForwardBatchInterval).
+					Error("Could not parse forward batch interval")
+				return
+			}
+		}
+		p.forwardBatcher = newForwardBatcher(conf.ForwardBatchSize, interval, p.postBatch)
+		p.idempotencyCache = idempotency.NewCache(defaultImportDedupeWindow, defaultImportDedupeMaxKeys)
+	}
+
+	if conf.ForwardHealthCheckInterval != "" {
+		p.forwardHealthInterval, err = time.ParseDuration(conf.ForwardHealthCheckInterval)
+		if err != nil {
+			logger.WithError(err).
+				WithField("value", conf.ForwardHealthCheckInterval).
+				Error("Could not parse forward health check interval")
+			return
+		}
+		path := conf.ForwardHealthCheckPath
+		if path == "" {
+			path = defaultProxyConfig.ForwardHealthCheckPath
+		}
+		threshold := conf.ForwardHealthCheckThreshold
+		if threshold == 0 {
+			threshold = defaultProxyConfig.ForwardHealthCheckThreshold
+		}
+		p.forwardHealth = newDestinationHealthChecker(p.ForwardDestinations, &p.ForwardDestinationsMtx,
+			p.HTTPClient, p.forwardScheme(), path, threshold, p.forwardHealthInterval)
+	}
+
 	// We got a static forward address, stick it in the destination!
 	if p.ConsulForwardService == "" && conf.ForwardAddress != "" {
-		p.ForwardDestinations.Add(conf.ForwardAddress)
+		if p.forwardHealth != nil {
+			p.forwardHealth.SetMembers([]string{conf.ForwardAddress})
+		} else {
+			p.ForwardDestinations.Add(conf.ForwardAddress)
+		}
 	}
 	if p.ConsulTraceService == "" && conf.TraceAddress != "" {
 		p.TraceDestinations.Add(conf.TraceAddress)
@@ -244,20 +352,49 @@ func NewProxyFromConfig(logger *logrus.Logger, conf ProxyConfig) (p Proxy, err e
 		}
 	}
 
+	grpcOpts := []proxysrv.Option{
+		proxysrv.WithForwardTimeout(p.ForwardTimeout),
+		proxysrv.WithLog(logrus.NewEntry(log)),
+		proxysrv.WithTraceClient(p.TraceClient),
+	}
+	if p.forwardTLS != nil {
+		grpcOpts = append(grpcOpts, proxysrv.WithTLSConfig(p.forwardTLS.ClientConfig()))
+	}
+	if p.listenTLS != nil {
+		grpcOpts = append(grpcOpts, proxysrv.WithServerTLSConfig(p.listenTLS.ServerConfig()))
+	}
+
 	if conf.GrpcAddress != "" {
 		p.grpcListenAddress = conf.GrpcAddress
-		p.grpcServer, err = proxysrv.New(p.ForwardGRPCDestinations,
-			proxysrv.WithForwardTimeout(p.ForwardTimeout),
-			proxysrv.WithLog(logrus.NewEntry(log)),
-			proxysrv.WithTraceClient(p.TraceClient),
-		)
+		p.grpcServer, err = proxysrv.New(p.ForwardGRPCDestinations, grpcOpts...)
 		if err != nil {
 			logger.WithError(err).Fatal("Failed to initialize the gRPC server")
 		}
 	}
 
-	// TODO Size of replicas in config?
-	//ret.ForwardDestinations.NumberOfReplicas = ???
+	switch conf.ForwardTransport {
+	case "", "http":
+	case "grpc":
+		if !p.AcceptingGRPCForwards {
+			err = errors.New("forwarding over gRPC requires a gRPC forward address or Consul service name")
+			logger.WithError(err).Error("Could not set up the forward transport")
+			return
+		}
+		p.forwardOverGRPC = true
+		if p.grpcServer == nil {
+			// We don't listen for gRPC, but its server holds the
+			// connections to the destinations:
+			p.grpcServer, err = proxysrv.New(p.ForwardGRPCDestinations, grpcOpts...)
+			if err != nil {
+				logger.WithError(err).Error("Failed to initialize the gRPC forwarder")
+				return
+			}
+		}
+	default:
+		err = fmt.Errorf("unknown forward transport %q", conf.ForwardTransport)
+		logger.WithError(err).Error("Could not set up the forward transport")
+		return
+	}
 
 	if conf.Debug {
 		logger.SetLevel(logrus.DebugLevel)
@@ -273,6 +410,16 @@ func NewProxyFromConfig(logger *logrus.Logger, conf ProxyConfig) (p Proxy, err e
 func (p *Proxy) Start() {
 	log.WithField("version", VERSION).Info("Starting server")
 
+	var reloadable []*tlsconfig.Reloadable
+	for _, r := range []*tlsconfig.Reloadable{p.forwardTLS, p.listenTLS} {
+		if r != nil {
+			reloadable = append(reloadable, r)
+		}
+	}
+	if len(reloadable) > 0 {
+		go tlsconfig.ReloadOnSignal(logrus.NewEntry(log), p.shutdown, reloadable, syscall.SIGHUP)
+	}
+
 	config := api.DefaultConfig()
 	// Use the same HTTP Client we're using for other things, so we can leverage
 	// it for testing.
@@ -346,6 +493,26 @@ func (p *Proxy) Start() {
 		}()
 	}
 
+	if p.forwardHealth != nil {
+		log.WithField("interval", p.forwardHealthInterval).Info("Checking the health of forwarding destinations")
+		go func() {
+			defer func() {
+				ConsumePanic(p.Sentry, p.TraceClient, p.Hostname, recover())
+			}()
+			ticker := time.NewTicker(p.forwardHealthInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-p.shutdown:
+					return
+				case <-ticker.C:
+					unhealthy := p.forwardHealth.Check(context.Background())
+					metrics.ReportOne(p.TraceClient, ssf.Gauge("forward.unhealthy_destinations", float32(unhealthy), nil))
+				}
+			}
+		}()
+	}
+
 	go func() {
 		hostname, _ := os.Hostname()
 		defer func() {
@@ -386,6 +553,9 @@ func (p *Proxy) Serve() {
 	<-done
 	graceful.Shutdown()
 	p.gRPCStop()
+	if p.forwardBatcher != nil {
+		p.forwardBatcher.Close()
+	}
 }
 
 // HTTPServe starts the HTTP server and listens perpetually until it encounters an unrecoverable error.
@@ -409,6 +579,9 @@ func (p *Proxy) HTTPServe() {
 		}()
 	}
 	httpSocket := bind.Socket(p.HTTPAddr)
+	if p.listenTLS != nil {
+		httpSocket = tls.NewListener(httpSocket, p.listenTLS.ServerConfig())
+	}
 	graceful.Timeout(10 * time.Second)
 	graceful.PreHook(func() {
 
@@ -420,8 +593,9 @@ func (p *Proxy) HTTPServe() {
 	})
 
 	// Ensure that the server responds to SIGUSR2 even
-	// when *not* running under einhorn.
-	graceful.AddSignal(syscall.SIGUSR2, syscall.SIGHUP)
+	// when *not* running under einhorn. (SIGHUP reloads the TLS
+	// certificates instead.)
+	graceful.AddSignal(syscall.SIGUSR2)
 	graceful.HandleSignals()
 	gracefulSocket := graceful.WrapListener(httpSocket)
 	log.WithField("address", p.HTTPAddr).Info("HTTP server listening")
@@ -442,7 +616,7 @@ func (p *Proxy) HTTPServe() {
 // gRPCServe starts the gRPC server and block until an error is encountered,
 // or the server is shutdown.
 //
-// TODO this doesn't handle SIGUSR2 and SIGHUP on it's own, unlike HTTPServe
+// TODO this doesn't handle SIGUSR2 on it's own, unlike HTTPServe
 // As long as both are running this is actually fine, as Serve will stop
 // the gRPC server when the HTTP one exits.  When running just gRPC however,
 // the signal handling won't work.
@@ -481,7 +655,7 @@ func (p *Proxy) gRPCStop() {
 // RefreshDestinations updates the server's list of valid destinations
 // for flushing. This should be called periodically to ensure we have
 // the latest data.
-func (p *Proxy) RefreshDestinations(serviceName string, ring *consistent.Consistent, mtx *sync.Mutex) {
+func (p *Proxy) RefreshDestinations(serviceName string, ring hashring.Ring, mtx *sync.Mutex) {
 	samples := &ssf.Samples{}
 	defer metrics.Report(p.TraceClient, samples)
 	srvTags := map[string]string{"service": serviceName}
@@ -507,10 +681,46 @@ func (p *Proxy) RefreshDestinations(serviceName string, ring *consistent.Consist
 		return
 	}
 
-	mtx.Lock()
-	ring.Set(destinations)
-	mtx.Unlock()
+	if ring == p.ForwardDestinations && p.forwardHealth != nil {
+		// Only the healthy destinations go on the ring:
+		p.forwardHealth.SetMembers(destinations)
+	} else {
+		mtx.Lock()
+		ring.Set(destinations)
+		mtx.Unlock()
+	}
 	samples.Add(ssf.Gauge("discoverer.destination_number", float32(len(destinations)), srvTags))
+	for dest, share := range ringShares(ring, ringShareProbes) {
+		samples.Add(ssf.Gauge("discoverer.ring_share", float32(share), map[string]string{
+			"service":     serviceName,
+			"destination": dest,
+		}))
+	}
+}
+
+// ringShareProbes is the number of keys that ringShares hashes to
+// estimate how the keyspace is distributed among a ring's members.
+const ringShareProbes = 10000
+
+// ringShares estimates the fraction of keys that each member of the
+// ring is responsible for, by looking up probes synthetic keys.
+func ringShares(ring hashring.Ring, probes int) map[string]float64 {
+	members := ring.Members()
+	shares := make(map[string]float64, len(members))
+	if len(members) == 0 || probes <= 0 {
+		return shares
+	}
+	for _, member := range members {
+		shares[member] = 0
+	}
+	for i := 0; i < probes; i++ {
+		dest, err := ring.Get("probe." + strconv.Itoa(i))
+		if err != nil {
+			continue
+		}
+		shares[dest] += 1 / float64(probes)
+	}
+	return shares
 }
 
 // Handler returns the Handler responsible for routing request processing.
@@ -576,7 +786,9 @@ func (p *Proxy) ProxyTraces(ctx context.Context, traces []DatadogTraceSpan) {
 }
 
 // ProxyMetrics takes a slice of JSONMetrics and breaks them up into
-// multiple HTTP requests by MetricKey using the hash ring.
+// multiple HTTP requests by MetricKey using the hash ring. Unless they are
+// batched, each request's idempotency key is derived from the one that
+// ctx carries and its destination.
 func (p *Proxy) ProxyMetrics(ctx context.Context, jsonMetrics []samplers.JSONMetric, origin string) {
 	span, _ := trace.StartSpanFromContext(ctx, "veneur.opentracing.proxy.proxy_metrics")
 	defer span.ClientFinish(p.TraceClient)
@@ -594,24 +806,37 @@ func (p *Proxy) ProxyMetrics(ctx context.Context, jsonMetrics []samplers.JSONMet
 		}),
 	)...)
 
-	jsonMetricsByDestination := make(map[string][]samplers.JSONMetric)
-	for _, h := range p.ForwardDestinations.Members() {
-		jsonMetricsByDestination[h] = make([]samplers.JSONMetric, 0)
-	}
-
-	for _, jm := range jsonMetrics {
-		dest, _ := p.ForwardDestinations.Get(jm.MetricKey.String())
-		jsonMetricsByDestination[dest] = append(jsonMetricsByDestination[dest], jm)
-	}
+	if p.forwardOverGRPC {
+		p.forwardGRPC(span.Attach(ctx), jsonMetrics)
+	} else {
+		jsonMetricsByDestination := make(map[string][]samplers.JSONMetric)
+		for _, h := range p.ForwardDestinations.Members() {
+			jsonMetricsByDestination[h] = make([]samplers.JSONMetric, 0)
+		}
 
-	// nb The response has already been returned at this point, because we
-	wg := sync.WaitGroup{}
-	wg.Add(len(jsonMetricsByDestination)) // Make our waitgroup the size of our destinations
+		for _, jm := range jsonMetrics {
+			dest, _ := p.ForwardDestinations.Get(jm.MetricKey.String())
+			jsonMetricsByDestination[dest] = append(jsonMetricsByDestination[dest], jm)
+		}
 
-	for dest, batch := range jsonMetricsByDestination {
-		go p.doPost(ctx, &wg, dest, batch)
+		if p.forwardBatcher != nil {
+			for dest, batch := range jsonMetricsByDestination {
+				p.forwardBatcher.Add(dest, batch)
+			}
+		} else {
+			// nb The response has already been returned at this point, because we
+			wg := sync.WaitGroup{}
+			wg.Add(len(jsonMetricsByDestination)) // Make our waitgroup the size of our destinations
+
+			for dest, batch := range jsonMetricsByDestination {
+				go func(dest string, batch []samplers.JSONMetric) {
+					defer wg.Done()
+					p.doPost(ctx, dest, batch)
+				}(dest, batch)
+			}
+			wg.Wait() // Wait for all the above goroutines to complete
+		}
 	}
-	wg.Wait() // Wait for all the above goroutines to complete
 	log.WithField("count", metricCount).Debug("Completed forward")
 
 	span.Add(ssf.RandomlySample(0.1,
@@ -620,9 +845,36 @@ func (p *Proxy) ProxyMetrics(ctx context.Context, jsonMetrics []samplers.JSONMet
 	)...)
 }
 
-func (p *Proxy) doPost(ctx context.Context, wg *sync.WaitGroup, destination string, batch []samplers.JSONMetric) {
-	defer wg.Done()
+// forwardGRPC converts the metrics to protobufs and forwards them to
+// the import service of the gRPC destinations.
+func (p *Proxy) forwardGRPC(ctx context.Context, jsonMetrics []samplers.JSONMetric) {
+	samples := &ssf.Samples{}
+	defer metrics.Report(p.TraceClient, samples)
+
+	ms := make([]*metricpb.Metric, 0, len(jsonMetrics))
+	for _, jm := range jsonMetrics {
+		m, err := jm.Metric()
+		if err != nil {
+			samples.Add(ssf.Count("forward.error_total", 1, map[string]string{"cause": "convert", "protocol": "grpc"}))
+			log.WithError(err).WithField("name", jm.Name).Warn("Could not convert a metric for forwarding over gRPC")
+			continue
+		}
+		ms = append(ms, m)
+	}
+	// The gRPC server logs and reports the errors:
+	_ = p.grpcServer.Forward(ctx, ms)
+}
+
+// forwardScheme returns the URL scheme of forwarding destinations
+// that are given without one.
+func (p *Proxy) forwardScheme() string {
+	if p.forwardTLS != nil {
+		return "https"
+	}
+	return "http"
+}
 
+func (p *Proxy) doPost(ctx context.Context, destination string, batch []samplers.JSONMetric) {
 	samples := &ssf.Samples{}
 	defer metrics.Report(p.TraceClient, samples)
 
@@ -633,11 +885,12 @@ func (p *Proxy) doPost(ctx context.Context, wg *sync.WaitGroup, destination stri
 
 	// Make sure the destination always has a valid 'http' prefix.
 	if !strings.HasPrefix(destination, "http") {
-		u := url.URL{Scheme: "http", Host: destination}
+		u := url.URL{Scheme: p.forwardScheme(), Host: destination}
 		destination = u.String()
 	}
 
 	endpoint := fmt.Sprintf("%s/import", destination)
+	ctx = idempotency.WithKey(ctx, idempotency.Derive(idempotency.FromContext(ctx), destination))
 	err := vhttp.PostHelper(ctx, p.HTTPClient, p.TraceClient, http.MethodPost, endpoint, batch, "forward", true, nil, log)
 	if err == nil {
 		log.WithField("metrics", batchSize).Debug("Completed forward to Veneur")
@@ -653,6 +906,18 @@ func (p *Proxy) doPost(ctx context.Context, wg *sync.WaitGroup, destination stri
 	)...)
 }
 
+// postBatch posts a batch of coalesced metrics, within the forward
+// timeout.
+func (p *Proxy) postBatch(destination string, batch []samplers.JSONMetric) {
+	ctx := context.Background()
+	if p.ForwardTimeout > 0 {
+		var cancel func()
+		ctx, cancel = context.WithTimeout(ctx, p.ForwardTimeout)
+		defer cancel()
+	}
+	p.doPost(ctx, destination, batch)
+}
+
 func (p *Proxy) ReportRuntimeMetrics() {
 	mem := &runtime.MemStats{}
 	runtime.ReadMemStats(mem)
@@ -0,0 +1,139 @@
+package veneur
+
+import (
+	"sync"
+	"time"
+
+	"github.com/stripe/veneur/samplers"
+)
+
+// defaultForwardBatchSize and defaultForwardBatchInterval are the
+// thresholds of a forwardBatcher, if only one of them is configured.
+const (
+	defaultForwardBatchSize     = 5000
+	defaultForwardBatchInterval = time.Second
+)
+
+// forwardBatcher coalesces the metrics that the proxy forwards over
+// HTTP: it buffers them per destination, across incoming requests, and
+// posts a destination's metrics once size of them are buffered, or once
+// the interval passes, whichever comes first.
+type forwardBatcher struct {
+	size     int
+	interval time.Duration
+	post     func(dest string, batch []samplers.JSONMetric)
+
+	mtx     sync.Mutex
+	pending map[string][]samplers.JSONMetric
+	closed  bool
+
+	// posts tracks the batches that are being posted, so that Close can
+	// wait for them.
+	posts sync.WaitGroup
+	stop  chan struct{}
+	done  chan struct{}
+}
+
+// newForwardBatcher returns a batcher that posts batches with post,
+// and starts flushing it every interval.
+func newForwardBatcher(size int, interval time.Duration, post func(dest string, batch []samplers.JSONMetric)) *forwardBatcher {
+	if size <= 0 {
+		size = defaultForwardBatchSize
+	}
+	if interval <= 0 {
+		interval = defaultForwardBatchInterval
+	}
+	b := &forwardBatcher{
+		size:     size,
+		interval: interval,
+		post:     post,
+		pending:  map[string][]samplers.JSONMetric{},
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go b.run()
+	return b
+}
+
+func (b *forwardBatcher) run() {
+	defer close(b.done)
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			b.Flush()
+		case <-b.stop:
+			return
+		}
+	}
+}
+
+// Add buffers the metrics for dest, and posts full batches of them.
+// Once the batcher is closed, Add posts the metrics right away.
+func (b *forwardBatcher) Add(dest string, metrics []samplers.JSONMetric) {
+	if len(metrics) == 0 {
+		return
+	}
+	b.mtx.Lock()
+	if b.closed {
+		b.mtx.Unlock()
+		for len(metrics) > 0 {
+			n := b.size
+			if n > len(metrics) {
+				n = len(metrics)
+			}
+			b.post(dest, metrics[:n])
+			metrics = metrics[n:]
+		}
+		return
+	}
+	pending := append(b.pending[dest], metrics...)
+	for len(pending) >= b.size {
+		b.send(dest, pending[:b.size:b.size])
+		pending = pending[b.size:]
+	}
+	if len(pending) == 0 {
+		delete(b.pending, dest)
+	} else {
+		b.pending[dest] = pending
+	}
+	b.mtx.Unlock()
+}
+
+// Flush posts the metrics buffered for every destination.
+func (b *forwardBatcher) Flush() {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	for dest, pending := range b.pending {
+		b.send(dest, pending)
+		delete(b.pending, dest)
+	}
+}
+
+// send posts a batch in the background. b.mtx must be held.
+func (b *forwardBatcher) send(dest string, batch []samplers.JSONMetric) {
+	b.posts.Add(1)
+	go func() {
+		defer b.posts.Done()
+		b.post(dest, batch)
+	}()
+}
+
+// Close stops flushing periodically, posts the metrics that are still
+// buffered, and waits for all posts to finish, so that no metrics are
+// lost when the proxy shuts down.
+func (b *forwardBatcher) Close() {
+	b.mtx.Lock()
+	if b.closed {
+		b.mtx.Unlock()
+		return
+	}
+	b.closed = true
+	b.mtx.Unlock()
+
+	close(b.stop)
+	<-b.done
+	b.Flush()
+	b.posts.Wait()
+}
@@ -0,0 +1,217 @@
+package veneur
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stripe/veneur/hashring"
+)
+
+// destinationHealthChecker periodically checks the health endpoint of
+// each destination that the proxy forwards metrics to, and keeps the
+// destinations that fail too many checks in a row off the hash ring
+// until they pass one again.
+//
+// Since the ring is consistent, taking a destination off it only
+// moves the keys that the destination was responsible for; keys
+// owned by healthy destinations stay where they are.
+type destinationHealthChecker struct {
+	client    *http.Client
+	scheme    string
+	path      string
+	threshold int
+	timeout   time.Duration
+
+	// ring is the ring that healthy destinations are routed through,
+	// and ringMtx is the mutex that the proxy holds when updating it.
+	ring    hashring.Ring
+	ringMtx *sync.Mutex
+
+	// mtx protects the fields below, and serializes updates to the
+	// ring.
+	mtx sync.Mutex
+	// members are all the known destinations, healthy or not.
+	members []string
+	// failures counts the consecutive failed checks of a destination.
+	failures map[string]int
+}
+
+func newDestinationHealthChecker(ring hashring.Ring, ringMtx *sync.Mutex, client *http.Client, scheme string, path string, threshold int, timeout time.Duration) *destinationHealthChecker {
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	if threshold < 1 {
+		threshold = 1
+	}
+	return &destinationHealthChecker{
+		client:    client,
+		scheme:    scheme,
+		path:      path,
+		threshold: threshold,
+		timeout:   timeout,
+		ring:      ring,
+		ringMtx:   ringMtx,
+		failures:  map[string]int{},
+	}
+}
+
+// SetMembers replaces the known destinations and puts those that
+// aren't known to be unhealthy on the ring. New destinations are
+// assumed to be healthy until they fail enough checks.
+func (h *destinationHealthChecker) SetMembers(members []string) {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+
+	h.members = append([]string(nil), members...)
+	failures := make(map[string]int, len(members))
+	for _, member := range members {
+		failures[member] = h.failures[member]
+	}
+	h.failures = failures
+	h.updateRing()
+}
+
+// healthy returns the destinations that haven't failed as many
+// consecutive checks as the threshold. If every destination is
+// unhealthy, it returns all of them: forwarding to destinations that
+// may be down beats dropping every metric. h.mtx must be held.
+func (h *destinationHealthChecker) healthy() []string {
+	healthy := make([]string, 0, len(h.members))
+	for _, member := range h.members {
+		if h.failures[member] < h.threshold {
+			healthy = append(healthy, member)
+		}
+	}
+	if len(healthy) == 0 {
+		return h.members
+	}
+	return healthy
+}
+
+// updateRing puts the healthy destinations on the ring, if they
+// differ from the ones that are on it. h.mtx must be held.
+func (h *destinationHealthChecker) updateRing() {
+	healthy := h.healthy()
+	h.ringMtx.Lock()
+	defer h.ringMtx.Unlock()
+	current := h.ring.Members()
+	if sameMembers(current, healthy) {
+		return
+	}
+	h.ring.Set(healthy)
+	log.WithFields(logrus.Fields{
+		"previous": current,
+		"healthy":  healthy,
+	}).Info("Updated the healthy forwarding destinations")
+}
+
+// Check checks every known destination once, concurrently, and takes
+// destinations that have become unhealthy off the ring, or puts those
+// that have recovered back on it. It returns the number of unhealthy
+// destinations.
+func (h *destinationHealthChecker) Check(ctx context.Context) int {
+	h.mtx.Lock()
+	members := h.members
+	h.mtx.Unlock()
+
+	results := make([]bool, len(members))
+	wg := sync.WaitGroup{}
+	for i, member := range members {
+		wg.Add(1)
+		go func(i int, member string) {
+			defer wg.Done()
+			results[i] = h.check(ctx, member)
+		}(i, member)
+	}
+	wg.Wait()
+
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	unhealthy := 0
+	for i, member := range members {
+		if _, ok := h.failures[member]; !ok {
+			// it was removed while we were checking it
+			continue
+		}
+		if results[i] {
+			if h.failures[member] >= h.threshold {
+				log.WithField("destination", member).Info("Forwarding destination recovered")
+			}
+			h.failures[member] = 0
+			continue
+		}
+		h.failures[member]++
+		if h.failures[member] == h.threshold {
+			log.WithFields(logrus.Fields{
+				"destination": member,
+				"failures":    h.failures[member],
+			}).Warn("Forwarding destination is unhealthy, no longer forwarding to it")
+		}
+		if h.failures[member] >= h.threshold {
+			unhealthy++
+		}
+	}
+	h.updateRing()
+	return unhealthy
+}
+
+// check returns true if the destination's health endpoint responds
+// with a 2xx status in time.
+func (h *destinationHealthChecker) check(ctx context.Context, destination string) bool {
+	if h.timeout > 0 {
+		var cancel func()
+		ctx, cancel = context.WithTimeout(ctx, h.timeout)
+		defer cancel()
+	}
+	endpoint := destination
+	if !strings.HasPrefix(endpoint, "http") {
+		u := url.URL{Scheme: h.scheme, Host: endpoint}
+		endpoint = u.String()
+	}
+	req, err := http.NewRequest(http.MethodGet, strings.TrimSuffix(endpoint, "/")+h.path, nil)
+	if err != nil {
+		log.WithError(err).WithField("destination", destination).Warn("Could not build a health check request")
+		return false
+	}
+	resp, err := h.client.Do(req.WithContext(ctx))
+	if err != nil {
+		log.WithError(err).WithField("destination", destination).Debug("Health check failed")
+		return false
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode/100 != 2 {
+		log.WithFields(logrus.Fields{
+			"destination": destination,
+			"status":      resp.StatusCode,
+		}).Debug("Health check failed")
+		return false
+	}
+	return true
+}
+
+// sameMembers returns true if a and b contain the same destinations,
+// in any order.
+func sameMembers(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	a = append([]string(nil), a...)
+	b = append([]string(nil), b...)
+	sort.Strings(a)
+	sort.Strings(b)
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
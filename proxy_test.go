@@ -3,20 +3,36 @@ package veneur
 import (
 	"compress/zlib"
 	"context"
+	"crypto/tls"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	stdlog "log"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"os"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/stripe/veneur/forwardrpc"
+	"github.com/stripe/veneur/hashring"
+	vhttp "github.com/stripe/veneur/http"
+	"github.com/stripe/veneur/importsrv"
+	"github.com/stripe/veneur/internal/idempotency"
 	"github.com/stripe/veneur/samplers"
+	"github.com/stripe/veneur/samplers/metricpb"
+	"github.com/stripe/veneur/tlsconfig"
+	"github.com/stripe/veneur/tlsconfig/tlstest"
 	"github.com/zenazn/goji/graceful"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 )
 
 func generateProxyConfig() ProxyConfig {
@@ -285,3 +301,477 @@ func TestProxyServeStopHTTP(t *testing.T) {
 		assert.Fail(t, "Stopping the Proxy over HTTP did not stop both listeners")
 	}
 }
+
+// TestHashRingRebalance verifies that adding a destination to the ring
+// only moves the keys that the new destination takes over.
+func TestHashRingRebalance(t *testing.T) {
+	const numKeys = 100000
+	for _, n := range []int{3, 10, 25} {
+		n := n
+		t.Run(fmt.Sprintf("%d destinations", n), func(t *testing.T) {
+			t.Parallel()
+			ring, _ := hashring.New(hashring.Ketama, defaultProxyConfig.HashRingReplicas)
+			for i := 0; i < n; i++ {
+				ring.Add(fmt.Sprintf("http://veneur-global-%d:8127", i))
+			}
+			before := make([]string, numKeys)
+			for i := range before {
+				before[i], _ = ring.Get(fmt.Sprintf("a.b.c.%d|counter|foo:bar", i))
+			}
+
+			added := fmt.Sprintf("http://veneur-global-%d:8127", n)
+			ring.Add(added)
+			moved := 0
+			for i := range before {
+				dest, _ := ring.Get(fmt.Sprintf("a.b.c.%d|counter|foo:bar", i))
+				if dest != before[i] {
+					assert.Equal(t, added, dest, "keys should only move to the new destination")
+					moved++
+				}
+			}
+
+			expected := 1 / float64(n+1)
+			fraction := float64(moved) / numKeys
+			assert.InDelta(t, expected, fraction, expected/2,
+				"%d of %d keys moved, expected about %.3f of them", moved, numKeys, expected)
+		})
+	}
+}
+
+func TestProxyHash(t *testing.T) {
+	cfg := generateProxyConfig()
+	cfg.Hash = "maglev"
+	proxy, err := NewProxyFromConfig(logrus.New(), cfg)
+	require.NoError(t, err)
+	assert.IsType(t, &hashring.MaglevRing{}, proxy.ForwardDestinations)
+	assert.IsType(t, &hashring.MaglevRing{}, proxy.TraceDestinations)
+	assert.IsType(t, &hashring.MaglevRing{}, proxy.ForwardGRPCDestinations)
+
+	cfg.Hash = "md5"
+	_, err = NewProxyFromConfig(logrus.New(), cfg)
+	assert.Error(t, err)
+}
+
+func TestRingShares(t *testing.T) {
+	ring, _ := hashring.New(hashring.Ketama, defaultProxyConfig.HashRingReplicas)
+	assert.Empty(t, ringShares(ring, ringShareProbes))
+
+	ring.Set([]string{"a", "b", "c", "d"})
+	shares := ringShares(ring, ringShareProbes)
+	require.Len(t, shares, 4)
+	total := 0.0
+	for dest, share := range shares {
+		assert.InDelta(t, 0.25, share, 0.1, "destination %s is responsible for too many or few keys", dest)
+		total += share
+	}
+	assert.InDelta(t, 1, total, 0.0001)
+}
+
+// newHealthCheckedDestination returns a fake global veneur whose
+// health check passes as long as healthy is set, and which counts the
+// metrics forwarded to it.
+func newHealthCheckedDestination(t *testing.T, healthy *int32, received *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/healthcheck":
+			if atomic.LoadInt32(healthy) == 0 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			w.Write([]byte("ok\n"))
+		case "/import":
+			z, err := zlib.NewReader(r.Body)
+			require.NoError(t, err)
+			var batch []samplers.JSONMetric
+			require.NoError(t, json.NewDecoder(z).Decode(&batch))
+			atomic.AddInt32(received, int32(len(batch)))
+			w.WriteHeader(http.StatusAccepted)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func TestHealthCheckedForwarding(t *testing.T) {
+	healthyA, healthyB := int32(1), int32(1)
+	var receivedA, receivedB int32
+	a := newHealthCheckedDestination(t, &healthyA, &receivedA)
+	defer a.Close()
+	b := newHealthCheckedDestination(t, &healthyB, &receivedB)
+	defer b.Close()
+
+	cfg := generateProxyConfig()
+	cfg.ConsulTraceServiceName = ""
+	cfg.ConsulForwardServiceName = ""
+	cfg.ForwardAddress = a.URL
+	cfg.ForwardHealthCheckInterval = "1h"
+	cfg.ForwardHealthCheckThreshold = 2
+	proxy, err := NewProxyFromConfig(logrus.New(), cfg)
+	require.NoError(t, err)
+	proxy.forwardHealth.SetMembers([]string{a.URL, b.URL})
+
+	metrics := make([]samplers.JSONMetric, 100)
+	for i := range metrics {
+		ctr := samplers.Counter{Name: fmt.Sprintf("a.counter.%d", i)}
+		ctr.Sample(1, 1.0)
+		metrics[i], err = ctr.Export()
+		require.NoError(t, err)
+	}
+	var onA []string
+	for _, m := range metrics {
+		if dest, _ := proxy.ForwardDestinations.Get(m.MetricKey.String()); dest == a.URL {
+			onA = append(onA, m.MetricKey.String())
+		}
+	}
+	require.NotEmpty(t, onA)
+	require.True(t, len(onA) < len(metrics), "both destinations should get some of the metrics")
+
+	atomic.StoreInt32(&healthyB, 0)
+	assert.Equal(t, 0, proxy.forwardHealth.Check(context.Background()))
+	assert.Len(t, proxy.ForwardDestinations.Members(), 2, "one failure is below the threshold")
+	assert.Equal(t, 1, proxy.forwardHealth.Check(context.Background()))
+	assert.Equal(t, []string{a.URL}, proxy.ForwardDestinations.Members())
+
+	proxy.ProxyMetrics(context.Background(), metrics, "test")
+	assert.Equal(t, int32(len(metrics)), atomic.LoadInt32(&receivedA), "the healthy destination should get all metrics")
+	assert.Equal(t, int32(0), atomic.LoadInt32(&receivedB), "the unhealthy destination shouldn't get any metrics")
+
+	atomic.StoreInt32(&healthyB, 1)
+	assert.Equal(t, 0, proxy.forwardHealth.Check(context.Background()))
+	assert.Len(t, proxy.ForwardDestinations.Members(), 2, "the destination should be back after recovering")
+	for _, key := range onA {
+		dest, _ := proxy.ForwardDestinations.Get(key)
+		assert.Equal(t, a.URL, dest, "keys on the healthy destination should stay there")
+	}
+}
+
+func TestProxyForwardBatching(t *testing.T) {
+	var posts, received int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		z, err := zlib.NewReader(r.Body)
+		if !assert.NoError(t, err) {
+			return
+		}
+		var batch []samplers.JSONMetric
+		if !assert.NoError(t, json.NewDecoder(z).Decode(&batch)) {
+			return
+		}
+		atomic.AddInt32(&posts, 1)
+		atomic.AddInt32(&received, int32(len(batch)))
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer ts.Close()
+
+	cfg := generateProxyConfig()
+	cfg.ConsulTraceServiceName = ""
+	cfg.ConsulForwardServiceName = ""
+	cfg.ForwardAddress = ts.URL
+	cfg.ForwardBatchSize = 100
+	cfg.ForwardBatchInterval = "1h"
+	proxy, err := NewProxyFromConfig(logrus.New(), cfg)
+	require.NoError(t, err)
+	require.NotNil(t, proxy.forwardBatcher)
+
+	// 250 metrics arrive in requests of 10, and go out in two full
+	// batches, plus one partial batch that is flushed on shutdown.
+	const n = 250
+	for i := 0; i < n; i += 10 {
+		metrics := make([]samplers.JSONMetric, 10)
+		for j := range metrics {
+			ctr := samplers.Counter{Name: fmt.Sprintf("a.counter.%d", i+j)}
+			ctr.Sample(1, 1.0)
+			metrics[j], err = ctr.Export()
+			require.NoError(t, err)
+		}
+		proxy.ProxyMetrics(context.Background(), metrics, "test")
+	}
+	proxy.forwardBatcher.Close()
+
+	assert.Equal(t, int32((n+cfg.ForwardBatchSize-1)/cfg.ForwardBatchSize), atomic.LoadInt32(&posts))
+	assert.Equal(t, int32(n), atomic.LoadInt32(&received))
+}
+
+func TestProxyForwardDuplicate(t *testing.T) {
+	ch := make(chan []samplers.InterMetric, 10)
+	sink, _ := NewChannelMetricSink(ch)
+	global := setupVeneurServer(t, globalConfig(), nil, sink, nil)
+	defer global.Shutdown()
+	imported := make(chan struct{}, 10)
+	globalTS := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handleImport(global).ServeHTTP(w, r)
+		imported <- struct{}{}
+	}))
+	defer globalTS.Close()
+
+	// A local veneur that retries sending a batch may send it to the
+	// same proxy, or to another one behind the same address:
+	var proxies []*httptest.Server
+	for i := 0; i < 2; i++ {
+		cfg := generateProxyConfig()
+		cfg.ConsulTraceServiceName = ""
+		cfg.ConsulForwardServiceName = ""
+		cfg.ForwardAddress = globalTS.URL
+		proxy, err := NewProxyFromConfig(logrus.New(), cfg)
+		require.NoError(t, err)
+		ts := httptest.NewServer(proxy.Handler())
+		defer ts.Close()
+		proxies = append(proxies, ts)
+	}
+
+	counter := samplers.NewCounter("a.b.c", nil)
+	counter.Sample(5, 1.0)
+	jm, err := counter.Export()
+	require.NoError(t, err)
+	batch := []samplers.JSONMetric{jm}
+
+	ctx := idempotency.WithKey(context.Background(), idempotency.NewKey())
+	for _, ts := range []*httptest.Server{proxies[0], proxies[0], proxies[1]} {
+		require.NoError(t, vhttp.PostHelper(ctx, ts.Client(), global.TraceClient, http.MethodPost, ts.URL+"/import", batch, "forward", true, nil, logrus.New()))
+	}
+	for i := 0; i < 3; i++ {
+		select {
+		case <-imported:
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for the proxies to forward the batch")
+		}
+	}
+
+	// The global veneur's workers ingest the imports asynchronously, so
+	// keep flushing until the counter shows up, and once more after that:
+	var total float64
+	flush := func() {
+		global.Flush(context.Background())
+		select {
+		case metrics := <-ch:
+			for _, m := range metrics {
+				total += m.Value
+			}
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for total == 0 && time.Now().Before(deadline) {
+		flush()
+	}
+	require.NotZero(t, total, "timed out waiting for the imported counter")
+	time.Sleep(100 * time.Millisecond)
+	flush()
+	assert.Equal(t, 5.0, total, "the batch that was sent again should be counted once")
+}
+
+func TestForwardBatcherInterval(t *testing.T) {
+	posted := make(chan []samplers.JSONMetric, 1)
+	b := newForwardBatcher(100, 10*time.Millisecond, func(dest string, batch []samplers.JSONMetric) {
+		assert.Equal(t, "a", dest)
+		posted <- batch
+	})
+	defer b.Close()
+
+	b.Add("a", make([]samplers.JSONMetric, 3))
+	select {
+	case batch := <-posted:
+		assert.Len(t, batch, 3, "a partial batch should be posted once the interval passes")
+	case <-time.After(5 * time.Second):
+		t.Fatal("the batch was never posted")
+	}
+}
+
+func TestHealthCheckedForwardingAllUnhealthy(t *testing.T) {
+	healthy := int32(0)
+	var received int32
+	a := newHealthCheckedDestination(t, &healthy, &received)
+	defer a.Close()
+
+	ring, _ := hashring.New(hashring.Ketama, defaultProxyConfig.HashRingReplicas)
+	h := newDestinationHealthChecker(ring, &sync.Mutex{}, a.Client(), "http", "healthcheck", 1, time.Second)
+	h.SetMembers([]string{a.URL, "127.0.0.1:1"})
+	assert.Equal(t, 2, h.Check(context.Background()))
+	assert.Len(t, ring.Members(), 2, "destinations should stay on the ring if none are healthy")
+}
+
+type channelMetricIngester chan []*metricpb.Metric
+
+func (c channelMetricIngester) IngestMetrics(ms []*metricpb.Metric) {
+	c <- ms
+}
+
+func TestForwardGRPC(t *testing.T) {
+	ingester := make(channelMetricIngester, 10)
+	importServer := importsrv.New([]importsrv.MetricIngester{ingester})
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go importServer.Server.Serve(ln)
+	defer importServer.Stop()
+
+	cfg := generateProxyConfig()
+	cfg.ConsulTraceServiceName = ""
+	cfg.ConsulForwardServiceName = ""
+	cfg.GrpcAddress = ""
+	cfg.GrpcForwardAddress = ln.Addr().String()
+	cfg.ForwardTransport = "grpc"
+	cfg.ForwardTimeout = "5s"
+	proxy, err := NewProxyFromConfig(logrus.New(), cfg)
+	require.NoError(t, err)
+	defer proxy.Shutdown()
+
+	ctr := samplers.NewCounter("a.counter", []string{"foo:bar"})
+	ctr.Sample(3, 1.0)
+	gauge := samplers.NewGauge("a.gauge", nil)
+	gauge.Sample(2.5, 1.0)
+	set := samplers.NewSet("a.set", nil)
+	set.Sample("member", 1.0)
+	histo := samplers.NewHist("a.histogram", nil)
+	histo.Sample(10, 1.0)
+	histo.Sample(20, 1.0)
+	var batch []samplers.JSONMetric
+	for _, exporter := range []interface {
+		Export() (samplers.JSONMetric, error)
+	}{ctr, gauge, set, histo} {
+		jm, err := exporter.Export()
+		require.NoError(t, err)
+		batch = append(batch, jm)
+	}
+
+	proxy.ProxyMetrics(context.Background(), batch, "test")
+
+	received := map[string]*metricpb.Metric{}
+	for len(received) < len(batch) {
+		select {
+		case ms := <-ingester:
+			for _, m := range ms {
+				received[m.Name] = m
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for metrics; got %v", received)
+		}
+	}
+	assert.Equal(t, []string{"foo:bar"}, received["a.counter"].Tags)
+	assert.Equal(t, int64(3), received["a.counter"].GetCounter().Value)
+	assert.Equal(t, 2.5, received["a.gauge"].GetGauge().Value)
+	assert.Equal(t, metricpb.Type_Set, received["a.set"].Type)
+	assert.NotEmpty(t, received["a.set"].GetSet().HyperLogLog)
+	assert.Equal(t, metricpb.Type_Histogram, received["a.histogram"].Type)
+	assert.Len(t, received["a.histogram"].GetHistogram().TDigest.MainCentroids, 2)
+}
+
+func TestForwardTransportValidation(t *testing.T) {
+	cfg := generateProxyConfig()
+	cfg.ForwardTransport = "grpc"
+	_, err := NewProxyFromConfig(logrus.New(), cfg)
+	assert.Error(t, err, "forwarding over gRPC should require gRPC destinations")
+
+	cfg.ForwardTransport = "carrier-pigeon"
+	_, err = NewProxyFromConfig(logrus.New(), cfg)
+	assert.Error(t, err)
+}
+
+func TestForwardMutualTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "veneur-proxy-tls")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	ca, err := tlstest.NewAuthority("veneur-ca")
+	require.NoError(t, err)
+	serverFiles, err := ca.WriteFiles(dir, "global")
+	require.NoError(t, err)
+	proxyFiles, err := ca.WriteFiles(dir, "proxy")
+	require.NoError(t, err)
+
+	serverTLS, err := tlsconfig.Load(serverFiles)
+	require.NoError(t, err)
+	var received int32
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&received, 1)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	ts.TLS = serverTLS.ServerConfig()
+	ts.Config.ErrorLog = stdlog.New(ioutil.Discard, "", 0)
+	ts.StartTLS()
+	defer ts.Close()
+
+	ctr := samplers.Counter{Name: "foo", Tags: []string{}}
+	ctr.Sample(20.0, 1.0)
+	jsonCtr, err := ctr.Export()
+	require.NoError(t, err)
+
+	tests := []struct {
+		name      string
+		files     ProxyConfig
+		forwarded bool
+	}{
+		{"trusted client certificate", ProxyConfig{
+			ForwardTLSCertificateFile:          proxyFiles.Certificate,
+			ForwardTLSKeyFile:                  proxyFiles.Key,
+			ForwardTLSAuthorityCertificateFile: proxyFiles.Authority,
+		}, true},
+		{"no client certificate", ProxyConfig{
+			ForwardTLSAuthorityCertificateFile: proxyFiles.Authority,
+		}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			atomic.StoreInt32(&received, 0)
+			cfg := generateProxyConfig()
+			cfg.ConsulTraceServiceName = ""
+			cfg.ConsulForwardServiceName = ""
+			// the destination's scheme should default to https:
+			cfg.ForwardAddress = strings.TrimPrefix(ts.URL, "https://")
+			cfg.ForwardTLSCertificateFile = test.files.ForwardTLSCertificateFile
+			cfg.ForwardTLSKeyFile = test.files.ForwardTLSKeyFile
+			cfg.ForwardTLSAuthorityCertificateFile = test.files.ForwardTLSAuthorityCertificateFile
+			proxy, err := NewProxyFromConfig(logrus.New(), cfg)
+			require.NoError(t, err)
+
+			proxy.ProxyMetrics(context.Background(), []samplers.JSONMetric{jsonCtr}, "test")
+			if test.forwarded {
+				assert.Equal(t, int32(1), atomic.LoadInt32(&received))
+			} else {
+				assert.Equal(t, int32(0), atomic.LoadInt32(&received), "the destination should reject the proxy")
+			}
+		})
+	}
+}
+
+func TestProxyListenMutualTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "veneur-proxy-tls")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	ca, err := tlstest.NewAuthority("veneur-ca")
+	require.NoError(t, err)
+	proxyFiles, err := ca.WriteFiles(dir, "proxy")
+	require.NoError(t, err)
+	localFiles, err := ca.WriteFiles(dir, "local")
+	require.NoError(t, err)
+	trusted, err := tlsconfig.Load(localFiles)
+	require.NoError(t, err)
+	noCert, err := tlsconfig.Load(tlsconfig.Files{Authority: localFiles.Authority})
+	require.NoError(t, err)
+
+	cfg := generateProxyConfig()
+	cfg.ConsulTraceServiceName = ""
+	cfg.ConsulForwardServiceName = ""
+	cfg.ForwardAddress = "http://127.0.0.1:1"
+	cfg.TLSCertificateFile = proxyFiles.Certificate
+	cfg.TLSKeyFile = proxyFiles.Key
+	cfg.TLSAuthorityCertificateFile = proxyFiles.Authority
+	proxy, err := NewProxyFromConfig(logrus.New(), cfg)
+	require.NoError(t, err)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go proxy.grpcServer.Server.Serve(ln)
+	defer proxy.grpcServer.Stop()
+
+	send := func(config *tls.Config) error {
+		conn, err := grpc.Dial(ln.Addr().String(), grpc.WithTransportCredentials(credentials.NewTLS(config)))
+		require.NoError(t, err)
+		defer conn.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_, err = forwardrpc.NewForwardClient(conn).SendMetrics(ctx, &forwardrpc.MetricList{})
+		return err
+	}
+	assert.NoError(t, send(trusted.ClientConfig()))
+	assert.Error(t, send(noCert.ClientConfig()), "a client without a certificate should be rejected")
+}
@@ -1,6 +1,7 @@
 package proxysrv
 
 import (
+	"crypto/tls"
 	"time"
 
 	"github.com/sirupsen/logrus"
@@ -36,3 +37,19 @@ func WithTraceClient(c *trace.Client) Option {
 		opts.traceClient = c
 	}
 }
+
+// WithTLSConfig makes the server connect to its destinations with TLS,
+// using the configuration.
+func WithTLSConfig(c *tls.Config) Option {
+	return func(opts *options) {
+		opts.tlsConfig = c
+	}
+}
+
+// WithServerTLSConfig makes the server serve TLS, with the
+// configuration.
+func WithServerTLSConfig(c *tls.Config) Option {
+	return func(opts *options) {
+		opts.serverTLSConfig = c
+	}
+}
@@ -7,6 +7,7 @@
 package proxysrv
 
 import (
+	"crypto/tls"
 	"fmt"
 	"io/ioutil"
 	"net"
@@ -19,9 +20,11 @@ import (
 	"github.com/sirupsen/logrus"
 	"golang.org/x/net/context" // This can be replace with "context" after Go 1.8 support is dropped
 	"google.golang.org/grpc"
-	"stathat.com/c/consistent"
+	"google.golang.org/grpc/credentials"
 
 	"github.com/stripe/veneur/forwardrpc"
+	"github.com/stripe/veneur/hashring"
+	"github.com/stripe/veneur/internal/idempotency"
 	"github.com/stripe/veneur/samplers"
 	"github.com/stripe/veneur/samplers/metricpb"
 	"github.com/stripe/veneur/ssf"
@@ -42,7 +45,7 @@ const (
 // on the metric name, type and tags.
 type Server struct {
 	*grpc.Server
-	destinations *consistent.Consistent
+	destinations hashring.Ring
 	opts         *options
 	conns        *clientConnMap
 	updateMtx    sync.Mutex
@@ -60,13 +63,16 @@ type options struct {
 	forwardTimeout time.Duration
 	traceClient    *trace.Client
 	statsInterval  time.Duration
+	tlsConfig      *tls.Config
+	// serverTLSConfig, if set, is the TLS configuration that the
+	// server listens with.
+	serverTLSConfig *tls.Config
 }
 
 // New creates a new Server with the provided destinations. The server returned
 // is unstarted.
-func New(destinations *consistent.Consistent, opts ...Option) (*Server, error) {
+func New(destinations hashring.Ring, opts ...Option) (*Server, error) {
 	res := &Server{
-		Server: grpc.NewServer(),
 		opts: &options{
 			forwardTimeout: defaultForwardTimeout,
 			statsInterval:  defaultReportStatsInterval,
@@ -79,6 +85,16 @@ func New(destinations *consistent.Consistent, opts ...Option) (*Server, error) {
 		opt(res.opts)
 	}
 
+	if res.opts.tlsConfig != nil {
+		res.conns = newClientConnMap(grpc.WithTransportCredentials(credentials.NewTLS(res.opts.tlsConfig)))
+	}
+
+	var serverOpts []grpc.ServerOption
+	if res.opts.serverTLSConfig != nil {
+		serverOpts = append(serverOpts, grpc.Creds(credentials.NewTLS(res.opts.serverTLSConfig)))
+	}
+	res.Server = grpc.NewServer(serverOpts...)
+
 	if res.opts.log == nil {
 		log := logrus.New()
 		log.Out = ioutil.Discard
@@ -144,7 +160,7 @@ func (s *Server) Stop() {
 // This also prunes the list of open connections.  If a connection exists to
 // a host that wasn't in either the current list or the last one, the
 // connection is closed.
-func (s *Server) SetDestinations(dests *consistent.Consistent) error {
+func (s *Server) SetDestinations(dests hashring.Ring) error {
 	s.updateMtx.Lock()
 	defer s.updateMtx.Unlock()
 
@@ -175,17 +191,29 @@ func (s *Server) SetDestinations(dests *consistent.Consistent) error {
 }
 
 // SendMetrics spawns a new goroutine that forwards metrics to the destinations
-// and exist immediately.
+// and exist immediately. The idempotency key of each forward is derived
+// from the one that the client sent and the destination.
 func (s *Server) SendMetrics(ctx context.Context, mlist *forwardrpc.MetricList) (*empty.Empty, error) {
+	key := idempotency.FromIncomingContext(ctx)
 	go func() {
 		// Track the number of active goroutines in a counter
 		atomic.AddInt64(s.activeProxyHandlers, 1)
-		_ = s.sendMetrics(context.Background(), mlist)
+		_ = s.sendMetrics(idempotency.WithKey(context.Background(), key), mlist)
 		atomic.AddInt64(s.activeProxyHandlers, -1)
 	}()
 	return &empty.Empty{}, nil
 }
 
+// Forward sends the metrics to their destinations on the ring, and
+// returns once every destination has received its share or the
+// forward timeout has passed. Unlike SendMetrics, it blocks, so that
+// callers forwarding on behalf of other protocols can report errors.
+func (s *Server) Forward(ctx context.Context, ms []*metricpb.Metric) error {
+	atomic.AddInt64(s.activeProxyHandlers, 1)
+	defer atomic.AddInt64(s.activeProxyHandlers, -1)
+	return s.sendMetrics(ctx, &forwardrpc.MetricList{Metrics: ms})
+}
+
 func (s *Server) sendMetrics(ctx context.Context, mlist *forwardrpc.MetricList) error {
 	span, _ := trace.StartSpanFromContext(ctx, "veneur.opentracing.proxysrv.send_metrics")
 	defer span.ClientFinish(s.opts.traceClient)
@@ -289,6 +317,7 @@ func (s *Server) forward(ctx context.Context, dest string, ms []*metricpb.Metric
 	}
 
 	c := forwardrpc.NewForwardClient(conn)
+	ctx = idempotency.WithKey(ctx, idempotency.Derive(idempotency.FromContext(ctx), dest))
 	_, err = c.SendMetrics(ctx, &forwardrpc.MetricList{Metrics: ms})
 	if err != nil {
 		return fmt.Errorf("failed to send %d metrics over gRPC: %v",
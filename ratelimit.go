@@ -0,0 +1,163 @@
+package veneur
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"github.com/segmentio/fasthash/fnv1a"
+)
+
+// rateLimiterShards is the number of independently locked shards that
+// a sourceRateLimiter spreads its sources over, so that listeners
+// reading from different sources rarely contend.
+const rateLimiterShards = 64
+
+// rateLimiterPruneEvery is the number of samples a shard admits or
+// drops between sweeps for buckets that have refilled completely.
+const rateLimiterPruneEvery = 4096
+
+// tokenBucket admits samples at a steady rate, allowing bursts of up
+// to its capacity. It is not safe for concurrent use.
+type tokenBucket struct {
+	rate   float64 // tokens per second
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate, burst float64, now time.Time) *tokenBucket {
+	return &tokenBucket{rate: rate, burst: burst, tokens: burst, last: now}
+}
+
+// refill adds the tokens accrued since the bucket was last used.
+func (b *tokenBucket) refill(now time.Time) {
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens += elapsed.Seconds() * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+	}
+	b.last = now
+}
+
+// allow takes a token from the bucket, and returns false if there
+// was none.
+func (b *tokenBucket) allow(now time.Time) bool {
+	b.refill(now)
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// full returns true if the bucket has refilled completely, making it
+// indistinguishable from a new one.
+func (b *tokenBucket) full(now time.Time) bool {
+	b.refill(now)
+	return b.tokens >= b.burst
+}
+
+type rateLimiterShard struct {
+	mtx     sync.Mutex
+	buckets map[string]*tokenBucket
+	ops     int
+}
+
+// sourceRateLimiter limits the rate of samples from each source with
+// a token bucket per source.
+type sourceRateLimiter struct {
+	rate   float64
+	burst  float64
+	now    func() time.Time
+	shards [rateLimiterShards]rateLimiterShard
+}
+
+// burstSize returns the configured burst size for a token bucket with
+// the rate. If burst isn't set, it is the rate (but at least 1).
+func burstSize(rate float64, burst int) float64 {
+	if burst >= 1 {
+		return float64(burst)
+	}
+	if rate < 1 {
+		return 1
+	}
+	return rate
+}
+
+// newSourceRateLimiter creates a limiter that admits rate samples per
+// second from each source, in bursts of up to burst samples.
+func newSourceRateLimiter(rate float64, burst int) *sourceRateLimiter {
+	l := &sourceRateLimiter{
+		rate:  rate,
+		burst: burstSize(rate, burst),
+		now:   time.Now,
+	}
+	for i := range l.shards {
+		l.shards[i].buckets = map[string]*tokenBucket{}
+	}
+	return l
+}
+
+// allow returns true if a sample from source is admitted.
+func (l *sourceRateLimiter) allow(source string) bool {
+	now := l.now()
+	shard := &l.shards[fnv1a.HashString32(source)%rateLimiterShards]
+	shard.mtx.Lock()
+	defer shard.mtx.Unlock()
+
+	shard.ops++
+	if shard.ops >= rateLimiterPruneEvery {
+		// Forget about the sources that haven't sent anything for
+		// long enough; this keeps clients on ephemeral addresses
+		// from growing the map forever.
+		shard.ops = 0
+		for k, b := range shard.buckets {
+			if b.full(now) {
+				delete(shard.buckets, k)
+			}
+		}
+	}
+
+	bucket, ok := shard.buckets[source]
+	if !ok {
+		bucket = newTokenBucket(l.rate, l.burst, now)
+		shard.buckets[source] = bucket
+	}
+	return bucket.allow(now)
+}
+
+// sourceOf returns the host part of a network address, which
+// identifies the source of samples for rate limiting.
+func sourceOf(addr net.Addr) string {
+	switch a := addr.(type) {
+	case *net.UDPAddr:
+		return a.IP.String()
+	case *net.TCPAddr:
+		return a.IP.String()
+	}
+	if host, _, err := net.SplitHostPort(addr.String()); err == nil {
+		return host
+	}
+	return addr.String()
+}
+
+// allowSample returns true if the server's rate limit admits a sample
+// from addr, and counts the sample as dropped otherwise.
+func (s *Server) allowSample(addr net.Addr, protocol string) bool {
+	if s.sourceRateLimiter == nil || addr == nil {
+		return true
+	}
+	source := sourceOf(addr)
+	if s.sourceRateLimiter.allow(source) {
+		return true
+	}
+	s.Statsd.Count("ingest.rate_limited_total", 1, []string{"source:" + source, "protocol:" + protocol, "limit:source"}, 1.0)
+	if protocol == "ssf" {
+		s.countDrop(ingestSourceSSF, dropReasonRateLimited)
+	} else {
+		s.countDrop(ingestSourceStatsd, dropReasonRateLimited)
+	}
+	return false
+}
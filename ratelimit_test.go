@@ -0,0 +1,125 @@
+package veneur
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stripe/veneur/samplers"
+)
+
+func TestSourceRateLimiterBurst(t *testing.T) {
+	now := time.Unix(1476119058, 0)
+	l := newSourceRateLimiter(10, 5)
+	l.now = func() time.Time { return now }
+
+	allowed := 0
+	for i := 0; i < 20; i++ {
+		if l.allow("10.0.0.1") {
+			allowed++
+		}
+	}
+	assert.Equal(t, 5, allowed, "only the burst should be admitted at once")
+	assert.True(t, l.allow("10.0.0.2"), "other sources should have their own bucket")
+
+	now = now.Add(300 * time.Millisecond)
+	allowed = 0
+	for i := 0; i < 20; i++ {
+		if l.allow("10.0.0.1") {
+			allowed++
+		}
+	}
+	assert.Equal(t, 3, allowed, "the bucket should refill at the rate")
+
+	now = now.Add(time.Hour)
+	allowed = 0
+	for i := 0; i < 20; i++ {
+		if l.allow("10.0.0.1") {
+			allowed++
+		}
+	}
+	assert.Equal(t, 5, allowed, "the bucket should refill no further than the burst")
+}
+
+func TestSourceRateLimiterDefaultBurst(t *testing.T) {
+	assert.Equal(t, float64(100), burstSize(100, 0))
+	assert.Equal(t, float64(1), burstSize(0.5, 0))
+	assert.Equal(t, float64(7), burstSize(100, 7))
+}
+
+func TestSourceRateLimiterPrunes(t *testing.T) {
+	now := time.Unix(1476119058, 0)
+	l := newSourceRateLimiter(1, 1)
+	l.now = func() time.Time { return now }
+
+	for i := 0; i < rateLimiterShards*rateLimiterPruneEvery; i++ {
+		l.allow(fmt.Sprintf("10.0.%d.%d", i/256%256, i%256))
+		now = now.Add(time.Millisecond)
+	}
+	buckets := 0
+	for i := range l.shards {
+		buckets += len(l.shards[i].buckets)
+	}
+	assert.True(t, buckets < 65536, "idle sources should be forgotten, but there are %d buckets", buckets)
+}
+
+func TestSourceRateLimiterConcurrent(t *testing.T) {
+	l := newSourceRateLimiter(1, 100)
+	var wg sync.WaitGroup
+	var mtx sync.Mutex
+	allowed := 0
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			n := 0
+			for j := 0; j < 100; j++ {
+				if l.allow("10.0.0.1") {
+					n++
+				}
+			}
+			mtx.Lock()
+			allowed += n
+			mtx.Unlock()
+		}()
+	}
+	wg.Wait()
+	assert.True(t, allowed >= 100 && allowed < 110, "admitted %d samples from a burst of 100", allowed)
+}
+
+func TestSourceOf(t *testing.T) {
+	assert.Equal(t, "10.0.0.1", sourceOf(&net.UDPAddr{IP: net.ParseIP("10.0.0.1"), Port: 8126}))
+	assert.Equal(t, "::1", sourceOf(&net.TCPAddr{IP: net.ParseIP("::1"), Port: 8126}))
+}
+
+// TestHandleTCPGoroutineRateLimit verifies that a burst of lines above
+// the per-connection limit is partially dropped.
+func TestHandleTCPGoroutineRateLimit(t *testing.T) {
+	s := &Server{
+		tcpReadTimeout:         time.Second,
+		tcpConnectionRateLimit: 0.001,
+		rateLimitBurst:         3,
+		Workers: []*Worker{
+			&Worker{PacketChan: make(chan samplers.UDPMetric, 10)},
+		},
+	}
+
+	client, server := net.Pipe()
+	go func() {
+		defer client.Close()
+		for i := 0; i < 10; i++ {
+			client.Write([]byte(fmt.Sprintf("m%d:1|c\n", i)))
+		}
+	}()
+	s.handleTCPGoroutine(server)
+
+	close(s.Workers[0].PacketChan)
+	var names []string
+	for packet := range s.Workers[0].PacketChan {
+		names = append(names, packet.Name)
+	}
+	assert.Equal(t, []string{"m0", "m1", "m2"}, names)
+}
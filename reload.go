@@ -0,0 +1,222 @@
+package veneur
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"reflect"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stripe/veneur/sinks"
+)
+
+// reloadableSettings are the prefixes of the settings that take effect
+// when the configuration is reloaded: those of the sinks, and the
+// options that select the metrics and tags that sinks receive. Every
+// other setting only takes effect when veneur restarts.
+var reloadableSettings = []string{
+	"datadog_",
+	"debug",
+	"falconer_",
+	"graphite_",
+	"honeycomb_",
+	"hostname",
+	"influxdb_",
+	"jaeger_",
+	"kafka_",
+	"lightstep_",
+	"metric_default_route",
+	"metric_routes",
+	"metric_sink_options",
+	"newrelic_",
+	"otlp_",
+	"prometheus_rw_",
+	"signalfx_",
+	"splunk_",
+	"tags_exclude",
+	"wavefront_",
+	"zipkin_",
+}
+
+func isReloadable(setting string) bool {
+	for _, prefix := range reloadableSettings {
+		if strings.HasPrefix(setting, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// restartRequired returns the names of the settings that can't be
+// reloaded and differ between the running configuration and conf, and
+// resets them in conf to their running values.
+func restartRequired(running Config, conf *Config) []string {
+	var changed []string
+	runningValue := reflect.ValueOf(running)
+	newValue := reflect.ValueOf(conf).Elem()
+	t := runningValue.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("yaml"), ",")[0]
+		if isReloadable(name) {
+			continue
+		}
+		if reflect.DeepEqual(runningValue.Field(i).Interface(), newValue.Field(i).Interface()) {
+			continue
+		}
+		changed = append(changed, name)
+		newValue.Field(i).Set(runningValue.Field(i))
+	}
+	return changed
+}
+
+// currentSinks returns the sinks that the server flushes to.
+func (s *Server) currentSinks() sinkSet {
+	s.sinksMtx.RLock()
+	defer s.sinksMtx.RUnlock()
+	return sinkSet{
+		metricSinks:          s.metricSinks,
+		spanSinks:            s.spanSinks,
+		metricSinkFilters:    s.metricSinkFilters,
+		metricSinkTags:       s.metricSinkTags,
+		metricSinkSanitizers: s.metricSinkSanitizers,
+		metricRouter:         s.metricRouter,
+	}
+}
+
+// ReloadConfig applies the settings in conf that can change while the
+// server is running: it replaces the server's sinks with the ones that
+// conf configures, with their endpoints, keys and sampling rates, the
+// tags they exclude and the metrics that are routed to them, and sets
+// the log level. The sinks report the hostname that conf resolves to,
+// so a hostname read from the environment, a file or a metadata
+// service is resolved again by reading the configuration. Changes to
+// any other setting, like the addresses that the server listens on,
+// are logged and take effect on restart.
+//
+// The new sinks are created and started before any sink is replaced.
+// If that fails, ReloadConfig stops the new sinks that started, returns
+// the error, and the server keeps running with its previous
+// configuration. Once the new sinks are in place, the replaced span
+// sinks are flushed, and the replaced sinks that hold data or run in
+// the background, like the asynchronous and buffering metric sinks,
+// are stopped, which sends the data that they still hold.
+func (s *Server) ReloadConfig(conf Config) error {
+	s.reloadMtx.Lock()
+	defer s.reloadMtx.Unlock()
+
+	changed := restartRequired(s.config, &conf)
+
+	set, err := s.newSinkSet(log, conf)
+	if err != nil {
+		return err
+	}
+	for i, sink := range set.spanSinks {
+		if err := sink.Start(s.TraceClient); err != nil {
+			stopSinks(nil, set.spanSinks[:i])
+			return fmt.Errorf("could not start span sink %s: %v", sink.Name(), err)
+		}
+	}
+	for i, sink := range set.metricSinks {
+		if err := sink.Start(s.TraceClient); err != nil {
+			stopSinks(set.metricSinks[:i], set.spanSinks)
+			return fmt.Errorf("could not start metric sink %s: %v", sink.Name(), err)
+		}
+	}
+	set.metricRouter = s.newMetricRouter(conf, set.metricSinks)
+	if s.metricExtractionSink != nil {
+		set.spanSinks = append([]sinks.SpanSink{s.metricExtractionSink}, set.spanSinks...)
+	}
+
+	s.sinksMtx.Lock()
+	previousSpanSinks := s.spanSinks
+	previousMetricSinks := s.metricSinks
+	s.metricSinks = set.metricSinks
+	s.spanSinks = set.spanSinks
+	s.metricSinkFilters = set.metricSinkFilters
+	s.metricSinkTags = set.metricSinkTags
+	s.metricSinkSanitizers = set.metricSinkSanitizers
+	s.metricRouter = set.metricRouter
+	s.sinksMtx.Unlock()
+	if s.SpanWorker != nil {
+		s.SpanWorker.SetSinks(set.spanSinks)
+	}
+
+	// Send the spans and metrics that the replaced sinks still hold:
+	replaced := make([]sinks.SpanSink, 0, len(previousSpanSinks))
+	for _, sink := range previousSpanSinks {
+		if sink != s.metricExtractionSink {
+			sink.Flush()
+			replaced = append(replaced, sink)
+		}
+	}
+	stopSinks(previousMetricSinks, replaced)
+
+	level := logrus.InfoLevel
+	if conf.Debug {
+		level = logrus.DebugLevel
+	}
+	log.SetLevel(level)
+
+	s.config = conf
+	log.WithFields(logrus.Fields{
+		"metricSinks": len(set.metricSinks),
+		"spanSinks":   len(set.spanSinks),
+	}).Info("Reloaded the configuration")
+	if len(changed) > 0 {
+		log.WithField("settings", changed).
+			Warn("Some changed settings can't be reloaded; restart veneur to apply them")
+	}
+	return nil
+}
+
+// stopSinks stops the metric and span sinks that need to be stopped,
+// and logs the errors that they return.
+func stopSinks(metricSinks []sinks.MetricSink, spanSinks []sinks.SpanSink) {
+	for _, sink := range metricSinks {
+		if err := sinks.Stop(sink); err != nil {
+			log.WithError(err).WithField("sink", sink.Name()).Warn("Could not stop a metric sink")
+		}
+	}
+	for _, sink := range spanSinks {
+		if err := sinks.Stop(sink); err != nil {
+			log.WithError(err).WithField("sink", sink.Name()).Warn("Could not stop a span sink")
+		}
+	}
+}
+
+// ReloadConfigOnSignal reads the configuration file at path and
+// reloads the server's configuration from it whenever the process
+// receives one of the signals, until the server shuts down. If the
+// file can't be read or the configuration is invalid, the error is
+// logged and the server keeps its previous configuration.
+func (s *Server) ReloadConfigOnSignal(path string, sigs ...os.Signal) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, sigs...)
+	defer signal.Stop(ch)
+	for {
+		select {
+		case <-s.shutdown:
+			return
+		case sig := <-ch:
+			entry := log.WithFields(logrus.Fields{
+				"signal": sig.String(),
+				"path":   path,
+			})
+			if err := s.reloadConfigFile(path); err != nil {
+				entry.WithError(err).Error("Could not reload the configuration; keeping the previous one")
+			}
+		}
+	}
+}
+
+func (s *Server) reloadConfigFile(path string) error {
+	conf, err := ReadConfig(path)
+	if err != nil {
+		if _, ok := err.(*UnknownConfigKeys); !ok {
+			return err
+		}
+		log.WithError(err).Warn("Config contains invalid or deprecated keys")
+	}
+	return s.ReloadConfig(conf)
+}
@@ -0,0 +1,182 @@
+package veneur
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stripe/veneur/samplers"
+	"github.com/stripe/veneur/ssf"
+)
+
+// hecEndpoint is a Splunk HTTP event collector that sends the trace
+// IDs of the spans it receives to ch.
+func hecEndpoint(ch chan<- int64) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		dec := json.NewDecoder(r.Body)
+		for {
+			var ev struct {
+				Event struct {
+					TraceID string `json:"trace_id"`
+				} `json:"event"`
+			}
+			if err := dec.Decode(&ev); err != nil {
+				if err != io.EOF {
+					w.WriteHeader(http.StatusBadRequest)
+				}
+				break
+			}
+			id, _ := strconv.ParseInt(ev.Event.TraceID, 10, 64)
+			ch <- id
+		}
+		w.Write([]byte(`{"text":"Success","code":0}`))
+	})
+}
+
+// sampledTraces sends a span for each of the trace IDs 1 to 10 to the
+// server, and returns the trace IDs that the HEC endpoint receives.
+func sampledTraces(t *testing.T, s *Server, ch <-chan int64) []int64 {
+	const marker = 1000
+	start := time.Now()
+	for id := int64(1); id <= 10; id++ {
+		s.SpanChan <- &ssf.SSFSpan{
+			Id:             id,
+			TraceId:        id,
+			StartTimestamp: start.UnixNano(),
+			EndTimestamp:   start.Add(time.Second).UnixNano(),
+			Service:        "reload-test",
+			Name:           "span",
+		}
+	}
+	// indicator spans are always sampled:
+	s.SpanChan <- &ssf.SSFSpan{
+		Id:             marker,
+		TraceId:        marker,
+		StartTimestamp: start.UnixNano(),
+		EndTimestamp:   start.Add(time.Second).UnixNano(),
+		Service:        "reload-test",
+		Name:           "marker",
+		Indicator:      true,
+	}
+
+	var ids []int64
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case id := <-ch:
+			if id == marker {
+				// give stragglers on other connections a moment:
+				time.Sleep(50 * time.Millisecond)
+				for len(ch) > 0 {
+					ids = append(ids, <-ch)
+				}
+				sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+				return ids
+			}
+			ids = append(ids, id)
+		case <-timeout:
+			t.Fatalf("timed out waiting for spans, got %v", ids)
+		}
+	}
+}
+
+func TestReloadConfigSampleRate(t *testing.T) {
+	ch := make(chan int64, 100)
+	hec := httptest.NewServer(hecEndpoint(ch))
+	defer hec.Close()
+
+	config := localConfig()
+	config.SsfListenAddresses = []string{"udp://127.0.0.1:0"}
+	config.SplunkHecAddress = hec.URL
+	config.SplunkHecToken = "00000000-0000-0000-0000-000000000000"
+	config.SplunkHecBatchSize = 1
+	config.SplunkHecMaxConnectionLifetime = "100ms"
+	config.SplunkSpanSampleRate = 1
+	s := setupVeneurServer(t, config, nil, nil, nil)
+	defer s.Shutdown()
+
+	assert.Equal(t, []int64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}, sampledTraces(t, s, ch))
+
+	reloaded := config
+	reloaded.SplunkSpanSampleRate = 5
+	require.NoError(t, s.ReloadConfig(reloaded))
+	assert.Equal(t, []int64{5, 10}, sampledTraces(t, s, ch), "the new sample rate should apply to new spans")
+
+	invalid := reloaded
+	invalid.SplunkSpanSampleRate = 1
+	invalid.SplunkHecToken = ""
+	assert.Error(t, s.ReloadConfig(invalid))
+	assert.Equal(t, []int64{5, 10}, sampledTraces(t, s, ch), "an invalid config shouldn't replace the previous one")
+}
+
+func TestReloadConfigRequiresRestart(t *testing.T) {
+	running := localConfig()
+	conf := running
+	conf.StatsdListenAddresses = []string{"udp://127.0.0.1:9999"}
+	conf.Interval = "1m"
+	conf.DatadogAPIKey = "new key"
+	conf.TagsExclude = []string{"host"}
+	conf.Debug = true
+
+	changed := restartRequired(running, &conf)
+	assert.Equal(t, []string{"interval", "statsd_listen_addresses"}, changed)
+	assert.Equal(t, running.StatsdListenAddresses, conf.StatsdListenAddresses, "settings that can't be reloaded should keep their values")
+	assert.Equal(t, running.Interval, conf.Interval)
+	assert.Equal(t, "new key", conf.DatadogAPIKey)
+	assert.Equal(t, []string{"host"}, conf.TagsExclude)
+	assert.True(t, conf.Debug)
+}
+
+func TestReloadConfigStopsReplacedSinks(t *testing.T) {
+	var posts int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(ioutil.Discard, r.Body)
+		atomic.AddInt32(&posts, 1)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+
+	config := Config{
+		DatadogAPIKey:          "apikey",
+		DatadogAPIHostname:     srv.URL,
+		DatadogFlushMaxPerBody: 1000,
+		MetricSinkOptions: map[string]MetricSinkOptions{
+			"datadog": {FlushInterval: "1h", AsyncQueueSize: 2},
+		},
+
+		// required or NewFromConfig fails
+		Interval:     "10s",
+		StatsAddress: "localhost:62251",
+	}
+	server, err := NewFromConfig(logrus.New(), config)
+	require.NoError(t, err)
+	for _, sink := range server.metricSinks {
+		require.NoError(t, sink.Start(server.TraceClient))
+	}
+
+	metrics := []samplers.InterMetric{{
+		Name:      "a.b.c",
+		Timestamp: time.Now().Unix(),
+		Value:     1.0,
+		Type:      samplers.CounterMetric,
+	}}
+	require.NoError(t, server.metricSinks[0].Flush(context.Background(), metrics))
+	assert.Equal(t, int32(0), atomic.LoadInt32(&posts), "the metrics should be buffered for an hour")
+
+	reloaded := config
+	reloaded.DatadogAPIKey = "newkey"
+	require.NoError(t, server.ReloadConfig(reloaded))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&posts), "the replaced sink should send the metrics it buffered")
+}
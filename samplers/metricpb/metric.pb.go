@@ -332,6 +332,9 @@ func (m *CounterValue) GetValue() int64 {
 // GaugeValue wraps the value of a gauge
 type GaugeValue struct {
 	Value float64 `protobuf:"fixed64,1,opt,name=value,proto3" json:"value,omitempty"`
+	// The time (in Unix seconds) that the value was recorded at, or 0
+	// if it is not known
+	Timestamp int64 `protobuf:"varint,2,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
 }
 
 func (m *GaugeValue) Reset()                    { *m = GaugeValue{} }
@@ -346,10 +349,19 @@ func (m *GaugeValue) GetValue() float64 {
 	return 0
 }
 
+func (m *GaugeValue) GetTimestamp() int64 {
+	if m != nil {
+		return m.Timestamp
+	}
+	return 0
+}
+
 // HistogramValue for now just includes the t-digest.  This can be expanded
 // to include the other values such as the sum, average, etc.
 type HistogramValue struct {
 	TDigest *tdigest.MergingDigestData `protobuf:"bytes,1,opt,name=t_digest,json=tDigest" json:"t_digest,omitempty"`
+	// The percentiles requested by the histogram's producer, if any
+	Percentiles []float64 `protobuf:"fixed64,2,rep,packed,name=percentiles" json:"percentiles,omitempty"`
 }
 
 func (m *HistogramValue) Reset()                    { *m = HistogramValue{} }
@@ -364,6 +376,13 @@ func (m *HistogramValue) GetTDigest() *tdigest.MergingDigestData {
 	return nil
 }
 
+func (m *HistogramValue) GetPercentiles() []float64 {
+	if m != nil {
+		return m.Percentiles
+	}
+	return nil
+}
+
 // SetValue contains a binary-encoded HyperLogLog
 type SetValue struct {
 	HyperLogLog []byte `protobuf:"bytes,1,opt,name=hyper_log_log,json=hyperLogLog,proto3" json:"hyper_log_log,omitempty"`
@@ -546,6 +565,11 @@ func (m *GaugeValue) MarshalTo(dAtA []byte) (int, error) {
 		encoding_binary.LittleEndian.PutUint64(dAtA[i:], uint64(math.Float64bits(float64(m.Value))))
 		i += 8
 	}
+	if m.Timestamp != 0 {
+		dAtA[i] = 0x10
+		i++
+		i = encodeVarintMetric(dAtA, i, uint64(m.Timestamp))
+	}
 	return i, nil
 }
 
@@ -574,6 +598,16 @@ func (m *HistogramValue) MarshalTo(dAtA []byte) (int, error) {
 		}
 		i += n6
 	}
+	if len(m.Percentiles) > 0 {
+		dAtA[i] = 0x12
+		i++
+		i = encodeVarintMetric(dAtA, i, uint64(len(m.Percentiles)*8))
+		for _, num := range m.Percentiles {
+			f7 := math.Float64bits(float64(num))
+			encoding_binary.LittleEndian.PutUint64(dAtA[i:], uint64(f7))
+			i += 8
+		}
+	}
 	return i, nil
 }
 
@@ -686,6 +720,9 @@ func (m *GaugeValue) Size() (n int) {
 	if m.Value != 0 {
 		n += 9
 	}
+	if m.Timestamp != 0 {
+		n += 1 + sovMetric(uint64(m.Timestamp))
+	}
 	return n
 }
 
@@ -696,6 +733,9 @@ func (m *HistogramValue) Size() (n int) {
 		l = m.TDigest.Size()
 		n += 1 + l + sovMetric(uint64(l))
 	}
+	if len(m.Percentiles) > 0 {
+		n += 1 + sovMetric(uint64(len(m.Percentiles)*8)) + len(m.Percentiles)*8
+	}
 	return n
 }
 
@@ -1105,6 +1145,25 @@ func (m *GaugeValue) Unmarshal(dAtA []byte) error {
 			v = uint64(encoding_binary.LittleEndian.Uint64(dAtA[iNdEx:]))
 			iNdEx += 8
 			m.Value = float64(math.Float64frombits(v))
+		case 2:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Timestamp", wireType)
+			}
+			m.Timestamp = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowMetric
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.Timestamp |= (int64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
 		default:
 			iNdEx = preIndex
 			skippy, err := skipMetric(dAtA[iNdEx:])
@@ -1188,6 +1247,52 @@ func (m *HistogramValue) Unmarshal(dAtA []byte) error {
 				return err
 			}
 			iNdEx = postIndex
+		case 2:
+			if wireType == 1 {
+				var v uint64
+				if (iNdEx + 8) > l {
+					return io.ErrUnexpectedEOF
+				}
+				v = uint64(encoding_binary.LittleEndian.Uint64(dAtA[iNdEx:]))
+				iNdEx += 8
+				v2 := float64(math.Float64frombits(v))
+				m.Percentiles = append(m.Percentiles, v2)
+			} else if wireType == 2 {
+				var packedLen int
+				for shift := uint(0); ; shift += 7 {
+					if shift >= 64 {
+						return ErrIntOverflowMetric
+					}
+					if iNdEx >= l {
+						return io.ErrUnexpectedEOF
+					}
+					b := dAtA[iNdEx]
+					iNdEx++
+					packedLen |= (int(b) & 0x7F) << shift
+					if b < 0x80 {
+						break
+					}
+				}
+				if packedLen < 0 {
+					return ErrInvalidLengthMetric
+				}
+				postIndex := iNdEx + packedLen
+				if postIndex > l {
+					return io.ErrUnexpectedEOF
+				}
+				for iNdEx < postIndex {
+					var v uint64
+					if (iNdEx + 8) > l {
+						return io.ErrUnexpectedEOF
+					}
+					v = uint64(encoding_binary.LittleEndian.Uint64(dAtA[iNdEx:]))
+					iNdEx += 8
+					v2 := float64(math.Float64frombits(v))
+					m.Percentiles = append(m.Percentiles, v2)
+				}
+			} else {
+				return fmt.Errorf("proto: wrong wireType = %d for field Percentiles", wireType)
+			}
 		default:
 			iNdEx = preIndex
 			skippy, err := skipMetric(dAtA[iNdEx:])
@@ -1398,33 +1503,35 @@ var (
 func init() { proto.RegisterFile("samplers/metricpb/metric.proto", fileDescriptorMetric) }
 
 var fileDescriptorMetric = []byte{
-	// 438 bytes of a gzipped FileDescriptorProto
+	// 467 bytes of a gzipped FileDescriptorProto
 	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x54, 0x92, 0xc1, 0x6a, 0xdb, 0x40,
-	0x10, 0x86, 0xbd, 0x96, 0x65, 0xd9, 0xe3, 0xc4, 0x15, 0x43, 0x5a, 0x96, 0x1c, 0x84, 0x11, 0x6d,
-	0x71, 0x43, 0x51, 0xc0, 0xa5, 0xd0, 0x6b, 0xd3, 0x80, 0x73, 0xb0, 0x2f, 0x4a, 0xe8, 0x35, 0xac,
-	0x9d, 0x61, 0x23, 0x90, 0xbc, 0x42, 0x5a, 0x97, 0xfa, 0x2d, 0xfa, 0x58, 0x39, 0xf6, 0x11, 0x8a,
-	0xfb, 0x22, 0x65, 0x57, 0xda, 0x2a, 0x39, 0x08, 0xcd, 0xfe, 0xff, 0xf7, 0x4b, 0xfc, 0x1a, 0x41,
-	0x54, 0x8b, 0xa2, 0xcc, 0xa9, 0xaa, 0x2f, 0x0b, 0xd2, 0x55, 0xb6, 0x2d, 0x37, 0xed, 0x90, 0x94,
-	0x95, 0xd2, 0x0a, 0x47, 0x4e, 0x3e, 0x7f, 0xad, 0x1f, 0x32, 0x49, 0xb5, 0xbe, 0x6c, 0xef, 0x0d,
-	0x10, 0x3f, 0xf5, 0x61, 0xb8, 0xb6, 0x0c, 0x22, 0x0c, 0x76, 0xa2, 0x20, 0xce, 0x66, 0x6c, 0x3e,
-	0x4e, 0xed, 0x6c, 0x34, 0x2d, 0x64, 0xcd, 0xfb, 0x33, 0xcf, 0x68, 0x66, 0xc6, 0x18, 0x06, 0xfa,
-	0x50, 0x12, 0xf7, 0x66, 0x6c, 0x3e, 0x5d, 0x4c, 0x13, 0xf7, 0x8a, 0xe4, 0xee, 0x50, 0x52, 0x6a,
-	0x3d, 0x5c, 0x40, 0xb0, 0x55, 0xfb, 0x9d, 0xa6, 0x8a, 0xfb, 0x33, 0x36, 0x9f, 0x2c, 0xde, 0x74,
-	0xd8, 0xb7, 0xc6, 0xf8, 0x2e, 0xf2, 0x3d, 0xdd, 0xf4, 0x52, 0x07, 0xe2, 0x47, 0xf0, 0xa5, 0xd8,
-	0x4b, 0xe2, 0x43, 0x9b, 0x38, 0xeb, 0x12, 0x4b, 0x23, 0x3b, 0xbe, 0x81, 0xf0, 0x0b, 0x8c, 0x1f,
-	0xb3, 0x5a, 0x2b, 0x59, 0x89, 0x82, 0x07, 0x36, 0xc1, 0xbb, 0xc4, 0x8d, 0xb3, 0x5c, 0xaa, 0x83,
-	0xf1, 0x3d, 0x78, 0x35, 0x69, 0x3e, 0xb2, 0x19, 0xec, 0x32, 0xb7, 0xa4, 0x1d, 0x6d, 0x00, 0x7c,
-	0x07, 0x7e, 0xbd, 0x55, 0x25, 0xf1, 0xb1, 0x2d, 0xfa, 0xea, 0x19, 0x69, 0xe4, 0xb4, 0x71, 0xaf,
-	0x02, 0xf0, 0x7f, 0x98, 0x58, 0xfc, 0x16, 0x4e, 0x9e, 0x57, 0xc3, 0xb3, 0xd6, 0xb0, 0x1f, 0xd4,
-	0x4b, 0x5b, 0x2a, 0x06, 0xe8, 0xea, 0xbc, 0x64, 0x98, 0x63, 0x96, 0x30, 0x7d, 0x59, 0x00, 0x3f,
-	0xc3, 0x48, 0xdf, 0x37, 0x8b, 0xb3, 0xe8, 0x64, 0x71, 0x9e, 0xb8, 0x45, 0xae, 0xa9, 0x92, 0xd9,
-	0x4e, 0x5e, 0xdb, 0xd3, 0xb5, 0xd0, 0x22, 0x0d, 0x74, 0x73, 0x88, 0x13, 0x18, 0xb9, 0x56, 0x18,
-	0xc3, 0xe9, 0xe3, 0xa1, 0xa4, 0xea, 0x3e, 0x57, 0xd2, 0x5c, 0xf6, 0x39, 0x27, 0xe9, 0xc4, 0x8a,
-	0x2b, 0x25, 0x57, 0x4a, 0x5e, 0x7c, 0x00, 0xdf, 0x76, 0xc3, 0x31, 0xf8, 0xeb, 0xec, 0x27, 0x3d,
-	0x84, 0x3d, 0x33, 0xae, 0xd4, 0x56, 0xe4, 0x21, 0x43, 0x80, 0xe1, 0x32, 0x57, 0x1b, 0x91, 0x87,
-	0xfd, 0x8b, 0xaf, 0x30, 0x30, 0xfb, 0xc6, 0x09, 0x04, 0x6d, 0xeb, 0x86, 0xb5, 0xe5, 0x42, 0x86,
-	0xa7, 0x30, 0xfe, 0xdf, 0x21, 0xec, 0x63, 0x00, 0xde, 0x2d, 0xe9, 0xd0, 0x33, 0xc8, 0x5d, 0x56,
-	0x50, 0x15, 0x0e, 0xae, 0xc2, 0xa7, 0x63, 0xc4, 0x7e, 0x1f, 0x23, 0xf6, 0xe7, 0x18, 0xb1, 0x5f,
-	0x7f, 0xa3, 0xde, 0x66, 0x68, 0x7f, 0xca, 0x4f, 0xff, 0x02, 0x00, 0x00, 0xff, 0xff, 0x3d, 0x41,
-	0xaf, 0x18, 0xd7, 0x02, 0x00, 0x00,
+	0x10, 0x86, 0xb3, 0x96, 0x65, 0x59, 0xe3, 0xc4, 0x15, 0x43, 0x5a, 0x96, 0x50, 0x8c, 0x10, 0x6d,
+	0x71, 0x43, 0x51, 0xc0, 0xa5, 0xd0, 0x63, 0x9b, 0x06, 0x92, 0x83, 0x7d, 0x51, 0x42, 0xaf, 0x61,
+	0xad, 0x0c, 0x1b, 0x81, 0xe4, 0x15, 0xd2, 0xba, 0xd4, 0x6f, 0xd1, 0xc7, 0xca, 0xb1, 0x8f, 0x50,
+	0xdc, 0x17, 0x29, 0xbb, 0x92, 0x2a, 0xe7, 0x60, 0x3c, 0xfb, 0xcf, 0xf7, 0x6b, 0x99, 0x7f, 0x16,
+	0x66, 0xb5, 0x28, 0xca, 0x9c, 0xaa, 0xfa, 0xa2, 0x20, 0x5d, 0x65, 0x69, 0xb9, 0x6e, 0x8b, 0xb8,
+	0xac, 0x94, 0x56, 0x38, 0xee, 0xe4, 0xb3, 0x97, 0xfa, 0x21, 0x93, 0x54, 0xeb, 0x8b, 0xf6, 0xbf,
+	0x01, 0xa2, 0xa7, 0x01, 0x8c, 0x56, 0x96, 0x41, 0x84, 0xe1, 0x46, 0x14, 0xc4, 0x59, 0xc8, 0xe6,
+	0x7e, 0x62, 0x6b, 0xa3, 0x69, 0x21, 0x6b, 0x3e, 0x08, 0x1d, 0xa3, 0x99, 0x1a, 0x23, 0x18, 0xea,
+	0x5d, 0x49, 0xdc, 0x09, 0xd9, 0x7c, 0xba, 0x98, 0xc6, 0xdd, 0x15, 0xf1, 0xdd, 0xae, 0xa4, 0xc4,
+	0xf6, 0x70, 0x01, 0x5e, 0xaa, 0xb6, 0x1b, 0x4d, 0x15, 0x77, 0x43, 0x36, 0x9f, 0x2c, 0x5e, 0xf5,
+	0xd8, 0xb7, 0xa6, 0xf1, 0x5d, 0xe4, 0x5b, 0xba, 0x39, 0x4a, 0x3a, 0x10, 0x3f, 0x80, 0x2b, 0xc5,
+	0x56, 0x12, 0x1f, 0x59, 0xc7, 0x69, 0xef, 0xb8, 0x36, 0x72, 0xc7, 0x37, 0x10, 0x7e, 0x06, 0xff,
+	0x31, 0xab, 0xb5, 0x92, 0x95, 0x28, 0xb8, 0x67, 0x1d, 0xbc, 0x77, 0xdc, 0x74, 0xad, 0xce, 0xd5,
+	0xc3, 0xf8, 0x0e, 0x9c, 0x9a, 0x34, 0x1f, 0x5b, 0x0f, 0xf6, 0x9e, 0x5b, 0xd2, 0x1d, 0x6d, 0x00,
+	0x7c, 0x0b, 0x6e, 0x9d, 0xaa, 0x92, 0xb8, 0x6f, 0x07, 0x7d, 0x71, 0x40, 0x1a, 0x39, 0x69, 0xba,
+	0x97, 0x1e, 0xb8, 0x3f, 0x8c, 0x2d, 0x7a, 0x03, 0xc7, 0x87, 0xa3, 0xe1, 0x69, 0xdb, 0xb0, 0x81,
+	0x3a, 0x49, 0x4b, 0x7d, 0x01, 0xe8, 0xc7, 0x79, 0xce, 0xb0, 0x96, 0xc1, 0xd7, 0xe0, 0xeb, 0xac,
+	0xa0, 0x5a, 0x8b, 0xa2, 0xe4, 0x03, 0xeb, 0xee, 0x85, 0x28, 0x83, 0xe9, 0xf3, 0xf1, 0xf0, 0x13,
+	0x8c, 0xf5, 0x7d, 0xb3, 0x56, 0xfb, 0xa1, 0xc9, 0xe2, 0x2c, 0xee, 0xd6, 0xbc, 0xa2, 0x4a, 0x66,
+	0x1b, 0x79, 0x65, 0x4f, 0x57, 0x42, 0x8b, 0xc4, 0xd3, 0xcd, 0x01, 0x43, 0x98, 0x94, 0x54, 0xa5,
+	0xb4, 0xd1, 0x59, 0x4e, 0xcd, 0x8e, 0x59, 0x72, 0x28, 0x45, 0x31, 0x8c, 0xbb, 0x54, 0x30, 0x82,
+	0x93, 0xc7, 0x5d, 0x49, 0xd5, 0x7d, 0xae, 0xa4, 0xf9, 0xd9, 0x9b, 0x8e, 0x93, 0x89, 0x15, 0x97,
+	0x4a, 0x2e, 0x95, 0x3c, 0x7f, 0x0f, 0xae, 0xcd, 0x06, 0x7d, 0x70, 0x57, 0xd9, 0x4f, 0x7a, 0x08,
+	0x8e, 0x4c, 0xb9, 0x54, 0xa9, 0xc8, 0x03, 0x86, 0x00, 0xa3, 0xeb, 0x5c, 0xad, 0x45, 0x1e, 0x0c,
+	0xce, 0xbf, 0xc2, 0xd0, 0xbc, 0x17, 0x9c, 0x80, 0xd7, 0xa6, 0xd6, 0xb0, 0x36, 0x9c, 0x80, 0xe1,
+	0x09, 0xf8, 0xff, 0xa7, 0x0c, 0x06, 0xe8, 0x81, 0x73, 0x4b, 0x3a, 0x70, 0x0c, 0x72, 0x97, 0x15,
+	0x54, 0x05, 0xc3, 0xcb, 0xe0, 0x69, 0x3f, 0x63, 0xbf, 0xf7, 0x33, 0xf6, 0x67, 0x3f, 0x63, 0xbf,
+	0xfe, 0xce, 0x8e, 0xd6, 0x23, 0xfb, 0xa8, 0x3f, 0xfe, 0x1b, 0x00, 0x20, 0x77, 0xcd, 0xdf, 0x17,
+	0x03, 0x00, 0x00,
 }
@@ -30,6 +30,12 @@ type UDPMetric struct {
 	Timestamp  int64
 	Message    string
 	HostName   string
+	// Percentiles are the percentiles that the producer of a
+	// histogram asked for, if any.
+	Percentiles []float64
+	// TraceID is the ID of the trace that a histogram or timer
+	// sample was measured in, taken from its ExemplarTraceIDTag.
+	TraceID string
 }
 
 // MetricScope describes where the metric will be emitted.
@@ -99,12 +105,18 @@ func (m MetricKey) String() string {
 // error occurs in processing any of the metrics, ExtractMetrics
 // collects them into the error type InvalidMetrics and returns this
 // error alongside any valid metrics that could be parsed.
+//
+// Events contained in the message are not metrics, and are skipped;
+// use ConvertEvents to extract those.
 func ConvertMetrics(m *ssf.SSFSpan) ([]UDPMetric, error) {
 	samples := m.Metrics
 	metrics := make([]UDPMetric, 0, len(samples)+1)
 	invalid := []*ssf.SSFSample{}
 
 	for _, metricPacket := range samples {
+		if metricPacket.IsEvent() {
+			continue
+		}
 		metric, err := ParseMetricSSF(metricPacket)
 		if err != nil || !ValidMetric(metric) {
 			invalid = append(invalid, metricPacket)
@@ -118,6 +130,37 @@ func ConvertMetrics(m *ssf.SSFSpan) ([]UDPMetric, error) {
 	return metrics, nil
 }
 
+// ConvertEvents examines an SSF message and returns any events
+// contained in it, in the form that events parsed with ParseEvent
+// take: SSF timestamps (in nanoseconds) are converted to Unix
+// seconds, and events without a timestamp are timestamped with the
+// current time. Events without a title are invalid; they are
+// returned in an InvalidMetrics error alongside the valid events.
+func ConvertEvents(m *ssf.SSFSpan) ([]ssf.SSFSample, error) {
+	var events []ssf.SSFSample
+	invalid := []*ssf.SSFSample{}
+	for _, sample := range m.Metrics {
+		if !sample.IsEvent() {
+			continue
+		}
+		if sample.Name == "" {
+			invalid = append(invalid, sample)
+			continue
+		}
+		event := *sample
+		if event.Timestamp == 0 {
+			event.Timestamp = time.Now().Unix()
+		} else {
+			event.Timestamp = time.Unix(0, event.Timestamp).Unix()
+		}
+		events = append(events, event)
+	}
+	if len(invalid) != 0 {
+		return events, &invalidMetrics{invalid}
+	}
+	return events, nil
+}
+
 // ConvertIndicatorMetrics takes a span that may be an "indicator"
 // span and returns metrics that can be determined from that
 // span. Currently, it converts the span to a timer metric for the
@@ -218,6 +261,13 @@ func ParseMetricSSF(metric *ssf.SSFSample) (UDPMetric, error) {
 		ret.Type = "gauge"
 	case ssf.SSFSample_HISTOGRAM:
 		ret.Type = "histogram"
+		ret.Percentiles = metric.Percentiles
+	case ssf.SSFSample_DISTRIBUTION:
+		// Distributions are histograms that are only ever
+		// aggregated globally.
+		ret.Type = "histogram"
+		ret.Scope = GlobalOnly
+		ret.Percentiles = metric.Percentiles
 	case ssf.SSFSample_SET:
 		ret.Type = "set"
 	case ssf.SSFSample_STATUS:
@@ -225,16 +275,30 @@ func ParseMetricSSF(metric *ssf.SSFSample) (UDPMetric, error) {
 	default:
 		return UDPMetric{}, invalidMetricTypeError
 	}
+	for _, p := range ret.Percentiles {
+		if !(p > 0 && p < 1) {
+			return UDPMetric{}, fmt.Errorf("Invalid percentile %v requested, must be >0 and <1", p)
+		}
+	}
 	h = fnv1a.AddString32(h, ret.Type)
 	switch metric.Metric {
 	case ssf.SSFSample_SET:
 		ret.Value = metric.Message
 	case ssf.SSFSample_STATUS:
 		ret.Value = metric.Status
+		ret.Message = metric.Message
 	default:
 		ret.Value = float64(metric.Value)
+		if metric.DoubleValue != 0 {
+			ret.Value = metric.DoubleValue
+		}
 	}
 	ret.SampleRate = metric.SampleRate
+	if metric.Timestamp != 0 {
+		// SSF timestamps are in nanoseconds, but metrics are
+		// timestamped with second resolution:
+		ret.Timestamp = time.Unix(0, metric.Timestamp).Unix()
+	}
 	tempTags := make([]string, 0, len(metric.Tags))
 	for key, value := range metric.Tags {
 		if key == "veneurlocalonly" {
@@ -245,8 +309,20 @@ func ParseMetricSSF(metric *ssf.SSFSample) (UDPMetric, error) {
 			ret.Scope = GlobalOnly
 			continue
 		}
+		if key == ExemplarTraceIDTag && ret.Type == "histogram" {
+			ret.TraceID = value
+			continue
+		}
 		tempTags = append(tempTags, key+":"+value)
 	}
+	// An explicit scope on the sample takes precedence over the
+	// scope implied by its type or tags:
+	switch metric.Scope {
+	case ssf.SSFSample_LOCAL:
+		ret.Scope = LocalOnly
+	case ssf.SSFSample_GLOBAL:
+		ret.Scope = GlobalOnly
+	}
 	sort.Strings(tempTags)
 	ret.Tags = tempTags
 	ret.JoinedTags = strings.Join(tempTags, ",")
@@ -257,7 +333,27 @@ func ParseMetricSSF(metric *ssf.SSFSample) (UDPMetric, error) {
 
 // ParseMetric converts the incoming packet from Datadog DogStatsD
 // Datagram format in to a Metric. http://docs.datadoghq.com/guides/dogstatsd/#datagram-format
+//
+// Packets with several values are rejected; use ParseMetrics to parse
+// them.
 func ParseMetric(packet []byte) (*UDPMetric, error) {
+	metrics, err := ParseMetrics(packet, 1)
+	if err != nil {
+		return nil, err
+	}
+	return &metrics[0], nil
+}
+
+// ParseMetrics converts the incoming packet from Datadog DogStatsD
+// Datagram format in to Metrics, one for each of the packet's values.
+// Like DogStatsD, it accepts several colon-separated values in one
+// packet ("foo:1:2:3|h"), which share the packet's type, sample rate
+// and tags. The value of a set is never split, since set members may
+// contain colons.
+//
+// Packets with more than maxValues values are rejected before any of
+// their values are parsed. If maxValues is 0, there is no limit.
+func ParseMetrics(packet []byte, maxValues int) ([]UDPMetric, error) {
 	ret := &UDPMetric{
 		SampleRate: 1.0,
 	}
@@ -297,6 +393,9 @@ func ParseMetric(packet []byte) (*UDPMetric, error) {
 		ret.Type = "gauge"
 	case 'h':
 		ret.Type = "histogram"
+	case 'd': // distributions are histograms aggregated globally
+		ret.Type = "histogram"
+		ret.Scope = GlobalOnly
 	case 'm': // We can ignore the s in "ms"
 		ret.Type = "timer"
 	case 's':
@@ -307,15 +406,24 @@ func ParseMetric(packet []byte) (*UDPMetric, error) {
 	// Add the type to the digest
 	h = fnv1a.AddString32(h, ret.Type)
 
-	// Now convert the metric's value
+	// Now convert the metric's values
+	var values []interface{}
 	if ret.Type == "set" {
-		ret.Value = string(valueChunk)
+		values = []interface{}{string(valueChunk)}
 	} else {
-		v, err := strconv.ParseFloat(string(valueChunk), 64)
-		if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
-			return nil, fmt.Errorf("Invalid number for metric value: %s", valueChunk)
+		count := bytes.Count(valueChunk, []byte{':'}) + 1
+		if maxValues > 0 && count > maxValues {
+			return nil, fmt.Errorf("Invalid metric packet, %d values exceed the maximum of %d", count, maxValues)
+		}
+		values = make([]interface{}, 0, count)
+		colonSplitter := NewSplitBytes(valueChunk, ':')
+		for colonSplitter.Next() {
+			v, err := strconv.ParseFloat(string(colonSplitter.Chunk()), 64)
+			if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+				return nil, fmt.Errorf("Invalid number for metric value: %s", colonSplitter.Chunk())
+			}
+			values = append(values, v)
 		}
-		ret.Value = v
 	}
 
 	// each of these sections can only appear once in the packet
@@ -368,6 +476,9 @@ func ParseMetric(packet []byte) (*UDPMetric, error) {
 					break
 				}
 			}
+			if ret.Type == "histogram" || ret.Type == "timer" {
+				tags = extractTraceID(ret, tags)
+			}
 			ret.Tags = tags
 			// we specifically need the sorted version here so that hashing over
 			// tags behaves deterministically
@@ -381,7 +492,24 @@ func ParseMetric(packet []byte) (*UDPMetric, error) {
 
 	ret.Digest = h
 
-	return ret, nil
+	metrics := make([]UDPMetric, len(values))
+	for i, v := range values {
+		metrics[i] = *ret
+		metrics[i].Value = v
+	}
+	return metrics, nil
+}
+
+// extractTraceID removes the ExemplarTraceIDTag from tags, and records
+// its value as the metric's trace ID.
+func extractTraceID(m *UDPMetric, tags []string) []string {
+	for i, tag := range tags {
+		if strings.HasPrefix(tag, ExemplarTraceIDTag+":") {
+			m.TraceID = tag[len(ExemplarTraceIDTag)+1:]
+			return append(tags[:i], tags[i+1:]...)
+		}
+	}
+	return tags
 }
 
 // ParseEvent parses a DogStatsD event packet and returns an SSF sample or an
@@ -0,0 +1,120 @@
+package samplers
+
+import (
+	"container/heap"
+	"fmt"
+	"math"
+	"math/rand"
+	"path"
+	"sort"
+)
+
+// Reservoir is a bounded, weighted random sample of the raw values of a
+// histogram. It uses the A-Res algorithm of Efraimidis and Spirakis:
+// every value gets a random key that grows with its weight, and the
+// values with the highest keys are retained, so that the retained
+// values follow the distribution of the sampled ones, and a value
+// sampled at a rate of 0.1 is ten times as likely to be retained as one
+// sampled at a rate of 1.
+type Reservoir struct {
+	size  int
+	items reservoirItems
+	// Seen is the total weight of the values sampled into the
+	// reservoir.
+	Seen float64
+}
+
+type reservoirItem struct {
+	value float64
+	key   float64
+}
+
+// reservoirItems is a min-heap of items by key, so that the item with
+// the lowest key is the one replaced.
+type reservoirItems []reservoirItem
+
+func (r reservoirItems) Len() int            { return len(r) }
+func (r reservoirItems) Less(i, j int) bool  { return r[i].key < r[j].key }
+func (r reservoirItems) Swap(i, j int)       { r[i], r[j] = r[j], r[i] }
+func (r *reservoirItems) Push(x interface{}) { *r = append(*r, x.(reservoirItem)) }
+func (r *reservoirItems) Pop() interface{} {
+	old := *r
+	item := old[len(old)-1]
+	*r = old[:len(old)-1]
+	return item
+}
+
+// NewReservoir returns an empty reservoir that retains at most size
+// values.
+func NewReservoir(size int) *Reservoir {
+	return &Reservoir{size: size, items: make(reservoirItems, 0, size)}
+}
+
+// Sample offers a value with the given weight to the reservoir.
+// Values with a weight that isn't positive are ignored.
+func (r *Reservoir) Sample(value, weight float64) {
+	if weight <= 0 || r.size < 1 {
+		return
+	}
+	r.Seen += weight
+	// The key is u^(1/weight) for a uniform u in [0, 1); its
+	// logarithm orders the same, and doesn't underflow for large
+	// weights:
+	key := math.Log(rand.Float64()) / weight
+	if len(r.items) < r.size {
+		heap.Push(&r.items, reservoirItem{value: value, key: key})
+		return
+	}
+	if key > r.items[0].key {
+		r.items[0] = reservoirItem{value: value, key: key}
+		heap.Fix(&r.items, 0)
+	}
+}
+
+// Values returns the retained values, in ascending order.
+func (r *Reservoir) Values() []float64 {
+	values := make([]float64, len(r.items))
+	for i, item := range r.items {
+		values[i] = item.value
+	}
+	sort.Float64s(values)
+	return values
+}
+
+// ReservoirSize sets the size of the reservoirs of the histograms whose
+// names match Pattern, a pattern in the syntax of path.Match.
+type ReservoirSize struct {
+	Pattern string
+	Size    int
+}
+
+// HistogramReservoirs decides which new histograms keep a reservoir of
+// their raw values, by their name: the first ReservoirSize whose
+// pattern matches the name applies, and histograms that none matches
+// keep no reservoir.
+type HistogramReservoirs []ReservoirSize
+
+// Validate checks that all the sizes are positive and that all the
+// patterns are well-formed.
+func (hr HistogramReservoirs) Validate() error {
+	for _, rs := range hr {
+		if rs.Size < 1 {
+			return fmt.Errorf("histogram reservoir size %d for %q must be positive", rs.Size, rs.Pattern)
+		}
+		if _, err := path.Match(rs.Pattern, ""); err != nil {
+			return fmt.Errorf("invalid histogram reservoir pattern %q: %v", rs.Pattern, err)
+		}
+	}
+	return nil
+}
+
+// ForName returns the size of the reservoir of new histograms named
+// name, or 0 if they keep none.
+func (hr HistogramReservoirs) ForName(name string) int {
+	for _, rs := range hr {
+		if ok, _ := path.Match(rs.Pattern, name); ok {
+			return rs.Size
+		}
+	}
+	return 0
+}
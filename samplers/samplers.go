@@ -5,6 +5,10 @@ import (
 	"encoding/binary"
 	"fmt"
 	"math"
+	"math/bits"
+	"path"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -58,6 +62,29 @@ type InterMetric struct {
 	// should be inserted into. If nil, that means the metric is
 	// meant to go to every sink.
 	Sinks RouteInformation
+
+	// Exemplars are example samples of the histogram that the metric
+	// was flushed from, for sinks that can link a metric to traces.
+	Exemplars []Exemplar
+}
+
+// ExemplarTraceIDTag is the tag that makes a histogram or timer sample
+// an exemplar: the tag is removed from the sample, and its value is
+// kept as the ID of the trace that the sample was measured in.
+const ExemplarTraceIDTag = "trace_id"
+
+// DefaultMaxExemplars is the number of exemplars that a histogram keeps
+// at most, unless configured otherwise.
+const DefaultMaxExemplars = 5
+
+// Exemplar is a sample of a histogram that links the histogram to the
+// trace that the sample was measured in.
+type Exemplar struct {
+	Value   float64
+	TraceID string
+	// Timestamp is when the sample was measured, in nanoseconds since
+	// the unix epoch.
+	Timestamp int64
 }
 
 type Aggregate int
@@ -85,6 +112,181 @@ var AggregatesLookup = map[string]Aggregate{
 type HistogramAggregates struct {
 	Value Aggregate
 	Count int
+	// PercentileNaming decides the names of the percentile metrics
+	// that histograms flush alongside their aggregates.
+	PercentileNaming PercentileNaming
+	// Overrides replace the aggregates and percentiles of the
+	// histograms and timers that they match, by name.
+	Overrides []AggregatesOverride
+}
+
+// AggregatesOverride sets the aggregates and percentiles that the
+// histograms and timers whose names match Pattern, a pattern in the
+// syntax of path.Match, flush instead of the configured ones.
+type AggregatesOverride struct {
+	Pattern     string
+	Aggregates  Aggregate
+	Percentiles []float64
+}
+
+// ParseAggregates converts names of aggregates, like "count", and of
+// percentiles, like "p99", "p99_9" or "99percentile", into the
+// aggregates and the percentiles (as fractions between 0 and 1) that
+// they name.
+func ParseAggregates(names []string) (Aggregate, []float64, error) {
+	var value Aggregate
+	var percentiles []float64
+	for _, name := range names {
+		if agg, ok := AggregatesLookup[name]; ok {
+			value |= agg
+			continue
+		}
+		percent := name
+		if strings.HasPrefix(percent, "p") {
+			percent = strings.TrimPrefix(percent, "p")
+		} else {
+			percent = strings.TrimSuffix(percent, "percentile")
+		}
+		p, err := strconv.ParseFloat(strings.Replace(percent, "_", ".", 1), 64)
+		if err != nil || percent == name {
+			return 0, nil, fmt.Errorf("unknown aggregate %q", name)
+		}
+		percentiles = append(percentiles, p/100)
+	}
+	if err := ValidatePercentiles(percentiles); err != nil {
+		return 0, nil, err
+	}
+	return value, percentiles, nil
+}
+
+// Validate checks that all the override patterns are well-formed and
+// that their percentiles are valid.
+func (a HistogramAggregates) Validate() error {
+	for _, o := range a.Overrides {
+		if _, err := path.Match(o.Pattern, ""); err != nil {
+			return fmt.Errorf("invalid histogram aggregates pattern %q: %v", o.Pattern, err)
+		}
+		if err := ValidatePercentiles(o.Percentiles); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ForName returns the aggregates and the percentiles that the histogram
+// or timer named name flushes. The first override whose pattern matches
+// the name applies; names not matched by any override flush these
+// aggregates and the given percentiles.
+func (a HistogramAggregates) ForName(name string, percentiles []float64) (HistogramAggregates, []float64) {
+	for _, o := range a.Overrides {
+		if ok, _ := path.Match(o.Pattern, name); ok {
+			return HistogramAggregates{
+				Value:            o.Aggregates,
+				Count:            bits.OnesCount(uint(o.Aggregates)),
+				PercentileNaming: a.PercentileNaming,
+			}, o.Percentiles
+		}
+	}
+	return a, percentiles
+}
+
+// PercentileNaming decides how the metrics that histograms flush for their
+// percentiles are named.
+type PercentileNaming int
+
+const (
+	// PercentileNamingLegacy suffixes percentiles like "99percentile", and
+	// fractional percentiles like "99_9percentile".
+	PercentileNamingLegacy PercentileNaming = iota
+	// PercentileNamingShort suffixes percentiles like "p99" and "p99_9".
+	PercentileNamingShort
+)
+
+// ParsePercentileNaming converts a configuration setting of "percentile" (or
+// an empty string) or "p" into a PercentileNaming.
+func ParsePercentileNaming(setting string) (PercentileNaming, error) {
+	switch setting {
+	case "", "percentile":
+		return PercentileNamingLegacy, nil
+	case "p":
+		return PercentileNamingShort, nil
+	}
+	return PercentileNamingLegacy, fmt.Errorf("unknown percentile naming %q, must be percentile or p", setting)
+}
+
+// Suffix returns the suffix of the metric name for the percentile p, which is
+// given as a fraction between 0 and 1. The percentage is written with as many
+// digits as it needs, up to six decimal places, and with an underscore for
+// its decimal point, so that 0.999 is "99_9percentile" or "p99_9".
+func (n PercentileNaming) Suffix(p float64) string {
+	percent := strconv.FormatFloat(math.Round(p*100*1e6)/1e6, 'f', -1, 64)
+	percent = strings.Replace(percent, ".", "_", 1)
+	if n == PercentileNamingShort {
+		return "p" + percent
+	}
+	return percent + "percentile"
+}
+
+// DigestEncoding decides how histograms and timers encode their
+// t-digests when they are exported for forwarding over HTTP. Veneurs
+// decode either encoding.
+type DigestEncoding int
+
+const (
+	// DigestEncodingGob encodes t-digests with encoding/gob, which all
+	// veneurs can decode.
+	DigestEncodingGob DigestEncoding = iota
+	// DigestEncodingBinary encodes t-digests in the versioned binary
+	// format of tdigest.MergingDigest.MarshalBinary, which keeps their
+	// total weight exactly.
+	DigestEncodingBinary
+)
+
+// ParseDigestEncoding converts a configuration setting of "gob" (or an
+// empty string) or "binary" into a DigestEncoding.
+func ParseDigestEncoding(setting string) (DigestEncoding, error) {
+	switch setting {
+	case "", "gob":
+		return DigestEncodingGob, nil
+	case "binary":
+		return DigestEncodingBinary, nil
+	}
+	return DigestEncodingGob, fmt.Errorf("unknown digest encoding %q, must be gob or binary", setting)
+}
+
+// ParsePercentileSuffix returns the percentile, as a fraction between 0 and
+// 1, that suffix names under either PercentileNaming. ok is false if suffix
+// doesn't name a percentile.
+func ParsePercentileSuffix(suffix string) (p float64, ok bool) {
+	var percent string
+	switch {
+	case strings.HasSuffix(suffix, "percentile"):
+		percent = strings.TrimSuffix(suffix, "percentile")
+	case strings.HasPrefix(suffix, "p"):
+		percent = strings.TrimPrefix(suffix, "p")
+	default:
+		return 0, false
+	}
+	if percent == "" || strings.Count(percent, "_") > 1 ||
+		strings.IndexFunc(percent, func(r rune) bool { return (r < '0' || r > '9') && r != '_' }) >= 0 {
+		return 0, false
+	}
+	value, err := strconv.ParseFloat(strings.Replace(percent, "_", ".", 1), 64)
+	if err != nil || value <= 0 || value >= 100 {
+		return 0, false
+	}
+	return value / 100, true
+}
+
+// ValidatePercentiles returns an error if any of percentiles is not strictly
+// between 0 and 1.
+func ValidatePercentiles(percentiles []float64) error {
+	for _, p := range percentiles {
+		if !(p > 0 && p < 1) {
+			return fmt.Errorf("invalid percentile %v, must be between 0 and 1 exclusive", p)
+		}
+	}
+	return nil
 }
 
 var aggregates = [...]string{
@@ -107,6 +309,58 @@ type JSONMetric struct {
 	Value []byte `json:"value"`
 }
 
+// Metric converts a JSONMetric into a protobuf-compatible
+// metricpb.Metric with the same contents, so that metrics received
+// over HTTP can be forwarded over gRPC.
+func (jm JSONMetric) Metric() (*metricpb.Metric, error) {
+	m := &metricpb.Metric{
+		Name: jm.Name,
+		Tags: jm.Tags,
+	}
+	switch jm.Type {
+	case "counter":
+		var value int64
+		if err := binary.Read(bytes.NewReader(jm.Value), binary.LittleEndian, &value); err != nil {
+			return nil, fmt.Errorf("failed to decode the counter: %v", err)
+		}
+		m.Type = metricpb.Type_Counter
+		m.Scope = metricpb.Scope_Global
+		m.Value = &metricpb.Metric_Counter{Counter: &metricpb.CounterValue{Value: value}}
+	case "gauge":
+		var value float64
+		buf := bytes.NewReader(jm.Value)
+		if err := binary.Read(buf, binary.LittleEndian, &value); err != nil {
+			return nil, fmt.Errorf("failed to decode the gauge: %v", err)
+		}
+		var timestamp int64
+		if buf.Len() > 0 {
+			if err := binary.Read(buf, binary.LittleEndian, &timestamp); err != nil {
+				return nil, fmt.Errorf("failed to decode the gauge's timestamp: %v", err)
+			}
+		}
+		m.Type = metricpb.Type_Gauge
+		m.Scope = metricpb.Scope_Global
+		m.Value = &metricpb.Metric_Gauge{Gauge: &metricpb.GaugeValue{Value: value, Timestamp: timestamp}}
+	case "set":
+		// the HyperLogLog is encoded the same way in both formats
+		m.Type = metricpb.Type_Set
+		m.Value = &metricpb.Metric_Set{Set: &metricpb.SetValue{HyperLogLog: jm.Value}}
+	case "histogram", "timer":
+		td, err := tdigest.Decode(jm.Value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode the t-digest: %v", err)
+		}
+		m.Type = metricpb.Type_Histogram
+		if jm.Type == "timer" {
+			m.Type = metricpb.Type_Timer
+		}
+		m.Value = &metricpb.Metric_Histogram{Histogram: &metricpb.HistogramValue{TDigest: td.Data()}}
+	default:
+		return nil, fmt.Errorf("can not convert a metric of type %q", jm.Type)
+	}
+	return m, nil
+}
+
 const sinkPrefix string = "veneursinkonly:"
 
 func routeInfo(tags []string) RouteInformation {
@@ -126,11 +380,17 @@ func routeInfo(tags []string) RouteInformation {
 	return info
 }
 
-// Counter is an accumulator
+// Counter is an accumulator. It counts whole increments exactly, up to
+// the limits of an int64, at which it saturates instead of wrapping
+// around.
 type Counter struct {
 	Name  string
 	Tags  []string
 	value int64
+	// fraction holds the fractional part of the increments, which
+	// sample rates like 0.3 leave behind, until they add up to whole
+	// ones.
+	fraction float64
 }
 
 // GetName returns the name of the counter.
@@ -140,7 +400,41 @@ func (c *Counter) GetName() string {
 
 // Sample adds a sample to the counter.
 func (c *Counter) Sample(sample float64, sampleRate float32) {
-	c.value += int64(sample) * int64(1/sampleRate)
+	increment := sample*float64(1/sampleRate) + c.fraction
+	whole := math.Trunc(increment)
+	c.fraction = increment - whole
+	switch {
+	case whole >= math.MaxInt64:
+		c.value = math.MaxInt64
+	case whole <= math.MinInt64:
+		c.value = math.MinInt64
+	default:
+		c.value = addSaturating(c.value, int64(whole))
+	}
+}
+
+// total returns the value of the counter, with its fractional
+// increments rounded to the nearest whole one.
+func (c *Counter) total() int64 {
+	return addSaturating(c.value, int64(math.Round(c.fraction)))
+}
+
+// Value returns the value of the counter so far.
+func (c *Counter) Value() int64 {
+	return c.total()
+}
+
+// addSaturating returns a+b, or the int64 closest to it if it
+// overflows.
+func addSaturating(a, b int64) int64 {
+	sum := a + b
+	switch {
+	case b > 0 && sum < a:
+		return math.MaxInt64
+	case b < 0 && sum > a:
+		return math.MinInt64
+	}
+	return sum
 }
 
 // Flush generates an InterMetric from the current state of this Counter.
@@ -150,18 +444,63 @@ func (c *Counter) Flush(interval time.Duration) []InterMetric {
 	return []InterMetric{{
 		Name:      c.Name,
 		Timestamp: time.Now().Unix(),
-		Value:     float64(c.value),
+		Value:     float64(c.total()),
 		Tags:      tags,
 		Type:      CounterMetric,
 		Sinks:     routeInfo(tags),
 	}}
 }
 
+// CounterRates decides whether counters are flushed as the totals of
+// their increments in a flush interval, as per-second rates, or both.
+type CounterRates int
+
+const (
+	// CounterRatesNone flushes only totals.
+	CounterRatesNone CounterRates = iota
+	// CounterRatesAlongside flushes both totals and rates.
+	CounterRatesAlongside
+	// CounterRatesInstead flushes only rates.
+	CounterRatesInstead
+)
+
+// ParseCounterRates converts a configuration setting of "none",
+// "alongside" or "instead" (or an empty string, meaning "none") into a
+// CounterRates.
+func ParseCounterRates(setting string) (CounterRates, error) {
+	switch setting {
+	case "", "none":
+		return CounterRatesNone, nil
+	case "alongside":
+		return CounterRatesAlongside, nil
+	case "instead":
+		return CounterRatesInstead, nil
+	}
+	return CounterRatesNone, fmt.Errorf("unknown counter rate setting %q, must be none, alongside or instead", setting)
+}
+
+// FlushRate generates an InterMetric holding the per-second rate of
+// the counter's increments over the elapsed time. The metric is named
+// after the counter with a ".rate" suffix, and is a gauge, so that
+// sinks report it as is.
+func (c *Counter) FlushRate(elapsed time.Duration) []InterMetric {
+	tags := make([]string, len(c.Tags))
+	copy(tags, c.Tags)
+	return []InterMetric{{
+		Name:      fmt.Sprintf("%s.rate", c.Name),
+		Timestamp: time.Now().Unix(),
+		Value:     float64(c.total()) / elapsed.Seconds(),
+		Tags:      tags,
+		Type:      GaugeMetric,
+		Sinks:     routeInfo(tags),
+	}}
+}
+
 // Export converts a Counter into a JSONMetric which reports the rate.
 func (c *Counter) Export() (JSONMetric, error) {
 	buf := new(bytes.Buffer)
 
-	err := binary.Write(buf, binary.LittleEndian, c.value)
+	err := binary.Write(buf, binary.LittleEndian, c.total())
 	if err != nil {
 		return JSONMetric{}, err
 	}
@@ -187,7 +526,7 @@ func (c *Counter) Combine(other []byte) error {
 		return err
 	}
 
-	c.value += otherCounts
+	c.value = addSaturating(c.value, otherCounts)
 
 	return nil
 }
@@ -200,13 +539,13 @@ func (c *Counter) Metric() (*metricpb.Metric, error) {
 		Name:  c.Name,
 		Tags:  c.Tags,
 		Type:  metricpb.Type_Counter,
-		Value: &metricpb.Metric_Counter{&metricpb.CounterValue{Value: c.value}},
+		Value: &metricpb.Metric_Counter{&metricpb.CounterValue{Value: c.total()}},
 	}, nil
 }
 
 // Merge adds the value from the input CounterValue to this one.
 func (c *Counter) Merge(v *metricpb.CounterValue) {
-	c.value += v.Value
+	c.value = addSaturating(c.value, v.Value)
 }
 
 // NewCounter generates and returns a new Counter.
@@ -219,20 +558,50 @@ type Gauge struct {
 	Name  string
 	Tags  []string
 	value float64
+	// timestamp is the time (in Unix seconds) that the current
+	// value was recorded at, or 0 if it is not known.
+	timestamp int64
 }
 
 // Sample takes on whatever value is passed in as a sample.
 func (g *Gauge) Sample(sample float64, sampleRate float32) {
+	g.SampleAt(sample, sampleRate, 0)
+}
+
+// SampleAt takes on whatever value is passed in as a sample, like
+// Sample, and records the time (in Unix seconds) that the value was
+// observed at. The gauge is flushed with that timestamp; a zero
+// timestamp means the time is unknown, and the gauge is flushed with
+// the time of the flush instead.
+//
+// Samples can arrive out of order, so if both the gauge's current
+// value and the new sample have a timestamp, the sample is ignored if
+// it is older than the current value. Otherwise, the latest sample to
+// arrive wins.
+func (g *Gauge) SampleAt(sample float64, sampleRate float32, timestamp int64) {
+	if timestamp != 0 && g.timestamp != 0 && timestamp < g.timestamp {
+		return
+	}
 	g.value = sample
+	g.timestamp = timestamp
+}
+
+// Value returns the gauge's current value.
+func (g *Gauge) Value() float64 {
+	return g.value
 }
 
 // Flush generates an InterMetric from the current state of this gauge.
 func (g *Gauge) Flush() []InterMetric {
 	tags := make([]string, len(g.Tags))
 	copy(tags, g.Tags)
+	ts := g.timestamp
+	if ts == 0 {
+		ts = time.Now().Unix()
+	}
 	return []InterMetric{{
 		Name:      g.Name,
-		Timestamp: time.Now().Unix(),
+		Timestamp: ts,
 		Value:     float64(g.value),
 		Tags:      tags,
 		Type:      GaugeMetric,
@@ -241,7 +610,8 @@ func (g *Gauge) Flush() []InterMetric {
 
 }
 
-// Export converts a Gauge into a JSONMetric.
+// Export converts a Gauge into a JSONMetric. Its value is followed by
+// its timestamp, if it has one.
 func (g *Gauge) Export() (JSONMetric, error) {
 	var buf bytes.Buffer
 
@@ -249,6 +619,12 @@ func (g *Gauge) Export() (JSONMetric, error) {
 	if err != nil {
 		return JSONMetric{}, err
 	}
+	if g.timestamp != 0 {
+		err = binary.Write(&buf, binary.LittleEndian, g.timestamp)
+		if err != nil {
+			return JSONMetric{}, err
+		}
+	}
 
 	return JSONMetric{
 		MetricKey: MetricKey{
@@ -261,7 +637,9 @@ func (g *Gauge) Export() (JSONMetric, error) {
 	}, nil
 }
 
-// Combine is pretty naïve for Gauges, as it just overwrites the value.
+// Combine is pretty naïve for Gauges, as it just overwrites the value,
+// unless both gauges have timestamps and the other value is older, like
+// SampleAt.
 func (g *Gauge) Combine(other []byte) error {
 	var otherValue float64
 	buf := bytes.NewReader(other)
@@ -271,7 +649,16 @@ func (g *Gauge) Combine(other []byte) error {
 		return err
 	}
 
-	g.value = otherValue
+	// gauges exported without a timestamp end here:
+	var otherTimestamp int64
+	if buf.Len() > 0 {
+		err = binary.Read(buf, binary.LittleEndian, &otherTimestamp)
+		if err != nil {
+			return err
+		}
+	}
+
+	g.SampleAt(otherValue, 1.0, otherTimestamp)
 
 	return nil
 }
@@ -289,13 +676,14 @@ func (g *Gauge) Metric() (*metricpb.Metric, error) {
 		Name:  g.Name,
 		Tags:  g.Tags,
 		Type:  metricpb.Type_Gauge,
-		Value: &metricpb.Metric_Gauge{&metricpb.GaugeValue{Value: g.value}},
+		Value: &metricpb.Metric_Gauge{&metricpb.GaugeValue{Value: g.value, Timestamp: g.timestamp}},
 	}, nil
 }
 
-// Merge sets the value of this Gauge to the value of the other.
+// Merge sets the value of this Gauge to the value of the other, unless
+// both have timestamps and the other value is older, like SampleAt.
 func (g *Gauge) Merge(v *metricpb.GaugeValue) {
-	g.value = v.Value
+	g.SampleAt(v.Value, 1.0, v.Timestamp)
 }
 
 // NewGauge generates an empty (valueless) Gauge
@@ -376,11 +764,45 @@ func (s *Set) Sample(sample string, sampleRate float32) {
 	s.Hll.Insert([]byte(sample))
 }
 
-// NewSet generates a new Set and returns it
+// DefaultSetPrecision is the precision of the HyperLogLog sketches
+// backing sets unless configured otherwise.
+const DefaultSetPrecision = 14
+
+// ValidateSetPrecision returns an error if sets can not be created
+// with the given HyperLogLog precision. While the algorithm supports
+// precisions from 4 to 18, the implementation we use only supports 14
+// and 16.
+//
+// A sketch with precision p has 2^p registers: Its standard error is
+// about 1.04/sqrt(2^p) (0.81% at precision 14 and 0.41% at 16), and
+// once a set has seen enough unique values to leave the sparse
+// representation, it takes up 2^p/2 bytes (8KiB at precision 14 and
+// 32KiB at 16). Small sets use much less memory at either precision.
+func ValidateSetPrecision(precision int) error {
+	switch precision {
+	case 14, 16:
+		return nil
+	}
+	return fmt.Errorf("unsupported set precision %d, must be 14 or 16", precision)
+}
+
+// NewSet generates a new Set with the default precision and returns
+// it.
 func NewSet(Name string, Tags []string) *Set {
-	// error is only returned if precision is outside the 4-18 range
-	// TODO: this is the maximum precision, should it be configurable?
-	Hll := hyperloglog.New()
+	return NewSetWithPrecision(Name, Tags, DefaultSetPrecision)
+}
+
+// NewSetWithPrecision generates a new Set whose HyperLogLog sketch has
+// the given precision and returns it. Precisions not accepted by
+// ValidateSetPrecision result in a Set with the default precision.
+//
+// Sets can only be combined with sets of the same precision, unless
+// they are empty; see Combine.
+func NewSetWithPrecision(Name string, Tags []string, precision int) *Set {
+	Hll := hyperloglog.New14()
+	if precision == 16 {
+		Hll = hyperloglog.New16()
+	}
 	return &Set{
 		Name: Name,
 		Tags: Tags,
@@ -420,20 +842,57 @@ func (s *Set) Export() (JSONMetric, error) {
 }
 
 // Combine merges the values seen with another set (marshalled as a byte slice)
+//
+// Sketches of different precisions can't be merged, so a set that hasn't
+// seen any values yet takes on the precision of the first sketch combined
+// into it. This way, a global veneur can aggregate sets from local veneurs
+// with another set_precision, as long as they all agree.
 func (s *Set) Combine(other []byte) error {
-	otherHLL := hyperloglog.New()
-	if err := otherHLL.UnmarshalBinary(other); err != nil {
+	otherHLL, err := decodeHLL(other)
+	if err != nil {
 		return err
 	}
 	if err := s.Hll.Merge(otherHLL); err != nil {
-		// does not error unless compressions are different
-		// however, decoding the other Hll causes us to use its compression
-		// parameter, which might be different from ours
-		return err
+		// does not error unless precisions are different
+		if s.Hll.Estimate() != 0 {
+			return err
+		}
+		s.Hll = otherHLL
 	}
 	return nil
 }
 
+// hllVersion is the version of the HyperLogLog encoding that sets can
+// decode. It is the first byte of the encoding.
+const hllVersion = 1
+
+// decodeHLL decodes a HyperLogLog sketch encoded by another veneur's
+// set. Unlike the sketch's own UnmarshalBinary, it returns an error
+// rather than panicking if the encoding is truncated or corrupt, or of a
+// version or precision that it doesn't know.
+func decodeHLL(b []byte) (hll *hyperloglog.Sketch, err error) {
+	// version, precision, register base, sparseness and a size
+	if len(b) < 8 {
+		return nil, fmt.Errorf("HyperLogLog encoding of %d bytes is truncated", len(b))
+	}
+	if b[0] != hllVersion {
+		return nil, fmt.Errorf("unsupported HyperLogLog encoding version %d", b[0])
+	}
+	if err := ValidateSetPrecision(int(b[1])); err != nil {
+		return nil, err
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			hll, err = nil, fmt.Errorf("corrupt HyperLogLog encoding: %v", r)
+		}
+	}()
+	hll = hyperloglog.New()
+	if err := hll.UnmarshalBinary(b); err != nil {
+		return nil, err
+	}
+	return hll, nil
+}
+
 // GetName returns the name of the set.
 func (s *Set) GetName() string {
 	return s.Name
@@ -478,6 +937,16 @@ type Histo struct {
 	LocalMax           float64
 	LocalSum           float64
 	LocalReciprocalSum float64
+	// Percentiles are the percentiles requested by the producer of
+	// the histogram. If any are set, only those percentiles are
+	// flushed.
+	Percentiles []float64
+	// Exemplars are the samples with trace IDs that were sampled by
+	// this veneur instance and have the highest values.
+	Exemplars []Exemplar
+	// Reservoir, if set, retains a sample of the raw values that were
+	// sampled by this veneur instance, for debugging.
+	Reservoir *Reservoir
 }
 
 // Sample adds the supplied value to the histogram.
@@ -491,25 +960,160 @@ func (h *Histo) Sample(sample float64, sampleRate float32) {
 	h.LocalSum += sample * weight
 
 	h.LocalReciprocalSum += (1 / sample) * weight
+
+	if h.Reservoir != nil {
+		h.Reservoir.Sample(sample, weight)
+	}
+}
+
+// AddExemplar records a sample with a trace ID as an exemplar of the
+// histogram. The histogram keeps at most max exemplars (or
+// DefaultMaxExemplars, if max is not positive): those with the highest
+// values, since examples of the tail latency are the most useful ones.
+func (h *Histo) AddExemplar(e Exemplar, max int) {
+	if max < 1 {
+		max = DefaultMaxExemplars
+	}
+	if len(h.Exemplars) < max {
+		h.Exemplars = append(h.Exemplars, e)
+		return
+	}
+	lowest := 0
+	for i := range h.Exemplars {
+		if h.Exemplars[i].Value < h.Exemplars[lowest].Value {
+			lowest = i
+		}
+	}
+	if e.Value > h.Exemplars[lowest].Value {
+		h.Exemplars[lowest] = e
+	}
 }
 
-// NewHist generates a new Histo and returns it.
+// DefaultHistogramCompression is the compression of the t-digests
+// backing histograms unless configured otherwise. We're going to
+// allocate a lot of these, so we don't want them to be huge.
+const DefaultHistogramCompression = 100
+
+// NewHist generates a new Histo with the default compression and
+// returns it.
 func NewHist(Name string, Tags []string) *Histo {
+	return NewHistWithCompression(Name, Tags, DefaultHistogramCompression)
+}
+
+// NewHistWithCompression generates a new Histo whose t-digest uses
+// the given compression and returns it. A t-digest with a higher
+// compression holds more centroids, so it takes up more memory (and
+// more space when forwarded), but its percentiles are more accurate.
+func NewHistWithCompression(Name string, Tags []string, compression float64) *Histo {
 	return &Histo{
-		Name: Name,
-		Tags: Tags,
-		// we're going to allocate a lot of these, so we don't want them to be huge
-		Value:    tdigest.NewMerging(100, false),
+		Name:     Name,
+		Tags:     Tags,
+		Value:    tdigest.NewMerging(compression, false),
 		LocalMin: math.Inf(+1),
 		LocalMax: math.Inf(-1),
 		LocalSum: 0,
 	}
 }
 
+// CompressionOverride sets the compression of the histograms whose
+// names match Pattern, a pattern in the syntax of path.Match.
+type CompressionOverride struct {
+	Pattern     string
+	Compression float64
+}
+
+// HistogramCompression decides the compression of new histograms by
+// their name: the first override whose pattern matches the name
+// applies, and histograms not matched by any override get the
+// Default compression.
+type HistogramCompression struct {
+	Default   float64
+	Overrides []CompressionOverride
+}
+
+// Validate checks that all the compressions are positive and that all
+// the patterns are well-formed.
+func (hc *HistogramCompression) Validate() error {
+	if hc.Default < 0 {
+		return fmt.Errorf("histogram compression %v must be positive", hc.Default)
+	}
+	for _, o := range hc.Overrides {
+		if o.Compression <= 0 {
+			return fmt.Errorf("histogram compression %v for %q must be positive", o.Compression, o.Pattern)
+		}
+		if _, err := path.Match(o.Pattern, ""); err != nil {
+			return fmt.Errorf("invalid histogram compression pattern %q: %v", o.Pattern, err)
+		}
+	}
+	return nil
+}
+
+// ForName returns the compression for new histograms named name. A
+// nil *HistogramCompression, or one with a zero Default, uses
+// DefaultHistogramCompression for histograms not matched by any
+// override.
+func (hc *HistogramCompression) ForName(name string) float64 {
+	if hc == nil {
+		return DefaultHistogramCompression
+	}
+	for _, o := range hc.Overrides {
+		if ok, _ := path.Match(o.Pattern, name); ok {
+			return o.Compression
+		}
+	}
+	if hc.Default == 0 {
+		return DefaultHistogramCompression
+	}
+	return hc.Default
+}
+
+// RequestPercentiles records the percentiles that the producer of the
+// histogram is interested in. Calling it with no percentiles leaves
+// any previously requested percentiles in place.
+func (h *Histo) RequestPercentiles(percentiles []float64) {
+	if len(percentiles) > 0 {
+		h.Percentiles = percentiles
+	}
+}
+
+// sortedExemplars returns a copy of the histogram's exemplars, from the
+// highest value to the lowest.
+func (h *Histo) sortedExemplars() []Exemplar {
+	if len(h.Exemplars) == 0 {
+		return nil
+	}
+	exemplars := append([]Exemplar(nil), h.Exemplars...)
+	sort.Slice(exemplars, func(i, j int) bool {
+		return exemplars[i].Value > exemplars[j].Value
+	})
+	return exemplars
+}
+
+// requestedPercentiles returns those of percentiles that were
+// requested for the histogram, or all of them if none were requested.
+func (h *Histo) requestedPercentiles(percentiles []float64) []float64 {
+	if len(h.Percentiles) == 0 {
+		return percentiles
+	}
+	requested := make([]float64, 0, len(percentiles))
+	for _, p := range percentiles {
+		for _, rp := range h.Percentiles {
+			if p == rp {
+				requested = append(requested, p)
+				break
+			}
+		}
+	}
+	return requested
+}
+
 // Flush generates InterMetrics for the current state of the Histo. percentiles
-// indicates what percentiles should be exported from the histogram.
+// indicates what percentiles should be exported from the histogram; if the
+// histogram's producer requested specific percentiles, only those of them are
+// exported.
 func (h *Histo) Flush(interval time.Duration, percentiles []float64, aggregates HistogramAggregates, global bool) []InterMetric {
 	now := time.Now().Unix()
+	percentiles = h.requestedPercentiles(percentiles)
 	metrics := make([]InterMetric, 0, aggregates.Count+len(percentiles))
 	sinks := routeInfo(h.Tags)
 
@@ -544,6 +1148,9 @@ func (h *Histo) Flush(interval time.Duration, percentiles []float64, aggregates
 			Tags:      tags,
 			Type:      GaugeMetric,
 			Sinks:     sinks,
+			// The exemplars with the highest values go
+			// along with the maximum:
+			Exemplars: h.sortedExemplars(),
 		})
 	}
 	if (aggregates.Value&AggregateMin) == AggregateMin && (!math.IsInf(h.LocalMin, 0) || global) {
@@ -659,9 +1266,8 @@ func (h *Histo) Flush(interval time.Duration, percentiles []float64, aggregates
 		copy(tags, h.Tags)
 		metrics = append(
 			metrics,
-			// TODO Fix to allow for p999, etc
 			InterMetric{
-				Name:      fmt.Sprintf("%s.%dpercentile", h.Name, int(p*100)),
+				Name:      fmt.Sprintf("%s.%s", h.Name, aggregates.PercentileNaming.Suffix(p)),
 				Timestamp: now,
 				Value:     float64(h.Value.Quantile(p)),
 				Tags:      tags,
@@ -674,9 +1280,55 @@ func (h *Histo) Flush(interval time.Duration, percentiles []float64, aggregates
 	return metrics
 }
 
+// FlushBuckets generates cumulative bucket counts for the current state of
+// the Histo, in the style of Prometheus histograms: for each of the upper
+// bounds, which must be sorted in ascending order, a counter named
+// "<name>.bucket" and tagged "le:<bound>" with the weight of the values less
+// than or equal to the bound, followed by one tagged "le:+Inf" with the total
+// weight. The counts are read from the histogram's t-digest, so they are exact
+// only as long as its centroids each hold a single distinct value.
+func (h *Histo) FlushBuckets(bounds []float64) []InterMetric {
+	total := h.Value.Count()
+	if len(bounds) == 0 || total == 0 {
+		return nil
+	}
+	now := time.Now().Unix()
+	sinks := routeInfo(h.Tags)
+	name := fmt.Sprintf("%s.bucket", h.Name)
+	metrics := make([]InterMetric, 0, len(bounds)+1)
+	bucket := func(le string, count float64) InterMetric {
+		tags := make([]string, len(h.Tags), len(h.Tags)+1)
+		copy(tags, h.Tags)
+		return InterMetric{
+			Name:      name,
+			Timestamp: now,
+			Value:     count,
+			Tags:      append(tags, "le:"+le),
+			Type:      CounterMetric,
+			Sinks:     sinks,
+		}
+	}
+	for _, b := range bounds {
+		metrics = append(metrics, bucket(strconv.FormatFloat(b, 'g', -1, 64), h.Value.CumulativeWeight(b)))
+	}
+	return append(metrics, bucket("+Inf", total))
+}
+
 // Export converts a Histogram into a JSONMetric
 func (h *Histo) Export() (JSONMetric, error) {
-	val, err := h.Value.GobEncode()
+	return h.ExportDigest(DigestEncodingGob)
+}
+
+// ExportDigest converts a Histogram into a JSONMetric, with its t-digest
+// in the given encoding.
+func (h *Histo) ExportDigest(encoding DigestEncoding) (JSONMetric, error) {
+	var val []byte
+	var err error
+	if encoding == DigestEncodingBinary {
+		val, err = h.Value.MarshalBinary()
+	} else {
+		val, err = h.Value.GobEncode()
+	}
 	if err != nil {
 		return JSONMetric{}, err
 	}
@@ -692,10 +1344,10 @@ func (h *Histo) Export() (JSONMetric, error) {
 }
 
 // Combine merges the values of a histogram with another histogram
-// (marshalled as a byte slice)
+// (marshalled as a byte slice, in either DigestEncoding)
 func (h *Histo) Combine(other []byte) error {
-	otherHistogram := tdigest.NewMerging(100, false)
-	if err := otherHistogram.GobDecode(other); err != nil {
+	otherHistogram, err := tdigest.Decode(other)
+	if err != nil {
 		return err
 	}
 	h.Value.Merge(otherHistogram)
@@ -716,15 +1368,36 @@ func (h *Histo) Metric() (*metricpb.Metric, error) {
 		Tags: h.Tags,
 		Type: metricpb.Type_Histogram,
 		Value: &metricpb.Metric_Histogram{&metricpb.HistogramValue{
-			TDigest: h.Value.Data(),
+			TDigest:     h.Value.Data(),
+			Percentiles: h.Percentiles,
 		}},
 	}, nil
 }
 
+// MergeHisto merges another Histo into this one: it merges their
+// t-digests, like Merge, and also combines the locally-tracked count,
+// sum, min and max, as if the other histogram's samples had been
+// added to this one. This is cheaper than re-sampling the other
+// histogram's values, and its percentiles stay within the t-digest's
+// error bounds.
+//
+// To merge histograms across veneur instances, serialize them with
+// Metric or Export, and merge them with Merge or Combine.
+func (h *Histo) MergeHisto(other *Histo) {
+	h.Value.Merge(other.Value)
+	h.LocalWeight += other.LocalWeight
+	h.LocalMin = math.Min(h.LocalMin, other.LocalMin)
+	h.LocalMax = math.Max(h.LocalMax, other.LocalMax)
+	h.LocalSum += other.LocalSum
+	h.LocalReciprocalSum += other.LocalReciprocalSum
+	h.RequestPercentiles(other.Percentiles)
+}
+
 // Merge merges the t-digests of the two histograms and mutates the state
 // of this one.
 func (h *Histo) Merge(v *metricpb.HistogramValue) {
 	if v.TDigest != nil {
 		h.Value.Merge(tdigest.NewMergingFromData(v.TDigest))
 	}
+	h.RequestPercentiles(v.Percentiles)
 }
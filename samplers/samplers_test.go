@@ -7,9 +7,11 @@ import (
 	"testing"
 	"time"
 
+	"github.com/stripe/veneur/samplers/metricpb"
 	"github.com/stripe/veneur/tdigest"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/stripe/veneur/ssf"
 )
 
@@ -84,6 +86,51 @@ func TestCounterSampleRate(t *testing.T) {
 	assert.Equal(t, float64(10), metrics[0].Value, "Metric value")
 }
 
+func TestCounterExact(t *testing.T) {
+	c := NewCounter("a.b.c", []string{"a:b"})
+	for i := 0; i < 100000000; i++ {
+		c.Sample(1, 1.0)
+	}
+	metrics := c.Flush(10 * time.Second)
+	assert.Equal(t, float64(100000000), metrics[0].Value, "no increments should be lost")
+}
+
+func TestCounterFractionalSampleRate(t *testing.T) {
+	c := NewCounter("a.b.c", []string{"a:b"})
+	for i := 0; i < 3000; i++ {
+		c.Sample(1, 0.3)
+	}
+	assert.Equal(t, float64(10000), c.Flush(10 * time.Second)[0].Value)
+
+	c = NewCounter("a.b.c", []string{"a:b"})
+	c.Sample(1, 0.3)
+	c.Sample(1, 0.3)
+	c.Sample(1, 0.3)
+	m, err := c.Metric()
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), m.GetCounter().Value, "forwarded counts should be rounded too")
+}
+
+func TestCounterSaturates(t *testing.T) {
+	c := NewCounter("a.b.c", []string{"a:b"})
+	c.Sample(math.MaxInt64/2, 1.0)
+	c.Sample(math.MaxInt64/2, 1.0)
+	c.Sample(math.MaxInt64/2, 1.0)
+	m, err := c.Metric()
+	require.NoError(t, err)
+	assert.Equal(t, int64(math.MaxInt64), m.GetCounter().Value)
+
+	c.Merge(&metricpb.CounterValue{Value: math.MinInt64})
+	c.Merge(&metricpb.CounterValue{Value: math.MinInt64})
+	m, err = c.Metric()
+	require.NoError(t, err)
+	assert.Equal(t, int64(math.MinInt64), m.GetCounter().Value)
+
+	c = NewCounter("a.b.c", []string{"a:b"})
+	c.Sample(1e30, 1.0)
+	assert.Equal(t, float64(math.MaxInt64), c.Flush(10 * time.Second)[0].Value)
+}
+
 func TestCounterMerge(t *testing.T) {
 	c := NewCounter("a.b.c", []string{"tag:val"})
 
@@ -149,6 +196,33 @@ func TestGaugeMerge(t *testing.T) {
 	assert.Equal(t, float64(5), metrics[0].Value)
 }
 
+func TestGaugeCombineTimestamp(t *testing.T) {
+	now := time.Now().Unix()
+	g := NewGauge("a.b.c", nil)
+	g.SampleAt(5, 1.0, now-10)
+	older, err := g.Export()
+	require.NoError(t, err)
+
+	gGlobal := NewGauge("a.b.c", nil)
+	gGlobal.SampleAt(6, 1.0, now)
+	require.NoError(t, gGlobal.Combine(older.Value))
+	m := gGlobal.Flush()[0]
+	assert.Equal(t, float64(6), m.Value, "the newer value should survive")
+	assert.Equal(t, now, m.Timestamp)
+
+	g.SampleAt(7, 1.0, now+10)
+	newer, err := g.Export()
+	require.NoError(t, err)
+	require.NoError(t, gGlobal.Combine(newer.Value))
+	m = gGlobal.Flush()[0]
+	assert.Equal(t, float64(7), m.Value)
+	assert.Equal(t, now+10, m.Timestamp, "the timestamp should come with the value")
+
+	pb, err := newer.Metric()
+	require.NoError(t, err)
+	assert.Equal(t, now+10, pb.GetGauge().Timestamp, "JSON gauges should keep their timestamp in protobuf")
+}
+
 func TestGauge(t *testing.T) {
 	g := NewGauge("a.b.c", []string{"a:b"})
 
@@ -170,6 +244,41 @@ func TestGauge(t *testing.T) {
 	assert.Equal(t, float64(5), m1.Value, "Value")
 }
 
+func TestGaugeTimestamp(t *testing.T) {
+	g := NewGauge("a.b.c", []string{"a:b"})
+
+	then := time.Now().Add(-1 * time.Hour).Unix()
+	g.SampleAt(5, 1.0, then)
+	metrics := g.Flush()
+	assert.Len(t, metrics, 1, "Flushed metric count")
+	assert.Equal(t, then, metrics[0].Timestamp)
+
+	// samples without a timestamp get flushed with the flush time
+	g.Sample(6, 1.0)
+	metrics = g.Flush()
+	assert.InDelta(t, time.Now().Unix(), metrics[0].Timestamp, 1)
+}
+
+func TestGaugeOutOfOrder(t *testing.T) {
+	now := time.Now().Unix()
+	g := NewGauge("a.b.c", nil)
+
+	g.SampleAt(2, 1.0, now)
+	g.SampleAt(1, 1.0, now-10)
+	m := g.Flush()[0]
+	assert.Equal(t, float64(2), m.Value, "the newer sample should survive")
+	assert.Equal(t, now, m.Timestamp)
+
+	g.SampleAt(3, 1.0, now)
+	assert.Equal(t, float64(3), g.Flush()[0].Value, "same-time samples are taken in arrival order")
+
+	// without timestamps on both, arrival order wins:
+	g.Sample(4, 1.0)
+	assert.Equal(t, float64(4), g.Flush()[0].Value)
+	g.SampleAt(5, 1.0, now-10)
+	assert.Equal(t, float64(5), g.Flush()[0].Value)
+}
+
 // Test the Metric and Merge function on Gauge
 func TestGaugeMergeMetric(t *testing.T) {
 	g := NewGauge("a.b.c", []string{"tag:val"})
@@ -186,6 +295,87 @@ func TestGaugeMergeMetric(t *testing.T) {
 	assert.Equal(t, float64(5), metrics[0].Value)
 }
 
+func TestGaugeMergeMetricTimestamp(t *testing.T) {
+	now := time.Now().Unix()
+	g := NewGauge("a.b.c", nil)
+	g.SampleAt(5, 1.0, now-10)
+	older, err := g.Metric()
+	require.NoError(t, err)
+	assert.Equal(t, now-10, older.GetGauge().Timestamp)
+
+	gGlobal := NewGauge("a.b.c", nil)
+	gGlobal.SampleAt(6, 1.0, now)
+	gGlobal.Merge(older.GetGauge())
+	m := gGlobal.Flush()[0]
+	assert.Equal(t, float64(6), m.Value, "the newer value should survive")
+	assert.Equal(t, now, m.Timestamp)
+
+	// a value without a timestamp replaces the gauge's timestamp too:
+	gGlobal.Merge(&metricpb.GaugeValue{Value: 7})
+	m = gGlobal.Flush()[0]
+	assert.Equal(t, float64(7), m.Value)
+	assert.InDelta(t, time.Now().Unix(), m.Timestamp, 1)
+}
+
+func TestParseCounterRates(t *testing.T) {
+	for setting, want := range map[string]CounterRates{
+		"":          CounterRatesNone,
+		"none":      CounterRatesNone,
+		"alongside": CounterRatesAlongside,
+		"instead":   CounterRatesInstead,
+	} {
+		got, err := ParseCounterRates(setting)
+		assert.NoError(t, err, setting)
+		assert.Equal(t, want, got, setting)
+	}
+	_, err := ParseCounterRates("sometimes")
+	assert.Error(t, err)
+}
+
+func TestCounterFlushRate(t *testing.T) {
+	c := NewCounter("a.b.c", []string{"a:b"})
+	c.Sample(120, 0.5)
+	metrics := c.FlushRate(time.Minute)
+	if assert.Len(t, metrics, 1) {
+		assert.Equal(t, "a.b.c.rate", metrics[0].Name)
+		assert.Equal(t, float64(4), metrics[0].Value)
+		assert.Equal(t, GaugeMetric, metrics[0].Type)
+	}
+}
+
+func TestSetPrecision(t *testing.T) {
+	for _, p := range []int{14, 16} {
+		assert.NoError(t, ValidateSetPrecision(p))
+	}
+	for _, p := range []int{0, 4, 15, 18, 270} {
+		assert.Error(t, ValidateSetPrecision(p))
+	}
+
+	if testing.Short() {
+		t.Skip("skipping 1M-element set in short mode")
+	}
+	const n = 1000000
+	s := NewSetWithPrecision("a.b.c", nil, 16)
+	for i := 0; i < n; i++ {
+		s.Sample(strconv.Itoa(i), 1.0)
+	}
+	// the standard error at precision 16 is 0.41%; stay within 3
+	// standard errors:
+	assert.InEpsilon(t, n, s.Flush()[0].Value, 3*0.0041)
+
+	// sets of different precisions can't be combined, unless the
+	// receiving set is still empty:
+	jm, err := s.Export()
+	require.NoError(t, err)
+	nonEmpty := NewSetWithPrecision("a.b.c", nil, 14)
+	nonEmpty.Sample("a", 1.0)
+	assert.Error(t, nonEmpty.Combine(jm.Value))
+	empty := NewSetWithPrecision("a.b.c", nil, 14)
+	assert.NoError(t, empty.Combine(jm.Value))
+	assert.Equal(t, s.Flush()[0].Value, empty.Flush()[0].Value)
+	assert.NoError(t, NewSetWithPrecision("a.b.c", nil, 16).Combine(jm.Value))
+}
+
 func TestSet(t *testing.T) {
 	s := NewSet("a.b.c", []string{"a:b"})
 
@@ -234,6 +424,58 @@ func TestSetMerge(t *testing.T) {
 	assert.True(t, -1 <= countDifference && countDifference <= 1, "counts did not match after merging (%d and %d)", count1, count2)
 }
 
+// TestSetMergeForwardedSketches merges the sketches of two sets, as a
+// global veneur would when two local veneurs forward them, and checks
+// that the result matches a single set that saw the union of their
+// values.
+func TestSetMergeForwardedSketches(t *testing.T) {
+	for _, precision := range []int{14, 16} {
+		union := NewSetWithPrecision("a.b.c", nil, precision)
+		var locals [2]*Set
+		for i := range locals {
+			locals[i] = NewSetWithPrecision("a.b.c", nil, precision)
+		}
+		sample := func(s *Set, from, to int) {
+			for i := from; i < to; i++ {
+				s.Sample(strconv.Itoa(i), 1.0)
+				union.Sample(strconv.Itoa(i), 1.0)
+			}
+		}
+		// the first set leaves the sparse representation, and the
+		// second overlaps with it by half:
+		sample(locals[0], 0, 100000)
+		sample(locals[1], 99000, 101000)
+
+		global := NewSetWithPrecision("a.b.c", nil, precision)
+		for _, local := range locals {
+			jm, err := local.Export()
+			require.NoError(t, err)
+			require.NoError(t, global.Combine(jm.Value))
+		}
+		assert.Equal(t, union.Hll.Estimate(), global.Hll.Estimate(),
+			"merged sketches should estimate like the union at precision %d", precision)
+		// the standard error is at most 0.81%; stay within 3 of them:
+		assert.InEpsilon(t, 101000, global.Flush()[0].Value, 3*0.0081)
+	}
+}
+
+func TestSetCombineInvalid(t *testing.T) {
+	s := NewSet("a.b.c", nil)
+	s.Sample("a", 1.0)
+	jm, err := s.Export()
+	require.NoError(t, err)
+
+	for name, b := range map[string][]byte{
+		"empty":     nil,
+		"truncated": jm.Value[:4],
+		"version":   append([]byte{2}, jm.Value[1:]...),
+		"precision": append([]byte{jm.Value[0], 12}, jm.Value[2:]...),
+		"too long":  append([]byte{1, 14, 0, 0, 0, 0, 0, 1}, make([]byte, 16)...),
+	} {
+		assert.Error(t, NewSet("a.b.c", nil).Combine(b), name)
+	}
+}
+
 // Test the Metric and Merge function on Set
 func TestSetMergeMetric(t *testing.T) {
 	rand.Seed(time.Now().Unix())
@@ -500,6 +742,174 @@ func TestHistoSampleRate(t *testing.T) {
 	assert.Equal(t, float64(10), count.Value, "count value")
 }
 
+func TestHistogramCompression(t *testing.T) {
+	var nilCompression *HistogramCompression
+	assert.Equal(t, float64(DefaultHistogramCompression), nilCompression.ForName("foo"))
+
+	hc := &HistogramCompression{
+		Overrides: []CompressionOverride{
+			{Pattern: "api.*.latency", Compression: 500},
+			{Pattern: "api.*", Compression: 50},
+		},
+	}
+	assert.NoError(t, hc.Validate())
+	assert.Equal(t, float64(500), hc.ForName("api.users.latency"))
+	assert.Equal(t, float64(50), hc.ForName("api.users.count"))
+	assert.Equal(t, float64(DefaultHistogramCompression), hc.ForName("db.latency"))
+	hc.Default = 30
+	assert.Equal(t, float64(30), hc.ForName("db.latency"))
+
+	assert.Error(t, (&HistogramCompression{Default: -1}).Validate())
+	assert.Error(t, (&HistogramCompression{Overrides: []CompressionOverride{{Pattern: "a", Compression: 0}}}).Validate())
+	assert.Error(t, (&HistogramCompression{Overrides: []CompressionOverride{{Pattern: "[", Compression: 10}}}).Validate())
+}
+
+func TestParseAggregates(t *testing.T) {
+	value, percentiles, err := ParseAggregates([]string{"count", "max", "p99", "p99_9", "50percentile"})
+	require.NoError(t, err)
+	assert.Equal(t, AggregateCount|AggregateMax, value)
+	assert.InDeltaSlice(t, []float64{0.99, 0.999, 0.5}, percentiles, 1e-9)
+
+	for _, names := range [][]string{{"mode"}, {"99"}, {"p"}, {"p100"}, {"p0"}} {
+		_, _, err := ParseAggregates(names)
+		assert.Error(t, err, "aggregates %v", names)
+	}
+}
+
+func TestHistogramAggregatesForName(t *testing.T) {
+	ha := HistogramAggregates{
+		Value:            AggregateMin | AggregateMax | AggregateCount,
+		Count:            3,
+		PercentileNaming: PercentileNamingShort,
+		Overrides: []AggregatesOverride{
+			{Pattern: "api.*.latency", Aggregates: AggregateCount, Percentiles: []float64{0.99}},
+			{Pattern: "api.*"},
+		},
+	}
+	assert.NoError(t, ha.Validate())
+
+	aggregates, percentiles := ha.ForName("api.users.latency", []float64{0.5})
+	assert.Equal(t, HistogramAggregates{Value: AggregateCount, Count: 1, PercentileNaming: PercentileNamingShort}, aggregates)
+	assert.Equal(t, []float64{0.99}, percentiles)
+
+	aggregates, percentiles = ha.ForName("api.users.count", []float64{0.5})
+	assert.Equal(t, 0, aggregates.Count)
+	assert.Empty(t, percentiles)
+
+	aggregates, percentiles = ha.ForName("db.latency", []float64{0.5})
+	assert.Equal(t, ha, aggregates)
+	assert.Equal(t, []float64{0.5}, percentiles)
+
+	assert.Error(t, HistogramAggregates{Overrides: []AggregatesOverride{{Pattern: "["}}}.Validate())
+	assert.Error(t, HistogramAggregates{Overrides: []AggregatesOverride{{Pattern: "a", Percentiles: []float64{1}}}}.Validate())
+}
+
+func TestHistoRequestedPercentiles(t *testing.T) {
+	h := NewHist("a.b.c", []string{"a:b"})
+	for i := 1; i <= 100; i++ {
+		h.Sample(float64(i), 1.0)
+	}
+	h.RequestPercentiles([]float64{0.5, 0.99, 0.75})
+	h.RequestPercentiles(nil)
+
+	metrics := h.Flush(10*time.Second, []float64{0.5, 0.9, 0.99}, HistogramAggregates{}, true)
+	names := []string{}
+	for _, m := range metrics {
+		names = append(names, m.Name)
+	}
+	assert.Equal(t, []string{"a.b.c.50percentile", "a.b.c.99percentile"}, names)
+
+	m, err := h.Metric()
+	assert.NoError(t, err)
+	h2 := NewHist("a.b.c", []string{"a:b"})
+	h2.Merge(m.GetHistogram())
+	assert.Equal(t, []float64{0.5, 0.99, 0.75}, h2.Percentiles)
+}
+
+func TestHistoExemplars(t *testing.T) {
+	h := NewHist("a.b.c", []string{"a:b"})
+	for i, value := range []float64{10, 500, 20, 5, 30} {
+		h.Sample(value, 1.0)
+		h.AddExemplar(Exemplar{Value: value, TraceID: strconv.Itoa(i)}, 3)
+	}
+	assert.Len(t, h.Exemplars, 3)
+
+	metrics := h.Flush(10*time.Second, nil, HistogramAggregates{Value: AggregateMax | AggregateCount, Count: 2}, false)
+	require.Len(t, metrics, 2)
+	for _, m := range metrics {
+		if m.Name == "a.b.c.max" {
+			assert.Equal(t, []Exemplar{
+				{Value: 500, TraceID: "1"},
+				{Value: 30, TraceID: "4"},
+				{Value: 20, TraceID: "2"},
+			}, m.Exemplars, "the highest exemplars should go with the max, highest first")
+		} else {
+			assert.Empty(t, m.Exemplars)
+		}
+	}
+}
+
+func TestHistoFlushBuckets(t *testing.T) {
+	h := NewHist("a.b.c", []string{"a:b"})
+	assert.Empty(t, h.FlushBuckets([]float64{1, 5}), "empty histograms have no buckets")
+
+	for _, v := range []float64{0.5, 1, 2, 7, 8, 100} {
+		h.Sample(v, 1.0)
+	}
+	h.Sample(2, 0.5)
+
+	metrics := h.FlushBuckets([]float64{1, 2.5, 10, 50})
+	buckets := map[string]float64{}
+	for _, m := range metrics {
+		assert.Equal(t, "a.b.c.bucket", m.Name)
+		assert.Equal(t, CounterMetric, m.Type)
+		require.Len(t, m.Tags, 2)
+		assert.Equal(t, "a:b", m.Tags[0])
+		buckets[m.Tags[1]] = m.Value
+	}
+	assert.Equal(t, map[string]float64{
+		"le:1":    2,
+		"le:2.5":  5,
+		"le:10":   7,
+		"le:50":   7,
+		"le:+Inf": 8,
+	}, buckets)
+	assert.Equal(t, []string{"a:b"}, h.Tags, "the histogram's tags should be left alone")
+}
+
+func TestPercentileNaming(t *testing.T) {
+	tests := []struct {
+		p      float64
+		legacy string
+		short  string
+	}{
+		{0.5, "50percentile", "p50"},
+		{0.29, "29percentile", "p29"},
+		{0.999, "99_9percentile", "p99_9"},
+		{0.9999, "99_99percentile", "p99_99"},
+		{0.0001, "0_01percentile", "p0_01"},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.legacy, PercentileNamingLegacy.Suffix(test.p))
+		assert.Equal(t, test.short, PercentileNamingShort.Suffix(test.p))
+		for _, suffix := range []string{test.legacy, test.short} {
+			p, ok := ParsePercentileSuffix(suffix)
+			assert.True(t, ok, suffix)
+			assert.InDelta(t, test.p, p, 1e-12, suffix)
+		}
+	}
+	for _, suffix := range []string{"max", "percentile", "p", "pp50", "p1_2_3", "p100", "50.5percentile", "count"} {
+		_, ok := ParsePercentileSuffix(suffix)
+		assert.False(t, ok, suffix)
+	}
+
+	_, err := ParsePercentileNaming("pct")
+	assert.Error(t, err)
+	assert.NoError(t, ValidatePercentiles([]float64{0.5, 0.999}))
+	assert.Error(t, ValidatePercentiles([]float64{0.5, 1}))
+	assert.Error(t, ValidatePercentiles([]float64{math.NaN()}))
+}
+
 func TestHistoMerge(t *testing.T) {
 	rand.Seed(time.Now().Unix())
 
@@ -524,6 +934,39 @@ func TestHistoMerge(t *testing.T) {
 	assert.InDelta(t, 1.0, h2.LocalMax, 0.02, "merged histogram should have max of 1 after adding a value")
 }
 
+func TestHistoMergeHisto(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	all := NewHist("a.b.c", []string{"a:b"})
+	h1 := NewHist("a.b.c", []string{"a:b"})
+	h2 := NewHist("a.b.c", []string{"a:b"})
+	for i := 0; i < 10000; i++ {
+		v := r.ExpFloat64() * 100
+		all.Sample(v, 1.0)
+		if i%3 == 0 {
+			h1.Sample(v, 0.5)
+			all.Sample(v, 1.0)
+		} else {
+			h2.Sample(v, 1.0)
+		}
+	}
+
+	h1.MergeHisto(h2)
+	for _, q := range []float64{0.5, 0.9, 0.99} {
+		assert.InEpsilon(t, all.Value.Quantile(q), h1.Value.Quantile(q), 0.02, "quantile %v", q)
+	}
+	assert.Equal(t, all.LocalWeight, h1.LocalWeight)
+	assert.Equal(t, all.LocalMin, h1.LocalMin)
+	assert.Equal(t, all.LocalMax, h1.LocalMax)
+	assert.InEpsilon(t, all.LocalSum, h1.LocalSum, 1e-9)
+	assert.InEpsilon(t, all.LocalReciprocalSum, h1.LocalReciprocalSum, 1e-9)
+	assert.Equal(t, all.Value.Count(), h1.Value.Count())
+
+	// merging an empty histogram changes nothing:
+	before := h1.LocalMin
+	h1.MergeHisto(NewHist("a.b.c", []string{"a:b"}))
+	assert.Equal(t, before, h1.LocalMin)
+}
+
 // Test the Metric and Merge function on Set
 func TestHistoMergeMetric(t *testing.T) {
 	rand.Seed(time.Now().Unix())
@@ -549,6 +992,56 @@ func TestHistoMergeMetric(t *testing.T) {
 	assert.InDelta(t, 1.0, h2.LocalMax, 0.02, "merged histogram should have max of 1 after adding a value")
 }
 
+func TestJSONMetricToMetric(t *testing.T) {
+	c := NewCounter("a.counter", []string{"a:b"})
+	c.Sample(5, 1.0)
+	jm, err := c.Export()
+	require.NoError(t, err)
+	m, err := jm.Metric()
+	require.NoError(t, err)
+	assert.Equal(t, "a.counter", m.Name)
+	assert.Equal(t, []string{"a:b"}, m.Tags)
+	assert.Equal(t, int64(5), m.GetCounter().Value)
+
+	g := NewGauge("a.gauge", nil)
+	g.Sample(1.5, 1.0)
+	jm, err = g.Export()
+	require.NoError(t, err)
+	m, err = jm.Metric()
+	require.NoError(t, err)
+	assert.Equal(t, 1.5, m.GetGauge().Value)
+
+	s := NewSet("a.set", nil)
+	s.Sample("a", 1.0)
+	s.Sample("b", 1.0)
+	jm, err = s.Export()
+	require.NoError(t, err)
+	m, err = jm.Metric()
+	require.NoError(t, err)
+	s2 := NewSet("a.set", nil)
+	require.NoError(t, s2.Merge(m.GetSet()))
+	assert.Equal(t, uint64(2), s2.Hll.Estimate())
+
+	h := NewHist("a.timer", nil)
+	for i := 0; i < 100; i++ {
+		h.Sample(float64(i), 1.0)
+	}
+	jm, err = h.Export()
+	require.NoError(t, err)
+	jm.Type = "timer"
+	m, err = jm.Metric()
+	require.NoError(t, err)
+	assert.Equal(t, metricpb.Type_Timer, m.Type)
+	h2 := NewHist("a.timer", nil)
+	h2.Merge(m.GetHistogram())
+	assert.InEpsilon(t, h.Value.Quantile(0.5), h2.Value.Quantile(0.5), 0.02)
+
+	_, err = JSONMetric{MetricKey: MetricKey{Name: "a.counter", Type: "counter"}, Value: []byte{1}}.Metric()
+	assert.Error(t, err, "truncated values should not convert")
+	_, err = JSONMetric{MetricKey: MetricKey{Name: "a.status", Type: "status"}}.Metric()
+	assert.Error(t, err, "status checks can not be forwarded")
+}
+
 func TestMetricKeyEquality(t *testing.T) {
 	c1 := NewCounter("a.b.c", []string{"a:b", "c:d"})
 	ce1, _ := c1.Export()
@@ -612,6 +1105,191 @@ func TestParseMetricSSF(t *testing.T) {
 	assert.Equal(t, udpMetric.Scope, expected.Scope)
 }
 
+func TestParseMetricSSFScope(t *testing.T) {
+	tests := []struct {
+		name   string
+		sample *ssf.SSFSample
+		scope  MetricScope
+	}{
+		{"default", ssf.Count("foo", 1, nil), MixedScope},
+		{"tag", ssf.Count("foo", 1, map[string]string{"veneurglobalonly": "true"}), GlobalOnly},
+		{"explicit global", ssf.Count("foo", 1, nil, ssf.Scope(ssf.SSFSample_GLOBAL)), GlobalOnly},
+		{"explicit local", ssf.Histogram("foo", 1, nil, ssf.Scope(ssf.SSFSample_LOCAL)), LocalOnly},
+		{
+			"explicit scope overrides tag",
+			ssf.Histogram("foo", 1, map[string]string{"veneurglobalonly": "true"}, ssf.Scope(ssf.SSFSample_LOCAL)),
+			LocalOnly,
+		},
+		{
+			"explicit scope overrides type",
+			ssf.Distribution("foo", 1, nil, ssf.Scope(ssf.SSFSample_LOCAL)),
+			LocalOnly,
+		},
+		{
+			"default scope keeps tag",
+			ssf.Histogram("foo", 1, map[string]string{"veneurlocalonly": "true"}, ssf.Scope(ssf.SSFSample_DEFAULT)),
+			LocalOnly,
+		},
+	}
+	for _, elt := range tests {
+		test := elt
+		t.Run(test.name, func(t *testing.T) {
+			udpMetric, err := ParseMetricSSF(test.sample)
+			assert.NoError(t, err)
+			assert.Equal(t, test.scope, udpMetric.Scope)
+			assert.Empty(t, udpMetric.Tags)
+		})
+	}
+}
+
+func TestParseMetricSSFStatus(t *testing.T) {
+	sample := ssf.Status("my.service", ssf.SSFSample_WARNING, nil, ssf.Message("running low on disk"))
+
+	udpMetric, err := ParseMetricSSF(sample)
+	assert.NoError(t, err)
+	assert.Equal(t, "status", udpMetric.Type)
+	assert.Equal(t, ssf.SSFSample_WARNING, udpMetric.Value)
+	assert.Equal(t, "running low on disk", udpMetric.Message)
+}
+
+func TestConvertEvents(t *testing.T) {
+	then := time.Unix(1500000000, 0)
+	span := &ssf.SSFSpan{
+		Metrics: []*ssf.SSFSample{
+			ssf.Count("my.counter", 1, nil),
+			ssf.Event("my.event", "something happened", nil, ssf.Timestamp(then)),
+			ssf.Event("", "this event has no title", nil),
+		},
+	}
+
+	metrics, err := ConvertMetrics(span)
+	assert.NoError(t, err)
+	if assert.Len(t, metrics, 1) {
+		assert.Equal(t, "my.counter", metrics[0].Name)
+	}
+
+	events, err := ConvertEvents(span)
+	if assert.Error(t, err) {
+		invalid, ok := err.(InvalidMetrics)
+		if assert.True(t, ok) {
+			assert.Len(t, invalid.Samples(), 1)
+		}
+	}
+	if assert.Len(t, events, 1) {
+		assert.Equal(t, "my.event", events[0].Name)
+		assert.Equal(t, then.Unix(), events[0].Timestamp)
+	}
+}
+
+func TestConvertEventsNamePrefix(t *testing.T) {
+	ssf.NamePrefix = "prefix."
+	defer func() { ssf.NamePrefix = "" }()
+	span := &ssf.SSFSpan{
+		Metrics: []*ssf.SSFSample{ssf.Event("", "this event has no title", nil)},
+	}
+
+	events, err := ConvertEvents(span)
+	assert.Error(t, err, "an event without a title should be invalid, even with a name prefix")
+	assert.Empty(t, events)
+}
+
+func TestParseMetricSSFDoubleValue(t *testing.T) {
+	udpMetric, err := ParseMetricSSF(ssf.CountInt("my.counter", 1<<24+1, nil))
+	assert.NoError(t, err)
+	assert.Equal(t, float64(1<<24+1), udpMetric.Value)
+
+	c := NewCounter("my.counter", nil)
+	c.Sample(udpMetric.Value.(float64), udpMetric.SampleRate)
+	assert.Equal(t, float64(1<<24+1), c.Flush(10*time.Second)[0].Value)
+}
+
+func TestParseMetricSSFTimestamp(t *testing.T) {
+	then := time.Unix(1500000000, 500)
+	udpMetric, err := ParseMetricSSF(ssf.Gauge("my.test.gauge", 1, nil, ssf.Timestamp(then)))
+	assert.NoError(t, err)
+	assert.Equal(t, then.Unix(), udpMetric.Timestamp)
+
+	udpMetric, err = ParseMetricSSF(ssf.Gauge("my.test.gauge", 1, nil))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), udpMetric.Timestamp)
+}
+
+func TestParseMetricSSFPercentiles(t *testing.T) {
+	udpMetric, err := ParseMetricSSF(ssf.Histogram("my.histo", 1, nil, ssf.Percentiles(0.5, 0.99)))
+	assert.NoError(t, err)
+	assert.Equal(t, []float64{0.5, 0.99}, udpMetric.Percentiles)
+
+	udpMetric, err = ParseMetricSSF(ssf.Distribution("my.dist", 1, nil, ssf.Percentiles(0.5)))
+	assert.NoError(t, err)
+	assert.Equal(t, []float64{0.5}, udpMetric.Percentiles)
+
+	for _, p := range []float64{0, 1, -0.5, math.NaN()} {
+		_, err = ParseMetricSSF(ssf.Histogram("my.histo", 1, nil, ssf.Percentiles(0.5, p)))
+		assert.Error(t, err, "percentile %v", p)
+	}
+}
+
+func TestDogStatsDRoundTrip(t *testing.T) {
+	tags := map[string]string{"purpose": "testing", "odd": "a,b|c"}
+	tests := map[string]*ssf.SSFSample{
+		"counter":      ssf.Count("my.counter", 2, tags),
+		"int counter":  ssf.CountInt("my.counter", 1<<24+1, tags),
+		"gauge":        ssf.Gauge("my.gauge", 0.25, tags, ssf.SampleRate(0.5)),
+		"histogram":    ssf.Histogram("my.histo", 1.5, tags),
+		"distribution": ssf.Distribution("my.dist", 100, tags),
+		"set":          ssf.Set("my.set", "a member", tags),
+		"untagged":     ssf.Gauge("my.gauge", -3, nil),
+	}
+	for name, elt := range tests {
+		sample := elt
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			line, err := sample.DogStatsD()
+			require.NoError(t, err)
+
+			fromSSF, err := ParseMetricSSF(sample)
+			require.NoError(t, err)
+			fromStatsd, err := ParseMetric([]byte(line))
+			require.NoError(t, err, line)
+
+			assert.Equal(t, fromSSF.Name, fromStatsd.Name)
+			assert.Equal(t, fromSSF.Type, fromStatsd.Type)
+			assert.Equal(t, fromSSF.Value, fromStatsd.Value)
+			assert.Equal(t, fromSSF.SampleRate, fromStatsd.SampleRate)
+			assert.Equal(t, fromSSF.Scope, fromStatsd.Scope)
+			if len(sample.Tags) > 0 {
+				assert.Equal(t, []string{"odd:a_b_c", "purpose:testing"}, fromStatsd.Tags)
+			}
+		})
+	}
+}
+
+func TestDogStatsDUnrepresentable(t *testing.T) {
+	tests := map[string]*ssf.SSFSample{
+		"status":     ssf.Status("my.check", ssf.SSFSample_OK, nil),
+		"event":      ssf.Event("title", "text", nil),
+		"bad name":   ssf.Count("my:counter", 1, nil),
+		"empty set":  ssf.Set("my.set", "", nil),
+		"not finite": ssf.Gauge("my.gauge", float32(math.Inf(1)), nil),
+	}
+	for name, sample := range tests {
+		_, err := sample.DogStatsD()
+		assert.Error(t, err, name)
+		assert.IsType(t, &ssf.InvalidSample{}, err, name)
+	}
+}
+
+func TestParseMetricSSFDistribution(t *testing.T) {
+	sample := ssf.Distribution("my.test.distribution", 1.5, map[string]string{"foo": "bar"})
+
+	udpMetric, err := ParseMetricSSF(sample)
+	assert.NoError(t, err)
+	assert.Equal(t, "histogram", udpMetric.Type)
+	assert.Equal(t, GlobalOnly, udpMetric.Scope)
+	assert.Equal(t, float64(1.5), udpMetric.Value)
+	assert.Equal(t, []string{"foo:bar"}, udpMetric.Tags)
+}
+
 func BenchmarkParseMetricSSF(b *testing.B) {
 
 	const LEN = 10000
@@ -643,3 +1321,64 @@ func BenchmarkParseMetricSSF(b *testing.B) {
 		ParseMetricSSF(samples[i%LEN])
 	}
 }
+
+func TestReservoirBounded(t *testing.T) {
+	r := NewReservoir(500)
+	for i := 0; i < 100000; i++ {
+		r.Sample(rand.NormFloat64(), 1)
+	}
+	values := r.Values()
+	require.Len(t, values, 500, "the reservoir should hold no more than its size")
+	assert.Equal(t, 100000.0, r.Seen)
+
+	// the retained values should roughly follow the standard normal
+	// distribution that they were sampled from:
+	assert.InDelta(t, 0, values[250], 0.25, "median")
+	assert.InDelta(t, -0.674, values[125], 0.25, "first quartile")
+	assert.InDelta(t, 0.674, values[375], 0.25, "third quartile")
+}
+
+func TestReservoirWeights(t *testing.T) {
+	r := NewReservoir(1000)
+	for i := 0; i < 100000; i++ {
+		// zeroes are a tenth of the values, but sampled at a rate of
+		// 1/9, so they carry half of the weight:
+		if i%10 == 0 {
+			r.Sample(0, 9)
+		} else {
+			r.Sample(1, 1)
+		}
+	}
+	var ones int
+	for _, v := range r.Values() {
+		ones += int(v)
+	}
+	assert.InDelta(t, 0.5, float64(ones)/1000, 0.06)
+}
+
+func TestHistoReservoir(t *testing.T) {
+	h := NewHist("a.b.c", nil)
+	h.Sample(5, 1)
+	assert.Nil(t, h.Reservoir, "histograms should keep no reservoir by default")
+
+	h.Reservoir = NewReservoir(2)
+	for i := 0; i < 10; i++ {
+		h.Sample(float64(i), 0.5)
+	}
+	assert.Len(t, h.Reservoir.Values(), 2)
+	assert.Equal(t, 20.0, h.Reservoir.Seen)
+}
+
+func TestHistogramReservoirs(t *testing.T) {
+	hr := HistogramReservoirs{
+		{Pattern: "api.*", Size: 100},
+		{Pattern: "*", Size: 10},
+	}
+	require.NoError(t, hr.Validate())
+	assert.Equal(t, 100, hr.ForName("api.latency"))
+	assert.Equal(t, 10, hr.ForName("db.latency"))
+	assert.Equal(t, 0, HistogramReservoirs(nil).ForName("api.latency"))
+
+	assert.Error(t, HistogramReservoirs{{Pattern: "api.*", Size: 0}}.Validate())
+	assert.Error(t, HistogramReservoirs{{Pattern: "[", Size: 1}}.Validate())
+}
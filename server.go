@@ -10,10 +10,15 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math"
+	"math/bits"
 	"net"
 	"net/http"
+	"os"
+	"os/signal"
 	"reflect"
 	"runtime"
+	"sort"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -31,11 +36,13 @@ import (
 	"github.com/zenazn/goji/bind"
 	"github.com/zenazn/goji/graceful"
 	"google.golang.org/grpc"
+	grpccredentials "google.golang.org/grpc/credentials"
 
 	"github.com/pkg/profile"
 
 	vhttp "github.com/stripe/veneur/http"
 	"github.com/stripe/veneur/importsrv"
+	"github.com/stripe/veneur/internal/idempotency"
 	"github.com/stripe/veneur/plugins"
 	localfilep "github.com/stripe/veneur/plugins/localfile"
 	s3p "github.com/stripe/veneur/plugins/s3"
@@ -45,12 +52,22 @@ import (
 	"github.com/stripe/veneur/sinks/datadog"
 	"github.com/stripe/veneur/sinks/debug"
 	"github.com/stripe/veneur/sinks/falconer"
+	"github.com/stripe/veneur/sinks/graphite"
+	"github.com/stripe/veneur/sinks/honeycomb"
+	"github.com/stripe/veneur/sinks/influxdb"
+	"github.com/stripe/veneur/sinks/jaeger"
 	"github.com/stripe/veneur/sinks/kafka"
 	"github.com/stripe/veneur/sinks/lightstep"
+	"github.com/stripe/veneur/sinks/newrelic"
+	"github.com/stripe/veneur/sinks/otlp"
+	"github.com/stripe/veneur/sinks/prometheus"
 	"github.com/stripe/veneur/sinks/signalfx"
 	"github.com/stripe/veneur/sinks/splunk"
 	"github.com/stripe/veneur/sinks/ssfmetrics"
+	"github.com/stripe/veneur/sinks/wavefront"
+	"github.com/stripe/veneur/sinks/zipkin"
 	"github.com/stripe/veneur/ssf"
+	"github.com/stripe/veneur/tlsconfig"
 	"github.com/stripe/veneur/trace"
 	"github.com/stripe/veneur/trace/metrics"
 )
@@ -74,6 +91,30 @@ var tracer = trace.GlobalTracer
 
 const defaultTCPReadTimeout = 10 * time.Minute
 
+// defaultShutdownDrainTimeout is how long a graceful shutdown waits
+// for the workers to process their queues, unless
+// shutdown_drain_timeout is set.
+const defaultShutdownDrainTimeout = 5 * time.Second
+
+// defaultTCPMaxLineLength is the longest line accepted on a TCP statsd
+// connection, unless tcp_max_line_length is set.
+const defaultTCPMaxLineLength = bufio.MaxScanTokenSize
+
+// defaultImportDedupeWindow and defaultImportDedupeMaxKeys bound how
+// long, and how many, idempotency keys of imported batches are
+// remembered, unless import_dedupe_window and import_dedupe_max_keys
+// are set.
+const (
+	defaultImportDedupeWindow  = time.Minute
+	defaultImportDedupeMaxKeys = 100000
+)
+
+// defaultHTTPMaxIdleConnsPerHost is the number of idle connections to
+// each host that HTTP sinks keep open, unless
+// http_max_idle_conns_per_host is set. net/http's default of 2 is too
+// few for sinks that post several bodies at once on every flush.
+const defaultHTTPMaxIdleConnsPerHost = 16
+
 // A Server is the actual veneur instance that will be run.
 type Server struct {
 	Workers              []*Worker
@@ -93,9 +134,15 @@ type Server struct {
 
 	HTTPAddr         string
 	numListeningHTTP *int32 // An atomic boolean for whether or not the HTTP server is running
+	// httpSamplesMaxBodyBytes is the largest (decompressed) body of a
+	// request to /import/samples.
+	httpSamplesMaxBodyBytes int64
 
 	ForwardAddr    string
 	forwardUseGRPC bool
+	// forwardDigestEncoding is the encoding of the t-digests of the
+	// histograms and timers forwarded over HTTP.
+	forwardDigestEncoding samplers.DigestEncoding
 
 	StatsdListenAddrs []net.Addr
 	SSFListenAddrs    []net.Addr
@@ -105,15 +152,84 @@ type Server struct {
 	synchronizeInterval bool
 	numReaders          int
 	metricMaxLength     int
+	metricMaxValues     int
 	traceMaxLengthBytes int
-
-	tlsConfig      *tls.Config
-	tcpReadTimeout time.Duration
+	spanMaxTags         int
+	spanMaxTagLength    int
+	// spanRepair makes invalid spans be repaired where possible,
+	// instead of dropped.
+	spanRepair bool
+
+	// cardinalityLimiter, if set, limits the number of series of
+	// each metric name in a flush interval.
+	cardinalityLimiter *cardinalityLimiter
+
+	// ingestDropWhenFull makes the statsd and SSF listeners drop
+	// samples instead of blocking when a worker's queue is full.
+	ingestDropWhenFull bool
+	// ingestDrops counts the samples dropped on ingestion since the
+	// last flush, by ingestDropKey.
+	ingestDrops sync.Map
+
+	tlsConfig        *tls.Config
+	tcpReadTimeout   time.Duration
+	tcpMaxLineLength int
+
+	// tlsFiles is set if the TLS configuration is read from files, which
+	// are reloaded on SIGHUP.
+	tlsFiles *tlsconfig.Reloadable
+	// httpTLS is set if the HTTP listener serves TLS, with tlsConfig.
+	httpTLS bool
+
+	// forwardTLS, if set, secures the connections to the forwarding
+	// address, over both HTTP and gRPC. forwardHTTPClient is the
+	// client that forwards over HTTP.
+	forwardTLS        *tlsconfig.Reloadable
+	forwardHTTPClient *http.Client
+
+	// sourceRateLimiter limits the rate of samples from each
+	// source, if it is set.
+	sourceRateLimiter *sourceRateLimiter
+	// tcpConnectionRateLimit limits the rate of samples on each TCP
+	// connection, in bursts of up to rateLimitBurst, if it is set.
+	tcpConnectionRateLimit float64
+	rateLimitBurst         int
 
 	// closed when the server is shutting down gracefully
 	shutdown chan struct{}
+	// shutdownDrainTimeout is how long GracefulShutdown waits for the
+	// queued metrics and spans to be processed.
+	shutdownDrainTimeout time.Duration
+	// flushes tracks the goroutines that Flush starts, so the final
+	// flush can wait for them.
+	flushes sync.WaitGroup
+	// flushTimeout bounds how long each sink may take to flush.
+	flushTimeout time.Duration
+	// flushMaxConcurrency bounds how many sinks flush at once; 0 lets
+	// all of them.
+	flushMaxConcurrency int
+	// idempotencyCache holds the idempotency keys of the recently
+	// imported batches of metrics, so that batches that are sent again
+	// are skipped. It is nil if deduplication is disabled.
+	idempotencyCache *idempotency.Cache
+	// flushCtx is the context of the periodic flushes; cancelFlushes
+	// cancels it when the server shuts down without draining.
+	flushCtx      context.Context
+	cancelFlushes context.CancelFunc
+	// adminAddr is the address that the admin endpoints are served on,
+	// if they are enabled.
+	adminAddr     string
+	adminListener net.Listener
+
+	// lastFlush is the report of the most recent flush to the metric
+	// sinks.
+	lastFlushMtx sync.Mutex
+	lastFlush    *FlushReport
 
 	HistogramPercentiles []float64
+	// HistogramBuckets are the upper bounds of the cumulative buckets
+	// that histograms and timers are flushed with, in ascending order.
+	HistogramBuckets []float64
 
 	plugins   []plugins.Plugin
 	pluginMtx sync.Mutex
@@ -122,8 +238,34 @@ type Server struct {
 
 	HistogramAggregates samplers.HistogramAggregates
 
+	counterRates samplers.CounterRates
+
+	// sinksMtx protects the sinks below, which are replaced when the
+	// configuration is reloaded.
+	sinksMtx    sync.RWMutex
 	spanSinks   []sinks.SpanSink
 	metricSinks []sinks.MetricSink
+	// metricSinkFilters select the metrics that each sink receives,
+	// by sink name. Sinks without a filter receive all metrics.
+	metricSinkFilters map[string]*sinks.MetricFilter
+	// metricSinkTags add tags to the metrics that each sink receives,
+	// by sink name.
+	metricSinkTags map[string]*sinks.TagInjector
+	// metricSinkSanitizers sanitize the names and tags of the metrics
+	// that each sink receives, by sink name.
+	metricSinkSanitizers map[string]sinks.Sanitizer
+	// metricRouter decides which sinks and plugins receive each
+	// metric, if routes are configured. Otherwise, they all receive
+	// every metric.
+	metricRouter *sinks.MetricRouter
+	// metricExtractionSink is the span sink that extracts metrics
+	// from spans. It isn't replaced on reload.
+	metricExtractionSink ssfmetrics.DerivedMetricsSink
+
+	// config is the configuration that the server is running with,
+	// and reloadMtx serializes reloads of it.
+	config    Config
+	reloadMtx sync.Mutex
 
 	TraceClient *trace.Client
 
@@ -144,6 +286,10 @@ type Server struct {
 type ssfServiceSpanMetrics struct {
 	ssfSpansReceivedTotal     int64
 	ssfRootSpansReceivedTotal int64
+	ssfTagsDroppedTotal       int64
+	ssfTagsTruncatedTotal     int64
+	ssfSpansInvalidTotal      int64
+	ssfSpansRepairedTotal     int64
 }
 
 // SetLogger sets the default logger in veneur to the passed value.
@@ -155,8 +301,11 @@ func SetLogger(logger *logrus.Logger) {
 // specification and sets up the passed logger according to the
 // configuration.
 func NewFromConfig(logger *logrus.Logger, conf Config) (*Server, error) {
-	ret := &Server{}
+	ret := &Server{config: conf}
 
+	if _, ok := hostnameMetadataEndpoints[conf.HostnameMetadata]; conf.HostnameMetadata != "" && !ok {
+		return ret, fmt.Errorf("unknown hostname_metadata provider %q", conf.HostnameMetadata)
+	}
 	ret.Hostname = conf.Hostname
 	ret.Tags = conf.Tags
 
@@ -165,27 +314,62 @@ func NewFromConfig(logger *logrus.Logger, conf Config) (*Server, error) {
 	ret.synchronizeInterval = conf.SynchronizeWithInterval
 
 	ret.TagsAsMap = mappedTags
-	ret.HistogramPercentiles = conf.Percentiles
-	ret.HistogramAggregates.Value = 0
-	for _, agg := range conf.Aggregates {
-		ret.HistogramAggregates.Value += samplers.AggregatesLookup[agg]
+	ret.HistogramPercentiles = append([]float64(nil), conf.Percentiles...)
+	ret.HistogramBuckets = histogramBuckets(conf.HistogramBuckets)
+
+	// aggregates can list percentiles too, which are flushed alongside
+	// the ones in percentiles.
+	aggregates, percentiles, err := samplers.ParseAggregates(conf.Aggregates)
+	if err != nil {
+		return ret, err
 	}
-	ret.HistogramAggregates.Count = len(conf.Aggregates)
+percentiles:
+	for _, p := range percentiles {
+		for _, configured := range ret.HistogramPercentiles {
+			if p == configured {
+				continue percentiles
+			}
+		}
+		ret.HistogramPercentiles = append(ret.HistogramPercentiles, p)
+	}
+	if conf.FlushMinMax {
+		aggregates |= samplers.AggregateMin | samplers.AggregateMax
+	}
+	ret.HistogramAggregates.Value = aggregates
+	ret.HistogramAggregates.Count = bits.OnesCount(uint(aggregates))
 
-	var err error
 	ret.interval, err = conf.ParseInterval()
 	if err != nil {
 		return ret, err
 	}
-
-	transport := &http.Transport{
-		IdleConnTimeout: ret.interval * 2, // If we're idle more than one interval something is up
+	ret.counterRates, err = samplers.ParseCounterRates(conf.CounterRates)
+	if err != nil {
+		return ret, err
 	}
-
-	ret.HTTPClient = &http.Client{
-		// make sure that POSTs to datadog do not overflow the flush interval
-		Timeout:   ret.interval * 9 / 10,
-		Transport: transport,
+	if err = samplers.ValidatePercentiles(ret.HistogramPercentiles); err != nil {
+		return ret, err
+	}
+	ret.HistogramAggregates.PercentileNaming, err = samplers.ParsePercentileNaming(conf.PercentileNaming)
+	if err != nil {
+		return ret, err
+	}
+	for _, o := range conf.HistogramAggregatesOverrides {
+		value, percentiles, err := samplers.ParseAggregates(o.Aggregates)
+		if err != nil {
+			return ret, fmt.Errorf("histogram aggregates for %q: %v", o.Name, err)
+		}
+		ret.HistogramAggregates.Overrides = append(ret.HistogramAggregates.Overrides, samplers.AggregatesOverride{
+			Pattern:     o.Name,
+			Aggregates:  value,
+			Percentiles: percentiles,
+		})
+	}
+	if err = ret.HistogramAggregates.Validate(); err != nil {
+		return ret, err
+	}
+	ret.forwardDigestEncoding, err = samplers.ParseDigestEncoding(conf.ForwardDigestEncoding)
+	if err != nil {
+		return ret, err
 	}
 
 	stats, err := statsd.NewBuffered(conf.StatsAddress, 4096)
@@ -204,6 +388,11 @@ func NewFromConfig(logger *logrus.Logger, conf Config) (*Server, error) {
 		return ret, err
 	}
 
+	ret.HTTPClient, err = newHTTPClient(conf.httpClientOptions(), ret.interval, ret.TraceClient, "shared", nil)
+	if err != nil {
+		return ret, err
+	}
+
 	// nil is a valid sentry client that noops all methods, if there is no DSN
 	// we can just leave it as nil
 	if conf.SentryDsn != "" {
@@ -267,8 +456,53 @@ func NewFromConfig(logger *logrus.Logger, conf Config) (*Server, error) {
 	ret.numReaders = conf.NumReaders
 
 	// Use the pre-allocated Workers slice to know how many to start.
+	compression := &samplers.HistogramCompression{Default: conf.HistogramCompression}
+	for _, o := range conf.HistogramCompressionOverrides {
+		compression.Overrides = append(compression.Overrides, samplers.CompressionOverride{
+			Pattern:     o.Name,
+			Compression: o.Compression,
+		})
+	}
+	if err := compression.Validate(); err != nil {
+		return ret, err
+	}
+	setPrecision := samplers.DefaultSetPrecision
+	if conf.SetPrecision != 0 {
+		setPrecision = conf.SetPrecision
+		if err := samplers.ValidateSetPrecision(setPrecision); err != nil {
+			return ret, err
+		}
+	}
+	var reservoirs samplers.HistogramReservoirs
+	for _, r := range conf.HistogramReservoirs {
+		reservoirs = append(reservoirs, samplers.ReservoirSize{Pattern: r.Name, Size: r.Size})
+	}
+	if err := reservoirs.Validate(); err != nil {
+		return ret, err
+	}
+	if conf.HistogramMaxExemplars < 0 {
+		return ret, fmt.Errorf("histogram_max_exemplars %d must not be negative", conf.HistogramMaxExemplars)
+	}
+	var gaugeTTL time.Duration
+	if conf.GaugeTTL != "" {
+		gaugeTTL, err = time.ParseDuration(conf.GaugeTTL)
+		if err != nil {
+			return ret, fmt.Errorf("invalid gauge_ttl: %v", err)
+		}
+		if gaugeTTL < 0 {
+			return ret, fmt.Errorf("gauge_ttl %v must not be negative", gaugeTTL)
+		}
+	}
+	if conf.MetricMaxCardinality > 0 {
+		ret.cardinalityLimiter = newCardinalityLimiter(conf.MetricMaxCardinality, conf.MetricCardinalityOverflowTag)
+	}
 	for i := range ret.Workers {
-		ret.Workers[i] = NewWorker(i+1, ret.TraceClient, log, ret.Statsd)
+		ret.Workers[i] = NewWorker(i+1, ret.TraceClient, log, ret.Statsd, compression, setPrecision)
+		ret.Workers[i].maxExemplars = conf.HistogramMaxExemplars
+		ret.Workers[i].reservoirs = reservoirs
+		ret.Workers[i].gaugeTTL = gaugeTTL
+		// global veneurs flush global gauges, local ones forward them:
+		ret.Workers[i].retainGlobalGauges = conf.ForwardAddress == ""
 		// do not close over loop index
 		go func(w *Worker) {
 			defer func() {
@@ -286,11 +520,33 @@ func NewFromConfig(logger *logrus.Logger, conf Config) (*Server, error) {
 	for i, w := range ret.Workers {
 		processors[i] = w
 	}
-	metricSink, err := ssfmetrics.NewMetricExtractionSink(processors, conf.IndicatorSpanTimerName, ret.TraceClient, log)
+	if ret.cardinalityLimiter != nil {
+		// the limit can change the worker that a metric goes to:
+		processors = []ssfmetrics.Processor{limitedProcessor{ret}}
+	}
+	var extractionOpts []ssfmetrics.ExtractionOption
+	if len(conf.SpanMetricRules) > 0 {
+		rules := make([]ssfmetrics.SpanMetricRule, len(conf.SpanMetricRules))
+		for i, rule := range conf.SpanMetricRules {
+			rules[i] = ssfmetrics.SpanMetricRule{
+				Name:  rule.Name,
+				Type:  rule.Type,
+				Unit:  rule.Unit,
+				Tags:  rule.Tags,
+				Match: rule.Match,
+			}
+		}
+		spanMetricRules, err := ssfmetrics.NewSpanMetricRules(rules)
+		if err != nil {
+			return ret, err
+		}
+		extractionOpts = append(extractionOpts, ssfmetrics.WithSpanMetricRules(spanMetricRules))
+	}
+	ret.metricExtractionSink, err = ssfmetrics.NewMetricExtractionSink(processors, ret.EventWorker, conf.IndicatorSpanTimerName, ret.TraceClient, log, extractionOpts...)
 	if err != nil {
 		return ret, err
 	}
-	ret.spanSinks = append(ret.spanSinks, metricSink)
+	ret.spanSinks = append(ret.spanSinks, ret.metricExtractionSink)
 
 	for _, addrStr := range conf.StatsdListenAddresses {
 		addr, err := protocol.ResolveAddr(addrStr)
@@ -308,9 +564,71 @@ func NewFromConfig(logger *logrus.Logger, conf Config) (*Server, error) {
 	}
 
 	ret.metricMaxLength = conf.MetricMaxLength
+	ret.metricMaxValues = conf.MetricMaxValues
+	ret.spanMaxTags = conf.SpanMaxTags
+	ret.spanMaxTagLength = conf.SpanMaxTagLength
+	switch conf.SpanValidation {
+	case "", "reject":
+	case "repair":
+		ret.spanRepair = true
+	default:
+		return ret, fmt.Errorf("unknown span_validation %q, must be reject or repair", conf.SpanValidation)
+	}
+	ret.ingestDropWhenFull = conf.IngestDropWhenFull
+	if conf.SourceRateLimit > 0 {
+		ret.sourceRateLimiter = newSourceRateLimiter(conf.SourceRateLimit, conf.SourceRateLimitBurst)
+	}
+	ret.tcpConnectionRateLimit = conf.TCPConnectionRateLimit
+	ret.rateLimitBurst = conf.SourceRateLimitBurst
+	ret.tcpMaxLineLength = conf.TCPMaxLineLength
+	if conf.TCPReadTimeout != "" {
+		ret.tcpReadTimeout, err = time.ParseDuration(conf.TCPReadTimeout)
+		if err != nil {
+			return ret, fmt.Errorf("invalid tcp_read_timeout: %v", err)
+		}
+	}
+	ret.shutdownDrainTimeout = defaultShutdownDrainTimeout
+	if conf.ShutdownDrainTimeout != "" {
+		ret.shutdownDrainTimeout, err = time.ParseDuration(conf.ShutdownDrainTimeout)
+		if err != nil {
+			return ret, fmt.Errorf("invalid shutdown_drain_timeout: %v", err)
+		}
+	}
+	ret.flushTimeout = ret.interval
+	if conf.FlushTimeout != "" {
+		ret.flushTimeout, err = time.ParseDuration(conf.FlushTimeout)
+		if err != nil {
+			return ret, fmt.Errorf("invalid flush_timeout: %v", err)
+		}
+	}
+	if conf.FlushMaxConcurrency < 0 {
+		return ret, fmt.Errorf("flush_max_concurrency must not be negative")
+	}
+	ret.flushMaxConcurrency = conf.FlushMaxConcurrency
+
+	dedupeWindow := defaultImportDedupeWindow
+	if conf.ImportDedupeWindow != "" {
+		dedupeWindow, err = time.ParseDuration(conf.ImportDedupeWindow)
+		if err != nil {
+			return ret, fmt.Errorf("invalid import_dedupe_window: %v", err)
+		}
+	}
+	dedupeMaxKeys := conf.ImportDedupeMaxKeys
+	if dedupeMaxKeys == 0 {
+		dedupeMaxKeys = defaultImportDedupeMaxKeys
+	}
+	if dedupeWindow > 0 && dedupeMaxKeys > 0 {
+		ret.idempotencyCache = idempotency.NewCache(dedupeWindow, dedupeMaxKeys)
+	}
+	ret.flushCtx, ret.cancelFlushes = context.WithCancel(context.Background())
 	ret.traceMaxLengthBytes = conf.TraceMaxLengthBytes
 	ret.RcvbufBytes = conf.ReadBufferSizeBytes
 	ret.HTTPAddr = conf.HTTPAddress
+	ret.adminAddr = conf.AdminAddress
+	ret.httpSamplesMaxBodyBytes = conf.HTTPSamplesMaxBodyBytes
+	if ret.httpSamplesMaxBodyBytes <= 0 {
+		ret.httpSamplesMaxBodyBytes = defaultConfig.HTTPSamplesMaxBodyBytes
+	}
 	ret.numListeningHTTP = new(int32)
 	ret.ForwardAddr = conf.ForwardAddress
 
@@ -344,57 +662,423 @@ func NewFromConfig(logger *logrus.Logger, conf Config) (*Server, error) {
 		}
 
 		ret.tlsConfig = &tls.Config{
+			MinVersion:   tlsconfig.MinVersion,
 			Certificates: []tls.Certificate{cert},
 			ClientAuth:   clientAuthMode,
 			ClientCAs:    clientCAs,
 		}
 	}
 
+	tlsFiles := tlsconfig.Files{
+		Certificate: conf.TLSCertificateFile,
+		Key:         conf.TLSKeyFile,
+		Authority:   conf.TLSAuthorityCertificateFile,
+	}
+	if !tlsFiles.IsZero() {
+		if conf.TLSKey != "" || conf.TLSCertificate != "" || conf.TLSAuthorityCertificate != "" {
+			err = errors.New("TLS can be configured with either PEM blocks or files, not both")
+			logger.WithError(err).Error("Improper TLS configuration")
+			return ret, err
+		}
+		if tlsFiles.Certificate == "" || tlsFiles.Key == "" {
+			err = errors.New("tls_certificate_file and tls_key_file must both be set")
+			logger.WithError(err).Error("Improper TLS configuration")
+			return ret, err
+		}
+		ret.tlsFiles, err = tlsconfig.Load(tlsFiles)
+		if err != nil {
+			logger.WithError(err).Error("Improper TLS configuration")
+			return ret, err
+		}
+		ret.tlsConfig = ret.tlsFiles.ServerConfig()
+	}
+	if (conf.HTTPTLS || conf.GrpcTLS) && ret.tlsConfig == nil {
+		err = errors.New("http_tls and grpc_tls need a TLS certificate and key")
+		logger.WithError(err).Error("Improper TLS configuration")
+		return ret, err
+	}
+	ret.httpTLS = conf.HTTPTLS
+
+	ret.forwardHTTPClient = ret.HTTPClient
+	forwardTLSFiles := tlsconfig.Files{
+		Certificate: conf.ForwardTLSCertificateFile,
+		Key:         conf.ForwardTLSKeyFile,
+		Authority:   conf.ForwardTLSAuthorityCertificateFile,
+	}
+	if !forwardTLSFiles.IsZero() {
+		ret.forwardTLS, err = tlsconfig.Load(forwardTLSFiles)
+		if err != nil {
+			logger.WithError(err).Error("Improper forwarding TLS configuration")
+			return ret, err
+		}
+		ret.forwardHTTPClient, err = newHTTPClient(conf.httpClientOptions(), ret.interval, ret.TraceClient, "forward", ret.forwardTLS.ClientConfig())
+		if err != nil {
+			return ret, err
+		}
+	}
+
+	configured, err := ret.newSinkSet(logger, conf)
+	if err != nil {
+		return ret, err
+	}
+	ret.metricSinks = configured.metricSinks
+	ret.spanSinks = append(ret.spanSinks, configured.spanSinks...)
+	ret.metricSinkFilters = configured.metricSinkFilters
+	ret.metricSinkTags = configured.metricSinkTags
+	ret.metricSinkSanitizers = configured.metricSinkSanitizers
+
+	if len(conf.SsfListenAddresses) > 0 {
+		trace.Enable()
+
+		// Set up as many span workers as we need:
+		ret.SpanWorkerGoroutines = 1
+		if conf.NumSpanWorkers > 0 {
+			ret.SpanWorkerGoroutines = conf.NumSpanWorkers
+		}
+	}
+
+	var svc s3iface.S3API
+	awsID := conf.AwsAccessKeyID
+	awsSecret := conf.AwsSecretAccessKey
+	if conf.AwsS3Bucket != "" {
+		var parquetSchema *s3p.ParquetSchema
+		switch conf.AwsS3Format {
+		case "", "tsv":
+		case "parquet":
+			parquetSchema, err = s3p.NewParquetSchema(conf.AwsS3ParquetColumns, conf.AwsS3ParquetCompression)
+			if err != nil {
+				return ret, err
+			}
+		default:
+			return ret, fmt.Errorf("unknown aws_s3_format %q", conf.AwsS3Format)
+		}
+		if len(awsID) > 0 && len(awsSecret) > 0 {
+			sess, err := session.NewSession(&aws.Config{
+				Region:      aws.String(conf.AwsRegion),
+				Credentials: credentials.NewStaticCredentials(awsID, awsSecret, ""),
+			})
+
+			if err != nil {
+				logger.Infof("error getting AWS session: %s", err)
+				svc = nil
+			} else {
+				logger.Info("Successfully created AWS session")
+				svc = s3.New(sess)
+				plugin := &s3p.S3Plugin{
+					Logger:   log,
+					Svc:      svc,
+					S3Bucket: conf.AwsS3Bucket,
+					Hostname: ret.Hostname,
+					Parquet:  parquetSchema,
+				}
+				ret.registerPlugin(plugin)
+			}
+		} else {
+			logger.Info("AWS credentials not found")
+		}
+	} else {
+		logger.Info("AWS S3 bucket not set. Skipping S3 Plugin initialization.")
+	}
+
+	if svc == nil {
+		logger.Info("S3 archives are disabled")
+	} else {
+		logger.Info("S3 archives are enabled")
+	}
+
+	if conf.FlushFile != "" {
+		localFilePlugin := &localfilep.Plugin{
+			FilePath: conf.FlushFile,
+			Logger:   log,
+		}
+		ret.registerPlugin(localFilePlugin)
+		logger.Info(fmt.Sprintf("Local file logging to %s", conf.FlushFile))
+	}
+
+	// Routes can name plugins as well as sinks, so set them up once
+	// both are:
+	ret.metricRouter = ret.newMetricRouter(conf, ret.metricSinks)
+
+	// closed in Shutdown; Same approach and http.Shutdown
+	ret.shutdown = make(chan struct{})
+
+	// Don't emit keys into logs now that we're done with them.
+	conf.SentryDsn = REDACTED
+	conf.TLSKey = REDACTED
+	conf.DatadogAPIKey = REDACTED
+	conf.SignalfxAPIKey = REDACTED
+	conf.PrometheusRwBearerToken = REDACTED
+	conf.PrometheusRwBasicAuthPassword = REDACTED
+	conf.LightstepAccessToken = REDACTED
+	conf.HoneycombWriteKey = REDACTED
+	conf.NewrelicAPIKey = REDACTED
+	conf.WavefrontAPIToken = REDACTED
+	conf.AwsAccessKeyID = REDACTED
+	conf.AwsSecretAccessKey = REDACTED
+
+	ret.forwardUseGRPC = conf.ForwardUseGrpc
+
+	// Setup the grpc server if it was configured
+	ret.grpcListenAddress = conf.GrpcAddress
+	if ret.grpcListenAddress != "" {
+		// convert all the workers to the proper interface
+		ingesters := make([]importsrv.MetricIngester, len(ret.Workers))
+		for i, worker := range ret.Workers {
+			ingesters[i] = worker
+		}
+
+		opts := []importsrv.Option{
+			importsrv.WithTraceClient(ret.TraceClient),
+			importsrv.WithSpanIngester(ret),
+			importsrv.WithIdempotencyCache(ret.idempotencyCache),
+		}
+		if conf.GrpcTLS {
+			opts = append(opts, importsrv.WithTLSConfig(ret.tlsConfig))
+		}
+		ret.grpcServer = importsrv.New(ingesters, opts...)
+	}
+
+	logger.WithField("config", conf).Debug("Initialized server")
+
+	return ret, err
+}
+
+// sinkSet holds the sinks that a configuration sets up, and the
+// options that route metrics to them. Reloading the configuration
+// replaces a server's sinks with a new set.
+type sinkSet struct {
+	metricSinks          []sinks.MetricSink
+	spanSinks            []sinks.SpanSink
+	metricSinkFilters    map[string]*sinks.MetricFilter
+	metricSinkTags       map[string]*sinks.TagInjector
+	metricSinkSanitizers map[string]sinks.Sanitizer
+	metricRouter         *sinks.MetricRouter
+}
+
+// newSinkSet creates the metric and span sinks that are configured in
+// conf. The span sinks don't include the server's metric extraction
+// sink.
+func (s *Server) newSinkSet(logger *logrus.Logger, conf Config) (sinkSet, error) {
+	set := sinkSet{}
+	var err error
+
 	if conf.SignalfxAPIKey != "" {
-		tracedHTTP := *ret.HTTPClient
-		tracedHTTP.Transport = vhttp.NewTraceRoundTripper(tracedHTTP.Transport, ret.TraceClient, "signalfx")
+		sfxHTTP, err := s.sinkHTTPClient(conf, "signalfx")
+		if err != nil {
+			return set, err
+		}
+		tracedHTTP := *sfxHTTP
+		tracedHTTP.Transport = vhttp.NewTraceRoundTripper(tracedHTTP.Transport, s.TraceClient, "signalfx")
 
-		fallback := signalfx.NewClient(conf.SignalfxEndpointBase, conf.SignalfxAPIKey, &tracedHTTP)
+		compression, err := vhttp.ParseCompression(conf.SignalfxCompression, vhttp.CompressionGzip)
+		if err != nil {
+			return set, fmt.Errorf("invalid signalfx_compression: %v", err)
+		}
+		fallback, err := signalfx.NewCompressedClient(conf.SignalfxEndpointBase, conf.SignalfxAPIKey, &tracedHTTP, compression)
+		if err != nil {
+			return set, fmt.Errorf("invalid signalfx_compression: %v", err)
+		}
 		byTagClients := map[string]signalfx.DPClient{}
 		for _, perTag := range conf.SignalfxPerTagAPIKeys {
-			byTagClients[perTag.Name] = signalfx.NewClient(conf.SignalfxEndpointBase, perTag.APIKey, &tracedHTTP)
+			byTagClients[perTag.Name], err = signalfx.NewCompressedClient(conf.SignalfxEndpointBase, perTag.APIKey, &tracedHTTP, compression)
+			if err != nil {
+				return set, err
+			}
 		}
-		sfxSink, err := signalfx.NewSignalFxSink(conf.SignalfxHostnameTag, conf.Hostname, ret.TagsAsMap, log, fallback, conf.SignalfxVaryKeyBy, byTagClients, conf.SignalfxMetricNamePrefixDrops, conf.SignalfxMetricTagPrefixDrops, metricSink)
+		sfxSink, err := signalfx.NewSignalFxSink(conf.SignalfxHostnameTag, conf.Hostname, s.TagsAsMap, log, fallback, conf.SignalfxVaryKeyBy, byTagClients, conf.SignalfxMetricNamePrefixDrops, conf.SignalfxMetricTagPrefixDrops, s.metricExtractionSink)
 		if err != nil {
-			return ret, err
+			return set, err
 		}
-		ret.metricSinks = append(ret.metricSinks, sfxSink)
+		set.metricSinks = append(set.metricSinks, sfxSink)
 	}
 	if conf.DatadogAPIKey != "" && conf.DatadogAPIHostname != "" {
+		compression, err := vhttp.ParseCompression(conf.DatadogCompression, vhttp.CompressionDeflate)
+		if err != nil {
+			return set, fmt.Errorf("invalid datadog_compression: %v", err)
+		}
+		ddHTTP, err := s.sinkHTTPClient(conf, "datadog")
+		if err != nil {
+			return set, err
+		}
 		ddSink, err := datadog.NewDatadogMetricSink(
-			ret.interval.Seconds(), conf.DatadogFlushMaxPerBody, conf.Hostname, ret.Tags,
-			conf.DatadogAPIHostname, conf.DatadogAPIKey, ret.HTTPClient, log,
+			s.interval.Seconds(), conf.DatadogFlushMaxPerBody, conf.Hostname, s.Tags,
+			conf.DatadogAPIHostname, conf.DatadogAPIKey, ddHTTP, log,
 		)
 		if err != nil {
-			return ret, err
+			return set, err
+		}
+		ddSink.Compression = compression
+		set.metricSinks = append(set.metricSinks, ddSink)
+	}
+	if conf.PrometheusRwAddress != "" {
+		promHTTP, err := s.sinkHTTPClient(conf, "prometheus_rw")
+		if err != nil {
+			return set, err
+		}
+		promSink, err := prometheus.NewRemoteWriteSink(
+			conf.PrometheusRwAddress, conf.PrometheusRwFlushMaxPerBody, s.Tags,
+			conf.PrometheusRwBearerToken, conf.PrometheusRwBasicAuthUsername, conf.PrometheusRwBasicAuthPassword,
+			promHTTP, log,
+		)
+		if err != nil {
+			return set, err
+		}
+		set.metricSinks = append(set.metricSinks, promSink)
+	}
+	if conf.InfluxdbAddress != "" {
+		influxHTTP, err := s.sinkHTTPClient(conf, "influxdb")
+		if err != nil {
+			return set, err
+		}
+		influxSink, err := influxdb.NewInfluxDBMetricSink(
+			conf.InfluxdbAddress, conf.InfluxdbDatabase, conf.InfluxdbRetentionPolicy,
+			s.Tags, influxHTTP, log,
+		)
+		if err != nil {
+			return set, err
+		}
+		set.metricSinks = append(set.metricSinks, influxSink)
+	}
+	if conf.NewrelicAPIKey != "" {
+		nrHTTP, err := s.sinkHTTPClient(conf, "newrelic")
+		if err != nil {
+			return set, err
+		}
+		nrSink, err := newrelic.NewNewRelicMetricSink(
+			conf.NewrelicEndpoint, conf.NewrelicAPIKey, s.interval,
+			conf.Hostname, s.Tags, nrHTTP, log,
+		)
+		if err != nil {
+			return set, err
+		}
+		set.metricSinks = append(set.metricSinks, nrSink)
+	}
+	if conf.WavefrontAddress != "" {
+		source := conf.WavefrontSource
+		if source == "" {
+			source = conf.Hostname
+		}
+		var wfSink *wavefront.WavefrontMetricSink
+		var err error
+		switch conf.WavefrontProtocol {
+		case "", "proxy":
+			wfSink, err = wavefront.NewWavefrontProxyMetricSink(
+				conf.WavefrontAddress, source, conf.WavefrontSourceTag, s.Tags, log,
+			)
+		case "direct":
+			var wfHTTP *http.Client
+			wfHTTP, err = s.sinkHTTPClient(conf, "wavefront")
+			if err == nil {
+				wfSink, err = wavefront.NewWavefrontDirectMetricSink(
+					conf.WavefrontAddress, conf.WavefrontAPIToken, source,
+					conf.WavefrontSourceTag, s.Tags, wfHTTP, log,
+				)
+			}
+		default:
+			err = fmt.Errorf("wavefront_protocol must be \"proxy\" or \"direct\", not %q", conf.WavefrontProtocol)
+		}
+		if err != nil {
+			return set, err
+		}
+		set.metricSinks = append(set.metricSinks, wfSink)
+	}
+	if conf.OtlpMetricsAddress != "" {
+		opts, err := otlpDialOptions(conf)
+		if err != nil {
+			return set, err
+		}
+		otlpSink, err := otlp.NewOTLPMetricSink(
+			context.Background(), conf.OtlpMetricsAddress, s.interval,
+			conf.Hostname, s.Tags, log, opts...,
+		)
+		if err != nil {
+			return set, err
+		}
+		set.metricSinks = append(set.metricSinks, otlpSink)
+	}
+	if conf.GraphiteAddress != "" {
+		graphiteSink, err := graphite.NewGraphiteMetricSink(
+			conf.GraphiteAddress, conf.GraphiteTagOrder, conf.GraphitePathSeparator,
+			conf.GraphiteBufferSize, log,
+		)
+		if err != nil {
+			return set, err
 		}
-		ret.metricSinks = append(ret.metricSinks, ddSink)
+		set.metricSinks = append(set.metricSinks, graphiteSink)
 	}
 
 	// Configure tracing sinks
 	if len(conf.SsfListenAddresses) > 0 {
 
-		trace.Enable()
-
 		// configure Datadog as a Span sink
 		if conf.DatadogAPIKey != "" && conf.DatadogTraceAPIAddress != "" {
+			ddHTTP, err := s.sinkHTTPClient(conf, "datadog")
+			if err != nil {
+				return set, err
+			}
 			ddSink, err := datadog.NewDatadogSpanSink(
 				conf.DatadogTraceAPIAddress, conf.DatadogSpanBufferSize,
-				ret.HTTPClient, log,
+				ddHTTP, log,
 			)
 			if err != nil {
-				return ret, err
+				return set, err
 			}
 
-			ret.spanSinks = append(ret.spanSinks, ddSink)
+			set.spanSinks = append(set.spanSinks, ddSink)
 			logger.Info("Configured Datadog trace sink")
 		}
 
+		if conf.HoneycombWriteKey != "" {
+			hcHTTP, err := s.sinkHTTPClient(conf, "honeycomb")
+			if err != nil {
+				return set, err
+			}
+			hcSink, err := honeycomb.NewHoneycombSpanSink(
+				conf.HoneycombAPIHost, conf.HoneycombWriteKey, conf.HoneycombDataset,
+				conf.HoneycombBatchSize, hcHTTP, log,
+			)
+			if err != nil {
+				return set, err
+			}
+			set.spanSinks = append(set.spanSinks, hcSink)
+			logger.Info("Configured Honeycomb trace sink")
+		}
+
+		if conf.ZipkinAddress != "" {
+			zkHTTP, err := s.sinkHTTPClient(conf, "zipkin")
+			if err != nil {
+				return set, err
+			}
+			zkSink, err := zipkin.NewZipkinSpanSink(conf.ZipkinAddress, conf.ZipkinBatchSize, zkHTTP, log)
+			if err != nil {
+				return set, err
+			}
+			set.spanSinks = append(set.spanSinks, zkSink)
+			logger.Info("Configured Zipkin trace sink")
+		}
+
+		if conf.JaegerAddress != "" {
+			var jaegerSink *jaeger.JaegerSpanSink
+			switch conf.JaegerProtocol {
+			case "", "grpc":
+				jaegerSink, err = jaeger.NewJaegerCollectorSpanSink(
+					context.Background(), conf.JaegerAddress, conf.Hostname, conf.Tags,
+					conf.JaegerBatchSize, log, grpc.WithInsecure(),
+				)
+			case "udp":
+				jaegerSink, err = jaeger.NewJaegerAgentSpanSink(
+					conf.JaegerAddress, conf.Hostname, conf.Tags, conf.JaegerBatchSize, log,
+				)
+			default:
+				err = fmt.Errorf("jaeger_protocol must be \"grpc\" or \"udp\", not %q", conf.JaegerProtocol)
+			}
+			if err != nil {
+				return set, err
+			}
+			set.spanSinks = append(set.spanSinks, jaegerSink)
+			logger.WithField("protocol", conf.JaegerProtocol).Info("Configured Jaeger trace sink")
+		}
+
 		// configure Lightstep as a Span Sink
 		if conf.LightstepAccessToken != "" {
 
@@ -405,83 +1089,92 @@ func NewFromConfig(logger *logrus.Logger, conf Config) (*Server, error) {
 				conf.LightstepAccessToken, log,
 			)
 			if err != nil {
-				return ret, err
+				return set, err
 			}
-			ret.spanSinks = append(ret.spanSinks, lsSink)
+			set.spanSinks = append(set.spanSinks, lsSink)
 
 			logger.Info("Configured Lightstep trace sink")
 		}
 
 		if (conf.SplunkHecToken != "" && conf.SplunkHecAddress == "") ||
 			(conf.SplunkHecToken == "" && conf.SplunkHecAddress != "") {
-			return ret, fmt.Errorf("both splunk_hec_address and splunk_hec_token need to be set!")
+			return set, fmt.Errorf("both splunk_hec_address and splunk_hec_token need to be set!")
 		}
 		if conf.SplunkHecToken != "" && conf.SplunkHecAddress != "" {
 			var sendTimeout, ingestTimeout, connLifetime, connJitter time.Duration
 			if conf.SplunkHecSendTimeout != "" {
 				sendTimeout, err = time.ParseDuration(conf.SplunkHecSendTimeout)
 				if err != nil {
-					return ret, err
+					return set, err
 				}
 			}
 			if conf.SplunkHecIngestTimeout != "" {
 				ingestTimeout, err = time.ParseDuration(conf.SplunkHecIngestTimeout)
 				if err != nil {
-					return ret, err
+					return set, err
 				}
 			}
 			if conf.SplunkHecMaxConnectionLifetime != "" {
 				connLifetime, err = time.ParseDuration(conf.SplunkHecMaxConnectionLifetime)
 				if err != nil {
-					return ret, err
+					return set, err
 				}
 			}
 			if conf.SplunkHecConnectionLifetimeJitter != "" {
 				connJitter, err = time.ParseDuration(conf.SplunkHecConnectionLifetimeJitter)
 				if err != nil {
-					return ret, err
+					return set, err
 				}
 			}
 
 			sss, err := splunk.NewSplunkSpanSink(conf.SplunkHecAddress, conf.SplunkHecToken, conf.Hostname, conf.SplunkHecTLSValidateHostname, log, ingestTimeout, sendTimeout, conf.SplunkHecBatchSize, conf.SplunkHecSubmissionWorkers, conf.SplunkSpanSampleRate, connLifetime, connJitter)
 			if err != nil {
-				return ret, err
+				return set, err
 			}
 
-			ret.spanSinks = append(ret.spanSinks, sss)
+			set.spanSinks = append(set.spanSinks, sss)
 		}
 
 		if conf.FalconerAddress != "" {
 			falsink, err := falconer.NewSpanSink(context.Background(), conf.FalconerAddress, log, grpc.WithInsecure())
 			if err != nil {
-				return ret, err
+				return set, err
 			}
 
-			ret.spanSinks = append(ret.spanSinks, falsink)
+			set.spanSinks = append(set.spanSinks, falsink)
 			logger.Info("Configured Falconer trace sink")
 		}
 
-		// Set up as many span workers as we need:
-		ret.SpanWorkerGoroutines = 1
-		if conf.NumSpanWorkers > 0 {
-			ret.SpanWorkerGoroutines = conf.NumSpanWorkers
+		if conf.OtlpTracesAddress != "" {
+			opts, err := otlpDialOptions(conf)
+			if err != nil {
+				return set, err
+			}
+			otlpSink, err := otlp.NewOTLPSpanSink(context.Background(), conf.OtlpTracesAddress, conf.Hostname, conf.OtlpTracesBatchSize, log, opts...)
+			if err != nil {
+				return set, err
+			}
+
+			set.spanSinks = append(set.spanSinks, otlpSink)
+			logger.Info("Configured OTLP trace sink")
 		}
 	}
 
 	if conf.KafkaBroker != "" {
 		if conf.KafkaMetricTopic != "" || conf.KafkaCheckTopic != "" || conf.KafkaEventTopic != "" {
 			kSink, err := kafka.NewKafkaMetricSink(
-				log, ret.TraceClient, conf.KafkaBroker, conf.KafkaCheckTopic, conf.KafkaEventTopic,
+				log, s.TraceClient, conf.KafkaBroker, conf.KafkaCheckTopic, conf.KafkaEventTopic,
 				conf.KafkaMetricTopic, conf.KafkaMetricRequireAcks,
 				conf.KafkaPartitioner, conf.KafkaRetryMax,
 				conf.KafkaMetricBufferBytes, conf.KafkaMetricBufferMessages,
-				conf.KafkaMetricBufferFrequency,
+				conf.KafkaMetricBufferFrequency, conf.KafkaMetricPartitionKey,
+				conf.KafkaMetricPartitionKeyTag,
 			)
 			if err != nil {
-				return ret, err
+				return set, err
 			}
 
-			ret.metricSinks = append(ret.metricSinks, kSink)
+			set.metricSinks = append(set.metricSinks, kSink)
 
 			logger.Info("Configured Kafka metric sink")
 		} else {
@@ -489,112 +1182,221 @@ func NewFromConfig(logger *logrus.Logger, conf Config) (*Server, error) {
 		}
 
 		if conf.KafkaSpanTopic != "" {
-			sink, err := kafka.NewKafkaSpanSink(log, ret.TraceClient, conf.KafkaBroker, conf.KafkaSpanTopic,
+			sink, err := kafka.NewKafkaSpanSink(log, s.TraceClient, conf.KafkaBroker, conf.KafkaSpanTopic,
 				conf.KafkaPartitioner, conf.KafkaMetricRequireAcks, conf.KafkaRetryMax,
 				conf.KafkaSpanBufferBytes, conf.KafkaSpanBufferMesages,
 				conf.KafkaSpanBufferFrequency, conf.KafkaSpanSerializationFormat,
 				conf.KafkaSpanSampleTag, conf.KafkaSpanSampleRatePercent,
 			)
 			if err != nil {
-				return ret, err
+				return set, err
 			}
 
-			ret.spanSinks = append(ret.spanSinks, sink)
+			set.spanSinks = append(set.spanSinks, sink)
 			logger.Info("Configured Kafka span sink")
 		} else {
 			logger.Warn("Kafka span sink skipped due to missing span topic")
 		}
 	}
 
-	{
-		mtx := sync.Mutex{}
-		if conf.DebugFlushedMetrics {
-			ret.metricSinks = append(ret.metricSinks, debug.NewDebugMetricSink(&mtx, log))
+	for _, sc := range conf.MetricSinks {
+		sinkConf, err := s.registeredSinkConfig(conf, sc)
+		if err != nil {
+			return set, err
 		}
-		if conf.DebugIngestedSpans {
-			ret.spanSinks = append(ret.spanSinks, debug.NewDebugSpanSink(&mtx, log))
+		sink, err := sinks.NewMetricSink(sinkConf)
+		if err != nil {
+			return set, err
 		}
+		set.metricSinks = append(set.metricSinks, sink)
+		logger.WithField("kind", sc.Kind).WithField("sink", sink.Name()).Info("Configured registered metric sink")
+	}
+	for _, sc := range conf.SpanSinks {
+		sinkConf, err := s.registeredSinkConfig(conf, sc)
+		if err != nil {
+			return set, err
+		}
+		sink, err := sinks.NewSpanSink(sinkConf)
+		if err != nil {
+			return set, err
+		}
+		set.spanSinks = append(set.spanSinks, sink)
+		logger.WithField("kind", sc.Kind).WithField("sink", sink.Name()).Info("Configured registered span sink")
 	}
 
-	// After all sinks are initialized, set the list of tags to exclude
-	setSinkExcludedTags(conf.TagsExclude, ret.metricSinks)
-
-	var svc s3iface.S3API
-	awsID := conf.AwsAccessKeyID
-	awsSecret := conf.AwsSecretAccessKey
-	if conf.AwsS3Bucket != "" {
-		if len(awsID) > 0 && len(awsSecret) > 0 {
-			sess, err := session.NewSession(&aws.Config{
-				Region:      aws.String(conf.AwsRegion),
-				Credentials: credentials.NewStaticCredentials(awsID, awsSecret, ""),
-			})
-
-			if err != nil {
-				logger.Infof("error getting AWS session: %s", err)
-				svc = nil
-			} else {
-				logger.Info("Successfully created AWS session")
-				svc = s3.New(sess)
-				plugin := &s3p.S3Plugin{
-					Logger:   log,
-					Svc:      svc,
-					S3Bucket: conf.AwsS3Bucket,
-					Hostname: ret.Hostname,
-				}
-				ret.registerPlugin(plugin)
-			}
-		} else {
-			logger.Info("AWS credentials not found")
+	{
+		mtx := sync.Mutex{}
+		if conf.DebugFlushedMetrics {
+			set.metricSinks = append(set.metricSinks, debug.NewDebugMetricSink(&mtx, log))
+		}
+		if conf.DebugIngestedSpans {
+			set.spanSinks = append(set.spanSinks, debug.NewDebugSpanSink(&mtx, log))
 		}
-	} else {
-		logger.Info("AWS S3 bucket not set. Skipping S3 Plugin initialization.")
 	}
 
-	if svc == nil {
-		logger.Info("S3 archives are disabled")
-	} else {
-		logger.Info("S3 archives are enabled")
+	// After all sinks are initialized, set the list of tags to exclude
+	setSinkExcludedTags(conf.TagsExclude, set.metricSinks)
+	set.metricSinkFilters = newMetricSinkFilters(conf.MetricSinkOptions, set.metricSinks)
+	set.metricSinkTags = newMetricSinkTags(conf.MetricSinkOptions)
+	set.metricSinkSanitizers = newMetricSinkSanitizers(conf.MetricSinkOptions, set.metricSinks)
+	set.metricSinks, err = wrapRetryingSinks(conf.MetricSinkOptions, set.metricSinks, s.interval, log)
+	if err != nil {
+		return set, err
 	}
-
-	if conf.FlushFile != "" {
-		localFilePlugin := &localfilep.Plugin{
-			FilePath: conf.FlushFile,
-			Logger:   log,
+	set.metricSinks, err = wrapSpillingSinks(conf.MetricSinkOptions, set.metricSinks, log)
+	if err != nil {
+		return set, err
+	}
+	set.metricSinks = wrapAsyncSinks(conf.MetricSinkOptions, set.metricSinks, log)
+	set.metricSinks, err = wrapBufferingSinks(conf.MetricSinkOptions, set.metricSinks, s.interval)
+	if err != nil {
+		return set, err
+	}
+	if conf.SpanTailSampling && len(set.spanSinks) > 0 {
+		opts, err := tailSamplingOptions(conf)
+		if err != nil {
+			return set, err
 		}
-		ret.registerPlugin(localFilePlugin)
-		logger.Info(fmt.Sprintf("Local file logging to %s", conf.FlushFile))
+		set.spanSinks = []sinks.SpanSink{sinks.NewTailSamplingSpanSink(set.spanSinks, opts, log)}
 	}
 
-	// closed in Shutdown; Same approach and http.Shutdown
-	ret.shutdown = make(chan struct{})
+	return set, nil
+}
 
-	// Don't emit keys into logs now that we're done with them.
-	conf.SentryDsn = REDACTED
-	conf.TLSKey = REDACTED
-	conf.DatadogAPIKey = REDACTED
-	conf.SignalfxAPIKey = REDACTED
-	conf.LightstepAccessToken = REDACTED
-	conf.AwsAccessKeyID = REDACTED
-	conf.AwsSecretAccessKey = REDACTED
+// tailSamplingOptions returns the options of the span_tail_sampling
+// settings.
+func tailSamplingOptions(conf Config) (sinks.TailSamplingOptions, error) {
+	opts := sinks.TailSamplingOptions{
+		MaxSpans:   conf.SpanTailSamplingMaxSpans,
+		KeepErrors: conf.SpanTailSamplingKeepErrors,
+		Rate:       conf.SpanTailSamplingRate,
+	}
+	var err error
+	if conf.SpanTailSamplingWait != "" {
+		opts.Wait, err = time.ParseDuration(conf.SpanTailSamplingWait)
+		if err != nil {
+			return opts, fmt.Errorf("invalid span_tail_sampling_wait: %v", err)
+		}
+	}
+	if conf.SpanTailSamplingMinDuration != "" {
+		opts.MinDuration, err = time.ParseDuration(conf.SpanTailSamplingMinDuration)
+		if err != nil {
+			return opts, fmt.Errorf("invalid span_tail_sampling_min_duration: %v", err)
+		}
+	}
+	if opts.Rate < 0 || opts.Rate > 1 {
+		return opts, fmt.Errorf("span_tail_sampling_rate %v must be between 0 and 1", opts.Rate)
+	}
+	return opts, nil
+}
 
-	ret.forwardUseGRPC = conf.ForwardUseGrpc
+// registeredSinkConfig is the config that the factory of a registered
+// sink receives.
+func (s *Server) registeredSinkConfig(conf Config, sc RegisteredSinkConfig) (sinks.SinkConfig, error) {
+	httpClient, err := s.sinkHTTPClient(conf, sc.Name)
+	if err != nil {
+		return sinks.SinkConfig{}, err
+	}
+	return sinks.SinkConfig{
+		Kind:       sc.Kind,
+		Name:       sc.Name,
+		Hostname:   conf.Hostname,
+		Tags:       s.Tags,
+		Interval:   s.interval,
+		HTTPClient: httpClient,
+		Logger:     log,
+		Config:     sc.Config,
+	}, nil
+}
 
-	// Setup the grpc server if it was configured
-	ret.grpcListenAddress = conf.GrpcAddress
-	if ret.grpcListenAddress != "" {
-		// convert all the workers to the proper interface
-		ingesters := make([]importsrv.MetricIngester, len(ret.Workers))
-		for i, worker := range ret.Workers {
-			ingesters[i] = worker
-		}
+// httpClientOptions returns the options of the HTTP client that sinks
+// share, from the http_* settings.
+func (c Config) httpClientOptions() HTTPClientOptions {
+	return HTTPClientOptions{
+		MaxIdleConnsPerHost: c.HTTPMaxIdleConnsPerHost,
+		IdleConnTimeout:     c.HTTPIdleConnTimeout,
+		DisableKeepAlives:   c.HTTPDisableKeepAlives,
+	}
+}
 
-		ret.grpcServer = importsrv.New(ingesters,
-			importsrv.WithTraceClient(ret.TraceClient))
+// newHTTPClient returns an HTTP client whose connection pool opts tune,
+// and that reports whether its requests use new or reused connections,
+// tagged with name. If tlsConfig is set, the client's TLS connections
+// use it.
+func newHTTPClient(opts HTTPClientOptions, interval time.Duration, tc *trace.Client, name string, tlsConfig *tls.Config) (*http.Client, error) {
+	maxIdle := opts.MaxIdleConnsPerHost
+	if maxIdle == 0 {
+		maxIdle = defaultHTTPMaxIdleConnsPerHost
+	}
+	if maxIdle < 0 {
+		return nil, fmt.Errorf("max_idle_conns_per_host of the %s HTTP client must not be negative", name)
+	}
+	// If we're idle more than one interval something is up:
+	idleTimeout := interval * 2
+	if opts.IdleConnTimeout != "" {
+		d, err := time.ParseDuration(opts.IdleConnTimeout)
+		if err != nil {
+			return nil, fmt.Errorf("invalid idle_conn_timeout of the %s HTTP client: %v", name, err)
+		}
+		idleTimeout = d
 	}
 
-	logger.WithField("config", conf).Debug("Initialized server")
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		TLSHandshakeTimeout: 10 * time.Second,
+		TLSClientConfig:     tlsConfig,
+		MaxIdleConnsPerHost: maxIdle,
+		IdleConnTimeout:     idleTimeout,
+		DisableKeepAlives:   opts.DisableKeepAlives,
+	}
+	return &http.Client{
+		// make sure that POSTs to datadog do not overflow the flush interval
+		Timeout:   interval * 9 / 10,
+		Transport: vhttp.NewConnectionReportingRoundTripper(transport, tc, name),
+	}, nil
+}
 
-	return ret, err
+// sinkHTTPClient returns the HTTP client of the sink named name: one
+// of its own if its metric_sink_options set http, and the shared one
+// otherwise.
+func (s *Server) sinkHTTPClient(conf Config, name string) (*http.Client, error) {
+	opts, ok := conf.MetricSinkOptions[name]
+	if !ok || opts.HTTP == nil {
+		return s.HTTPClient, nil
+	}
+	own := *opts.HTTP
+	shared := conf.httpClientOptions()
+	if own.MaxIdleConnsPerHost == 0 {
+		own.MaxIdleConnsPerHost = shared.MaxIdleConnsPerHost
+	}
+	if own.IdleConnTimeout == "" {
+		own.IdleConnTimeout = shared.IdleConnTimeout
+	}
+	own.DisableKeepAlives = own.DisableKeepAlives || shared.DisableKeepAlives
+	return newHTTPClient(own, s.interval, s.TraceClient, name, nil)
+}
+
+// otlpDialOptions returns the options for dialing the configured OTLP
+// collector: TLS (verified against otlp_tls_authority_certificate, if
+// set, and the system's roots otherwise) if otlp_tls is enabled, and a
+// plaintext connection otherwise.
+func otlpDialOptions(conf Config) ([]grpc.DialOption, error) {
+	if !conf.OtlpTLS {
+		return []grpc.DialOption{grpc.WithInsecure()}, nil
+	}
+	tlsConfig := &tls.Config{}
+	if conf.OtlpTLSAuthorityCertificate != "" {
+		roots := x509.NewCertPool()
+		if !roots.AppendCertsFromPEM([]byte(conf.OtlpTLSAuthorityCertificate)) {
+			return nil, errors.New("otlp_tls_authority_certificate: Could not load any certificates")
+		}
+		tlsConfig.RootCAs = roots
+	}
+	return []grpc.DialOption{grpc.WithTransportCredentials(grpccredentials.NewTLS(tlsConfig))}, nil
 }
 
 // Start spins up the Server to do actual work, firing off goroutines for
@@ -602,6 +1404,16 @@ func NewFromConfig(logger *logrus.Logger, conf Config) (*Server, error) {
 func (s *Server) Start() {
 	log.WithField("version", VERSION).Info("Starting server")
 
+	var reloadable []*tlsconfig.Reloadable
+	for _, r := range []*tlsconfig.Reloadable{s.tlsFiles, s.forwardTLS} {
+		if r != nil {
+			reloadable = append(reloadable, r)
+		}
+	}
+	if len(reloadable) > 0 {
+		go tlsconfig.ReloadOnSignal(logrus.NewEntry(log), s.shutdown, reloadable, syscall.SIGHUP)
+	}
+
 	// Set up the processors for spans:
 
 	// Use the pre-allocated Workers slice to know how many to start.
@@ -670,10 +1482,19 @@ func (s *Server) Start() {
 		logrus.Info("Tracing sockets are not configured - not reading trace socket")
 	}
 
+	// Serve the admin endpoints, if they are enabled
+	if s.adminAddr != "" {
+		s.startAdmin()
+	}
+
 	// Initialize a gRPC connection for forwarding
 	if s.forwardUseGRPC {
 		var err error
-		s.grpcForwardConn, err = grpc.Dial(s.ForwardAddr, grpc.WithInsecure())
+		creds := grpc.WithInsecure()
+		if s.forwardTLS != nil {
+			creds = grpc.WithTransportCredentials(grpccredentials.NewTLS(s.forwardTLS.ClientConfig()))
+		}
+		s.grpcForwardConn, err = grpc.Dial(s.ForwardAddr, creds)
 		if err != nil {
 			log.WithError(err).WithFields(logrus.Fields{
 				"forwardAddr": s.ForwardAddr,
@@ -706,7 +1527,7 @@ func (s *Server) Start() {
 				ticker.Stop()
 				return
 			case <-ticker.C:
-				s.Flush(context.TODO())
+				s.Flush(s.flushCtx)
 			}
 		}
 	}()
@@ -735,9 +1556,10 @@ func (s *Server) HandleMetricPacket(packet []byte) error {
 				"packet":        string(packet),
 			}).Warn("Could not parse packet")
 			samples.Add(ssf.Count("packet.error_total", 1, map[string]string{"packet_type": "event", "reason": "parse"}))
+			s.countDrop(ingestSourceStatsd, dropReasonParseError)
 			return err
 		}
-		s.EventWorker.sampleChan <- *event
+		s.EventWorker.IngestEvent(*event)
 	} else if bytes.HasPrefix(packet, []byte{'_', 's', 'c'}) {
 		svcheck, err := samplers.ParseServiceCheck(packet)
 		if err != nil {
@@ -746,20 +1568,24 @@ func (s *Server) HandleMetricPacket(packet []byte) error {
 				"packet":        string(packet),
 			}).Warn("Could not parse packet")
 			samples.Add(ssf.Count("packet.error_total", 1, map[string]string{"packet_type": "service_check", "reason": "parse"}))
+			s.countDrop(ingestSourceStatsd, dropReasonParseError)
 			return err
 		}
-		s.Workers[svcheck.Digest%uint32(len(s.Workers))].PacketChan <- *svcheck
+		s.enqueueMetric(s.workerFor(svcheck), *svcheck)
 	} else {
-		metric, err := samplers.ParseMetric(packet)
+		parsed, err := samplers.ParseMetrics(packet, s.metricMaxValues)
 		if err != nil {
 			log.WithFields(logrus.Fields{
 				logrus.ErrorKey: err,
 				"packet":        string(packet),
 			}).Warn("Could not parse packet")
 			samples.Add(ssf.Count("packet.error_total", 1, map[string]string{"packet_type": "metric", "reason": "parse"}))
+			s.countDrop(ingestSourceStatsd, dropReasonParseError)
 			return err
 		}
-		s.Workers[metric.Digest%uint32(len(s.Workers))].PacketChan <- *metric
+		for i := range parsed {
+			s.enqueueMetric(s.workerFor(&parsed[i]), parsed[i])
+		}
 	}
 	return nil
 }
@@ -783,6 +1609,7 @@ func (s *Server) HandleTracePacket(packet []byte) {
 	if err != nil {
 		reason := "reason:" + err.Error()
 		s.Statsd.Count("ssf.error_total", 1, []string{"ssf_format:packet", "packet_type:ssf_metric", reason}, 1.0)
+		s.countDrop(ingestSourceSSF, dropReasonParseError)
 		log.WithError(err).Warn("ParseSSF")
 		return
 	}
@@ -835,21 +1662,45 @@ func (s *Server) handleSSF(span *ssf.SSFSpan, ssfFormat string) {
 
 	atomic.AddInt64(&metricsStruct.ssfSpansReceivedTotal, 1)
 
+	if span = s.validateSpan(span, metricsStruct); span == nil {
+		return
+	}
+
 	if span.Id == span.TraceId {
 		atomic.AddInt64(&metricsStruct.ssfRootSpansReceivedTotal, 1)
 	}
 
-	s.SpanChan <- span
+	dropped, truncated := span.LimitTags(s.spanMaxTags, s.spanMaxTagLength)
+	if dropped > 0 {
+		atomic.AddInt64(&metricsStruct.ssfTagsDroppedTotal, int64(dropped))
+	}
+	if truncated > 0 {
+		atomic.AddInt64(&metricsStruct.ssfTagsTruncatedTotal, int64(truncated))
+	}
+
+	s.enqueueSpan(span, ssfFormat)
+}
+
+// IngestSpan handles a span received by the gRPC import server. It
+// blocks while the span channel is full.
+func (s *Server) IngestSpan(span *ssf.SSFSpan) {
+	s.handleSSF(span, "grpc")
 }
 
 // ReadMetricSocket listens for available packets to handle.
 func (s *Server) ReadMetricSocket(serverConn net.PacketConn, packetPool *sync.Pool) {
 	for {
 		buf := packetPool.Get().([]byte)
-		n, _, err := serverConn.ReadFrom(buf)
+		n, addr, err := serverConn.ReadFrom(buf)
 		if err != nil {
-			log.WithError(err).Error("Error reading from UDP metrics socket")
-			continue
+			select {
+			case <-s.shutdown:
+				log.WithError(err).Info("Ignoring ReadFrom error while shutting down")
+				return
+			default:
+				log.WithError(err).Error("Error reading from UDP metrics socket")
+				continue
+			}
 		}
 		if n > s.metricMaxLength {
 			metrics.ReportOne(s.TraceClient, ssf.Count("packet.error_total", 1, map[string]string{"packet_type": "unknown", "reason": "toolong"}))
@@ -863,6 +1714,9 @@ func (s *Server) ReadMetricSocket(serverConn net.PacketConn, packetPool *sync.Po
 		// trailing newlines
 		splitPacket := samplers.NewSplitBytes(buf[:n], '\n')
 		for splitPacket.Next() {
+			if !s.allowSample(addr, "udp") {
+				continue
+			}
 			s.HandleMetricPacket(splitPacket.Chunk())
 		}
 
@@ -887,7 +1741,7 @@ func (s *Server) ReadSSFPacketSocket(serverConn net.PacketConn, packetPool *sync
 
 	for {
 		buf := packetPool.Get().([]byte)
-		n, _, err := serverConn.ReadFrom(buf)
+		n, addr, err := serverConn.ReadFrom(buf)
 		if err != nil {
 			// In tests, the probably-best way to
 			// terminate this reader is to issue a shutdown and close the listening
@@ -902,11 +1756,61 @@ func (s *Server) ReadSSFPacketSocket(serverConn net.PacketConn, packetPool *sync
 			}
 		}
 
-		s.HandleTracePacket(buf[:n])
+		if s.allowSample(addr, "ssf") {
+			s.HandleTracePacket(buf[:n])
+		}
 		packetPool.Put(buf)
 	}
 }
 
+// ReadSSFDatagramSocket reads datagrams of framed SSF spans off a
+// UNIX domain datagram socket. Each datagram holds one or more spans
+// in wire format; see package github.com/stripe/veneur/protocol for
+// details. Datagrams longer than trace_max_length_bytes are dropped.
+func (s *Server) ReadSSFDatagramSocket(serverConn net.PacketConn) {
+	// one extra byte tells truncated datagrams from those that fit
+	// exactly
+	buf := make([]byte, s.traceMaxLengthBytes+1)
+	for {
+		n, _, err := serverConn.ReadFrom(buf)
+		if err != nil {
+			select {
+			case <-s.shutdown:
+				log.WithError(err).Info("Ignoring ReadFrom error while shutting down")
+				return
+			default:
+				log.WithError(err).Error("Error reading from UNIX datagram trace socket")
+				continue
+			}
+		}
+		if n > s.traceMaxLengthBytes {
+			s.Statsd.Count("ssf.error_total", 1, []string{"ssf_format:datagram", "packet_type:unknown", "reason:too_long"}, 1.0)
+			log.WithField("max_length", s.traceMaxLengthBytes).Warn("Dropping SSF datagram that exceeds trace_max_length_bytes")
+			continue
+		}
+
+		datagram := bytes.NewReader(buf[:n])
+		for datagram.Len() > 0 {
+			msg, err := protocol.ReadSSF(datagram)
+			if protocol.IsFramingError(err) {
+				// the rest of the datagram is unreadable
+				s.Statsd.Count("ssf.error_total", 1, []string{"ssf_format:datagram", "packet_type:unknown", "reason:framing"}, 1.0)
+				s.countDrop(ingestSourceSSF, dropReasonParseError)
+				log.WithError(err).Info("Frame error reading from SSF datagram. Dropping the rest of it.")
+				break
+			}
+			if err != nil {
+				// the frame was read, so the next one can be
+				s.Statsd.Count("ssf.error_total", 1, []string{"ssf_format:datagram", "packet_type:unknown", "reason:processing"}, 1.0)
+				s.countDrop(ingestSourceSSF, dropReasonParseError)
+				log.WithError(err).Error("Error processing an SSF frame")
+				continue
+			}
+			s.handleSSF(msg, "datagram")
+		}
+	}
+}
+
 // ReadSSFStreamSocket reads a streaming connection in framed wire format
 // off a streaming socket. See package
 // github.com/stripe/veneur/protocol for details.
@@ -942,6 +1846,7 @@ func (s *Server) ReadSSFStreamSocket(serverConn net.Conn) {
 				Error("Error processing an SSF frame")
 			tags = append(tags, []string{"packet_type:unknown", "reason:processing"}...)
 			s.Statsd.Incr("ssf.error_total", tags, 1.0)
+			s.countDrop(ingestSourceSSF, dropReasonParseError)
 			tags = tags[:1]
 			continue
 		}
@@ -1005,14 +1910,39 @@ func (s *Server) handleTCPGoroutine(conn net.Conn) {
 		}).Debug("Starting TCP connection")
 	}
 
-	// Scanner is nearly the same performance as a custom implementation
+	maxLineLength := defaultTCPMaxLineLength
+	if s.tcpMaxLineLength > 0 {
+		maxLineLength = s.tcpMaxLineLength
+	}
+
+	// Scanner is nearly the same performance as a custom implementation.
+	// It reassembles lines that are split across reads; the +1 leaves
+	// room for the newline of a line that is exactly maxLineLength long.
 	buf := bufio.NewScanner(conn)
+	initial := 4096
+	if initial > maxLineLength+1 {
+		initial = maxLineLength + 1
+	}
+	buf.Buffer(make([]byte, initial), maxLineLength+1)
 
 	scanWithDeadline := func() bool {
 		conn.SetReadDeadline(time.Now().Add(timeout))
 		return buf.Scan()
 	}
+	var connLimit *tokenBucket
+	if s.tcpConnectionRateLimit > 0 {
+		burst := burstSize(s.tcpConnectionRateLimit, s.rateLimitBurst)
+		connLimit = newTokenBucket(s.tcpConnectionRateLimit, burst, time.Now())
+	}
 	for scanWithDeadline() {
+		if !s.allowSample(conn.RemoteAddr(), "tcp") {
+			continue
+		}
+		if connLimit != nil && !connLimit.allow(time.Now()) {
+			s.Statsd.Count("ingest.rate_limited_total", 1, []string{"source:" + sourceOf(conn.RemoteAddr()), "protocol:tcp", "limit:connection"}, 1.0)
+			s.countDrop(ingestSourceStatsd, dropReasonRateLimited)
+			continue
+		}
 		// treat each line as a separate packet
 		err := s.HandleMetricPacket(buf.Bytes())
 		if err != nil {
@@ -1023,7 +1953,15 @@ func (s *Server) handleTCPGoroutine(conn net.Conn) {
 			return
 		}
 	}
-	if buf.Err() != nil {
+	if buf.Err() == bufio.ErrTooLong {
+		// there's no telling where the next line starts, so give up on
+		// the connection
+		metrics.ReportOne(s.TraceClient, ssf.Count("tcp.line_too_long", 1, nil))
+		log.WithFields(logrus.Fields{
+			"peer":       conn.RemoteAddr(),
+			"max_length": maxLineLength,
+		}).Warn("Line too long; closing TCP connection")
+	} else if buf.Err() != nil {
 		// usually "read: connection reset by peer" or "i/o timeout"
 		log.WithFields(logrus.Fields{
 			logrus.ErrorKey: buf.Err(),
@@ -1054,7 +1992,8 @@ func (s *Server) ReadTCPSocket(listener net.Listener) {
 // Start all of the the configured servers (gRPC or HTTP) and block until
 // one of them exist.  At that point, stop them both.
 func (s *Server) Serve() {
-	done := make(chan struct{})
+	// Both servers may shut down, and nobody waits for the second:
+	done := make(chan struct{}, 2)
 
 	if s.HTTPAddr != "" {
 		go func() {
@@ -1070,10 +2009,20 @@ func (s *Server) Serve() {
 		}()
 	}
 
-	// wait until at least one of the servers has shut down
-	<-done
-	graceful.Shutdown()
-	s.gRPCStop()
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGTERM)
+	defer signal.Stop(sigs)
+
+	// wait until at least one of the servers has shut down, or we're
+	// asked to terminate
+	select {
+	case <-done:
+		graceful.Shutdown()
+		s.gRPCStop()
+	case sig := <-sigs:
+		log.WithField("signal", sig.String()).Info("Received signal")
+		s.GracefulShutdown()
+	}
 }
 
 // HTTPServe starts the HTTP server and listens perpetually until it encounters an unrecoverable error.
@@ -1096,7 +2045,7 @@ func (s *Server) HTTPServe() {
 			profileStopOnce.Do(prf.Stop)
 		}()
 	}
-	httpSocket := bind.Socket(s.HTTPAddr)
+	httpSocket := s.httpListener(bind.Socket(s.HTTPAddr))
 	graceful.Timeout(10 * time.Second)
 	graceful.PreHook(func() {
 
@@ -1108,8 +2057,9 @@ func (s *Server) HTTPServe() {
 	})
 
 	// Ensure that the server responds to SIGUSR2 even
-	// when *not* running under einhorn.
-	graceful.AddSignal(syscall.SIGUSR2, syscall.SIGHUP)
+	// when *not* running under einhorn. (SIGHUP reloads the TLS
+	// certificates instead.)
+	graceful.AddSignal(syscall.SIGUSR2)
 	graceful.HandleSignals()
 	gracefulSocket := graceful.WrapListener(httpSocket)
 	log.WithField("address", s.HTTPAddr).Info("HTTP server listening")
@@ -1127,10 +2077,19 @@ func (s *Server) HTTPServe() {
 	graceful.Shutdown()
 }
 
+// httpListener wraps the HTTP server's listener with TLS, if the HTTP
+// server serves TLS.
+func (s *Server) httpListener(ln net.Listener) net.Listener {
+	if s.httpTLS {
+		return tls.NewListener(ln, s.tlsConfig)
+	}
+	return ln
+}
+
 // gRPCServe starts the gRPC server and blocks until an error is encountered,
 // or the server is shutdown.
 //
-// TODO this doesn't handle SIGUSR2 and SIGHUP on it's own, unlike HTTPServe
+// TODO this doesn't handle SIGUSR2 on it's own, unlike HTTPServe
 // As long as both are running this is actually fine, as Serve will stop
 // the gRPC server when the HTTP one exits.  When running just gRPC however,
 // the signal handling won't work.
@@ -1169,18 +2128,146 @@ func (s *Server) gRPCStop() {
 // Shutdown signals the server to shut down after closing all
 // current connections.
 func (s *Server) Shutdown() {
-	// TODO(aditya) shut down workers and socket readers
+	// TODO(aditya) shut down workers
 	log.Info("Shutting down server gracefully")
+	s.stopListening()
+	if s.cancelFlushes != nil {
+		s.cancelFlushes()
+	}
+	s.closeForwardConn()
+}
+
+// GracefulShutdown shuts down the server without losing the data it
+// has already received: it stops the listeners and the periodic
+// flushes, waits up to shutdown_drain_timeout for the workers to
+// process the metrics and spans that are queued, and then flushes to
+// all sinks, plugins and the forwarding destination one last time,
+// waiting for that flush to finish. The metrics that are still queued
+// when the deadline passes are dropped.
+func (s *Server) GracefulShutdown() {
+	log.WithField("timeout", s.shutdownDrainTimeout.String()).
+		Info("Shutting down server: draining queues and flushing")
+	s.stopListening()
+
+	dropped := s.drain(s.shutdownDrainTimeout)
+	flushed := s.flush(context.Background())
+	s.flushes.Wait()
+	s.closeForwardConn()
+
+	entry := log.WithFields(logrus.Fields{
+		"flushed": flushed,
+		"dropped": dropped,
+	})
+	if dropped > 0 {
+		entry.Warn("Shut down before the queues were drained; dropped the remaining metrics and spans")
+		return
+	}
+	entry.Info("Shut down after the final flush")
+}
+
+// stopListening stops the periodic flushes, and the listeners that
+// receive metrics and spans.
+func (s *Server) stopListening() {
 	close(s.shutdown)
+	if s.adminListener != nil {
+		s.adminListener.Close()
+	}
 	graceful.Shutdown()
 	s.gRPCStop()
+}
 
-	// Close the gRPC connection for forwarding
+// closeForwardConn closes the gRPC connection for forwarding, if
+// there is one.
+func (s *Server) closeForwardConn() {
 	if s.grpcForwardConn != nil {
 		s.grpcForwardConn.Close()
 	}
 }
 
+// queued returns the number of metrics and spans that are waiting to
+// be processed by the workers.
+func (s *Server) queued() int {
+	n := len(s.SpanChan)
+	for _, w := range s.Workers {
+		n += len(w.PacketChan) + len(w.ImportChan) + len(w.ImportMetricChan)
+	}
+	return n
+}
+
+// drain waits until the workers have processed everything that's
+// queued for them, or until the timeout passes, and returns the number
+// of metrics and spans that are left in the queues. Once the queues are
+// empty, it also waits for the workers to finish with what they took
+// off them.
+func (s *Server) drain(timeout time.Duration) int {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		if s.queued() == 0 && s.waitIdle(ctx) && s.queued() == 0 {
+			return 0
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return s.queued()
+		}
+	}
+}
+
+// barrier is handed to each goroutine of a worker by drain. A goroutine
+// that receives it has finished with everything it took off its
+// channels; it checks in, and then waits for drain to release it, so
+// that no goroutine receives the barrier twice.
+type barrier struct {
+	arrived chan struct{}
+	release chan struct{}
+}
+
+func (b barrier) wait() {
+	b.arrived <- struct{}{}
+	<-b.release
+}
+
+// waitIdle waits until the span workers' goroutines, and then the
+// metric workers, are between two items of their queues. The span
+// workers go first, since the spans they process can produce metrics.
+// It returns false if ctx is done first.
+func (s *Server) waitIdle(ctx context.Context) bool {
+	if s.SpanWorker != nil && !passBarrier(ctx, s.SpanWorker.barriers, s.SpanWorkerGoroutines) {
+		return false
+	}
+	for _, w := range s.Workers {
+		if !passBarrier(ctx, w.barriers, 1) {
+			return false
+		}
+	}
+	return true
+}
+
+// passBarrier hands a barrier to the n goroutines that receive from ch,
+// and waits for all of them to check in.
+func passBarrier(ctx context.Context, ch chan<- barrier, n int) bool {
+	b := barrier{arrived: make(chan struct{}, n), release: make(chan struct{})}
+	defer close(b.release)
+	for i := 0; i < n; i++ {
+		select {
+		case ch <- b:
+		case <-ctx.Done():
+			return false
+		}
+	}
+	for i := 0; i < n; i++ {
+		select {
+		case <-b.arrived:
+		case <-ctx.Done():
+			return false
+		}
+	}
+	return true
+}
+
 // IsLocal indicates whether veneur is running as a local instance
 // (forwarding non-local data to a global veneur instance) or is running as a global
 // instance (sending all data directly to the final destination).
@@ -1234,6 +2321,224 @@ func setSinkExcludedTags(excludeRules []string, metricSinks []sinks.MetricSink)
 	}
 }
 
+// newMetricSinkFilters returns the filters that the options configure
+// for each metric sink, by sink name.
+func newMetricSinkFilters(options map[string]MetricSinkOptions, metricSinks []sinks.MetricSink) map[string]*sinks.MetricFilter {
+	filters := map[string]*sinks.MetricFilter{}
+	for name, opts := range options {
+		if len(opts.AllowNames) == 0 && len(opts.DenyNames) == 0 &&
+			len(opts.RequireTags) == 0 && len(opts.ForbidTags) == 0 {
+			continue
+		}
+		filters[name] = sinks.NewMetricFilter(opts.AllowNames, opts.DenyNames, opts.RequireTags, opts.ForbidTags)
+	}
+	for name := range options {
+		found := false
+		for _, sink := range metricSinks {
+			if sink.Name() == name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			log.WithField("sink", name).Warn("Options are configured for a metric sink that isn't enabled")
+		}
+	}
+	return filters
+}
+
+// newMetricRouter returns a router for the routes in conf, to the
+// metric sinks and the server's plugins, or nil if there are no routes.
+func (s *Server) newMetricRouter(conf Config, metricSinks []sinks.MetricSink) *sinks.MetricRouter {
+	if len(conf.MetricRoutes) == 0 {
+		if len(conf.MetricDefaultRoute) > 0 {
+			log.Warn("metric_default_route is set, but there are no metric_routes; ignoring it")
+		}
+		return nil
+	}
+
+	var destinations []string
+	for _, sink := range metricSinks {
+		destinations = append(destinations, sink.Name())
+	}
+	for _, p := range s.getPlugins() {
+		destinations = append(destinations, p.Name())
+	}
+	known := func(name string) bool {
+		for _, dest := range destinations {
+			if dest == name {
+				return true
+			}
+		}
+		return false
+	}
+	check := func(names []string) {
+		for _, name := range names {
+			if !known(name) {
+				log.WithField("sink", name).Warn("Metrics are routed to a metric sink or plugin that isn't enabled")
+			}
+		}
+	}
+
+	routes := make([]sinks.MetricRoute, len(conf.MetricRoutes))
+	for i, route := range conf.MetricRoutes {
+		check(route.Sinks)
+		routes[i] = sinks.MetricRoute{
+			Filter:       sinks.NewMetricFilter(route.AllowNames, route.DenyNames, route.RequireTags, route.ForbidTags),
+			Destinations: route.Sinks,
+		}
+	}
+	defaults := destinations
+	if len(conf.MetricDefaultRoute) > 0 {
+		check(conf.MetricDefaultRoute)
+		defaults = conf.MetricDefaultRoute
+	}
+	return sinks.NewMetricRouter(routes, defaults)
+}
+
+// newMetricSinkTags returns the tag injectors that the options
+// configure for each metric sink, by sink name.
+func newMetricSinkTags(options map[string]MetricSinkOptions) map[string]*sinks.TagInjector {
+	injectors := map[string]*sinks.TagInjector{}
+	for name, opts := range options {
+		if len(opts.AddTags) > 0 {
+			injectors[name] = sinks.NewTagInjector(opts.AddTags, opts.Overwrite)
+		}
+	}
+	return injectors
+}
+
+// newMetricSinkSanitizers returns the sanitizer of each metric sink,
+// by sink name: the one that its options configure, if any, and
+// otherwise its own, if it is a sinks.SanitizingSink.
+func newMetricSinkSanitizers(options map[string]MetricSinkOptions, metricSinks []sinks.MetricSink) map[string]sinks.Sanitizer {
+	sanitizers := map[string]sinks.Sanitizer{}
+	for _, sink := range metricSinks {
+		if opts, ok := options[sink.Name()]; ok && opts.Sanitize != nil {
+			sanitizers[sink.Name()] = opts.Sanitize.rules()
+		} else if ss, ok := sink.(sinks.SanitizingSink); ok {
+			sanitizers[sink.Name()] = ss.Sanitizer()
+		}
+	}
+	return sanitizers
+}
+
+// wrapRetryingSinks wraps the metric sinks whose options configure
+// retries in a RetryingSink.
+func wrapRetryingSinks(options map[string]MetricSinkOptions, metricSinks []sinks.MetricSink, interval time.Duration, log *logrus.Logger) ([]sinks.MetricSink, error) {
+	parse := func(name, key, value string) (time.Duration, error) {
+		if value == "" {
+			return 0, nil
+		}
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return 0, fmt.Errorf("invalid %s for metric sink %s: %v", key, name, err)
+		}
+		return d, nil
+	}
+
+	for i, sink := range metricSinks {
+		opts, ok := options[sink.Name()]
+		if !ok || opts.RetryMaxAttempts < 2 {
+			continue
+		}
+		backoff, err := parse(sink.Name(), "retry_backoff", opts.RetryBackoff)
+		if err != nil {
+			return nil, err
+		}
+		maxBackoff, err := parse(sink.Name(), "retry_max_backoff", opts.RetryMaxBackoff)
+		if err != nil {
+			return nil, err
+		}
+		timeout, err := parse(sink.Name(), "retry_timeout", opts.RetryTimeout)
+		if err != nil {
+			return nil, err
+		}
+		if timeout == 0 {
+			timeout = interval
+		}
+		var fallback plugins.Plugin
+		if opts.RetryFallbackFile != "" {
+			fallback = &localfilep.Plugin{FilePath: opts.RetryFallbackFile, Logger: log}
+		}
+		metricSinks[i] = sinks.NewRetryingSink(sink, opts.RetryMaxAttempts, backoff, maxBackoff, timeout, fallback, log)
+	}
+	return metricSinks, nil
+}
+
+// wrapSpillingSinks wraps the metric sinks whose options configure a
+// spill directory in a SpillingSink.
+func wrapSpillingSinks(options map[string]MetricSinkOptions, metricSinks []sinks.MetricSink, log *logrus.Logger) ([]sinks.MetricSink, error) {
+	for i, sink := range metricSinks {
+		opts, ok := options[sink.Name()]
+		if !ok || opts.SpillDirectory == "" {
+			continue
+		}
+		spilling, err := sinks.NewSpillingSink(sink, opts.SpillDirectory, opts.SpillMaxBytes, log)
+		if err != nil {
+			return nil, fmt.Errorf("invalid spill_directory for metric sink %s: %v", sink.Name(), err)
+		}
+		metricSinks[i] = spilling
+	}
+	return metricSinks, nil
+}
+
+// wrapAsyncSinks wraps the metric sinks whose options configure an
+// asynchronous queue. Retries, if any, happen on the queue's workers.
+func wrapAsyncSinks(options map[string]MetricSinkOptions, metricSinks []sinks.MetricSink, log *logrus.Logger) []sinks.MetricSink {
+	for i, sink := range metricSinks {
+		opts, ok := options[sink.Name()]
+		if !ok || opts.AsyncQueueSize < 1 {
+			continue
+		}
+		metricSinks[i] = sinks.NewAsyncSink(sink, opts.AsyncQueueSize, opts.AsyncWorkers, log)
+	}
+	return metricSinks
+}
+
+// wrapBufferingSinks wraps the metric sinks whose options configure a
+// flush interval longer than the server's in a BufferingSink.
+func wrapBufferingSinks(options map[string]MetricSinkOptions, metricSinks []sinks.MetricSink, interval time.Duration) ([]sinks.MetricSink, error) {
+	for i, sink := range metricSinks {
+		opts, ok := options[sink.Name()]
+		if !ok || opts.FlushInterval == "" || interval <= 0 {
+			continue
+		}
+		sinkInterval, err := time.ParseDuration(opts.FlushInterval)
+		if err != nil {
+			return nil, fmt.Errorf("invalid flush_interval for metric sink %s: %v", sink.Name(), err)
+		}
+		every := int((sinkInterval + interval - 1) / interval)
+		if every < 2 {
+			continue
+		}
+		metricSinks[i] = sinks.NewBufferingSink(sink, every)
+	}
+	return metricSinks, nil
+}
+
+// histogramBuckets returns the configured bucket bounds sorted in
+// ascending order, without duplicates or NaNs.
+func histogramBuckets(bounds []float64) []float64 {
+	sorted := make([]float64, 0, len(bounds))
+	for _, b := range bounds {
+		if !math.IsNaN(b) {
+			sorted = append(sorted, b)
+		}
+	}
+	sort.Float64s(sorted)
+	buckets := sorted[:0]
+	for _, b := range sorted {
+		if len(buckets) == 0 || b != buckets[len(buckets)-1] {
+			buckets = append(buckets, b)
+		}
+	}
+	if len(buckets) == 0 {
+		return nil
+	}
+	return buckets
+}
+
 func generateExcludedTags(excludeRules []string, sinkName string) []string {
 	excludedTags := make([]string, 0, len(excludeRules))
 	for _, rule := range excludeRules {
@@ -2,20 +2,30 @@ package veneur
 
 import (
 	"context"
+	"encoding/binary"
 	"encoding/json"
 	"io"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stripe/veneur/samplers"
+	"github.com/stripe/veneur/sinks"
 	"github.com/stripe/veneur/sinks/datadog"
 	"github.com/stripe/veneur/sinks/lightstep"
+	"github.com/stripe/veneur/sinks/otlp"
+	"github.com/stripe/veneur/sinks/otlp/otlpmetrics"
+	ocontext "golang.org/x/net/context"
+	"google.golang.org/grpc"
 )
 
 func TestFlushTracesBySink(t *testing.T) {
@@ -86,6 +96,8 @@ func testFlushTraceDatadog(t *testing.T, protobuf, jsn io.Reader) {
 	config := globalConfig()
 	config.DatadogAPIKey = "secret"
 	config.DatadogTraceAPIAddress = remoteServer.URL
+	// one of the fixtures has no service:
+	config.SpanValidation = "repair"
 
 	server := setupVeneurServer(t, config, nil, nil, nil)
 	defer server.Shutdown()
@@ -118,6 +130,7 @@ func testFlushTraceDatadog(t *testing.T, protobuf, jsn io.Reader) {
 // implementation doesn't expose itself for mocking.
 func testFlushTraceLightstep(t *testing.T, protobuf, jsn io.Reader) {
 	config := globalConfig()
+	config.SpanValidation = "repair"
 
 	// this can be anything as long as it's not empty
 	config.LightstepAccessToken = "secret"
@@ -162,3 +175,213 @@ func TestNewDatadogMetricSinkConfig(t *testing.T) {
 	// Verify that the values got set	assert.Equal(t, "apikey", sink.APIKey)
 	assert.Equal(t, "http://api", sink.DDHostname)
 }
+
+func TestNewRetryingMetricSinkConfig(t *testing.T) {
+	config := Config{
+		DatadogAPIKey:      "apikey",
+		DatadogAPIHostname: "http://api",
+		MetricSinkOptions: map[string]MetricSinkOptions{
+			"datadog": {RetryMaxAttempts: 3, RetryBackoff: "100ms"},
+		},
+
+		// required or NewFromConfig fails
+		Interval:     "10s",
+		StatsAddress: "localhost:62251",
+	}
+	server, err := NewFromConfig(logrus.New(), config)
+	require.NoError(t, err)
+	sink, ok := server.metricSinks[0].(*sinks.RetryingSink)
+	require.True(t, ok, "the datadog sink should retry flushes")
+	assert.Equal(t, "datadog", sink.Name())
+
+	config.MetricSinkOptions["datadog"] = MetricSinkOptions{RetryMaxAttempts: 3, RetryBackoff: "soon"}
+	_, err = NewFromConfig(logrus.New(), config)
+	assert.Error(t, err)
+}
+
+func TestNewAsyncMetricSinkConfig(t *testing.T) {
+	config := Config{
+		DatadogAPIKey:      "apikey",
+		DatadogAPIHostname: "http://api",
+		MetricSinkOptions: map[string]MetricSinkOptions{
+			"datadog": {AsyncQueueSize: 8, AsyncWorkers: 2, RetryMaxAttempts: 3},
+		},
+
+		// required or NewFromConfig fails
+		Interval:     "10s",
+		StatsAddress: "localhost:62251",
+	}
+	server, err := NewFromConfig(logrus.New(), config)
+	require.NoError(t, err)
+	sink, ok := server.metricSinks[0].(*sinks.AsyncSink)
+	require.True(t, ok, "the datadog sink should flush asynchronously")
+	assert.Equal(t, "datadog", sink.Name())
+}
+
+func TestSinkHTTPClientKeepAlive(t *testing.T) {
+	newConns := func(opts map[string]MetricSinkOptions) int {
+		var mtx sync.Mutex
+		conns := 0
+		srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			io.Copy(ioutil.Discard, r.Body)
+			w.WriteHeader(http.StatusAccepted)
+		}))
+		srv.Config.ConnState = func(c net.Conn, state http.ConnState) {
+			if state == http.StateNew {
+				mtx.Lock()
+				conns++
+				mtx.Unlock()
+			}
+		}
+		srv.Start()
+		defer srv.Close()
+
+		config := Config{
+			DatadogAPIKey:          "apikey",
+			DatadogAPIHostname:     srv.URL,
+			DatadogFlushMaxPerBody: 1000,
+			MetricSinkOptions:      opts,
+
+			// required or NewFromConfig fails
+			Interval:     "10s",
+			StatsAddress: "localhost:62251",
+		}
+		server, err := NewFromConfig(logrus.New(), config)
+		require.NoError(t, err)
+		sink := server.metricSinks[0].(*datadog.DatadogMetricSink)
+
+		metrics := []samplers.InterMetric{{
+			Name:      "a.b.c",
+			Timestamp: time.Now().Unix(),
+			Value:     1.0,
+			Type:      samplers.GaugeMetric,
+		}}
+		for i := 0; i < 2; i++ {
+			require.NoError(t, sink.Flush(context.Background(), metrics))
+		}
+		mtx.Lock()
+		defer mtx.Unlock()
+		return conns
+	}
+
+	assert.Equal(t, 1, newConns(nil), "consecutive flushes should reuse the connection")
+	assert.Equal(t, 2, newConns(map[string]MetricSinkOptions{
+		"datadog": {HTTP: &HTTPClientOptions{DisableKeepAlives: true}},
+	}), "the sink's own client shouldn't keep connections alive")
+}
+
+func TestSinkHTTPClientInvalidOptions(t *testing.T) {
+	config := Config{
+		DatadogAPIKey:      "apikey",
+		DatadogAPIHostname: "http://api",
+		MetricSinkOptions: map[string]MetricSinkOptions{
+			"datadog": {HTTP: &HTTPClientOptions{IdleConnTimeout: "soon"}},
+		},
+
+		// required or NewFromConfig fails
+		Interval:     "10s",
+		StatsAddress: "localhost:62251",
+	}
+	_, err := NewFromConfig(logrus.New(), config)
+	assert.Error(t, err)
+
+	config.MetricSinkOptions = nil
+	config.HTTPMaxIdleConnsPerHost = -1
+	_, err = NewFromConfig(logrus.New(), config)
+	assert.Error(t, err)
+}
+
+func TestSinkHTTPClientSpanSinks(t *testing.T) {
+	for _, name := range []string{"datadog", "honeycomb", "zipkin"} {
+		config := Config{
+			// without datadog_api_hostname, there's only a datadog
+			// span sink:
+			DatadogAPIKey:          "apikey",
+			DatadogTraceAPIAddress: "http://trace",
+			HoneycombWriteKey:      "writekey",
+			ZipkinAddress:          "http://zipkin",
+			SsfListenAddresses:     []string{"udp://127.0.0.1:99"},
+			MetricSinkOptions: map[string]MetricSinkOptions{
+				name: {HTTP: &HTTPClientOptions{IdleConnTimeout: "soon"}},
+			},
+
+			// required or NewFromConfig fails
+			Interval:     "10s",
+			StatsAddress: "localhost:62251",
+		}
+		server, err := NewFromConfig(logrus.New(), config)
+		assert.Error(t, err, "the %s span sink should get a client of its own", name)
+		if err == nil {
+			server.Shutdown()
+		}
+	}
+}
+
+type otlpMetricsRecorder struct {
+	mtx      sync.Mutex
+	requests []*otlpmetrics.ExportMetricsServiceRequest
+}
+
+func (r *otlpMetricsRecorder) Export(ctx ocontext.Context, req *otlpmetrics.ExportMetricsServiceRequest) (*otlpmetrics.ExportMetricsServiceResponse, error) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.requests = append(r.requests, req)
+	return &otlpmetrics.ExportMetricsServiceResponse{}, nil
+}
+
+func TestFlushHistogramExemplarsOTLP(t *testing.T) {
+	recorder := &otlpMetricsRecorder{}
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	srv := grpc.NewServer()
+	otlpmetrics.RegisterMetricsServiceServer(srv, recorder)
+	go srv.Serve(lis)
+	defer srv.Stop()
+
+	sink, err := otlp.NewOTLPMetricSink(context.Background(), lis.Addr().String(), time.Hour, "localhost", nil, logrus.New(), grpc.WithInsecure())
+	require.NoError(t, err)
+
+	config := localConfig()
+	config.Interval = "1h"
+	config.HistogramMaxExemplars = 2
+	f := newFixture(t, config, sink, nil)
+	defer f.Close()
+
+	for _, packet := range []string{
+		"a.b.c:10|ms|#svc:api,trace_id:1",
+		"a.b.c:500|ms|#svc:api,trace_id:2",
+		"a.b.c:20|ms|#svc:api,trace_id:3",
+		"a.b.c:30|ms|#svc:api",
+	} {
+		m, err := samplers.ParseMetric([]byte(packet))
+		require.NoError(t, err)
+		f.server.Workers[0].ProcessMetric(m)
+	}
+	f.server.Flush(context.TODO())
+
+	recorder.mtx.Lock()
+	defer recorder.mtx.Unlock()
+	require.Len(t, recorder.requests, 1)
+	var max *otlpmetrics.Gauge
+	for _, m := range recorder.requests[0].ResourceMetrics[0].ScopeMetrics[0].Metrics {
+		if m.Name == "a.b.c.max" {
+			max = m.GetGauge()
+		}
+	}
+	require.NotNil(t, max, "the max should be exported as a gauge: %v", recorder.requests[0])
+	require.Len(t, max.DataPoints, 1, "the trace ID shouldn't make a series of its own")
+	pt := max.DataPoints[0]
+	require.Len(t, pt.Attributes, 1)
+	assert.Equal(t, "svc", pt.Attributes[0].Key)
+
+	require.Len(t, pt.Exemplars, 2, "the exemplars with the highest values should be kept")
+	for i, want := range []struct {
+		value   float64
+		traceID uint64
+	}{{500, 2}, {20, 3}} {
+		assert.Equal(t, want.value, pt.Exemplars[i].GetAsDouble())
+		require.Len(t, pt.Exemplars[i].TraceId, 16)
+		assert.Equal(t, want.traceID, binary.BigEndian.Uint64(pt.Exemplars[i].TraceId[8:]))
+		assert.NotZero(t, pt.Exemplars[i].TimeUnixNano)
+	}
+}
@@ -18,6 +18,8 @@ import (
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"sort"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -25,15 +27,22 @@ import (
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/stripe/veneur/forwardrpc"
+	vhttp "github.com/stripe/veneur/http"
 	"github.com/stripe/veneur/protocol"
 	"github.com/stripe/veneur/samplers"
 	"github.com/stripe/veneur/sinks"
 	"github.com/stripe/veneur/sinks/blackhole"
 	"github.com/stripe/veneur/ssf"
 	"github.com/stripe/veneur/tdigest"
+	"github.com/stripe/veneur/tlsconfig"
+	"github.com/stripe/veneur/tlsconfig/tlstest"
 	"github.com/stripe/veneur/trace"
 	"github.com/stripe/veneur/trace/metrics"
 	"github.com/zenazn/goji/graceful"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"gopkg.in/yaml.v2"
 )
 
 const ε = .00002
@@ -168,6 +177,8 @@ func setupVeneurServer(t testing.TB, config Config, transport http.RoundTripper,
 
 type channelMetricSink struct {
 	metricsChannel chan []samplers.InterMetric
+	// name overrides the sink's name, if set.
+	name string
 }
 
 // NewChannelMetricSink creates a new channelMetricSink. This sink writes any
@@ -180,6 +191,9 @@ func NewChannelMetricSink(ch chan []samplers.InterMetric) (*channelMetricSink, e
 }
 
 func (c *channelMetricSink) Name() string {
+	if c.name != "" {
+		return c.name
+	}
 	return "channel"
 }
 
@@ -291,6 +305,168 @@ func TestGlobalServerFlush(t *testing.T) {
 	assert.Equal(t, len(expectedMetrics), len(interMetrics), "incorrect number of elements in the flushed series on the remote server")
 }
 
+func TestFlushMinMax(t *testing.T) {
+	config := localConfig()
+	config.Aggregates = []string{"count"}
+	config.Percentiles = nil
+	config.FlushMinMax = true
+
+	metricsChan := make(chan []samplers.InterMetric, 10)
+	cms, _ := NewChannelMetricSink(metricsChan)
+	defer close(metricsChan)
+
+	f := newFixture(t, config, cms, nil)
+	defer f.Close()
+	assert.Equal(t, 3, f.server.HistogramAggregates.Count)
+
+	intervals := [][]float64{
+		{0.001, 5, 123456.789, -3.25},
+		{42, 17},
+	}
+	for _, values := range intervals {
+		for _, value := range values {
+			f.server.Workers[0].ProcessMetric(&samplers.UDPMetric{
+				MetricKey: samplers.MetricKey{
+					Name: "a.b.c",
+					Type: "histogram",
+				},
+				Value:      value,
+				Digest:     12345,
+				SampleRate: 1.0,
+				Scope:      samplers.LocalOnly,
+			})
+		}
+		f.server.Flush(context.TODO())
+
+		flushed := map[string]float64{}
+		for _, m := range <-metricsChan {
+			flushed[m.Name] = m.Value
+		}
+		sorted := append([]float64{}, values...)
+		sort.Float64s(sorted)
+		assert.Equal(t, sorted[0], flushed["a.b.c.min"])
+		assert.Equal(t, sorted[len(sorted)-1], flushed["a.b.c.max"])
+	}
+}
+
+func TestFlushCustomPercentiles(t *testing.T) {
+	config := globalConfig()
+	config.Aggregates = nil
+	config.Percentiles = []float64{0.25, 0.75, 0.999, 0.9999}
+	config.PercentileNaming = "p"
+
+	metricsChan := make(chan []samplers.InterMetric, 10)
+	cms, _ := NewChannelMetricSink(metricsChan)
+	defer close(metricsChan)
+
+	f := newFixture(t, config, cms, nil)
+	defer f.Close()
+
+	for i := 1; i <= 10000; i++ {
+		f.server.Workers[0].ProcessMetric(&samplers.UDPMetric{
+			MetricKey: samplers.MetricKey{
+				Name: "a.b.c",
+				Type: "histogram",
+			},
+			Value:      float64(i),
+			Digest:     12345,
+			SampleRate: 1.0,
+			Scope:      samplers.LocalOnly,
+		})
+	}
+	f.server.Flush(context.TODO())
+
+	flushed := map[string]float64{}
+	for _, m := range <-metricsChan {
+		flushed[m.Name] = m.Value
+	}
+	require.Len(t, flushed, 4)
+	assert.InDelta(t, 2500, flushed["a.b.c.p25"], 50)
+	assert.InDelta(t, 7500, flushed["a.b.c.p75"], 50)
+	assert.InDelta(t, 9990, flushed["a.b.c.p99_9"], 5)
+	assert.InDelta(t, 9999, flushed["a.b.c.p99_99"], 1)
+}
+
+func TestFlushHistogramAggregates(t *testing.T) {
+	configs := map[string]func() Config{
+		"global": func() Config {
+			config := localConfig()
+			config.Aggregates = []string{"count", "p99"}
+			config.Percentiles = nil
+			return config
+		},
+		"override": func() Config {
+			config := localConfig()
+			require.NoError(t, yaml.Unmarshal([]byte(`
+histogram_aggregates_overrides:
+  - name: "db.*"
+    aggregates: ["max"]
+  - name: "a.*"
+    aggregates: ["count", "p99"]
+`), &config))
+			return config
+		},
+	}
+	for name, config := range configs {
+		config := config
+		t.Run(name, func(t *testing.T) {
+			metricsChan := make(chan []samplers.InterMetric, 10)
+			cms, _ := NewChannelMetricSink(metricsChan)
+			defer close(metricsChan)
+
+			f := newFixture(t, config(), cms, nil)
+			defer f.Close()
+
+			for i := 1; i <= 1000; i++ {
+				f.server.Workers[0].ProcessMetric(&samplers.UDPMetric{
+					MetricKey: samplers.MetricKey{
+						Name: "a.b.c",
+						Type: "histogram",
+					},
+					Value:      float64(i),
+					Digest:     12345,
+					SampleRate: 1.0,
+					Scope:      samplers.LocalOnly,
+				})
+			}
+			f.server.Flush(context.TODO())
+
+			flushed := map[string]float64{}
+			for _, m := range <-metricsChan {
+				flushed[m.Name] = m.Value
+			}
+			require.Len(t, flushed, 2)
+			assert.Equal(t, float64(1000), flushed["a.b.c.count"])
+			assert.InDelta(t, 990, flushed["a.b.c.99percentile"], 10)
+		})
+	}
+}
+
+func TestInvalidAggregates(t *testing.T) {
+	config := localConfig()
+	config.Aggregates = []string{"count", "p100"}
+	_, err := NewFromConfig(logrus.New(), config)
+	assert.Error(t, err)
+
+	config = localConfig()
+	require.NoError(t, yaml.Unmarshal([]byte(`
+histogram_aggregates_overrides:
+  - name: "a.*"
+    aggregates: ["count", "mode"]
+`), &config))
+	_, err = NewFromConfig(logrus.New(), config)
+	assert.Error(t, err)
+}
+
+func TestInvalidPercentiles(t *testing.T) {
+	for _, percentiles := range [][]float64{{0.5, 1}, {0}, {-0.1}, {99}} {
+		config := globalConfig()
+		config.Percentiles = percentiles
+		_, err := NewFromConfig(logrus.New(), config)
+		assert.Error(t, err, "percentiles %v", percentiles)
+	}
+}
+
 // TestLocalServerMixedMetrics ensures that stuff tagged as local only or local parts of mixed
 // scope metrics are sent directly to sinks while global metrics are forwarded.
 func TestLocalServerMixedMetrics(t *testing.T) {
@@ -477,6 +653,21 @@ func readTestKeysCerts() (map[string]string, error) {
 	return pems, nil
 }
 
+func TestSetPrecisionConfig(t *testing.T) {
+	config := localConfig()
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+
+	config.SetPrecision = 15
+	_, err := NewFromConfig(logger, config)
+	assert.Error(t, err, "precision 15 is not supported")
+
+	config.SetPrecision = 16
+	server, err := NewFromConfig(logger, config)
+	require.NoError(t, err)
+	assert.Equal(t, 16, server.Workers[0].setPrecision)
+}
+
 // TestTCPConfig checks that invalid configurations are errors
 func TestTCPConfig(t *testing.T) {
 	config := localConfig()
@@ -554,6 +745,160 @@ func sendTCPMetrics(a *net.TCPAddr, tlsConfig *tls.Config, f *fixture) error {
 	return nil
 }
 
+// TestTCPMetricsTLSFiles verifies that a TCP listener configured
+// with TLS files that include an authority rejects clients without a
+// certificate signed by it.
+func TestTCPMetricsTLSFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "veneur-tls")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	ca, err := tlstest.NewAuthority("veneur-ca")
+	require.NoError(t, err)
+	serverFiles, err := ca.WriteFiles(dir, "server")
+	require.NoError(t, err)
+	clientFiles, err := ca.WriteFiles(dir, "client")
+	require.NoError(t, err)
+	otherCA, err := tlstest.NewAuthority("other-ca")
+	require.NoError(t, err)
+	untrustedFiles, err := otherCA.WriteFiles(dir, "untrusted")
+	require.NoError(t, err)
+
+	trusted, err := tlsconfig.Load(clientFiles)
+	require.NoError(t, err)
+	noCert, err := tlsconfig.Load(tlsconfig.Files{Authority: clientFiles.Authority})
+	require.NoError(t, err)
+	untrusted, err := tlsconfig.Load(tlsconfig.Files{
+		Certificate: untrustedFiles.Certificate,
+		Key:         untrustedFiles.Key,
+		Authority:   clientFiles.Authority,
+	})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name   string
+		client *tls.Config
+		ok     bool
+	}{
+		{"trusted client certificate", trusted.ClientConfig(), true},
+		{"no client certificate", noCert.ClientConfig(), false},
+		{"untrusted client certificate", untrusted.ClientConfig(), false},
+		{"plain TCP", nil, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := localConfig()
+			config.Interval = "60s"
+			config.NumWorkers = 1
+			config.StatsdListenAddresses = []string{"tcp://127.0.0.1:0"}
+			config.TLSCertificateFile = serverFiles.Certificate
+			config.TLSKeyFile = serverFiles.Key
+			config.TLSAuthorityCertificateFile = serverFiles.Authority
+			f := newFixture(t, config, nil, nil)
+			defer f.Close()
+
+			err := sendTCPMetrics(f.server.StatsdListenAddrs[0].(*net.TCPAddr), test.client, f)
+			if test.ok {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err, "the connection should have been rejected")
+			}
+		})
+	}
+}
+
+func TestTLSFilesConflict(t *testing.T) {
+	config := localConfig()
+	config.TLSKey = "key"
+	config.TLSCertificate = "certificate"
+	config.TLSCertificateFile = "server.crt"
+	config.TLSKeyFile = "server.key"
+	_, err := NewFromConfig(logrus.New(), config)
+	assert.Error(t, err)
+}
+
+// TestImportMutualTLS verifies that a global veneur that serves its
+// HTTP and gRPC imports with TLS files that include an authority
+// accepts the forwards of a local veneur with a certificate signed by
+// it, and rejects clients without one.
+func TestImportMutualTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "veneur-tls")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	ca, err := tlstest.NewAuthority("veneur-ca")
+	require.NoError(t, err)
+	serverFiles, err := ca.WriteFiles(dir, "server")
+	require.NoError(t, err)
+	clientFiles, err := ca.WriteFiles(dir, "client")
+	require.NoError(t, err)
+	noCert, err := tlsconfig.Load(tlsconfig.Files{Authority: clientFiles.Authority})
+	require.NoError(t, err)
+
+	config := globalConfig()
+	config.GrpcAddress = "127.0.0.1:0"
+	config.HTTPTLS = true
+	config.GrpcTLS = true
+	config.TLSCertificateFile = serverFiles.Certificate
+	config.TLSKeyFile = serverFiles.Key
+	config.TLSAuthorityCertificateFile = serverFiles.Authority
+	global, err := NewFromConfig(logrus.New(), config)
+	require.NoError(t, err)
+
+	httpLn, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer httpLn.Close()
+	go http.Serve(global.httpListener(httpLn), global.Handler())
+	grpcLn, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go global.grpcServer.Server.Serve(grpcLn)
+	defer global.grpcServer.Stop()
+
+	lconfig := localConfig()
+	lconfig.ForwardAddress = "https://" + httpLn.Addr().String()
+	lconfig.ForwardTLSCertificateFile = clientFiles.Certificate
+	lconfig.ForwardTLSKeyFile = clientFiles.Key
+	lconfig.ForwardTLSAuthorityCertificateFile = clientFiles.Authority
+	local, err := NewFromConfig(logrus.New(), lconfig)
+	require.NoError(t, err)
+
+	t.Run("http", func(t *testing.T) {
+		counter := samplers.NewCounter("a.b.c", nil)
+		counter.Sample(1, 1.0)
+		jm, err := counter.Export()
+		require.NoError(t, err)
+		endpoint := lconfig.ForwardAddress + "/import"
+		post := func(cl *http.Client) error {
+			return vhttp.PostHelper(context.Background(), cl, local.TraceClient, http.MethodPost, endpoint, []samplers.JSONMetric{jm}, "forward", true, nil, logrus.New())
+		}
+		assert.NoError(t, post(local.forwardHTTPClient), "the local veneur's forwards should be accepted")
+		assert.Error(t, post(&http.Client{Transport: &http.Transport{TLSClientConfig: noCert.ClientConfig()}}),
+			"a client without a certificate should be rejected")
+		assert.Error(t, post(&http.Client{}), "a client without TLS should be rejected")
+	})
+
+	t.Run("grpc", func(t *testing.T) {
+		send := func(creds credentials.TransportCredentials) error {
+			conn, err := grpc.Dial(grpcLn.Addr().String(), grpc.WithTransportCredentials(creds))
+			require.NoError(t, err)
+			defer conn.Close()
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			_, err = forwardrpc.NewForwardClient(conn).SendMetrics(ctx, &forwardrpc.MetricList{})
+			return err
+		}
+		assert.NoError(t, send(credentials.NewTLS(local.forwardTLS.ClientConfig())), "the local veneur's forwards should be accepted")
+		assert.Error(t, send(credentials.NewTLS(noCert.ClientConfig())), "a client without a certificate should be rejected")
+	})
+}
+
+func TestImportTLSNeedsCertificate(t *testing.T) {
+	config := globalConfig()
+	config.HTTPTLS = true
+	_, err := NewFromConfig(logrus.New(), config)
+	assert.Error(t, err)
+}
+
 func TestUDPMetrics(t *testing.T) {
 	config := localConfig()
 	config.NumWorkers = 1
@@ -909,6 +1254,56 @@ func TestHandleTCPGoroutineTimeout(t *testing.T) {
 	}
 }
 
+// TestHandleTCPGoroutineSplitLines verifies that lines split across
+// reads on a TCP connection are reassembled.
+func TestHandleTCPGoroutineSplitLines(t *testing.T) {
+	s := &Server{tcpReadTimeout: time.Second, Workers: []*Worker{
+		&Worker{PacketChan: make(chan samplers.UDPMetric, 10)},
+	}}
+
+	client, server := net.Pipe()
+	go func() {
+		defer client.Close()
+		for _, chunk := range []string{"a.count:1|c\nb.gau", "ge:2|g|#foo:bar\n", "c.timer:3|ms\n"} {
+			if _, err := client.Write([]byte(chunk)); err != nil {
+				t.Error("expected Write to succeed:", err)
+				return
+			}
+		}
+	}()
+	s.handleTCPGoroutine(server)
+
+	close(s.Workers[0].PacketChan)
+	var names []string
+	for packet := range s.Workers[0].PacketChan {
+		names = append(names, packet.Name)
+	}
+	assert.Equal(t, []string{"a.count", "b.gauge", "c.timer"}, names)
+}
+
+// TestHandleTCPGoroutineMaxLineLength verifies that a connection is
+// closed once a line exceeds the maximum length.
+func TestHandleTCPGoroutineMaxLineLength(t *testing.T) {
+	s := &Server{tcpReadTimeout: time.Second, tcpMaxLineLength: 16, Workers: []*Worker{
+		&Worker{PacketChan: make(chan samplers.UDPMetric, 10)},
+	}}
+
+	client, server := net.Pipe()
+	go func() {
+		defer client.Close()
+		client.Write([]byte("exactly.16:111|c\n"))
+		client.Write([]byte("much.too.long.metric:1|c\nnext:1|c\n"))
+	}()
+	s.handleTCPGoroutine(server)
+
+	close(s.Workers[0].PacketChan)
+	var names []string
+	for packet := range s.Workers[0].PacketChan {
+		names = append(names, packet.Name)
+	}
+	assert.Equal(t, []string{"exactly.16"}, names)
+}
+
 // This is necessary until we can import
 // github.com/sirupsen/logrus/test - it's currently failing due to dep
 // insisting on pulling the repo in with its capitalized name.
@@ -954,7 +1349,7 @@ func BenchmarkSendSSFUNIX(b *testing.B) {
 		b.Fatal(err)
 	}
 	// Simulate a metrics worker:
-	w := NewWorker(0, nil, nullLogger(), s.Statsd)
+	w := NewWorker(0, nil, nullLogger(), s.Statsd, nil, 0)
 	s.Workers = []*Worker{w}
 	go func() {
 	}()
@@ -1027,7 +1422,7 @@ func BenchmarkSendSSFUDP(b *testing.B) {
 	require.NoError(b, err)
 
 	// Simulate a metrics worker:
-	w := NewWorker(0, nil, nullLogger(), s.Statsd)
+	w := NewWorker(0, nil, nullLogger(), s.Statsd, nil, 0)
 	s.Workers = []*Worker{w}
 
 	go func() {
@@ -1156,6 +1551,76 @@ func TestSSFMetricsEndToEnd(t *testing.T) {
 	assert.Equal(t, 2, n, "Should have gotten the right number of metrics")
 }
 
+// TestSSFUnixgramEndToEnd sends a batch of framed SSF spans to a live
+// veneur in a single UNIX domain datagram and verifies that the
+// metrics on all of them have been received and processed.
+func TestSSFUnixgramEndToEnd(t *testing.T) {
+	tdir, err := ioutil.TempDir("", "e2etest")
+	require.NoError(t, err)
+	defer os.RemoveAll(tdir)
+
+	path := filepath.Join(tdir, "test.sock")
+	// a stale socket file must not keep veneur from listening:
+	require.NoError(t, ioutil.WriteFile(path, nil, 0600))
+
+	config := localConfig()
+	config.SsfListenAddresses = []string{"unixgram://" + path}
+	metricsChan := make(chan []samplers.InterMetric, 10)
+	cms, _ := NewChannelMetricSink(metricsChan)
+	f := newFixture(t, config, cms, nil)
+	defer f.Close()
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0666), info.Mode().Perm(), "the socket should be writable by everyone")
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: path, Net: "unixgram"})
+	require.NoError(t, err)
+	defer conn.Close()
+
+	// datagrams longer than trace_max_length_bytes are dropped:
+	_, err = conn.Write(make([]byte, config.TraceMaxLengthBytes+1))
+	require.NoError(t, err)
+
+	var batch bytes.Buffer
+	start := time.Now()
+	for id := int64(1); id <= 2; id++ {
+		_, err := protocol.WriteSSF(&batch, &ssf.SSFSpan{
+			Id:             id,
+			TraceId:        id,
+			Service:        "e2e_test",
+			StartTimestamp: start.UnixNano(),
+			EndTimestamp:   start.Add(time.Second).UnixNano(),
+			Metrics: []*ssf.SSFSample{
+				ssf.Count("some.counter", 1, map[string]string{"purpose": "testing", "span": fmt.Sprint(id)}),
+			},
+		})
+		require.NoError(t, err)
+	}
+	_, err = conn.Write(batch.Bytes())
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.TODO(), 500*time.Millisecond)
+	defer cancel()
+	go func() {
+		<-ctx.Done()
+		close(metricsChan)
+	}()
+	keepFlushing(ctx, f.server)
+
+	n := 0
+	for metrics := range metricsChan {
+		for _, m := range metrics {
+			for _, tag := range m.Tags {
+				if tag == "purpose:testing" {
+					n++
+				}
+			}
+		}
+	}
+	assert.Equal(t, 2, n, "Should have gotten the metrics of both spans")
+}
+
 // TestInternalSSFMetricsEndToEnd reports an SSF span with some
 // attached metrics to a live veneur through an internal trace
 // backeng, like that veneur server itself would be.
@@ -1362,6 +1827,192 @@ func TestServeStopHTTP(t *testing.T) {
 	}
 }
 
+func TestGracefulShutdownFlushesQueuedMetrics(t *testing.T) {
+	config := globalConfig()
+	// Only the final flush should send anything:
+	config.Interval = "1h"
+	config.ShutdownDrainTimeout = "5s"
+
+	metricsChan := make(chan []samplers.InterMetric, 10)
+	cms, _ := NewChannelMetricSink(metricsChan)
+	s := setupVeneurServer(t, config, nil, cms, nil)
+
+	for i := 0; i < 100; i++ {
+		require.NoError(t, s.HandleMetricPacket([]byte("a.b.c:1|c")))
+	}
+	require.NoError(t, s.HandleMetricPacket([]byte("x.y.z:2|g")))
+	s.GracefulShutdown()
+
+	select {
+	case ms := <-metricsChan:
+		values := map[string]float64{}
+		for _, m := range ms {
+			values[m.Name] = m.Value
+		}
+		assert.Equal(t, map[string]float64{"a.b.c": 100, "x.y.z": 2}, values)
+	default:
+		t.Fatal("the metrics that were queued before the shutdown weren't flushed")
+	}
+}
+
+func TestDrainDropsAfterTimeout(t *testing.T) {
+	// Nothing processes this worker's queue:
+	w := NewWorker(0, nil, logrus.New(), nil, nil, 0)
+	s := &Server{Workers: []*Worker{w}, SpanChan: make(chan *ssf.SSFSpan, 10)}
+	w.PacketChan <- samplers.UDPMetric{}
+	w.PacketChan <- samplers.UDPMetric{}
+	s.SpanChan <- &ssf.SSFSpan{}
+
+	assert.Equal(t, 3, s.drain(50*time.Millisecond))
+
+	<-w.PacketChan
+	<-w.PacketChan
+	<-s.SpanChan
+	// an idle worker answers drain's barrier:
+	go w.Work()
+	defer close(w.QuitChan)
+	assert.Equal(t, 0, s.drain(time.Second))
+}
+
+func TestDrainWaitsForBusyWorkers(t *testing.T) {
+	w := NewWorker(0, nil, logrus.New(), nil, nil, 0)
+	s := &Server{Workers: []*Worker{w}, SpanChan: make(chan *ssf.SSFSpan, 10)}
+	go w.Work()
+	defer close(w.QuitChan)
+
+	// Hold the worker up after it has taken a metric off its queue:
+	w.mutex.Lock()
+	w.PacketChan <- samplers.UDPMetric{
+		MetricKey:  samplers.MetricKey{Name: "a.b.c", Type: counterTypeName},
+		Value:      1.0,
+		SampleRate: 1.0,
+	}
+	for len(w.PacketChan) > 0 {
+		time.Sleep(time.Millisecond)
+	}
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		w.mutex.Unlock()
+	}()
+
+	assert.Equal(t, 0, s.drain(time.Second))
+	assert.Equal(t, int64(1), w.MetricsProcessedCount(), "drain should wait until the metric is processed")
+}
+
+func TestHandleSSFLimitsTags(t *testing.T) {
+	s := &Server{SpanChan: make(chan *ssf.SSFSpan, 1), spanMaxTags: 3, spanMaxTagLength: 8}
+	span := &ssf.SSFSpan{Id: 2, TraceId: 2, Service: "farm", Name: "harvest", StartTimestamp: 1, EndTimestamp: 2, Tags: map[string]string{}}
+	for i := 0; i < 1000; i++ {
+		span.Tags[fmt.Sprintf("tag%03d", i)] = "value"
+	}
+	span.Tags["tag000"] = "a much longer value"
+
+	s.handleSSF(span, "packet")
+	clamped := <-s.SpanChan
+	assert.Equal(t, map[string]string{"tag000": "a much l", "tag001": "value", "tag002": "value"}, clamped.Tags)
+
+	metrics, ok := s.ssfInternalMetrics.Load("service:farm,ssf_format:packet")
+	require.True(t, ok)
+	assert.Equal(t, int64(997), metrics.(*ssfServiceSpanMetrics).ssfTagsDroppedTotal)
+	assert.Equal(t, int64(1), metrics.(*ssfServiceSpanMetrics).ssfTagsTruncatedTotal)
+}
+
+func TestHandleSSFValidatesSpans(t *testing.T) {
+	valid := func() *ssf.SSFSpan {
+		return &ssf.SSFSpan{Id: 2, TraceId: 1, Service: "farm", Name: "harvest", StartTimestamp: 1, EndTimestamp: 2}
+	}
+	counts := func(s *Server) *ssfServiceSpanMetrics {
+		metrics, ok := s.ssfInternalMetrics.Load("service:farm,ssf_format:packet")
+		require.True(t, ok)
+		return metrics.(*ssfServiceSpanMetrics)
+	}
+
+	t.Run("reject", func(t *testing.T) {
+		s := &Server{SpanChan: make(chan *ssf.SSFSpan, 10)}
+		s.handleSSF(valid(), "packet")
+		assert.Len(t, s.SpanChan, 1)
+		<-s.SpanChan
+
+		backwards := valid()
+		backwards.StartTimestamp, backwards.EndTimestamp = 2, 1
+		s.handleSSF(backwards, "packet")
+		assert.Len(t, s.SpanChan, 0, "invalid spans should be dropped")
+
+		withMetrics := valid()
+		withMetrics.TraceId = 0
+		withMetrics.Metrics = []*ssf.SSFSample{ssf.Count("a.b.c", 1, nil)}
+		s.handleSSF(withMetrics, "packet")
+		require.Len(t, s.SpanChan, 1)
+		kept := <-s.SpanChan
+		assert.Equal(t, withMetrics.Metrics, kept.Metrics, "the metrics of invalid spans should be kept")
+		assert.Zero(t, kept.Id)
+
+		// spans that only carry metrics aren't validated:
+		s.handleSSF(&ssf.SSFSpan{Service: "farm", Metrics: withMetrics.Metrics}, "packet")
+		assert.Len(t, s.SpanChan, 1)
+
+		assert.Equal(t, int64(2), counts(s).ssfSpansInvalidTotal)
+		count, ok := s.ingestDrops.Load(ingestDropKey{source: ingestSourceSSF, reason: dropReasonInvalid})
+		require.True(t, ok)
+		assert.Equal(t, int64(2), atomic.LoadInt64(count.(*int64)))
+	})
+
+	t.Run("repair", func(t *testing.T) {
+		s := &Server{SpanChan: make(chan *ssf.SSFSpan, 10), spanRepair: true}
+		backwards := valid()
+		backwards.StartTimestamp, backwards.EndTimestamp = 2, 1
+		s.handleSSF(backwards, "packet")
+		require.Len(t, s.SpanChan, 1)
+		repaired := <-s.SpanChan
+		assert.Equal(t, int64(1), repaired.StartTimestamp)
+		assert.Equal(t, int64(2), repaired.EndTimestamp)
+
+		unnamed := valid()
+		unnamed.Name = ""
+		s.handleSSF(unnamed, "packet")
+		assert.Len(t, s.SpanChan, 0, "spans that can't be repaired should be dropped")
+
+		assert.Equal(t, int64(1), counts(s).ssfSpansRepairedTotal)
+		assert.Equal(t, int64(1), counts(s).ssfSpansInvalidTotal)
+	})
+
+	config := localConfig()
+	config.SpanValidation = "ignore"
+	_, err := NewFromConfig(logrus.New(), config)
+	assert.Error(t, err)
+}
+
+func TestIngestDropsWhenFull(t *testing.T) {
+	w := NewWorker(0, nil, nullLogger(), nil, nil, 0)
+	s := &Server{
+		Workers:            []*Worker{w},
+		SpanChan:           make(chan *ssf.SSFSpan, 1),
+		ingestDropWhenFull: true,
+	}
+	dropped := func(source, reason string) int64 {
+		count, ok := s.ingestDrops.Load(ingestDropKey{source: source, reason: reason})
+		if !ok {
+			return 0
+		}
+		return atomic.LoadInt64(count.(*int64))
+	}
+
+	// nobody reads the worker's queue, so it fills up:
+	for i := 0; i < cap(w.PacketChan)+5; i++ {
+		require.NoError(t, s.HandleMetricPacket([]byte("a.b.c:1|c")))
+	}
+	assert.Equal(t, cap(w.PacketChan), len(w.PacketChan))
+	assert.Equal(t, int64(5), dropped(ingestSourceStatsd, dropReasonQueueFull))
+
+	assert.Error(t, s.HandleMetricPacket([]byte("a.b.c:nope|c")))
+	assert.Equal(t, int64(1), dropped(ingestSourceStatsd, dropReasonParseError))
+
+	for i := 0; i < 3; i++ {
+		s.handleSSF(&ssf.SSFSpan{Id: 1, TraceId: 1, Service: "farm", Name: "harvest", StartTimestamp: 1, EndTimestamp: 2}, "packet")
+	}
+	assert.Equal(t, int64(2), dropped(ingestSourceSSF, dropReasonQueueFull))
+}
+
 func BenchmarkHandleTracePacket(b *testing.B) {
 	const LEN = 1000
 	input := generateSSFPackets(b, LEN)
@@ -1399,3 +2050,120 @@ func BenchmarkHandleSSF(b *testing.B) {
 		f.server.handleSSF(spans[i%LEN], "packet")
 	}
 }
+
+// registeredSinkChannels are the channels that metric sinks of the
+// registered "channel" kind flush to, by the channel named in their
+// config.
+var registeredSinkChannels = map[string]chan []samplers.InterMetric{}
+
+func init() {
+	sinks.RegisterMetricSink("channel", func(config sinks.SinkConfig) (sinks.MetricSink, error) {
+		var options struct {
+			Channel string `yaml:"channel"`
+		}
+		if err := config.Decode(&options); err != nil {
+			return nil, err
+		}
+		ch, ok := registeredSinkChannels[options.Channel]
+		if !ok {
+			return nil, fmt.Errorf("no channel %q", options.Channel)
+		}
+		return &channelMetricSink{metricsChannel: ch, name: config.Name}, nil
+	})
+}
+
+func TestRegisteredMetricSink(t *testing.T) {
+	ch := make(chan []samplers.InterMetric, 10)
+	registeredSinkChannels["registered"] = ch
+	defer delete(registeredSinkChannels, "registered")
+
+	config := localConfig()
+	config.Interval = "1h"
+	require.NoError(t, yaml.Unmarshal([]byte(`
+metric_sinks:
+  - kind: channel
+    name: internal
+    config:
+      channel: registered
+metric_sink_options:
+  internal:
+    add_tags:
+      sink: internal
+`), &config))
+	server := setupVeneurServer(t, config, nil, nil, nil)
+	defer server.Shutdown()
+
+	server.Workers[0].ProcessMetric(&samplers.UDPMetric{
+		MetricKey:  samplers.MetricKey{Name: "a.b.c", Type: counterTypeName},
+		Value:      1.0,
+		SampleRate: 1.0,
+		Scope:      samplers.LocalOnly,
+	})
+	server.Flush(context.Background())
+
+	select {
+	case metrics := <-ch:
+		require.Len(t, metrics, 1)
+		assert.Equal(t, "a.b.c", metrics[0].Name)
+		assert.Contains(t, metrics[0].Tags, "sink:internal")
+	case <-time.After(3 * time.Second):
+		t.Fatal("timed out waiting for the registered sink to flush")
+	}
+	report, ok := server.LastFlush()
+	require.True(t, ok)
+	var names []string
+	for _, sink := range report.Sinks {
+		names = append(names, sink.Sink)
+	}
+	assert.Contains(t, names, "internal")
+}
+
+func TestRegisteredSinkErrors(t *testing.T) {
+	registeredSinkChannels["registered"] = make(chan []samplers.InterMetric, 1)
+	defer delete(registeredSinkChannels, "registered")
+
+	for name, section := range map[string]string{
+		"unknown kind": `
+metric_sinks:
+  - kind: carrier_pigeon`,
+		"unknown option": `
+metric_sinks:
+  - kind: channel
+    config:
+      channel: registered
+      buffer: 10`,
+		"factory error": `
+metric_sinks:
+  - kind: channel
+    config:
+      channel: missing`,
+		"unknown span sink kind": `
+span_sinks:
+  - kind: channel`,
+	} {
+		config := localConfig()
+		require.NoError(t, yaml.Unmarshal([]byte(section), &config))
+		_, err := NewFromConfig(logrus.New(), config)
+		assert.Error(t, err, name)
+	}
+}
+
+func TestSpanTailSamplingConfig(t *testing.T) {
+	config := localConfig()
+	config.DebugIngestedSpans = true
+	config.SpanTailSampling = true
+	config.SpanTailSamplingKeepErrors = true
+	config.SpanTailSamplingWait = "2s"
+	server, err := NewFromConfig(logrus.New(), config)
+	require.NoError(t, err)
+	var names []string
+	for _, sink := range server.spanSinks {
+		names = append(names, sink.Name())
+	}
+	assert.Contains(t, names, "tail_sampling")
+	assert.NotContains(t, names, "debug", "the debug sink should be wrapped by the tail sampler")
+
+	config.SpanTailSamplingRate = 1.5
+	_, err = NewFromConfig(logrus.New(), config)
+	assert.Error(t, err)
+}
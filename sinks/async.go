@@ -0,0 +1,182 @@
+package sinks
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stripe/veneur/samplers"
+	"github.com/stripe/veneur/ssf"
+	"github.com/stripe/veneur/trace"
+)
+
+// MetricKeyAsyncQueueDepth is emitted as a gauge by AsyncSink on each
+// flush, with the number of batches waiting in its queue. Tagged with
+// `sink:sink.Name()`.
+const MetricKeyAsyncQueueDepth = "sink.async_queue_depth"
+
+// MetricKeyAsyncBatchesDropped is emitted as a counter by AsyncSink for
+// each batch that it dropped because its queue was full. Tagged with
+// `sink:sink.Name()`.
+const MetricKeyAsyncBatchesDropped = "sink.async_batches_dropped_total"
+
+// MetricKeyAsyncMetricsDropped is emitted as a counter by AsyncSink
+// with the number of metrics in the batches that it dropped. Tagged
+// with `sink:sink.Name()`.
+const MetricKeyAsyncMetricsDropped = "sink.async_metrics_dropped_total"
+
+// DefaultAsyncQueueSize is the number of batches that an AsyncSink
+// queues, if no other size is configured.
+const DefaultAsyncQueueSize = 4
+
+// DefaultAsyncWorkers is the number of goroutines that an AsyncSink
+// flushes its queue on, if no other number is configured.
+const DefaultAsyncWorkers = 1
+
+// AsyncSink is a MetricSink that wraps another, and flushes the
+// wrapped sink on its own goroutines, so that a slow sink doesn't hold
+// up the server's flush. Batches queue up while all workers are busy;
+// once the queue is full, further batches are dropped.
+type AsyncSink struct {
+	sink    MetricSink
+	queue   chan []samplers.InterMetric
+	workers int
+
+	startOnce sync.Once
+	working   sync.WaitGroup
+	// mtx guards stopped; Flush holds it for reading while it
+	// queues a batch, so that Stop never closes the queue under it.
+	mtx     sync.RWMutex
+	stopped bool
+	// Counts of the batches and metrics dropped since the last
+	// flush, accessed atomically.
+	droppedBatches int64
+	droppedMetrics int64
+
+	traceClient *trace.Client
+	log         *logrus.Logger
+}
+
+var _ MetricSink = &AsyncSink{}
+var _ HealthChecker = &AsyncSink{}
+var _ Stopper = &AsyncSink{}
+
+// NewAsyncSink wraps sink so that its flushes happen on workers
+// goroutines, with up to queueSize batches waiting for a free worker.
+func NewAsyncSink(sink MetricSink, queueSize, workers int, log *logrus.Logger) *AsyncSink {
+	if queueSize < 1 {
+		queueSize = DefaultAsyncQueueSize
+	}
+	if workers < 1 {
+		workers = DefaultAsyncWorkers
+	}
+	return &AsyncSink{
+		sink:    sink,
+		queue:   make(chan []samplers.InterMetric, queueSize),
+		workers: workers,
+		log:     log,
+	}
+}
+
+// Name returns the name of the wrapped sink, so that metrics routed
+// to it still reach it.
+func (s *AsyncSink) Name() string {
+	return s.sink.Name()
+}
+
+// Start starts the wrapped sink, and then the workers.
+func (s *AsyncSink) Start(cl *trace.Client) error {
+	s.traceClient = cl
+	if err := s.sink.Start(cl); err != nil {
+		return err
+	}
+	s.startOnce.Do(func() {
+		s.working.Add(s.workers)
+		for i := 0; i < s.workers; i++ {
+			go func() {
+				defer s.working.Done()
+				s.work()
+			}()
+		}
+	})
+	return nil
+}
+
+func (s *AsyncSink) work() {
+	for metrics := range s.queue {
+		// The server's flush context may be done long before the
+		// batch leaves the queue, so don't inherit it.
+		err := s.sink.Flush(context.Background(), metrics)
+		if err != nil {
+			s.log.WithError(err).WithField("sink", s.Name()).Warn("Error flushing sink asynchronously")
+		}
+	}
+}
+
+// Flush queues the metrics for the workers, and returns without
+// waiting for them. If the queue is full, it drops the metrics and
+// returns an error. Once the sink is stopped, Flush flushes the wrapped
+// sink directly.
+func (s *AsyncSink) Flush(ctx context.Context, metrics []samplers.InterMetric) error {
+	s.mtx.RLock()
+	if s.stopped {
+		s.mtx.RUnlock()
+		return s.sink.Flush(ctx, metrics)
+	}
+	span, _ := trace.StartSpanFromContext(ctx, "")
+	defer span.ClientFinish(s.traceClient)
+
+	var err error
+	select {
+	case s.queue <- metrics:
+	default:
+		atomic.AddInt64(&s.droppedBatches, 1)
+		atomic.AddInt64(&s.droppedMetrics, int64(len(metrics)))
+		err = fmt.Errorf("queue of %d batches is full, dropped %d metrics", cap(s.queue), len(metrics))
+		span.Error(err)
+	}
+	s.mtx.RUnlock()
+
+	tags := map[string]string{"sink": s.Name()}
+	span.Add(ssf.Gauge(MetricKeyAsyncQueueDepth, float32(len(s.queue)), tags))
+	if batches := atomic.SwapInt64(&s.droppedBatches, 0); batches > 0 {
+		span.Add(
+			ssf.Count(MetricKeyAsyncBatchesDropped, float32(batches), tags),
+			ssf.Count(MetricKeyAsyncMetricsDropped, float32(atomic.SwapInt64(&s.droppedMetrics, 0)), tags),
+		)
+	}
+	return err
+}
+
+// Stop waits for the workers to flush the batches in the queue, and
+// then stops the wrapped sink. The workers log their errors.
+func (s *AsyncSink) Stop() error {
+	s.mtx.Lock()
+	if s.stopped {
+		s.mtx.Unlock()
+		return nil
+	}
+	s.stopped = true
+	close(s.queue)
+	s.mtx.Unlock()
+
+	s.working.Wait()
+	// If the sink was never started, nothing flushed the queue:
+	s.work()
+	return Stop(s.sink)
+}
+
+// Healthy returns the health of the wrapped sink, if it can tell.
+func (s *AsyncSink) Healthy() error {
+	if hc, ok := s.sink.(HealthChecker); ok {
+		return hc.Healthy()
+	}
+	return nil
+}
+
+// FlushOtherSamples passes the samples to the wrapped sink directly.
+func (s *AsyncSink) FlushOtherSamples(ctx context.Context, samples []ssf.SSFSample) {
+	s.sink.FlushOtherSamples(ctx, samples)
+}
@@ -0,0 +1,128 @@
+package sinks
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stripe/veneur/samplers"
+	"github.com/stripe/veneur/ssf"
+	"github.com/stripe/veneur/trace"
+)
+
+// blockingSink blocks each flush until it is released, and then sends
+// the batch on flushed.
+type blockingSink struct {
+	release chan struct{}
+	flushed chan []samplers.InterMetric
+}
+
+func (s *blockingSink) Name() string {
+	return "blocking"
+}
+
+func (s *blockingSink) Start(*trace.Client) error {
+	return nil
+}
+
+func (s *blockingSink) Flush(ctx context.Context, metrics []samplers.InterMetric) error {
+	<-s.release
+	s.flushed <- metrics
+	return nil
+}
+
+func (s *blockingSink) FlushOtherSamples(ctx context.Context, samples []ssf.SSFSample) {}
+
+func TestAsyncSinkDoesNotBlock(t *testing.T) {
+	sink := &blockingSink{release: make(chan struct{}), flushed: make(chan []samplers.InterMetric, 10)}
+	spans := make(chan *ssf.SSFSpan, 10)
+	cl, err := trace.NewChannelClient(spans)
+	require.NoError(t, err)
+	defer cl.Close()
+
+	as := NewAsyncSink(sink, 2, 1, logrus.New())
+	require.NoError(t, as.Start(cl))
+	require.Equal(t, "blocking", as.Name())
+
+	done := make(chan []error)
+	go func() {
+		var errs []error
+		for i := 0; i < 5; i++ {
+			errs = append(errs, as.Flush(context.Background(), retryTestMetrics))
+		}
+		done <- errs
+	}()
+	var errs []error
+	select {
+	case errs = <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("flushing to a blocked sink should not block the caller")
+	}
+
+	// The worker holds at most one batch, and the queue another two,
+	// so at least two of the batches must have been dropped.
+	dropped := 0
+	for _, err := range errs {
+		if err != nil {
+			dropped++
+		}
+	}
+	assert.True(t, dropped >= 2 && dropped <= 3, "unexpected number of dropped batches: %d", dropped)
+
+	close(sink.release)
+	for i := 0; i < 5-dropped; i++ {
+		select {
+		case metrics := <-sink.flushed:
+			assert.Equal(t, retryTestMetrics, metrics)
+		case <-time.After(5 * time.Second):
+			t.Fatal("queued batches should be flushed once the sink unblocks")
+		}
+	}
+
+	var batchesDropped, metricsDropped float32
+	var depthReported bool
+	for i := 0; i < 5; i++ {
+		span := <-spans
+		for _, m := range span.Metrics {
+			switch m.Name {
+			case MetricKeyAsyncBatchesDropped:
+				batchesDropped += m.Value
+			case MetricKeyAsyncMetricsDropped:
+				metricsDropped += m.Value
+			case MetricKeyAsyncQueueDepth:
+				depthReported = true
+				assert.Equal(t, "blocking", m.Tags["sink"])
+			}
+		}
+	}
+	assert.True(t, depthReported, "the queue depth should be reported")
+	assert.Equal(t, float32(dropped), batchesDropped)
+	assert.Equal(t, float32(dropped*len(retryTestMetrics)), metricsDropped)
+}
+
+func TestAsyncSinkStopDrainsQueue(t *testing.T) {
+	sink := &blockingSink{release: make(chan struct{}), flushed: make(chan []samplers.InterMetric, 10)}
+	as := NewAsyncSink(sink, 4, 1, logrus.New())
+	require.NoError(t, as.Start(nil))
+	for i := 0; i < 3; i++ {
+		require.NoError(t, as.Flush(context.Background(), retryTestMetrics))
+	}
+
+	stopped := make(chan error)
+	go func() { stopped <- as.Stop() }()
+	close(sink.release)
+	select {
+	case err := <-stopped:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Stop should return once the queue is flushed")
+	}
+	assert.Len(t, sink.flushed, 3, "Stop should flush every queued batch")
+
+	require.NoError(t, as.Flush(context.Background(), retryTestMetrics))
+	assert.Len(t, sink.flushed, 4, "a stopped sink should flush the wrapped sink directly")
+	assert.NoError(t, as.Stop(), "stopping twice should be harmless")
+}
@@ -0,0 +1,168 @@
+package sinks
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stripe/veneur/ssf"
+	"github.com/stripe/veneur/trace"
+	"github.com/stripe/veneur/trace/metrics"
+)
+
+// spanBatchQueueLength is the number of full batches that can wait to
+// be sent by a SpanBatcher. Once the queue is full, further batches
+// are dropped.
+const spanBatchQueueLength = 16
+
+// spanSendTimeout bounds the time that sending a single batch of spans
+// may take.
+const spanSendTimeout = 10 * time.Second
+
+// SpanSendFunc sends a batch of spans for a SpanBatcher, giving up once
+// ctx is done. It returns the number of spans in the batch that it
+// sent; the others count as dropped, and SpanSendFunc should log why.
+type SpanSendFunc func(ctx context.Context, batch []*ssf.SSFSpan) int
+
+// SpanBatcher buffers spans for a span sink, and sends them in batches
+// on a goroutine of its own, whenever a batch is full and on every
+// flush. Full batches queue up while a batch is being sent; once the
+// queue is full, further batches are dropped.
+type SpanBatcher struct {
+	name      string
+	batchSize int
+	send      SpanSendFunc
+
+	startOnce sync.Once
+	working   sync.WaitGroup
+	// mutex guards buffer and stopped, and is held while a batch is
+	// queued, so that Stop never closes the queue under it.
+	mutex   sync.Mutex
+	buffer  []*ssf.SSFSpan
+	queue   chan []*ssf.SSFSpan
+	stopped bool
+	// Counts of the spans sent and dropped since the last flush,
+	// accessed atomically.
+	sentCount, dropCount int64
+
+	log *logrus.Logger
+}
+
+var _ Stopper = &SpanBatcher{}
+
+// NewSpanBatcher returns a SpanBatcher for the span sink called name,
+// which sends batches of at most batchSize spans with send.
+func NewSpanBatcher(name string, batchSize int, send SpanSendFunc, log *logrus.Logger) *SpanBatcher {
+	return &SpanBatcher{
+		name:      name,
+		batchSize: batchSize,
+		send:      send,
+		buffer:    make([]*ssf.SSFSpan, 0, batchSize),
+		queue:     make(chan []*ssf.SSFSpan, spanBatchQueueLength),
+		log:       log,
+	}
+}
+
+// Start starts sending the queued batches in the background.
+func (b *SpanBatcher) Start() {
+	b.startOnce.Do(func() {
+		b.working.Add(1)
+		go func() {
+			defer b.working.Done()
+			b.work()
+		}()
+	})
+}
+
+func (b *SpanBatcher) work() {
+	for batch := range b.queue {
+		b.sendBatch(batch)
+	}
+}
+
+func (b *SpanBatcher) sendBatch(batch []*ssf.SSFSpan) {
+	ctx, cancel := context.WithTimeout(context.Background(), spanSendTimeout)
+	defer cancel()
+
+	sent := b.send(ctx, batch)
+	atomic.AddInt64(&b.sentCount, int64(sent))
+	atomic.AddInt64(&b.dropCount, int64(len(batch)-sent))
+}
+
+// Add buffers the span, and queues the buffered spans to be sent if
+// there are batchSize of them. Once the batcher is stopped, Add drops
+// the span.
+func (b *SpanBatcher) Add(span *ssf.SSFSpan) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.stopped {
+		atomic.AddInt64(&b.dropCount, 1)
+		return
+	}
+	b.buffer = append(b.buffer, span)
+	if len(b.buffer) >= b.batchSize {
+		b.enqueue()
+	}
+}
+
+// Flush queues all buffered spans to be sent, and reports the number
+// of spans sent and dropped since the last flush to cl, tagged with
+// the sink's name.
+func (b *SpanBatcher) Flush(cl *trace.Client) {
+	b.mutex.Lock()
+	if !b.stopped && len(b.buffer) > 0 {
+		b.enqueue()
+	}
+	b.mutex.Unlock()
+
+	tags := map[string]string{"sink": b.name}
+	samples := &ssf.Samples{}
+	samples.Add(
+		ssf.Count(MetricKeyTotalSpansFlushed, float32(atomic.SwapInt64(&b.sentCount, 0)), tags),
+		ssf.Count(MetricKeyTotalSpansDropped, float32(atomic.SwapInt64(&b.dropCount, 0)), tags),
+	)
+	metrics.Report(cl, samples)
+}
+
+// enqueue hands the buffered spans to the sending goroutine, dropping
+// them if it is too far behind. b.mutex must be held.
+func (b *SpanBatcher) enqueue() {
+	select {
+	case b.queue <- b.buffer:
+	default:
+		atomic.AddInt64(&b.dropCount, int64(len(b.buffer)))
+		b.log.WithFields(logrus.Fields{
+			"sink":  b.name,
+			"spans": len(b.buffer),
+		}).Warn("Dropping spans: send queue is full")
+	}
+	b.buffer = make([]*ssf.SSFSpan, 0, b.batchSize)
+}
+
+// Stop queues the buffered spans, and waits for all queued batches to
+// be sent. It returns an error if any spans were dropped since the
+// last flush.
+func (b *SpanBatcher) Stop() error {
+	b.mutex.Lock()
+	if b.stopped {
+		b.mutex.Unlock()
+		return nil
+	}
+	if len(b.buffer) > 0 {
+		b.enqueue()
+	}
+	b.stopped = true
+	close(b.queue)
+	b.mutex.Unlock()
+
+	b.working.Wait()
+	// If the batcher was never started, nothing sent the queue:
+	b.work()
+	if dropped := atomic.LoadInt64(&b.dropCount); dropped > 0 {
+		return fmt.Errorf("%s dropped %d spans", b.name, dropped)
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package sinks
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stripe/veneur/ssf"
+	"github.com/stripe/veneur/trace"
+)
+
+func TestSpanBatcher(t *testing.T) {
+	sent := make(chan []*ssf.SSFSpan, 10)
+	send := func(ctx context.Context, batch []*ssf.SSFSpan) int {
+		sent <- batch
+		// The last span of each batch is rejected:
+		return len(batch) - 1
+	}
+	reports := make(chan *ssf.SSFSpan, 2)
+	cl, err := trace.NewChannelClient(reports)
+	require.NoError(t, err)
+	defer cl.Close()
+
+	b := NewSpanBatcher("test", 2, send, logrus.New())
+	b.Start()
+	for i := int64(1); i <= 3; i++ {
+		b.Add(&ssf.SSFSpan{Id: i})
+	}
+	assert.Len(t, <-sent, 2, "a full batch should be sent right away")
+
+	b.Flush(cl)
+	assert.Len(t, <-sent, 1, "flushing should send the partial batch")
+
+	// Stopping waits for both batches to be accounted for.
+	assert.Error(t, b.Stop(), "the rejected spans should make stopping fail")
+	b.Flush(cl)
+	counts := map[string]float32{}
+	for i := 0; i < 2; i++ {
+		for _, m := range (<-reports).Metrics {
+			counts[m.Name] += m.Value
+		}
+	}
+	assert.Equal(t, float32(1), counts[MetricKeyTotalSpansFlushed])
+	assert.Equal(t, float32(2), counts[MetricKeyTotalSpansDropped])
+}
+
+func TestSpanBatcherDropsWhenQueueIsFull(t *testing.T) {
+	send := func(ctx context.Context, batch []*ssf.SSFSpan) int {
+		return len(batch)
+	}
+	// Without starting the batcher, nothing takes batches off its
+	// queue.
+	b := NewSpanBatcher("test", 1, send, logrus.New())
+	for i := 0; i < spanBatchQueueLength+3; i++ {
+		b.Add(&ssf.SSFSpan{Id: int64(i)})
+	}
+	err := b.Stop()
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "dropped 3 spans")
+	}
+	assert.Equal(t, int64(spanBatchQueueLength), b.sentCount, "stopping should send the queued batches")
+
+	b.Add(&ssf.SSFSpan{Id: 1})
+	assert.Equal(t, int64(4), b.dropCount, "spans added after stopping should be dropped")
+}
@@ -0,0 +1,156 @@
+package sinks
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/stripe/veneur/samplers"
+	"github.com/stripe/veneur/ssf"
+	"github.com/stripe/veneur/trace"
+)
+
+// BufferingSink is a MetricSink that wraps another, and flushes the
+// wrapped sink only on every few of the server's flushes. Until then,
+// it re-aggregates the metrics of each flush into those it buffered:
+//
+//   - Counters are summed, so the wrapped sink receives the total of
+//     the increments over its longer interval.
+//   - Gauges and statuses keep their latest value.
+//
+// Histograms and timers reach sinks as the counters and gauges that
+// the server flushed for them, so only their .count is summed
+// correctly. Their percentiles and their .min, .max, .sum, .avg,
+// .median and .hmean aggregates are gauges, and the wrapped sink
+// receives the values of the last of the server's flushes only.
+//
+// Buffered metrics are flushed to the wrapped sink when the
+// BufferingSink is stopped, as when a reload of the configuration
+// replaces it, but those that haven't been flushed when Veneur shuts
+// down are lost.
+type BufferingSink struct {
+	sink  MetricSink
+	every int
+
+	mtx     sync.Mutex
+	stopped bool
+	flushes int
+	keys    []string
+	metrics map[string]*samplers.InterMetric
+}
+
+var _ MetricSink = &BufferingSink{}
+var _ HealthChecker = &BufferingSink{}
+var _ Stopper = &BufferingSink{}
+
+// NewBufferingSink wraps sink so that it is flushed once every every
+// flushes of the server. If every is less than 2, every flush is
+// passed on.
+func NewBufferingSink(sink MetricSink, every int) *BufferingSink {
+	if every < 1 {
+		every = 1
+	}
+	return &BufferingSink{
+		sink:    sink,
+		every:   every,
+		metrics: map[string]*samplers.InterMetric{},
+	}
+}
+
+// Name returns the name of the wrapped sink, so that metrics routed
+// to it still reach it.
+func (s *BufferingSink) Name() string {
+	return s.sink.Name()
+}
+
+// Start starts the wrapped sink.
+func (s *BufferingSink) Start(cl *trace.Client) error {
+	return s.sink.Start(cl)
+}
+
+// Flush adds the metrics to the buffer and, on every s.every-th call,
+// flushes the buffered metrics to the wrapped sink. Once the sink is
+// stopped, Flush flushes the wrapped sink directly.
+func (s *BufferingSink) Flush(ctx context.Context, metrics []samplers.InterMetric) error {
+	if s.every == 1 {
+		return s.sink.Flush(ctx, metrics)
+	}
+
+	s.mtx.Lock()
+	if s.stopped {
+		s.mtx.Unlock()
+		return s.sink.Flush(ctx, metrics)
+	}
+	for _, m := range metrics {
+		s.add(m)
+	}
+	s.flushes++
+	if s.flushes < s.every {
+		s.mtx.Unlock()
+		return nil
+	}
+	buffered := s.take()
+	s.mtx.Unlock()
+
+	return s.sink.Flush(ctx, buffered)
+}
+
+// Stop flushes the buffered metrics to the wrapped sink, and then stops
+// it.
+func (s *BufferingSink) Stop() error {
+	s.mtx.Lock()
+	s.stopped = true
+	buffered := s.take()
+	s.mtx.Unlock()
+
+	var err error
+	if len(buffered) > 0 {
+		err = s.sink.Flush(context.Background(), buffered)
+	}
+	if stopErr := Stop(s.sink); err == nil {
+		err = stopErr
+	}
+	return err
+}
+
+// take empties the buffer, and returns the metrics that it held. It
+// must be called with s.mtx held.
+func (s *BufferingSink) take() []samplers.InterMetric {
+	buffered := make([]samplers.InterMetric, 0, len(s.keys))
+	for _, key := range s.keys {
+		buffered = append(buffered, *s.metrics[key])
+	}
+	s.flushes = 0
+	s.keys = nil
+	s.metrics = make(map[string]*samplers.InterMetric, len(buffered))
+	return buffered
+}
+
+// add merges m into the buffer. It must be called with s.mtx held.
+func (s *BufferingSink) add(m samplers.InterMetric) {
+	key := m.Name + "\x00" + strconv.Itoa(int(m.Type)) + "\x00" + strings.Join(m.Tags, ",")
+	prev, ok := s.metrics[key]
+	if !ok {
+		s.keys = append(s.keys, key)
+		s.metrics[key] = &m
+		return
+	}
+	if m.Type == samplers.CounterMetric {
+		m.Value += prev.Value
+	}
+	*prev = m
+}
+
+// Healthy returns the health of the wrapped sink, if it can tell.
+func (s *BufferingSink) Healthy() error {
+	if hc, ok := s.sink.(HealthChecker); ok {
+		return hc.Healthy()
+	}
+	return nil
+}
+
+// FlushOtherSamples passes the samples to the wrapped sink directly.
+func (s *BufferingSink) FlushOtherSamples(ctx context.Context, samples []ssf.SSFSample) {
+	s.sink.FlushOtherSamples(ctx, samples)
+}
@@ -0,0 +1,68 @@
+package sinks
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stripe/veneur/samplers"
+)
+
+func TestBufferingSinkFlushesLessOften(t *testing.T) {
+	fast := &flakySink{name: "datadog"}
+	slow := &flakySink{name: "s3"}
+	sinks := []MetricSink{fast, NewBufferingSink(slow, 3)}
+	require.Equal(t, "s3", sinks[1].Name())
+
+	for i := 1; i <= 6; i++ {
+		metrics := []samplers.InterMetric{
+			{Name: "requests", Value: float64(i), Tags: []string{"az:a"}, Type: samplers.CounterMetric},
+			{Name: "requests", Value: 10 * float64(i), Tags: []string{"az:b"}, Type: samplers.CounterMetric},
+			{Name: "queue.depth", Value: float64(100 + i), Type: samplers.GaugeMetric},
+		}
+		if i%3 == 1 {
+			// a series that isn't sent every time
+			metrics = append(metrics, samplers.InterMetric{Name: "restarts", Value: 1, Type: samplers.CounterMetric})
+		}
+		for _, sink := range sinks {
+			require.NoError(t, sink.Flush(context.Background(), metrics))
+		}
+	}
+
+	assert.Len(t, fast.batches, 6)
+	assert.Equal(t, [][]samplers.InterMetric{
+		{
+			{Name: "requests", Value: 1 + 2 + 3, Tags: []string{"az:a"}, Type: samplers.CounterMetric},
+			{Name: "requests", Value: 10 + 20 + 30, Tags: []string{"az:b"}, Type: samplers.CounterMetric},
+			{Name: "queue.depth", Value: 103, Type: samplers.GaugeMetric},
+			{Name: "restarts", Value: 1, Type: samplers.CounterMetric},
+		},
+		{
+			{Name: "requests", Value: 4 + 5 + 6, Tags: []string{"az:a"}, Type: samplers.CounterMetric},
+			{Name: "requests", Value: 40 + 50 + 60, Tags: []string{"az:b"}, Type: samplers.CounterMetric},
+			{Name: "queue.depth", Value: 106, Type: samplers.GaugeMetric},
+			{Name: "restarts", Value: 1, Type: samplers.CounterMetric},
+		},
+	}, slow.batches)
+}
+
+func TestBufferingSinkEveryFlush(t *testing.T) {
+	sink := &flakySink{name: "s3"}
+	bs := NewBufferingSink(sink, 0)
+	require.NoError(t, bs.Flush(context.Background(), retryTestMetrics))
+	assert.Equal(t, [][]samplers.InterMetric{retryTestMetrics}, sink.batches)
+}
+
+func TestBufferingSinkStop(t *testing.T) {
+	sink := &flakySink{name: "s3"}
+	bs := NewBufferingSink(sink, 3)
+	require.NoError(t, bs.Flush(context.Background(), retryTestMetrics))
+	assert.Empty(t, sink.batches)
+
+	require.NoError(t, bs.Stop())
+	assert.Equal(t, [][]samplers.InterMetric{retryTestMetrics}, sink.batches, "Stop should flush the buffered metrics")
+
+	require.NoError(t, bs.Stop())
+	assert.Len(t, sink.batches, 1, "an empty buffer shouldn't be flushed")
+}
@@ -39,10 +39,17 @@ type DatadogMetricSink struct {
 	flushMaxPerBody int
 	tags            []string
 	interval        float64
+	health          sinks.FlushHealth
 	traceClient     *trace.Client
 	log             *logrus.Logger
+	// Compression is what the bodies of metrics and events are
+	// compressed with; empty means deflate.
+	Compression vhttp.Compression
 }
 
+var _ sinks.HealthChecker = &DatadogMetricSink{}
+var _ sinks.SanitizingSink = &DatadogMetricSink{}
+
 // DDEvent represents the structure of datadog's undocumented /intake endpoint
 type DDEvent struct {
 	Title       string   `json:"msg_title"`
@@ -97,6 +104,19 @@ func (dd *DatadogMetricSink) Name() string {
 	return "datadog"
 }
 
+// Sanitizer returns the lenient sanitizer, since Datadog accepts
+// (and sanitizes on its own) almost any metric name and tag.
+func (dd *DatadogMetricSink) Sanitizer() sinks.Sanitizer {
+	return sinks.LenientSanitizer
+}
+
+func (dd *DatadogMetricSink) compression() vhttp.Compression {
+	if dd.Compression == "" {
+		return vhttp.CompressionDeflate
+	}
+	return dd.Compression
+}
+
 // Start sets the sink up.
 func (dd *DatadogMetricSink) Start(cl *trace.Client) error {
 	dd.traceClient = cl
@@ -114,7 +134,7 @@ func (dd *DatadogMetricSink) Flush(ctx context.Context, interMetrics []samplers.
 		// this endpoint is not documented to take an array... but it does
 		// another curious constraint of this endpoint is that it does not
 		// support "Content-Encoding: deflate"
-		err := vhttp.PostHelper(context.TODO(), dd.HTTPClient, dd.traceClient, http.MethodPost, fmt.Sprintf("%s/api/v1/check_run?api_key=%s", dd.DDHostname, dd.APIKey), checks, "flush_checks", false, map[string]string{"sink": "datadog"}, dd.log)
+		err := vhttp.PostHelper(span.Attach(ctx), dd.HTTPClient, dd.traceClient, http.MethodPost, fmt.Sprintf("%s/api/v1/check_run?api_key=%s", dd.DDHostname, dd.APIKey), checks, "flush_checks", false, map[string]string{"sink": "datadog"}, dd.log)
 		if err == nil {
 			dd.log.WithField("checks", len(checks)).Info("Completed flushing service checks to Datadog")
 		} else {
@@ -132,6 +152,7 @@ func (dd *DatadogMetricSink) Flush(ctx context.Context, interMetrics []samplers.
 	dd.log.WithField("workers", workers).Debug("Worker count chosen")
 	dd.log.WithField("chunkSize", chunkSize).Debug("Chunk size chosen")
 	var wg sync.WaitGroup
+	errs := make([]error, workers)
 	flushStart := time.Now()
 	for i := 0; i < workers; i++ {
 		chunk := ddmetrics[i*chunkSize:]
@@ -140,9 +161,17 @@ func (dd *DatadogMetricSink) Flush(ctx context.Context, interMetrics []samplers.
 			chunk = chunk[:chunkSize]
 		}
 		wg.Add(1)
-		go dd.flushPart(span.Attach(ctx), chunk, &wg)
+		go dd.flushPart(span.Attach(ctx), chunk, &wg, &errs[i])
 	}
 	wg.Wait()
+	var flushErr error
+	for _, err := range errs {
+		if err != nil {
+			flushErr = err
+			break
+		}
+	}
+	dd.health.Record(flushErr)
 	tags := map[string]string{"sink": dd.Name()}
 	span.Add(
 		ssf.Timing(sinks.MetricKeyMetricFlushDuration, time.Since(flushStart), time.Nanosecond, tags),
@@ -226,11 +255,11 @@ func (dd *DatadogMetricSink) FlushOtherSamples(ctx context.Context, samples []ss
 		// the official dd-agent
 		// we don't actually pass all the body keys that dd-agent passes here... but
 		// it still works
-		err := vhttp.PostHelper(context.Background(), dd.HTTPClient, dd.traceClient, http.MethodPost, fmt.Sprintf("%s/intake?api_key=%s", dd.DDHostname, dd.APIKey), map[string]map[string][]DDEvent{
+		err := vhttp.PostCompressed(context.Background(), dd.HTTPClient, dd.traceClient, http.MethodPost, fmt.Sprintf("%s/intake?api_key=%s", dd.DDHostname, dd.APIKey), map[string]map[string][]DDEvent{
 			"events": {
 				"api": events,
 			},
-		}, "flush_events", true, map[string]string{"sink": "datadog"}, dd.log)
+		}, "flush_events", dd.compression(), map[string]string{"sink": "datadog"}, dd.log)
 
 		if err == nil {
 			dd.log.WithField("events", len(events)).Info("Completed flushing events to Datadog")
@@ -321,11 +350,17 @@ func (dd *DatadogMetricSink) finalizeMetrics(metrics []samplers.InterMetric) ([]
 	return ddMetrics, checks
 }
 
-func (dd *DatadogMetricSink) flushPart(ctx context.Context, metricSlice []DDMetric, wg *sync.WaitGroup) {
+// Healthy returns an error if the last few flushes failed to post
+// metrics to Datadog.
+func (dd *DatadogMetricSink) Healthy() error {
+	return dd.health.Healthy()
+}
+
+func (dd *DatadogMetricSink) flushPart(ctx context.Context, metricSlice []DDMetric, wg *sync.WaitGroup, errOut *error) {
 	defer wg.Done()
-	vhttp.PostHelper(ctx, dd.HTTPClient, dd.traceClient, http.MethodPost, fmt.Sprintf("%s/api/v1/series?api_key=%s", dd.DDHostname, dd.APIKey), map[string][]DDMetric{
+	*errOut = vhttp.PostCompressed(ctx, dd.HTTPClient, dd.traceClient, http.MethodPost, fmt.Sprintf("%s/api/v1/series?api_key=%s", dd.DDHostname, dd.APIKey), map[string][]DDMetric{
 		"series": metricSlice,
-	}, "flush", true, map[string]string{"sink": "datadog"}, dd.log)
+	}, "flush", dd.compression(), map[string]string{"sink": "datadog"}, dd.log)
 }
 
 // DatadogTraceSpan represents a trace span as JSON for the
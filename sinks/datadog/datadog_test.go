@@ -1,6 +1,8 @@
 package datadog
 
 import (
+	"bytes"
+	"compress/gzip"
 	"compress/zlib"
 	"context"
 	"encoding/json"
@@ -14,8 +16,10 @@ import (
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	vhttp "github.com/stripe/veneur/http"
 	"github.com/stripe/veneur/protocol/dogstatsd"
 	"github.com/stripe/veneur/samplers"
+	"github.com/stripe/veneur/sinks"
 	"github.com/stripe/veneur/ssf"
 )
 
@@ -73,6 +77,25 @@ func TestServerTags(t *testing.T) {
 	assert.Contains(t, ddMetrics[0].Tags, "a:b", "Tags should contain server tags")
 }
 
+func TestDatadogSanitizer(t *testing.T) {
+	ddSink := DatadogMetricSink{hostname: "somehostname", interval: 10}
+
+	metrics := sinks.Sanitize(ddSink.Sanitizer(), []samplers.InterMetric{{
+		Name:      "9 Lives.héllo",
+		Timestamp: time.Now().Unix(),
+		Value:     float64(10),
+		Tags:      []string{"User ID:Jane Doe", "host:abc123", "région:日本", ":orphan", ""},
+		Type:      samplers.CounterMetric,
+	}})
+	again := sinks.Sanitize(ddSink.Sanitizer(), metrics)
+	assert.Equal(t, metrics, again, "sanitizing should be idempotent")
+
+	ddMetrics, _ := ddSink.finalizeMetrics(metrics)
+	assert.Equal(t, "9_Lives.héllo", ddMetrics[0].Name, "only whitespace should be replaced")
+	assert.Equal(t, []string{"User_ID:Jane_Doe", "région:日本"}, ddMetrics[0].Tags)
+	assert.Equal(t, "abc123", ddMetrics[0].Hostname, "magic tags should survive sanitizing")
+}
+
 func TestHostMagicTag(t *testing.T) {
 	ddSink := DatadogMetricSink{
 		hostname: "badhostname",
@@ -292,6 +315,88 @@ func TestDatadogMetricRouting(t *testing.T) {
 
 }
 
+// encodingRoundTripper records the Content-Encoding and the raw body of
+// the requests it receives, and answers the ones with a Content-Encoding
+// that it doesn't accept with a 415.
+type encodingRoundTripper struct {
+	accept    map[string]bool
+	encodings []string
+	bodies    [][]byte
+}
+
+func (rt *encodingRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	encoding := req.Header.Get("Content-Encoding")
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		return nil, err
+	}
+	rt.encodings = append(rt.encodings, encoding)
+	rt.bodies = append(rt.bodies, body)
+
+	rec := httptest.NewRecorder()
+	rec.Code = http.StatusAccepted
+	if encoding != "" && !rt.accept[encoding] {
+		rec.Code = http.StatusUnsupportedMediaType
+	}
+	return rec.Result(), nil
+}
+
+func TestDatadogFlushCompression(t *testing.T) {
+	metrics := []samplers.InterMetric{{
+		Name:      "a.b.c",
+		Timestamp: 1476119058,
+		Value:     float64(100),
+		Tags:      []string{"foo:bar"},
+		Type:      samplers.GaugeMetric,
+	}}
+	flush := func(compression vhttp.Compression, rt *encodingRoundTripper) {
+		ddSink, err := NewDatadogMetricSink(10, 2500, "example.com", []string{"gloobles:toots"}, "http://example.com", "secret", &http.Client{Transport: rt}, logrus.New())
+		require.NoError(t, err)
+		ddSink.Compression = compression
+		require.NoError(t, ddSink.Flush(context.TODO(), metrics))
+	}
+
+	uncompressed := &encodingRoundTripper{}
+	flush(vhttp.CompressionNone, uncompressed)
+	require.Equal(t, []string{""}, uncompressed.encodings)
+	payload := uncompressed.bodies[0]
+
+	gzipped := &encodingRoundTripper{accept: map[string]bool{"gzip": true}}
+	flush(vhttp.CompressionGzip, gzipped)
+	require.Equal(t, []string{"gzip"}, gzipped.encodings)
+	r, err := gzip.NewReader(bytes.NewReader(gzipped.bodies[0]))
+	require.NoError(t, err)
+	body, err := ioutil.ReadAll(r)
+	require.NoError(t, err)
+	assert.Equal(t, string(payload), string(body), "the gzipped body should decompress to the original payload")
+
+	deflated := &encodingRoundTripper{accept: map[string]bool{"deflate": true}}
+	flush("", deflated)
+	require.Equal(t, []string{"deflate"}, deflated.encodings, "metrics should be deflated by default")
+	zr, err := zlib.NewReader(bytes.NewReader(deflated.bodies[0]))
+	require.NoError(t, err)
+	body, err = ioutil.ReadAll(zr)
+	require.NoError(t, err)
+	assert.Equal(t, string(payload), string(body))
+}
+
+func TestDatadogFlushCompressionRejected(t *testing.T) {
+	rt := &encodingRoundTripper{}
+	ddSink, err := NewDatadogMetricSink(10, 2500, "example.com", nil, "http://example.com", "secret", &http.Client{Transport: rt}, logrus.New())
+	require.NoError(t, err)
+	ddSink.Compression = vhttp.CompressionGzip
+
+	err = ddSink.Flush(context.TODO(), []samplers.InterMetric{{
+		Name:      "a.b.c",
+		Timestamp: 1476119058,
+		Value:     float64(100),
+		Type:      samplers.GaugeMetric,
+	}})
+	require.NoError(t, err, "the sink should fall back to sending the metrics uncompressed")
+	assert.Equal(t, []string{"gzip", ""}, rt.encodings)
+	assert.Contains(t, string(rt.bodies[1]), `"metric":"a.b.c"`)
+}
+
 func TestDatadogFlushEvents(t *testing.T) {
 	transport := &DatadogRoundTripper{Endpoint: "/intake", Contains: ""}
 	ddSink, err := NewDatadogMetricSink(10, 2500, "example.com", []string{"gloobles:toots"}, "http://example.com", "secret", &http.Client{Transport: transport}, logrus.New())
@@ -417,3 +522,30 @@ func TestDatadogFlushServiceCheck(t *testing.T) {
 	assert.Subset(t, ddFixtureCheck.Tags, ddChecks[0].Tags, "Check posted to DD does not have matching tags")
 
 }
+
+func TestDatadogMetricSinkHealth(t *testing.T) {
+	status := http.StatusInternalServerError
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	ddSink := DatadogMetricSink{
+		DDHostname:      srv.URL,
+		HTTPClient:      &http.Client{},
+		flushMaxPerBody: 15,
+		log:             logrus.New(),
+		interval:        10,
+	}
+	ddSink.health.Threshold = 2
+	metrics := []samplers.InterMetric{{Name: "a.b.c", Value: 1, Type: samplers.GaugeMetric}}
+
+	require.NoError(t, ddSink.Flush(context.TODO(), metrics))
+	assert.NoError(t, ddSink.Healthy())
+	require.NoError(t, ddSink.Flush(context.TODO(), metrics))
+	assert.Error(t, ddSink.Healthy(), "consecutive failed flushes should make the sink unhealthy")
+
+	status = http.StatusAccepted
+	require.NoError(t, ddSink.Flush(context.TODO(), metrics))
+	assert.NoError(t, ddSink.Healthy())
+}
@@ -0,0 +1,121 @@
+package sinks
+
+import (
+	"bytes"
+	"regexp"
+
+	"github.com/stripe/veneur/samplers"
+)
+
+// MetricFilter selects the metrics that a single sink receives, by
+// glob patterns on their names and tags. In the patterns, "*" matches
+// any sequence of characters (including none) and "?" matches any
+// single character.
+//
+// Deny rules take precedence over allow rules: a metric is rejected if
+// its name matches any denied name pattern or any of its tags matches
+// a forbidden tag pattern. Otherwise, it is accepted if its name
+// matches one of the allowed name patterns (or if there are none), and
+// if, for each required tag pattern, at least one of its tags matches.
+type MetricFilter struct {
+	allowNames  []*regexp.Regexp
+	denyNames   []*regexp.Regexp
+	requireTags []*regexp.Regexp
+	forbidTags  []*regexp.Regexp
+}
+
+// NewMetricFilter returns a filter from lists of glob patterns. Tag
+// patterns match entire tags, so "env:*" matches any tag with the key
+// "env", and "debug" matches only the value-less tag "debug".
+func NewMetricFilter(allowNames, denyNames, requireTags, forbidTags []string) *MetricFilter {
+	return &MetricFilter{
+		allowNames:  compileGlobs(allowNames),
+		denyNames:   compileGlobs(denyNames),
+		requireTags: compileGlobs(requireTags),
+		forbidTags:  compileGlobs(forbidTags),
+	}
+}
+
+func compileGlobs(globs []string) []*regexp.Regexp {
+	if len(globs) == 0 {
+		return nil
+	}
+	res := make([]*regexp.Regexp, 0, len(globs))
+	for _, glob := range globs {
+		var expr bytes.Buffer
+		expr.WriteString("^")
+		for _, r := range glob {
+			switch r {
+			case '*':
+				expr.WriteString(".*")
+			case '?':
+				expr.WriteString(".")
+			default:
+				expr.WriteString(regexp.QuoteMeta(string(r)))
+			}
+		}
+		expr.WriteString("$")
+		// Every character is either quoted or a valid operator, so
+		// the expression always compiles.
+		res = append(res, regexp.MustCompile(expr.String()))
+	}
+	return res
+}
+
+func matchAny(res []*regexp.Regexp, s string) bool {
+	for _, re := range res {
+		if re.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
+
+// Accept returns whether the metric passes the filter.
+func (f *MetricFilter) Accept(metric samplers.InterMetric) bool {
+	if matchAny(f.denyNames, metric.Name) {
+		return false
+	}
+	for _, tag := range metric.Tags {
+		if matchAny(f.forbidTags, tag) {
+			return false
+		}
+	}
+	if len(f.allowNames) > 0 && !matchAny(f.allowNames, metric.Name) {
+		return false
+	}
+	for _, re := range f.requireTags {
+		found := false
+		for _, tag := range metric.Tags {
+			if re.MatchString(tag) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// Filter returns the metrics that pass the filter, in order. The
+// metrics slice is returned unchanged if all of them pass.
+func (f *MetricFilter) Filter(metrics []samplers.InterMetric) []samplers.InterMetric {
+	for i, metric := range metrics {
+		if f.Accept(metric) {
+			continue
+		}
+		// Copy the accepted prefix, rather than compacting in place,
+		// since other sinks share the slice.
+		filtered := make([]samplers.InterMetric, i, len(metrics)-1)
+		copy(filtered, metrics[:i])
+		for _, metric := range metrics[i+1:] {
+			if f.Accept(metric) {
+				filtered = append(filtered, metric)
+			}
+		}
+		return filtered
+	}
+	return metrics
+}
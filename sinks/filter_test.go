@@ -0,0 +1,87 @@
+package sinks
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stripe/veneur/samplers"
+)
+
+func TestGlobs(t *testing.T) {
+	tests := []struct {
+		glob  string
+		match []string
+		miss  []string
+	}{
+		{"api.*", []string{"api.", "api.requests", "api.requests.count"}, []string{"api", "xapi.requests"}},
+		{"*.count", []string{"a.count", ".count"}, []string{"a.count.rate"}},
+		{"a?c", []string{"abc", "a.c"}, []string{"ac", "abbc"}},
+		{"a.b", []string{"a.b"}, []string{"axb"}},
+		{"a+(b)[c]", []string{"a+(b)[c]"}, []string{"aab"}},
+		{"*", []string{"", "anything"}, nil},
+	}
+	for _, elt := range tests {
+		test := elt
+		t.Run(test.glob, func(t *testing.T) {
+			t.Parallel()
+			res := compileGlobs([]string{test.glob})
+			for _, s := range test.match {
+				assert.True(t, matchAny(res, s), "%q should match %q", test.glob, s)
+			}
+			for _, s := range test.miss {
+				assert.False(t, matchAny(res, s), "%q shouldn't match %q", test.glob, s)
+			}
+		})
+	}
+}
+
+func TestMetricFilter(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter *MetricFilter
+		metric samplers.InterMetric
+		accept bool
+	}{
+		{"empty filter", NewMetricFilter(nil, nil, nil, nil),
+			samplers.InterMetric{Name: "a"}, true},
+		{"allowed name", NewMetricFilter([]string{"api.*", "db.*"}, nil, nil, nil),
+			samplers.InterMetric{Name: "db.queries"}, true},
+		{"name not allowed", NewMetricFilter([]string{"api.*"}, nil, nil, nil),
+			samplers.InterMetric{Name: "db.queries"}, false},
+		{"denied name", NewMetricFilter(nil, []string{"debug.*"}, nil, nil),
+			samplers.InterMetric{Name: "debug.allocs"}, false},
+		{"deny beats allow", NewMetricFilter([]string{"api.*"}, []string{"*.debug"}, nil, nil),
+			samplers.InterMetric{Name: "api.debug"}, false},
+		{"required tag present", NewMetricFilter(nil, nil, []string{"env:*"}, nil),
+			samplers.InterMetric{Name: "a", Tags: []string{"host:x", "env:prod"}}, true},
+		{"required tag missing", NewMetricFilter(nil, nil, []string{"env:*"}, nil),
+			samplers.InterMetric{Name: "a", Tags: []string{"host:x"}}, false},
+		{"all required tags", NewMetricFilter(nil, nil, []string{"env:prod", "team:*"}, nil),
+			samplers.InterMetric{Name: "a", Tags: []string{"env:prod"}}, false},
+		{"required tags match whole tags", NewMetricFilter(nil, nil, []string{"env"}, nil),
+			samplers.InterMetric{Name: "a", Tags: []string{"env:prod"}}, false},
+		{"forbidden tag", NewMetricFilter(nil, nil, nil, []string{"user_id:*"}),
+			samplers.InterMetric{Name: "a", Tags: []string{"user_id:1234"}}, false},
+		{"forbidden beats required", NewMetricFilter(nil, nil, []string{"env:*"}, []string{"env:dev"}),
+			samplers.InterMetric{Name: "a", Tags: []string{"env:dev"}}, false},
+		{"forbidden beats allowed", NewMetricFilter([]string{"a"}, nil, nil, []string{"debug"}),
+			samplers.InterMetric{Name: "a", Tags: []string{"debug"}}, false},
+	}
+	for _, elt := range tests {
+		test := elt
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, test.accept, test.filter.Accept(test.metric))
+		})
+	}
+}
+
+func TestMetricFilterFilter(t *testing.T) {
+	filter := NewMetricFilter(nil, []string{"b"}, nil, nil)
+	metrics := []samplers.InterMetric{{Name: "a"}, {Name: "b"}, {Name: "c"}}
+	assert.Equal(t, []samplers.InterMetric{{Name: "a"}, {Name: "c"}}, filter.Filter(metrics))
+	assert.Equal(t, "b", metrics[1].Name, "the input must not be modified")
+
+	accepted := metrics[:1]
+	assert.Equal(t, accepted, filter.Filter(accepted))
+}
@@ -0,0 +1,244 @@
+package graphite
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stripe/veneur/samplers"
+	"github.com/stripe/veneur/sinks"
+	"github.com/stripe/veneur/ssf"
+	"github.com/stripe/veneur/trace"
+)
+
+// DefaultBufferSize is the number of points that the sink holds on to
+// while it can't reach Graphite, if no other size is configured.
+const DefaultBufferSize = 100000
+
+// DefaultBackoff is the time that the sink waits before retrying a
+// failed connection attempt for the first time. Each subsequent
+// attempt in the same flush waits twice as long.
+const DefaultBackoff = 100 * time.Millisecond
+
+// maxAttempts is the number of times that a flush tries to connect to
+// Graphite and write the buffered points.
+const maxAttempts = 3
+
+// writeTimeout bounds the time that writing the buffered points to
+// Graphite may take.
+const writeTimeout = 10 * time.Second
+
+// GraphiteMetricSink is a MetricSink that writes metrics to Graphite
+// in its plaintext protocol, "metric.path value timestamp\n", over
+// TCP. Points that can't be written are kept in a bounded buffer and
+// written once the connection is re-established.
+type GraphiteMetricSink struct {
+	address    string
+	tagOrder   []string
+	separator  string
+	bufferSize int
+	backoff    time.Duration
+
+	// mutex protects the connection and the buffer.
+	mutex  sync.Mutex
+	conn   net.Conn
+	buffer []string
+
+	traceClient *trace.Client
+	log         *logrus.Logger
+}
+
+var _ sinks.MetricSink = &GraphiteMetricSink{}
+
+// NewGraphiteMetricSink creates a sink that writes metrics to the
+// Graphite server at address ("host:port").
+//
+// Metric paths are made of the metric's name, followed by the key and
+// value of each tag listed in tagOrder that the metric has, in that
+// order, joined with separator; all other tags are dropped. If
+// separator is empty, it defaults to ".". At most bufferSize points
+// are kept while Graphite can't be reached.
+func NewGraphiteMetricSink(address string, tagOrder []string, separator string, bufferSize int, log *logrus.Logger) (*GraphiteMetricSink, error) {
+	if address == "" {
+		return nil, errors.New("graphite address must be set")
+	}
+	if separator == "" {
+		separator = "."
+	}
+	if bufferSize <= 0 {
+		bufferSize = DefaultBufferSize
+	}
+	return &GraphiteMetricSink{
+		address:    address,
+		tagOrder:   tagOrder,
+		separator:  separator,
+		bufferSize: bufferSize,
+		backoff:    DefaultBackoff,
+		log:        log,
+	}, nil
+}
+
+// Name returns the name of this sink.
+func (s *GraphiteMetricSink) Name() string {
+	return "graphite"
+}
+
+// Start sets the sink up.
+func (s *GraphiteMetricSink) Start(cl *trace.Client) error {
+	s.traceClient = cl
+	return nil
+}
+
+// Flush writes metrics to Graphite, along with any points that
+// previous flushes couldn't write. If Graphite can't be reached, the
+// points stay buffered, with the oldest points dropped once the buffer
+// is full.
+func (s *GraphiteMetricSink) Flush(ctx context.Context, interMetrics []samplers.InterMetric) error {
+	span, _ := trace.StartSpanFromContext(ctx, "")
+	defer span.ClientFinish(s.traceClient)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, metric := range interMetrics {
+		if !sinks.IsAcceptableMetric(metric, s) {
+			continue
+		}
+		// Graphite can't store NaN or infinite values.
+		if math.IsNaN(metric.Value) || math.IsInf(metric.Value, 0) {
+			continue
+		}
+		s.buffer = append(s.buffer, s.line(metric))
+	}
+	if dropped := len(s.buffer) - s.bufferSize; dropped > 0 {
+		s.log.WithField("points", dropped).Warn("Graphite buffer is full, dropping oldest points")
+		span.Add(ssf.Count("flush.dropped_total", float32(dropped), map[string]string{"sink": s.Name()}))
+		s.buffer = append(s.buffer[:0], s.buffer[dropped:]...)
+	}
+	if len(s.buffer) == 0 {
+		return nil
+	}
+
+	flushStart := time.Now()
+	points := len(s.buffer)
+	if err := s.write(ctx); err != nil {
+		span.Error(err)
+		span.Add(ssf.Count("flush.error_total", 1, map[string]string{"cause": "io", "sink": s.Name()}))
+		s.log.WithError(err).WithField("points", points).Warn("Error writing to Graphite, keeping points buffered")
+		return err
+	}
+	tags := map[string]string{"sink": s.Name()}
+	span.Add(
+		ssf.Timing(sinks.MetricKeyMetricFlushDuration, time.Since(flushStart), time.Nanosecond, tags),
+		ssf.Count(sinks.MetricKeyTotalMetricsFlushed, float32(points), tags),
+	)
+	s.log.WithField("metrics", points).Info("Completed flush to Graphite")
+	return nil
+}
+
+// FlushOtherSamples is a no-op: Graphite has no representation for
+// events and service checks.
+func (s *GraphiteMetricSink) FlushOtherSamples(ctx context.Context, samples []ssf.SSFSample) {
+}
+
+// write sends the buffered points over the connection, (re-)connecting
+// with backoff if necessary. Once all points are written, it empties
+// the buffer. s.mutex must be held.
+func (s *GraphiteMetricSink) write(ctx context.Context) error {
+	var body bytes.Buffer
+	for _, line := range s.buffer {
+		body.WriteString(line)
+	}
+
+	wait := s.backoff
+	var err error
+	for attempt := 0; attempt < maxAttempts; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(wait):
+			}
+			wait *= 2
+		}
+		if s.conn == nil {
+			var dialer net.Dialer
+			s.conn, err = dialer.DialContext(ctx, "tcp", s.address)
+			if err != nil {
+				s.conn = nil
+				continue
+			}
+		}
+		s.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+		if _, err = s.conn.Write(body.Bytes()); err != nil {
+			// The connection is broken; we don't know how much
+			// of the body made it, so write all of it again on a
+			// new connection. Graphite keeps only one value per
+			// path and timestamp, so duplicates are harmless.
+			s.conn.Close()
+			s.conn = nil
+			continue
+		}
+		s.buffer = s.buffer[:0]
+		return nil
+	}
+	return err
+}
+
+// line renders the metric as a line of Graphite's plaintext protocol.
+func (s *GraphiteMetricSink) line(metric samplers.InterMetric) string {
+	var buf bytes.Buffer
+	buf.WriteString(s.component(metric.Name, false))
+	if len(s.tagOrder) > 0 {
+		tags := map[string]string{}
+		for _, tag := range metric.Tags {
+			kv := strings.SplitN(tag, ":", 2)
+			if len(kv) == 2 && kv[1] != "" {
+				tags[kv[0]] = kv[1]
+			}
+		}
+		for _, key := range s.tagOrder {
+			value, ok := tags[key]
+			if !ok {
+				continue
+			}
+			buf.WriteString(s.separator)
+			buf.WriteString(s.component(key, true))
+			buf.WriteString(s.separator)
+			buf.WriteString(s.component(value, true))
+		}
+	}
+	buf.WriteByte(' ')
+	buf.WriteString(strconv.FormatFloat(metric.Value, 'f', -1, 64))
+	buf.WriteByte(' ')
+	buf.WriteString(strconv.FormatInt(metric.Timestamp, 10))
+	buf.WriteByte('\n')
+	return buf.String()
+}
+
+// component sanitizes a part of a metric path: whitespace is replaced
+// with underscores, and so are dots and the separator if isTag is true,
+// so that tags can't add levels to the path.
+func (s *GraphiteMetricSink) component(part string, isTag bool) string {
+	part = strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '\t', '\n', '\r':
+			return '_'
+		}
+		return r
+	}, part)
+	if isTag {
+		part = strings.Replace(part, s.separator, "_", -1)
+		if s.separator != "." {
+			part = strings.Replace(part, ".", "_", -1)
+		}
+	}
+	return part
+}
@@ -0,0 +1,132 @@
+package graphite
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stripe/veneur/samplers"
+)
+
+// collectLines accepts connections on lis and sends every line it
+// receives on the returned channel.
+func collectLines(lis net.Listener) <-chan string {
+	lines := make(chan string, 100)
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				scanner := bufio.NewScanner(conn)
+				for scanner.Scan() {
+					lines <- scanner.Text()
+				}
+			}()
+		}
+	}()
+	return lines
+}
+
+func receive(t *testing.T, lines <-chan string, n int) []string {
+	var ret []string
+	for i := 0; i < n; i++ {
+		select {
+		case line := <-lines:
+			ret = append(ret, line)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for line %d, got %v", i+1, ret)
+		}
+	}
+	return ret
+}
+
+func TestGraphiteFlush(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer lis.Close()
+	lines := collectLines(lis)
+
+	sink, err := NewGraphiteMetricSink(lis.Addr().String(), []string{"service", "host"}, "", 0, logrus.New())
+	require.NoError(t, err)
+	require.NoError(t, sink.Start(nil))
+
+	metrics := []samplers.InterMetric{
+		{
+			Name:      "a.b.c",
+			Timestamp: 1476119058,
+			Value:     100,
+			Tags:      []string{"host:web.1", "service:api", "ignored:tag"},
+			Type:      samplers.CounterMetric,
+		},
+		{
+			Name:      "latency.99percentile",
+			Timestamp: 1476119059,
+			Value:     1.5,
+			Tags:      []string{"env:prod", "service:my api"},
+			Type:      samplers.GaugeMetric,
+		},
+		{
+			Name:      "elsewhere",
+			Timestamp: 1476119059,
+			Value:     1,
+			Type:      samplers.GaugeMetric,
+			Sinks:     samplers.RouteInformation{"datadog": struct{}{}},
+		},
+	}
+	require.NoError(t, sink.Flush(context.Background(), metrics))
+	assert.Equal(t, []string{
+		"a.b.c.service.api.host.web_1 100 1476119058",
+		"latency.99percentile.service.my_api 1.5 1476119059",
+	}, receive(t, lines, 2))
+}
+
+func TestGraphiteSeparatorAndDroppedTags(t *testing.T) {
+	sink, err := NewGraphiteMetricSink("localhost:2003", []string{"host"}, "_", 0, logrus.New())
+	require.NoError(t, err)
+	assert.Equal(t, "a.b_host_web_1 1 10\n", sink.line(samplers.InterMetric{
+		Name: "a.b", Value: 1, Timestamp: 10, Tags: []string{"host:web.1"},
+	}))
+
+	sink, err = NewGraphiteMetricSink("localhost:2003", nil, "", 0, logrus.New())
+	require.NoError(t, err)
+	assert.Equal(t, "a.b 1 10\n", sink.line(samplers.InterMetric{
+		Name: "a.b", Value: 1, Timestamp: 10, Tags: []string{"host:web.1"},
+	}))
+}
+
+func TestGraphiteReconnects(t *testing.T) {
+	// Find a free port, and don't listen on it yet:
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := lis.Addr().String()
+	lis.Close()
+
+	sink, err := NewGraphiteMetricSink(addr, nil, "", 2, logrus.New())
+	require.NoError(t, err)
+	sink.backoff = time.Millisecond
+
+	flush := func(name string, ts int64) error {
+		return sink.Flush(context.Background(), []samplers.InterMetric{{Name: name, Value: 1, Timestamp: ts}})
+	}
+	assert.Error(t, flush("first", 1))
+	assert.Error(t, flush("second", 2))
+	assert.Error(t, flush("third", 3))
+	assert.Len(t, sink.buffer, 2, "only the newest points should be buffered")
+
+	lis, err = net.Listen("tcp", addr)
+	require.NoError(t, err)
+	defer lis.Close()
+	lines := collectLines(lis)
+
+	require.NoError(t, flush("fourth", 4))
+	assert.Equal(t, []string{"third 1 3", "fourth 1 4"}, receive(t, lines, 2))
+	assert.Empty(t, sink.buffer)
+}
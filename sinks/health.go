@@ -0,0 +1,63 @@
+package sinks
+
+import (
+	"fmt"
+	"sync"
+)
+
+// HealthChecker is an optional interface for sinks and plugins that
+// can tell whether they are delivering data. The server's
+// /healthcheck endpoint reports the health of each of them.
+type HealthChecker interface {
+	// Healthy returns nil if the sink is delivering data, and an
+	// error describing the problem otherwise.
+	Healthy() error
+}
+
+// DefaultUnhealthyThreshold is the number of consecutive failed
+// flushes after which a FlushHealth reports its sink as unhealthy, if
+// no other threshold is set.
+const DefaultUnhealthyThreshold = 3
+
+// FlushHealth tracks the outcome of a sink's flushes, and judges the
+// sink unhealthy once Threshold flushes in a row have failed. Its zero
+// value is ready to use, with DefaultUnhealthyThreshold.
+type FlushHealth struct {
+	// Threshold is the number of consecutive failures after which
+	// the sink is unhealthy.
+	Threshold int
+
+	mutex    sync.Mutex
+	failures int
+	lastErr  error
+}
+
+var _ HealthChecker = &FlushHealth{}
+
+// Record records the outcome of a flush: a failure if err is non-nil,
+// a success otherwise.
+func (h *FlushHealth) Record(err error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if err == nil {
+		h.failures = 0
+		h.lastErr = nil
+		return
+	}
+	h.failures++
+	h.lastErr = err
+}
+
+// Healthy returns an error if the last Threshold flushes all failed.
+func (h *FlushHealth) Healthy() error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	threshold := h.Threshold
+	if threshold <= 0 {
+		threshold = DefaultUnhealthyThreshold
+	}
+	if h.failures < threshold {
+		return nil
+	}
+	return fmt.Errorf("%d consecutive flushes failed, the last with: %v", h.failures, h.lastErr)
+}
@@ -0,0 +1,30 @@
+package sinks
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFlushHealth(t *testing.T) {
+	h := &FlushHealth{}
+	assert.NoError(t, h.Healthy(), "sinks that never flushed are healthy")
+
+	failure := errors.New("503 Service Unavailable")
+	for i := 1; i < DefaultUnhealthyThreshold; i++ {
+		h.Record(failure)
+		assert.NoError(t, h.Healthy(), "%d failures shouldn't cross the threshold", i)
+	}
+	h.Record(failure)
+	if err := h.Healthy(); assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "503 Service Unavailable")
+	}
+
+	h.Record(nil)
+	assert.NoError(t, h.Healthy(), "a success should reset the failures")
+
+	h = &FlushHealth{Threshold: 1}
+	h.Record(failure)
+	assert.Error(t, h.Healthy())
+}
@@ -0,0 +1,232 @@
+package honeycomb
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stripe/veneur/protocol"
+	"github.com/stripe/veneur/sinks"
+	"github.com/stripe/veneur/ssf"
+	"github.com/stripe/veneur/trace"
+)
+
+// DefaultAPIHost is the Honeycomb API that events are sent to, if no
+// other host is configured.
+const DefaultAPIHost = "https://api.honeycomb.io"
+
+// DefaultBatchSize is the number of spans that the sink buffers
+// before sending them, if no other size is configured.
+const DefaultBatchSize = 100
+
+// SampleRateTag is the span tag that carries the rate at which a span
+// was sampled, as a probability in (0..1] like an SSF sample's rate.
+// It is sent as the event's sample rate instead of as a field.
+const SampleRateTag = "sample_rate"
+
+// Event is a single Honeycomb event, as the batch API accepts it.
+type Event struct {
+	Time       string                 `json:"time"`
+	SampleRate int64                  `json:"samplerate,omitempty"`
+	Data       map[string]interface{} `json:"data"`
+}
+
+// eventResponse is the batch API's response for a single event.
+type eventResponse struct {
+	Status int    `json:"status"`
+	Error  string `json:"error"`
+}
+
+// HoneycombSpanSink is a SpanSink that sends each span as an event to
+// a Honeycomb dataset. It buffers spans and sends them in batches,
+// whenever a batch is full and on every flush.
+type HoneycombSpanSink struct {
+	batchURL   string
+	writeKey   string
+	httpClient *http.Client
+	batcher    *sinks.SpanBatcher
+
+	traceClient *trace.Client
+	log         *logrus.Logger
+}
+
+var _ sinks.SpanSink = &HoneycombSpanSink{}
+var _ sinks.Stopper = &HoneycombSpanSink{}
+
+// NewHoneycombSpanSink creates a sink that sends spans to the dataset
+// through the batch events API at apiHost, authenticated with the
+// writeKey, in batches of at most batchSize spans.
+func NewHoneycombSpanSink(apiHost, writeKey, dataset string, batchSize int, httpClient *http.Client, log *logrus.Logger) (*HoneycombSpanSink, error) {
+	if dataset == "" {
+		return nil, fmt.Errorf("a Honeycomb dataset is required")
+	}
+	if apiHost == "" {
+		apiHost = DefaultAPIHost
+	}
+	if _, err := url.Parse(apiHost); err != nil {
+		return nil, err
+	}
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+	s := &HoneycombSpanSink{
+		batchURL:   strings.TrimSuffix(apiHost, "/") + "/1/batch/" + url.PathEscape(dataset),
+		writeKey:   writeKey,
+		httpClient: httpClient,
+		log:        log,
+	}
+	s.batcher = sinks.NewSpanBatcher(s.Name(), batchSize, s.send, log)
+	return s, nil
+}
+
+// Name returns the name of this sink.
+func (s *HoneycombSpanSink) Name() string {
+	return "honeycomb"
+}
+
+// Start sets the sink up and starts sending batches of spans in the
+// background.
+func (s *HoneycombSpanSink) Start(cl *trace.Client) error {
+	s.traceClient = cl
+	s.batcher.Start()
+	return nil
+}
+
+// Ingest buffers the span, and queues the buffered spans to be sent if
+// there are batchSize of them.
+func (s *HoneycombSpanSink) Ingest(span *ssf.SSFSpan) error {
+	if err := protocol.ValidateTrace(span); err != nil {
+		return err
+	}
+	s.batcher.Add(span)
+	return nil
+}
+
+// Flush queues all buffered spans to be sent, and reports the number
+// of spans sent and dropped since the last flush.
+func (s *HoneycombSpanSink) Flush() {
+	s.batcher.Flush(s.traceClient)
+}
+
+// Stop sends the buffered spans, and waits for all batches to be sent.
+func (s *HoneycombSpanSink) Stop() error {
+	return s.batcher.Stop()
+}
+
+func (s *HoneycombSpanSink) send(ctx context.Context, batch []*ssf.SSFSpan) int {
+	events := make([]Event, len(batch))
+	for i, span := range batch {
+		events[i] = convertSpan(span)
+	}
+	responses, err := s.post(ctx, events)
+	if err != nil {
+		s.log.WithError(err).WithField("spans", len(batch)).Warn("Error sending spans to Honeycomb")
+		return 0
+	}
+
+	// The batch API reports each event's outcome separately, in the
+	// order that they were sent.
+	sent := len(batch)
+	var lastErr string
+	for _, resp := range responses {
+		if resp.Status/100 != 2 {
+			sent--
+			lastErr = resp.Error
+		}
+	}
+	if rejected := len(batch) - sent; rejected > 0 {
+		s.log.WithFields(logrus.Fields{
+			"rejected":      rejected,
+			logrus.ErrorKey: lastErr,
+		}).Warn("Honeycomb rejected some spans")
+	}
+	return sent
+}
+
+func (s *HoneycombSpanSink) post(ctx context.Context, events []Event) ([]eventResponse, error) {
+	body, err := json.Marshal(events)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodPost, s.batchURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "veneur")
+	req.Header.Set("X-Honeycomb-Team", s.writeKey)
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("honeycomb responded with %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	var responses []eventResponse
+	if err := json.NewDecoder(resp.Body).Decode(&responses); err != nil {
+		return nil, fmt.Errorf("could not decode honeycomb response: %v", err)
+	}
+	return responses, nil
+}
+
+// convertSpan converts an SSF span into a Honeycomb event. The span's
+// tags become fields of the event, except where they would clash with
+// the fields describing the span itself.
+func convertSpan(span *ssf.SSFSpan) Event {
+	data := make(map[string]interface{}, len(span.Tags)+8)
+	for k, v := range span.Tags {
+		if k == SampleRateTag {
+			continue
+		}
+		data[k] = v
+	}
+	data["trace.trace_id"] = strconv.FormatInt(span.TraceId, 10)
+	data["trace.span_id"] = strconv.FormatInt(span.Id, 10)
+	if span.ParentId > 0 {
+		data["trace.parent_id"] = strconv.FormatInt(span.ParentId, 10)
+	} else {
+		delete(data, "trace.parent_id")
+	}
+	data["name"] = span.Name
+	data["service_name"] = span.Service
+	data["duration_ms"] = float64(span.EndTimestamp-span.StartTimestamp) / float64(time.Millisecond)
+	data["error"] = span.Error
+	if span.Indicator {
+		data["indicator"] = true
+	}
+
+	return Event{
+		Time:       time.Unix(0, span.StartTimestamp).UTC().Format(time.RFC3339Nano),
+		SampleRate: sampleRate(span),
+		Data:       data,
+	}
+}
+
+// sampleRate returns the Honeycomb sample rate of the span: the
+// inverse of the probability in its sample_rate tag, or 0 (which
+// Honeycomb treats as 1) if it wasn't sampled or the tag is invalid.
+func sampleRate(span *ssf.SSFSpan) int64 {
+	tag, ok := span.Tags[SampleRateTag]
+	if !ok {
+		return 0
+	}
+	p, err := strconv.ParseFloat(tag, 64)
+	if err != nil || p <= 0 || p >= 1 {
+		return 0
+	}
+	return int64(math.Round(1 / p))
+}
@@ -0,0 +1,146 @@
+package honeycomb
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stripe/veneur/sinks"
+	"github.com/stripe/veneur/ssf"
+	"github.com/stripe/veneur/trace"
+)
+
+type honeycombRequest struct {
+	path     string
+	writeKey string
+	events   []map[string]interface{}
+}
+
+func TestHoneycombSpanSink(t *testing.T) {
+	requests := make(chan honeycombRequest, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+		var events []map[string]interface{}
+		require.NoError(t, json.Unmarshal(body, &events))
+		requests <- honeycombRequest{r.URL.EscapedPath(), r.Header.Get("X-Honeycomb-Team"), events}
+
+		w.Write([]byte(`[{"status":202},{"status":400,"error":"no"}]`))
+	}))
+	defer server.Close()
+
+	reports := make(chan *ssf.SSFSpan, 2)
+	cl, err := trace.NewChannelClient(reports)
+	require.NoError(t, err)
+	defer cl.Close()
+
+	sink, err := NewHoneycombSpanSink(server.URL, "secret", "my traces", 10, http.DefaultClient, logrus.New())
+	require.NoError(t, err)
+	require.NoError(t, sink.Start(cl))
+
+	start := time.Date(2016, 10, 10, 17, 4, 18, 500, time.UTC)
+	require.NoError(t, sink.Ingest(&ssf.SSFSpan{
+		TraceId:        1,
+		Id:             1,
+		StartTimestamp: start.UnixNano(),
+		EndTimestamp:   start.Add(1500 * time.Microsecond).UnixNano(),
+		Name:           "GET /",
+		Service:        "frontend",
+		Indicator:      true,
+		Tags:           map[string]string{"route": "/", "name": "clobbered"},
+	}))
+	require.NoError(t, sink.Ingest(&ssf.SSFSpan{
+		TraceId:        1,
+		Id:             2,
+		ParentId:       1,
+		StartTimestamp: start.UnixNano(),
+		EndTimestamp:   start.Add(time.Second).UnixNano(),
+		Name:           "db.query",
+		Service:        "frontend",
+		Error:          true,
+		Tags:           map[string]string{SampleRateTag: "0.1"},
+	}))
+	sink.Flush()
+
+	var req honeycombRequest
+	select {
+	case req = <-requests:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the batch")
+	}
+	assert.Equal(t, "/1/batch/my%20traces", req.path)
+	assert.Equal(t, "secret", req.writeKey)
+	assert.Equal(t, []map[string]interface{}{
+		{
+			"time": "2016-10-10T17:04:18.0000005Z",
+			"data": map[string]interface{}{
+				"trace.trace_id": "1",
+				"trace.span_id":  "1",
+				"name":           "GET /",
+				"service_name":   "frontend",
+				"duration_ms":    1.5,
+				"error":          false,
+				"indicator":      true,
+				"route":          "/",
+			},
+		},
+		{
+			"time":       "2016-10-10T17:04:18.0000005Z",
+			"samplerate": 10.0,
+			"data": map[string]interface{}{
+				"trace.trace_id":  "1",
+				"trace.span_id":   "2",
+				"trace.parent_id": "1",
+				"name":            "db.query",
+				"service_name":    "frontend",
+				"duration_ms":     1000.0,
+				"error":           true,
+			},
+		},
+	}, req.events)
+
+	// Stopping waits for the response to be accounted for.
+	assert.Error(t, sink.Stop(), "the rejected span should make stopping fail")
+	sink.Flush()
+	counts := map[string]float32{}
+	for i := 0; i < 2; i++ {
+		for _, m := range (<-reports).Metrics {
+			counts[m.Name] += m.Value
+		}
+	}
+	assert.Equal(t, float32(1), counts[sinks.MetricKeyTotalSpansFlushed], "the accepted span should count as sent")
+	assert.Equal(t, float32(1), counts[sinks.MetricKeyTotalSpansDropped], "the rejected span should count as dropped")
+}
+
+func TestSampleRate(t *testing.T) {
+	tests := []struct {
+		tag  string
+		rate int64
+	}{
+		{"", 0},
+		{"1", 0},
+		{"0.5", 2},
+		{"0.3", 3},
+		{"0.001", 1000},
+		{"0", 0},
+		{"10", 0},
+		{"often", 0},
+	}
+	for _, elt := range tests {
+		test := elt
+		t.Run(test.tag, func(t *testing.T) {
+			t.Parallel()
+			span := &ssf.SSFSpan{}
+			if test.tag != "" {
+				span.Tags = map[string]string{SampleRateTag: test.tag}
+			}
+			assert.Equal(t, test.rate, sampleRate(span))
+		})
+	}
+}
@@ -0,0 +1,182 @@
+package influxdb
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stripe/veneur/samplers"
+	"github.com/stripe/veneur/sinks"
+	"github.com/stripe/veneur/ssf"
+	"github.com/stripe/veneur/trace"
+)
+
+// measurementEscaper escapes the characters that are special in an
+// InfluxDB line protocol measurement name. Line protocol has no way to
+// escape newlines, so they are replaced with underscores.
+var measurementEscaper = strings.NewReplacer(",", `\,`, " ", `\ `, "\n", "_")
+
+// tagEscaper escapes the characters that are special in an InfluxDB
+// line protocol tag key or value.
+var tagEscaper = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `, "\n", "_")
+
+// InfluxDBMetricSink is a MetricSink that writes metrics to InfluxDB's
+// /write endpoint in line protocol.
+type InfluxDBMetricSink struct {
+	writeURL    string
+	tags        []string
+	httpClient  *http.Client
+	traceClient *trace.Client
+	log         *logrus.Logger
+}
+
+var _ sinks.MetricSink = &InfluxDBMetricSink{}
+
+// NewInfluxDBMetricSink creates a sink that writes metrics to the
+// database (and, if it is non-empty, the retention policy) on the
+// InfluxDB server at address, adding tags to each metric.
+func NewInfluxDBMetricSink(address string, database string, retentionPolicy string, tags []string, httpClient *http.Client, log *logrus.Logger) (*InfluxDBMetricSink, error) {
+	if database == "" {
+		return nil, errors.New("influxdb database must be set")
+	}
+	u, err := url.Parse(address)
+	if err != nil {
+		return nil, err
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/write"
+	q := url.Values{}
+	q.Set("db", database)
+	if retentionPolicy != "" {
+		q.Set("rp", retentionPolicy)
+	}
+	q.Set("precision", "ns")
+	u.RawQuery = q.Encode()
+
+	return &InfluxDBMetricSink{
+		writeURL:   u.String(),
+		tags:       tags,
+		httpClient: httpClient,
+		log:        log,
+	}, nil
+}
+
+// Name returns the name of this sink.
+func (s *InfluxDBMetricSink) Name() string {
+	return "influxdb"
+}
+
+// Start sets the sink up.
+func (s *InfluxDBMetricSink) Start(cl *trace.Client) error {
+	s.traceClient = cl
+	return nil
+}
+
+// Flush writes metrics to InfluxDB, one point per metric.
+func (s *InfluxDBMetricSink) Flush(ctx context.Context, interMetrics []samplers.InterMetric) error {
+	span, _ := trace.StartSpanFromContext(ctx, "")
+	defer span.ClientFinish(s.traceClient)
+
+	var body bytes.Buffer
+	points := 0
+	for _, metric := range interMetrics {
+		if !sinks.IsAcceptableMetric(metric, s) {
+			continue
+		}
+		// InfluxDB can't store NaN or infinite field values.
+		if math.IsNaN(metric.Value) || math.IsInf(metric.Value, 0) {
+			continue
+		}
+		s.writeLine(&body, metric)
+		points++
+	}
+	if points == 0 {
+		return nil
+	}
+
+	flushStart := time.Now()
+	if err := s.post(ctx, &body); err != nil {
+		span.Error(err)
+		span.Add(ssf.Count("flush.error_total", 1, map[string]string{"cause": "io", "sink": s.Name()}))
+		s.log.WithError(err).WithField("metrics", points).Warn("Error flushing metrics to InfluxDB")
+		return err
+	}
+	tags := map[string]string{"sink": s.Name()}
+	span.Add(
+		ssf.Timing(sinks.MetricKeyMetricFlushDuration, time.Since(flushStart), time.Nanosecond, tags),
+		ssf.Count(sinks.MetricKeyTotalMetricsFlushed, float32(points), tags),
+	)
+	s.log.WithField("metrics", points).Info("Completed flush to InfluxDB")
+	return nil
+}
+
+// FlushOtherSamples is a no-op: events and service checks are not
+// written to InfluxDB.
+func (s *InfluxDBMetricSink) FlushOtherSamples(ctx context.Context, samples []ssf.SSFSample) {
+}
+
+// writeLine renders the metric as a line of the form
+// "measurement,tag=value,... value=1.5 timestamp". Tags are sorted by
+// key, and tags with an empty key or value are dropped, since InfluxDB
+// rejects them.
+func (s *InfluxDBMetricSink) writeLine(buf *bytes.Buffer, metric samplers.InterMetric) {
+	tags := map[string]string{}
+	for _, tagList := range [][]string{s.tags, metric.Tags} {
+		for _, tag := range tagList {
+			kv := strings.SplitN(tag, ":", 2)
+			if len(kv) < 2 || kv[0] == "" || kv[1] == "" {
+				continue
+			}
+			tags[kv[0]] = kv[1]
+		}
+	}
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	buf.WriteString(measurementEscaper.Replace(metric.Name))
+	for _, k := range keys {
+		buf.WriteByte(',')
+		buf.WriteString(tagEscaper.Replace(k))
+		buf.WriteByte('=')
+		buf.WriteString(tagEscaper.Replace(tags[k]))
+	}
+	buf.WriteString(" value=")
+	buf.WriteString(strconv.FormatFloat(metric.Value, 'g', -1, 64))
+	buf.WriteByte(' ')
+	buf.WriteString(strconv.FormatInt(metric.Timestamp*int64(time.Second), 10))
+	buf.WriteByte('\n')
+}
+
+func (s *InfluxDBMetricSink) post(ctx context.Context, body io.Reader) error {
+	req, err := http.NewRequest(http.MethodPost, s.writeURL, body)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 == 2 {
+		io.Copy(ioutil.Discard, resp.Body)
+		return nil
+	}
+	msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+	return fmt.Errorf("influxdb responded with %s: %s", resp.Status, bytes.TrimSpace(msg))
+}
@@ -0,0 +1,88 @@
+package influxdb
+
+import (
+	"context"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stripe/veneur/samplers"
+)
+
+func TestInfluxDBFlush(t *testing.T) {
+	var body string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "/influx/write", r.URL.Path)
+		assert.Equal(t, "metrics", r.URL.Query().Get("db"))
+		assert.Equal(t, "weekly", r.URL.Query().Get("rp"))
+		assert.Equal(t, "ns", r.URL.Query().Get("precision"))
+		b, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+		body = string(b)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	sink, err := NewInfluxDBMetricSink(srv.URL+"/influx/", "metrics", "weekly", []string{"env:test"}, srv.Client(), logrus.New())
+	require.NoError(t, err)
+	require.NoError(t, sink.Start(nil))
+
+	metrics := []samplers.InterMetric{
+		{
+			Name:      "a.b.c",
+			Timestamp: 1476119058,
+			Value:     100,
+			Tags:      []string{"foo:bar", "empty:", "novalue", "sp ace:a,b=c"},
+			Type:      samplers.CounterMetric,
+		},
+		{
+			Name:      "lat ency,ms.99percentile",
+			Timestamp: 1476119059,
+			Value:     1.5,
+			Type:      samplers.GaugeMetric,
+		},
+		{
+			Name:      "notanumber",
+			Timestamp: 1476119059,
+			Value:     math.NaN(),
+			Type:      samplers.GaugeMetric,
+		},
+		{
+			Name:      "elsewhere",
+			Timestamp: 1476119059,
+			Value:     1,
+			Type:      samplers.GaugeMetric,
+			Sinks:     samplers.RouteInformation{"datadog": struct{}{}},
+		},
+	}
+	require.NoError(t, sink.Flush(context.Background(), metrics))
+	assert.Equal(t,
+		"a.b.c,env=test,foo=bar,sp\\ ace=a\\,b\\=c value=100 1476119058000000000\n"+
+			"lat\\ ency\\,ms.99percentile,env=test value=1.5 1476119059000000000\n",
+		body)
+}
+
+func TestInfluxDBFlushError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"error":"database not found"}`, http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	sink, err := NewInfluxDBMetricSink(srv.URL, "metrics", "", nil, srv.Client(), logrus.New())
+	require.NoError(t, err)
+	err = sink.Flush(context.Background(), []samplers.InterMetric{{Name: "a", Value: 1}})
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "database not found")
+	}
+}
+
+func TestNewInfluxDBMetricSinkRequiresDatabase(t *testing.T) {
+	_, err := NewInfluxDBMetricSink("http://localhost:8086", "", "", nil, http.DefaultClient, logrus.New())
+	assert.Error(t, err)
+}
@@ -0,0 +1,142 @@
+package jaeger
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/stripe/veneur/internal/thrift"
+	"github.com/stripe/veneur/sinks/jaeger/jaegerpb"
+)
+
+// maxPacketSize is the largest UDP packet that the Jaeger agent
+// accepts by default.
+const maxPacketSize = 65000
+
+// Tag types of Jaeger's Thrift model, which are numbered differently
+// from the protobuf model's value types.
+var thriftTagTypes = map[jaegerpb.ValueType]int32{
+	jaegerpb.ValueType_STRING:  0,
+	jaegerpb.ValueType_FLOAT64: 1,
+	jaegerpb.ValueType_BOOL:    2,
+	jaegerpb.ValueType_INT64:   3,
+	jaegerpb.ValueType_BINARY:  4,
+}
+
+// writeTags writes a list field of Jaeger tags.
+func writeTags(w *thrift.Writer, id int16, tags []*jaegerpb.KeyValue) {
+	w.List(id, thrift.TypeStruct, len(tags))
+	for _, kv := range tags {
+		w.ListStruct()
+		w.String(1, kv.Key)
+		w.I32(2, thriftTagTypes[kv.VType])
+		switch kv.VType {
+		case jaegerpb.ValueType_STRING:
+			w.String(3, kv.VStr)
+		case jaegerpb.ValueType_FLOAT64:
+			w.Double(4, kv.VFloat64)
+		case jaegerpb.ValueType_BOOL:
+			w.Bool(5, kv.VBool)
+		case jaegerpb.ValueType_INT64:
+			w.I64(6, kv.VInt64)
+		case jaegerpb.ValueType_BINARY:
+			w.Binary(7, kv.VBinary)
+		}
+		w.EndStruct()
+	}
+}
+
+func micros(seconds int64, nanos int32) int64 {
+	return seconds*1e6 + int64(nanos)/1e3
+}
+
+// encodeBatch encodes the batch as a call of the agent's emitBatch
+// method, as Jaeger's Thrift model defines it.
+func encodeBatch(batch *jaegerpb.Batch, seq int32) []byte {
+	w := &thrift.Writer{}
+	w.Message("emitBatch", seq)
+	w.BeginStruct(1)
+
+	w.BeginStruct(1)
+	w.String(1, batch.Process.ServiceName)
+	if len(batch.Process.Tags) > 0 {
+		writeTags(w, 2, batch.Process.Tags)
+	}
+	w.EndStruct()
+
+	w.List(2, thrift.TypeStruct, len(batch.Spans))
+	for _, span := range batch.Spans {
+		w.ListStruct()
+		w.I64(1, int64(binary.BigEndian.Uint64(span.TraceId[8:])))
+		w.I64(2, int64(binary.BigEndian.Uint64(span.TraceId[:8])))
+		w.I64(3, int64(binary.BigEndian.Uint64(span.SpanId)))
+		var parent int64
+		if len(span.References) > 0 {
+			parent = int64(binary.BigEndian.Uint64(span.References[0].SpanId))
+		}
+		w.I64(4, parent)
+		w.String(5, span.OperationName)
+		w.I32(7, int32(span.Flags))
+		w.I64(8, micros(span.StartTime.Seconds, span.StartTime.Nanos))
+		w.I64(9, micros(span.Duration.Seconds, span.Duration.Nanos))
+		if len(span.Tags) > 0 {
+			writeTags(w, 10, span.Tags)
+		}
+		if len(span.Logs) > 0 {
+			w.List(11, thrift.TypeStruct, len(span.Logs))
+			for _, log := range span.Logs {
+				w.ListStruct()
+				w.I64(1, micros(log.Timestamp.Seconds, log.Timestamp.Nanos))
+				writeTags(w, 2, log.Fields)
+				w.EndStruct()
+			}
+		}
+		w.EndStruct()
+	}
+
+	w.EndStruct()
+	w.EndStruct()
+	return w.Bytes()
+}
+
+// agentExporter exports batches to a Jaeger agent as compact Thrift
+// over UDP.
+type agentExporter struct {
+	mutex sync.Mutex
+	conn  net.Conn
+	seq   int32
+}
+
+func newAgentExporter(address string) (*agentExporter, error) {
+	conn, err := net.Dial("udp", address)
+	if err != nil {
+		return nil, err
+	}
+	return &agentExporter{conn: conn}, nil
+}
+
+// export sends the batch in as many packets as it takes to keep each
+// of them below the agent's maximum packet size.
+func (e *agentExporter) export(ctx context.Context, batch *jaegerpb.Batch) error {
+	e.mutex.Lock()
+	e.seq++
+	seq := e.seq
+	e.mutex.Unlock()
+
+	packet := encodeBatch(batch, seq)
+	if len(packet) <= maxPacketSize {
+		_, err := e.conn.Write(packet)
+		return err
+	}
+	if len(batch.Spans) < 2 {
+		return fmt.Errorf("span %x is too large to send to the agent: %d bytes", batch.Spans[0].SpanId, len(packet))
+	}
+	half := len(batch.Spans) / 2
+	first := e.export(ctx, &jaegerpb.Batch{Process: batch.Process, Spans: batch.Spans[:half]})
+	if err := e.export(ctx, &jaegerpb.Batch{Process: batch.Process, Spans: batch.Spans[half:]}); err != nil {
+		return err
+	}
+	return first
+}
@@ -0,0 +1,278 @@
+package jaeger
+
+import (
+	"context"
+	"encoding/binary"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stripe/veneur/protocol"
+	"github.com/stripe/veneur/sinks"
+	"github.com/stripe/veneur/sinks/jaeger/jaegerpb"
+	"github.com/stripe/veneur/ssf"
+	"github.com/stripe/veneur/trace"
+	"google.golang.org/grpc"
+)
+
+// DefaultBatchSize is the number of spans that the span sink buffers
+// before exporting them, if no other size is configured.
+const DefaultBatchSize = 100
+
+// sampledFlag marks a Jaeger span as sampled. Veneur only receives
+// spans that were sampled already.
+const sampledFlag = 1
+
+// exporter sends a batch of spans of a single process to Jaeger.
+type exporter interface {
+	export(ctx context.Context, batch *jaegerpb.Batch) error
+}
+
+// JaegerSpanSink is a SpanSink that exports spans to Jaeger, either
+// to a collector over gRPC or to an agent as Thrift over UDP. It
+// buffers spans and exports them in batches, whenever a batch is full
+// and on every flush.
+type JaegerSpanSink struct {
+	target      string
+	processTags []*jaegerpb.KeyValue
+	exporter    exporter
+	batcher     *sinks.SpanBatcher
+
+	traceClient *trace.Client
+	log         *logrus.Logger
+}
+
+var _ sinks.SpanSink = &JaegerSpanSink{}
+var _ sinks.Stopper = &JaegerSpanSink{}
+
+// NewJaegerCollectorSpanSink creates a sink that exports spans to the
+// Jaeger collector at target ("host:port"), using opts to dial its
+// gRPC API, in batches of at most batchSize spans. The hostname and
+// the tags (in "key:value" form) become tags of each span's process.
+func NewJaegerCollectorSpanSink(ctx context.Context, target string, hostname string, tags []string, batchSize int, log *logrus.Logger, opts ...grpc.DialOption) (*JaegerSpanSink, error) {
+	conn, err := grpc.DialContext(ctx, target, opts...)
+	if err != nil {
+		log.WithError(err).WithField("target", target).Error("Error establishing connection to Jaeger collector")
+		return nil, err
+	}
+	exp := &collectorExporter{client: jaegerpb.NewCollectorServiceClient(conn)}
+	return newJaegerSpanSink(target, hostname, tags, batchSize, exp, log), nil
+}
+
+// NewJaegerAgentSpanSink creates a sink that exports spans to the
+// Jaeger agent at address ("host:port"), as compact Thrift over UDP.
+// Its other arguments are those of NewJaegerCollectorSpanSink.
+func NewJaegerAgentSpanSink(address string, hostname string, tags []string, batchSize int, log *logrus.Logger) (*JaegerSpanSink, error) {
+	exp, err := newAgentExporter(address)
+	if err != nil {
+		log.WithError(err).WithField("address", address).Error("Error resolving Jaeger agent")
+		return nil, err
+	}
+	return newJaegerSpanSink(address, hostname, tags, batchSize, exp, log), nil
+}
+
+func newJaegerSpanSink(target string, hostname string, tags []string, batchSize int, exp exporter, log *logrus.Logger) *JaegerSpanSink {
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+	var processTags []*jaegerpb.KeyValue
+	if hostname != "" {
+		processTags = append(processTags, stringTag("hostname", hostname))
+	}
+	for _, tag := range tags {
+		kv := strings.SplitN(tag, ":", 2)
+		if len(kv) == 1 {
+			kv = append(kv, "")
+		}
+		processTags = append(processTags, stringTag(kv[0], kv[1]))
+	}
+	s := &JaegerSpanSink{
+		target:      target,
+		processTags: processTags,
+		exporter:    exp,
+		log:         log,
+	}
+	s.batcher = sinks.NewSpanBatcher(s.Name(), batchSize, s.export, log)
+	return s
+}
+
+// Name returns the name of this sink.
+func (s *JaegerSpanSink) Name() string {
+	return "jaeger"
+}
+
+// Start sets the sink up and starts exporting batches of spans in the
+// background.
+func (s *JaegerSpanSink) Start(cl *trace.Client) error {
+	s.traceClient = cl
+	s.batcher.Start()
+	return nil
+}
+
+// Ingest buffers the span, and queues the buffered spans for export
+// if there are batchSize of them.
+func (s *JaegerSpanSink) Ingest(span *ssf.SSFSpan) error {
+	if err := protocol.ValidateTrace(span); err != nil {
+		return err
+	}
+	s.batcher.Add(span)
+	return nil
+}
+
+// Flush queues all buffered spans for export, and reports the number
+// of spans exported and dropped since the last flush.
+func (s *JaegerSpanSink) Flush() {
+	s.batcher.Flush(s.traceClient)
+}
+
+// Stop exports the buffered spans, and waits for all batches to be
+// exported.
+func (s *JaegerSpanSink) Stop() error {
+	return s.batcher.Stop()
+}
+
+func (s *JaegerSpanSink) export(ctx context.Context, spans []*ssf.SSFSpan) int {
+	sent := 0
+	for _, batch := range s.batches(spans) {
+		if err := s.exporter.export(ctx, batch); err != nil {
+			s.log.WithError(err).WithFields(logrus.Fields{
+				"target":  s.target,
+				"service": batch.Process.ServiceName,
+				"spans":   len(batch.Spans),
+			}).Warn("Error exporting spans to Jaeger")
+			continue
+		}
+		sent += len(batch.Spans)
+	}
+	return sent
+}
+
+// batches converts the spans into one Jaeger batch per service, since
+// each batch describes the process that all of its spans belong to.
+func (s *JaegerSpanSink) batches(spans []*ssf.SSFSpan) []*jaegerpb.Batch {
+	byService := map[string]*jaegerpb.Batch{}
+	var batches []*jaegerpb.Batch
+	for _, span := range spans {
+		batch, ok := byService[span.Service]
+		if !ok {
+			batch = &jaegerpb.Batch{Process: &jaegerpb.Process{
+				ServiceName: span.Service,
+				Tags:        s.processTags,
+			}}
+			byService[span.Service] = batch
+			batches = append(batches, batch)
+		}
+		batch.Spans = append(batch.Spans, convertSpan(span))
+	}
+	return batches
+}
+
+// traceID encodes an SSF trace ID as a 128-bit Jaeger trace ID: the
+// high 64 bits are the upper half of the span's propagated trace ID
+// (zero for 64-bit trace IDs), and the low 64 bits are the SSF trace
+// ID, in big-endian order.
+func traceID(high uint64, id int64) []byte {
+	b := make([]byte, 16)
+	binary.BigEndian.PutUint64(b, high)
+	binary.BigEndian.PutUint64(b[8:], uint64(id))
+	return b
+}
+
+// spanID encodes an SSF span ID as a Jaeger span ID, in big-endian
+// order.
+func spanID(id int64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(id))
+	return b
+}
+
+func stringTag(key, value string) *jaegerpb.KeyValue {
+	return &jaegerpb.KeyValue{Key: key, VType: jaegerpb.ValueType_STRING, VStr: value}
+}
+
+func boolTag(key string, value bool) *jaegerpb.KeyValue {
+	return &jaegerpb.KeyValue{Key: key, VType: jaegerpb.ValueType_BOOL, VBool: value}
+}
+
+func timestamp(nanos int64) *jaegerpb.Timestamp {
+	return &jaegerpb.Timestamp{Seconds: nanos / int64(time.Second), Nanos: int32(nanos % int64(time.Second))}
+}
+
+// convertSpan converts an SSF span into a Jaeger span. The span's tags
+// become string tags sorted by key; error and indicator spans get the
+// boolean tags "error" and "indicator". The metrics embedded in the
+// span become its logs.
+func convertSpan(span *ssf.SSFSpan) *jaegerpb.Span {
+	duration := span.EndTimestamp - span.StartTimestamp
+	js := &jaegerpb.Span{
+		TraceId:       traceID(trace.TraceIDHigh(span.Tags), span.TraceId),
+		SpanId:        spanID(span.Id),
+		OperationName: span.Name,
+		Flags:         sampledFlag,
+		StartTime:     timestamp(span.StartTimestamp),
+		Duration: &jaegerpb.Duration{
+			Seconds: duration / int64(time.Second),
+			Nanos:   int32(duration % int64(time.Second)),
+		},
+	}
+	if span.ParentId > 0 {
+		js.References = []*jaegerpb.SpanRef{{
+			TraceId: js.TraceId,
+			SpanId:  spanID(span.ParentId),
+			RefType: jaegerpb.SpanRefType_CHILD_OF,
+		}}
+	}
+
+	keys := make([]string, 0, len(span.Tags))
+	for k := range span.Tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		js.Tags = append(js.Tags, stringTag(k, span.Tags[k]))
+	}
+	if span.Error {
+		js.Tags = append(js.Tags, boolTag("error", true))
+	}
+	if span.Indicator {
+		js.Tags = append(js.Tags, boolTag("indicator", true))
+	}
+
+	for _, sample := range span.Metrics {
+		ts := sample.Timestamp
+		if ts == 0 {
+			ts = span.StartTimestamp
+		}
+		log := &jaegerpb.Log{
+			Timestamp: timestamp(ts),
+			Fields: []*jaegerpb.KeyValue{
+				stringTag("event", sample.Name),
+				{Key: "value", VType: jaegerpb.ValueType_FLOAT64, VFloat64: float64(sample.Value)},
+			},
+		}
+		if sample.Message != "" {
+			log.Fields = append(log.Fields, stringTag("message", sample.Message))
+		}
+		keys = keys[:0]
+		for k := range sample.Tags {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			log.Fields = append(log.Fields, stringTag(k, sample.Tags[k]))
+		}
+		js.Logs = append(js.Logs, log)
+	}
+	return js
+}
+
+// collectorExporter exports batches to a Jaeger collector's gRPC API.
+type collectorExporter struct {
+	client jaegerpb.CollectorServiceClient
+}
+
+func (e *collectorExporter) export(ctx context.Context, batch *jaegerpb.Batch) error {
+	_, err := e.client.PostSpans(ctx, &jaegerpb.PostSpansRequest{Batch: batch})
+	return err
+}
@@ -0,0 +1,202 @@
+package jaeger
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	ocontext "golang.org/x/net/context"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stripe/veneur/sinks/jaeger/jaegerpb"
+	"github.com/stripe/veneur/ssf"
+	"google.golang.org/grpc"
+)
+
+type mockCollector struct {
+	mut      sync.Mutex
+	batches  []*jaegerpb.Batch
+	received chan struct{}
+}
+
+func (m *mockCollector) PostSpans(ctx ocontext.Context, req *jaegerpb.PostSpansRequest) (*jaegerpb.PostSpansResponse, error) {
+	m.mut.Lock()
+	m.batches = append(m.batches, req.Batch)
+	m.mut.Unlock()
+	m.received <- struct{}{}
+	return &jaegerpb.PostSpansResponse{}, nil
+}
+
+func TestTraceAndSpanIDs(t *testing.T) {
+	assert.Equal(t, []byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0x01, 0x02}, traceID(0, 0x0102))
+	assert.Equal(t, []byte{0, 0, 0, 0, 0, 0, 0, 0, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, traceID(0, -1))
+	assert.Equal(t, []byte{0x80, 0xf1, 0x98, 0xee, 0x56, 0x34, 0x3b, 0xa8, 0, 0, 0, 0, 0, 0, 0x01, 0x02},
+		traceID(0x80f198ee56343ba8, 0x0102))
+	assert.Equal(t, []byte{0, 0, 0, 0, 0, 0, 0x01, 0x02}, spanID(0x0102))
+}
+
+func TestConvertSpan(t *testing.T) {
+	start := time.Unix(1476119058, 500)
+	root := convertSpan(&ssf.SSFSpan{
+		TraceId:        1,
+		Id:             1,
+		StartTimestamp: start.UnixNano(),
+		EndTimestamp:   start.Add(1500 * time.Millisecond).UnixNano(),
+		Name:           "GET /",
+		Service:        "frontend",
+		Indicator:      true,
+		Tags:           map[string]string{"route": "/", "method": "GET"},
+		Metrics: []*ssf.SSFSample{
+			ssf.Count("cache.miss", 2, map[string]string{"cache": "users"}, ssf.Timestamp(start.Add(time.Second))),
+		},
+	})
+	assert.Equal(t, traceID(0, 1), root.TraceId)
+	assert.Equal(t, spanID(1), root.SpanId)
+	assert.Empty(t, root.References, "root spans have no parent")
+	assert.Equal(t, "GET /", root.OperationName)
+	assert.Equal(t, uint32(sampledFlag), root.Flags)
+	assert.Equal(t, &jaegerpb.Timestamp{Seconds: 1476119058, Nanos: 500}, root.StartTime)
+	assert.Equal(t, &jaegerpb.Duration{Seconds: 1, Nanos: 500000000}, root.Duration)
+	assert.Equal(t, []*jaegerpb.KeyValue{
+		stringTag("method", "GET"),
+		stringTag("route", "/"),
+		boolTag("indicator", true),
+	}, root.Tags)
+	require.Len(t, root.Logs, 1)
+	assert.Equal(t, &jaegerpb.Timestamp{Seconds: 1476119059, Nanos: 500}, root.Logs[0].Timestamp)
+	assert.Equal(t, []*jaegerpb.KeyValue{
+		stringTag("event", "cache.miss"),
+		{Key: "value", VType: jaegerpb.ValueType_FLOAT64, VFloat64: 2},
+		stringTag("cache", "users"),
+	}, root.Logs[0].Fields)
+
+	child := convertSpan(&ssf.SSFSpan{
+		TraceId:        1,
+		Id:             2,
+		ParentId:       1,
+		StartTimestamp: start.UnixNano(),
+		EndTimestamp:   start.Add(time.Millisecond).UnixNano(),
+		Name:           "db.query",
+		Service:        "frontend",
+		Error:          true,
+	})
+	assert.Equal(t, root.TraceId, child.TraceId)
+	assert.Equal(t, []*jaegerpb.SpanRef{{
+		TraceId: traceID(0, 1),
+		SpanId:  spanID(1),
+		RefType: jaegerpb.SpanRefType_CHILD_OF,
+	}}, child.References)
+	assert.Equal(t, []*jaegerpb.KeyValue{boolTag("error", true)}, child.Tags)
+}
+
+func testSpan(id int64, service string) *ssf.SSFSpan {
+	return &ssf.SSFSpan{
+		TraceId:        id,
+		Id:             id,
+		StartTimestamp: time.Now().UnixNano(),
+		EndTimestamp:   time.Now().UnixNano(),
+		Name:           "test",
+		Service:        service,
+	}
+}
+
+func TestJaegerCollectorSpanSink(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	srv := grpc.NewServer()
+	mock := &mockCollector{received: make(chan struct{}, 10)}
+	jaegerpb.RegisterCollectorServiceServer(srv, mock)
+	go srv.Serve(lis)
+	defer srv.Stop()
+
+	sink, err := NewJaegerCollectorSpanSink(context.Background(), lis.Addr().String(), "myhost", []string{"env:test", "canary"}, 10, logrus.New(), grpc.WithInsecure())
+	require.NoError(t, err)
+	require.NoError(t, sink.Start(nil))
+
+	assert.Error(t, sink.Ingest(&ssf.SSFSpan{}), "invalid spans should be rejected")
+	require.NoError(t, sink.Ingest(testSpan(1, "a")))
+	require.NoError(t, sink.Ingest(testSpan(2, "b")))
+	require.NoError(t, sink.Ingest(testSpan(3, "a")))
+	sink.Flush()
+	for i := 0; i < 2; i++ {
+		select {
+		case <-mock.received:
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for batches")
+		}
+	}
+
+	mock.mut.Lock()
+	defer mock.mut.Unlock()
+	require.Len(t, mock.batches, 2, "spans should be batched by service")
+	for i, service := range []string{"a", "b"} {
+		batch := mock.batches[i]
+		assert.Equal(t, service, batch.Process.ServiceName)
+		assert.Equal(t, []*jaegerpb.KeyValue{
+			stringTag("hostname", "myhost"),
+			stringTag("env", "test"),
+			stringTag("canary", ""),
+		}, batch.Process.Tags)
+	}
+	require.Len(t, mock.batches[0].Spans, 2)
+	assert.Equal(t, spanID(1), mock.batches[0].Spans[0].SpanId)
+	assert.Equal(t, spanID(3), mock.batches[0].Spans[1].SpanId)
+	require.Len(t, mock.batches[1].Spans, 1)
+	assert.Equal(t, traceID(0, 2), mock.batches[1].Spans[0].TraceId)
+}
+
+func TestJaegerAgentSpanSink(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer conn.Close()
+
+	sink, err := NewJaegerAgentSpanSink(conn.LocalAddr().String(), "myhost", nil, 10, logrus.New())
+	require.NoError(t, err)
+	require.NoError(t, sink.Start(nil))
+	require.NoError(t, sink.Ingest(testSpan(0x0102, "a")))
+	sink.Flush()
+
+	buf := make([]byte, maxPacketSize)
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	n, _, err := conn.ReadFrom(buf)
+	require.NoError(t, err)
+	packet := buf[:n]
+
+	// A oneway emitBatch call with sequence number 1...
+	assert.Equal(t, append([]byte{0x82, 0x81, 1, 9}, "emitBatch"...), packet[:13])
+	// ...whose batch's process has the service name "a"...
+	assert.Equal(t, []byte{0x1c, 0x1c, 0x18, 1, 'a'}, packet[13:18])
+	// ...and whose span has the low trace ID 0x0102 (zigzag-encoded),
+	// followed by the high trace ID 0.
+	assert.True(t, bytes.Contains(packet, []byte{0x16, 0x84, 0x04, 0x16, 0x00}), "unexpected packet %x", packet)
+}
+
+func TestAgentExporterSplitsLargeBatches(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer conn.Close()
+	exp, err := newAgentExporter(conn.LocalAddr().String())
+	require.NoError(t, err)
+
+	big := string(bytes.Repeat([]byte("x"), maxPacketSize/3))
+	batch := &jaegerpb.Batch{Process: &jaegerpb.Process{ServiceName: "a"}}
+	for i := int64(1); i <= 4; i++ {
+		span := testSpan(i, "a")
+		span.Tags = map[string]string{"big": big}
+		batch.Spans = append(batch.Spans, convertSpan(span))
+	}
+	require.NoError(t, exp.export(context.Background(), batch))
+
+	buf := make([]byte, maxPacketSize)
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	for i := 0; i < 2; i++ {
+		n, _, err := conn.ReadFrom(buf)
+		require.NoError(t, err, "the batch should be split into two packets")
+		assert.True(t, n <= maxPacketSize)
+	}
+}
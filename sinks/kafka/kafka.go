@@ -10,6 +10,7 @@ import (
 	"math"
 	"strconv"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -32,20 +33,37 @@ const IngestTimeout = 5 * time.Second
 
 var IngestTimeoutError = errors.New("Timed out writing to Kafka producer")
 
+var errStopped = errors.New("the Kafka sink is stopped")
+
 var _ sinks.MetricSink = &KafkaMetricSink{}
 var _ sinks.SpanSink = &KafkaSpanSink{}
 
 type KafkaMetricSink struct {
-	logger      *logrus.Entry
-	producer    sarama.AsyncProducer
-	checkTopic  string
-	eventTopic  string
-	metricTopic string
-	brokers     string
-	config      *sarama.Config
-	traceClient *trace.Client
+	logger          *logrus.Entry
+	producer        sarama.AsyncProducer
+	checkTopic      string
+	eventTopic      string
+	metricTopic     string
+	brokers         string
+	partitionKey    string
+	partitionKeyTag string
+	config          *sarama.Config
+	traceClient     *trace.Client
+
+	// produceErrors counts the metrics that failed to be produced
+	// since the last flush.
+	produceErrors int64
+	health        sinks.FlushHealth
+
+	// mtx guards stopped; flushes hold it for reading while they
+	// produce, so that Stop never closes the producer under them.
+	mtx     sync.RWMutex
+	stopped bool
 }
 
+var _ sinks.HealthChecker = &KafkaMetricSink{}
+var _ sinks.Stopper = &KafkaMetricSink{}
+
 type KafkaSpanSink struct {
 	logger          *logrus.Entry
 	producer        sarama.AsyncProducer
@@ -57,10 +75,27 @@ type KafkaSpanSink struct {
 	config          *sarama.Config
 	spansFlushed    int64
 	traceClient     *trace.Client
+
+	// mtx guards stopped; Ingest holds it for reading while it
+	// produces, so that Stop never closes the producer under it.
+	mtx     sync.RWMutex
+	stopped bool
 }
 
+var _ sinks.Stopper = &KafkaSpanSink{}
+
+// PartitionKeyName is the partition key setting that partitions
+// metrics by their name.
+const PartitionKeyName = "name"
+
 // NewKafkaMetricSink creates a new Kafka Plugin.
-func NewKafkaMetricSink(logger *logrus.Logger, cl *trace.Client, brokers string, checkTopic string, eventTopic string, metricTopic string, ackRequirement string, partitioner string, retries int, bufferBytes int, bufferMessages int, bufferDuration string) (*KafkaMetricSink, error) {
+//
+// If partitionKeyTag is set, metrics are partitioned by the value of
+// that tag; if partitionKey is PartitionKeyName, they are partitioned
+// by their name. Metrics with the same key always go to the same
+// partition, and metrics that don't have the tag are spread across
+// partitions round-robin. Otherwise, the partitioner setting applies.
+func NewKafkaMetricSink(logger *logrus.Logger, cl *trace.Client, brokers string, checkTopic string, eventTopic string, metricTopic string, ackRequirement string, partitioner string, retries int, bufferBytes int, bufferMessages int, bufferDuration string, partitionKey string, partitionKeyTag string) (*KafkaMetricSink, error) {
 	if logger == nil {
 		logger = &logrus.Logger{Out: ioutil.Discard}
 	}
@@ -69,6 +104,10 @@ func NewKafkaMetricSink(logger *logrus.Logger, cl *trace.Client, brokers string,
 		return nil, errors.New("Unable to start Kafka sink with no valid topic names")
 	}
 
+	if partitionKey != "" && partitionKey != PartitionKeyName {
+		return nil, fmt.Errorf("Unknown Kafka metric partition key %q, must be %q", partitionKey, PartitionKeyName)
+	}
+
 	ll := logger.WithField("metric_sink", "kafka")
 
 	var finalBufferDuration time.Duration
@@ -81,28 +120,37 @@ func NewKafkaMetricSink(logger *logrus.Logger, cl *trace.Client, brokers string,
 	}
 
 	config, _ := newProducerConfig(ll, ackRequirement, partitioner, retries, bufferBytes, bufferMessages, finalBufferDuration)
+	if partitionKey != "" || partitionKeyTag != "" {
+		config.Producer.Partitioner = newKeyedPartitioner
+	}
+	// Errors are read by trackErrors, to judge the sink's health.
+	config.Producer.Return.Errors = true
 
 	ll.WithFields(logrus.Fields{
-		"brokers":         brokers,
-		"check_topic":     checkTopic,
-		"event_topic":     eventTopic,
-		"metric_topic":    metricTopic,
-		"partitioner":     partitioner,
-		"ack_requirement": ackRequirement,
-		"max_retries":     retries,
-		"buffer_bytes":    bufferBytes,
-		"buffer_messages": bufferMessages,
-		"buffer_duration": bufferDuration,
+		"brokers":           brokers,
+		"check_topic":       checkTopic,
+		"partition_key":     partitionKey,
+		"partition_key_tag": partitionKeyTag,
+		"event_topic":       eventTopic,
+		"metric_topic":      metricTopic,
+		"partitioner":       partitioner,
+		"ack_requirement":   ackRequirement,
+		"max_retries":       retries,
+		"buffer_bytes":      bufferBytes,
+		"buffer_messages":   bufferMessages,
+		"buffer_duration":   bufferDuration,
 	}).Info("Created Kafka metric sink")
 
 	return &KafkaMetricSink{
-		logger:      ll,
-		checkTopic:  checkTopic,
-		eventTopic:  eventTopic,
-		metricTopic: metricTopic,
-		brokers:     brokers,
-		config:      config,
-		traceClient: cl,
+		logger:          ll,
+		checkTopic:      checkTopic,
+		eventTopic:      eventTopic,
+		metricTopic:     metricTopic,
+		brokers:         brokers,
+		partitionKey:    partitionKey,
+		partitionKeyTag: partitionKeyTag,
+		config:          config,
+		traceClient:     cl,
 	}, nil
 }
 
@@ -151,6 +199,34 @@ func newProducerConfig(logger *logrus.Entry, ackRequirement string, partitioner
 	return config, nil
 }
 
+// keyedPartitioner sends messages with a key to the partition that
+// the key hashes to, and spreads messages without a key across
+// partitions round-robin.
+type keyedPartitioner struct {
+	hash       sarama.Partitioner
+	roundRobin sarama.Partitioner
+}
+
+func newKeyedPartitioner(topic string) sarama.Partitioner {
+	return &keyedPartitioner{
+		hash:       sarama.NewHashPartitioner(topic),
+		roundRobin: sarama.NewRoundRobinPartitioner(topic),
+	}
+}
+
+func (p *keyedPartitioner) Partition(message *sarama.ProducerMessage, numPartitions int32) (int32, error) {
+	if message.Key == nil {
+		return p.roundRobin.Partition(message, numPartitions)
+	}
+	return p.hash.Partition(message, numPartitions)
+}
+
+// RequiresConsistency is true, since keyed messages must always go to
+// the partition their key hashes to.
+func (p *keyedPartitioner) RequiresConsistency() bool {
+	return true
+}
+
 // newConfiguredProducer returns a configured Sarama SyncProducer
 func newConfiguredProducer(logger *logrus.Entry, brokerString string, config *sarama.Config) (sarama.AsyncProducer, error) {
 	brokerList := strings.Split(brokerString, ",")
@@ -182,19 +258,52 @@ func (k *KafkaMetricSink) Start(cl *trace.Client) error {
 		return err
 	}
 	k.producer = producer
+	if producer != nil {
+		go k.trackErrors(producer)
+	}
 	return nil
 }
 
+// trackErrors counts the messages that the producer fails to produce,
+// until it is closed.
+func (k *KafkaMetricSink) trackErrors(producer sarama.AsyncProducer) {
+	for err := range producer.Errors() {
+		atomic.AddInt64(&k.produceErrors, 1)
+		k.logger.WithError(err.Err).Debug("Error producing metric")
+	}
+}
+
+// Healthy returns an error if metrics failed to be produced in each of
+// the last few flush intervals.
+func (k *KafkaMetricSink) Healthy() error {
+	return k.health.Healthy()
+}
+
 // Flush sends a slice of metrics to Kafka
 func (k *KafkaMetricSink) Flush(ctx context.Context, interMetrics []samplers.InterMetric) error {
 	samples := &ssf.Samples{}
 	defer metrics.Report(k.traceClient, samples)
 
+	// Metrics are produced asynchronously, so the outcome of a flush
+	// is only known by the next one.
+	if failed := atomic.SwapInt64(&k.produceErrors, 0); failed > 0 {
+		samples.Add(ssf.Count("flush.error_total", float32(failed), map[string]string{"cause": "io", "sink": k.Name()}))
+		k.health.Record(fmt.Errorf("%d metrics failed to be produced to Kafka", failed))
+	} else {
+		k.health.Record(nil)
+	}
+
 	if len(interMetrics) == 0 {
 		k.logger.Info("Nothing to flush, skipping.")
 		return nil
 	}
 
+	k.mtx.RLock()
+	defer k.mtx.RUnlock()
+	if k.stopped {
+		return errStopped
+	}
+
 	successes := int64(0)
 	for _, metric := range interMetrics {
 		if !sinks.IsAcceptableMetric(metric, k) {
@@ -211,6 +320,7 @@ func (k *KafkaMetricSink) Flush(ctx context.Context, interMetrics []samplers.Int
 
 		k.producer.Input() <- &sarama.ProducerMessage{
 			Topic: k.metricTopic,
+			Key:   k.messageKey(metric),
 			Value: sarama.StringEncoder(j),
 		}
 		successes++
@@ -219,6 +329,39 @@ func (k *KafkaMetricSink) Flush(ctx context.Context, interMetrics []samplers.Int
 	return nil
 }
 
+// messageKey returns the key to partition the metric by, or nil if
+// the metric should not be partitioned by key.
+func (k *KafkaMetricSink) messageKey(metric samplers.InterMetric) sarama.Encoder {
+	if k.partitionKeyTag != "" {
+		prefix := k.partitionKeyTag + ":"
+		for _, tag := range metric.Tags {
+			if strings.HasPrefix(tag, prefix) {
+				return sarama.StringEncoder(tag[len(prefix):])
+			}
+		}
+		return nil
+	}
+	if k.partitionKey == PartitionKeyName {
+		return sarama.StringEncoder(metric.Name)
+	}
+	return nil
+}
+
+// Stop closes the producer, which waits for the metrics that it
+// buffered to be produced. Later flushes fail.
+func (k *KafkaMetricSink) Stop() error {
+	k.mtx.Lock()
+	defer k.mtx.Unlock()
+	if k.stopped {
+		return nil
+	}
+	k.stopped = true
+	if k.producer == nil {
+		return nil
+	}
+	return k.producer.Close()
+}
+
 // FlushOtherSamples flushes non-metric, non-span samples
 func (k *KafkaMetricSink) FlushOtherSamples(ctx context.Context, samples []ssf.SSFSample) {
 	// TODO
@@ -374,6 +517,11 @@ func (k *KafkaSpanSink) Ingest(span *ssf.SSFSpan) error {
 		Value: enc,
 	}
 
+	k.mtx.RLock()
+	defer k.mtx.RUnlock()
+	if k.stopped {
+		return errStopped
+	}
 	select {
 	case k.producer.Input() <- message:
 		atomic.AddInt64(&k.spansFlushed, 1)
@@ -383,6 +531,21 @@ func (k *KafkaSpanSink) Ingest(span *ssf.SSFSpan) error {
 	}
 }
 
+// Stop closes the producer, which waits for the spans that it buffered
+// to be produced. Spans ingested later are refused.
+func (k *KafkaSpanSink) Stop() error {
+	k.mtx.Lock()
+	defer k.mtx.Unlock()
+	if k.stopped {
+		return nil
+	}
+	k.stopped = true
+	if k.producer == nil {
+		return nil
+	}
+	return k.producer.Close()
+}
+
 // Flush emits metrics, since the spans have already been ingested and are
 // sending async.
 func (k *KafkaSpanSink) Flush() {
@@ -28,7 +28,7 @@ func TestMetricFlush(t *testing.T) {
 	// https://github.com/stripe/veneur/issues/277
 	logger := logrus.StandardLogger()
 
-	sink, err := NewKafkaMetricSink(logger, nil, "testing", "testCheckTopic", "testEventTopic", "testMetricTopic", "all", "hash", 0, 0, 0, "")
+	sink, err := NewKafkaMetricSink(logger, nil, "testing", "testCheckTopic", "testEventTopic", "testMetricTopic", "all", "hash", 0, 0, 0, "", "", "")
 	assert.NoError(t, err)
 	sink.Start(trace.DefaultClient)
 
@@ -122,7 +122,7 @@ func TestMetricFlushRouting(t *testing.T) {
 			// https://github.com/stripe/veneur/issues/277
 			logger := logrus.StandardLogger()
 
-			sink, err := NewKafkaMetricSink(logger, nil, "testing", "testCheckTopic", "testEventTopic", "testMetricTopic", "all", "hash", 0, 0, 0, "")
+			sink, err := NewKafkaMetricSink(logger, nil, "testing", "testCheckTopic", "testEventTopic", "testMetricTopic", "all", "hash", 0, 0, 0, "", "", "")
 			assert.NoError(t, err)
 			sink.Start(trace.DefaultClient)
 
@@ -150,7 +150,7 @@ func TestMetricFlushRouting(t *testing.T) {
 func TestMetricConstructor(t *testing.T) {
 	logger := logrus.StandardLogger()
 
-	sink, err := NewKafkaMetricSink(logger, nil, "testing", "veneur_checks", "veneur_events", "veneur_metrics", "all", "hash", 1, 2, 3, "10s")
+	sink, err := NewKafkaMetricSink(logger, nil, "testing", "veneur_checks", "veneur_events", "veneur_metrics", "all", "hash", 1, 2, 3, "10s", "", "")
 	assert.NoError(t, err)
 
 	assert.Equal(t, "kafka", sink.Name())
@@ -170,11 +170,11 @@ func TestMetricInstantiateError(t *testing.T) {
 	logger := logrus.StandardLogger()
 
 	// Busted duration
-	_, err1 := NewKafkaMetricSink(logger, nil, "testing", "veneur_checks", "veneur_events", "veneur_metrics", "all", "hash", 1, 2, 3, "farts")
+	_, err1 := NewKafkaMetricSink(logger, nil, "testing", "veneur_checks", "veneur_events", "veneur_metrics", "all", "hash", 1, 2, 3, "farts", "", "")
 	assert.Error(t, err1)
 
 	// No topics
-	_, err := NewKafkaMetricSink(logger, nil, "testing", "", "", "", "all", "hash", 1, 2, 3, "10s")
+	_, err := NewKafkaMetricSink(logger, nil, "testing", "", "", "", "all", "hash", 1, 2, 3, "10s", "", "")
 	assert.Error(t, err)
 }
 
@@ -487,3 +487,102 @@ func TestSpanFlushProtobuf(t *testing.T) {
 
 	assert.Equal(t, testSpan.Service, span.Service)
 }
+
+func TestMetricPartitionKey(t *testing.T) {
+	logger := logrus.StandardLogger()
+	metric := func(name string, tags ...string) samplers.InterMetric {
+		return samplers.InterMetric{Name: name, Timestamp: 1476119058, Value: 1, Tags: tags, Type: samplers.CounterMetric}
+	}
+
+	tests := []struct {
+		name       string
+		key, tag   string
+		metrics    []samplers.InterMetric
+		samePart   bool
+		expectKeys []sarama.Encoder
+	}{
+		{
+			"by tag",
+			"", "service",
+			[]samplers.InterMetric{metric("a", "service:api", "host:1"), metric("b", "host:2", "service:api")},
+			true,
+			[]sarama.Encoder{sarama.StringEncoder("api"), sarama.StringEncoder("api")},
+		},
+		{
+			"by name",
+			PartitionKeyName, "",
+			[]samplers.InterMetric{metric("a", "host:1"), metric("a", "host:2")},
+			true,
+			[]sarama.Encoder{sarama.StringEncoder("a"), sarama.StringEncoder("a")},
+		},
+		{
+			"tag absent",
+			"", "service",
+			[]samplers.InterMetric{metric("a"), metric("a")},
+			false,
+			[]sarama.Encoder{nil, nil},
+		},
+	}
+	for _, elt := range tests {
+		test := elt
+		t.Run(test.name, func(t *testing.T) {
+			config := sarama.NewConfig()
+			config.Producer.Return.Successes = true
+			producerMock := mocks.NewAsyncProducer(t, config)
+			for range test.metrics {
+				producerMock.ExpectInputAndSucceed()
+			}
+
+			sink, err := NewKafkaMetricSink(logger, nil, "testing", "", "", "testMetricTopic", "all", "random", 0, 0, 0, "", test.key, test.tag)
+			assert.NoError(t, err)
+			sink.producer = producerMock
+			assert.NoError(t, sink.Flush(context.Background(), test.metrics))
+
+			partitioner := sink.config.Producer.Partitioner("testMetricTopic")
+			var keys []sarama.Encoder
+			var partitions []int32
+			for range test.metrics {
+				msg := <-producerMock.Successes()
+				keys = append(keys, msg.Key)
+				p, err := partitioner.Partition(msg, 16)
+				assert.NoError(t, err)
+				partitions = append(partitions, p)
+			}
+			assert.Equal(t, test.expectKeys, keys)
+			if test.samePart {
+				assert.Equal(t, partitions[0], partitions[1], "metrics with the same key should go to the same partition")
+			} else {
+				assert.NotEqual(t, partitions[0], partitions[1], "metrics without a key should be spread round-robin")
+			}
+		})
+	}
+
+	_, err := NewKafkaMetricSink(logger, nil, "testing", "", "", "testMetricTopic", "all", "hash", 0, 0, 0, "", "hostname", "")
+	assert.Error(t, err)
+}
+
+func TestMetricSinkHealth(t *testing.T) {
+	config := sarama.NewConfig()
+	config.Producer.Return.Errors = true
+	producerMock := mocks.NewAsyncProducer(t, config)
+	producerMock.ExpectInputAndFail(sarama.ErrOutOfBrokers)
+
+	sink, err := NewKafkaMetricSink(logrus.StandardLogger(), nil, "testing", "testCheckTopic", "testEventTopic", "testMetricTopic", "all", "hash", 0, 0, 0, "", "", "")
+	assert.NoError(t, err)
+	sink.producer = producerMock
+	sink.health.Threshold = 1
+
+	metric := samplers.InterMetric{Name: "a.b.c", Timestamp: 1476119058, Value: 1, Type: samplers.CounterMetric}
+	assert.NoError(t, sink.Flush(context.Background(), []samplers.InterMetric{metric}))
+	assert.NoError(t, sink.Healthy(), "failures are only known by the next flush")
+
+	// Closing the producer delivers the expected failure and ends
+	// trackErrors:
+	assert.NoError(t, producerMock.Close())
+	sink.trackErrors(producerMock)
+	assert.NoError(t, sink.Flush(context.Background(), nil))
+	assert.Error(t, sink.Healthy())
+
+	assert.NoError(t, sink.Flush(context.Background(), nil))
+	assert.NoError(t, sink.Healthy(), "a flush without failures should make the sink healthy again")
+}
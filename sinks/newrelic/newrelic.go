@@ -0,0 +1,376 @@
+package newrelic
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stripe/veneur/samplers"
+	"github.com/stripe/veneur/sinks"
+	"github.com/stripe/veneur/ssf"
+	"github.com/stripe/veneur/trace"
+)
+
+// DefaultEndpoint is New Relic's Metric API in the US region. Accounts
+// in the EU region use https://metric-api.eu.newrelic.com/metric/v1.
+const DefaultEndpoint = "https://metric-api.newrelic.com/metric/v1"
+
+// maxPayloadBytes is the largest payload that the Metric API accepts.
+// The limit applies to the compressed payload; the sink keeps the
+// uncompressed payload below it, so it never has to compress a payload
+// twice.
+const maxPayloadBytes = 1000000
+
+// Metric is a single metric, as the Metric API accepts it.
+type Metric struct {
+	Name       string            `json:"name"`
+	Type       string            `json:"type"`
+	Value      interface{}       `json:"value"`
+	Timestamp  int64             `json:"timestamp"`
+	IntervalMS int64             `json:"interval.ms,omitempty"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+// Summary is the value of a summary metric.
+type Summary struct {
+	Count float64 `json:"count"`
+	Sum   float64 `json:"sum"`
+	Min   float64 `json:"min"`
+	Max   float64 `json:"max"`
+}
+
+// common holds the attributes shared by all metrics of a payload.
+type common struct {
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+// NewRelicMetricSink is a MetricSink that posts metrics to New Relic's
+// Metric API.
+type NewRelicMetricSink struct {
+	endpoint    string
+	apiKey      string
+	interval    time.Duration
+	common      []byte
+	maxPayload  int
+	httpClient  *http.Client
+	traceClient *trace.Client
+	log         *logrus.Logger
+}
+
+var _ sinks.MetricSink = &NewRelicMetricSink{}
+
+// NewNewRelicMetricSink creates a sink that posts metrics to the
+// Metric API at endpoint (DefaultEndpoint if it is empty),
+// authenticated with apiKey. Counts and summaries cover the flush
+// interval. The hostname and the tags become attributes of all
+// metrics.
+func NewNewRelicMetricSink(endpoint string, apiKey string, interval time.Duration, hostname string, tags []string, httpClient *http.Client, log *logrus.Logger) (*NewRelicMetricSink, error) {
+	if apiKey == "" {
+		return nil, errors.New("a New Relic API key is required")
+	}
+	if endpoint == "" {
+		endpoint = DefaultEndpoint
+	}
+	attrs := attributes(tags)
+	if hostname != "" {
+		if attrs == nil {
+			attrs = map[string]string{}
+		}
+		attrs["host.name"] = hostname
+	}
+	commonJSON, err := json.Marshal(common{Attributes: attrs})
+	if err != nil {
+		return nil, err
+	}
+	return &NewRelicMetricSink{
+		endpoint:   endpoint,
+		apiKey:     apiKey,
+		interval:   interval,
+		common:     commonJSON,
+		maxPayload: maxPayloadBytes,
+		httpClient: httpClient,
+		log:        log,
+	}, nil
+}
+
+// Name returns the name of this sink.
+func (s *NewRelicMetricSink) Name() string {
+	return "newrelic"
+}
+
+// Start sets the sink up.
+func (s *NewRelicMetricSink) Start(cl *trace.Client) error {
+	s.traceClient = cl
+	return nil
+}
+
+// Flush posts metrics to New Relic, in as many requests as it takes to
+// keep each payload below the Metric API's size limit.
+func (s *NewRelicMetricSink) Flush(ctx context.Context, interMetrics []samplers.InterMetric) error {
+	span, _ := trace.StartSpanFromContext(ctx, "")
+	defer span.ClientFinish(s.traceClient)
+
+	metrics := s.convertMetrics(interMetrics)
+	if len(metrics) == 0 {
+		return nil
+	}
+	payloads, err := s.payloads(metrics)
+	if err != nil {
+		span.Error(err)
+		span.Add(ssf.Count("flush.error_total", 1, map[string]string{"cause": "json", "sink": s.Name()}))
+		s.log.WithError(err).Error("Could not render New Relic payload")
+		return err
+	}
+
+	flushStart := time.Now()
+	for _, payload := range payloads {
+		if err := s.post(ctx, payload); err != nil {
+			span.Error(err)
+			span.Add(ssf.Count("flush.error_total", 1, map[string]string{"cause": "io", "sink": s.Name()}))
+			s.log.WithError(err).WithField("metrics", len(metrics)).Warn("Error flushing metrics to New Relic")
+			return err
+		}
+	}
+	tags := map[string]string{"sink": s.Name()}
+	span.Add(
+		ssf.Timing(sinks.MetricKeyMetricFlushDuration, time.Since(flushStart), time.Nanosecond, tags),
+		ssf.Count(sinks.MetricKeyTotalMetricsFlushed, float32(len(metrics)), tags),
+	)
+	s.log.WithFields(logrus.Fields{
+		"metrics":  len(metrics),
+		"payloads": len(payloads),
+	}).Info("Completed flush to New Relic")
+	return nil
+}
+
+// FlushOtherSamples is a no-op: the Metric API has no representation
+// for events and service checks.
+func (s *NewRelicMetricSink) FlushOtherSamples(ctx context.Context, samples []ssf.SSFSample) {
+}
+
+// payloads renders the metrics as JSON payloads of the form
+// [{"common": {...}, "metrics": [...]}], each of at most maxPayload
+// bytes.
+func (s *NewRelicMetricSink) payloads(metrics []Metric) ([][]byte, error) {
+	prefix := append(append([]byte(`[{"common":`), s.common...), `,"metrics":[`...)
+	const suffix = "]}]"
+
+	var payloads [][]byte
+	var buf bytes.Buffer
+	for _, m := range metrics {
+		b, err := json.Marshal(m)
+		if err != nil {
+			return nil, err
+		}
+		if buf.Len() > 0 && buf.Len()+1+len(b)+len(suffix) > s.maxPayload {
+			buf.WriteString(suffix)
+			payloads = append(payloads, buf.Bytes())
+			buf = bytes.Buffer{}
+		}
+		if buf.Len() == 0 {
+			buf.Write(prefix)
+		} else {
+			buf.WriteByte(',')
+		}
+		buf.Write(b)
+	}
+	buf.WriteString(suffix)
+	return append(payloads, buf.Bytes()), nil
+}
+
+func (s *NewRelicMetricSink) post(ctx context.Context, payload []byte) error {
+	var body bytes.Buffer
+	gz := gzip.NewWriter(&body)
+	if _, err := gz.Write(payload); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, s.endpoint, &body)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Content-Encoding", "gzip")
+	req.Header.Set("Api-Key", s.apiKey)
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 == 2 {
+		io.Copy(ioutil.Discard, resp.Body)
+		return nil
+	}
+	msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+	return fmt.Errorf("new relic responded with %s: %s", resp.Status, bytes.TrimSpace(msg))
+}
+
+type seriesKey struct {
+	name string
+	tags string
+}
+
+func keyOf(name string, tags []string) seriesKey {
+	sorted := make([]string, len(tags))
+	copy(sorted, tags)
+	sort.Strings(sorted)
+	return seriesKey{name, strings.Join(sorted, ",")}
+}
+
+// histogram collects the aggregates that Veneur flushed for a single
+// histogram or timer, by their index in the flushed metrics.
+type histogram struct {
+	count, sum, avg, min, max int
+}
+
+// convertMetrics converts metrics into Metric API metrics. Counters
+// become counts over the flush interval, and gauges and statuses
+// become gauges.
+//
+// Veneur flushes each aggregate of a histogram as a separate metric.
+// convertMetrics collects the count, min, max and sum of each
+// histogram back into a summary; if the sum wasn't flushed, it is
+// computed from the average. Histograms without all of these are left
+// as separate metrics, as are their other aggregates and percentiles.
+func (s *NewRelicMetricSink) convertMetrics(interMetrics []samplers.InterMetric) []Metric {
+	accepted := make([]samplers.InterMetric, 0, len(interMetrics))
+	for _, m := range interMetrics {
+		if !sinks.IsAcceptableMetric(m, s) {
+			continue
+		}
+		// JSON can't represent NaN or infinite values.
+		if math.IsNaN(m.Value) || math.IsInf(m.Value, 0) {
+			continue
+		}
+		accepted = append(accepted, m)
+	}
+
+	histograms := map[seriesKey]*histogram{}
+	var histogramKeys []seriesKey
+	for i, m := range accepted {
+		dot := strings.LastIndexByte(m.Name, '.')
+		if dot < 0 {
+			continue
+		}
+		aggregate := m.Name[dot+1:]
+		var field *int
+		key := keyOf(m.Name[:dot], m.Tags)
+		h, ok := histograms[key]
+		if !ok {
+			h = &histogram{-1, -1, -1, -1, -1}
+		}
+		switch {
+		case aggregate == "count" && m.Type == samplers.CounterMetric:
+			field = &h.count
+		case aggregate == "sum" && m.Type == samplers.GaugeMetric:
+			field = &h.sum
+		case aggregate == "avg" && m.Type == samplers.GaugeMetric:
+			field = &h.avg
+		case aggregate == "min" && m.Type == samplers.GaugeMetric:
+			field = &h.min
+		case aggregate == "max" && m.Type == samplers.GaugeMetric:
+			field = &h.max
+		default:
+			continue
+		}
+		*field = i
+		if !ok {
+			histograms[key] = h
+			histogramKeys = append(histogramKeys, key)
+		}
+	}
+
+	metrics := make([]Metric, 0, len(accepted))
+	consumed := make([]bool, len(accepted))
+	for _, key := range histogramKeys {
+		h := histograms[key]
+		if h.count < 0 || h.min < 0 || h.max < 0 || (h.sum < 0 && h.avg < 0) {
+			continue
+		}
+		count := accepted[h.count]
+		summary := Summary{
+			Count: count.Value,
+			Min:   accepted[h.min].Value,
+			Max:   accepted[h.max].Value,
+		}
+		if h.sum >= 0 {
+			summary.Sum = accepted[h.sum].Value
+			consumed[h.sum] = true
+		} else {
+			summary.Sum = accepted[h.avg].Value * count.Value
+		}
+		consumed[h.count], consumed[h.min], consumed[h.max] = true, true, true
+		metrics = append(metrics, Metric{
+			Name:       key.name,
+			Type:       "summary",
+			Value:      summary,
+			Timestamp:  s.startMillis(count),
+			IntervalMS: s.intervalMillis(),
+			Attributes: attributes(count.Tags),
+		})
+	}
+
+	for i, m := range accepted {
+		if consumed[i] {
+			continue
+		}
+		metric := Metric{
+			Name:       m.Name,
+			Type:       "gauge",
+			Value:      m.Value,
+			Timestamp:  m.Timestamp * 1000,
+			Attributes: attributes(m.Tags),
+		}
+		if m.Type == samplers.CounterMetric {
+			metric.Type = "count"
+			metric.Timestamp = s.startMillis(m)
+			metric.IntervalMS = s.intervalMillis()
+		}
+		metrics = append(metrics, metric)
+	}
+	return metrics
+}
+
+// startMillis returns the start of the flush interval that m covers,
+// in milliseconds since the unix epoch.
+func (s *NewRelicMetricSink) startMillis(m samplers.InterMetric) int64 {
+	return time.Unix(m.Timestamp, 0).Add(-s.interval).UnixNano() / int64(time.Millisecond)
+}
+
+func (s *NewRelicMetricSink) intervalMillis() int64 {
+	return int64(s.interval / time.Millisecond)
+}
+
+// attributes converts tags of the form "key:value" to attributes. Tags
+// without a value become attributes with an empty value.
+func attributes(tags []string) map[string]string {
+	if len(tags) == 0 {
+		return nil
+	}
+	attrs := make(map[string]string, len(tags))
+	for _, tag := range tags {
+		kv := strings.SplitN(tag, ":", 2)
+		value := ""
+		if len(kv) == 2 {
+			value = kv[1]
+		}
+		attrs[kv[0]] = value
+	}
+	return attrs
+}
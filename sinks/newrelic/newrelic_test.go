@@ -0,0 +1,160 @@
+package newrelic
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stripe/veneur/samplers"
+)
+
+type payload struct {
+	Common struct {
+		Attributes map[string]string `json:"attributes"`
+	} `json:"common"`
+	Metrics []map[string]interface{} `json:"metrics"`
+}
+
+// newTestServer returns a server that decodes the payloads posted to
+// it, and sends them on the returned channel.
+func newTestServer(t *testing.T) (*httptest.Server, chan []payload) {
+	payloads := make(chan []payload, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "secret", r.Header.Get("Api-Key"))
+		assert.Equal(t, "gzip", r.Header.Get("Content-Encoding"))
+		gz, err := gzip.NewReader(r.Body)
+		require.NoError(t, err)
+		var p []payload
+		require.NoError(t, json.NewDecoder(gz).Decode(&p))
+		payloads <- p
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	return server, payloads
+}
+
+func TestNewRelicMetricSinkFlush(t *testing.T) {
+	server, payloads := newTestServer(t)
+	defer server.Close()
+
+	sink, err := NewNewRelicMetricSink(server.URL, "secret", 10*time.Second, "myhost", []string{"env:test"}, server.Client(), logrus.New())
+	require.NoError(t, err)
+	require.NoError(t, sink.Start(nil))
+
+	const ts = 1476119058
+	tags := []string{"region:us", "canary"}
+	require.NoError(t, sink.Flush(context.Background(), []samplers.InterMetric{
+		{Name: "requests", Timestamp: ts, Value: 5, Tags: tags, Type: samplers.CounterMetric},
+		{Name: "queue.depth", Timestamp: ts, Value: 3.5, Tags: tags, Type: samplers.GaugeMetric},
+		{Name: "latency.count", Timestamp: ts, Value: 4, Tags: tags, Type: samplers.CounterMetric},
+		{Name: "latency.min", Timestamp: ts, Value: 1, Tags: tags, Type: samplers.GaugeMetric},
+		{Name: "latency.max", Timestamp: ts, Value: 10, Tags: tags, Type: samplers.GaugeMetric},
+		{Name: "latency.avg", Timestamp: ts, Value: 2.5, Tags: tags, Type: samplers.GaugeMetric},
+		{Name: "latency.99percentile", Timestamp: ts, Value: 9, Tags: tags, Type: samplers.GaugeMetric},
+	}))
+
+	var p []payload
+	select {
+	case p = <-payloads:
+	default:
+		t.Fatal("no payload was posted")
+	}
+	require.Len(t, p, 1)
+	assert.Equal(t, map[string]string{"env": "test", "host.name": "myhost"}, p[0].Common.Attributes)
+
+	attrs := map[string]interface{}{"region": "us", "canary": ""}
+	assert.Equal(t, []map[string]interface{}{
+		{
+			"name":        "latency",
+			"type":        "summary",
+			"value":       map[string]interface{}{"count": 4.0, "sum": 10.0, "min": 1.0, "max": 10.0},
+			"timestamp":   float64((ts - 10) * 1000),
+			"interval.ms": 10000.0,
+			"attributes":  attrs,
+		},
+		{
+			"name":        "requests",
+			"type":        "count",
+			"value":       5.0,
+			"timestamp":   float64((ts - 10) * 1000),
+			"interval.ms": 10000.0,
+			"attributes":  attrs,
+		},
+		{
+			"name":       "queue.depth",
+			"type":       "gauge",
+			"value":      3.5,
+			"timestamp":  float64(ts * 1000),
+			"attributes": attrs,
+		},
+		{
+			"name":       "latency.avg",
+			"type":       "gauge",
+			"value":      2.5,
+			"timestamp":  float64(ts * 1000),
+			"attributes": attrs,
+		},
+		{
+			"name":       "latency.99percentile",
+			"type":       "gauge",
+			"value":      9.0,
+			"timestamp":  float64(ts * 1000),
+			"attributes": attrs,
+		},
+	}, p[0].Metrics)
+}
+
+func TestNewRelicMetricSinkChunks(t *testing.T) {
+	server, payloads := newTestServer(t)
+	defer server.Close()
+
+	sink, err := NewNewRelicMetricSink(server.URL, "secret", 10*time.Second, "", nil, server.Client(), logrus.New())
+	require.NoError(t, err)
+	sink.maxPayload = 200
+
+	metrics := make([]samplers.InterMetric, 10)
+	for i := range metrics {
+		metrics[i] = samplers.InterMetric{Name: "a.gauge", Timestamp: 1476119058, Value: float64(i), Type: samplers.GaugeMetric}
+	}
+	require.NoError(t, sink.Flush(context.Background(), metrics))
+	close(payloads)
+
+	var values []float64
+	requests := 0
+	for p := range payloads {
+		requests++
+		require.Len(t, p, 1)
+		for _, m := range p[0].Metrics {
+			values = append(values, m["value"].(float64))
+		}
+	}
+	assert.True(t, requests > 1, "the metrics should be split across requests")
+	assert.Equal(t, []float64{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}, values)
+}
+
+func TestNewRelicMetricSinkPayloadSize(t *testing.T) {
+	sink, err := NewNewRelicMetricSink("", "secret", 10*time.Second, "myhost", nil, http.DefaultClient, logrus.New())
+	require.NoError(t, err)
+	sink.maxPayload = 300
+
+	metrics := make([]Metric, 20)
+	for i := range metrics {
+		metrics[i] = Metric{Name: "a.gauge", Type: "gauge", Value: float64(i), Timestamp: 1476119058000}
+	}
+	payloads, err := sink.payloads(metrics)
+	require.NoError(t, err)
+	count := 0
+	for _, p := range payloads {
+		assert.True(t, len(p) <= sink.maxPayload, "payload of %d bytes is too large", len(p))
+		var decoded []payload
+		require.NoError(t, json.Unmarshal(p, &decoded))
+		count += len(decoded[0].Metrics)
+	}
+	assert.Equal(t, len(metrics), count)
+}
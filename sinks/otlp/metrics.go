@@ -0,0 +1,376 @@
+package otlp
+
+import (
+	"context"
+	"encoding/hex"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stripe/veneur/samplers"
+	"github.com/stripe/veneur/sinks"
+	"github.com/stripe/veneur/sinks/otlp/otlpcommon"
+	"github.com/stripe/veneur/sinks/otlp/otlpmetrics"
+	"github.com/stripe/veneur/ssf"
+	"github.com/stripe/veneur/trace"
+	"google.golang.org/grpc"
+)
+
+// OTLPMetricSink is a MetricSink that exports metrics to an
+// OpenTelemetry collector over OTLP/gRPC.
+type OTLPMetricSink struct {
+	target      string
+	interval    time.Duration
+	resource    *otlpcommon.Resource
+	conn        *grpc.ClientConn
+	client      otlpmetrics.MetricsServiceClient
+	traceClient *trace.Client
+	log         *logrus.Logger
+}
+
+var _ sinks.MetricSink = &OTLPMetricSink{}
+
+// NewOTLPMetricSink creates a sink that exports metrics to the OTLP
+// collector at target ("host:port"), using opts to dial it. Data
+// points cover the flush interval, and the exported resource is
+// described by the hostname and the tags.
+func NewOTLPMetricSink(ctx context.Context, target string, interval time.Duration, hostname string, tags []string, log *logrus.Logger, opts ...grpc.DialOption) (*OTLPMetricSink, error) {
+	conn, err := grpc.DialContext(ctx, target, opts...)
+	if err != nil {
+		log.WithError(err).WithField("target", target).Error("Error establishing connection to OTLP collector")
+		return nil, err
+	}
+	return &OTLPMetricSink{
+		target:   target,
+		interval: interval,
+		resource: newResource(hostname, tags),
+		conn:     conn,
+		client:   otlpmetrics.NewMetricsServiceClient(conn),
+		log:      log,
+	}, nil
+}
+
+// Name returns the name of this sink.
+func (s *OTLPMetricSink) Name() string {
+	return "otlp"
+}
+
+// Start sets the sink up.
+func (s *OTLPMetricSink) Start(cl *trace.Client) error {
+	s.traceClient = cl
+	return nil
+}
+
+// Flush exports metrics to the collector in a single request.
+func (s *OTLPMetricSink) Flush(ctx context.Context, interMetrics []samplers.InterMetric) error {
+	span, _ := trace.StartSpanFromContext(ctx, "")
+	defer span.ClientFinish(s.traceClient)
+
+	metrics, points := s.convertMetrics(interMetrics)
+	if len(metrics) == 0 {
+		return nil
+	}
+
+	flushStart := time.Now()
+	resp, err := s.client.Export(ctx, &otlpmetrics.ExportMetricsServiceRequest{
+		ResourceMetrics: []*otlpmetrics.ResourceMetrics{{
+			Resource: s.resource,
+			ScopeMetrics: []*otlpmetrics.ScopeMetrics{{
+				Scope:   instrumentationScope,
+				Metrics: metrics,
+			}},
+		}},
+	})
+	if err != nil {
+		span.Error(err)
+		span.Add(ssf.Count("flush.error_total", 1, map[string]string{"cause": "io", "sink": s.Name()}))
+		s.log.WithError(err).WithField("target", s.target).Warn("Error exporting metrics to OTLP collector")
+		return err
+	}
+	if ps := resp.GetPartialSuccess(); ps != nil && ps.RejectedDataPoints > 0 {
+		s.log.WithFields(logrus.Fields{
+			"rejected":      ps.RejectedDataPoints,
+			logrus.ErrorKey: ps.ErrorMessage,
+		}).Warn("OTLP collector rejected some data points")
+		points -= int(ps.RejectedDataPoints)
+	}
+
+	tags := map[string]string{"sink": s.Name()}
+	span.Add(
+		ssf.Timing(sinks.MetricKeyMetricFlushDuration, time.Since(flushStart), time.Nanosecond, tags),
+		ssf.Count(sinks.MetricKeyTotalMetricsFlushed, float32(points), tags),
+	)
+	s.log.WithField("metrics", points).Info("Completed flush to OTLP collector")
+	return nil
+}
+
+// FlushOtherSamples is a no-op: OTLP has no representation for events
+// and service checks.
+func (s *OTLPMetricSink) FlushOtherSamples(ctx context.Context, samples []ssf.SSFSample) {
+}
+
+type seriesKey struct {
+	name string
+	tags string
+}
+
+func keyOf(name string, tags []string) seriesKey {
+	sorted := make([]string, len(tags))
+	copy(sorted, tags)
+	sort.Strings(sorted)
+	return seriesKey{name, strings.Join(sorted, ",")}
+}
+
+// convertMetrics converts metrics into OTLP metrics, returning them
+// along with the number of data points they contain.
+//
+// Veneur flushes each aggregate and percentile of a histogram as a
+// separate metric. convertMetrics collects the percentiles of each
+// histogram back into a Summary data point, along with its count, sum,
+// min (quantile 0), median (quantile 0.5) and max (quantile 1). The
+// remaining counters become delta Sums covering the flush interval,
+// and gauges and statuses become Gauges. Summary data points can't
+// carry exemplars, so aggregates that have exemplars (a histogram's
+// max) remain separate metrics.
+func (s *OTLPMetricSink) convertMetrics(interMetrics []samplers.InterMetric) ([]*otlpmetrics.Metric, int) {
+	accepted := make([]samplers.InterMetric, 0, len(interMetrics))
+	for _, m := range interMetrics {
+		if sinks.IsAcceptableMetric(m, s) {
+			accepted = append(accepted, m)
+		}
+	}
+
+	summaries := map[seriesKey]*otlpmetrics.SummaryDataPoint{}
+	var summaryKeys []seriesKey
+	consumed := make([]bool, len(accepted))
+	for i, m := range accepted {
+		if m.Type != samplers.GaugeMetric {
+			continue
+		}
+		dot := strings.LastIndexByte(m.Name, '.')
+		if dot < 1 {
+			continue
+		}
+		p, ok := samplers.ParsePercentileSuffix(m.Name[dot+1:])
+		if !ok {
+			continue
+		}
+		key := keyOf(m.Name[:dot], m.Tags)
+		pt, ok := summaries[key]
+		if !ok {
+			start, end := s.timeRange(m)
+			pt = &otlpmetrics.SummaryDataPoint{
+				Attributes:        attributes(m.Tags),
+				StartTimeUnixNano: start,
+				TimeUnixNano:      end,
+			}
+			summaries[key] = pt
+			summaryKeys = append(summaryKeys, key)
+		}
+		pt.QuantileValues = append(pt.QuantileValues, &otlpmetrics.SummaryDataPoint_ValueAtQuantile{
+			Quantile: p,
+			Value:    m.Value,
+		})
+		consumed[i] = true
+	}
+	for i, m := range accepted {
+		if consumed[i] {
+			continue
+		}
+		dot := strings.LastIndexByte(m.Name, '.')
+		if dot < 0 {
+			continue
+		}
+		if pt, ok := summaries[keyOf(m.Name[:dot], m.Tags)]; ok && len(m.Exemplars) == 0 {
+			consumed[i] = foldAggregate(pt, m.Name[dot+1:], m)
+		}
+	}
+
+	var metrics []*otlpmetrics.Metric
+	gauges := map[string]*otlpmetrics.Gauge{}
+	sums := map[string]*otlpmetrics.Sum{}
+	points := 0
+	for i, m := range accepted {
+		if consumed[i] {
+			continue
+		}
+		start, end := s.timeRange(m)
+		pt := &otlpmetrics.NumberDataPoint{
+			Attributes:        attributes(m.Tags),
+			StartTimeUnixNano: start,
+			TimeUnixNano:      end,
+			Value:             &otlpmetrics.NumberDataPoint_AsDouble{AsDouble: m.Value},
+			Exemplars:         exemplars(m.Exemplars),
+		}
+		points++
+		if m.Type == samplers.CounterMetric {
+			sum, ok := sums[m.Name]
+			if !ok {
+				sum = &otlpmetrics.Sum{
+					AggregationTemporality: otlpmetrics.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA,
+					IsMonotonic:            true,
+				}
+				sums[m.Name] = sum
+				metrics = append(metrics, &otlpmetrics.Metric{Name: m.Name, Data: &otlpmetrics.Metric_Sum{Sum: sum}})
+			}
+			sum.DataPoints = append(sum.DataPoints, pt)
+			continue
+		}
+		// The start time of a gauge's data point is meaningless.
+		pt.StartTimeUnixNano = 0
+		gauge, ok := gauges[m.Name]
+		if !ok {
+			gauge = &otlpmetrics.Gauge{}
+			gauges[m.Name] = gauge
+			metrics = append(metrics, &otlpmetrics.Metric{Name: m.Name, Data: &otlpmetrics.Metric_Gauge{Gauge: gauge}})
+		}
+		gauge.DataPoints = append(gauge.DataPoints, pt)
+	}
+
+	byName := map[string]*otlpmetrics.Summary{}
+	for _, key := range summaryKeys {
+		pt := summaries[key]
+		sort.Slice(pt.QuantileValues, func(i, j int) bool {
+			return pt.QuantileValues[i].Quantile < pt.QuantileValues[j].Quantile
+		})
+		summary, ok := byName[key.name]
+		if !ok {
+			summary = &otlpmetrics.Summary{}
+			byName[key.name] = summary
+			metrics = append(metrics, &otlpmetrics.Metric{Name: key.name, Data: &otlpmetrics.Metric_Summary{Summary: summary}})
+		}
+		summary.DataPoints = append(summary.DataPoints, pt)
+		points++
+	}
+	return metrics, points
+}
+
+// foldAggregate records the histogram aggregate m in the summary data
+// point, if the summary can represent the aggregate. It returns
+// whether it did.
+func foldAggregate(pt *otlpmetrics.SummaryDataPoint, aggregate string, m samplers.InterMetric) bool {
+	var quantile float64
+	switch {
+	case aggregate == "count" && m.Type == samplers.CounterMetric:
+		pt.Count = uint64(math.Round(m.Value))
+		return true
+	case aggregate == "sum" && m.Type == samplers.GaugeMetric:
+		pt.Sum = m.Value
+		return true
+	case aggregate == "min" && m.Type == samplers.GaugeMetric:
+		quantile = 0
+	case aggregate == "median" && m.Type == samplers.GaugeMetric:
+		quantile = 0.5
+	case aggregate == "max" && m.Type == samplers.GaugeMetric:
+		quantile = 1
+	default:
+		return false
+	}
+	for _, qv := range pt.QuantileValues {
+		if qv.Quantile == quantile {
+			return false
+		}
+	}
+	pt.QuantileValues = append(pt.QuantileValues, &otlpmetrics.SummaryDataPoint_ValueAtQuantile{
+		Quantile: quantile,
+		Value:    m.Value,
+	})
+	return true
+}
+
+// exemplars converts the exemplars of a metric into OTLP exemplars.
+// Trace IDs that aren't SSF or OTLP trace IDs become a trace_id
+// attribute of the exemplar instead.
+func exemplars(es []samplers.Exemplar) []*otlpmetrics.Exemplar {
+	if len(es) == 0 {
+		return nil
+	}
+	ret := make([]*otlpmetrics.Exemplar, 0, len(es))
+	for _, e := range es {
+		ex := &otlpmetrics.Exemplar{
+			TimeUnixNano: uint64(e.Timestamp),
+			Value:        &otlpmetrics.Exemplar_AsDouble{AsDouble: e.Value},
+		}
+		if id, ok := exemplarTraceID(e.TraceID); ok {
+			ex.TraceId = id
+		} else {
+			ex.FilteredAttributes = []*otlpcommon.KeyValue{stringAttribute(samplers.ExemplarTraceIDTag, e.TraceID)}
+		}
+		ret = append(ret, ex)
+	}
+	return ret
+}
+
+// exemplarTraceID encodes the trace ID of an exemplar as a 16-byte
+// OTLP trace ID. The ID can be an SSF trace ID, in decimal, or a 64 or
+// 128-bit trace ID in hex.
+func exemplarTraceID(id string) ([]byte, bool) {
+	// No SSF ID is 32 digits long, so those are always hex:
+	if len(id) != 32 {
+		if ssfID, err := strconv.ParseInt(id, 10, 64); err == nil {
+			return traceID(0, ssfID), true
+		}
+	}
+	if len(id) != 16 && len(id) != 32 {
+		return nil, false
+	}
+	b, err := hex.DecodeString(id)
+	if err != nil {
+		return nil, false
+	}
+	return append(make([]byte, 16-len(b)), b...), true
+}
+
+// timeRange returns the start and end of the flush interval that m
+// covers, in nanoseconds since the unix epoch.
+func (s *OTLPMetricSink) timeRange(m samplers.InterMetric) (uint64, uint64) {
+	end := time.Unix(m.Timestamp, 0)
+	return uint64(end.Add(-s.interval).UnixNano()), uint64(end.UnixNano())
+}
+
+// instrumentationScope identifies veneur as the producer of the
+// exported telemetry.
+var instrumentationScope = &otlpcommon.InstrumentationScope{Name: "github.com/stripe/veneur"}
+
+// newResource returns a resource describing the veneur server, with
+// the hostname as its "host.name" attribute and the tags as
+// additional attributes.
+func newResource(hostname string, tags []string) *otlpcommon.Resource {
+	attrs := []*otlpcommon.KeyValue{stringAttribute("service.name", "veneur")}
+	if hostname != "" {
+		attrs = append(attrs, stringAttribute("host.name", hostname))
+	}
+	return &otlpcommon.Resource{Attributes: append(attrs, attributes(tags)...)}
+}
+
+// attributes converts tags of the form "key:value" to attributes,
+// sorted by key. Tags without a value become attributes with an empty
+// string value.
+func attributes(tags []string) []*otlpcommon.KeyValue {
+	if len(tags) == 0 {
+		return nil
+	}
+	attrs := make([]*otlpcommon.KeyValue, 0, len(tags))
+	for _, tag := range tags {
+		kv := strings.SplitN(tag, ":", 2)
+		value := ""
+		if len(kv) == 2 {
+			value = kv[1]
+		}
+		attrs = append(attrs, stringAttribute(kv[0], value))
+	}
+	sort.SliceStable(attrs, func(i, j int) bool {
+		return attrs[i].Key < attrs[j].Key
+	})
+	return attrs
+}
+
+func stringAttribute(key, value string) *otlpcommon.KeyValue {
+	return &otlpcommon.KeyValue{
+		Key:   key,
+		Value: &otlpcommon.AnyValue{Value: &otlpcommon.AnyValue_StringValue{StringValue: value}},
+	}
+}
@@ -0,0 +1,192 @@
+package otlp
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	ocontext "golang.org/x/net/context"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stripe/veneur/samplers"
+	"github.com/stripe/veneur/sinks/otlp/otlpcommon"
+	"github.com/stripe/veneur/sinks/otlp/otlpmetrics"
+	"google.golang.org/grpc"
+)
+
+type mockMetricsServer struct {
+	mut      sync.Mutex
+	requests []*otlpmetrics.ExportMetricsServiceRequest
+}
+
+func (m *mockMetricsServer) Export(ctx ocontext.Context, req *otlpmetrics.ExportMetricsServiceRequest) (*otlpmetrics.ExportMetricsServiceResponse, error) {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	m.requests = append(m.requests, req)
+	return &otlpmetrics.ExportMetricsServiceResponse{}, nil
+}
+
+// startServer starts a gRPC server on a local port, and returns its
+// address along with the server, which the caller must stop.
+func startServer(t *testing.T, register func(*grpc.Server)) (string, *grpc.Server) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	srv := grpc.NewServer()
+	register(srv)
+	go srv.Serve(lis)
+	return lis.Addr().String(), srv
+}
+
+func stringValue(kv *otlpcommon.KeyValue) string {
+	return kv.Value.GetStringValue()
+}
+
+func TestOTLPMetricSinkExport(t *testing.T) {
+	mock := &mockMetricsServer{}
+	addr, srv := startServer(t, func(srv *grpc.Server) {
+		otlpmetrics.RegisterMetricsServiceServer(srv, mock)
+	})
+	defer srv.Stop()
+
+	sink, err := NewOTLPMetricSink(context.Background(), addr, 10*time.Second, "myhost", []string{"env:test"}, logrus.New(), grpc.WithInsecure())
+	require.NoError(t, err)
+	require.NoError(t, sink.Start(nil))
+
+	const ts = 1476119058
+	tags := []string{"region:us", "svc:api"}
+	metrics := []samplers.InterMetric{
+		{Name: "requests", Timestamp: ts, Value: 12, Tags: tags, Type: samplers.CounterMetric},
+		{Name: "queue.depth", Timestamp: ts, Value: 3.5, Tags: tags, Type: samplers.GaugeMetric},
+		{Name: "latency.max", Timestamp: ts, Value: 90, Tags: tags, Type: samplers.GaugeMetric},
+		{Name: "latency.min", Timestamp: ts, Value: 1, Tags: tags, Type: samplers.GaugeMetric},
+		{Name: "latency.count", Timestamp: ts, Value: 40, Tags: tags, Type: samplers.CounterMetric},
+		{Name: "latency.avg", Timestamp: ts, Value: 20, Tags: tags, Type: samplers.GaugeMetric},
+		{Name: "latency.99percentile", Timestamp: ts, Value: 85, Tags: tags, Type: samplers.GaugeMetric},
+		{Name: "latency.50percentile", Timestamp: ts, Value: 18, Tags: tags, Type: samplers.GaugeMetric},
+		// No percentiles for this series, so it stays a counter:
+		{Name: "other.count", Timestamp: ts, Value: 2, Type: samplers.CounterMetric},
+		{
+			Name:  "elsewhere",
+			Type:  samplers.GaugeMetric,
+			Sinks: samplers.RouteInformation{"datadog": struct{}{}},
+		},
+	}
+	require.NoError(t, sink.Flush(context.Background(), metrics))
+
+	mock.mut.Lock()
+	defer mock.mut.Unlock()
+	require.Len(t, mock.requests, 1)
+	require.Len(t, mock.requests[0].ResourceMetrics, 1)
+	rm := mock.requests[0].ResourceMetrics[0]
+
+	resource := map[string]string{}
+	for _, kv := range rm.Resource.Attributes {
+		resource[kv.Key] = stringValue(kv)
+	}
+	assert.Equal(t, map[string]string{"service.name": "veneur", "host.name": "myhost", "env": "test"}, resource)
+
+	require.Len(t, rm.ScopeMetrics, 1)
+	byName := map[string]*otlpmetrics.Metric{}
+	for _, m := range rm.ScopeMetrics[0].Metrics {
+		byName[m.Name] = m
+	}
+	assert.Len(t, byName, 5)
+
+	end := uint64(time.Unix(ts, 0).UnixNano())
+	start := uint64(time.Unix(ts-10, 0).UnixNano())
+
+	if sum := byName["requests"].GetSum(); assert.NotNil(t, sum, "counters should be sums") {
+		assert.Equal(t, otlpmetrics.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA, sum.AggregationTemporality)
+		assert.True(t, sum.IsMonotonic)
+		require.Len(t, sum.DataPoints, 1)
+		pt := sum.DataPoints[0]
+		assert.Equal(t, 12.0, pt.GetAsDouble())
+		assert.Equal(t, start, pt.StartTimeUnixNano)
+		assert.Equal(t, end, pt.TimeUnixNano)
+		require.Len(t, pt.Attributes, 2)
+		assert.Equal(t, "region", pt.Attributes[0].Key)
+		assert.Equal(t, "us", stringValue(pt.Attributes[0]))
+		assert.Equal(t, "svc", pt.Attributes[1].Key)
+		assert.Equal(t, "api", stringValue(pt.Attributes[1]))
+	}
+	if gauge := byName["queue.depth"].GetGauge(); assert.NotNil(t, gauge, "gauges should be gauges") {
+		require.Len(t, gauge.DataPoints, 1)
+		assert.Equal(t, 3.5, gauge.DataPoints[0].GetAsDouble())
+		assert.Equal(t, end, gauge.DataPoints[0].TimeUnixNano)
+	}
+	if summary := byName["latency"].GetSummary(); assert.NotNil(t, summary, "histograms should be summaries") {
+		require.Len(t, summary.DataPoints, 1)
+		pt := summary.DataPoints[0]
+		assert.Equal(t, uint64(40), pt.Count)
+		assert.Equal(t, start, pt.StartTimeUnixNano)
+		assert.Equal(t, end, pt.TimeUnixNano)
+		assert.Equal(t, []*otlpmetrics.SummaryDataPoint_ValueAtQuantile{
+			{Quantile: 0, Value: 1},
+			{Quantile: 0.5, Value: 18},
+			{Quantile: 0.99, Value: 85},
+			{Quantile: 1, Value: 90},
+		}, pt.QuantileValues)
+	}
+	assert.NotNil(t, byName["latency.avg"].GetGauge(), "aggregates summaries can't represent should stay gauges")
+	assert.NotNil(t, byName["other.count"].GetSum())
+}
+
+func TestOTLPMetricSinkExportError(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := lis.Addr().String()
+	lis.Close()
+
+	sink, err := NewOTLPMetricSink(context.Background(), addr, 10*time.Second, "", nil, logrus.New(), grpc.WithInsecure())
+	require.NoError(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.Error(t, sink.Flush(ctx, []samplers.InterMetric{{Name: "a", Value: 1}}))
+}
+
+func TestOTLPMetricSinkExemplars(t *testing.T) {
+	sink := &OTLPMetricSink{interval: 10 * time.Second}
+	const ts = 1476119058
+	metrics, _ := sink.convertMetrics([]samplers.InterMetric{
+		{Name: "latency.99percentile", Timestamp: ts, Value: 85, Type: samplers.GaugeMetric},
+		{Name: "latency.count", Timestamp: ts, Value: 40, Type: samplers.CounterMetric},
+		{
+			Name:      "latency.max",
+			Timestamp: ts,
+			Value:     90,
+			Type:      samplers.GaugeMetric,
+			Exemplars: []samplers.Exemplar{
+				{Value: 90, TraceID: "1234", Timestamp: 5},
+				{Value: 80, TraceID: "00000000000000010000000000000002"},
+				{Value: 70, TraceID: "not-an-id"},
+			},
+		},
+	})
+
+	byName := map[string]*otlpmetrics.Metric{}
+	for _, m := range metrics {
+		byName[m.Name] = m
+	}
+	if summary := byName["latency"].GetSummary(); assert.NotNil(t, summary) {
+		assert.Equal(t, uint64(40), summary.DataPoints[0].Count)
+		assert.Len(t, summary.DataPoints[0].QuantileValues, 1, "the max has exemplars, which summaries can't carry")
+	}
+	gauge := byName["latency.max"].GetGauge()
+	require.NotNil(t, gauge, "the max should stay a gauge")
+	exemplars := gauge.DataPoints[0].Exemplars
+	require.Len(t, exemplars, 3)
+
+	assert.Equal(t, 90.0, exemplars[0].GetAsDouble())
+	assert.Equal(t, uint64(5), exemplars[0].TimeUnixNano)
+	assert.Equal(t, traceID(0, 1234), exemplars[0].TraceId)
+	assert.Equal(t, traceID(1, 2), exemplars[1].TraceId)
+	assert.Nil(t, exemplars[2].TraceId)
+	if assert.Len(t, exemplars[2].FilteredAttributes, 1) {
+		assert.Equal(t, "trace_id", exemplars[2].FilteredAttributes[0].Key)
+		assert.Equal(t, "not-an-id", stringValue(exemplars[2].FilteredAttributes[0]))
+	}
+}
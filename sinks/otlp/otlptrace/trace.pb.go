@@ -0,0 +1,2016 @@
+// Code generated by protoc-gen-gogo. DO NOT EDIT.
+// source: sinks/otlp/otlptrace/trace.proto
+
+/*
+	Package otlptrace is a generated protocol buffer package.
+
+	It is generated from these files:
+		sinks/otlp/otlptrace/trace.proto
+
+	It has these top-level messages:
+		ExportTraceServiceRequest
+		ExportTraceServiceResponse
+		ExportTracePartialSuccess
+		ResourceSpans
+		ScopeSpans
+		Span
+		Status
+*/
+package otlptrace
+
+import proto "github.com/gogo/protobuf/proto"
+import fmt "fmt"
+import math "math"
+import opentelemetry_proto_common_v1 "github.com/stripe/veneur/sinks/otlp/otlpcommon"
+
+import (
+	context "golang.org/x/net/context"
+	grpc "google.golang.org/grpc"
+)
+
+import encoding_binary "encoding/binary"
+
+import io "io"
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the proto package it is being compiled against.
+// A compilation error at this line likely means your copy of the
+// proto package needs to be updated.
+const _ = proto.GoGoProtoPackageIsVersion2 // please upgrade the proto package
+
+type Span_SpanKind int32
+
+const (
+	Span_SPAN_KIND_UNSPECIFIED Span_SpanKind = 0
+	Span_SPAN_KIND_INTERNAL    Span_SpanKind = 1
+	Span_SPAN_KIND_SERVER      Span_SpanKind = 2
+	Span_SPAN_KIND_CLIENT      Span_SpanKind = 3
+	Span_SPAN_KIND_PRODUCER    Span_SpanKind = 4
+	Span_SPAN_KIND_CONSUMER    Span_SpanKind = 5
+)
+
+var Span_SpanKind_name = map[int32]string{
+	0: "SPAN_KIND_UNSPECIFIED",
+	1: "SPAN_KIND_INTERNAL",
+	2: "SPAN_KIND_SERVER",
+	3: "SPAN_KIND_CLIENT",
+	4: "SPAN_KIND_PRODUCER",
+	5: "SPAN_KIND_CONSUMER",
+}
+var Span_SpanKind_value = map[string]int32{
+	"SPAN_KIND_UNSPECIFIED": 0,
+	"SPAN_KIND_INTERNAL":    1,
+	"SPAN_KIND_SERVER":      2,
+	"SPAN_KIND_CLIENT":      3,
+	"SPAN_KIND_PRODUCER":    4,
+	"SPAN_KIND_CONSUMER":    5,
+}
+
+func (x Span_SpanKind) String() string {
+	return proto.EnumName(Span_SpanKind_name, int32(x))
+}
+func (Span_SpanKind) EnumDescriptor() ([]byte, []int) { return fileDescriptorTrace, []int{5, 0} }
+
+type Status_StatusCode int32
+
+const (
+	Status_STATUS_CODE_UNSET Status_StatusCode = 0
+	Status_STATUS_CODE_OK    Status_StatusCode = 1
+	Status_STATUS_CODE_ERROR Status_StatusCode = 2
+)
+
+var Status_StatusCode_name = map[int32]string{
+	0: "STATUS_CODE_UNSET",
+	1: "STATUS_CODE_OK",
+	2: "STATUS_CODE_ERROR",
+}
+var Status_StatusCode_value = map[string]int32{
+	"STATUS_CODE_UNSET": 0,
+	"STATUS_CODE_OK":    1,
+	"STATUS_CODE_ERROR": 2,
+}
+
+func (x Status_StatusCode) String() string {
+	return proto.EnumName(Status_StatusCode_name, int32(x))
+}
+func (Status_StatusCode) EnumDescriptor() ([]byte, []int) { return fileDescriptorTrace, []int{6, 0} }
+
+type ExportTraceServiceRequest struct {
+	ResourceSpans []*ResourceSpans `protobuf:"bytes,1,rep,name=resource_spans,json=resourceSpans" json:"resource_spans,omitempty"`
+}
+
+func (m *ExportTraceServiceRequest) Reset()                    { *m = ExportTraceServiceRequest{} }
+func (m *ExportTraceServiceRequest) String() string            { return proto.CompactTextString(m) }
+func (*ExportTraceServiceRequest) ProtoMessage()               {}
+func (*ExportTraceServiceRequest) Descriptor() ([]byte, []int) { return fileDescriptorTrace, []int{0} }
+
+func (m *ExportTraceServiceRequest) GetResourceSpans() []*ResourceSpans {
+	if m != nil {
+		return m.ResourceSpans
+	}
+	return nil
+}
+
+type ExportTraceServiceResponse struct {
+	PartialSuccess *ExportTracePartialSuccess `protobuf:"bytes,1,opt,name=partial_success,json=partialSuccess" json:"partial_success,omitempty"`
+}
+
+func (m *ExportTraceServiceResponse) Reset()                    { *m = ExportTraceServiceResponse{} }
+func (m *ExportTraceServiceResponse) String() string            { return proto.CompactTextString(m) }
+func (*ExportTraceServiceResponse) ProtoMessage()               {}
+func (*ExportTraceServiceResponse) Descriptor() ([]byte, []int) { return fileDescriptorTrace, []int{1} }
+
+func (m *ExportTraceServiceResponse) GetPartialSuccess() *ExportTracePartialSuccess {
+	if m != nil {
+		return m.PartialSuccess
+	}
+	return nil
+}
+
+type ExportTracePartialSuccess struct {
+	RejectedSpans int64  `protobuf:"varint,1,opt,name=rejected_spans,json=rejectedSpans,proto3" json:"rejected_spans,omitempty"`
+	ErrorMessage  string `protobuf:"bytes,2,opt,name=error_message,json=errorMessage,proto3" json:"error_message,omitempty"`
+}
+
+func (m *ExportTracePartialSuccess) Reset()                    { *m = ExportTracePartialSuccess{} }
+func (m *ExportTracePartialSuccess) String() string            { return proto.CompactTextString(m) }
+func (*ExportTracePartialSuccess) ProtoMessage()               {}
+func (*ExportTracePartialSuccess) Descriptor() ([]byte, []int) { return fileDescriptorTrace, []int{2} }
+
+func (m *ExportTracePartialSuccess) GetRejectedSpans() int64 {
+	if m != nil {
+		return m.RejectedSpans
+	}
+	return 0
+}
+
+func (m *ExportTracePartialSuccess) GetErrorMessage() string {
+	if m != nil {
+		return m.ErrorMessage
+	}
+	return ""
+}
+
+type ResourceSpans struct {
+	Resource   *opentelemetry_proto_common_v1.Resource `protobuf:"bytes,1,opt,name=resource" json:"resource,omitempty"`
+	ScopeSpans []*ScopeSpans                           `protobuf:"bytes,2,rep,name=scope_spans,json=scopeSpans" json:"scope_spans,omitempty"`
+	SchemaUrl  string                                  `protobuf:"bytes,3,opt,name=schema_url,json=schemaUrl,proto3" json:"schema_url,omitempty"`
+}
+
+func (m *ResourceSpans) Reset()                    { *m = ResourceSpans{} }
+func (m *ResourceSpans) String() string            { return proto.CompactTextString(m) }
+func (*ResourceSpans) ProtoMessage()               {}
+func (*ResourceSpans) Descriptor() ([]byte, []int) { return fileDescriptorTrace, []int{3} }
+
+func (m *ResourceSpans) GetResource() *opentelemetry_proto_common_v1.Resource {
+	if m != nil {
+		return m.Resource
+	}
+	return nil
+}
+
+func (m *ResourceSpans) GetScopeSpans() []*ScopeSpans {
+	if m != nil {
+		return m.ScopeSpans
+	}
+	return nil
+}
+
+func (m *ResourceSpans) GetSchemaUrl() string {
+	if m != nil {
+		return m.SchemaUrl
+	}
+	return ""
+}
+
+type ScopeSpans struct {
+	Scope     *opentelemetry_proto_common_v1.InstrumentationScope `protobuf:"bytes,1,opt,name=scope" json:"scope,omitempty"`
+	Spans     []*Span                                             `protobuf:"bytes,2,rep,name=spans" json:"spans,omitempty"`
+	SchemaUrl string                                              `protobuf:"bytes,3,opt,name=schema_url,json=schemaUrl,proto3" json:"schema_url,omitempty"`
+}
+
+func (m *ScopeSpans) Reset()                    { *m = ScopeSpans{} }
+func (m *ScopeSpans) String() string            { return proto.CompactTextString(m) }
+func (*ScopeSpans) ProtoMessage()               {}
+func (*ScopeSpans) Descriptor() ([]byte, []int) { return fileDescriptorTrace, []int{4} }
+
+func (m *ScopeSpans) GetScope() *opentelemetry_proto_common_v1.InstrumentationScope {
+	if m != nil {
+		return m.Scope
+	}
+	return nil
+}
+
+func (m *ScopeSpans) GetSpans() []*Span {
+	if m != nil {
+		return m.Spans
+	}
+	return nil
+}
+
+func (m *ScopeSpans) GetSchemaUrl() string {
+	if m != nil {
+		return m.SchemaUrl
+	}
+	return ""
+}
+
+type Span struct {
+	TraceId                []byte                                    `protobuf:"bytes,1,opt,name=trace_id,json=traceId,proto3" json:"trace_id,omitempty"`
+	SpanId                 []byte                                    `protobuf:"bytes,2,opt,name=span_id,json=spanId,proto3" json:"span_id,omitempty"`
+	TraceState             string                                    `protobuf:"bytes,3,opt,name=trace_state,json=traceState,proto3" json:"trace_state,omitempty"`
+	ParentSpanId           []byte                                    `protobuf:"bytes,4,opt,name=parent_span_id,json=parentSpanId,proto3" json:"parent_span_id,omitempty"`
+	Name                   string                                    `protobuf:"bytes,5,opt,name=name,proto3" json:"name,omitempty"`
+	Kind                   Span_SpanKind                             `protobuf:"varint,6,opt,name=kind,proto3,enum=opentelemetry.proto.collector.trace.v1.Span_SpanKind" json:"kind,omitempty"`
+	StartTimeUnixNano      uint64                                    `protobuf:"fixed64,7,opt,name=start_time_unix_nano,json=startTimeUnixNano,proto3" json:"start_time_unix_nano,omitempty"`
+	EndTimeUnixNano        uint64                                    `protobuf:"fixed64,8,opt,name=end_time_unix_nano,json=endTimeUnixNano,proto3" json:"end_time_unix_nano,omitempty"`
+	Attributes             []*opentelemetry_proto_common_v1.KeyValue `protobuf:"bytes,9,rep,name=attributes" json:"attributes,omitempty"`
+	DroppedAttributesCount uint32                                    `protobuf:"varint,10,opt,name=dropped_attributes_count,json=droppedAttributesCount,proto3" json:"dropped_attributes_count,omitempty"`
+	Status                 *Status                                   `protobuf:"bytes,15,opt,name=status" json:"status,omitempty"`
+}
+
+func (m *Span) Reset()                    { *m = Span{} }
+func (m *Span) String() string            { return proto.CompactTextString(m) }
+func (*Span) ProtoMessage()               {}
+func (*Span) Descriptor() ([]byte, []int) { return fileDescriptorTrace, []int{5} }
+
+func (m *Span) GetTraceId() []byte {
+	if m != nil {
+		return m.TraceId
+	}
+	return nil
+}
+
+func (m *Span) GetSpanId() []byte {
+	if m != nil {
+		return m.SpanId
+	}
+	return nil
+}
+
+func (m *Span) GetTraceState() string {
+	if m != nil {
+		return m.TraceState
+	}
+	return ""
+}
+
+func (m *Span) GetParentSpanId() []byte {
+	if m != nil {
+		return m.ParentSpanId
+	}
+	return nil
+}
+
+func (m *Span) GetName() string {
+	if m != nil {
+		return m.Name
+	}
+	return ""
+}
+
+func (m *Span) GetKind() Span_SpanKind {
+	if m != nil {
+		return m.Kind
+	}
+	return Span_SPAN_KIND_UNSPECIFIED
+}
+
+func (m *Span) GetStartTimeUnixNano() uint64 {
+	if m != nil {
+		return m.StartTimeUnixNano
+	}
+	return 0
+}
+
+func (m *Span) GetEndTimeUnixNano() uint64 {
+	if m != nil {
+		return m.EndTimeUnixNano
+	}
+	return 0
+}
+
+func (m *Span) GetAttributes() []*opentelemetry_proto_common_v1.KeyValue {
+	if m != nil {
+		return m.Attributes
+	}
+	return nil
+}
+
+func (m *Span) GetDroppedAttributesCount() uint32 {
+	if m != nil {
+		return m.DroppedAttributesCount
+	}
+	return 0
+}
+
+func (m *Span) GetStatus() *Status {
+	if m != nil {
+		return m.Status
+	}
+	return nil
+}
+
+type Status struct {
+	Message string            `protobuf:"bytes,2,opt,name=message,proto3" json:"message,omitempty"`
+	Code    Status_StatusCode `protobuf:"varint,3,opt,name=code,proto3,enum=opentelemetry.proto.collector.trace.v1.Status_StatusCode" json:"code,omitempty"`
+}
+
+func (m *Status) Reset()                    { *m = Status{} }
+func (m *Status) String() string            { return proto.CompactTextString(m) }
+func (*Status) ProtoMessage()               {}
+func (*Status) Descriptor() ([]byte, []int) { return fileDescriptorTrace, []int{6} }
+
+func (m *Status) GetMessage() string {
+	if m != nil {
+		return m.Message
+	}
+	return ""
+}
+
+func (m *Status) GetCode() Status_StatusCode {
+	if m != nil {
+		return m.Code
+	}
+	return Status_STATUS_CODE_UNSET
+}
+
+func init() {
+	proto.RegisterType((*ExportTraceServiceRequest)(nil), "opentelemetry.proto.collector.trace.v1.ExportTraceServiceRequest")
+	proto.RegisterType((*ExportTraceServiceResponse)(nil), "opentelemetry.proto.collector.trace.v1.ExportTraceServiceResponse")
+	proto.RegisterType((*ExportTracePartialSuccess)(nil), "opentelemetry.proto.collector.trace.v1.ExportTracePartialSuccess")
+	proto.RegisterType((*ResourceSpans)(nil), "opentelemetry.proto.collector.trace.v1.ResourceSpans")
+	proto.RegisterType((*ScopeSpans)(nil), "opentelemetry.proto.collector.trace.v1.ScopeSpans")
+	proto.RegisterType((*Span)(nil), "opentelemetry.proto.collector.trace.v1.Span")
+	proto.RegisterType((*Status)(nil), "opentelemetry.proto.collector.trace.v1.Status")
+	proto.RegisterEnum("opentelemetry.proto.collector.trace.v1.Span_SpanKind", Span_SpanKind_name, Span_SpanKind_value)
+	proto.RegisterEnum("opentelemetry.proto.collector.trace.v1.Status_StatusCode", Status_StatusCode_name, Status_StatusCode_value)
+}
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ context.Context
+var _ grpc.ClientConn
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+const _ = grpc.SupportPackageIsVersion4
+
+// Client API for TraceService service
+
+type TraceServiceClient interface {
+	Export(ctx context.Context, in *ExportTraceServiceRequest, opts ...grpc.CallOption) (*ExportTraceServiceResponse, error)
+}
+
+type traceServiceClient struct {
+	cc *grpc.ClientConn
+}
+
+func NewTraceServiceClient(cc *grpc.ClientConn) TraceServiceClient {
+	return &traceServiceClient{cc}
+}
+
+func (c *traceServiceClient) Export(ctx context.Context, in *ExportTraceServiceRequest, opts ...grpc.CallOption) (*ExportTraceServiceResponse, error) {
+	out := new(ExportTraceServiceResponse)
+	err := grpc.Invoke(ctx, "/opentelemetry.proto.collector.trace.v1.TraceService/Export", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Server API for TraceService service
+
+type TraceServiceServer interface {
+	Export(context.Context, *ExportTraceServiceRequest) (*ExportTraceServiceResponse, error)
+}
+
+func RegisterTraceServiceServer(s *grpc.Server, srv TraceServiceServer) {
+	s.RegisterService(&_TraceService_serviceDesc, srv)
+}
+
+func _TraceService_Export_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ExportTraceServiceRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TraceServiceServer).Export(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/opentelemetry.proto.collector.trace.v1.TraceService/Export",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TraceServiceServer).Export(ctx, req.(*ExportTraceServiceRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+var _TraceService_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "opentelemetry.proto.collector.trace.v1.TraceService",
+	HandlerType: (*TraceServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Export",
+			Handler:    _TraceService_Export_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "sinks/otlp/otlptrace/trace.proto",
+}
+
+func (m *ExportTraceServiceRequest) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalTo(dAtA)
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *ExportTraceServiceRequest) MarshalTo(dAtA []byte) (int, error) {
+	var i int
+	_ = i
+	var l int
+	_ = l
+	if len(m.ResourceSpans) > 0 {
+		for _, msg := range m.ResourceSpans {
+			dAtA[i] = 0xa
+			i++
+			i = encodeVarintTrace(dAtA, i, uint64(msg.Size()))
+			n, err := msg.MarshalTo(dAtA[i:])
+			if err != nil {
+				return 0, err
+			}
+			i += n
+		}
+	}
+	return i, nil
+}
+
+func (m *ExportTraceServiceResponse) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalTo(dAtA)
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *ExportTraceServiceResponse) MarshalTo(dAtA []byte) (int, error) {
+	var i int
+	_ = i
+	var l int
+	_ = l
+	if m.PartialSuccess != nil {
+		dAtA[i] = 0xa
+		i++
+		i = encodeVarintTrace(dAtA, i, uint64(m.PartialSuccess.Size()))
+		n1, err := m.PartialSuccess.MarshalTo(dAtA[i:])
+		if err != nil {
+			return 0, err
+		}
+		i += n1
+	}
+	return i, nil
+}
+
+func (m *ExportTracePartialSuccess) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalTo(dAtA)
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *ExportTracePartialSuccess) MarshalTo(dAtA []byte) (int, error) {
+	var i int
+	_ = i
+	var l int
+	_ = l
+	if m.RejectedSpans != 0 {
+		dAtA[i] = 0x8
+		i++
+		i = encodeVarintTrace(dAtA, i, uint64(m.RejectedSpans))
+	}
+	if len(m.ErrorMessage) > 0 {
+		dAtA[i] = 0x12
+		i++
+		i = encodeVarintTrace(dAtA, i, uint64(len(m.ErrorMessage)))
+		i += copy(dAtA[i:], m.ErrorMessage)
+	}
+	return i, nil
+}
+
+func (m *ResourceSpans) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalTo(dAtA)
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *ResourceSpans) MarshalTo(dAtA []byte) (int, error) {
+	var i int
+	_ = i
+	var l int
+	_ = l
+	if m.Resource != nil {
+		dAtA[i] = 0xa
+		i++
+		i = encodeVarintTrace(dAtA, i, uint64(m.Resource.Size()))
+		n2, err := m.Resource.MarshalTo(dAtA[i:])
+		if err != nil {
+			return 0, err
+		}
+		i += n2
+	}
+	if len(m.ScopeSpans) > 0 {
+		for _, msg := range m.ScopeSpans {
+			dAtA[i] = 0x12
+			i++
+			i = encodeVarintTrace(dAtA, i, uint64(msg.Size()))
+			n, err := msg.MarshalTo(dAtA[i:])
+			if err != nil {
+				return 0, err
+			}
+			i += n
+		}
+	}
+	if len(m.SchemaUrl) > 0 {
+		dAtA[i] = 0x1a
+		i++
+		i = encodeVarintTrace(dAtA, i, uint64(len(m.SchemaUrl)))
+		i += copy(dAtA[i:], m.SchemaUrl)
+	}
+	return i, nil
+}
+
+func (m *ScopeSpans) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalTo(dAtA)
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *ScopeSpans) MarshalTo(dAtA []byte) (int, error) {
+	var i int
+	_ = i
+	var l int
+	_ = l
+	if m.Scope != nil {
+		dAtA[i] = 0xa
+		i++
+		i = encodeVarintTrace(dAtA, i, uint64(m.Scope.Size()))
+		n3, err := m.Scope.MarshalTo(dAtA[i:])
+		if err != nil {
+			return 0, err
+		}
+		i += n3
+	}
+	if len(m.Spans) > 0 {
+		for _, msg := range m.Spans {
+			dAtA[i] = 0x12
+			i++
+			i = encodeVarintTrace(dAtA, i, uint64(msg.Size()))
+			n, err := msg.MarshalTo(dAtA[i:])
+			if err != nil {
+				return 0, err
+			}
+			i += n
+		}
+	}
+	if len(m.SchemaUrl) > 0 {
+		dAtA[i] = 0x1a
+		i++
+		i = encodeVarintTrace(dAtA, i, uint64(len(m.SchemaUrl)))
+		i += copy(dAtA[i:], m.SchemaUrl)
+	}
+	return i, nil
+}
+
+func (m *Span) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalTo(dAtA)
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *Span) MarshalTo(dAtA []byte) (int, error) {
+	var i int
+	_ = i
+	var l int
+	_ = l
+	if len(m.TraceId) > 0 {
+		dAtA[i] = 0xa
+		i++
+		i = encodeVarintTrace(dAtA, i, uint64(len(m.TraceId)))
+		i += copy(dAtA[i:], m.TraceId)
+	}
+	if len(m.SpanId) > 0 {
+		dAtA[i] = 0x12
+		i++
+		i = encodeVarintTrace(dAtA, i, uint64(len(m.SpanId)))
+		i += copy(dAtA[i:], m.SpanId)
+	}
+	if len(m.TraceState) > 0 {
+		dAtA[i] = 0x1a
+		i++
+		i = encodeVarintTrace(dAtA, i, uint64(len(m.TraceState)))
+		i += copy(dAtA[i:], m.TraceState)
+	}
+	if len(m.ParentSpanId) > 0 {
+		dAtA[i] = 0x22
+		i++
+		i = encodeVarintTrace(dAtA, i, uint64(len(m.ParentSpanId)))
+		i += copy(dAtA[i:], m.ParentSpanId)
+	}
+	if len(m.Name) > 0 {
+		dAtA[i] = 0x2a
+		i++
+		i = encodeVarintTrace(dAtA, i, uint64(len(m.Name)))
+		i += copy(dAtA[i:], m.Name)
+	}
+	if m.Kind != 0 {
+		dAtA[i] = 0x30
+		i++
+		i = encodeVarintTrace(dAtA, i, uint64(m.Kind))
+	}
+	if m.StartTimeUnixNano != 0 {
+		dAtA[i] = 0x39
+		i++
+		encoding_binary.LittleEndian.PutUint64(dAtA[i:], uint64(m.StartTimeUnixNano))
+		i += 8
+	}
+	if m.EndTimeUnixNano != 0 {
+		dAtA[i] = 0x41
+		i++
+		encoding_binary.LittleEndian.PutUint64(dAtA[i:], uint64(m.EndTimeUnixNano))
+		i += 8
+	}
+	if len(m.Attributes) > 0 {
+		for _, msg := range m.Attributes {
+			dAtA[i] = 0x4a
+			i++
+			i = encodeVarintTrace(dAtA, i, uint64(msg.Size()))
+			n, err := msg.MarshalTo(dAtA[i:])
+			if err != nil {
+				return 0, err
+			}
+			i += n
+		}
+	}
+	if m.DroppedAttributesCount != 0 {
+		dAtA[i] = 0x50
+		i++
+		i = encodeVarintTrace(dAtA, i, uint64(m.DroppedAttributesCount))
+	}
+	if m.Status != nil {
+		dAtA[i] = 0x7a
+		i++
+		i = encodeVarintTrace(dAtA, i, uint64(m.Status.Size()))
+		n4, err := m.Status.MarshalTo(dAtA[i:])
+		if err != nil {
+			return 0, err
+		}
+		i += n4
+	}
+	return i, nil
+}
+
+func (m *Status) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalTo(dAtA)
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *Status) MarshalTo(dAtA []byte) (int, error) {
+	var i int
+	_ = i
+	var l int
+	_ = l
+	if len(m.Message) > 0 {
+		dAtA[i] = 0x12
+		i++
+		i = encodeVarintTrace(dAtA, i, uint64(len(m.Message)))
+		i += copy(dAtA[i:], m.Message)
+	}
+	if m.Code != 0 {
+		dAtA[i] = 0x18
+		i++
+		i = encodeVarintTrace(dAtA, i, uint64(m.Code))
+	}
+	return i, nil
+}
+
+func encodeVarintTrace(dAtA []byte, offset int, v uint64) int {
+	for v >= 1<<7 {
+		dAtA[offset] = uint8(v&0x7f | 0x80)
+		v >>= 7
+		offset++
+	}
+	dAtA[offset] = uint8(v)
+	return offset + 1
+}
+func (m *ExportTraceServiceRequest) Size() (n int) {
+	var l int
+	_ = l
+	if len(m.ResourceSpans) > 0 {
+		for _, e := range m.ResourceSpans {
+			l = e.Size()
+			n += 1 + l + sovTrace(uint64(l))
+		}
+	}
+	return n
+}
+
+func (m *ExportTraceServiceResponse) Size() (n int) {
+	var l int
+	_ = l
+	if m.PartialSuccess != nil {
+		l = m.PartialSuccess.Size()
+		n += 1 + l + sovTrace(uint64(l))
+	}
+	return n
+}
+
+func (m *ExportTracePartialSuccess) Size() (n int) {
+	var l int
+	_ = l
+	if m.RejectedSpans != 0 {
+		n += 1 + sovTrace(uint64(m.RejectedSpans))
+	}
+	l = len(m.ErrorMessage)
+	if l > 0 {
+		n += 1 + l + sovTrace(uint64(l))
+	}
+	return n
+}
+
+func (m *ResourceSpans) Size() (n int) {
+	var l int
+	_ = l
+	if m.Resource != nil {
+		l = m.Resource.Size()
+		n += 1 + l + sovTrace(uint64(l))
+	}
+	if len(m.ScopeSpans) > 0 {
+		for _, e := range m.ScopeSpans {
+			l = e.Size()
+			n += 1 + l + sovTrace(uint64(l))
+		}
+	}
+	l = len(m.SchemaUrl)
+	if l > 0 {
+		n += 1 + l + sovTrace(uint64(l))
+	}
+	return n
+}
+
+func (m *ScopeSpans) Size() (n int) {
+	var l int
+	_ = l
+	if m.Scope != nil {
+		l = m.Scope.Size()
+		n += 1 + l + sovTrace(uint64(l))
+	}
+	if len(m.Spans) > 0 {
+		for _, e := range m.Spans {
+			l = e.Size()
+			n += 1 + l + sovTrace(uint64(l))
+		}
+	}
+	l = len(m.SchemaUrl)
+	if l > 0 {
+		n += 1 + l + sovTrace(uint64(l))
+	}
+	return n
+}
+
+func (m *Span) Size() (n int) {
+	var l int
+	_ = l
+	l = len(m.TraceId)
+	if l > 0 {
+		n += 1 + l + sovTrace(uint64(l))
+	}
+	l = len(m.SpanId)
+	if l > 0 {
+		n += 1 + l + sovTrace(uint64(l))
+	}
+	l = len(m.TraceState)
+	if l > 0 {
+		n += 1 + l + sovTrace(uint64(l))
+	}
+	l = len(m.ParentSpanId)
+	if l > 0 {
+		n += 1 + l + sovTrace(uint64(l))
+	}
+	l = len(m.Name)
+	if l > 0 {
+		n += 1 + l + sovTrace(uint64(l))
+	}
+	if m.Kind != 0 {
+		n += 1 + sovTrace(uint64(m.Kind))
+	}
+	if m.StartTimeUnixNano != 0 {
+		n += 9
+	}
+	if m.EndTimeUnixNano != 0 {
+		n += 9
+	}
+	if len(m.Attributes) > 0 {
+		for _, e := range m.Attributes {
+			l = e.Size()
+			n += 1 + l + sovTrace(uint64(l))
+		}
+	}
+	if m.DroppedAttributesCount != 0 {
+		n += 1 + sovTrace(uint64(m.DroppedAttributesCount))
+	}
+	if m.Status != nil {
+		l = m.Status.Size()
+		n += 1 + l + sovTrace(uint64(l))
+	}
+	return n
+}
+
+func (m *Status) Size() (n int) {
+	var l int
+	_ = l
+	l = len(m.Message)
+	if l > 0 {
+		n += 1 + l + sovTrace(uint64(l))
+	}
+	if m.Code != 0 {
+		n += 1 + sovTrace(uint64(m.Code))
+	}
+	return n
+}
+
+func sovTrace(x uint64) (n int) {
+	for {
+		n++
+		x >>= 7
+		if x == 0 {
+			break
+		}
+	}
+	return n
+}
+func sozTrace(x uint64) (n int) {
+	return sovTrace(uint64((x << 1) ^ uint64((int64(x) >> 63))))
+}
+func (m *ExportTraceServiceRequest) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowTrace
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= (uint64(b) & 0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: ExportTraceServiceRequest: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: ExportTraceServiceRequest: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field ResourceSpans", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowTrace
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= (int(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthTrace
+			}
+			postIndex := iNdEx + msglen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.ResourceSpans = append(m.ResourceSpans, &ResourceSpans{})
+			if err := m.ResourceSpans[len(m.ResourceSpans)-1].Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
+		default:
+			iNdEx = preIndex
+			skippy, err := skipTrace(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if skippy < 0 {
+				return ErrInvalidLengthTrace
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+func (m *ExportTraceServiceResponse) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowTrace
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= (uint64(b) & 0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: ExportTraceServiceResponse: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: ExportTraceServiceResponse: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field PartialSuccess", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowTrace
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= (int(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthTrace
+			}
+			postIndex := iNdEx + msglen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			if m.PartialSuccess == nil {
+				m.PartialSuccess = &ExportTracePartialSuccess{}
+			}
+			if err := m.PartialSuccess.Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
+		default:
+			iNdEx = preIndex
+			skippy, err := skipTrace(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if skippy < 0 {
+				return ErrInvalidLengthTrace
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+func (m *ExportTracePartialSuccess) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowTrace
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= (uint64(b) & 0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: ExportTracePartialSuccess: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: ExportTracePartialSuccess: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field RejectedSpans", wireType)
+			}
+			m.RejectedSpans = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowTrace
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.RejectedSpans |= (int64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 2:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field ErrorMessage", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowTrace
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= (uint64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthTrace
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.ErrorMessage = string(dAtA[iNdEx:postIndex])
+			iNdEx = postIndex
+		default:
+			iNdEx = preIndex
+			skippy, err := skipTrace(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if skippy < 0 {
+				return ErrInvalidLengthTrace
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+func (m *ResourceSpans) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowTrace
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= (uint64(b) & 0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: ResourceSpans: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: ResourceSpans: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Resource", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowTrace
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= (int(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthTrace
+			}
+			postIndex := iNdEx + msglen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			if m.Resource == nil {
+				m.Resource = &opentelemetry_proto_common_v1.Resource{}
+			}
+			if err := m.Resource.Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
+		case 2:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field ScopeSpans", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowTrace
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= (int(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthTrace
+			}
+			postIndex := iNdEx + msglen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.ScopeSpans = append(m.ScopeSpans, &ScopeSpans{})
+			if err := m.ScopeSpans[len(m.ScopeSpans)-1].Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
+		case 3:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field SchemaUrl", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowTrace
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= (uint64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthTrace
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.SchemaUrl = string(dAtA[iNdEx:postIndex])
+			iNdEx = postIndex
+		default:
+			iNdEx = preIndex
+			skippy, err := skipTrace(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if skippy < 0 {
+				return ErrInvalidLengthTrace
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+func (m *ScopeSpans) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowTrace
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= (uint64(b) & 0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: ScopeSpans: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: ScopeSpans: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Scope", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowTrace
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= (int(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthTrace
+			}
+			postIndex := iNdEx + msglen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			if m.Scope == nil {
+				m.Scope = &opentelemetry_proto_common_v1.InstrumentationScope{}
+			}
+			if err := m.Scope.Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
+		case 2:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Spans", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowTrace
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= (int(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthTrace
+			}
+			postIndex := iNdEx + msglen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Spans = append(m.Spans, &Span{})
+			if err := m.Spans[len(m.Spans)-1].Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
+		case 3:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field SchemaUrl", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowTrace
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= (uint64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthTrace
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.SchemaUrl = string(dAtA[iNdEx:postIndex])
+			iNdEx = postIndex
+		default:
+			iNdEx = preIndex
+			skippy, err := skipTrace(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if skippy < 0 {
+				return ErrInvalidLengthTrace
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+func (m *Span) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowTrace
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= (uint64(b) & 0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: Span: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: Span: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field TraceId", wireType)
+			}
+			var byteLen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowTrace
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				byteLen |= (int(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if byteLen < 0 {
+				return ErrInvalidLengthTrace
+			}
+			postIndex := iNdEx + byteLen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.TraceId = append(m.TraceId[:0], dAtA[iNdEx:postIndex]...)
+			if m.TraceId == nil {
+				m.TraceId = []byte{}
+			}
+			iNdEx = postIndex
+		case 2:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field SpanId", wireType)
+			}
+			var byteLen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowTrace
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				byteLen |= (int(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if byteLen < 0 {
+				return ErrInvalidLengthTrace
+			}
+			postIndex := iNdEx + byteLen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.SpanId = append(m.SpanId[:0], dAtA[iNdEx:postIndex]...)
+			if m.SpanId == nil {
+				m.SpanId = []byte{}
+			}
+			iNdEx = postIndex
+		case 3:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field TraceState", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowTrace
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= (uint64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthTrace
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.TraceState = string(dAtA[iNdEx:postIndex])
+			iNdEx = postIndex
+		case 4:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field ParentSpanId", wireType)
+			}
+			var byteLen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowTrace
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				byteLen |= (int(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if byteLen < 0 {
+				return ErrInvalidLengthTrace
+			}
+			postIndex := iNdEx + byteLen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.ParentSpanId = append(m.ParentSpanId[:0], dAtA[iNdEx:postIndex]...)
+			if m.ParentSpanId == nil {
+				m.ParentSpanId = []byte{}
+			}
+			iNdEx = postIndex
+		case 5:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Name", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowTrace
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= (uint64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthTrace
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Name = string(dAtA[iNdEx:postIndex])
+			iNdEx = postIndex
+		case 6:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Kind", wireType)
+			}
+			m.Kind = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowTrace
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.Kind |= (Span_SpanKind(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 7:
+			if wireType != 1 {
+				return fmt.Errorf("proto: wrong wireType = %d for field StartTimeUnixNano", wireType)
+			}
+			m.StartTimeUnixNano = 0
+			if (iNdEx + 8) > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.StartTimeUnixNano = uint64(encoding_binary.LittleEndian.Uint64(dAtA[iNdEx:]))
+			iNdEx += 8
+		case 8:
+			if wireType != 1 {
+				return fmt.Errorf("proto: wrong wireType = %d for field EndTimeUnixNano", wireType)
+			}
+			m.EndTimeUnixNano = 0
+			if (iNdEx + 8) > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.EndTimeUnixNano = uint64(encoding_binary.LittleEndian.Uint64(dAtA[iNdEx:]))
+			iNdEx += 8
+		case 9:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Attributes", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowTrace
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= (int(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthTrace
+			}
+			postIndex := iNdEx + msglen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Attributes = append(m.Attributes, &opentelemetry_proto_common_v1.KeyValue{})
+			if err := m.Attributes[len(m.Attributes)-1].Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
+		case 10:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field DroppedAttributesCount", wireType)
+			}
+			m.DroppedAttributesCount = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowTrace
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.DroppedAttributesCount |= (uint32(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 15:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Status", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowTrace
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= (int(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthTrace
+			}
+			postIndex := iNdEx + msglen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			if m.Status == nil {
+				m.Status = &Status{}
+			}
+			if err := m.Status.Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
+		default:
+			iNdEx = preIndex
+			skippy, err := skipTrace(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if skippy < 0 {
+				return ErrInvalidLengthTrace
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+func (m *Status) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowTrace
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= (uint64(b) & 0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: Status: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: Status: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 2:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Message", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowTrace
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= (uint64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthTrace
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Message = string(dAtA[iNdEx:postIndex])
+			iNdEx = postIndex
+		case 3:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Code", wireType)
+			}
+			m.Code = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowTrace
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.Code |= (Status_StatusCode(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		default:
+			iNdEx = preIndex
+			skippy, err := skipTrace(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if skippy < 0 {
+				return ErrInvalidLengthTrace
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+func skipTrace(dAtA []byte) (n int, err error) {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return 0, ErrIntOverflowTrace
+			}
+			if iNdEx >= l {
+				return 0, io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= (uint64(b) & 0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		wireType := int(wire & 0x7)
+		switch wireType {
+		case 0:
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return 0, ErrIntOverflowTrace
+				}
+				if iNdEx >= l {
+					return 0, io.ErrUnexpectedEOF
+				}
+				iNdEx++
+				if dAtA[iNdEx-1] < 0x80 {
+					break
+				}
+			}
+			return iNdEx, nil
+		case 1:
+			iNdEx += 8
+			return iNdEx, nil
+		case 2:
+			var length int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return 0, ErrIntOverflowTrace
+				}
+				if iNdEx >= l {
+					return 0, io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				length |= (int(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			iNdEx += length
+			if length < 0 {
+				return 0, ErrInvalidLengthTrace
+			}
+			return iNdEx, nil
+		case 3:
+			for {
+				var innerWire uint64
+				var start int = iNdEx
+				for shift := uint(0); ; shift += 7 {
+					if shift >= 64 {
+						return 0, ErrIntOverflowTrace
+					}
+					if iNdEx >= l {
+						return 0, io.ErrUnexpectedEOF
+					}
+					b := dAtA[iNdEx]
+					iNdEx++
+					innerWire |= (uint64(b) & 0x7F) << shift
+					if b < 0x80 {
+						break
+					}
+				}
+				innerWireType := int(innerWire & 0x7)
+				if innerWireType == 4 {
+					break
+				}
+				next, err := skipTrace(dAtA[start:])
+				if err != nil {
+					return 0, err
+				}
+				iNdEx = start + next
+			}
+			return iNdEx, nil
+		case 4:
+			return iNdEx, nil
+		case 5:
+			iNdEx += 4
+			return iNdEx, nil
+		default:
+			return 0, fmt.Errorf("proto: illegal wireType %d", wireType)
+		}
+	}
+	panic("unreachable")
+}
+
+var (
+	ErrInvalidLengthTrace = fmt.Errorf("proto: negative length found during unmarshaling")
+	ErrIntOverflowTrace   = fmt.Errorf("proto: integer overflow")
+)
+
+func init() { proto.RegisterFile("sinks/otlp/otlptrace/trace.proto", fileDescriptorTrace) }
+
+var fileDescriptorTrace = []byte{
+	// 842 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xa4, 0x55, 0xdd, 0x6e, 0xe4, 0x34,
+	0x14, 0xae, 0xe7, 0xaf, 0xd3, 0xd3, 0xce, 0x34, 0x6b, 0xed, 0x2e, 0x69, 0x11, 0x65, 0x14, 0xfe,
+	0x46, 0x02, 0x4d, 0xc5, 0xac, 0x90, 0xe0, 0x72, 0x3a, 0xcd, 0xa2, 0xd0, 0x6d, 0xa6, 0x72, 0x66,
+	0xf6, 0x02, 0x21, 0x45, 0xd9, 0xc4, 0x5a, 0xb2, 0x3b, 0xb1, 0x83, 0xed, 0xac, 0xda, 0x37, 0xe0,
+	0x0e, 0x6e, 0xb9, 0xe3, 0x86, 0x97, 0xe0, 0x05, 0xd8, 0x4b, 0x1e, 0x01, 0x95, 0x17, 0x41, 0xb1,
+	0xe7, 0xb7, 0x62, 0x45, 0x80, 0x1b, 0x4f, 0xfc, 0x9d, 0xf3, 0x7d, 0xf6, 0xf9, 0x8e, 0xc7, 0x86,
+	0x9e, 0x4c, 0xd9, 0x4b, 0x79, 0xca, 0xd5, 0x3c, 0xd7, 0x83, 0x12, 0x51, 0x4c, 0x4f, 0xf5, 0x38,
+	0xc8, 0x05, 0x57, 0x1c, 0x7f, 0xc8, 0x73, 0xca, 0x14, 0x9d, 0xd3, 0x8c, 0x2a, 0x71, 0x63, 0xc0,
+	0x41, 0xcc, 0xe7, 0x73, 0x1a, 0x2b, 0x2e, 0x06, 0x26, 0xf5, 0xd5, 0xa7, 0xc7, 0xce, 0x1d, 0xa5,
+	0x98, 0x67, 0x19, 0x67, 0xa7, 0xe6, 0xc7, 0xd0, 0x9c, 0x1b, 0x38, 0x72, 0xaf, 0x73, 0x2e, 0xd4,
+	0xb4, 0x64, 0x05, 0x54, 0xbc, 0x4a, 0x63, 0x4a, 0xe8, 0x77, 0x05, 0x95, 0x0a, 0x7f, 0x03, 0x5d,
+	0x41, 0x25, 0x2f, 0x44, 0x4c, 0x43, 0x99, 0x47, 0x4c, 0xda, 0xa8, 0x57, 0xef, 0xef, 0x0f, 0x3f,
+	0x1b, 0x54, 0xdb, 0xc1, 0x80, 0x2c, 0xd8, 0x41, 0x49, 0x26, 0x1d, 0xb1, 0x39, 0x75, 0xbe, 0x47,
+	0x70, 0xfc, 0x77, 0x6b, 0xcb, 0x9c, 0x33, 0x49, 0xf1, 0x0b, 0x38, 0xcc, 0x23, 0xa1, 0xd2, 0x68,
+	0x1e, 0xca, 0x22, 0x8e, 0xa9, 0x2c, 0x57, 0x47, 0xfd, 0xfd, 0xe1, 0xa8, 0xea, 0xea, 0x1b, 0xe2,
+	0x57, 0x46, 0x29, 0x30, 0x42, 0xa4, 0x9b, 0x6f, 0xcd, 0x9d, 0xe7, 0x70, 0xf4, 0xc6, 0x64, 0xfc,
+	0x41, 0xe9, 0xc2, 0x0b, 0x1a, 0x2b, 0x9a, 0xac, 0x5c, 0x40, 0xfd, 0x3a, 0xe9, 0x2c, 0x51, 0x5d,
+	0x0e, 0x7e, 0x0f, 0x3a, 0x54, 0x08, 0x2e, 0xc2, 0x8c, 0x4a, 0x19, 0x3d, 0xa7, 0x76, 0xad, 0x87,
+	0xfa, 0x7b, 0xe4, 0x40, 0x83, 0x97, 0x06, 0x73, 0x5e, 0x23, 0xe8, 0x6c, 0x99, 0x82, 0xc7, 0xd0,
+	0x5e, 0xda, 0xb2, 0xa8, 0xef, 0xa3, 0x37, 0xd4, 0xa7, 0xbb, 0xb6, 0x61, 0x2a, 0x59, 0x11, 0x71,
+	0x00, 0xfb, 0x32, 0xe6, 0xf9, 0xb2, 0x4b, 0x35, 0xdd, 0xa5, 0x61, 0x55, 0x9f, 0x82, 0x92, 0x6a,
+	0x5a, 0x04, 0x72, 0xf5, 0x8d, 0xdf, 0x01, 0x90, 0xf1, 0xb7, 0x34, 0x8b, 0xc2, 0x42, 0xcc, 0xed,
+	0xba, 0xae, 0x66, 0xcf, 0x20, 0x33, 0x31, 0x77, 0x7e, 0x45, 0x00, 0x6b, 0x26, 0xf6, 0xa0, 0xa9,
+	0xb9, 0x8b, 0x22, 0x1e, 0xfd, 0x43, 0x11, 0x1e, 0x93, 0x4a, 0x14, 0x19, 0x65, 0x2a, 0x52, 0x29,
+	0x67, 0x5a, 0x88, 0x18, 0x05, 0x7c, 0x06, 0xcd, 0xcd, 0x3a, 0x3e, 0xa9, 0x5c, 0x47, 0x1e, 0x31,
+	0xd2, 0x94, 0x55, 0x36, 0xff, 0x4b, 0x13, 0x1a, 0x65, 0x3a, 0x3e, 0x82, 0xb6, 0xe6, 0x87, 0x69,
+	0xa2, 0x77, 0x7e, 0x40, 0x76, 0xf5, 0xdc, 0x4b, 0xf0, 0x5b, 0xb0, 0x5b, 0x6a, 0x95, 0x91, 0x9a,
+	0x8e, 0xb4, 0xca, 0xa9, 0x97, 0xe0, 0x77, 0x61, 0xdf, 0x70, 0xa4, 0x8a, 0x14, 0x5d, 0x88, 0x83,
+	0x86, 0x82, 0x12, 0xc1, 0xef, 0x43, 0x79, 0xc0, 0x28, 0x53, 0xe1, 0x52, 0xa0, 0xa1, 0x05, 0x0e,
+	0x0c, 0x1a, 0x18, 0x19, 0x0c, 0x0d, 0x16, 0x65, 0xd4, 0x6e, 0x6a, 0xbe, 0xfe, 0xc6, 0x1e, 0x34,
+	0x5e, 0xa6, 0x2c, 0xb1, 0x5b, 0x3d, 0xd4, 0xef, 0x56, 0xff, 0x9f, 0x95, 0x8a, 0x7a, 0xb8, 0x48,
+	0x59, 0x42, 0xb4, 0x04, 0x3e, 0x85, 0xfb, 0x52, 0x45, 0x42, 0x85, 0x2a, 0xcd, 0x68, 0x58, 0xb0,
+	0xf4, 0x3a, 0x64, 0x11, 0xe3, 0xf6, 0x6e, 0x0f, 0xf5, 0x5b, 0xe4, 0x9e, 0x8e, 0x4d, 0xd3, 0x8c,
+	0xce, 0x58, 0x7a, 0xed, 0x47, 0x8c, 0xe3, 0x8f, 0x01, 0x53, 0x96, 0xdc, 0x4d, 0x6f, 0xeb, 0xf4,
+	0x43, 0xca, 0x92, 0xad, 0xe4, 0x2f, 0x01, 0x22, 0xa5, 0x44, 0xfa, 0xac, 0x50, 0x54, 0xda, 0x7b,
+	0xbd, 0x7a, 0x85, 0x83, 0x7b, 0x41, 0x6f, 0x9e, 0x46, 0xf3, 0x82, 0x92, 0x0d, 0x2a, 0xfe, 0x1c,
+	0xec, 0x44, 0xf0, 0x3c, 0xa7, 0x49, 0xb8, 0x46, 0xc3, 0x98, 0x17, 0x4c, 0xd9, 0xd0, 0x43, 0xfd,
+	0x0e, 0x79, 0xb8, 0x88, 0x8f, 0x56, 0xe1, 0x71, 0x19, 0xc5, 0x8f, 0xa1, 0x55, 0x36, 0xa0, 0x90,
+	0xf6, 0xa1, 0x3e, 0x72, 0x83, 0xca, 0x6e, 0x69, 0x16, 0x59, 0xb0, 0x9d, 0x9f, 0x10, 0xb4, 0x97,
+	0xde, 0xe1, 0x23, 0x78, 0x10, 0x5c, 0x8d, 0xfc, 0xf0, 0xc2, 0xf3, 0xcf, 0xc3, 0x99, 0x1f, 0x5c,
+	0xb9, 0x63, 0xef, 0xb1, 0xe7, 0x9e, 0x5b, 0x3b, 0xf8, 0x21, 0xe0, 0x75, 0xc8, 0xf3, 0xa7, 0x2e,
+	0xf1, 0x47, 0x4f, 0x2c, 0x84, 0xef, 0x83, 0xb5, 0xc6, 0x03, 0x97, 0x3c, 0x75, 0x89, 0x55, 0xdb,
+	0x46, 0xc7, 0x4f, 0x3c, 0xd7, 0x9f, 0x5a, 0xf5, 0x6d, 0x8d, 0x2b, 0x32, 0x39, 0x9f, 0x8d, 0x5d,
+	0x62, 0x35, 0xb6, 0xf1, 0xf1, 0xc4, 0x0f, 0x66, 0x97, 0x2e, 0xb1, 0x9a, 0xce, 0x6f, 0x08, 0x5a,
+	0x66, 0xbb, 0xd8, 0x86, 0xdd, 0xed, 0x9b, 0x65, 0x39, 0xc5, 0x97, 0xd0, 0x88, 0x79, 0x62, 0x0e,
+	0x62, 0x77, 0xf8, 0xc5, 0xbf, 0xb3, 0x61, 0xf1, 0x33, 0xe6, 0x09, 0x25, 0x5a, 0xc6, 0xf1, 0x01,
+	0xd6, 0x18, 0x7e, 0x00, 0xf7, 0x82, 0xe9, 0x68, 0x3a, 0x0b, 0xc2, 0xf1, 0xe4, 0xdc, 0x2d, 0x2d,
+	0x71, 0xa7, 0xd6, 0x0e, 0xc6, 0xd0, 0xdd, 0x84, 0x27, 0x17, 0x16, 0xba, 0x9b, 0xea, 0x12, 0x32,
+	0x21, 0x56, 0xed, 0xab, 0x46, 0x1b, 0x59, 0xb5, 0xe1, 0xcf, 0x08, 0x0e, 0x36, 0xef, 0x79, 0xfc,
+	0x03, 0x82, 0x96, 0xb9, 0x74, 0xf1, 0x7f, 0xb9, 0xd1, 0xb7, 0x9f, 0xaa, 0xe3, 0xb3, 0xff, 0x23,
+	0x61, 0x5e, 0x9c, 0xb3, 0xb7, 0x5f, 0xdf, 0x9e, 0xa0, 0xdf, 0x6f, 0x4f, 0xd0, 0x1f, 0xb7, 0x27,
+	0xe8, 0xc7, 0x3f, 0x4f, 0x76, 0xbe, 0xde, 0x5b, 0x3d, 0xc0, 0xcf, 0x5a, 0x5a, 0xf1, 0xd1, 0x5f,
+	0x03, 0x00, 0x14, 0xd4, 0x87, 0x40, 0x9f, 0x07, 0x00, 0x00,
+}
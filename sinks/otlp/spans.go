@@ -0,0 +1,208 @@
+package otlp
+
+import (
+	"context"
+	"encoding/binary"
+	"sort"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stripe/veneur/protocol"
+	"github.com/stripe/veneur/sinks"
+	"github.com/stripe/veneur/sinks/otlp/otlpcommon"
+	"github.com/stripe/veneur/sinks/otlp/otlptrace"
+	"github.com/stripe/veneur/ssf"
+	"github.com/stripe/veneur/trace"
+	"google.golang.org/grpc"
+)
+
+// DefaultSpanBatchSize is the number of spans that the span sink
+// buffers before exporting them, if no other size is configured.
+const DefaultSpanBatchSize = 512
+
+// OTLPSpanSink is a SpanSink that exports spans to an OpenTelemetry
+// collector over OTLP/gRPC. It buffers spans and exports them in
+// batches, whenever a batch is full and on every flush.
+type OTLPSpanSink struct {
+	target   string
+	hostname string
+	batcher  *sinks.SpanBatcher
+
+	conn        *grpc.ClientConn
+	client      otlptrace.TraceServiceClient
+	traceClient *trace.Client
+	log         *logrus.Logger
+}
+
+var _ sinks.SpanSink = &OTLPSpanSink{}
+var _ sinks.Stopper = &OTLPSpanSink{}
+
+// NewOTLPSpanSink creates a sink that exports spans to the OTLP
+// collector at target ("host:port"), using opts to dial it, in batches
+// of at most batchSize spans. The hostname is reported as the
+// "host.name" attribute of each span's resource.
+func NewOTLPSpanSink(ctx context.Context, target string, hostname string, batchSize int, log *logrus.Logger, opts ...grpc.DialOption) (*OTLPSpanSink, error) {
+	conn, err := grpc.DialContext(ctx, target, opts...)
+	if err != nil {
+		log.WithError(err).WithField("target", target).Error("Error establishing connection to OTLP collector")
+		return nil, err
+	}
+	if batchSize <= 0 {
+		batchSize = DefaultSpanBatchSize
+	}
+	s := &OTLPSpanSink{
+		target:   target,
+		hostname: hostname,
+		conn:     conn,
+		client:   otlptrace.NewTraceServiceClient(conn),
+		log:      log,
+	}
+	s.batcher = sinks.NewSpanBatcher(s.Name(), batchSize, s.export, log)
+	return s, nil
+}
+
+// Name returns the name of this sink.
+func (s *OTLPSpanSink) Name() string {
+	return "otlp"
+}
+
+// Start sets the sink up and starts exporting batches of spans in the
+// background.
+func (s *OTLPSpanSink) Start(cl *trace.Client) error {
+	s.traceClient = cl
+	s.batcher.Start()
+	return nil
+}
+
+// Ingest buffers the span, and queues the buffered spans for export
+// if there are batchSize of them.
+func (s *OTLPSpanSink) Ingest(span *ssf.SSFSpan) error {
+	if err := protocol.ValidateTrace(span); err != nil {
+		return err
+	}
+	s.batcher.Add(span)
+	return nil
+}
+
+// Flush queues all buffered spans for export, and reports the number
+// of spans exported and dropped since the last flush.
+func (s *OTLPSpanSink) Flush() {
+	s.batcher.Flush(s.traceClient)
+}
+
+// Stop exports the buffered spans, and waits for all batches to be
+// exported.
+func (s *OTLPSpanSink) Stop() error {
+	return s.batcher.Stop()
+}
+
+func (s *OTLPSpanSink) export(ctx context.Context, batch []*ssf.SSFSpan) int {
+	resp, err := s.client.Export(ctx, s.exportRequest(batch))
+	if err != nil {
+		s.log.WithError(err).WithFields(logrus.Fields{
+			"target": s.target,
+			"spans":  len(batch),
+		}).Warn("Error exporting spans to OTLP collector")
+		return 0
+	}
+	sent := len(batch)
+	if ps := resp.GetPartialSuccess(); ps != nil && ps.RejectedSpans > 0 {
+		s.log.WithFields(logrus.Fields{
+			"rejected":      ps.RejectedSpans,
+			logrus.ErrorKey: ps.ErrorMessage,
+		}).Warn("OTLP collector rejected some spans")
+		sent -= int(ps.RejectedSpans)
+	}
+	return sent
+}
+
+// exportRequest converts the spans into an export request with one
+// resource per service.
+func (s *OTLPSpanSink) exportRequest(batch []*ssf.SSFSpan) *otlptrace.ExportTraceServiceRequest {
+	byService := map[string]*otlptrace.ScopeSpans{}
+	var services []string
+	for _, span := range batch {
+		scope, ok := byService[span.Service]
+		if !ok {
+			scope = &otlptrace.ScopeSpans{Scope: instrumentationScope}
+			byService[span.Service] = scope
+			services = append(services, span.Service)
+		}
+		scope.Spans = append(scope.Spans, convertSpan(span))
+	}
+
+	req := &otlptrace.ExportTraceServiceRequest{
+		ResourceSpans: make([]*otlptrace.ResourceSpans, 0, len(services)),
+	}
+	for _, service := range services {
+		attrs := []*otlpcommon.KeyValue{stringAttribute("service.name", service)}
+		if s.hostname != "" {
+			attrs = append(attrs, stringAttribute("host.name", s.hostname))
+		}
+		req.ResourceSpans = append(req.ResourceSpans, &otlptrace.ResourceSpans{
+			Resource:   &otlpcommon.Resource{Attributes: attrs},
+			ScopeSpans: []*otlptrace.ScopeSpans{byService[service]},
+		})
+	}
+	return req
+}
+
+// convertSpan converts an SSF span into an OTLP span. The span's tags
+// become string attributes sorted by key; indicator spans additionally
+// get the boolean attribute "indicator". Error spans get an error
+// status.
+func convertSpan(span *ssf.SSFSpan) *otlptrace.Span {
+	keys := make([]string, 0, len(span.Tags))
+	for k := range span.Tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	attrs := make([]*otlpcommon.KeyValue, 0, len(keys)+1)
+	for _, k := range keys {
+		attrs = append(attrs, stringAttribute(k, span.Tags[k]))
+	}
+	if span.Indicator {
+		attrs = append(attrs, &otlpcommon.KeyValue{
+			Key:   "indicator",
+			Value: &otlpcommon.AnyValue{Value: &otlpcommon.AnyValue_BoolValue{BoolValue: true}},
+		})
+	}
+
+	status := &otlptrace.Status{Code: otlptrace.Status_STATUS_CODE_UNSET}
+	if span.Error {
+		status.Code = otlptrace.Status_STATUS_CODE_ERROR
+	}
+
+	ret := &otlptrace.Span{
+		TraceId:           traceID(trace.TraceIDHigh(span.Tags), span.TraceId),
+		SpanId:            spanID(span.Id),
+		Name:              span.Name,
+		Kind:              otlptrace.Span_SPAN_KIND_INTERNAL,
+		StartTimeUnixNano: uint64(span.StartTimestamp),
+		EndTimeUnixNano:   uint64(span.EndTimestamp),
+		Attributes:        attrs,
+		Status:            status,
+	}
+	if span.ParentId > 0 {
+		ret.ParentSpanId = spanID(span.ParentId)
+	}
+	return ret
+}
+
+// traceID encodes an SSF trace ID as a 16-byte OTLP trace ID: the
+// upper half of the span's propagated trace ID followed by the SSF ID,
+// in big-endian order. The upper half of a 64-bit trace ID is eight
+// zero bytes, the same way that other tracers widen 64-bit trace IDs.
+func traceID(high uint64, id int64) []byte {
+	b := make([]byte, 16)
+	binary.BigEndian.PutUint64(b, high)
+	binary.BigEndian.PutUint64(b[8:], uint64(id))
+	return b
+}
+
+// spanID encodes an SSF span ID as an 8-byte OTLP span ID, in
+// big-endian order.
+func spanID(id int64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(id))
+	return b
+}
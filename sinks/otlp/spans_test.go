@@ -0,0 +1,148 @@
+package otlp
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	ocontext "golang.org/x/net/context"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stripe/veneur/sinks/otlp/otlptrace"
+	"github.com/stripe/veneur/ssf"
+	"google.golang.org/grpc"
+)
+
+type mockTraceServer struct {
+	mut      sync.Mutex
+	requests []*otlptrace.ExportTraceServiceRequest
+	received chan struct{}
+}
+
+func (m *mockTraceServer) Export(ctx ocontext.Context, req *otlptrace.ExportTraceServiceRequest) (*otlptrace.ExportTraceServiceResponse, error) {
+	m.mut.Lock()
+	m.requests = append(m.requests, req)
+	m.mut.Unlock()
+	m.received <- struct{}{}
+	return &otlptrace.ExportTraceServiceResponse{}, nil
+}
+
+func TestTraceAndSpanIDs(t *testing.T) {
+	assert.Equal(t, []byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0x01, 0x02}, traceID(0, 0x0102))
+	assert.Equal(t, []byte{0x80, 0xf1, 0x98, 0xee, 0x56, 0x34, 0x3b, 0xa8, 0, 0, 0, 0, 0, 0, 0x01, 0x02},
+		traceID(0x80f198ee56343ba8, 0x0102))
+	assert.Equal(t, []byte{0, 0, 0, 0, 0, 0, 0x01, 0x02}, spanID(0x0102))
+	assert.Equal(t, []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, spanID(-1))
+}
+
+func TestConvertSpanTree(t *testing.T) {
+	start := time.Unix(1476119058, 500)
+	root := &ssf.SSFSpan{
+		TraceId:        1,
+		Id:             1,
+		ParentId:       0,
+		StartTimestamp: start.UnixNano(),
+		EndTimestamp:   start.Add(time.Second).UnixNano(),
+		Name:           "GET /",
+		Service:        "frontend",
+		Indicator:      true,
+		Tags:           map[string]string{"route": "/", "method": "GET"},
+	}
+	child := &ssf.SSFSpan{
+		TraceId:        1,
+		Id:             2,
+		ParentId:       1,
+		StartTimestamp: start.Add(time.Millisecond).UnixNano(),
+		EndTimestamp:   start.Add(500 * time.Millisecond).UnixNano(),
+		Name:           "db.query",
+		Service:        "frontend",
+		Error:          true,
+	}
+
+	converted := convertSpan(root)
+	assert.Equal(t, traceID(0, 1), converted.TraceId)
+	assert.Equal(t, spanID(1), converted.SpanId)
+	assert.Empty(t, converted.ParentSpanId, "root spans have no parent")
+	assert.Equal(t, "GET /", converted.Name)
+	assert.Equal(t, uint64(start.UnixNano()), converted.StartTimeUnixNano)
+	assert.Equal(t, uint64(start.Add(time.Second).UnixNano()), converted.EndTimeUnixNano)
+	assert.Equal(t, otlptrace.Status_STATUS_CODE_UNSET, converted.Status.Code)
+	require.Len(t, converted.Attributes, 3)
+	assert.Equal(t, "method", converted.Attributes[0].Key)
+	assert.Equal(t, "GET", converted.Attributes[0].Value.GetStringValue())
+	assert.Equal(t, "route", converted.Attributes[1].Key)
+	assert.Equal(t, "indicator", converted.Attributes[2].Key)
+	assert.True(t, converted.Attributes[2].Value.GetBoolValue())
+
+	convertedChild := convertSpan(child)
+	assert.Equal(t, converted.TraceId, convertedChild.TraceId)
+	assert.Equal(t, converted.SpanId, convertedChild.ParentSpanId)
+	assert.Equal(t, spanID(2), convertedChild.SpanId)
+	assert.Equal(t, otlptrace.Status_STATUS_CODE_ERROR, convertedChild.Status.Code)
+	assert.Empty(t, convertedChild.Attributes)
+}
+
+func testSpan(id int64, service string) *ssf.SSFSpan {
+	return &ssf.SSFSpan{
+		TraceId:        id,
+		Id:             id,
+		StartTimestamp: time.Now().UnixNano(),
+		EndTimestamp:   time.Now().UnixNano(),
+		Name:           "test",
+		Service:        service,
+	}
+}
+
+func TestOTLPSpanSinkBatches(t *testing.T) {
+	mock := &mockTraceServer{received: make(chan struct{}, 10)}
+	addr, srv := startServer(t, func(srv *grpc.Server) {
+		otlptrace.RegisterTraceServiceServer(srv, mock)
+	})
+	defer srv.Stop()
+
+	sink, err := NewOTLPSpanSink(context.Background(), addr, "myhost", 2, logrus.New(), grpc.WithInsecure())
+	require.NoError(t, err)
+	require.NoError(t, sink.Start(nil))
+
+	assert.Error(t, sink.Ingest(&ssf.SSFSpan{}), "invalid spans should be rejected")
+
+	require.NoError(t, sink.Ingest(testSpan(1, "a")))
+	require.NoError(t, sink.Ingest(testSpan(2, "b")))
+	select {
+	case <-mock.received:
+	case <-time.After(5 * time.Second):
+		t.Fatal("a full batch should be exported without a flush")
+	}
+
+	require.NoError(t, sink.Ingest(testSpan(3, "a")))
+	sink.Flush()
+	select {
+	case <-mock.received:
+	case <-time.After(5 * time.Second):
+		t.Fatal("flushing should export the partial batch")
+	}
+
+	mock.mut.Lock()
+	defer mock.mut.Unlock()
+	require.Len(t, mock.requests, 2)
+
+	first := mock.requests[0]
+	require.Len(t, first.ResourceSpans, 2, "spans should be grouped by service")
+	for i, service := range []string{"a", "b"} {
+		rs := first.ResourceSpans[i]
+		attrs := map[string]string{}
+		for _, kv := range rs.Resource.Attributes {
+			attrs[kv.Key] = kv.Value.GetStringValue()
+		}
+		assert.Equal(t, map[string]string{"service.name": service, "host.name": "myhost"}, attrs)
+		require.Len(t, rs.ScopeSpans, 1)
+		assert.Len(t, rs.ScopeSpans[0].Spans, 1)
+	}
+
+	second := mock.requests[1]
+	require.Len(t, second.ResourceSpans, 1)
+	assert.Equal(t, spanID(3), second.ResourceSpans[0].ScopeSpans[0].Spans[0].SpanId)
+}
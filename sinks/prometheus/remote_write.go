@@ -0,0 +1,314 @@
+package prometheus
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/sirupsen/logrus"
+	"github.com/stripe/veneur/samplers"
+	"github.com/stripe/veneur/sinks"
+	"github.com/stripe/veneur/sinks/prometheus/prompb"
+	"github.com/stripe/veneur/ssf"
+	"github.com/stripe/veneur/trace"
+)
+
+// DefaultFlushMaxPerBody is the number of time series that the sink
+// sends in one remote write request if no other limit is configured.
+const DefaultFlushMaxPerBody = 5000
+
+// DefaultMaxRetries is the number of times that a failed remote write
+// request is retried before its metrics are dropped.
+const DefaultMaxRetries = 3
+
+// DefaultBackoff is the time that the sink waits before retrying a
+// failed request for the first time. Each subsequent retry waits
+// twice as long as the previous one, up to DefaultMaxBackoff.
+const DefaultBackoff = 100 * time.Millisecond
+
+// DefaultMaxBackoff is the longest time that the sink waits between
+// two attempts at sending a request.
+const DefaultMaxBackoff = 2 * time.Second
+
+// RemoteWriteSink is a MetricSink that sends metrics to an endpoint
+// speaking the Prometheus remote write protocol.
+type RemoteWriteSink struct {
+	endpoint        string
+	bearerToken     string
+	username        string
+	password        string
+	tags            []string
+	flushMaxPerBody int
+	maxRetries      int
+	backoff         time.Duration
+	maxBackoff      time.Duration
+	httpClient      *http.Client
+	traceClient     *trace.Client
+	log             *logrus.Logger
+}
+
+var _ sinks.SanitizingSink = &RemoteWriteSink{}
+
+// NewRemoteWriteSink creates a sink that POSTs metrics to the remote
+// write endpoint, adding tags to each metric. Requests are
+// authenticated with bearerToken if it is non-empty, or with HTTP
+// basic auth if username is non-empty; configuring both is an error.
+func NewRemoteWriteSink(endpoint string, flushMaxPerBody int, tags []string, bearerToken string, username string, password string, httpClient *http.Client, log *logrus.Logger) (*RemoteWriteSink, error) {
+	if endpoint == "" {
+		return nil, errors.New("prometheus remote write endpoint must be set")
+	}
+	if bearerToken != "" && username != "" {
+		return nil, errors.New("only one of a bearer token and basic auth can be used for prometheus remote write")
+	}
+	if flushMaxPerBody <= 0 {
+		flushMaxPerBody = DefaultFlushMaxPerBody
+	}
+	return &RemoteWriteSink{
+		endpoint:        endpoint,
+		bearerToken:     bearerToken,
+		username:        username,
+		password:        password,
+		tags:            tags,
+		flushMaxPerBody: flushMaxPerBody,
+		maxRetries:      DefaultMaxRetries,
+		backoff:         DefaultBackoff,
+		maxBackoff:      DefaultMaxBackoff,
+		httpClient:      httpClient,
+		log:             log,
+	}, nil
+}
+
+// Name returns the name of this sink.
+func (s *RemoteWriteSink) Name() string {
+	return "prometheus_rw"
+}
+
+// Start sets the sink up.
+func (s *RemoteWriteSink) Start(cl *trace.Client) error {
+	s.traceClient = cl
+	return nil
+}
+
+// Flush sends metrics to the remote write endpoint, in batches of at
+// most flushMaxPerBody time series. Batches that fail are retried
+// with backoff; Flush returns the error of the last batch that could
+// not be sent.
+func (s *RemoteWriteSink) Flush(ctx context.Context, interMetrics []samplers.InterMetric) error {
+	span, _ := trace.StartSpanFromContext(ctx, "")
+	defer span.ClientFinish(s.traceClient)
+
+	series := make([]*prompb.TimeSeries, 0, len(interMetrics))
+	for _, metric := range interMetrics {
+		if !sinks.IsAcceptableMetric(metric, s) {
+			continue
+		}
+		series = append(series, s.timeSeries(metric))
+	}
+	if len(series) == 0 {
+		return nil
+	}
+
+	flushStart := time.Now()
+	var lastErr error
+	flushed := 0
+	for start := 0; start < len(series); start += s.flushMaxPerBody {
+		end := start + s.flushMaxPerBody
+		if end > len(series) {
+			end = len(series)
+		}
+		err := s.write(span.Attach(ctx), &prompb.WriteRequest{Timeseries: series[start:end]})
+		if err != nil {
+			span.Error(err)
+			span.Add(ssf.Count("flush.error_total", 1, map[string]string{"cause": "io", "sink": s.Name()}))
+			s.log.WithError(err).WithField("metrics", end-start).Warn("Error flushing metrics to Prometheus remote write endpoint")
+			lastErr = err
+			continue
+		}
+		flushed += end - start
+	}
+
+	tags := map[string]string{"sink": s.Name()}
+	span.Add(
+		ssf.Timing(sinks.MetricKeyMetricFlushDuration, time.Since(flushStart), time.Nanosecond, tags),
+		ssf.Count(sinks.MetricKeyTotalMetricsFlushed, float32(flushed), tags),
+	)
+	s.log.WithField("metrics", flushed).Info("Completed flush to Prometheus remote write endpoint")
+	return lastErr
+}
+
+// FlushOtherSamples is a no-op: events and service checks have no
+// representation in Prometheus.
+func (s *RemoteWriteSink) FlushOtherSamples(ctx context.Context, samples []ssf.SSFSample) {
+}
+
+// timeSeries converts a metric into a time series with a single
+// sample, and the metric's exemplars. The series' labels are sorted by
+// name, as the remote write protocol requires.
+func (s *RemoteWriteSink) timeSeries(metric samplers.InterMetric) *prompb.TimeSeries {
+	labels := map[string]string{}
+	for _, tags := range [][]string{s.tags, metric.Tags} {
+		for _, tag := range tags {
+			kv := strings.SplitN(tag, ":", 2)
+			value := ""
+			if len(kv) == 2 {
+				value = kv[1]
+			}
+			labels[SanitizeLabelName(kv[0])] = value
+		}
+	}
+	labels["__name__"] = SanitizeMetricName(metric.Name)
+
+	ts := &prompb.TimeSeries{
+		Labels: make([]*prompb.Label, 0, len(labels)),
+		Samples: []*prompb.Sample{{
+			Value:     metric.Value,
+			Timestamp: metric.Timestamp * 1000,
+		}},
+	}
+	for name, value := range labels {
+		ts.Labels = append(ts.Labels, &prompb.Label{Name: name, Value: value})
+	}
+	for _, e := range metric.Exemplars {
+		ts.Exemplars = append(ts.Exemplars, &prompb.Exemplar{
+			Labels:    []*prompb.Label{{Name: samplers.ExemplarTraceIDTag, Value: e.TraceID}},
+			Value:     e.Value,
+			Timestamp: e.Timestamp / int64(time.Millisecond),
+		})
+	}
+	sort.Slice(ts.Labels, func(i, j int) bool {
+		return ts.Labels[i].Name < ts.Labels[j].Name
+	})
+	return ts
+}
+
+// write sends one remote write request, retrying it with exponential
+// backoff if the endpoint can't be reached or responds with a server
+// error or 429 status.
+func (s *RemoteWriteSink) write(ctx context.Context, req *prompb.WriteRequest) error {
+	data, err := req.Marshal()
+	if err != nil {
+		return err
+	}
+	body := snappy.Encode(nil, data)
+
+	wait := s.backoff
+	for attempt := 0; ; attempt++ {
+		retry, err := s.post(ctx, body)
+		if err == nil {
+			return nil
+		}
+		if !retry || attempt >= s.maxRetries {
+			return err
+		}
+		s.log.WithError(err).WithField("attempt", attempt+1).Debug("Retrying Prometheus remote write request")
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+		wait *= 2
+		if wait > s.maxBackoff {
+			wait = s.maxBackoff
+		}
+	}
+}
+
+// post makes a single attempt at sending body to the endpoint. It
+// returns whether a failed attempt is worth retrying.
+func (s *RemoteWriteSink) post(ctx context.Context, body []byte) (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, s.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("User-Agent", "veneur")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	if s.bearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+s.bearerToken)
+	} else if s.username != "" {
+		req.SetBasicAuth(s.username, s.password)
+	}
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return ctx.Err() == nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 == 2 {
+		io.Copy(ioutil.Discard, resp.Body)
+		return false, nil
+	}
+	msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+	err = fmt.Errorf("remote write endpoint responded with %s: %s", resp.Status, bytes.TrimSpace(msg))
+	return resp.StatusCode/100 == 5 || resp.StatusCode == http.StatusTooManyRequests, err
+}
+
+// SanitizeMetricName replaces all characters in name that are not
+// allowed in a Prometheus metric name with underscores. A name that
+// starts with a digit gets an underscore prepended.
+func SanitizeMetricName(name string) string {
+	return sanitize(name, true)
+}
+
+// SanitizeLabelName replaces all characters in name that are not
+// allowed in a Prometheus label name with underscores. A name that
+// starts with a digit gets an underscore prepended.
+func SanitizeLabelName(name string) string {
+	return sanitize(name, false)
+}
+
+func sanitize(name string, allowColon bool) string {
+	var buf bytes.Buffer
+	buf.Grow(len(name) + 1)
+	for i, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r == '_', r == ':' && allowColon:
+			buf.WriteRune(r)
+		case r >= '0' && r <= '9':
+			if i == 0 {
+				buf.WriteByte('_')
+			}
+			buf.WriteRune(r)
+		default:
+			buf.WriteByte('_')
+		}
+	}
+	if buf.Len() == 0 {
+		return "_"
+	}
+	return buf.String()
+}
+
+// Sanitizer returns the sanitizer that enforces Prometheus' charset on
+// the metrics flushed to the sink: names are sanitized with
+// SanitizeMetricName, tag keys with SanitizeLabelName, and tags
+// without a key are dropped. Tag values are left alone, since label
+// values may contain any unicode.
+func (s *RemoteWriteSink) Sanitizer() sinks.Sanitizer {
+	return labelSanitizer{}
+}
+
+type labelSanitizer struct{}
+
+func (labelSanitizer) SanitizeName(name string) string {
+	return SanitizeMetricName(name)
+}
+
+func (labelSanitizer) SanitizeTag(tag string) (string, bool) {
+	kv := strings.SplitN(tag, ":", 2)
+	if kv[0] == "" {
+		return "", false
+	}
+	kv[0] = SanitizeLabelName(kv[0])
+	return strings.Join(kv, ":"), true
+}
@@ -0,0 +1,231 @@
+package prometheus
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stripe/veneur/samplers"
+	"github.com/stripe/veneur/sinks/prometheus/prompb"
+)
+
+func labelMap(ts *prompb.TimeSeries) map[string]string {
+	labels := map[string]string{}
+	for _, l := range ts.Labels {
+		labels[l.Name] = l.Value
+	}
+	return labels
+}
+
+func TestRemoteWriteFlush(t *testing.T) {
+	received := make(chan *prompb.WriteRequest, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "snappy", r.Header.Get("Content-Encoding"))
+		assert.Equal(t, "application/x-protobuf", r.Header.Get("Content-Type"))
+		assert.Equal(t, "0.1.0", r.Header.Get("X-Prometheus-Remote-Write-Version"))
+		assert.Equal(t, "Bearer s3kr1t", r.Header.Get("Authorization"))
+
+		compressed, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+		data, err := snappy.Decode(nil, compressed)
+		require.NoError(t, err)
+		req := &prompb.WriteRequest{}
+		require.NoError(t, req.Unmarshal(data))
+		received <- req
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	sink, err := NewRemoteWriteSink(srv.URL, 2, []string{"env:test"}, "s3kr1t", "", "", srv.Client(), logrus.New())
+	require.NoError(t, err)
+	require.NoError(t, sink.Start(nil))
+
+	metrics := []samplers.InterMetric{
+		{
+			Name:      "a.b-c",
+			Timestamp: 1476119058,
+			Value:     100,
+			Tags:      []string{"foo:bar", "1up", "with.dot:x:y"},
+			Type:      samplers.CounterMetric,
+		},
+		{
+			Name:      "gauge",
+			Timestamp: 1476119059,
+			Value:     1.5,
+			Type:      samplers.GaugeMetric,
+		},
+		{
+			Name:      "elsewhere",
+			Timestamp: 1476119059,
+			Value:     1,
+			Type:      samplers.GaugeMetric,
+			Sinks:     samplers.RouteInformation{"datadog": struct{}{}},
+		},
+		{
+			Name:      "third",
+			Timestamp: 1476119060,
+			Value:     3,
+			Type:      samplers.GaugeMetric,
+		},
+	}
+	require.NoError(t, sink.Flush(context.Background(), metrics))
+	close(received)
+
+	var series []*prompb.TimeSeries
+	batches := 0
+	for req := range received {
+		batches++
+		series = append(series, req.Timeseries...)
+	}
+	assert.Equal(t, 2, batches, "metrics should be split into batches of 2")
+	require.Len(t, series, 3)
+
+	first := series[0]
+	assert.Equal(t, []*prompb.Label{
+		{Name: "_1up", Value: ""},
+		{Name: "__name__", Value: "a_b_c"},
+		{Name: "env", Value: "test"},
+		{Name: "foo", Value: "bar"},
+		{Name: "with_dot", Value: "x:y"},
+	}, first.Labels)
+	assert.Equal(t, []*prompb.Sample{{Value: 100, Timestamp: 1476119058000}}, first.Samples)
+
+	assert.Equal(t, map[string]string{"__name__": "gauge", "env": "test"}, labelMap(series[1]))
+	assert.Equal(t, "third", labelMap(series[2])["__name__"])
+}
+
+func TestRemoteWriteExemplars(t *testing.T) {
+	sink, err := NewRemoteWriteSink("http://localhost", 10, nil, "", "", "", nil, logrus.New())
+	require.NoError(t, err)
+	ts := sink.timeSeries(samplers.InterMetric{
+		Name:      "latency.max",
+		Timestamp: 1476119058,
+		Value:     90,
+		Type:      samplers.GaugeMetric,
+		Exemplars: []samplers.Exemplar{{Value: 90, TraceID: "1234", Timestamp: 1476119057500000000}},
+	})
+	assert.Equal(t, []*prompb.Exemplar{{
+		Labels:    []*prompb.Label{{Name: "trace_id", Value: "1234"}},
+		Value:     90,
+		Timestamp: 1476119057500,
+	}}, ts.Exemplars)
+}
+
+func TestRemoteWriteBasicAuth(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, ok := r.BasicAuth()
+		assert.True(t, ok)
+		assert.Equal(t, "user", user)
+		assert.Equal(t, "pass", pass)
+	}))
+	defer srv.Close()
+
+	sink, err := NewRemoteWriteSink(srv.URL, 0, nil, "", "user", "pass", srv.Client(), logrus.New())
+	require.NoError(t, err)
+	assert.NoError(t, sink.Flush(context.Background(), []samplers.InterMetric{{Name: "a", Value: 1}}))
+}
+
+func TestRemoteWriteRetries(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []int
+		requests int32
+		ok       bool
+	}{
+		{"succeeds after server errors", []int{503, 500, 204}, 3, true},
+		{"retries rate limits", []int{429, 200}, 2, true},
+		{"gives up after max retries", []int{500, 500, 500, 500, 500}, 4, false},
+		{"does not retry client errors", []int{400, 204}, 1, false},
+	}
+	for _, elt := range tests {
+		test := elt
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			var requests int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := atomic.AddInt32(&requests, 1)
+				w.WriteHeader(test.statuses[n-1])
+			}))
+			defer srv.Close()
+
+			sink, err := NewRemoteWriteSink(srv.URL, 0, nil, "", "", "", srv.Client(), logrus.New())
+			require.NoError(t, err)
+			sink.backoff = time.Millisecond
+			err = sink.Flush(context.Background(), []samplers.InterMetric{{Name: "a", Value: 1}})
+			if test.ok {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+			assert.Equal(t, test.requests, atomic.LoadInt32(&requests))
+		})
+	}
+}
+
+func TestNewRemoteWriteSinkErrors(t *testing.T) {
+	_, err := NewRemoteWriteSink("", 0, nil, "", "", "", http.DefaultClient, logrus.New())
+	assert.Error(t, err)
+	_, err = NewRemoteWriteSink("http://localhost", 0, nil, "token", "user", "", http.DefaultClient, logrus.New())
+	assert.Error(t, err)
+}
+
+func TestSanitizeNames(t *testing.T) {
+	tests := map[string][2]string{
+		"foo.bar":   {"foo_bar", "foo_bar"},
+		"ns:name":   {"ns:name", "ns_name"},
+		"9lives":    {"_9lives", "_9lives"},
+		"a-b c/d":   {"a_b_c_d", "a_b_c_d"},
+		"ok_123":    {"ok_123", "ok_123"},
+		"héllo":     {"h_llo", "h_llo"},
+		"":          {"_", "_"},
+		"__name__x": {"__name__x", "__name__x"},
+	}
+	for in, out := range tests {
+		assert.Equal(t, out[0], SanitizeMetricName(in), "metric name %q", in)
+		assert.Equal(t, out[1], SanitizeLabelName(in), "label name %q", in)
+	}
+}
+
+func TestRemoteWriteSanitizer(t *testing.T) {
+	sink, err := NewRemoteWriteSink("http://localhost", 0, nil, "", "", "", http.DefaultClient, logrus.New())
+	require.NoError(t, err)
+	s := sink.Sanitizer()
+
+	names := map[string]string{
+		"api.requests": "api_requests",
+		"9lives":       "_9lives",
+		"héllo wörld":  "h_llo_w_rld",
+		"ns:name":      "ns:name",
+		"":             "_",
+	}
+	for in, out := range names {
+		assert.Equal(t, out, s.SanitizeName(in), "name %q", in)
+		assert.Equal(t, out, s.SanitizeName(out), "sanitizing name %q again", out)
+	}
+
+	tags := map[string]string{
+		"user id:Jane Doe":  "user_id:Jane Doe",
+		"1st:héllo":         "_1st:héllo",
+		"région":            "r_gion",
+		"url:http://a.b/c":  "url:http://a.b/c",
+		"k.e.y:v:with:cols": "k_e_y:v:with:cols",
+	}
+	for in, out := range tags {
+		tag, ok := s.SanitizeTag(in)
+		assert.True(t, ok, "tag %q", in)
+		assert.Equal(t, out, tag, "tag %q", in)
+		tag, _ = s.SanitizeTag(out)
+		assert.Equal(t, out, tag, "sanitizing tag %q again", out)
+	}
+	_, ok := s.SanitizeTag(":value")
+	assert.False(t, ok, "tags without a key should be dropped")
+}
@@ -0,0 +1,154 @@
+package sinks
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+)
+
+// SinkConfig is what a registered sink's factory receives to construct
+// a sink from the metric_sinks or span_sinks section of veneur's
+// config.
+type SinkConfig struct {
+	// Kind is the name that the factory was registered under.
+	Kind string
+	// Name is the name that the sink is configured under, which
+	// defaults to Kind. The sink's Name method must return it, since
+	// per-sink options and routes refer to sinks by name.
+	Name string
+
+	// Hostname, Tags and Interval are veneur's own hostname, the
+	// tags that it adds to everything it emits, and its flush
+	// interval.
+	Hostname string
+	Tags     []string
+	Interval time.Duration
+	// HTTPClient is veneur's shared HTTP client, which sinks that
+	// talk HTTP should use.
+	HTTPClient *http.Client
+	Logger     *logrus.Logger
+
+	// Config is the sink's own section of the config, which Decode
+	// decodes.
+	Config map[string]interface{}
+}
+
+// Decode decodes the sink's own section of the config into into,
+// which should be a pointer to a struct with yaml tags. Keys of the
+// section that don't correspond to a field of into are an error.
+func (c SinkConfig) Decode(into interface{}) error {
+	bts, err := yaml.Marshal(c.Config)
+	if err != nil {
+		return err
+	}
+	if err := yaml.UnmarshalStrict(bts, into); err != nil {
+		return fmt.Errorf("config of sink %q: %v", c.Name, err)
+	}
+	return nil
+}
+
+// MetricSinkFactory constructs a metric sink from its config. It
+// shouldn't start the sink; veneur calls the sink's Start method when
+// it starts.
+type MetricSinkFactory func(SinkConfig) (MetricSink, error)
+
+// SpanSinkFactory constructs a span sink from its config, like a
+// MetricSinkFactory.
+type SpanSinkFactory func(SinkConfig) (SpanSink, error)
+
+var registry = struct {
+	sync.Mutex
+	metricSinks map[string]MetricSinkFactory
+	spanSinks   map[string]SpanSinkFactory
+}{
+	metricSinks: map[string]MetricSinkFactory{},
+	spanSinks:   map[string]SpanSinkFactory{},
+}
+
+// RegisterMetricSink makes a kind of metric sink available to veneur's
+// config, under the name kind. It is meant to be called from the init
+// function of the package that implements the sink, and panics if the
+// kind is already registered.
+func RegisterMetricSink(kind string, factory MetricSinkFactory) {
+	registry.Lock()
+	defer registry.Unlock()
+	if _, ok := registry.metricSinks[kind]; ok {
+		panic(fmt.Sprintf("metric sink %q is already registered", kind))
+	}
+	registry.metricSinks[kind] = factory
+}
+
+// RegisterSpanSink makes a kind of span sink available to veneur's
+// config, like RegisterMetricSink.
+func RegisterSpanSink(kind string, factory SpanSinkFactory) {
+	registry.Lock()
+	defer registry.Unlock()
+	if _, ok := registry.spanSinks[kind]; ok {
+		panic(fmt.Sprintf("span sink %q is already registered", kind))
+	}
+	registry.spanSinks[kind] = factory
+}
+
+// NewMetricSink constructs a metric sink of a registered kind. The
+// config's Name defaults to its Kind, and it is an error for the sink
+// to have another name.
+func NewMetricSink(config SinkConfig) (MetricSink, error) {
+	registry.Lock()
+	factory, ok := registry.metricSinks[config.Kind]
+	kinds := make([]string, 0, len(registry.metricSinks))
+	for kind := range registry.metricSinks {
+		kinds = append(kinds, kind)
+	}
+	registry.Unlock()
+	if !ok {
+		return nil, unknownKind("metric", config.Kind, kinds)
+	}
+	if config.Name == "" {
+		config.Name = config.Kind
+	}
+	sink, err := factory(config)
+	if err != nil {
+		return nil, err
+	}
+	if sink.Name() != config.Name {
+		return nil, fmt.Errorf("metric sink of kind %q is named %q instead of %q", config.Kind, sink.Name(), config.Name)
+	}
+	return sink, nil
+}
+
+// NewSpanSink constructs a span sink of a registered kind, like
+// NewMetricSink.
+func NewSpanSink(config SinkConfig) (SpanSink, error) {
+	registry.Lock()
+	factory, ok := registry.spanSinks[config.Kind]
+	kinds := make([]string, 0, len(registry.spanSinks))
+	for kind := range registry.spanSinks {
+		kinds = append(kinds, kind)
+	}
+	registry.Unlock()
+	if !ok {
+		return nil, unknownKind("span", config.Kind, kinds)
+	}
+	if config.Name == "" {
+		config.Name = config.Kind
+	}
+	sink, err := factory(config)
+	if err != nil {
+		return nil, err
+	}
+	if sink.Name() != config.Name {
+		return nil, fmt.Errorf("span sink of kind %q is named %q instead of %q", config.Kind, sink.Name(), config.Name)
+	}
+	return sink, nil
+}
+
+func unknownKind(sinkType, kind string, registered []string) error {
+	sort.Strings(registered)
+	return fmt.Errorf("unknown %s sink kind %q, registered kinds are: %s", sinkType, kind, strings.Join(registered, ", "))
+}
@@ -0,0 +1,60 @@
+package sinks
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stripe/veneur/ssf"
+	"github.com/stripe/veneur/trace"
+)
+
+type namedSpanSink struct {
+	name    string
+	options struct {
+		Endpoint string `yaml:"endpoint"`
+	}
+}
+
+func (s *namedSpanSink) Start(*trace.Client) error      { return nil }
+func (s *namedSpanSink) Name() string                   { return s.name }
+func (s *namedSpanSink) Ingest(span *ssf.SSFSpan) error { return nil }
+func (s *namedSpanSink) Flush()                         {}
+
+func TestRegisterSpanSink(t *testing.T) {
+	defer func() {
+		delete(registry.spanSinks, "test_named")
+		delete(registry.spanSinks, "test_misnamed")
+	}()
+	RegisterSpanSink("test_named", func(config SinkConfig) (SpanSink, error) {
+		sink := &namedSpanSink{name: config.Name}
+		return sink, config.Decode(&sink.options)
+	})
+	RegisterSpanSink("test_misnamed", func(config SinkConfig) (SpanSink, error) {
+		return &namedSpanSink{name: "something_else"}, nil
+	})
+	assert.Panics(t, func() {
+		RegisterSpanSink("test_named", nil)
+	})
+
+	sink, err := NewSpanSink(SinkConfig{
+		Kind:   "test_named",
+		Config: map[string]interface{}{"endpoint": "https://example.com"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "test_named", sink.Name(), "the name should default to the kind")
+	assert.Equal(t, "https://example.com", sink.(*namedSpanSink).options.Endpoint)
+
+	sink, err = NewSpanSink(SinkConfig{Kind: "test_named", Name: "traces"})
+	require.NoError(t, err)
+	assert.Equal(t, "traces", sink.Name())
+
+	_, err = NewSpanSink(SinkConfig{Kind: "test_named", Config: map[string]interface{}{"endpiont": "x"}})
+	assert.Error(t, err, "unknown config keys should be an error")
+	_, err = NewSpanSink(SinkConfig{Kind: "test_misnamed"})
+	assert.Error(t, err, "sinks must be named after their config")
+	_, err = NewSpanSink(SinkConfig{Kind: "test_missing"})
+	assert.Error(t, err)
+	_, err = NewMetricSink(SinkConfig{Kind: "test_named"})
+	assert.Error(t, err, "span sinks aren't metric sinks")
+}
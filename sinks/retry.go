@@ -0,0 +1,194 @@
+package sinks
+
+import (
+	"context"
+	"math/rand"
+	"strconv"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stripe/veneur/plugins"
+	"github.com/stripe/veneur/samplers"
+	"github.com/stripe/veneur/ssf"
+	"github.com/stripe/veneur/trace"
+)
+
+// MetricKeyFlushAttempts is emitted as a counter by RetryingSink for
+// every attempt to flush the wrapped sink. Tagged with
+// `sink:sink.Name()`, `attempt` (starting at 1) and `outcome`
+// ("success" or "error").
+const MetricKeyFlushAttempts = "sink.flush_attempts_total"
+
+// MetricKeyTotalMetricsSpilled is emitted as a counter by RetryingSink
+// with the number of metrics that it handed to its fallback after all
+// attempts failed. Tagged with `sink:sink.Name()` and `fallback`.
+const MetricKeyTotalMetricsSpilled = "sink.metrics_spilled_total"
+
+// DefaultRetryBackoff is the time that a RetryingSink waits before
+// its first retry, if no other backoff is configured.
+const DefaultRetryBackoff = 500 * time.Millisecond
+
+// DefaultRetryMaxBackoff is the longest time that a RetryingSink waits
+// between two attempts, if no other maximum is configured.
+const DefaultRetryMaxBackoff = 5 * time.Second
+
+// RetryingSink is a MetricSink that wraps another, and retries the
+// wrapped sink's failed flushes with exponential backoff and jitter.
+// Once all attempts have failed, it hands the batch to a fallback, if
+// one is set.
+//
+// A sink that fails after delivering part of a batch receives all of
+// it again on the next attempt, so only sinks that report errors
+// before delivering anything, like most HTTP sinks, deliver batches
+// exactly once.
+type RetryingSink struct {
+	sink        MetricSink
+	maxAttempts int
+	backoff     time.Duration
+	maxBackoff  time.Duration
+	timeout     time.Duration
+	fallback    plugins.Plugin
+
+	traceClient *trace.Client
+	log         *logrus.Logger
+}
+
+var _ MetricSink = &RetryingSink{}
+var _ HealthChecker = &RetryingSink{}
+var _ Stopper = &RetryingSink{}
+
+// NewRetryingSink wraps sink so that each flush is attempted up to
+// maxAttempts times in total, within timeout (if non-zero). The first
+// retry happens after about backoff, and each subsequent one after
+// twice as long as the previous one, up to maxBackoff; each wait is
+// randomized between half and all of that. If all attempts fail, the
+// batch is flushed to fallback instead, unless fallback is nil.
+func NewRetryingSink(sink MetricSink, maxAttempts int, backoff, maxBackoff, timeout time.Duration, fallback plugins.Plugin, log *logrus.Logger) *RetryingSink {
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+	if backoff <= 0 {
+		backoff = DefaultRetryBackoff
+	}
+	if maxBackoff <= 0 {
+		maxBackoff = DefaultRetryMaxBackoff
+	}
+	if maxBackoff < backoff {
+		maxBackoff = backoff
+	}
+	return &RetryingSink{
+		sink:        sink,
+		maxAttempts: maxAttempts,
+		backoff:     backoff,
+		maxBackoff:  maxBackoff,
+		timeout:     timeout,
+		fallback:    fallback,
+		log:         log,
+	}
+}
+
+// Name returns the name of the wrapped sink, so that metrics routed
+// to it still reach it.
+func (s *RetryingSink) Name() string {
+	return s.sink.Name()
+}
+
+// Start starts the wrapped sink.
+func (s *RetryingSink) Start(cl *trace.Client) error {
+	s.traceClient = cl
+	return s.sink.Start(cl)
+}
+
+// Flush flushes the metrics to the wrapped sink, retrying until it
+// succeeds, the attempts are exhausted or the timeout expires. In the
+// latter two cases, it flushes the metrics to the fallback, and
+// returns the error of the last attempt.
+func (s *RetryingSink) Flush(ctx context.Context, metrics []samplers.InterMetric) error {
+	span, _ := trace.StartSpanFromContext(ctx, "")
+	defer span.ClientFinish(s.traceClient)
+
+	flushCtx := ctx
+	if s.timeout > 0 {
+		var cancel context.CancelFunc
+		flushCtx, cancel = context.WithTimeout(ctx, s.timeout)
+		defer cancel()
+	}
+
+	wait := s.backoff
+	var err error
+attempts:
+	for attempt := 1; attempt <= s.maxAttempts; attempt++ {
+		if attempt > 1 {
+			select {
+			case <-flushCtx.Done():
+				break attempts
+			case <-time.After(wait/2 + time.Duration(rand.Int63n(int64(wait/2)+1))):
+			}
+			wait *= 2
+			if wait > s.maxBackoff {
+				wait = s.maxBackoff
+			}
+		}
+
+		err = s.sink.Flush(flushCtx, metrics)
+		outcome := "success"
+		if err != nil {
+			outcome = "error"
+		}
+		span.Add(ssf.Count(MetricKeyFlushAttempts, 1, map[string]string{
+			"sink":    s.Name(),
+			"attempt": strconv.Itoa(attempt),
+			"outcome": outcome,
+		}))
+		if err == nil {
+			return nil
+		}
+		s.log.WithError(err).WithFields(logrus.Fields{
+			"sink":    s.Name(),
+			"attempt": attempt,
+		}).Warn("Error flushing sink, retrying")
+	}
+
+	span.Error(err)
+	if s.fallback == nil {
+		return err
+	}
+	// The timeout applies to the wrapped sink only: the fallback
+	// should get its chance regardless.
+	if fbErr := s.fallback.Flush(ctx, metrics); fbErr != nil {
+		s.log.WithError(fbErr).WithFields(logrus.Fields{
+			"sink":     s.Name(),
+			"fallback": s.fallback.Name(),
+		}).Error("Error flushing metrics to fallback")
+		return err
+	}
+	span.Add(ssf.Count(MetricKeyTotalMetricsSpilled, float32(len(metrics)), map[string]string{
+		"sink":     s.Name(),
+		"fallback": s.fallback.Name(),
+	}))
+	s.log.WithFields(logrus.Fields{
+		"sink":     s.Name(),
+		"fallback": s.fallback.Name(),
+		"metrics":  len(metrics),
+	}).Warn("Gave up flushing sink, flushed metrics to fallback")
+	return err
+}
+
+// Stop stops the wrapped sink, if it needs to be stopped.
+func (s *RetryingSink) Stop() error {
+	return Stop(s.sink)
+}
+
+// Healthy returns the health of the wrapped sink, if it can tell.
+func (s *RetryingSink) Healthy() error {
+	if hc, ok := s.sink.(HealthChecker); ok {
+		return hc.Healthy()
+	}
+	return nil
+}
+
+// FlushOtherSamples passes the samples to the wrapped sink, without
+// retrying.
+func (s *RetryingSink) FlushOtherSamples(ctx context.Context, samples []ssf.SSFSample) {
+	s.sink.FlushOtherSamples(ctx, samples)
+}
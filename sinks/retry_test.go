@@ -0,0 +1,97 @@
+package sinks
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stripe/veneur/samplers"
+	"github.com/stripe/veneur/ssf"
+	"github.com/stripe/veneur/trace"
+)
+
+// flakySink fails its first failures flushes, and records the batches
+// of the flushes that succeed.
+type flakySink struct {
+	name     string
+	failures int
+
+	mut      sync.Mutex
+	attempts int
+	batches  [][]samplers.InterMetric
+}
+
+func (s *flakySink) Name() string {
+	return s.name
+}
+
+func (s *flakySink) Start(*trace.Client) error {
+	return nil
+}
+
+func (s *flakySink) Flush(ctx context.Context, metrics []samplers.InterMetric) error {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	s.attempts++
+	if s.attempts <= s.failures {
+		return errors.New("503 Service Unavailable")
+	}
+	s.batches = append(s.batches, metrics)
+	return nil
+}
+
+func (s *flakySink) FlushOtherSamples(ctx context.Context, samples []ssf.SSFSample) {}
+
+var retryTestMetrics = []samplers.InterMetric{{Name: "a.b.c", Value: 1}, {Name: "a.b.d", Value: 2}}
+
+func TestRetryingSinkRetries(t *testing.T) {
+	tests := []struct {
+		name        string
+		failures    int
+		maxAttempts int
+		succeeds    bool
+	}{
+		{"no failures", 0, 3, true},
+		{"fails then succeeds", 2, 3, true},
+		{"fails too often", 3, 3, false},
+		{"no retries", 1, 1, false},
+	}
+	for _, elt := range tests {
+		test := elt
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			sink := &flakySink{name: "flaky", failures: test.failures}
+			fallback := &flakySink{name: "fallback"}
+			rs := NewRetryingSink(sink, test.maxAttempts, time.Millisecond, 2*time.Millisecond, 0, fallback, logrus.New())
+			require.Equal(t, "flaky", rs.Name())
+
+			err := rs.Flush(context.Background(), retryTestMetrics)
+			if test.succeeds {
+				assert.NoError(t, err)
+				assert.Equal(t, [][]samplers.InterMetric{retryTestMetrics}, sink.batches, "the batch should land exactly once")
+				assert.Equal(t, test.failures+1, sink.attempts)
+				assert.Empty(t, fallback.batches)
+			} else {
+				assert.Error(t, err)
+				assert.Empty(t, sink.batches)
+				assert.Equal(t, test.maxAttempts, sink.attempts)
+				assert.Equal(t, [][]samplers.InterMetric{retryTestMetrics}, fallback.batches, "the batch should be spilled to the fallback")
+			}
+		})
+	}
+}
+
+func TestRetryingSinkTimeout(t *testing.T) {
+	sink := &flakySink{name: "flaky", failures: 100}
+	rs := NewRetryingSink(sink, 100, 50*time.Millisecond, time.Second, 120*time.Millisecond, nil, logrus.New())
+
+	start := time.Now()
+	assert.Error(t, rs.Flush(context.Background(), retryTestMetrics))
+	assert.True(t, time.Since(start) < time.Second, "the timeout should stop retries")
+	assert.True(t, sink.attempts >= 2 && sink.attempts < 100, "unexpected number of attempts: %d", sink.attempts)
+}
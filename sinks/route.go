@@ -0,0 +1,54 @@
+package sinks
+
+import "github.com/stripe/veneur/samplers"
+
+// MetricRoute sends the metrics that pass its filter to a set of
+// destinations: metric sinks or plugins, by name. A filter without
+// any patterns matches every metric.
+type MetricRoute struct {
+	Filter       *MetricFilter
+	Destinations []string
+}
+
+// MetricRouter decides which destinations receive each metric. Routes
+// are evaluated in order, and a metric goes only to the destinations
+// of the first route that it matches. Metrics that match no route go
+// to the default destinations.
+type MetricRouter struct {
+	routes   []MetricRoute
+	defaults []string
+}
+
+// NewMetricRouter returns a router that evaluates the routes in order,
+// and sends the metrics that match none of them to the default
+// destinations.
+func NewMetricRouter(routes []MetricRoute, defaults []string) *MetricRouter {
+	return &MetricRouter{
+		routes:   routes,
+		defaults: defaults,
+	}
+}
+
+// Destinations returns the names of the destinations that receive the
+// metric.
+func (r *MetricRouter) Destinations(metric samplers.InterMetric) []string {
+	for _, route := range r.routes {
+		if route.Filter.Accept(metric) {
+			return route.Destinations
+		}
+	}
+	return r.defaults
+}
+
+// Route returns the metrics that each destination receives, by
+// destination name, in their original order. Destinations that don't
+// receive any metrics aren't in the map.
+func (r *MetricRouter) Route(metrics []samplers.InterMetric) map[string][]samplers.InterMetric {
+	routed := map[string][]samplers.InterMetric{}
+	for _, metric := range metrics {
+		for _, dest := range r.Destinations(metric) {
+			routed[dest] = append(routed[dest], metric)
+		}
+	}
+	return routed
+}
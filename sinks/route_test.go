@@ -0,0 +1,57 @@
+package sinks
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stripe/veneur/samplers"
+)
+
+func TestMetricRouter(t *testing.T) {
+	router := NewMetricRouter([]MetricRoute{
+		{NewMetricFilter([]string{"*.trace.*"}, nil, nil, nil), []string{"s3"}},
+		{NewMetricFilter([]string{"billing.*"}, nil, nil, nil), []string{"datadog", "kafka"}},
+		// overlaps the route above for billing metrics in prod:
+		{NewMetricFilter(nil, nil, []string{"env:prod"}, nil), []string{"kafka"}},
+		{NewMetricFilter([]string{"debug.*"}, nil, nil, nil), nil},
+	}, []string{"datadog"})
+
+	tests := []struct {
+		name   string
+		metric samplers.InterMetric
+		dests  []string
+	}{
+		{"first route", samplers.InterMetric{Name: "api.trace.duration"}, []string{"s3"}},
+		{"first of overlapping routes", samplers.InterMetric{Name: "billing.charges", Tags: []string{"env:prod"}}, []string{"datadog", "kafka"}},
+		{"later overlapping route", samplers.InterMetric{Name: "api.requests", Tags: []string{"env:prod"}}, []string{"kafka"}},
+		{"earlier route wins over tags", samplers.InterMetric{Name: "api.trace.spans", Tags: []string{"env:prod"}}, []string{"s3"}},
+		{"route without destinations", samplers.InterMetric{Name: "debug.allocs"}, nil},
+		{"default route", samplers.InterMetric{Name: "api.requests", Tags: []string{"env:dev"}}, []string{"datadog"}},
+	}
+	for _, elt := range tests {
+		test := elt
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, test.dests, router.Destinations(test.metric))
+		})
+	}
+}
+
+func TestMetricRouterRoute(t *testing.T) {
+	router := NewMetricRouter([]MetricRoute{
+		{NewMetricFilter([]string{"billing.*"}, nil, nil, nil), []string{"datadog", "kafka"}},
+		{NewMetricFilter([]string{"debug.*"}, nil, nil, nil), nil},
+	}, []string{"datadog"})
+
+	metrics := []samplers.InterMetric{
+		{Name: "api.requests"},
+		{Name: "billing.charges"},
+		{Name: "debug.allocs"},
+		{Name: "api.latency"},
+	}
+	routed := router.Route(metrics)
+	assert.Equal(t, map[string][]samplers.InterMetric{
+		"datadog": {metrics[0], metrics[1], metrics[3]},
+		"kafka":   {metrics[1]},
+	}, routed)
+}
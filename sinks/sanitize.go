@@ -0,0 +1,139 @@
+package sinks
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/stripe/veneur/samplers"
+)
+
+// Sanitizer rewrites the names and tags of metrics into a form that a
+// sink accepts. Sanitizers must be deterministic, and idempotent:
+// sanitizing a name or tag that was already sanitized must leave it
+// unchanged.
+type Sanitizer interface {
+	// SanitizeName returns the sanitized metric name.
+	SanitizeName(name string) string
+	// SanitizeTag returns the sanitized "key:value" (or "key") tag,
+	// and false if the tag should be dropped.
+	SanitizeTag(tag string) (string, bool)
+}
+
+// SanitizingSink is a MetricSink that has a Sanitizer of its own,
+// which it expects all the metrics flushed to it to have passed
+// through, unless another sanitizer is configured for it.
+type SanitizingSink interface {
+	MetricSink
+	Sanitizer() Sanitizer
+}
+
+// Sanitize returns copies of the metrics with their names and tags
+// sanitized. Only the metrics' tag slices are copied; the metrics
+// passed in, and their tags, are left untouched.
+func Sanitize(s Sanitizer, metrics []samplers.InterMetric) []samplers.InterMetric {
+	sanitized := make([]samplers.InterMetric, len(metrics))
+	for i, metric := range metrics {
+		metric.Name = s.SanitizeName(metric.Name)
+		tags := make([]string, 0, len(metric.Tags))
+		for _, tag := range metric.Tags {
+			if tag, ok := s.SanitizeTag(tag); ok {
+				tags = append(tags, tag)
+			}
+		}
+		metric.Tags = tags
+		sanitized[i] = metric
+	}
+	return sanitized
+}
+
+// SanitizeRules is a Sanitizer that applies a configurable set of
+// rules. Its zero value leaves names and tags unchanged.
+type SanitizeRules struct {
+	// Lowercase converts names and tags to lower case.
+	Lowercase bool
+	// Allowed reports whether a character may appear in names and in
+	// the keys and values of tags. Characters that aren't allowed are
+	// replaced with Replacement. If Allowed is nil, all characters are
+	// allowed.
+	Allowed func(r rune) bool
+	// Replacement replaces disallowed characters. It defaults to '_',
+	// and must itself be allowed.
+	Replacement rune
+	// CollapseSeparators replaces runs of the same separator ('.', '_'
+	// or '-') with a single one, and trims separators from the ends.
+	CollapseSeparators bool
+	// StripEmptyTags drops tags whose key is empty once sanitized.
+	StripEmptyTags bool
+}
+
+var _ Sanitizer = SanitizeRules{}
+
+// ASCIIAllowed allows the ASCII letters and digits, and '.', '_', '-'
+// and '/'.
+func ASCIIAllowed(r rune) bool {
+	return r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("._-/", r))
+}
+
+// SanitizeName applies the rules to a metric name.
+func (sr SanitizeRules) SanitizeName(name string) string {
+	return sr.sanitize(name)
+}
+
+// SanitizeTag applies the rules to the key and the value of a tag
+// separately, so that the colon between them is kept.
+func (sr SanitizeRules) SanitizeTag(tag string) (string, bool) {
+	key, value, hasValue := tag, "", false
+	if colon := strings.IndexByte(tag, ':'); colon >= 0 {
+		key, value, hasValue = tag[:colon], tag[colon+1:], true
+	}
+	key = sr.sanitize(key)
+	if key == "" && sr.StripEmptyTags {
+		return "", false
+	}
+	if !hasValue {
+		return key, true
+	}
+	return key + ":" + sr.sanitize(value), true
+}
+
+func (sr SanitizeRules) sanitize(s string) string {
+	replacement := sr.Replacement
+	if replacement == 0 {
+		replacement = '_'
+	}
+	var b strings.Builder
+	b.Grow(len(s))
+	var last rune
+	for _, r := range s {
+		if sr.Lowercase {
+			r = unicode.ToLower(r)
+		}
+		if sr.Allowed != nil && !sr.Allowed(r) {
+			r = replacement
+		}
+		if sr.CollapseSeparators && isSeparator(r) && (r == last || b.Len() == 0) {
+			continue
+		}
+		b.WriteRune(r)
+		last = r
+	}
+	out := b.String()
+	if sr.CollapseSeparators {
+		out = strings.TrimRightFunc(out, isSeparator)
+	}
+	return out
+}
+
+func isSeparator(r rune) bool {
+	return r == '.' || r == '_' || r == '-'
+}
+
+// LenientSanitizer only strips tags with an empty key, and replaces
+// whitespace and control characters, which no sink accepts, with
+// underscores. Other characters are left alone.
+var LenientSanitizer Sanitizer = SanitizeRules{
+	Allowed: func(r rune) bool {
+		return !unicode.IsSpace(r) && !unicode.IsControl(r)
+	},
+	StripEmptyTags: true,
+}
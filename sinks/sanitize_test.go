@@ -0,0 +1,100 @@
+package sinks
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stripe/veneur/samplers"
+)
+
+// assertIdempotent checks that sanitizing the sanitized name and tag
+// again leaves them unchanged.
+func assertIdempotent(t *testing.T, s Sanitizer, name, tag string) {
+	assert.Equal(t, name, s.SanitizeName(name), "sanitizing name %q again", name)
+	again, ok := s.SanitizeTag(tag)
+	assert.True(t, ok, "sanitizing tag %q again", tag)
+	assert.Equal(t, tag, again, "sanitizing tag %q again", tag)
+}
+
+func TestSanitizeRules(t *testing.T) {
+	strict := SanitizeRules{
+		Lowercase:          true,
+		Allowed:            ASCIIAllowed,
+		CollapseSeparators: true,
+		StripEmptyTags:     true,
+	}
+	tests := []struct {
+		in, name, tag string
+	}{
+		{"API.Requests", "api.requests", "api.requests"},
+		{"héllo wörld", "h_llo_w_rld", "h_llo_w_rld"},
+		{"日本語", "", ""},
+		{"9lives", "9lives", "9lives"},
+		{"  leading and trailing  ", "leading_and_trailing", "leading_and_trailing"},
+		{"a..b__c--d", "a.b_c-d", "a.b_c-d"},
+		{"a._-b", "a._-b", "a._-b"},
+		{"path/to:thing", "path/to_thing", "path/to:thing"},
+		{"ÉCOLE", "cole", "cole"},
+	}
+	for _, tt := range tests {
+		name := strict.SanitizeName(tt.in)
+		assert.Equal(t, tt.name, name, "name %q", tt.in)
+		tag, ok := strict.SanitizeTag(tt.in)
+		if tt.tag == "" {
+			assert.False(t, ok, "tag %q should be stripped", tt.in)
+			continue
+		}
+		assert.True(t, ok, "tag %q", tt.in)
+		assert.Equal(t, tt.tag, tag, "tag %q", tt.in)
+		assertIdempotent(t, strict, name, tag)
+	}
+
+	tag, ok := strict.SanitizeTag("User ID:Jane Doe")
+	assert.True(t, ok)
+	assert.Equal(t, "user_id:jane_doe", tag)
+	tag, ok = strict.SanitizeTag("env:")
+	assert.True(t, ok, "tags with an empty value are kept")
+	assert.Equal(t, "env:", tag)
+	_, ok = strict.SanitizeTag(":value")
+	assert.False(t, ok, "tags with an empty key are stripped")
+
+	var none SanitizeRules
+	assert.Equal(t, "Héllo World", none.SanitizeName("Héllo World"))
+	tag, ok = none.SanitizeTag(":x")
+	assert.True(t, ok)
+	assert.Equal(t, ":x", tag)
+}
+
+func TestLenientSanitizer(t *testing.T) {
+	tests := map[string]string{
+		"api.requests":    "api.requests",
+		"héllo wörld":     "héllo_wörld",
+		"9lives":          "9lives",
+		"tab\there":       "tab_here",
+		"new\nline":       "new_line",
+		"日本語":             "日本語",
+		"Mixed-Case/Path": "Mixed-Case/Path",
+	}
+	for in, out := range tests {
+		assert.Equal(t, out, LenientSanitizer.SanitizeName(in), "name %q", in)
+		assertIdempotent(t, LenientSanitizer, out, out)
+	}
+
+	tag, ok := LenientSanitizer.SanitizeTag("user id:Jane Doe")
+	assert.True(t, ok)
+	assert.Equal(t, "user_id:Jane_Doe", tag)
+	_, ok = LenientSanitizer.SanitizeTag("")
+	assert.False(t, ok)
+}
+
+func TestSanitizeCopies(t *testing.T) {
+	s := SanitizeRules{Lowercase: true, StripEmptyTags: true}
+	tags := []string{"Env:Prod", ":empty"}
+	metrics := []samplers.InterMetric{{Name: "A.B", Tags: tags}}
+
+	sanitized := Sanitize(s, metrics)
+	assert.Equal(t, "a.b", sanitized[0].Name)
+	assert.Equal(t, []string{"env:prod"}, sanitized[0].Tags)
+	assert.Equal(t, "A.B", metrics[0].Name)
+	assert.Equal(t, []string{"Env:Prod", ":empty"}, tags)
+}
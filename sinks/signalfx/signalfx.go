@@ -13,6 +13,7 @@ import (
 	"github.com/signalfx/golib/event"
 	"github.com/signalfx/golib/sfxclient"
 	"github.com/sirupsen/logrus"
+	vhttp "github.com/stripe/veneur/http"
 	"github.com/stripe/veneur/protocol/dogstatsd"
 	"github.com/stripe/veneur/samplers"
 	"github.com/stripe/veneur/sinks"
@@ -99,14 +100,30 @@ type SignalFxSink struct {
 type DPClient dpsink.Sink
 
 // NewClient constructs a new signalfx HTTP client for the given
-// endpoint and API token.
+// endpoint and API token, that gzips large bodies.
 func NewClient(endpoint, apiKey string, client *http.Client) DPClient {
+	dpClient, _ := NewCompressedClient(endpoint, apiKey, client, vhttp.CompressionGzip)
+	return dpClient
+}
+
+// NewCompressedClient is NewClient with a choice of compression. The
+// signalfx client only compresses with gzip, and leaves bodies that
+// fit into a single packet uncompressed, so compression must be
+// vhttp.CompressionGzip or vhttp.CompressionNone.
+func NewCompressedClient(endpoint, apiKey string, client *http.Client, compression vhttp.Compression) (DPClient, error) {
 	httpSink := sfxclient.NewHTTPSink()
 	httpSink.AuthToken = apiKey
 	httpSink.DatapointEndpoint = fmt.Sprintf("%s/v2/datapoint", endpoint)
 	httpSink.EventEndpoint = fmt.Sprintf("%s/v2/event", endpoint)
 	httpSink.Client = client
-	return httpSink
+	switch compression {
+	case vhttp.CompressionGzip:
+	case vhttp.CompressionNone:
+		httpSink.DisableCompression = true
+	default:
+		return nil, fmt.Errorf("the signalfx sink can't compress with %q, only with %q or %q", compression, vhttp.CompressionGzip, vhttp.CompressionNone)
+	}
+	return httpSink, nil
 }
 
 // NewSignalFxSink creates a new SignalFx sink for metrics.
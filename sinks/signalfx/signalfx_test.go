@@ -2,7 +2,10 @@ package signalfx
 
 import (
 	"context"
+	"io"
+	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
 	"sort"
 	"strconv"
 	"testing"
@@ -13,6 +16,8 @@ import (
 	"github.com/signalfx/golib/sfxclient"
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	vhttp "github.com/stripe/veneur/http"
 	"github.com/stripe/veneur/protocol/dogstatsd"
 	"github.com/stripe/veneur/samplers"
 	"github.com/stripe/veneur/ssf"
@@ -80,6 +85,35 @@ func TestNewSignalFxSink(t *testing.T) {
 	assert.Equal(t, map[string]string{"yay": "pie"}, sink.commonDimensions)
 }
 
+func TestSignalFxClientCompression(t *testing.T) {
+	encodings := make(chan string, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encodings <- r.Header.Get("Content-Encoding")
+		io.Copy(ioutil.Discard, r.Body)
+		w.Write([]byte(`"OK"`))
+	}))
+	defer srv.Close()
+
+	// the client only compresses bodies that are too large for a
+	// single packet:
+	points := make([]*datapoint.Datapoint, 100)
+	for i := range points {
+		points[i] = datapoint.New("a.b.c."+strconv.Itoa(i), map[string]string{"host": "example"}, datapoint.NewIntValue(1), datapoint.Gauge, time.Now())
+	}
+	for compression, want := range map[vhttp.Compression]string{
+		vhttp.CompressionGzip: "gzip",
+		vhttp.CompressionNone: "",
+	} {
+		client, err := NewCompressedClient(srv.URL, "secret", srv.Client(), compression)
+		require.NoError(t, err)
+		require.NoError(t, client.AddDatapoints(context.Background(), points))
+		assert.Equal(t, want, <-encodings, "compression %s", compression)
+	}
+
+	_, err := NewCompressedClient(srv.URL, "secret", srv.Client(), vhttp.CompressionDeflate)
+	assert.Error(t, err, "the signalfx client can't deflate")
+}
+
 func TestSignalFxFlushRouting(t *testing.T) {
 	fakeSink := NewFakeSink()
 	derived := newDerivedProcessor()
@@ -23,6 +23,20 @@ const MetricKeyTotalMetricsFlushed = "sink.metrics_flushed_total"
 // skipped, not applicable to this MetricSink.
 const MetricKeyTotalMetricsSkipped = "sink.metrics_skipped_total"
 
+// MetricKeySinkFlushDuration is emitted as a timer by veneur around
+// each metric sink's Flush, tagged with `sink:sink.Name()`. Unlike
+// MetricKeyMetricFlushDuration, sinks don't have to emit it themselves.
+const MetricKeySinkFlushDuration = "sink.flush_duration_ns"
+
+// MetricKeySinkMetricsFlushed is emitted as a counter by veneur for
+// the metrics that it passes to each metric sink's Flush, tagged with
+// `sink:sink.Name()` and `metric_type`.
+const MetricKeySinkMetricsFlushed = "sink.metrics_flushed"
+
+// MetricKeySinkFlushErrors is emitted as a counter by veneur when a
+// metric sink's Flush returns an error, tagged with `sink:sink.Name()`.
+const MetricKeySinkFlushErrors = "sink.flush_errors_total"
+
 // EventReportedCount number of events processed by a sink. Tagged with
 // `sink:sink.Name()`.
 const EventReportedCount = "sink.events_reported_total"
@@ -46,6 +60,26 @@ type MetricSink interface {
 	FlushOtherSamples(ctx context.Context, samples []ssf.SSFSample)
 }
 
+// Stopper is an optional interface for metric and span sinks that run
+// goroutines or hold data between their flushes. When a reload of the
+// configuration replaces the sinks, the replaced ones that implement
+// Stopper are stopped after their last flush.
+type Stopper interface {
+	// Stop sends the data that the sink still holds, and stops its
+	// background work. It returns an error if some of the data
+	// couldn't be sent. Metrics or spans that reach the sink later
+	// may be sent right away or dropped, but must not block.
+	Stop() error
+}
+
+// Stop stops sink, if it is a Stopper.
+func Stop(sink interface{}) error {
+	if st, ok := sink.(Stopper); ok {
+		return st.Stop()
+	}
+	return nil
+}
+
 // IsAcceptableMetric returns true if a metric is meant to be ingested
 // by a given sink.
 func IsAcceptableMetric(metric samplers.InterMetric, sink MetricSink) bool {
@@ -0,0 +1,311 @@
+package sinks
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stripe/veneur/samplers"
+	"github.com/stripe/veneur/ssf"
+	"github.com/stripe/veneur/trace"
+)
+
+// MetricKeySpillReplayed is emitted as a counter by SpillingSink with
+// the number of spilled metrics that it flushed to the wrapped sink
+// once it recovered. Tagged with `sink:sink.Name()`.
+const MetricKeySpillReplayed = "sink.spill_metrics_replayed_total"
+
+// MetricKeySpillEvicted is emitted as a counter by SpillingSink with
+// the number of spilled metrics that it deleted to stay within its
+// disk cap. Tagged with `sink:sink.Name()`.
+const MetricKeySpillEvicted = "sink.spill_metrics_evicted_total"
+
+// MetricKeySpillBytes is emitted as a gauge by SpillingSink on each
+// flush, with the size of the batches in its spill directory. Tagged
+// with `sink:sink.Name()`.
+const MetricKeySpillBytes = "sink.spill_bytes"
+
+// DefaultSpillMaxBytes is the size that a SpillingSink's batches may
+// take up on disk, if no other cap is configured.
+const DefaultSpillMaxBytes = 100 << 20
+
+// spillSuffix is the suffix of spilled batch files. Batches that are
+// still being written have a different one, so that they are never
+// replayed half-written.
+const spillSuffix = ".json.gz"
+
+type spilledBatch struct {
+	path    string
+	size    int64
+	metrics int
+}
+
+// SpillingSink is a MetricSink that wraps another, and writes the
+// batches that the wrapped sink fails to flush to a directory. On
+// each flush, it first replays the spilled batches, oldest first, and
+// only flushes the new batch once they are all delivered. Batches stay
+// on disk until the wrapped sink accepted them, and are picked up
+// again if Veneur restarts.
+//
+// The spilled batches are capped at a total size; once they exceed
+// it, the oldest are deleted. Replaying a batch that the wrapped sink
+// delivered in part, like a RetryingSink, delivers that part twice.
+// Only one SpillingSink should use a directory at a time.
+type SpillingSink struct {
+	sink     MetricSink
+	dir      string
+	maxBytes int64
+
+	// mtx serializes flushes, so that batches are replayed in order
+	// and only once.
+	mtx     sync.Mutex
+	batches []spilledBatch
+	bytes   int64
+	seq     int64
+
+	traceClient *trace.Client
+	log         *logrus.Logger
+}
+
+var _ MetricSink = &SpillingSink{}
+var _ HealthChecker = &SpillingSink{}
+var _ Stopper = &SpillingSink{}
+
+// NewSpillingSink wraps sink so that the batches it fails to flush are
+// spilled to dir, which is created if it doesn't exist, up to maxBytes
+// in total. Batches that an earlier SpillingSink left in dir are
+// replayed too.
+func NewSpillingSink(sink MetricSink, dir string, maxBytes int64, log *logrus.Logger) (*SpillingSink, error) {
+	if maxBytes <= 0 {
+		maxBytes = DefaultSpillMaxBytes
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	s := &SpillingSink{
+		sink:     sink,
+		dir:      dir,
+		maxBytes: maxBytes,
+		log:      log,
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, fi := range files {
+		seq, metrics, ok := parseSpillName(fi.Name())
+		if !ok {
+			continue
+		}
+		s.batches = append(s.batches, spilledBatch{
+			path:    filepath.Join(dir, fi.Name()),
+			size:    fi.Size(),
+			metrics: metrics,
+		})
+		s.bytes += fi.Size()
+		if seq > s.seq {
+			s.seq = seq
+		}
+	}
+	sort.Slice(s.batches, func(i, j int) bool { return s.batches[i].path < s.batches[j].path })
+	return s, nil
+}
+
+// parseSpillName returns the sequence number and the number of metrics
+// of a spilled batch file, named "<sequence>-<metrics>.json.gz".
+func parseSpillName(name string) (seq int64, metrics int, ok bool) {
+	if !strings.HasSuffix(name, spillSuffix) {
+		return 0, 0, false
+	}
+	parts := strings.SplitN(strings.TrimSuffix(name, spillSuffix), "-", 2)
+	if len(parts) != 2 {
+		return 0, 0, false
+	}
+	seq, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	metrics, err = strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, 0, false
+	}
+	return seq, metrics, true
+}
+
+// Name returns the name of the wrapped sink, so that metrics routed
+// to it still reach it.
+func (s *SpillingSink) Name() string {
+	return s.sink.Name()
+}
+
+// Start starts the wrapped sink.
+func (s *SpillingSink) Start(cl *trace.Client) error {
+	s.traceClient = cl
+	return s.sink.Start(cl)
+}
+
+// Flush replays the spilled batches, and then flushes the metrics to
+// the wrapped sink. If replaying or flushing fails, it spills the
+// metrics, and returns the error.
+func (s *SpillingSink) Flush(ctx context.Context, metrics []samplers.InterMetric) error {
+	span, _ := trace.StartSpanFromContext(ctx, "")
+	defer span.ClientFinish(s.traceClient)
+	tags := map[string]string{"sink": s.Name()}
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	replayed, err := s.replay(ctx)
+	if replayed > 0 {
+		span.Add(ssf.Count(MetricKeySpillReplayed, float32(replayed), tags))
+	}
+	if err == nil {
+		err = s.sink.Flush(ctx, metrics)
+	}
+	if err != nil {
+		span.Error(err)
+		evicted, spillErr := s.spill(metrics)
+		if spillErr != nil {
+			s.log.WithError(spillErr).WithField("sink", s.Name()).Error("Error spilling metrics to disk")
+		} else {
+			span.Add(ssf.Count(MetricKeyTotalMetricsSpilled, float32(len(metrics)), map[string]string{
+				"sink":     s.Name(),
+				"fallback": "disk",
+			}))
+		}
+		if evicted > 0 {
+			span.Add(ssf.Count(MetricKeySpillEvicted, float32(evicted), tags))
+			s.log.WithFields(logrus.Fields{
+				"sink":    s.Name(),
+				"metrics": evicted,
+			}).Warn("Spill directory is full, deleted the oldest metrics")
+		}
+	}
+	span.Add(ssf.Gauge(MetricKeySpillBytes, float32(s.bytes), tags))
+	return err
+}
+
+// replay flushes the spilled batches to the wrapped sink, oldest first,
+// deleting each once it is flushed. It stops at the first error, and
+// returns the number of metrics flushed.
+func (s *SpillingSink) replay(ctx context.Context) (int, error) {
+	replayed := 0
+	for len(s.batches) > 0 {
+		batch := s.batches[0]
+		metrics, err := readSpilledBatch(batch.path)
+		if err != nil {
+			// A batch that can't be read will never be; drop it
+			// rather than stall the sink forever.
+			s.log.WithError(err).WithField("sink", s.Name()).Error("Dropping unreadable spilled batch")
+		} else if err := s.sink.Flush(ctx, metrics); err != nil {
+			return replayed, err
+		} else {
+			replayed += len(metrics)
+		}
+		s.remove(0)
+	}
+	return replayed, nil
+}
+
+// spill writes the metrics to a new file in the spill directory, and
+// then deletes the oldest batches until they fit within the cap. It
+// returns the number of metrics deleted.
+func (s *SpillingSink) spill(metrics []samplers.InterMetric) (int, error) {
+	s.seq++
+	name := fmt.Sprintf("%020d-%d%s", s.seq, len(metrics), spillSuffix)
+	path := filepath.Join(s.dir, name)
+	size, err := writeSpilledBatch(path, metrics)
+	if err != nil {
+		return 0, err
+	}
+	s.batches = append(s.batches, spilledBatch{path: path, size: size, metrics: len(metrics)})
+	s.bytes += size
+
+	evicted := 0
+	for s.bytes > s.maxBytes && len(s.batches) > 0 {
+		evicted += s.batches[0].metrics
+		s.remove(0)
+	}
+	return evicted, nil
+}
+
+func (s *SpillingSink) remove(i int) {
+	batch := s.batches[i]
+	if err := os.Remove(batch.path); err != nil && !os.IsNotExist(err) {
+		s.log.WithError(err).WithField("path", batch.path).Error("Error deleting spilled batch")
+	}
+	s.bytes -= batch.size
+	s.batches = append(s.batches[:i], s.batches[i+1:]...)
+}
+
+func writeSpilledBatch(path string, metrics []samplers.InterMetric) (int64, error) {
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return 0, err
+	}
+	gz := gzip.NewWriter(f)
+	err = json.NewEncoder(gz).Encode(metrics)
+	if closeErr := gz.Close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return 0, err
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+	return fi.Size(), nil
+}
+
+func readSpilledBatch(path string) ([]samplers.InterMetric, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	var metrics []samplers.InterMetric
+	err = json.NewDecoder(gz).Decode(&metrics)
+	return metrics, err
+}
+
+// Stop stops the wrapped sink, if it needs to be stopped. Spilled
+// batches stay on disk, for the next SpillingSink of the directory to
+// replay.
+func (s *SpillingSink) Stop() error {
+	return Stop(s.sink)
+}
+
+// Healthy returns the health of the wrapped sink, if it can tell.
+func (s *SpillingSink) Healthy() error {
+	if hc, ok := s.sink.(HealthChecker); ok {
+		return hc.Healthy()
+	}
+	return nil
+}
+
+// FlushOtherSamples passes the samples to the wrapped sink directly.
+func (s *SpillingSink) FlushOtherSamples(ctx context.Context, samples []ssf.SSFSample) {
+	s.sink.FlushOtherSamples(ctx, samples)
+}
@@ -0,0 +1,103 @@
+package sinks
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stripe/veneur/samplers"
+)
+
+func spillTestBatch(i int) []samplers.InterMetric {
+	return []samplers.InterMetric{
+		{Name: "a.b.c", Value: float64(i), Timestamp: int64(i), Tags: []string{"batch:" + fmt.Sprint(i)}, Type: samplers.CounterMetric},
+		{Name: "a.b.d", Value: float64(i) / 3, Timestamp: int64(i), Type: samplers.GaugeMetric},
+	}
+}
+
+func spilledFiles(t *testing.T, dir string) int {
+	files, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	return len(files)
+}
+
+func TestSpillingSinkReplays(t *testing.T) {
+	dir, err := ioutil.TempDir("", "veneur-spill")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// The sink is down for the first three flushes: the first fails
+	// the batch itself, the next two fail replaying it.
+	flaky := &flakySink{name: "flaky", failures: 3}
+	spilling, err := NewSpillingSink(flaky, dir, 0, logrus.New())
+	require.NoError(t, err)
+
+	for i := 1; i <= 3; i++ {
+		assert.Error(t, spilling.Flush(context.Background(), spillTestBatch(i)))
+		assert.Equal(t, i, spilledFiles(t, dir))
+	}
+	assert.Empty(t, flaky.batches)
+
+	require.NoError(t, spilling.Flush(context.Background(), spillTestBatch(4)))
+	assert.Equal(t, [][]samplers.InterMetric{
+		spillTestBatch(1), spillTestBatch(2), spillTestBatch(3), spillTestBatch(4),
+	}, flaky.batches, "all batches should be delivered once, in order")
+	assert.Equal(t, 0, spilledFiles(t, dir))
+
+	require.NoError(t, spilling.Flush(context.Background(), spillTestBatch(5)))
+	assert.Len(t, flaky.batches, 5, "replayed batches must not be replayed again")
+}
+
+func TestSpillingSinkReplaysAfterRestart(t *testing.T) {
+	dir, err := ioutil.TempDir("", "veneur-spill")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	down := &flakySink{name: "flaky", failures: 2}
+	spilling, err := NewSpillingSink(down, dir, 0, logrus.New())
+	require.NoError(t, err)
+	assert.Error(t, spilling.Flush(context.Background(), spillTestBatch(1)))
+	assert.Error(t, spilling.Flush(context.Background(), spillTestBatch(2)))
+
+	up := &flakySink{name: "flaky"}
+	restarted, err := NewSpillingSink(up, dir, 0, logrus.New())
+	require.NoError(t, err)
+	require.NoError(t, restarted.Flush(context.Background(), spillTestBatch(3)))
+	assert.Equal(t, [][]samplers.InterMetric{
+		spillTestBatch(1), spillTestBatch(2), spillTestBatch(3),
+	}, up.batches)
+	assert.Equal(t, 0, spilledFiles(t, dir))
+}
+
+func TestSpillingSinkEvictsOldest(t *testing.T) {
+	dir, err := ioutil.TempDir("", "veneur-spill")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// Find out how big a batch is on disk, and allow for two:
+	probe, err := NewSpillingSink(&flakySink{name: "probe", failures: 1}, dir, 0, logrus.New())
+	require.NoError(t, err)
+	probe.Flush(context.Background(), spillTestBatch(0))
+	require.Len(t, probe.batches, 1)
+	size := probe.batches[0].size
+	os.Remove(probe.batches[0].path)
+
+	flaky := &flakySink{name: "flaky", failures: 4}
+	spilling, err := NewSpillingSink(flaky, dir, 2*size+size/2, logrus.New())
+	require.NoError(t, err)
+	for i := 1; i <= 4; i++ {
+		assert.Error(t, spilling.Flush(context.Background(), spillTestBatch(i)))
+	}
+	assert.Equal(t, 2, spilledFiles(t, dir))
+	assert.True(t, spilling.bytes <= 2*size+size/2)
+
+	require.NoError(t, spilling.Flush(context.Background(), spillTestBatch(5)))
+	assert.Equal(t, [][]samplers.InterMetric{
+		spillTestBatch(3), spillTestBatch(4), spillTestBatch(5),
+	}, flaky.batches, "the oldest batches should be evicted")
+}
@@ -34,7 +34,7 @@ type TestableSplunkSpanSink interface {
 
 	// Stop shuts down the sink's submission workers by finishing
 	// each worker's last submission HTTP request.
-	Stop()
+	Stop() error
 
 	// Sync instructs all submission workers to finish submitting
 	// their current request and start a new one. It returns when
@@ -68,6 +68,8 @@ type splunkSpanSink struct {
 	connLifetimeJitter time.Duration
 	rand               *mrand.Rand
 
+	stopOnce sync.Once
+
 	// these fields are for testing only:
 
 	// sync holds one channel per submission worker.
@@ -80,6 +82,7 @@ type splunkSpanSink struct {
 
 var _ sinks.SpanSink = &splunkSpanSink{}
 var _ TestableSplunkSpanSink = &splunkSpanSink{}
+var _ sinks.Stopper = &splunkSpanSink{}
 
 // NewSplunkSpanSink constructs a new splunk span sink from the server
 // name and token provided, using the local hostname configured for
@@ -163,10 +166,15 @@ func (sss *splunkSpanSink) Start(cl *trace.Client) error {
 	return nil
 }
 
-func (sss *splunkSpanSink) Stop() {
-	for _, signal := range sss.sync {
-		close(signal)
-	}
+// Stop shuts down the submission workers, once. Each of them finishes
+// its last submission HTTP request first.
+func (sss *splunkSpanSink) Stop() error {
+	sss.stopOnce.Do(func() {
+		for _, signal := range sss.sync {
+			close(signal)
+		}
+	})
+	return nil
 }
 
 func (sss *splunkSpanSink) Sync() {
@@ -16,7 +16,9 @@ import (
 // metricExtractionSink enqueues ssf spans or udp metrics for processing in the next pipeline iteration.
 type metricExtractionSink struct {
 	workers                []Processor
+	events                 EventProcessor
 	indicatorSpanTimerName string
+	rules                  *SpanMetricRules
 	log                    *logrus.Logger
 	traceClient            *trace.Client
 	spansProcessed         int64
@@ -31,22 +33,47 @@ type Processor interface {
 	IngestUDP(samplers.UDPMetric)
 }
 
+// EventProcessor represents a thing that can process events.
+type EventProcessor interface {
+	// IngestEvent takes a single event and processes it.
+	IngestEvent(ssf.SSFSample)
+}
+
 // DerivedMetricsSink composes the functionality of a SpanSink and DerivedMetricsProcessor
 type DerivedMetricsSink interface {
 	sinks.SpanSink
 	samplers.DerivedMetricsProcessor
 }
 
+// ExtractionOption is a functional option for the sink that
+// NewMetricExtractionSink creates.
+type ExtractionOption func(*metricExtractionSink)
+
+// WithSpanMetricRules makes the sink extract metrics from trace spans
+// according to rules, in addition to the indicator span timer.
+func WithSpanMetricRules(rules *SpanMetricRules) ExtractionOption {
+	return func(m *metricExtractionSink) {
+		m.rules = rules
+	}
+}
+
 // NewMetricExtractionSink sets up and creates a span sink that
 // extracts metrics ("samples") from SSF spans and reports them to a
-// veneur's metrics workers.
-func NewMetricExtractionSink(mw []Processor, timerName string, cl *trace.Client, log *logrus.Logger) (DerivedMetricsSink, error) {
-	return &metricExtractionSink{
+// veneur's metrics workers. Events contained in SSF spans are
+// reported to the event processor ep; if ep is nil, they are
+// discarded.
+func NewMetricExtractionSink(mw []Processor, ep EventProcessor, timerName string, cl *trace.Client, log *logrus.Logger, opts ...ExtractionOption) (DerivedMetricsSink, error) {
+	sink := &metricExtractionSink{
 		workers:                mw,
+		events:                 ep,
 		indicatorSpanTimerName: timerName,
 		traceClient:            cl,
 		log:                    log,
-	}, nil
+	}
+	for _, opt := range opts {
+		opt(sink)
+	}
+	return sink, nil
 }
 
 // Name returns "metric_extraction".
@@ -107,6 +134,22 @@ func (m *metricExtractionSink) Ingest(span *ssf.SSFSpan) error {
 	metricsCount += len(metrics)
 	m.sendMetrics(metrics)
 
+	if m.events != nil {
+		events, err := samplers.ConvertEvents(span)
+		if err != nil {
+			m.log.WithError(err).
+				Warn("Could not parse events from SSF Message")
+			m.SendSample(ssf.Count("ssf.error_total", 1, map[string]string{
+				"packet_type": "ssf_event",
+				"step":        "extract_events",
+				"reason":      "invalid_events",
+			}))
+		}
+		for _, event := range events {
+			m.events.IngestEvent(event)
+		}
+	}
+
 	if err := protocol.ValidateTrace(span); err != nil {
 		return err
 	}
@@ -131,10 +174,40 @@ func (m *metricExtractionSink) Ingest(span *ssf.SSFSpan) error {
 	}
 	metricsCount += len(spanMetrics)
 
-	m.sendMetrics(append(indicatorMetrics, spanMetrics...))
+	ruleMetrics, err := m.extractRuleMetrics(span)
+	if err != nil {
+		m.log.WithError(err).
+			WithField("span_name", span.Name).
+			Warn("Couldn't extract metrics for span from rules")
+		return err
+	}
+	metricsCount += len(ruleMetrics)
+
+	m.sendMetrics(append(append(indicatorMetrics, spanMetrics...), ruleMetrics...))
 	return nil
 }
 
+// extractRuleMetrics returns the metrics that the sink's span metric
+// rules extract from span.
+func (m *metricExtractionSink) extractRuleMetrics(span *ssf.SSFSpan) ([]samplers.UDPMetric, error) {
+	if m.rules == nil {
+		return nil, nil
+	}
+	samples, err := m.rules.Extract(span)
+	if err != nil {
+		return nil, err
+	}
+	metrics := make([]samplers.UDPMetric, 0, len(samples))
+	for _, sample := range samples {
+		metric, err := samplers.ParseMetricSSF(sample)
+		if err != nil {
+			return nil, err
+		}
+		metrics = append(metrics, metric)
+	}
+	return metrics, nil
+}
+
 func (m *metricExtractionSink) Flush() {
 	tags := map[string]string{"sink": m.Name()}
 	metrics.ReportBatch(m.traceClient, []*ssf.SSFSample{
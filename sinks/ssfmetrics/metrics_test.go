@@ -8,6 +8,8 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/stripe/veneur"
+	"github.com/stripe/veneur/protocol"
+	"github.com/stripe/veneur/samplers"
 	"github.com/stripe/veneur/sinks"
 	"github.com/stripe/veneur/sinks/ssfmetrics"
 	"github.com/stripe/veneur/ssf"
@@ -15,9 +17,9 @@ import (
 
 func TestMetricExtractor(t *testing.T) {
 	logger := logrus.StandardLogger()
-	worker := veneur.NewWorker(0, nil, logger, nil)
+	worker := veneur.NewWorker(0, nil, logger, nil, nil, 0)
 	workers := []ssfmetrics.Processor{worker}
-	sink, err := ssfmetrics.NewMetricExtractionSink(workers, "foo", nil, logger)
+	sink, err := ssfmetrics.NewMetricExtractionSink(workers, nil, "foo", nil, logger)
 	require.NoError(t, err)
 
 	start := time.Now()
@@ -53,11 +55,56 @@ func TestMetricExtractor(t *testing.T) {
 	assert.Equal(t, 2, <-done, "Should have sent the right number of metrics")
 }
 
+type eventCollector struct {
+	events []ssf.SSFSample
+}
+
+func (ec *eventCollector) IngestEvent(event ssf.SSFSample) {
+	ec.events = append(ec.events, event)
+}
+
+func TestEventExtractor(t *testing.T) {
+	logger := logrus.StandardLogger()
+	worker := veneur.NewWorker(0, nil, logger, nil, nil, 0)
+	workers := []ssfmetrics.Processor{worker}
+	events := &eventCollector{}
+	sink, err := ssfmetrics.NewMetricExtractionSink(workers, events, "foo", nil, logger)
+	require.NoError(t, err)
+
+	then := time.Unix(1500000000, 0)
+	span := &ssf.SSFSpan{
+		Metrics: []*ssf.SSFSample{
+			ssf.Count("some.counter", 1, map[string]string{"purpose": "testing"}),
+			ssf.Event("deploy", "deployed the thing", map[string]string{"purpose": "testing"},
+				ssf.Timestamp(then), ssf.AlertType("success")),
+		},
+	}
+	err = sink.Ingest(span)
+	_, isNoTrace := err.(*protocol.InvalidTrace)
+	assert.True(t, isNoTrace, "a span only carrying samples is not a valid trace span")
+	close(worker.PacketChan)
+
+	n := 0
+	for m := range worker.PacketChan {
+		assert.Equal(t, "some.counter", m.Name, "events should not be processed as metrics")
+		n++
+	}
+	assert.Equal(t, 1, n)
+
+	require.Len(t, events.events, 1)
+	event := events.events[0]
+	assert.Equal(t, "deploy", event.Name)
+	assert.Equal(t, "deployed the thing", event.Message)
+	assert.Equal(t, then.Unix(), event.Timestamp)
+	assert.True(t, event.IsEvent())
+	assert.Equal(t, "testing", event.Tags["purpose"])
+}
+
 func setupBench() (*ssf.SSFSpan, sinks.SpanSink) {
 	logger := logrus.StandardLogger()
-	worker := veneur.NewWorker(0, nil, logger, nil)
+	worker := veneur.NewWorker(0, nil, logger, nil, nil, 0)
 	workers := []ssfmetrics.Processor{worker}
-	sink, err := ssfmetrics.NewMetricExtractionSink(workers, "foo", nil, logger)
+	sink, err := ssfmetrics.NewMetricExtractionSink(workers, nil, "foo", nil, logger)
 	if err != nil {
 		panic(err)
 	}
@@ -107,9 +154,9 @@ func BenchmarkParallelMetricExtractor(b *testing.B) {
 
 func TestIndicatorMetricExtractor(t *testing.T) {
 	logger := logrus.StandardLogger()
-	worker := veneur.NewWorker(0, nil, logger, nil)
+	worker := veneur.NewWorker(0, nil, logger, nil, nil, 0)
 	workers := []ssfmetrics.Processor{worker}
-	sink, err := ssfmetrics.NewMetricExtractionSink(workers, "foo", nil, logger)
+	sink, err := ssfmetrics.NewMetricExtractionSink(workers, nil, "foo", nil, logger)
 	require.NoError(t, err)
 
 	start := time.Now()
@@ -138,3 +185,79 @@ func TestIndicatorMetricExtractor(t *testing.T) {
 	close(worker.PacketChan)
 	assert.Equal(t, 1, <-done, "Should have sent the right number of metrics")
 }
+
+func TestSpanMetricRules(t *testing.T) {
+	rules, err := ssfmetrics.NewSpanMetricRules([]ssfmetrics.SpanMetricRule{
+		{
+			Name: "{{.Service}}.{{.Tags.endpoint}}.duration",
+			Type: "histogram",
+			Unit: "ms",
+			Tags: []string{"endpoint", "error", "missing"},
+		},
+		{
+			Name:  "{{.Service}}.errors",
+			Type:  "counter",
+			Tags:  []string{"name"},
+			Match: map[string]string{"error": "true"},
+		},
+	})
+	require.NoError(t, err)
+
+	logger := logrus.StandardLogger()
+	worker := veneur.NewWorker(0, nil, logger, nil, nil, 0)
+	workers := []ssfmetrics.Processor{worker}
+	sink, err := ssfmetrics.NewMetricExtractionSink(workers, nil, "", nil, logger, ssfmetrics.WithSpanMetricRules(rules))
+	require.NoError(t, err)
+
+	start := time.Now()
+	span := &ssf.SSFSpan{
+		Id:             5,
+		TraceId:        5,
+		Service:        "farm",
+		Name:           "harvest",
+		StartTimestamp: start.UnixNano(),
+		EndTimestamp:   start.Add(1500 * time.Millisecond).UnixNano(),
+		Error:          true,
+		Tags:           map[string]string{"endpoint": "barn"},
+	}
+	done := make(chan map[string]samplers.UDPMetric)
+	go func() {
+		metrics := map[string]samplers.UDPMetric{}
+		for m := range worker.PacketChan {
+			metrics[m.Name] = m
+		}
+		done <- metrics
+	}()
+	assert.NoError(t, sink.Ingest(span))
+	span.Error = false
+	assert.NoError(t, sink.Ingest(span))
+	close(worker.PacketChan)
+	metrics := <-done
+
+	duration, ok := metrics["farm.barn.duration"]
+	if assert.True(t, ok, "should have extracted a duration histogram: %v", metrics) {
+		assert.Equal(t, "histogram", duration.Type)
+		assert.InEpsilon(t, 1500, duration.Value, 0.001)
+		assert.ElementsMatch(t, []string{"endpoint:barn", "error:false"}, duration.Tags)
+	}
+	errors, ok := metrics["farm.errors"]
+	if assert.True(t, ok, "should have extracted an error counter: %v", metrics) {
+		assert.Equal(t, "counter", errors.Type)
+		assert.Equal(t, []string{"name:harvest"}, errors.Tags)
+	}
+}
+
+func TestInvalidSpanMetricRules(t *testing.T) {
+	tests := map[string]ssfmetrics.SpanMetricRule{
+		"no name":      {Type: "counter"},
+		"bad template": {Name: "{{.Service", Type: "counter"},
+		"unknown type": {Name: "spans", Type: "gauge"},
+		"unknown unit": {Name: "spans", Type: "histogram", Unit: "fortnights"},
+	}
+	for name, rule := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := ssfmetrics.NewSpanMetricRules([]ssfmetrics.SpanMetricRule{rule})
+			assert.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package ssfmetrics
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"text/template"
+	"time"
+
+	"github.com/stripe/veneur/ssf"
+)
+
+// SpanMetricRule describes a metric that is extracted from the spans
+// that the rule matches.
+type SpanMetricRule struct {
+	// Name is a text/template for the metric's name. It can refer to
+	// the span's {{.Service}}, its {{.Name}} and its tags, e.g.
+	// {{.Tags.endpoint}}.
+	Name string
+	// Type is "counter", which counts the spans, or "histogram" or
+	// "distribution", which record their duration.
+	Type string
+	// Unit is the unit of the durations that histograms and
+	// distributions record: "ns" (the default), "us", "ms" or "s".
+	Unit string
+	// Tags are the span tags that become tags of the metric. The
+	// names "service", "name", "error" and "indicator" refer to the
+	// span's fields of that name instead. Tags that a span doesn't
+	// have are left off.
+	Tags []string
+	// Match restricts the rule to spans whose tags (or fields, named
+	// as in Tags) have the given values, e.g. {"error": "true"}.
+	Match map[string]string
+}
+
+// SpanMetricRules extracts metrics from spans according to a list of
+// rules.
+type SpanMetricRules struct {
+	rules []compiledRule
+}
+
+type compiledRule struct {
+	name   *template.Template
+	metric ssf.SSFSample_Metric
+	unit   time.Duration
+	tags   []string
+	match  map[string]string
+}
+
+// spanMetricData is what the name templates of rules are executed on.
+type spanMetricData struct {
+	Service string
+	Name    string
+	Tags    map[string]string
+}
+
+var spanMetricUnits = map[string]time.Duration{
+	"":   time.Nanosecond,
+	"ns": time.Nanosecond,
+	"us": time.Microsecond,
+	"ms": time.Millisecond,
+	"s":  time.Second,
+}
+
+// NewSpanMetricRules compiles rules, and returns an error if any of
+// them is invalid.
+func NewSpanMetricRules(rules []SpanMetricRule) (*SpanMetricRules, error) {
+	compiled := make([]compiledRule, 0, len(rules))
+	for i, rule := range rules {
+		if rule.Name == "" {
+			return nil, fmt.Errorf("span metric rule %d has no name", i)
+		}
+		name, err := template.New(rule.Name).Option("missingkey=zero").Parse(rule.Name)
+		if err != nil {
+			return nil, fmt.Errorf("span metric rule %q: %v", rule.Name, err)
+		}
+		cr := compiledRule{name: name, tags: rule.Tags, match: rule.Match}
+		switch rule.Type {
+		case "counter":
+			cr.metric = ssf.SSFSample_COUNTER
+		case "histogram":
+			cr.metric = ssf.SSFSample_HISTOGRAM
+		case "distribution":
+			cr.metric = ssf.SSFSample_DISTRIBUTION
+		default:
+			return nil, fmt.Errorf("span metric rule %q has unknown type %q", rule.Name, rule.Type)
+		}
+		unit, ok := spanMetricUnits[rule.Unit]
+		if !ok {
+			return nil, fmt.Errorf("span metric rule %q has unknown unit %q", rule.Name, rule.Unit)
+		}
+		cr.unit = unit
+		compiled = append(compiled, cr)
+	}
+	return &SpanMetricRules{rules: compiled}, nil
+}
+
+// Extract returns the metrics that the rules extract from span.
+func (r *SpanMetricRules) Extract(span *ssf.SSFSpan) ([]*ssf.SSFSample, error) {
+	var samples []*ssf.SSFSample
+	data := spanMetricData{Service: span.Service, Name: span.Name, Tags: span.Tags}
+	for _, rule := range r.rules {
+		if !rule.matches(span) {
+			continue
+		}
+		var name bytes.Buffer
+		if err := rule.name.Execute(&name, data); err != nil {
+			return samples, err
+		}
+		tags := make(map[string]string, len(rule.tags))
+		for _, key := range rule.tags {
+			if value, ok := spanField(span, key); ok {
+				tags[key] = value
+			}
+		}
+
+		var sample *ssf.SSFSample
+		if rule.metric == ssf.SSFSample_COUNTER {
+			sample = ssf.Count(name.String(), 1, tags)
+		} else {
+			duration := time.Duration(span.EndTimestamp - span.StartTimestamp)
+			sample = ssf.Timing(name.String(), duration, rule.unit, tags)
+			sample.Metric = rule.metric
+		}
+		// Like indicator timers, the name is the configured one,
+		// without ssf.NamePrefix:
+		sample.Name = name.String()
+		samples = append(samples, sample)
+	}
+	return samples, nil
+}
+
+func (r compiledRule) matches(span *ssf.SSFSpan) bool {
+	for key, want := range r.match {
+		if value, ok := spanField(span, key); !ok || value != want {
+			return false
+		}
+	}
+	return true
+}
+
+// spanField returns the value of a span's field or tag, as named in a
+// SpanMetricRule.
+func spanField(span *ssf.SSFSpan, key string) (string, bool) {
+	switch key {
+	case "service":
+		return span.Service, true
+	case "name":
+		return span.Name, true
+	case "error":
+		return strconv.FormatBool(span.Error), true
+	case "indicator":
+		return strconv.FormatBool(span.Indicator), true
+	}
+	value, ok := span.Tags[key]
+	return value, ok
+}
@@ -0,0 +1,79 @@
+package sinks
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/stripe/veneur/samplers"
+)
+
+// TagInjector adds static tags to the metrics that a single sink
+// receives, without modifying the metrics that other sinks receive.
+type TagInjector struct {
+	keys      []string
+	tags      []string
+	overwrite bool
+}
+
+// NewTagInjector returns an injector that adds a "key:value" tag for
+// each entry of tags (or a "key" tag, if the value is empty). Metrics
+// that already have a tag with the same key keep their own tag, unless
+// overwrite is true.
+func NewTagInjector(tags map[string]string, overwrite bool) *TagInjector {
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	ti := &TagInjector{keys: keys, tags: make([]string, len(keys)), overwrite: overwrite}
+	for i, k := range keys {
+		ti.tags[i] = k
+		if v := tags[k]; v != "" {
+			ti.tags[i] += ":" + v
+		}
+	}
+	return ti
+}
+
+// Inject returns copies of the metrics with the tags added. Only the
+// metrics' tag slices are copied; the metrics passed in, and their
+// tags, are left untouched.
+func (ti *TagInjector) Inject(metrics []samplers.InterMetric) []samplers.InterMetric {
+	injected := make([]samplers.InterMetric, len(metrics))
+	present := make([]bool, len(ti.keys))
+	for i, metric := range metrics {
+		for j := range present {
+			present[j] = false
+		}
+		tags := make([]string, 0, len(metric.Tags)+len(ti.tags))
+		for _, tag := range metric.Tags {
+			key := tag
+			if colon := strings.IndexByte(tag, ':'); colon >= 0 {
+				key = tag[:colon]
+			}
+			if j := sort.SearchStrings(ti.keys, key); j < len(ti.keys) && ti.keys[j] == key {
+				if present[j] {
+					// Another tag with this key was already
+					// overwritten; drop the duplicate.
+					if ti.overwrite {
+						continue
+					}
+				} else {
+					present[j] = true
+					if ti.overwrite {
+						tag = ti.tags[j]
+					}
+				}
+			}
+			tags = append(tags, tag)
+		}
+		for j, tag := range ti.tags {
+			if !present[j] {
+				tags = append(tags, tag)
+			}
+		}
+		metric.Tags = tags
+		injected[i] = metric
+	}
+	return injected
+}
@@ -0,0 +1,49 @@
+package sinks
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stripe/veneur/samplers"
+)
+
+func TestTagInjector(t *testing.T) {
+	add := map[string]string{"sink": "datadog", "region": "us-east-1", "canary": ""}
+	tests := []struct {
+		name      string
+		overwrite bool
+		tags      []string
+		want      []string
+	}{
+		{"no tags", false, nil,
+			[]string{"canary", "region:us-east-1", "sink:datadog"}},
+		{"other tags", false, []string{"env:prod"},
+			[]string{"env:prod", "canary", "region:us-east-1", "sink:datadog"}},
+		{"existing tags are kept", false, []string{"region:eu-west-1", "canary:yes"},
+			[]string{"region:eu-west-1", "canary:yes", "sink:datadog"}},
+		{"existing tags are overwritten", true, []string{"region:eu-west-1", "env:prod"},
+			[]string{"region:us-east-1", "env:prod", "canary", "sink:datadog"}},
+		{"value-less tags are overwritten", true, []string{"region"},
+			[]string{"region:us-east-1", "canary", "sink:datadog"}},
+		{"duplicates are collapsed when overwriting", true, []string{"region:a", "region:b"},
+			[]string{"region:us-east-1", "canary", "sink:datadog"}},
+		{"duplicates are kept otherwise", false, []string{"region:a", "region:b"},
+			[]string{"region:a", "region:b", "canary", "sink:datadog"}},
+		{"prefixes aren't keys", true, []string{"regional:x"},
+			[]string{"regional:x", "canary", "region:us-east-1", "sink:datadog"}},
+	}
+	for _, elt := range tests {
+		test := elt
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			var original []string
+			if test.tags != nil {
+				original = append([]string{}, test.tags...)
+			}
+			metrics := []samplers.InterMetric{{Name: "a", Value: 1, Tags: test.tags}}
+			got := NewTagInjector(add, test.overwrite).Inject(metrics)
+			assert.Equal(t, []samplers.InterMetric{{Name: "a", Value: 1, Tags: test.want}}, got)
+			assert.Equal(t, original, metrics[0].Tags, "the input must not be modified")
+		})
+	}
+}
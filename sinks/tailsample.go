@@ -0,0 +1,324 @@
+package sinks
+
+import (
+	"container/list"
+	"encoding/binary"
+	"hash/fnv"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stripe/veneur/ssf"
+	"github.com/stripe/veneur/trace"
+	"github.com/stripe/veneur/trace/metrics"
+)
+
+// MetricKeyTailSampledTraces is emitted as a counter by
+// TailSamplingSpanSink for each trace that it decides on. Tagged with
+// `decision` (the reason a trace was kept, or `dropped`) and with
+// `complete:false` for traces that were decided before their root span
+// arrived.
+const MetricKeyTailSampledTraces = "sink.tail_sampling.traces_total"
+
+// MetricKeyTailSamplingBufferedSpans is emitted as a gauge by
+// TailSamplingSpanSink on each flush, with the number of spans that it
+// holds while their traces are undecided.
+const MetricKeyTailSamplingBufferedSpans = "sink.tail_sampling.buffered_spans"
+
+// DefaultTailSamplingWait is how long a TailSamplingSpanSink holds the
+// spans of a trace, if no other wait is configured.
+const DefaultTailSamplingWait = 5 * time.Second
+
+// DefaultTailSamplingMaxSpans is the number of spans that a
+// TailSamplingSpanSink holds at most, if no other bound is configured.
+const DefaultTailSamplingMaxSpans = 100000
+
+// The decisions of a TailSamplingSpanSink, as reported in the decision
+// tag of MetricKeyTailSampledTraces.
+const (
+	tailSampleError    = "error"
+	tailSampleDuration = "duration"
+	tailSampleRate     = "rate"
+	tailSampleDropped  = "dropped"
+)
+
+// TailSamplingOptions decide which traces a TailSamplingSpanSink keeps.
+// A trace is kept if any of its spans has the error flag and KeepErrors
+// is set, if it lasts at least MinDuration, or otherwise with
+// probability Rate.
+type TailSamplingOptions struct {
+	// Wait is how long the spans of a trace are held, from the first
+	// one's arrival, for the trace's root span. Traces whose root span
+	// doesn't arrive in time are decided on the spans that did.
+	Wait time.Duration
+	// MaxSpans bounds the number of spans held. Once it is exceeded,
+	// the oldest traces are decided early.
+	MaxSpans int
+
+	KeepErrors bool
+	// MinDuration is the duration from the start of a trace's first
+	// span to the end of its last that keeps the trace. Zero keeps no
+	// trace for its duration.
+	MinDuration time.Duration
+	// Rate is the fraction, between 0 and 1, of the other traces that
+	// are kept. The choice is made by hashing the trace ID, so that
+	// every veneur makes the same one.
+	Rate float64
+}
+
+// TailSamplingSpanSink is a SpanSink that keeps or drops whole traces
+// for the span sinks that it wraps: it holds the spans of each trace
+// until the trace's root span arrives, or until it has waited long
+// enough, and then ingests all of them into the wrapped sinks, or none.
+// Spans that arrive after their trace was decided follow the decision.
+type TailSamplingSpanSink struct {
+	sinks []SpanSink
+	opts  TailSamplingOptions
+
+	mtx sync.Mutex
+	// pending are the traces that are not decided yet, by ID, and
+	// queue holds them in the order that they arrived in.
+	pending map[int64]*list.Element
+	queue   *list.List
+	spans   int
+	// decided holds the decisions of recently decided traces, so
+	// that their late spans follow them.
+	decided map[int64]tailDecision
+	// counts are the traces decided since the last flush, by their
+	// decision and completeness.
+	counts map[tailCount]int64
+
+	now         func() time.Time
+	traceClient *trace.Client
+	log         *logrus.Logger
+}
+
+var _ SpanSink = &TailSamplingSpanSink{}
+var _ Stopper = &TailSamplingSpanSink{}
+
+type pendingTrace struct {
+	id      int64
+	arrived time.Time
+	spans   []*ssf.SSFSpan
+}
+
+type tailDecision struct {
+	keep bool
+	at   time.Time
+}
+
+type tailCount struct {
+	decision string
+	complete bool
+}
+
+// NewTailSamplingSpanSink wraps spanSinks so that they only ingest the
+// traces that opts keep.
+func NewTailSamplingSpanSink(spanSinks []SpanSink, opts TailSamplingOptions, log *logrus.Logger) *TailSamplingSpanSink {
+	if opts.Wait <= 0 {
+		opts.Wait = DefaultTailSamplingWait
+	}
+	if opts.MaxSpans < 1 {
+		opts.MaxSpans = DefaultTailSamplingMaxSpans
+	}
+	return &TailSamplingSpanSink{
+		sinks:   spanSinks,
+		opts:    opts,
+		pending: map[int64]*list.Element{},
+		queue:   list.New(),
+		decided: map[int64]tailDecision{},
+		counts:  map[tailCount]int64{},
+		now:     time.Now,
+		log:     log,
+	}
+}
+
+// Name returns "tail_sampling".
+func (s *TailSamplingSpanSink) Name() string {
+	return "tail_sampling"
+}
+
+// Start starts the wrapped sinks.
+func (s *TailSamplingSpanSink) Start(cl *trace.Client) error {
+	s.traceClient = cl
+	for _, sink := range s.sinks {
+		if err := sink.Start(cl); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Ingest holds the span until its trace is decided, or ingests it into
+// the wrapped sinks right away if its trace was kept already. A root
+// span decides its trace.
+func (s *TailSamplingSpanSink) Ingest(span *ssf.SSFSpan) error {
+	now := s.now()
+	s.mtx.Lock()
+	kept := s.expire(now)
+	if d, ok := s.decided[span.TraceId]; ok {
+		if d.keep {
+			kept = append(kept, span)
+		}
+	} else {
+		elt, ok := s.pending[span.TraceId]
+		if !ok {
+			elt = s.queue.PushBack(&pendingTrace{id: span.TraceId, arrived: now})
+			s.pending[span.TraceId] = elt
+		}
+		pt := elt.Value.(*pendingTrace)
+		pt.spans = append(pt.spans, span)
+		s.spans++
+		if span.ParentId == 0 || span.Id == span.TraceId {
+			kept = append(kept, s.decide(elt, true, now)...)
+		}
+		for s.spans > s.opts.MaxSpans {
+			kept = append(kept, s.decide(s.queue.Front(), false, now)...)
+		}
+	}
+	s.mtx.Unlock()
+
+	return s.ingest(kept)
+}
+
+// Flush decides the traces that have waited long enough, and flushes
+// the wrapped sinks.
+func (s *TailSamplingSpanSink) Flush() {
+	now := s.now()
+	s.mtx.Lock()
+	kept := s.expire(now)
+	for id, d := range s.decided {
+		if now.Sub(d.at) > s.opts.Wait {
+			delete(s.decided, id)
+		}
+	}
+	counts := s.counts
+	s.counts = map[tailCount]int64{}
+	buffered := s.spans
+	s.mtx.Unlock()
+
+	if err := s.ingest(kept); err != nil {
+		s.log.WithError(err).Warn("Could not ingest the spans of kept traces")
+	}
+	for _, sink := range s.sinks {
+		sink.Flush()
+	}
+
+	samples := &ssf.Samples{}
+	for c, n := range counts {
+		tags := map[string]string{"sink": s.Name(), "decision": c.decision}
+		if !c.complete {
+			tags["complete"] = "false"
+		}
+		samples.Add(ssf.Count(MetricKeyTailSampledTraces, float32(n), tags))
+	}
+	samples.Add(ssf.Gauge(MetricKeyTailSamplingBufferedSpans, float32(buffered), map[string]string{"sink": s.Name()}))
+	metrics.Report(s.traceClient, samples)
+}
+
+// Stop decides the traces that are still pending, without waiting for
+// them to complete, and then flushes and stops the wrapped sinks.
+func (s *TailSamplingSpanSink) Stop() error {
+	now := s.now()
+	s.mtx.Lock()
+	var kept []*ssf.SSFSpan
+	for s.queue.Len() > 0 {
+		kept = append(kept, s.decide(s.queue.Front(), false, now)...)
+	}
+	s.mtx.Unlock()
+
+	err := s.ingest(kept)
+	for _, sink := range s.sinks {
+		sink.Flush()
+		if stopErr := Stop(sink); err == nil {
+			err = stopErr
+		}
+	}
+	return err
+}
+
+// expire decides the pending traces that have waited for longer than
+// the configured wait, and returns the spans of the ones it keeps.
+// s.mtx must be held.
+func (s *TailSamplingSpanSink) expire(now time.Time) []*ssf.SSFSpan {
+	var kept []*ssf.SSFSpan
+	for elt := s.queue.Front(); elt != nil; elt = s.queue.Front() {
+		if now.Sub(elt.Value.(*pendingTrace).arrived) <= s.opts.Wait {
+			break
+		}
+		kept = append(kept, s.decide(elt, false, now)...)
+	}
+	return kept
+}
+
+// decide keeps or drops a pending trace, and returns its spans if it
+// is kept. s.mtx must be held.
+func (s *TailSamplingSpanSink) decide(elt *list.Element, complete bool, now time.Time) []*ssf.SSFSpan {
+	pt := s.queue.Remove(elt).(*pendingTrace)
+	delete(s.pending, pt.id)
+	s.spans -= len(pt.spans)
+
+	decision := s.decision(pt)
+	keep := decision != tailSampleDropped
+	s.decided[pt.id] = tailDecision{keep: keep, at: now}
+	s.counts[tailCount{decision: decision, complete: complete}]++
+	if !keep {
+		return nil
+	}
+	return pt.spans
+}
+
+// decision returns the reason that a trace is kept, or
+// tailSampleDropped.
+func (s *TailSamplingSpanSink) decision(pt *pendingTrace) string {
+	var start, end int64 = math.MaxInt64, math.MinInt64
+	for _, span := range pt.spans {
+		if span.Error && s.opts.KeepErrors {
+			return tailSampleError
+		}
+		if span.StartTimestamp < start {
+			start = span.StartTimestamp
+		}
+		if span.EndTimestamp > end {
+			end = span.EndTimestamp
+		}
+	}
+	if s.opts.MinDuration > 0 && time.Duration(end-start) >= s.opts.MinDuration {
+		return tailSampleDuration
+	}
+	if sampleTrace(pt.id, s.opts.Rate) {
+		return tailSampleRate
+	}
+	return tailSampleDropped
+}
+
+// sampleTrace decides whether the trace with the given ID is among the
+// fraction rate of traces that are kept.
+func sampleTrace(id int64, rate float64) bool {
+	if rate <= 0 {
+		return false
+	}
+	if rate >= 1 {
+		return true
+	}
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], uint64(id))
+	h := fnv.New32a()
+	h.Write(buf[:])
+	return float64(h.Sum32()) < rate*math.MaxUint32
+}
+
+// ingest ingests spans into every wrapped sink, and returns the first
+// error of any of them.
+func (s *TailSamplingSpanSink) ingest(spans []*ssf.SSFSpan) error {
+	var first error
+	for _, span := range spans {
+		for _, sink := range s.sinks {
+			if err := sink.Ingest(span); err != nil && first == nil {
+				first = err
+			}
+		}
+	}
+	return first
+}
@@ -0,0 +1,174 @@
+package sinks
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stripe/veneur/ssf"
+	"github.com/stripe/veneur/trace"
+)
+
+type recordingSpanSink struct {
+	mtx     sync.Mutex
+	spans   []*ssf.SSFSpan
+	flushes int
+}
+
+func (s *recordingSpanSink) Start(*trace.Client) error { return nil }
+func (s *recordingSpanSink) Name() string              { return "recording" }
+
+func (s *recordingSpanSink) Ingest(span *ssf.SSFSpan) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.spans = append(s.spans, span)
+	return nil
+}
+
+func (s *recordingSpanSink) Flush() {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.flushes++
+}
+
+func (s *recordingSpanSink) ids() []int64 {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	ids := make([]int64, len(s.spans))
+	for i, span := range s.spans {
+		ids[i] = span.Id
+	}
+	return ids
+}
+
+// traceSpans returns the spans of a trace whose root span lasts
+// duration, with a child that has the error flag if failed.
+func traceSpans(traceID int64, duration time.Duration, failed bool) (root *ssf.SSFSpan, children []*ssf.SSFSpan) {
+	start := time.Unix(1000, 0)
+	root = &ssf.SSFSpan{
+		Id:             traceID,
+		TraceId:        traceID,
+		StartTimestamp: start.UnixNano(),
+		EndTimestamp:   start.Add(duration).UnixNano(),
+	}
+	for i := int64(1); i <= 2; i++ {
+		children = append(children, &ssf.SSFSpan{
+			Id:             traceID*10 + i,
+			TraceId:        traceID,
+			ParentId:       traceID,
+			StartTimestamp: start.UnixNano(),
+			EndTimestamp:   start.Add(duration / 2).UnixNano(),
+			Error:          failed && i == 2,
+		})
+	}
+	return root, children
+}
+
+func TestTailSamplingKeepsErrorTraces(t *testing.T) {
+	rec := &recordingSpanSink{}
+	sink := NewTailSamplingSpanSink([]SpanSink{rec}, TailSamplingOptions{KeepErrors: true}, logrus.New())
+
+	failedRoot, failedChildren := traceSpans(1, time.Millisecond, true)
+	okRoot, okChildren := traceSpans(2, time.Millisecond, false)
+	for _, span := range append(failedChildren, okChildren...) {
+		require.NoError(t, sink.Ingest(span))
+	}
+	assert.Empty(t, rec.ids(), "no spans should be ingested before their trace is decided")
+
+	require.NoError(t, sink.Ingest(failedRoot))
+	require.NoError(t, sink.Ingest(okRoot))
+	assert.Equal(t, []int64{11, 12, 1}, rec.ids(), "all spans of the failed trace should be kept")
+
+	// Late spans follow their trace's decision:
+	require.NoError(t, sink.Ingest(&ssf.SSFSpan{Id: 13, TraceId: 1, ParentId: 1}))
+	require.NoError(t, sink.Ingest(&ssf.SSFSpan{Id: 23, TraceId: 2, ParentId: 2}))
+	assert.Equal(t, []int64{11, 12, 1, 13}, rec.ids())
+
+	sink.Flush()
+	assert.Equal(t, 1, rec.flushes)
+}
+
+func TestTailSamplingDecisions(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     TailSamplingOptions
+		duration time.Duration
+		failed   bool
+		kept     bool
+	}{
+		{"error", TailSamplingOptions{KeepErrors: true}, time.Millisecond, true, true},
+		{"errors not kept", TailSamplingOptions{}, time.Millisecond, true, false},
+		{"slow", TailSamplingOptions{MinDuration: time.Second}, 2 * time.Second, false, true},
+		{"fast", TailSamplingOptions{MinDuration: time.Second}, time.Millisecond, false, false},
+		{"sampled", TailSamplingOptions{Rate: 1}, time.Millisecond, false, true},
+	}
+	for _, elt := range tests {
+		test := elt
+		t.Run(test.name, func(t *testing.T) {
+			rec := &recordingSpanSink{}
+			sink := NewTailSamplingSpanSink([]SpanSink{rec}, test.opts, logrus.New())
+			root, children := traceSpans(1, test.duration, test.failed)
+			for _, span := range append(children, root) {
+				require.NoError(t, sink.Ingest(span))
+			}
+			if test.kept {
+				assert.Len(t, rec.ids(), 3)
+			} else {
+				assert.Empty(t, rec.ids())
+			}
+		})
+	}
+}
+
+func TestTailSamplingRate(t *testing.T) {
+	kept := 0
+	for id := int64(1); id <= 10000; id++ {
+		if sampleTrace(id, 0.25) {
+			kept++
+		}
+		assert.Equal(t, sampleTrace(id, 0.25), sampleTrace(id, 0.25))
+	}
+	assert.InDelta(t, 2500, kept, 250)
+}
+
+func TestTailSamplingEmitsPartialTraces(t *testing.T) {
+	now := time.Unix(1000, 0)
+	rec := &recordingSpanSink{}
+	sink := NewTailSamplingSpanSink([]SpanSink{rec}, TailSamplingOptions{
+		Wait:       time.Second,
+		KeepErrors: true,
+	}, logrus.New())
+	sink.now = func() time.Time { return now }
+
+	_, failedChildren := traceSpans(1, time.Millisecond, true)
+	_, okChildren := traceSpans(2, time.Millisecond, false)
+	for _, span := range append(failedChildren, okChildren...) {
+		require.NoError(t, sink.Ingest(span))
+	}
+	sink.Flush()
+	assert.Empty(t, rec.ids(), "traces should wait for their root span")
+
+	now = now.Add(2 * time.Second)
+	sink.Flush()
+	assert.Equal(t, []int64{11, 12}, rec.ids(), "the incomplete failed trace should be kept")
+	assert.Equal(t, 0, sink.spans)
+}
+
+func TestTailSamplingMaxSpans(t *testing.T) {
+	rec := &recordingSpanSink{}
+	sink := NewTailSamplingSpanSink([]SpanSink{rec}, TailSamplingOptions{
+		MaxSpans:   3,
+		KeepErrors: true,
+	}, logrus.New())
+
+	_, failedChildren := traceSpans(1, time.Millisecond, true)
+	_, okChildren := traceSpans(2, time.Millisecond, false)
+	for _, span := range append(failedChildren, okChildren...) {
+		require.NoError(t, sink.Ingest(span))
+	}
+	assert.Equal(t, []int64{11, 12}, rec.ids(), "the oldest trace should be decided once the buffer is full")
+	assert.Equal(t, 2, sink.spans)
+}
@@ -0,0 +1,323 @@
+package wavefront
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stripe/veneur/samplers"
+	"github.com/stripe/veneur/sinks"
+	"github.com/stripe/veneur/ssf"
+	"github.com/stripe/veneur/trace"
+)
+
+// DefaultSourceTag is the tag whose value becomes the source of a
+// point, if no other tag is configured.
+const DefaultSourceTag = "host"
+
+// writeTimeout bounds the time that writing a flush's points to a
+// proxy may take.
+const writeTimeout = 10 * time.Second
+
+// tagValueEscaper escapes the characters that are special in a quoted
+// Wavefront tag value. Line format has no way to escape newlines, so
+// they are replaced with underscores.
+var tagValueEscaper = strings.NewReplacer(`"`, `\"`, `\`, `\\`, "\n", "_")
+
+// WavefrontMetricSink is a MetricSink that writes metrics in
+// Wavefront's line format, "name value timestamp source=host tag=value",
+// either to a Wavefront proxy over TCP or to Wavefront's direct
+// ingestion API over HTTP.
+type WavefrontMetricSink struct {
+	// address is the proxy's "host:port" or, for direct ingestion,
+	// the URL of the report endpoint.
+	address   string
+	apiToken  string
+	direct    bool
+	source    string
+	sourceTag string
+	tags      map[string]string
+
+	// mutex protects the connection to the proxy.
+	mutex sync.Mutex
+	conn  net.Conn
+
+	httpClient  *http.Client
+	traceClient *trace.Client
+	log         *logrus.Logger
+}
+
+var _ sinks.MetricSink = &WavefrontMetricSink{}
+
+// NewWavefrontProxyMetricSink creates a sink that writes metrics to the
+// Wavefront proxy at address ("host:port").
+//
+// The source of each point is the value of the metric's sourceTag tag
+// if it has one, and source otherwise. The tags (in "key:value" form)
+// are added to every point.
+func NewWavefrontProxyMetricSink(address string, source string, sourceTag string, tags []string, log *logrus.Logger) (*WavefrontMetricSink, error) {
+	if address == "" {
+		return nil, errors.New("wavefront address must be set")
+	}
+	return newWavefrontMetricSink(address, "", false, source, sourceTag, tags, nil, log), nil
+}
+
+// NewWavefrontDirectMetricSink creates a sink that posts metrics to
+// the direct ingestion API of the Wavefront instance at address (like
+// "https://example.wavefront.com"), authenticated with apiToken. Its
+// other arguments are those of NewWavefrontProxyMetricSink.
+func NewWavefrontDirectMetricSink(address string, apiToken string, source string, sourceTag string, tags []string, httpClient *http.Client, log *logrus.Logger) (*WavefrontMetricSink, error) {
+	if apiToken == "" {
+		return nil, errors.New("a wavefront API token is required for direct ingestion")
+	}
+	u, err := url.Parse(address)
+	if err != nil {
+		return nil, err
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/report"
+	u.RawQuery = url.Values{"f": []string{"wavefront"}}.Encode()
+	return newWavefrontMetricSink(u.String(), apiToken, true, source, sourceTag, tags, httpClient, log), nil
+}
+
+func newWavefrontMetricSink(address string, apiToken string, direct bool, source string, sourceTag string, tags []string, httpClient *http.Client, log *logrus.Logger) *WavefrontMetricSink {
+	if sourceTag == "" {
+		sourceTag = DefaultSourceTag
+	}
+	return &WavefrontMetricSink{
+		address:    address,
+		apiToken:   apiToken,
+		direct:     direct,
+		source:     source,
+		sourceTag:  sourceTag,
+		tags:       parseTags(tags),
+		httpClient: httpClient,
+		log:        log,
+	}
+}
+
+// Name returns the name of this sink.
+func (s *WavefrontMetricSink) Name() string {
+	return "wavefront"
+}
+
+// Start sets the sink up.
+func (s *WavefrontMetricSink) Start(cl *trace.Client) error {
+	s.traceClient = cl
+	return nil
+}
+
+// Flush writes metrics to Wavefront, one point per metric.
+func (s *WavefrontMetricSink) Flush(ctx context.Context, interMetrics []samplers.InterMetric) error {
+	span, _ := trace.StartSpanFromContext(ctx, "")
+	defer span.ClientFinish(s.traceClient)
+
+	var body bytes.Buffer
+	points := 0
+	for _, metric := range interMetrics {
+		if !sinks.IsAcceptableMetric(metric, s) {
+			continue
+		}
+		// Wavefront can't store NaN or infinite values.
+		if math.IsNaN(metric.Value) || math.IsInf(metric.Value, 0) {
+			continue
+		}
+		s.writeLine(&body, metric)
+		points++
+	}
+	if points == 0 {
+		return nil
+	}
+
+	flushStart := time.Now()
+	var err error
+	if s.direct {
+		err = s.post(ctx, body.Bytes())
+	} else {
+		err = s.write(ctx, body.Bytes())
+	}
+	if err != nil {
+		span.Error(err)
+		span.Add(ssf.Count("flush.error_total", 1, map[string]string{"cause": "io", "sink": s.Name()}))
+		s.log.WithError(err).WithField("metrics", points).Warn("Error flushing metrics to Wavefront")
+		return err
+	}
+	tags := map[string]string{"sink": s.Name()}
+	span.Add(
+		ssf.Timing(sinks.MetricKeyMetricFlushDuration, time.Since(flushStart), time.Nanosecond, tags),
+		ssf.Count(sinks.MetricKeyTotalMetricsFlushed, float32(points), tags),
+	)
+	s.log.WithField("metrics", points).Info("Completed flush to Wavefront")
+	return nil
+}
+
+// FlushOtherSamples is a no-op: events and service checks are not
+// sent to Wavefront.
+func (s *WavefrontMetricSink) FlushOtherSamples(ctx context.Context, samples []ssf.SSFSample) {
+}
+
+// write sends the body to the proxy, reconnecting once if the
+// connection turns out to be broken.
+func (s *WavefrontMetricSink) write(ctx context.Context, body []byte) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var err error
+	for attempt := 0; attempt < 2; attempt++ {
+		if s.conn == nil {
+			var dialer net.Dialer
+			s.conn, err = dialer.DialContext(ctx, "tcp", s.address)
+			if err != nil {
+				s.conn = nil
+				return err
+			}
+		}
+		s.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+		if _, err = s.conn.Write(body); err == nil {
+			return nil
+		}
+		// The proxy may have closed an idle connection; try again on
+		// a new one.
+		s.conn.Close()
+		s.conn = nil
+	}
+	return err
+}
+
+func (s *WavefrontMetricSink) post(ctx context.Context, body []byte) error {
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	if _, err := gz.Write(body); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, s.address, &compressed)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("Content-Encoding", "gzip")
+	req.Header.Set("Authorization", "Bearer "+s.apiToken)
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 == 2 {
+		io.Copy(ioutil.Discard, resp.Body)
+		return nil
+	}
+	msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+	return fmt.Errorf("wavefront responded with %s: %s", resp.Status, bytes.TrimSpace(msg))
+}
+
+// writeLine renders the metric as a line of the form
+// `name value timestamp source="host" "tag"="value" ...`. Point tags
+// are sorted by key; the metric's tags override the sink's tags with
+// the same key, and tags with an empty value are dropped, since
+// Wavefront rejects them.
+func (s *WavefrontMetricSink) writeLine(buf *bytes.Buffer, metric samplers.InterMetric) {
+	tags := make(map[string]string, len(s.tags)+len(metric.Tags))
+	for k, v := range s.tags {
+		tags[k] = v
+	}
+	for k, v := range parseTags(metric.Tags) {
+		tags[k] = v
+	}
+	source := s.source
+	if v, ok := tags[s.sourceTag]; ok {
+		source = v
+		delete(tags, s.sourceTag)
+	}
+	// Wavefront reserves these tags for the source.
+	delete(tags, "source")
+	delete(tags, "host")
+
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	buf.WriteString(SanitizeMetricName(metric.Name))
+	buf.WriteByte(' ')
+	buf.WriteString(strconv.FormatFloat(metric.Value, 'f', -1, 64))
+	buf.WriteByte(' ')
+	buf.WriteString(strconv.FormatInt(metric.Timestamp, 10))
+	buf.WriteString(` source="`)
+	buf.WriteString(tagValueEscaper.Replace(source))
+	buf.WriteByte('"')
+	for _, k := range keys {
+		buf.WriteString(` "`)
+		buf.WriteString(SanitizeTagKey(k))
+		buf.WriteString(`"="`)
+		buf.WriteString(tagValueEscaper.Replace(tags[k]))
+		buf.WriteByte('"')
+	}
+	buf.WriteByte('\n')
+}
+
+// parseTags converts tags of the form "key:value" into a map, dropping
+// tags without a value.
+func parseTags(tags []string) map[string]string {
+	parsed := make(map[string]string, len(tags))
+	for _, tag := range tags {
+		kv := strings.SplitN(tag, ":", 2)
+		if len(kv) < 2 || kv[0] == "" || kv[1] == "" {
+			continue
+		}
+		parsed[kv[0]] = kv[1]
+	}
+	return parsed
+}
+
+// sanitize replaces every character of s for which allowed returns
+// false with an underscore.
+func sanitize(s string, allowed func(r rune) bool) string {
+	return strings.Map(func(r rune) rune {
+		if allowed(r) {
+			return r
+		}
+		return '_'
+	}, s)
+}
+
+func isAlnum(r rune) bool {
+	return (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9')
+}
+
+// SanitizeMetricName replaces the characters that Wavefront doesn't
+// allow in metric names with underscores. Letters, digits, "-", "_",
+// ".", "/" and "," are allowed.
+func SanitizeMetricName(name string) string {
+	return sanitize(name, func(r rune) bool {
+		return isAlnum(r) || strings.ContainsRune("-_./,", r)
+	})
+}
+
+// SanitizeTagKey replaces the characters that Wavefront doesn't allow
+// in point tag keys with underscores. Letters, digits, "-", "_" and "."
+// are allowed.
+func SanitizeTagKey(key string) string {
+	return sanitize(key, func(r rune) bool {
+		return isAlnum(r) || strings.ContainsRune("-_.", r)
+	})
+}
@@ -0,0 +1,133 @@
+package wavefront
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stripe/veneur/samplers"
+)
+
+func TestWriteLine(t *testing.T) {
+	sink, err := NewWavefrontProxyMetricSink("localhost:2878", "veneur-host", "", []string{"env:prod", "region:us"}, logrus.New())
+	require.NoError(t, err)
+
+	tests := []struct {
+		name   string
+		metric samplers.InterMetric
+		line   string
+	}{
+		{
+			"configured source",
+			samplers.InterMetric{Name: "a.b.c", Timestamp: 1476119058, Value: 1.5, Tags: []string{"foo:bar"}},
+			`a.b.c 1.5 1476119058 source="veneur-host" "env"="prod" "foo"="bar" "region"="us"` + "\n",
+		},
+		{
+			"source from host tag",
+			samplers.InterMetric{Name: "a.b.c", Timestamp: 1476119058, Value: 2, Tags: []string{"host:web-1", "env:dev"}},
+			`a.b.c 2 1476119058 source="web-1" "env"="dev" "region"="us"` + "\n",
+		},
+		{
+			"histogram aggregate",
+			samplers.InterMetric{Name: "req.latency.99percentile", Timestamp: 1476119058, Value: 0.25},
+			`req.latency.99percentile 0.25 1476119058 source="veneur-host" "env"="prod" "region"="us"` + "\n",
+		},
+		{
+			"sanitized",
+			samplers.InterMetric{Name: "a b:c\n", Timestamp: 1476119058, Value: -3, Tags: []string{`we:ird key:"quo\ted"`, "empty:", "bare"}},
+			`a_b_c_ -3 1476119058 source="veneur-host" "env"="prod" "region"="us" "we"="ird key:\"quo\\ted\""` + "\n",
+		},
+	}
+	for _, elt := range tests {
+		test := elt
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			var buf bytes.Buffer
+			sink.writeLine(&buf, test.metric)
+			assert.Equal(t, test.line, buf.String())
+		})
+	}
+}
+
+func TestSourceTag(t *testing.T) {
+	sink, err := NewWavefrontProxyMetricSink("localhost:2878", "veneur-host", "instance", nil, logrus.New())
+	require.NoError(t, err)
+	var buf bytes.Buffer
+	sink.writeLine(&buf, samplers.InterMetric{Name: "up", Timestamp: 1, Value: 1, Tags: []string{"instance:i-123", "host:web-1"}})
+	assert.Equal(t, `up 1 1 source="i-123"`+"\n", buf.String(), "the host tag is reserved for the source")
+}
+
+func TestSanitize(t *testing.T) {
+	assert.Equal(t, "a.b-c_d/e,f", SanitizeMetricName("a.b-c_d/e,f"))
+	assert.Equal(t, "a_b_c_d", SanitizeMetricName("a b:c=d"))
+	assert.Equal(t, "a.b-c_d_e_f", SanitizeTagKey("a.b-c_d/e,f"))
+}
+
+func TestWavefrontProxyMetricSink(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer lis.Close()
+	lines := make(chan string, 10)
+	go func() {
+		conn, err := lis.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		scanner := bufio.NewScanner(conn)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+	}()
+
+	sink, err := NewWavefrontProxyMetricSink(lis.Addr().String(), "myhost", "", nil, logrus.New())
+	require.NoError(t, err)
+	require.NoError(t, sink.Start(nil))
+	require.NoError(t, sink.Flush(context.Background(), []samplers.InterMetric{
+		{Name: "a.b.c", Timestamp: 1476119058, Value: 1, Type: samplers.CounterMetric},
+		{Name: "a.b.d", Timestamp: 1476119058, Value: 2, Type: samplers.GaugeMetric},
+	}))
+
+	for _, want := range []string{`a.b.c 1 1476119058 source="myhost"`, `a.b.d 2 1476119058 source="myhost"`} {
+		select {
+		case line := <-lines:
+			assert.Equal(t, want, line)
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for points")
+		}
+	}
+}
+
+func TestWavefrontDirectMetricSink(t *testing.T) {
+	var body, auth, query string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		query = r.URL.Path + "?" + r.URL.RawQuery
+		gz, err := gzip.NewReader(r.Body)
+		require.NoError(t, err)
+		b, err := ioutil.ReadAll(gz)
+		require.NoError(t, err)
+		body = string(b)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	sink, err := NewWavefrontDirectMetricSink(server.URL, "token", "myhost", "", nil, server.Client(), logrus.New())
+	require.NoError(t, err)
+	require.NoError(t, sink.Flush(context.Background(), []samplers.InterMetric{
+		{Name: "a.b.c", Timestamp: 1476119058, Value: 1, Tags: []string{"host:web-1"}, Type: samplers.GaugeMetric},
+	}))
+	assert.Equal(t, "Bearer token", auth)
+	assert.Equal(t, "/report?f=wavefront", query)
+	assert.Equal(t, `a.b.c 1 1476119058 source="web-1"`+"\n", body)
+}
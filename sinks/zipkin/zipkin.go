@@ -0,0 +1,226 @@
+package zipkin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stripe/veneur/protocol"
+	"github.com/stripe/veneur/sinks"
+	"github.com/stripe/veneur/ssf"
+	"github.com/stripe/veneur/trace"
+)
+
+// DefaultBatchSize is the number of spans that the sink buffers
+// before sending them, if no other size is configured.
+const DefaultBatchSize = 100
+
+// KindTag is the span tag that carries the Zipkin kind of a span, like
+// "client" or "server". SSF spans don't record their kind otherwise.
+const KindTag = "span.kind"
+
+// Endpoint is the network context of a Zipkin span.
+type Endpoint struct {
+	ServiceName string `json:"serviceName,omitempty"`
+}
+
+// Annotation is an event that happened during a Zipkin span.
+type Annotation struct {
+	Timestamp int64  `json:"timestamp"`
+	Value     string `json:"value"`
+}
+
+// Span is a span in the Zipkin v2 JSON format. Timestamps and durations
+// are in microseconds.
+type Span struct {
+	TraceID       string            `json:"traceId"`
+	ID            string            `json:"id"`
+	ParentID      string            `json:"parentId,omitempty"`
+	Name          string            `json:"name,omitempty"`
+	Kind          string            `json:"kind,omitempty"`
+	Timestamp     int64             `json:"timestamp"`
+	Duration      int64             `json:"duration"`
+	LocalEndpoint *Endpoint         `json:"localEndpoint,omitempty"`
+	Annotations   []Annotation      `json:"annotations,omitempty"`
+	Tags          map[string]string `json:"tags,omitempty"`
+}
+
+// ZipkinSpanSink is a SpanSink that sends spans to a Zipkin collector
+// in the v2 JSON format. It buffers spans and sends them in batches,
+// whenever a batch is full and on every flush.
+type ZipkinSpanSink struct {
+	spansURL   string
+	httpClient *http.Client
+	batcher    *sinks.SpanBatcher
+
+	traceClient *trace.Client
+	log         *logrus.Logger
+}
+
+var _ sinks.SpanSink = &ZipkinSpanSink{}
+var _ sinks.Stopper = &ZipkinSpanSink{}
+
+// NewZipkinSpanSink creates a sink that sends spans to the Zipkin
+// collector at address (like "http://localhost:9411"), in batches of
+// at most batchSize spans.
+func NewZipkinSpanSink(address string, batchSize int, httpClient *http.Client, log *logrus.Logger) (*ZipkinSpanSink, error) {
+	if _, err := url.Parse(address); err != nil {
+		return nil, err
+	}
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+	s := &ZipkinSpanSink{
+		spansURL:   strings.TrimSuffix(address, "/") + "/api/v2/spans",
+		httpClient: httpClient,
+		log:        log,
+	}
+	s.batcher = sinks.NewSpanBatcher(s.Name(), batchSize, s.send, log)
+	return s, nil
+}
+
+// Name returns the name of this sink.
+func (s *ZipkinSpanSink) Name() string {
+	return "zipkin"
+}
+
+// Start sets the sink up and starts sending batches of spans in the
+// background.
+func (s *ZipkinSpanSink) Start(cl *trace.Client) error {
+	s.traceClient = cl
+	s.batcher.Start()
+	return nil
+}
+
+// Ingest buffers the span, and queues the buffered spans to be sent if
+// there are batchSize of them.
+func (s *ZipkinSpanSink) Ingest(span *ssf.SSFSpan) error {
+	if err := protocol.ValidateTrace(span); err != nil {
+		return err
+	}
+	s.batcher.Add(span)
+	return nil
+}
+
+// Flush queues all buffered spans to be sent, and reports the number
+// of spans sent and dropped since the last flush.
+func (s *ZipkinSpanSink) Flush() {
+	s.batcher.Flush(s.traceClient)
+}
+
+// Stop sends the buffered spans, and waits for all batches to be sent.
+func (s *ZipkinSpanSink) Stop() error {
+	return s.batcher.Stop()
+}
+
+func (s *ZipkinSpanSink) send(ctx context.Context, batch []*ssf.SSFSpan) int {
+	spans := make([]Span, len(batch))
+	for i, span := range batch {
+		spans[i] = convertSpan(span)
+	}
+	if err := s.post(ctx, spans); err != nil {
+		s.log.WithError(err).WithField("spans", len(batch)).Warn("Error sending spans to Zipkin")
+		return 0
+	}
+	return len(batch)
+}
+
+func (s *ZipkinSpanSink) post(ctx context.Context, spans []Span) error {
+	body, err := json.Marshal(spans)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, s.spansURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "veneur")
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 == 2 {
+		io.Copy(ioutil.Discard, resp.Body)
+		return nil
+	}
+	msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+	return fmt.Errorf("zipkin responded with %s: %s", resp.Status, bytes.TrimSpace(msg))
+}
+
+// hexID formats an SSF ID as the 16 lowercase hex digits that Zipkin
+// expects.
+func hexID(id int64) string {
+	return fmt.Sprintf("%016x", uint64(id))
+}
+
+// traceHexID formats the trace ID of an SSF span in hex, as 32 digits
+// if the span's propagated trace ID has 128 bits, and 16 otherwise.
+func traceHexID(span *ssf.SSFSpan) string {
+	if high := trace.TraceIDHigh(span.Tags); high != 0 {
+		return fmt.Sprintf("%016x%016x", high, uint64(span.TraceId))
+	}
+	return hexID(span.TraceId)
+}
+
+// convertSpan converts an SSF span into a Zipkin span. The span's tags
+// become Zipkin tags, except for its kind; error spans get the tag
+// "error", and indicator spans an "indicator" annotation at their
+// start.
+func convertSpan(span *ssf.SSFSpan) Span {
+	zs := Span{
+		TraceID:   traceHexID(span),
+		ID:        hexID(span.Id),
+		Name:      span.Name,
+		Timestamp: span.StartTimestamp / int64(time.Microsecond),
+		Duration:  (span.EndTimestamp - span.StartTimestamp) / int64(time.Microsecond),
+	}
+	if span.ParentId > 0 {
+		zs.ParentID = hexID(span.ParentId)
+	}
+	// Zipkin treats a duration of 0 as unknown, so round up spans
+	// that took less than a microsecond.
+	if zs.Duration == 0 && span.EndTimestamp > span.StartTimestamp {
+		zs.Duration = 1
+	}
+	if span.Service != "" {
+		zs.LocalEndpoint = &Endpoint{ServiceName: span.Service}
+	}
+
+	for k, v := range span.Tags {
+		if k == KindTag {
+			switch kind := strings.ToUpper(v); kind {
+			case "CLIENT", "SERVER", "PRODUCER", "CONSUMER":
+				zs.Kind = kind
+			}
+			continue
+		}
+		if zs.Tags == nil {
+			zs.Tags = make(map[string]string, len(span.Tags)+1)
+		}
+		zs.Tags[k] = v
+	}
+	if span.Error {
+		if zs.Tags == nil {
+			zs.Tags = map[string]string{}
+		}
+		if _, ok := zs.Tags["error"]; !ok {
+			zs.Tags["error"] = "true"
+		}
+	}
+	if span.Indicator {
+		zs.Annotations = []Annotation{{Timestamp: zs.Timestamp, Value: "indicator"}}
+	}
+	return zs
+}
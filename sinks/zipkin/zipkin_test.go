@@ -0,0 +1,129 @@
+package zipkin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stripe/veneur/sinks"
+	"github.com/stripe/veneur/ssf"
+	"github.com/stripe/veneur/trace"
+)
+
+func TestHexID(t *testing.T) {
+	assert.Equal(t, "0000000000000102", hexID(0x0102))
+	assert.Equal(t, "7fffffffffffffff", hexID(1<<63-1))
+	assert.Equal(t, "ffffffffffffffff", hexID(-1))
+}
+
+func TestTraceHexID(t *testing.T) {
+	assert.Equal(t, "0000000000000102", traceHexID(&ssf.SSFSpan{TraceId: 0x0102}))
+	assert.Equal(t, "80f198ee56343ba80000000000000102", traceHexID(&ssf.SSFSpan{
+		TraceId: 0x0102,
+		Tags:    map[string]string{trace.TraceIDHighTag: "80f198ee56343ba8"},
+	}))
+}
+
+func TestZipkinSpanSink(t *testing.T) {
+	type request struct {
+		path  string
+		spans []Span
+	}
+	requests := make(chan request, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var spans []Span
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&spans))
+		requests <- request{r.URL.Path, spans}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	reports := make(chan *ssf.SSFSpan, 2)
+	cl, err := trace.NewChannelClient(reports)
+	require.NoError(t, err)
+	defer cl.Close()
+
+	sink, err := NewZipkinSpanSink(server.URL+"/", 10, http.DefaultClient, logrus.New())
+	require.NoError(t, err)
+	require.NoError(t, sink.Start(cl))
+
+	start := time.Unix(1476119058, 1500)
+	require.NoError(t, sink.Ingest(&ssf.SSFSpan{
+		TraceId:        0x1234abcd,
+		Id:             0x1234abcd,
+		StartTimestamp: start.UnixNano(),
+		EndTimestamp:   start.Add(2*time.Second + 2500*time.Nanosecond).UnixNano(),
+		Name:           "GET /",
+		Service:        "frontend",
+		Indicator:      true,
+		Tags:           map[string]string{"route": "/", KindTag: "server"},
+	}))
+	require.NoError(t, sink.Ingest(&ssf.SSFSpan{
+		TraceId:        0x1234abcd,
+		Id:             -2,
+		ParentId:       0x1234abcd,
+		StartTimestamp: start.Add(time.Millisecond).UnixNano(),
+		EndTimestamp:   start.Add(time.Millisecond + 300*time.Nanosecond).UnixNano(),
+		Name:           "db.query",
+		Service:        "frontend",
+		Error:          true,
+	}))
+	sink.Flush()
+
+	var req request
+	select {
+	case req = <-requests:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the batch")
+	}
+	assert.Equal(t, "/api/v2/spans", req.path)
+	assert.Equal(t, []Span{
+		{
+			TraceID:       "000000001234abcd",
+			ID:            "000000001234abcd",
+			Name:          "GET /",
+			Kind:          "SERVER",
+			Timestamp:     1476119058000001,
+			Duration:      2000002,
+			LocalEndpoint: &Endpoint{ServiceName: "frontend"},
+			Annotations:   []Annotation{{Timestamp: 1476119058000001, Value: "indicator"}},
+			Tags:          map[string]string{"route": "/"},
+		},
+		{
+			TraceID:       "000000001234abcd",
+			ID:            "fffffffffffffffe",
+			ParentID:      "000000001234abcd",
+			Name:          "db.query",
+			Timestamp:     1476119058001001,
+			Duration:      1,
+			LocalEndpoint: &Endpoint{ServiceName: "frontend"},
+			Tags:          map[string]string{"error": "true"},
+		},
+	}, req.spans)
+
+	require.NoError(t, sink.Stop())
+	sink.Flush()
+	var sent float32
+	for i := 0; i < 2; i++ {
+		for _, m := range (<-reports).Metrics {
+			if m.Name == sinks.MetricKeyTotalSpansFlushed {
+				sent += m.Value
+			}
+		}
+	}
+	assert.Equal(t, float32(2), sent)
+}
+
+func TestRootSpanHasNoParent(t *testing.T) {
+	for _, parent := range []int64{0, -1} {
+		zs := convertSpan(&ssf.SSFSpan{TraceId: 1, Id: 1, ParentId: parent, Name: "root"})
+		b, err := json.Marshal(zs)
+		require.NoError(t, err)
+		assert.NotContains(t, string(b), "parentId")
+	}
+}
@@ -0,0 +1,115 @@
+package ssf
+
+import (
+	"bytes"
+	"sort"
+	"strconv"
+)
+
+// seriesKey returns a string identifying the time series that a
+// sample belongs to: its type, scope, name and tags, with the tags
+// sorted by key.
+func seriesKey(s *SSFSample) string {
+	keys := make([]string, 0, len(s.Tags))
+	for k := range s.Tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var buf bytes.Buffer
+	buf.WriteString(strconv.Itoa(int(s.Metric)))
+	buf.WriteByte(0)
+	buf.WriteString(strconv.Itoa(int(s.Scope)))
+	buf.WriteByte(0)
+	buf.WriteString(s.Name)
+	for _, k := range keys {
+		buf.WriteByte(0)
+		buf.WriteString(k)
+		buf.WriteByte(0)
+		buf.WriteString(s.Tags[k])
+	}
+	return buf.String()
+}
+
+// Dedupe removes all but the last gauge sample for each series from
+// the batch. A series is identified by the sample's name, scope and
+// tags (regardless of the order the tags were set in). Since only the
+// latest value of a gauge is reported, this shrinks batches that set
+// the same gauge many times without changing what gets reported.
+//
+// The remaining samples keep their relative order. Samples of other
+// types are left untouched; to combine counters, use SumCounters. A
+// nil *Samples is left alone.
+func (s *Samples) Dedupe() {
+	if s == nil {
+		return
+	}
+	last := map[string]int{}
+	for i, sample := range s.Batch {
+		if sample.Metric == SSFSample_GAUGE {
+			last[seriesKey(sample)] = i
+		}
+	}
+	kept := s.Batch[:0]
+	for i, sample := range s.Batch {
+		if sample.Metric == SSFSample_GAUGE && last[seriesKey(sample)] != i {
+			continue
+		}
+		kept = append(kept, sample)
+	}
+	s.clearTail(len(kept))
+	s.Batch = kept
+}
+
+// SumCounters combines all counter samples in the batch that belong
+// to the same series and have the same sample rate into one sample
+// whose value is the sum of their values. Series are identified the
+// same way as for Dedupe. The combined sample takes the place of the
+// first sample of its series in the batch; samples of other types are
+// left untouched.
+//
+// SumCounters modifies the first sample of each series in place. A nil
+// *Samples is left alone.
+func (s *Samples) SumCounters() {
+	if s == nil {
+		return
+	}
+	first := map[string]*SSFSample{}
+	kept := s.Batch[:0]
+	for _, sample := range s.Batch {
+		if sample.Metric != SSFSample_COUNTER {
+			kept = append(kept, sample)
+			continue
+		}
+		key := seriesKey(sample) + "\x00" + strconv.FormatFloat(float64(sample.SampleRate), 'g', -1, 32)
+		sum, ok := first[key]
+		if !ok {
+			first[key] = sample
+			kept = append(kept, sample)
+			continue
+		}
+		if sum.DoubleValue != 0 || sample.DoubleValue != 0 {
+			sum.DoubleValue = sum.value() + sample.value()
+		}
+		sum.Value += sample.Value
+	}
+	s.clearTail(len(kept))
+	s.Batch = kept
+}
+
+// value returns the sample's value, preferring DoubleValue if it is
+// set.
+func (s *SSFSample) value() float64 {
+	if s.DoubleValue != 0 {
+		return s.DoubleValue
+	}
+	return float64(s.Value)
+}
+
+// clearTail sets the entries of the batch from n onwards to nil, so
+// that samples removed from the batch can be garbage-collected.
+func (s *Samples) clearTail(n int) {
+	for i := n; i < len(s.Batch); i++ {
+		s.Batch[i] = nil
+	}
+}
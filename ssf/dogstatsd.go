@@ -0,0 +1,84 @@
+package ssf
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// statsdReplacer replaces the characters that delimit the sections
+// and tags of a DogStatsD line.
+var statsdReplacer = strings.NewReplacer(",", "_", "|", "_", "\n", "_")
+
+// DogStatsD renders the sample as a line in DogStatsD's datagram
+// format, "name:value|type|@rate|#key:value,...". Tags are sorted by
+// key, and any commas, pipes or newlines in them are replaced with
+// underscores. The sample rate is omitted if it is 1.
+//
+// Only counters, gauges, histograms, distributions and sets can be
+// rendered this way; DogStatsD has separate encodings for events and
+// service checks, so DogStatsD returns an *InvalidSample error for
+// those.
+func (s *SSFSample) DogStatsD() (string, error) {
+	if s.IsEvent() {
+		return "", &InvalidSample{s, "events have no DogStatsD metric representation"}
+	}
+	typ := s.Metric.DogStatsDType()
+	if typ == "" {
+		return "", &InvalidSample{s, fmt.Sprintf("%s metrics have no DogStatsD representation", s.Metric)}
+	}
+	if s.Name == "" || strings.ContainsAny(s.Name, ":|\n") {
+		return "", &InvalidSample{s, "name can not be represented in DogStatsD"}
+	}
+
+	var value string
+	switch {
+	case s.Metric == SSFSample_SET:
+		if s.Message == "" || strings.ContainsAny(s.Message, "|\n") {
+			return "", &InvalidSample{s, "set member can not be represented in DogStatsD"}
+		}
+		value = s.Message
+	case s.DoubleValue != 0:
+		value = strconv.FormatFloat(s.DoubleValue, 'f', -1, 64)
+	default:
+		value = strconv.FormatFloat(float64(s.Value), 'f', -1, 32)
+	}
+	if s.Metric != SSFSample_SET {
+		for _, v := range []float64{float64(s.Value), s.DoubleValue} {
+			if math.IsNaN(v) || math.IsInf(v, 0) {
+				return "", &InvalidSample{s, fmt.Sprintf("value %v is not finite", v)}
+			}
+		}
+	}
+
+	var line bytes.Buffer
+	line.WriteString(s.Name)
+	line.WriteByte(':')
+	line.WriteString(value)
+	line.WriteByte('|')
+	line.WriteString(typ)
+	if s.SampleRate != 0 && s.SampleRate != 1 {
+		line.WriteString("|@")
+		line.WriteString(strconv.FormatFloat(float64(s.SampleRate), 'f', -1, 32))
+	}
+	if len(s.Tags) > 0 {
+		keys := make([]string, 0, len(s.Tags))
+		for key := range s.Tags {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		line.WriteString("|#")
+		for i, key := range keys {
+			if i > 0 {
+				line.WriteByte(',')
+			}
+			line.WriteString(statsdReplacer.Replace(key))
+			line.WriteByte(':')
+			line.WriteString(statsdReplacer.Replace(s.Tags[key]))
+		}
+	}
+	return line.String(), nil
+}
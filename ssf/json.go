@@ -0,0 +1,59 @@
+package ssf
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// unmarshalEnum decodes an enum value from JSON, given either as its
+// number or as its name, case-insensitively, like "COUNTER" or
+// "counter".
+func unmarshalEnum(data []byte, kind string, values map[string]int32) (int32, error) {
+	var n int32
+	if err := json.Unmarshal(data, &n); err == nil {
+		return n, nil
+	}
+	var name string
+	if err := json.Unmarshal(data, &name); err != nil {
+		return 0, fmt.Errorf("%s must be a number or a name, not %s", kind, data)
+	}
+	n, ok := values[strings.ToUpper(name)]
+	if !ok {
+		return 0, fmt.Errorf("unknown %s %q", kind, name)
+	}
+	return n, nil
+}
+
+// UnmarshalJSON decodes a metric type given as its number, or as its
+// name like "COUNTER".
+func (t *SSFSample_Metric) UnmarshalJSON(data []byte) error {
+	n, err := unmarshalEnum(data, "metric type", SSFSample_Metric_value)
+	if err != nil {
+		return err
+	}
+	*t = SSFSample_Metric(n)
+	return nil
+}
+
+// UnmarshalJSON decodes a status given as its number, or as its name
+// like "WARNING".
+func (s *SSFSample_Status) UnmarshalJSON(data []byte) error {
+	n, err := unmarshalEnum(data, "status", SSFSample_Status_value)
+	if err != nil {
+		return err
+	}
+	*s = SSFSample_Status(n)
+	return nil
+}
+
+// UnmarshalJSON decodes a scope given as its number, or as its name
+// like "GLOBAL".
+func (s *SSFSample_Scope) UnmarshalJSON(data []byte) error {
+	n, err := unmarshalEnum(data, "scope", SSFSample_Scope_value)
+	if err != nil {
+		return err
+	}
+	*s = SSFSample_Scope(n)
+	return nil
+}
@@ -0,0 +1,27 @@
+package ssf
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnmarshalSampleJSON(t *testing.T) {
+	var samples []SSFSample
+	require.NoError(t, json.Unmarshal([]byte(`[
+		{"metric": 1, "name": "a.gauge", "value": 2},
+		{"metric": "histogram", "name": "a.histogram", "scope": "GLOBAL"},
+		{"metric": "STATUS", "name": "a.check", "status": "warning"}
+	]`), &samples))
+	assert.Equal(t, SSFSample_GAUGE, samples[0].Metric)
+	assert.Equal(t, SSFSample_HISTOGRAM, samples[1].Metric)
+	assert.Equal(t, SSFSample_GLOBAL, samples[1].Scope)
+	assert.Equal(t, SSFSample_STATUS, samples[2].Metric)
+	assert.Equal(t, SSFSample_WARNING, samples[2].Status)
+
+	var sample SSFSample
+	assert.Error(t, json.Unmarshal([]byte(`{"metric": "timer"}`), &sample))
+	assert.Error(t, json.Unmarshal([]byte(`{"metric": true}`), &sample))
+}
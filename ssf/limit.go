@@ -0,0 +1,74 @@
+package ssf
+
+import (
+	"sort"
+	"unicode/utf8"
+)
+
+// LimitTags clamps the span's tags to at most maxTags tags, with keys
+// and values of at most maxLength bytes each. A limit of 0 disables
+// that limit.
+//
+// Tags are kept in the order of their keys, so that the tags that are
+// dropped from a span with too many are the same every time: the ones
+// whose keys sort last. Keys and values that are too long are cut at
+// the last UTF-8 character that fits. If cutting a key makes it equal
+// to a key that was kept already, its tag is dropped.
+//
+// LimitTags returns the number of tags that it dropped, and the number
+// of tags whose key or value it truncated.
+func (s *SSFSpan) LimitTags(maxTags, maxLength int) (dropped, truncated int) {
+	fewEnough := maxTags <= 0 || len(s.Tags) <= maxTags
+	if fewEnough && (maxLength <= 0 || !anyLonger(s.Tags, maxLength)) {
+		return 0, 0
+	}
+
+	keys := make([]string, 0, len(s.Tags))
+	for k := range s.Tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	tags := make(map[string]string, len(keys))
+	for _, k := range keys {
+		if maxTags > 0 && len(tags) == maxTags {
+			dropped++
+			continue
+		}
+		key, value := truncate(k, maxLength), truncate(s.Tags[k], maxLength)
+		if _, ok := tags[key]; ok {
+			dropped++
+			continue
+		}
+		if key != k || value != s.Tags[k] {
+			truncated++
+		}
+		tags[key] = value
+	}
+	s.Tags = tags
+	return dropped, truncated
+}
+
+// anyLonger returns true if any key or value in tags is longer than
+// maxLength bytes.
+func anyLonger(tags map[string]string, maxLength int) bool {
+	for k, v := range tags {
+		if len(k) > maxLength || len(v) > maxLength {
+			return true
+		}
+	}
+	return false
+}
+
+// truncate cuts s to at most maxLength bytes, without splitting a
+// UTF-8 character. If maxLength is 0, s is returned unchanged.
+func truncate(s string, maxLength int) string {
+	if maxLength <= 0 || len(s) <= maxLength {
+		return s
+	}
+	end := maxLength
+	for end > 0 && !utf8.RuneStart(s[end]) {
+		end--
+	}
+	return s[:end]
+}
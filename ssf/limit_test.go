@@ -0,0 +1,88 @@
+package ssf
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimitTags(t *testing.T) {
+	tests := []struct {
+		name      string
+		tags      map[string]string
+		maxTags   int
+		maxLength int
+		want      map[string]string
+		dropped   int
+		truncated int
+	}{
+		{
+			name: "no limits",
+			tags: map[string]string{"a": "1", "b": "2"},
+			want: map[string]string{"a": "1", "b": "2"},
+		},
+		{
+			name:      "within limits",
+			tags:      map[string]string{"a": "1", "b": "2"},
+			maxTags:   2,
+			maxLength: 1,
+			want:      map[string]string{"a": "1", "b": "2"},
+		},
+		{
+			name:    "too many tags",
+			tags:    map[string]string{"d": "4", "b": "2", "c": "3", "a": "1"},
+			maxTags: 2,
+			want:    map[string]string{"a": "1", "b": "2"},
+			dropped: 2,
+		},
+		{
+			name:      "too long",
+			tags:      map[string]string{"service": "veneur", "az": "us-west-2a"},
+			maxLength: 4,
+			want:      map[string]string{"serv": "vene", "az": "us-w"},
+			truncated: 2,
+		},
+		{
+			name:      "truncated at a character boundary",
+			tags:      map[string]string{"city": "Zürich"},
+			maxLength: 2,
+			want:      map[string]string{"ci": "Z"},
+			truncated: 1,
+		},
+		{
+			name:      "truncated keys collide",
+			tags:      map[string]string{"host": "a", "hostname": "b"},
+			maxLength: 4,
+			want:      map[string]string{"host": "a"},
+			dropped:   1,
+		},
+	}
+	for _, elt := range tests {
+		test := elt
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			span := &SSFSpan{Tags: test.tags}
+			dropped, truncated := span.LimitTags(test.maxTags, test.maxLength)
+			assert.Equal(t, test.want, span.Tags)
+			assert.Equal(t, test.dropped, dropped, "dropped")
+			assert.Equal(t, test.truncated, truncated, "truncated")
+		})
+	}
+}
+
+func TestLimitTagsDeterministic(t *testing.T) {
+	tags := map[string]string{}
+	for i := 0; i < 1000; i++ {
+		tags[fmt.Sprintf("tag%03d", i)] = "x"
+	}
+	for i := 0; i < 10; i++ {
+		span := &SSFSpan{Tags: map[string]string{}}
+		for k, v := range tags {
+			span.Tags[k] = v
+		}
+		dropped, _ := span.LimitTags(3, 0)
+		assert.Equal(t, 997, dropped)
+		assert.Equal(t, map[string]string{"tag000": "x", "tag001": "x", "tag002": "x"}, span.Tags)
+	}
+}
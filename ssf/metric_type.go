@@ -0,0 +1,38 @@
+package ssf
+
+var shortNames = map[SSFSample_Metric]string{
+	SSFSample_COUNTER:      "counter",
+	SSFSample_GAUGE:        "gauge",
+	SSFSample_HISTOGRAM:    "histogram",
+	SSFSample_SET:          "set",
+	SSFSample_STATUS:       "status",
+	SSFSample_DISTRIBUTION: "distribution",
+}
+
+var statsdTypes = map[SSFSample_Metric]string{
+	SSFSample_COUNTER:      "c",
+	SSFSample_GAUGE:        "g",
+	SSFSample_HISTOGRAM:    "h",
+	SSFSample_DISTRIBUTION: "d",
+	SSFSample_SET:          "s",
+}
+
+// ShortName returns a lower-case, human-readable name for the metric
+// type, like "counter" for SSFSample_COUNTER, suitable for log
+// messages and tags. Metric types unknown to this package are named
+// "unknown".
+func (t SSFSample_Metric) ShortName() string {
+	if name, ok := shortNames[t]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+// DogStatsDType returns the letter that denotes the metric type in
+// DogStatsD's datagram format, like "c" for SSFSample_COUNTER. It
+// returns the empty string for types that have no DogStatsD metric
+// representation, like SSFSample_STATUS (which DogStatsD encodes as a
+// service check instead).
+func (t SSFSample_Metric) DogStatsDType() string {
+	return statsdTypes[t]
+}
@@ -0,0 +1,31 @@
+package ssf
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShortName(t *testing.T) {
+	// every metric type in the protobuf definition needs a name:
+	for value, protoName := range SSFSample_Metric_name {
+		assert.NotEqual(t, "unknown", SSFSample_Metric(value).ShortName(), protoName)
+	}
+	assert.Equal(t, "counter", SSFSample_COUNTER.ShortName())
+	assert.Equal(t, "distribution", SSFSample_DISTRIBUTION.ShortName())
+	assert.Equal(t, "unknown", SSFSample_Metric(99).ShortName())
+}
+
+func TestDogStatsDType(t *testing.T) {
+	for value, protoName := range SSFSample_Metric_name {
+		metric := SSFSample_Metric(value)
+		if metric == SSFSample_STATUS {
+			assert.Equal(t, "", metric.DogStatsDType())
+			continue
+		}
+		assert.NotEqual(t, "", metric.DogStatsDType(), protoName)
+	}
+	assert.Equal(t, "c", SSFSample_COUNTER.DogStatsDType())
+	assert.Equal(t, "d", SSFSample_DISTRIBUTION.DogStatsDType())
+	assert.Equal(t, "", SSFSample_Metric(99).DogStatsDType())
+}
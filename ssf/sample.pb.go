@@ -40,6 +40,9 @@ const (
 	SSFSample_HISTOGRAM SSFSample_Metric = 2
 	SSFSample_SET       SSFSample_Metric = 3
 	SSFSample_STATUS    SSFSample_Metric = 4
+	// A DISTRIBUTION is a histogram that is always aggregated
+	// globally, across all hosts reporting it.
+	SSFSample_DISTRIBUTION SSFSample_Metric = 5
 )
 
 var SSFSample_Metric_name = map[int32]string{
@@ -48,13 +51,15 @@ var SSFSample_Metric_name = map[int32]string{
 	2: "HISTOGRAM",
 	3: "SET",
 	4: "STATUS",
+	5: "DISTRIBUTION",
 }
 var SSFSample_Metric_value = map[string]int32{
-	"COUNTER":   0,
-	"GAUGE":     1,
-	"HISTOGRAM": 2,
-	"SET":       3,
-	"STATUS":    4,
+	"COUNTER":      0,
+	"GAUGE":        1,
+	"HISTOGRAM":    2,
+	"SET":          3,
+	"STATUS":       4,
+	"DISTRIBUTION": 5,
 }
 
 func (x SSFSample_Metric) String() string {
@@ -89,6 +94,34 @@ func (x SSFSample_Status) String() string {
 }
 func (SSFSample_Status) EnumDescriptor() ([]byte, []int) { return fileDescriptorSample, []int{0, 1} }
 
+type SSFSample_Scope int32
+
+const (
+	// Let veneur decide where to aggregate the metric, based on
+	// its type and tags.
+	SSFSample_DEFAULT SSFSample_Scope = 0
+	// Aggregate the metric only on the local veneur instance.
+	SSFSample_LOCAL SSFSample_Scope = 1
+	// Aggregate the metric only on the global veneur instance.
+	SSFSample_GLOBAL SSFSample_Scope = 2
+)
+
+var SSFSample_Scope_name = map[int32]string{
+	0: "DEFAULT",
+	1: "LOCAL",
+	2: "GLOBAL",
+}
+var SSFSample_Scope_value = map[string]int32{
+	"DEFAULT": 0,
+	"LOCAL":   1,
+	"GLOBAL":  2,
+}
+
+func (x SSFSample_Scope) String() string {
+	return proto.EnumName(SSFSample_Scope_name, int32(x))
+}
+func (SSFSample_Scope) EnumDescriptor() ([]byte, []int) { return fileDescriptorSample, []int{0, 2} }
+
 // SSFSample is similar of a StatsD-style, point in time metric. It has a Metric
 // type, a name, a value and a timestamp. Additionally it can contain a message,
 // a status, a sample rate, a map of tags as string keys and values and a unit
@@ -106,6 +139,17 @@ type SSFSample struct {
 	SampleRate float32           `protobuf:"fixed32,7,opt,name=sample_rate,json=sampleRate,proto3" json:"sample_rate,omitempty"`
 	Tags       map[string]string `protobuf:"bytes,8,rep,name=tags" json:"tags,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
 	Unit       string            `protobuf:"bytes,9,opt,name=unit,proto3" json:"unit,omitempty"`
+	// Where the metric should be aggregated. A non-DEFAULT scope takes
+	// precedence over the "veneurlocalonly" and "veneurglobalonly" tags.
+	Scope SSFSample_Scope `protobuf:"varint,10,opt,name=scope,proto3,enum=ssf.SSFSample_Scope" json:"scope,omitempty"`
+	// A higher-precision version of value. If it is non-zero, it takes
+	// precedence over value.
+	DoubleValue float64 `protobuf:"fixed64,11,opt,name=double_value,json=doubleValue,proto3" json:"double_value,omitempty"`
+	// For histograms and distributions, the percentiles (in the
+	// interval (0..1)) that the sender is interested in. If any are
+	// given, Veneur only reports those of its configured percentiles
+	// that are listed here.
+	Percentiles []float64 `protobuf:"fixed64,12,rep,packed,name=percentiles" json:"percentiles,omitempty"`
 }
 
 func (m *SSFSample) Reset()                    { *m = SSFSample{} }
@@ -176,6 +220,27 @@ func (m *SSFSample) GetUnit() string {
 	return ""
 }
 
+func (m *SSFSample) GetScope() SSFSample_Scope {
+	if m != nil {
+		return m.Scope
+	}
+	return SSFSample_DEFAULT
+}
+
+func (m *SSFSample) GetDoubleValue() float64 {
+	if m != nil {
+		return m.DoubleValue
+	}
+	return 0
+}
+
+func (m *SSFSample) GetPercentiles() []float64 {
+	if m != nil {
+		return m.Percentiles
+	}
+	return nil
+}
+
 // SSFSpan is the primary unit of reporting in SSF. It embeds a set of
 // SSFSamples, as well as start/stop time stamps and a parent ID
 // (which allows assembling a span lineage for distributed tracing
@@ -336,6 +401,7 @@ func init() {
 	proto.RegisterType((*SSFSpan)(nil), "ssf.SSFSpan")
 	proto.RegisterEnum("ssf.SSFSample_Metric", SSFSample_Metric_name, SSFSample_Metric_value)
 	proto.RegisterEnum("ssf.SSFSample_Status", SSFSample_Status_name, SSFSample_Status_value)
+	proto.RegisterEnum("ssf.SSFSample_Scope", SSFSample_Scope_name, SSFSample_Scope_value)
 }
 func (m *SSFSample) Marshal() (dAtA []byte, err error) {
 	size := m.Size()
@@ -414,6 +480,27 @@ func (m *SSFSample) MarshalTo(dAtA []byte) (int, error) {
 		i = encodeVarintSample(dAtA, i, uint64(len(m.Unit)))
 		i += copy(dAtA[i:], m.Unit)
 	}
+	if m.Scope != 0 {
+		dAtA[i] = 0x50
+		i++
+		i = encodeVarintSample(dAtA, i, uint64(m.Scope))
+	}
+	if m.DoubleValue != 0 {
+		dAtA[i] = 0x59
+		i++
+		encoding_binary.LittleEndian.PutUint64(dAtA[i:], uint64(math.Float64bits(float64(m.DoubleValue))))
+		i += 8
+	}
+	if len(m.Percentiles) > 0 {
+		dAtA[i] = 0x62
+		i++
+		i = encodeVarintSample(dAtA, i, uint64(len(m.Percentiles)*8))
+		for _, num := range m.Percentiles {
+			f1 := math.Float64bits(float64(num))
+			encoding_binary.LittleEndian.PutUint64(dAtA[i:], uint64(f1))
+			i += 8
+		}
+	}
 	return i, nil
 }
 
@@ -573,6 +660,15 @@ func (m *SSFSample) Size() (n int) {
 	if l > 0 {
 		n += 1 + l + sovSample(uint64(l))
 	}
+	if m.Scope != 0 {
+		n += 1 + sovSample(uint64(m.Scope))
+	}
+	if m.DoubleValue != 0 {
+		n += 9
+	}
+	if len(m.Percentiles) > 0 {
+		n += 1 + sovSample(uint64(len(m.Percentiles)*8)) + len(m.Percentiles)*8
+	}
 	return n
 }
 
@@ -954,6 +1050,82 @@ func (m *SSFSample) Unmarshal(dAtA []byte) error {
 			}
 			m.Unit = string(dAtA[iNdEx:postIndex])
 			iNdEx = postIndex
+		case 10:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Scope", wireType)
+			}
+			m.Scope = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowSample
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.Scope |= (SSFSample_Scope(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 11:
+			if wireType != 1 {
+				return fmt.Errorf("proto: wrong wireType = %d for field DoubleValue", wireType)
+			}
+			var v uint64
+			if (iNdEx + 8) > l {
+				return io.ErrUnexpectedEOF
+			}
+			v = uint64(encoding_binary.LittleEndian.Uint64(dAtA[iNdEx:]))
+			iNdEx += 8
+			m.DoubleValue = float64(math.Float64frombits(v))
+		case 12:
+			if wireType == 1 {
+				var v uint64
+				if (iNdEx + 8) > l {
+					return io.ErrUnexpectedEOF
+				}
+				v = uint64(encoding_binary.LittleEndian.Uint64(dAtA[iNdEx:]))
+				iNdEx += 8
+				v2 := float64(math.Float64frombits(v))
+				m.Percentiles = append(m.Percentiles, v2)
+			} else if wireType == 2 {
+				var packedLen int
+				for shift := uint(0); ; shift += 7 {
+					if shift >= 64 {
+						return ErrIntOverflowSample
+					}
+					if iNdEx >= l {
+						return io.ErrUnexpectedEOF
+					}
+					b := dAtA[iNdEx]
+					iNdEx++
+					packedLen |= (int(b) & 0x7F) << shift
+					if b < 0x80 {
+						break
+					}
+				}
+				if packedLen < 0 {
+					return ErrInvalidLengthSample
+				}
+				postIndex := iNdEx + packedLen
+				if postIndex > l {
+					return io.ErrUnexpectedEOF
+				}
+				for iNdEx < postIndex {
+					var v uint64
+					if (iNdEx + 8) > l {
+						return io.ErrUnexpectedEOF
+					}
+					v = uint64(encoding_binary.LittleEndian.Uint64(dAtA[iNdEx:]))
+					iNdEx += 8
+					v2 := float64(math.Float64frombits(v))
+					m.Percentiles = append(m.Percentiles, v2)
+				}
+			} else {
+				return fmt.Errorf("proto: wrong wireType = %d for field Percentiles", wireType)
+			}
 		default:
 			iNdEx = preIndex
 			skippy, err := skipSample(dAtA[iNdEx:])
@@ -1494,41 +1666,47 @@ var (
 func init() { proto.RegisterFile("ssf/sample.proto", fileDescriptorSample) }
 
 var fileDescriptorSample = []byte{
-	// 573 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x9c, 0x53, 0xdd, 0x6e, 0xd3, 0x30,
-	0x14, 0x5e, 0xe2, 0x36, 0x4d, 0x4e, 0xb7, 0x62, 0x59, 0x03, 0x19, 0x98, 0x4a, 0x55, 0x2e, 0xa8,
-	0x10, 0x14, 0x69, 0x5c, 0x30, 0x71, 0x57, 0x46, 0x29, 0x65, 0x2c, 0x95, 0x9c, 0x54, 0xbb, 0x9c,
-	0x4c, 0xe3, 0x4d, 0x11, 0x4b, 0x1a, 0xd9, 0xde, 0xa4, 0xbd, 0x05, 0x8f, 0xc2, 0x63, 0x70, 0xc9,
-	0x23, 0xa0, 0x71, 0xc1, 0x6b, 0x20, 0xdb, 0x6d, 0xc3, 0xdf, 0x15, 0x77, 0xfe, 0xce, 0xf7, 0xc9,
-	0x3a, 0xdf, 0xf9, 0xce, 0x01, 0xac, 0xd4, 0xd9, 0x33, 0xc5, 0x8b, 0xea, 0x42, 0x0c, 0x2b, 0xb9,
-	0xd4, 0x4b, 0x82, 0x94, 0x3a, 0xeb, 0xff, 0x40, 0x10, 0x25, 0xc9, 0x9b, 0xc4, 0x12, 0xe4, 0x29,
-	0x04, 0x85, 0xd0, 0x32, 0x5f, 0x50, 0xaf, 0xe7, 0x0d, 0x3a, 0xfb, 0xb7, 0x87, 0x4a, 0x9d, 0x0d,
-	0x37, 0xfc, 0xf0, 0xd8, 0x92, 0x6c, 0x25, 0x22, 0x04, 0x1a, 0x25, 0x2f, 0x04, 0xf5, 0x7b, 0xde,
-	0x20, 0x62, 0xf6, 0x4d, 0x76, 0xa1, 0x79, 0xc5, 0x2f, 0x2e, 0x05, 0x45, 0x3d, 0x6f, 0xe0, 0x33,
-	0x07, 0xc8, 0x1e, 0x44, 0x3a, 0x2f, 0x84, 0xd2, 0xbc, 0xa8, 0x68, 0xa3, 0xe7, 0x0d, 0x10, 0xab,
-	0x0b, 0x84, 0x42, 0xab, 0x10, 0x4a, 0xf1, 0x73, 0x41, 0x9b, 0xf6, 0xab, 0x35, 0x34, 0x0d, 0x29,
-	0xcd, 0xf5, 0xa5, 0xa2, 0xc1, 0x3f, 0x1b, 0x4a, 0x2c, 0xc9, 0x56, 0x22, 0xf2, 0x00, 0xda, 0xce,
-	0xe2, 0xa9, 0xe4, 0x5a, 0xd0, 0x96, 0x6d, 0x01, 0x5c, 0x89, 0x71, 0x2d, 0xc8, 0x13, 0x68, 0x68,
-	0x7e, 0xae, 0x68, 0xd8, 0x43, 0x83, 0xf6, 0x3e, 0xfd, 0xe3, 0xb7, 0x94, 0x9f, 0xab, 0x71, 0xa9,
-	0xe5, 0x35, 0xb3, 0x2a, 0xe3, 0xef, 0xb2, 0xcc, 0x35, 0x8d, 0x9c, 0x3f, 0xf3, 0xbe, 0xf7, 0x02,
-	0xa2, 0x8d, 0x8c, 0x60, 0x40, 0x1f, 0xc5, 0xb5, 0x1d, 0x56, 0xc4, 0xcc, 0xb3, 0xb6, 0xef, 0x66,
-	0xe2, 0xc0, 0x4b, 0xff, 0xc0, 0xeb, 0xbf, 0x86, 0xc0, 0x8d, 0x8f, 0xb4, 0xa1, 0x75, 0x38, 0x9b,
-	0xc7, 0xe9, 0x98, 0xe1, 0x2d, 0x12, 0x41, 0x73, 0x32, 0x9a, 0x4f, 0xc6, 0xd8, 0x23, 0x3b, 0x10,
-	0xbd, 0x9d, 0x26, 0xe9, 0x6c, 0xc2, 0x46, 0xc7, 0xd8, 0x27, 0x2d, 0x40, 0xc9, 0x38, 0xc5, 0x88,
-	0x00, 0x04, 0x49, 0x3a, 0x4a, 0xe7, 0x09, 0x6e, 0xf4, 0x0f, 0x20, 0x70, 0x9e, 0x49, 0x00, 0xfe,
-	0xec, 0x08, 0x6f, 0x99, 0xdf, 0x4e, 0x46, 0x2c, 0x9e, 0xc6, 0x13, 0xec, 0x91, 0x6d, 0x08, 0x0f,
-	0xd9, 0x34, 0x9d, 0x1e, 0x8e, 0xde, 0x63, 0xdf, 0x50, 0xf3, 0xf8, 0x28, 0x9e, 0x9d, 0xc4, 0x18,
-	0xf5, 0x3f, 0x23, 0x68, 0x19, 0xab, 0x15, 0x2f, 0xcd, 0xc0, 0xaf, 0x84, 0x54, 0xf9, 0xb2, 0xb4,
-	0xbd, 0x37, 0xd9, 0x1a, 0x92, 0xbb, 0x10, 0x6a, 0xc9, 0x17, 0xe2, 0x34, 0xcf, 0xac, 0x05, 0xc4,
-	0x5a, 0x16, 0x4f, 0x33, 0xd2, 0x01, 0x3f, 0xcf, 0x6c, 0xac, 0x88, 0xf9, 0x79, 0x46, 0xee, 0x43,
-	0x54, 0x71, 0x29, 0x4a, 0x6d, 0xb4, 0x2e, 0xd3, 0xd0, 0x15, 0xa6, 0x19, 0x79, 0x04, 0xb7, 0x94,
-	0xe6, 0x52, 0x9f, 0xd6, 0xb1, 0x37, 0xad, 0xa4, 0x63, 0xcb, 0xe9, 0x26, 0xfb, 0x87, 0xb0, 0x23,
-	0xca, 0xec, 0x17, 0x59, 0x60, 0x65, 0xdb, 0xa2, 0xcc, 0x6a, 0xd1, 0x2e, 0x34, 0x85, 0x94, 0x4b,
-	0x69, 0x13, 0x0d, 0x99, 0x03, 0xc6, 0x85, 0x12, 0xf2, 0x2a, 0x5f, 0x08, 0x1a, 0xba, 0xb5, 0x59,
-	0x41, 0x32, 0x30, 0x0b, 0x65, 0x66, 0xad, 0x28, 0xd8, 0xa4, 0x3b, 0xbf, 0x27, 0xcd, 0xd6, 0x34,
-	0x79, 0xbc, 0x5a, 0x88, 0xb6, 0x95, 0xdd, 0xd9, 0xc8, 0x2a, 0x5e, 0xfe, 0xb5, 0x0e, 0x7b, 0x10,
-	0xe5, 0x65, 0x96, 0x2f, 0xb8, 0x5e, 0x4a, 0xba, 0x6d, 0x3b, 0xa9, 0x0b, 0x9b, 0x63, 0xd8, 0xa9,
-	0x8f, 0xe1, 0xbf, 0x97, 0xe5, 0x5d, 0x23, 0x8c, 0x30, 0xbc, 0xc2, 0x5f, 0x6e, 0xba, 0xde, 0xd7,
-	0x9b, 0xae, 0xf7, 0xed, 0xa6, 0xeb, 0x7d, 0xfa, 0xde, 0xdd, 0xfa, 0x10, 0xd8, 0xd3, 0x7d, 0xfe,
-	0x33, 0x00, 0x00, 0xff, 0xff, 0xa8, 0x9e, 0x3e, 0x57, 0xce, 0x03, 0x00, 0x00,
+	// 672 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x9c, 0x54, 0xcd, 0x6e, 0xd3, 0x4c,
+	0x14, 0xad, 0xed, 0xd8, 0x89, 0x6f, 0xd2, 0x7c, 0xa3, 0x51, 0xbf, 0x4f, 0xf3, 0x41, 0x15, 0x4c,
+	0x58, 0x10, 0x15, 0x08, 0x52, 0x59, 0x50, 0xb1, 0x4b, 0xdb, 0x34, 0x98, 0xa6, 0x89, 0x34, 0x76,
+	0xda, 0x65, 0x34, 0x8d, 0xa7, 0x95, 0x45, 0xe2, 0x58, 0x9e, 0x49, 0xa5, 0xbe, 0x05, 0x3b, 0x5e,
+	0x83, 0xc7, 0x60, 0xc9, 0x23, 0xa0, 0xf2, 0x22, 0x68, 0x66, 0xf2, 0x53, 0x0a, 0x2b, 0x76, 0x73,
+	0xcf, 0x3d, 0x99, 0x9c, 0x7b, 0xee, 0x19, 0x03, 0x12, 0xe2, 0xea, 0xb5, 0x60, 0xb3, 0x7c, 0xca,
+	0xdb, 0x79, 0x31, 0x97, 0x73, 0xec, 0x08, 0x71, 0xd5, 0xfc, 0xec, 0x82, 0x1f, 0x45, 0x27, 0x91,
+	0x6e, 0xe0, 0x57, 0xe0, 0xcd, 0xb8, 0x2c, 0xd2, 0x09, 0xb1, 0x02, 0xab, 0x55, 0xdf, 0xff, 0xb7,
+	0x2d, 0xc4, 0x55, 0x7b, 0xdd, 0x6f, 0x9f, 0xe9, 0x26, 0x5d, 0x92, 0x30, 0x86, 0x52, 0xc6, 0x66,
+	0x9c, 0xd8, 0x81, 0xd5, 0xf2, 0xa9, 0x3e, 0xe3, 0x1d, 0x70, 0x6f, 0xd8, 0x74, 0xc1, 0x89, 0x13,
+	0x58, 0x2d, 0x9b, 0x9a, 0x02, 0xef, 0x82, 0x2f, 0xd3, 0x19, 0x17, 0x92, 0xcd, 0x72, 0x52, 0x0a,
+	0xac, 0x96, 0x43, 0x37, 0x00, 0x26, 0x50, 0x9e, 0x71, 0x21, 0xd8, 0x35, 0x27, 0xae, 0xbe, 0x6a,
+	0x55, 0x2a, 0x41, 0x42, 0x32, 0xb9, 0x10, 0xc4, 0xfb, 0xa3, 0xa0, 0x48, 0x37, 0xe9, 0x92, 0x84,
+	0x9f, 0x40, 0xd5, 0x8c, 0x38, 0x2e, 0x98, 0xe4, 0xa4, 0xac, 0x25, 0x80, 0x81, 0x28, 0x93, 0x1c,
+	0xbf, 0x84, 0x92, 0x64, 0xd7, 0x82, 0x54, 0x02, 0xa7, 0x55, 0xdd, 0x27, 0x0f, 0x6e, 0x8b, 0xd9,
+	0xb5, 0xe8, 0x66, 0xb2, 0xb8, 0xa5, 0x9a, 0xa5, 0xe6, 0x5b, 0x64, 0xa9, 0x24, 0xbe, 0x99, 0x4f,
+	0x9d, 0xf1, 0x1e, 0xb8, 0x62, 0x32, 0xcf, 0x39, 0x01, 0x2d, 0x68, 0xe7, 0xa1, 0x20, 0xd5, 0xa3,
+	0x86, 0x82, 0x9f, 0x42, 0x2d, 0x99, 0x2f, 0x2e, 0xa7, 0x7c, 0x6c, 0x2c, 0xa9, 0x06, 0x56, 0xcb,
+	0xa2, 0x55, 0x83, 0x9d, 0x6b, 0x63, 0x02, 0xa8, 0xe6, 0xbc, 0x98, 0xf0, 0x4c, 0xa6, 0x53, 0x2e,
+	0x48, 0x2d, 0x70, 0x14, 0xe3, 0x1e, 0xf4, 0xe8, 0x2d, 0xf8, 0x6b, 0x5d, 0x18, 0x81, 0xf3, 0x91,
+	0xdf, 0xea, 0xed, 0xf8, 0x54, 0x1d, 0x37, 0x7e, 0x9b, 0x25, 0x98, 0xe2, 0x9d, 0x7d, 0x60, 0x35,
+	0xcf, 0xc1, 0x33, 0xfb, 0xc2, 0x55, 0x28, 0x1f, 0x0d, 0x47, 0x83, 0xb8, 0x4b, 0xd1, 0x16, 0xf6,
+	0xc1, 0xed, 0x75, 0x46, 0xbd, 0x2e, 0xb2, 0xf0, 0x36, 0xf8, 0xef, 0xc3, 0x28, 0x1e, 0xf6, 0x68,
+	0xe7, 0x0c, 0xd9, 0xb8, 0x0c, 0x4e, 0xd4, 0x8d, 0x91, 0x83, 0x01, 0xbc, 0x28, 0xee, 0xc4, 0xa3,
+	0x08, 0x95, 0x30, 0x82, 0xda, 0x71, 0x18, 0xc5, 0x34, 0x3c, 0x1c, 0xc5, 0xe1, 0x70, 0x80, 0xdc,
+	0xe6, 0x01, 0x78, 0xc6, 0x76, 0xec, 0x81, 0x3d, 0x3c, 0x45, 0x5b, 0xea, 0xfe, 0x8b, 0x0e, 0x1d,
+	0x84, 0x83, 0x1e, 0xb2, 0x70, 0x0d, 0x2a, 0x47, 0x34, 0x8c, 0xc3, 0xa3, 0x4e, 0x1f, 0xd9, 0xaa,
+	0x35, 0x1a, 0x9c, 0x0e, 0x86, 0x17, 0x03, 0xe4, 0x34, 0x5f, 0x80, 0xab, 0xfd, 0x51, 0xe8, 0x71,
+	0xf7, 0xa4, 0x33, 0xea, 0xc7, 0x46, 0x50, 0x7f, 0xa8, 0xd8, 0x96, 0xfa, 0xe3, 0x5e, 0x7f, 0x78,
+	0xa8, 0x7e, 0xd9, 0xfc, 0xe2, 0x40, 0x59, 0xf9, 0x9a, 0xb3, 0x4c, 0x05, 0xe4, 0x86, 0x17, 0x22,
+	0x9d, 0x67, 0x7a, 0x74, 0x97, 0xae, 0x4a, 0xfc, 0x3f, 0x54, 0x64, 0xc1, 0x26, 0x7c, 0x9c, 0x26,
+	0xda, 0x01, 0x87, 0x96, 0x75, 0x1d, 0x26, 0xb8, 0x0e, 0x76, 0x9a, 0xe8, 0x18, 0x3a, 0xd4, 0x4e,
+	0x13, 0xfc, 0x18, 0xfc, 0x9c, 0x15, 0x3c, 0x93, 0x8a, 0x6b, 0x32, 0x58, 0x31, 0x40, 0x98, 0xe0,
+	0xe7, 0xf0, 0x8f, 0x90, 0xac, 0x90, 0xe3, 0x4d, 0x4c, 0x5d, 0x4d, 0xa9, 0x6b, 0x38, 0x5e, 0xa1,
+	0xf8, 0x19, 0x6c, 0xf3, 0x2c, 0xb9, 0x47, 0xf3, 0x34, 0xad, 0xc6, 0xb3, 0x64, 0x43, 0xda, 0x01,
+	0x97, 0x17, 0xc5, 0xbc, 0xd0, 0x09, 0xac, 0x50, 0x53, 0xa8, 0x29, 0x04, 0x2f, 0x6e, 0xd2, 0x09,
+	0x27, 0x15, 0x13, 0xf3, 0x65, 0x89, 0x5b, 0xea, 0x01, 0xa8, 0x55, 0x09, 0x02, 0x3a, 0x99, 0xf5,
+	0x5f, 0x63, 0x45, 0x57, 0x6d, 0xbc, 0xb7, 0x0c, 0x70, 0x55, 0xd3, 0xfe, 0x5b, 0xd3, 0x72, 0x96,
+	0xfd, 0x16, 0xdf, 0x5d, 0xf0, 0xd3, 0x2c, 0x49, 0x27, 0x4c, 0xce, 0x0b, 0x52, 0xd3, 0x4a, 0x36,
+	0xc0, 0xfa, 0xf1, 0x6e, 0x6f, 0x1e, 0xef, 0x5f, 0x67, 0xed, 0x43, 0xa9, 0xe2, 0x23, 0x38, 0x44,
+	0x5f, 0xef, 0x1a, 0xd6, 0xb7, 0xbb, 0x86, 0xf5, 0xfd, 0xae, 0x61, 0x7d, 0xfa, 0xd1, 0xd8, 0xba,
+	0xf4, 0xf4, 0xa7, 0xe6, 0xcd, 0xcf, 0x01, 0x00, 0x9a, 0xf6, 0x1e, 0x70, 0x7e, 0x04, 0x00, 0x00,
 }
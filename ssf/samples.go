@@ -1,9 +1,12 @@
 package ssf
 
 import (
+	"hash/fnv"
 	"math/rand"
 	"sync"
 	"time"
+
+	"github.com/stripe/veneur/protocol/dogstatsd"
 )
 
 var rngPool = sync.Pool{
@@ -20,16 +23,239 @@ func defaultRandFloat32() float32 {
 
 // Samples is a batch of SSFSamples, not attached to an SSF span, that
 // can be submitted with package metrics's Report function.
+//
+// Samples is not safe for concurrent use; use SyncSamples to collect
+// samples from multiple goroutines.
 type Samples struct {
 	Batch []*SSFSample
+
+	prefix string
 }
 
-// Add appends a sample to the batch of samples.
+// NewPrefixedSamples returns an empty batch of samples that prepends
+// prefix to the name of every sample added to it. This lets a process
+// namespace the metrics of several logical services independently of
+// each other.
+//
+// The batch's prefix is applied in addition to the global NamePrefix:
+// NamePrefix is prepended when a sample is constructed, and the
+// batch's prefix is prepended to that when it is added, so a sample
+// ends up named prefix + NamePrefix + name. As with NamePrefix, no
+// separator is added after prefix.
+func NewPrefixedSamples(prefix string) *Samples {
+	return &Samples{prefix: prefix}
+}
+
+// Add appends a sample to the batch of samples. If the batch was
+// created with NewPrefixedSamples, Add appends copies of the samples
+// with the batch's prefix prepended to their names (but not to the
+// titles of events), leaving the samples that were passed in as they
+// are. The copies share their tags with the originals.
 func (s *Samples) Add(sample ...*SSFSample) {
 	if s.Batch == nil {
 		s.Batch = []*SSFSample{}
 	}
-	s.Batch = append(s.Batch, sample...)
+	if s.prefix == "" {
+		s.Batch = append(s.Batch, sample...)
+		return
+	}
+	for _, smp := range sample {
+		if !smp.IsEvent() {
+			prefixed := *smp
+			prefixed.Name = s.prefix + smp.Name
+			smp = &prefixed
+		}
+		s.Batch = append(s.Batch, smp)
+	}
+}
+
+// AddCount adds delta to the counter named name with exactly the
+// tags given (the tag maps must be equal) in the batch, or appends a
+// new counter sample for it if the batch has none yet. This keeps
+// batches small when the same counter is incremented many times
+// between reports. Only counters created with the default sample rate
+// and scope are added to.
+//
+// AddCount scans the whole batch to find a matching counter, so it
+// is best suited for small batches.
+func (s *Samples) AddCount(name string, delta float32, tags map[string]string) {
+	sample := Count(name, delta, tags)
+	fullName := s.prefix + sample.Name
+	for _, existing := range s.Batch {
+		if existing.Metric == SSFSample_COUNTER && existing.Name == fullName &&
+			existing.SampleRate == 1 && existing.Scope == SSFSample_DEFAULT &&
+			tagsEqual(existing.Tags, tags) {
+			existing.Value += delta
+			if existing.DoubleValue != 0 {
+				existing.DoubleValue += float64(delta)
+			}
+			return
+		}
+	}
+	s.Add(sample)
+}
+
+func tagsEqual(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if bv, ok := b[k]; !ok || bv != v {
+			return false
+		}
+	}
+	return true
+}
+
+// Merge appends all samples in other to the batch of samples, as if
+// they were passed to Add. It is a no-op if either s or other is nil.
+func (s *Samples) Merge(other *Samples) {
+	if s == nil || other == nil {
+		return
+	}
+	s.Add(other.Batch...)
+}
+
+// Len returns the number of samples in the batch. A nil *Samples has
+// length 0.
+func (s *Samples) Len() int {
+	if s == nil {
+		return 0
+	}
+	return len(s.Batch)
+}
+
+// ProtoSize returns the number of bytes that the batch of samples
+// takes up when it is marshaled as the metrics of an SSFSpan. The
+// size is exact, but does not include any of the span's other fields;
+// a span with no other fields set marshals to exactly this size. A
+// nil *Samples has size 0.
+func (s *Samples) ProtoSize() int {
+	if s == nil {
+		return 0
+	}
+	n := 0
+	for _, sample := range s.Batch {
+		n += embeddedSize(sample)
+	}
+	return n
+}
+
+// embeddedSize returns the number of bytes sample takes up as an
+// element of an SSFSpan's metrics.
+func embeddedSize(sample *SSFSample) int {
+	l := sample.Size()
+	// one byte for the field key, plus the length prefix:
+	return 1 + l + sovSample(uint64(l))
+}
+
+// Chunk splits the batch into consecutive sub-batches whose
+// ProtoSize is at most maxBytes each, so that each can be sent in a
+// single datagram. The samples keep their order, and the sub-batches
+// do not share memory with s.
+//
+// A sample that is larger than maxBytes on its own can not be split
+// up: it is returned in a chunk of its own, which is larger than
+// maxBytes, and callers must be prepared to handle (or drop) it. A
+// nil or empty *Samples results in no chunks.
+func (s *Samples) Chunk(maxBytes int) []*Samples {
+	if s.Len() == 0 {
+		return nil
+	}
+	chunks := []*Samples{}
+	var current *Samples
+	currentSize := 0
+	for _, sample := range s.Batch {
+		size := embeddedSize(sample)
+		if current == nil || currentSize+size > maxBytes {
+			current = &Samples{}
+			currentSize = 0
+			chunks = append(chunks, current)
+		}
+		current.Batch = append(current.Batch, sample)
+		currentSize += size
+	}
+	return chunks
+}
+
+// Reset empties the batch of samples, but keeps the memory allocated
+// for it around, so that the Samples can be re-used without
+// re-allocating.
+func (s *Samples) Reset() {
+	if s == nil {
+		return
+	}
+	s.Batch = s.Batch[:0]
+}
+
+var samplesPool = sync.Pool{
+	New: func() interface{} {
+		return &Samples{}
+	},
+}
+
+// GetSamples returns an empty batch of samples from a pool of
+// batches. Batches that were returned to the pool with PutSamples
+// keep their capacity, so re-using them avoids re-allocating the
+// batch on every flush.
+func GetSamples() *Samples {
+	return samplesPool.Get().(*Samples)
+}
+
+// PutSamples resets the batch and returns it to the pool used by
+// GetSamples. Callers must not retain the Samples, or any references
+// to its Batch slice, after putting it back.
+func PutSamples(s *Samples) {
+	if s == nil {
+		return
+	}
+	// Don't let the pooled batch keep the samples alive:
+	s.clearTail(0)
+	s.Reset()
+	s.prefix = ""
+	samplesPool.Put(s)
+}
+
+// SyncSamples is a batch of SSFSamples that is safe for concurrent
+// use by multiple goroutines. The zero value is an empty batch ready
+// to use.
+type SyncSamples struct {
+	mtx     sync.Mutex
+	samples Samples
+}
+
+// Add appends a sample to the batch of samples.
+func (s *SyncSamples) Add(sample ...*SSFSample) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.samples.Add(sample...)
+}
+
+// Merge appends all samples in other to the batch of samples. It is
+// a no-op if other is nil.
+func (s *SyncSamples) Merge(other *Samples) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.samples.Merge(other)
+}
+
+// Len returns the number of samples in the batch.
+func (s *SyncSamples) Len() int {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.samples.Len()
+}
+
+// Batch returns a copy of the samples collected so far. Samples added
+// after Batch returns are not reflected in the returned slice, so it
+// can be iterated over while other goroutines continue to add to the
+// batch.
+func (s *SyncSamples) Batch() []*SSFSample {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	batch := make([]*SSFSample, len(s.samples.Batch))
+	copy(batch, s.samples.Batch)
+	return batch
 }
 
 // NamePrefix is a string prepended to every SSFSample name generated
@@ -42,6 +268,16 @@ var NamePrefix string
 // commonly needed fields in sample creation helper functions. The
 // options are applied by order of arguments (left to right), so when
 // setting multiple of the same option, the rightmost wins.
+//
+// All options in this package can be passed to every constructor,
+// but not all of them are meaningful for every metric type:
+//
+//   - Tag, Tags, Unit, Timestamp, SampleRate and Scope apply to all
+//     metric types.
+//   - Message is meant for status samples.
+//   - AlertType and Priority are meant for events.
+//   - TimeUnit is meant for histograms and distributions that record
+//     durations; Timing applies it automatically.
 type SampleOption func(*SSFSample)
 
 // Unit is a functional option for creating an SSFSample. It sets the
@@ -53,26 +289,92 @@ func Unit(name string) SampleOption {
 }
 
 // Timestamp is a functional option for creating an SSFSample. It sets
-// the timestamp field on the sample to the timestamp passed.
+// the timestamp field on the sample to the timestamp passed, in
+// nanoseconds since the Unix epoch. Veneur reports gauges with the
+// timestamp of their latest sample, if it has one; samples without a
+// timestamp are reported with the time of the flush.
 func Timestamp(ts time.Time) SampleOption {
 	return func(s *SSFSample) {
 		s.Timestamp = ts.UnixNano()
 	}
 }
 
+// Tag is a functional option for creating an SSFSample. It sets a
+// single tag on the sample, allocating the sample's tag map if
+// necessary. An existing tag with the same key is overwritten.
+func Tag(key, value string) SampleOption {
+	return func(s *SSFSample) {
+		if s.Tags == nil {
+			s.Tags = map[string]string{}
+		}
+		s.Tags[key] = value
+	}
+}
+
+// Tags is a functional option for creating an SSFSample. It merges
+// the given tags into the sample's tags, allocating the sample's tag
+// map if necessary. Existing tags with the same keys are
+// overwritten.
+func Tags(tags map[string]string) SampleOption {
+	return func(s *SSFSample) {
+		if s.Tags == nil {
+			s.Tags = make(map[string]string, len(tags))
+		}
+		for k, v := range tags {
+			s.Tags[k] = v
+		}
+	}
+}
+
+// Message is a functional option for creating an SSFSample. It sets
+// the sample's message, which for STATUS samples is a human-readable
+// description of the service's state.
+//
+// Set samples carry their value in the message field, so passing
+// this option to Set replaces the set's value.
+func Message(msg string) SampleOption {
+	return func(s *SSFSample) {
+		s.Message = msg
+	}
+}
+
 // SampleRate sets the rate at which a measurement is sampled. The
 // rate is a number on the interval (0..1] (1 means that the value is
 // not sampled). Any numbers outside this interval result in no change
 // to the sample rate (by default, all SSFSamples created with the
-// helpers in this package have a SampleRate=1).
+// helpers in this package have a SampleRate=1); the strict
+// constructors, like NewCount and MustCount, reject them.
 func SampleRate(rate float32) SampleOption {
 	return func(s *SSFSample) {
-		if rate > 0 && rate <= 1 {
+		if rate > 0 && rate <= 1 || isStrictRateProbe(s.SampleRate) {
 			s.SampleRate = rate
 		}
 	}
 }
 
+// Scope is a functional option for creating an SSFSample. It sets
+// where veneur should aggregate the sample: SSFSample_LOCAL keeps the
+// metric on the veneur instance that received it, and
+// SSFSample_GLOBAL forwards it to the global veneur instance.
+//
+// A scope other than SSFSample_DEFAULT takes precedence over
+// everything else that veneur uses to decide where to aggregate a
+// metric, including the metric's type and the "veneurlocalonly" and
+// "veneurglobalonly" tags. With SSFSample_DEFAULT, veneur decides
+// based on those.
+func Scope(scope SSFSample_Scope) SampleOption {
+	return func(s *SSFSample) {
+		s.Scope = scope
+	}
+}
+
+// Day and Week are time resolutions longer than those provided by
+// package time, for reporting the durations of long-running jobs.
+const (
+	Day  = 24 * time.Hour
+	Week = 7 * Day
+)
+
 var resolutions = map[time.Duration]string{
 	time.Nanosecond:  "ns",
 	time.Microsecond: "µs",
@@ -80,26 +382,69 @@ var resolutions = map[time.Duration]string{
 	time.Second:      "s",
 	time.Minute:      "min",
 	time.Hour:        "h",
+	Day:              "d",
+	Week:             "wk",
+}
+
+// orderedResolutions holds the keys of resolutions, from the largest
+// to the smallest.
+var orderedResolutions = []time.Duration{
+	Week, Day, time.Hour, time.Minute, time.Second,
+	time.Millisecond, time.Microsecond, time.Nanosecond,
+}
+
+// ResolutionFromString returns the time resolution corresponding to
+// a unit symbol as set by TimeUnit, e.g. "ms" for time.Millisecond.
+// In addition to "µs", microseconds can be spelled "us". If the unit
+// is not known, ResolutionFromString returns false.
+func ResolutionFromString(unit string) (time.Duration, bool) {
+	if unit == "us" {
+		return time.Microsecond, true
+	}
+	for res, name := range resolutions {
+		if name == unit {
+			return res, true
+		}
+	}
+	return 0, false
 }
 
 // TimeUnit sets the unit on a sample to the given resolution's SI
 // unit symbol. Valid resolutions are the time duration constants from
-// Nanosecond through Hour. The non-SI units "minute" and "hour" are
-// represented by "min" and "h" respectively.
+// Nanosecond through Hour, and Day and Week. The non-SI units
+// "minute", "hour", "day" and "week" are represented by "min", "h",
+// "d" and "wk" respectively.
 //
-// If a resolution is passed that does not correspond exactly to the
-// duration constants in package time, this option does not affect the
-// sample at all.
+// If a resolution is passed that does not correspond exactly to one
+// of these, the sample is reported in the largest unit that is
+// shorter than the resolution, and its value (which is assumed to be
+// in multiples of the resolution) is scaled to match: A value of 1 at
+// a resolution of 90*time.Minute is reported as 1.5h. Resolutions
+// shorter than a nanosecond do not affect the sample at all.
 func TimeUnit(resolution time.Duration) SampleOption {
 	return func(s *SSFSample) {
 		if unit, ok := resolutions[resolution]; ok {
 			s.Unit = unit
+			return
+		}
+		for _, known := range orderedResolutions {
+			if known < resolution {
+				scale := float64(resolution) / float64(known)
+				s.Value = float32(float64(s.Value) * scale)
+				s.DoubleValue *= scale
+				s.Unit = resolutions[known]
+				return
+			}
 		}
 	}
 }
 
 func create(base *SSFSample, opts []SampleOption) *SSFSample {
 	base.Name = NamePrefix + base.Name
+	return apply(base, opts)
+}
+
+func apply(base *SSFSample, opts []SampleOption) *SSFSample {
 	for _, opt := range opts {
 		opt(base)
 	}
@@ -113,14 +458,26 @@ func create(base *SSFSample, opts []SampleOption) *SSFSample {
 // measurement has its SampleRate field adjusted to be its original
 // SampleRate * rate.
 func RandomlySample(rate float32, samples ...*SSFSample) []*SSFSample {
+	r, ok := rngPool.Get().(*rand.Rand)
+	if ok {
+		defer rngPool.Put(r)
+	}
+	return RandomlySampleWith(r, rate, samples...)
+}
+
+// RandomlySampleWith works like RandomlySample, but rolls the given
+// RNG to decide which measurements to include. This lets callers
+// that sample at high rates keep a *rand.Rand per goroutine, and
+// lets tests pass a seeded RNG to get deterministic results. Note
+// that a *rand.Rand is not safe for concurrent use.
+//
+// If r is nil, the default source in package math/rand is used.
+func RandomlySampleWith(r *rand.Rand, rate float32, samples ...*SSFSample) []*SSFSample {
 	res := make([]*SSFSample, 0, len(samples))
 
 	randFloat := defaultRandFloat32
-
-	r, ok := rngPool.Get().(*rand.Rand)
-	if ok {
+	if r != nil {
 		randFloat = r.Float32
-		defer rngPool.Put(r)
 	}
 
 	for _, s := range samples {
@@ -134,6 +491,107 @@ func RandomlySample(rate float32, samples ...*SSFSample) []*SSFSample {
 	return res
 }
 
+// ConsistentlySample works like RandomlySample, but instead of
+// rolling an RNG, it decides whether to include the measurements
+// based on a hash of key: The same key and rate always lead to the
+// same decision, and all measurements passed in a call are either
+// included or rejected together. This allows sampling correlated
+// measurements (for example, all the measurements belonging to one
+// request, or one trace) consistently.
+//
+// Each included measurement has its SampleRate field adjusted to be
+// its original SampleRate * rate.
+func ConsistentlySample(rate float32, key string, samples ...*SSFSample) []*SSFSample {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	// Use the top 53 bits of the hash to get a uniformly
+	// distributed float64 in [0, 1):
+	roll := float64(h.Sum64()>>11) / (1 << 53)
+	if roll >= float64(rate) {
+		return []*SSFSample{}
+	}
+	res := make([]*SSFSample, 0, len(samples))
+	for _, s := range samples {
+		if rate > 0 && rate <= 1 {
+			s.SampleRate = s.SampleRate * rate
+		}
+		res = append(res, s)
+	}
+	return res
+}
+
+// Event returns an SSFSample representing an event: an annotation
+// with a title and a text body, like a deploy or an alert. It is
+// timestamped with the current time; use the Timestamp option to
+// override that, and the AlertType and Priority options to set the
+// event's fields for sinks that support them. Events without a title
+// are discarded on ingestion.
+//
+// Events are encoded as samples with the same special tags that
+// veneur uses for DogStatsD events, so sinks process them the same
+// way. The title is not a metric name, so neither NamePrefix nor the
+// prefix of a batch is prepended to it.
+func Event(title string, text string, tags map[string]string, opts ...SampleOption) *SSFSample {
+	eventTags := make(map[string]string, len(tags)+1)
+	for k, v := range tags {
+		eventTags[k] = v
+	}
+	eventTags[dogstatsd.EventIdentifierKey] = ""
+	return apply(&SSFSample{
+		Name:       title,
+		Message:    text,
+		Timestamp:  time.Now().UnixNano(),
+		Tags:       eventTags,
+		SampleRate: 1.0,
+	}, opts)
+}
+
+// IsEvent returns true if the sample represents an event, as
+// constructed with Event or parsed from a DogStatsD event packet.
+func (s *SSFSample) IsEvent() bool {
+	_, ok := s.Tags[dogstatsd.EventIdentifierKey]
+	return ok
+}
+
+// AlertType is a functional option for creating an event with
+// Event. It sets the event's alert type, which must be one of
+// "error", "warning", "info" or "success". Any other value results
+// in no change to the event (by default, sinks report events with
+// the alert type "info").
+func AlertType(alertType string) SampleOption {
+	return func(s *SSFSample) {
+		switch alertType {
+		case "error", "warning", "info", "success":
+			Tag(dogstatsd.EventAlertTypeTagKey, alertType)(s)
+		}
+	}
+}
+
+// Priority is a functional option for creating an event with
+// Event. It sets the event's priority, which must be either "normal"
+// or "low". Any other value results in no change to the event (by
+// default, sinks report events with the priority "normal").
+func Priority(priority string) SampleOption {
+	return func(s *SSFSample) {
+		switch priority {
+		case "normal", "low":
+			Tag(dogstatsd.EventPriorityTagKey, priority)(s)
+		}
+	}
+}
+
+// Percentiles is a functional option for creating histogram and
+// distribution samples. It tells Veneur which percentiles the sender
+// is interested in, each in the interval (0..1). Veneur then skips
+// computing any of its configured percentiles that were not
+// requested for the histogram. Samples with a percentile outside the
+// interval fail validation and are dropped by Veneur.
+func Percentiles(ps ...float64) SampleOption {
+	return func(s *SSFSample) {
+		s.Percentiles = append(s.Percentiles, ps...)
+	}
+}
+
 // Count returns an SSFSample representing an increment / decrement of
 // a counter. It's a convenience wrapper around constructing SSFSample
 // objects.
@@ -147,6 +605,22 @@ func Count(name string, value float32, tags map[string]string, opts ...SampleOpt
 	}, opts)
 }
 
+// CountInt returns an SSFSample representing an increment /
+// decrement of a counter by an integer value. Unlike with Count, the
+// value is transmitted without rounding it to a float32 (which can
+// only represent integers up to 2^24 exactly); values up to 2^53 are
+// represented exactly.
+func CountInt(name string, value int64, tags map[string]string, opts ...SampleOption) *SSFSample {
+	return create(&SSFSample{
+		Metric:      SSFSample_COUNTER,
+		Name:        name,
+		Value:       float32(value),
+		DoubleValue: float64(value),
+		Tags:        tags,
+		SampleRate:  1.0,
+	}, opts)
+}
+
 // Gauge returns an SSFSample representing a gauge at a certain
 // value. It's a convenience wrapper around constructing SSFSample
 // objects.
@@ -160,6 +634,21 @@ func Gauge(name string, value float32, tags map[string]string, opts ...SampleOpt
 	}, opts)
 }
 
+// GaugeInt returns an SSFSample representing a gauge at a certain
+// integer value. Unlike with Gauge, the value is transmitted without
+// rounding it to a float32 (which can only represent integers up to
+// 2^24 exactly); values up to 2^53 are represented exactly.
+func GaugeInt(name string, value int64, tags map[string]string, opts ...SampleOption) *SSFSample {
+	return create(&SSFSample{
+		Metric:      SSFSample_GAUGE,
+		Name:        name,
+		Value:       float32(value),
+		DoubleValue: float64(value),
+		Tags:        tags,
+		SampleRate:  1.0,
+	}, opts)
+}
+
 // Histogram returns an SSFSample representing a value on a histogram,
 // like a timer or other range. It's a convenience wrapper around
 // constructing SSFSample objects.
@@ -173,6 +662,20 @@ func Histogram(name string, value float32, tags map[string]string, opts ...Sampl
 	}, opts)
 }
 
+// Distribution returns an SSFSample representing a value on a
+// distribution: a histogram that is aggregated globally across all
+// hosts reporting it, rather than on each host. It's a convenience
+// wrapper around constructing SSFSample objects.
+func Distribution(name string, value float32, tags map[string]string, opts ...SampleOption) *SSFSample {
+	return create(&SSFSample{
+		Metric:     SSFSample_DISTRIBUTION,
+		Name:       name,
+		Value:      value,
+		Tags:       tags,
+		SampleRate: 1.0,
+	}, opts)
+}
+
 // Set returns an SSFSample representing a value on a set, useful for
 // counting the unique values that occur in a certain time bound.
 func Set(name string, value string, tags map[string]string, opts ...SampleOption) *SSFSample {
@@ -186,14 +689,17 @@ func Set(name string, value string, tags map[string]string, opts ...SampleOption
 }
 
 // Timing returns an SSFSample (really a histogram) representing the
-// timing in the given resolution.
+// timing in the given resolution. Fractions of the resolution are
+// preserved, so 1500µs at millisecond resolution is reported as 1.5.
 func Timing(name string, value time.Duration, resolution time.Duration, tags map[string]string, opts ...SampleOption) *SSFSample {
-	time := float32(value / resolution)
+	time := float32(float64(value) / float64(resolution))
 	return Histogram(name, time, tags, append(opts, TimeUnit(resolution))...)
 }
 
-// Status returns an SSFSample capturing the reported state
-// of a service
+// Status returns an SSFSample capturing the reported state of a
+// service, which sinks like Datadog's report as a service check. Use
+// the Message option to attach a human-readable description of the
+// state.
 func Status(name string, state SSFSample_Status, tags map[string]string, opts ...SampleOption) *SSFSample {
 	return create(&SSFSample{
 		Metric:     SSFSample_STATUS,
@@ -2,16 +2,209 @@ package ssf
 
 import (
 	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/gogo/protobuf/proto"
 	"github.com/stretchr/testify/assert"
+	"github.com/stripe/veneur/protocol/dogstatsd"
 )
 
+func TestProtoSize(t *testing.T) {
+	var nilSamples *Samples
+	assert.Equal(t, 0, nilSamples.ProtoSize())
+
+	samples := &Samples{}
+	for i := 0; i < 200; i++ {
+		samples.Add(Count(fmt.Sprintf("counter.%d", i), float32(i), map[string]string{"purpose": "testing"}))
+	}
+	samples.Add(Set("a.set", "a member", nil, Unit("members")))
+	samples.Add(Status("a.check", SSFSample_CRITICAL, nil, Message(strings.Repeat("oh no", 100))))
+
+	data, err := proto.Marshal(&SSFSpan{Metrics: samples.Batch})
+	assert.NoError(t, err)
+	assert.Equal(t, len(data), samples.ProtoSize())
+}
+
+func TestPrefixedSamples(t *testing.T) {
+	foo := NewPrefixedSamples("foo.")
+	bar := NewPrefixedSamples("bar.")
+	foo.Add(Count("requests", 1, nil))
+	bar.Add(Count("requests", 1, nil), Gauge("queue_length", 2, nil))
+	assert.Equal(t, "foo.requests", foo.Batch[0].Name)
+	assert.Equal(t, "bar.requests", bar.Batch[0].Name)
+	assert.Equal(t, "bar.queue_length", bar.Batch[1].Name)
+
+	unprefixed := &Samples{}
+	unprefixed.Merge(bar)
+	assert.Equal(t, "bar.requests", unprefixed.Batch[0].Name)
+
+	// the same sample can go to several batches:
+	shared := Count("errors", 1, nil)
+	foo.Add(shared)
+	bar.Add(shared)
+	assert.Equal(t, "errors", shared.Name, "Add shouldn't rename the caller's sample")
+	assert.Equal(t, "foo.errors", foo.Batch[1].Name)
+	assert.Equal(t, "bar.errors", bar.Batch[2].Name)
+}
+
+func TestDedupe(t *testing.T) {
+	samples := &Samples{}
+	for i := 0; i < 5; i++ {
+		samples.Add(Gauge("queue_length", float32(i), map[string]string{"a": "1", "b": "2"}))
+	}
+	samples.Dedupe()
+	assert.Equal(t, 1, samples.Len())
+	assert.Equal(t, float32(4), samples.Batch[0].Value)
+
+	samples = &Samples{}
+	samples.Add(
+		Gauge("queue_length", 1, map[string]string{"queue": "a"}),
+		Histogram("latency", 1, nil),
+		Gauge("queue_length", 2, map[string]string{"queue": "b"}),
+		Histogram("latency", 1, nil),
+		Gauge("queue_length", 3, map[string]string{"queue": "a"}, Scope(SSFSample_GLOBAL)),
+		Count("requests", 1, nil),
+		Gauge("queue_length", 4, map[string]string{"queue": "a"}),
+		Count("requests", 1, nil),
+	)
+	samples.Dedupe()
+	values := []float32{}
+	for _, sample := range samples.Batch {
+		values = append(values, sample.Value)
+	}
+	assert.Equal(t, []float32{1, 2, 1, 3, 1, 4, 1}, values)
+}
+
+func TestSumCounters(t *testing.T) {
+	samples := &Samples{}
+	samples.Add(
+		Count("requests", 1, map[string]string{"a": "1", "b": "2"}),
+		Gauge("queue_length", 1, nil),
+		Count("requests", 2, map[string]string{"b": "2", "a": "1"}),
+		Count("requests", 4, nil),
+		Count("requests", 8, map[string]string{"a": "1", "b": "2"}, SampleRate(0.5)),
+		CountInt("requests", 1<<24+1, map[string]string{"a": "1", "b": "2"}),
+		Histogram("requests", 1, map[string]string{"a": "1", "b": "2"}),
+	)
+	samples.SumCounters()
+	if assert.Equal(t, 5, samples.Len()) {
+		assert.Equal(t, float64(1<<24+4), samples.Batch[0].DoubleValue)
+		assert.Equal(t, SSFSample_GAUGE, samples.Batch[1].Metric)
+		assert.Equal(t, float32(4), samples.Batch[2].Value)
+		assert.Equal(t, float32(8), samples.Batch[3].Value)
+		assert.Equal(t, SSFSample_HISTOGRAM, samples.Batch[4].Metric)
+	}
+}
+
+func TestAddCount(t *testing.T) {
+	samples := &Samples{}
+	samples.Add(Count("requests", 1, nil, SampleRate(0.5)))
+	for i := 0; i < 10; i++ {
+		samples.AddCount("requests", 1, map[string]string{"path": "/"})
+		samples.AddCount("requests", 2, map[string]string{"path": "/", "method": "GET"})
+		samples.AddCount("requests", 3, nil)
+		samples.AddCount("requests", 4, map[string]string{})
+		samples.AddCount("errors", 1, map[string]string{"path": "/"})
+	}
+	if assert.Equal(t, 5, samples.Len()) {
+		assert.Equal(t, float32(1), samples.Batch[0].Value, "sampled counters should not be added to")
+		assert.Equal(t, float32(10), samples.Batch[1].Value)
+		assert.Equal(t, float32(20), samples.Batch[2].Value)
+		// nil and empty tags are equal:
+		assert.Equal(t, float32(70), samples.Batch[3].Value)
+		assert.Equal(t, "errors", samples.Batch[4].Name)
+		assert.Equal(t, float32(10), samples.Batch[4].Value)
+	}
+
+	prefixed := NewPrefixedSamples("svc.")
+	prefixed.AddCount("requests", 1, nil)
+	prefixed.AddCount("requests", 1, nil)
+	if assert.Equal(t, 1, prefixed.Len()) {
+		assert.Equal(t, "svc.requests", prefixed.Batch[0].Name)
+		assert.Equal(t, float32(2), prefixed.Batch[0].Value)
+	}
+}
+
+func TestSamplesPool(t *testing.T) {
+	samples := GetSamples()
+	assert.Equal(t, 0, samples.Len())
+	samples.Add(Count("foo", 1, nil), Count("bar", 1, nil))
+	batch := samples.Batch
+	PutSamples(samples)
+	assert.Equal(t, 0, samples.Len())
+	assert.Nil(t, batch[0], "pooled batches should not retain samples")
+
+	prefixed := NewPrefixedSamples("foo.")
+	PutSamples(prefixed)
+	assert.Equal(t, "", prefixed.prefix)
+
+	// must not panic:
+	PutSamples(nil)
+}
+
+const samplesPerFlush = 10000
+
+func BenchmarkSamplesFlush(b *testing.B) {
+	sample := Count("foo", 1, nil)
+	b.Run("unpooled", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			samples := &Samples{}
+			for j := 0; j < samplesPerFlush; j++ {
+				samples.Add(sample)
+			}
+		}
+	})
+	b.Run("pooled", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			samples := GetSamples()
+			for j := 0; j < samplesPerFlush; j++ {
+				samples.Add(sample)
+			}
+			PutSamples(samples)
+		}
+	})
+}
+
+func TestChunk(t *testing.T) {
+	var nilSamples *Samples
+	assert.Nil(t, nilSamples.Chunk(100))
+
+	samples := &Samples{}
+	for i := 0; i < 1000; i++ {
+		samples.Add(Count(fmt.Sprintf("counter.%d", i), float32(i), map[string]string{"purpose": "testing"}))
+	}
+	huge := Status("a.check", SSFSample_CRITICAL, nil, Message(strings.Repeat("oh no", 1000)))
+	samples.Add(huge, Count("after.huge", 1, nil))
+
+	const mtu = 1400
+	chunks := samples.Chunk(mtu)
+	total := 0
+	var oversized []*Samples
+	for _, chunk := range chunks {
+		total += chunk.Len()
+		if chunk.ProtoSize() > mtu {
+			oversized = append(oversized, chunk)
+		}
+	}
+	assert.Equal(t, samples.Len(), total)
+	if assert.Len(t, oversized, 1) {
+		assert.Equal(t, []*SSFSample{huge}, oversized[0].Batch)
+	}
+	assert.Equal(t, "counter.0", chunks[0].Batch[0].Name)
+	last := chunks[len(chunks)-1]
+	assert.Equal(t, "after.huge", last.Batch[last.Len()-1].Name)
+}
+
 type constructor func(name string, value float32, tags map[string]string, opts ...SampleOption) *SSFSample
 
 func TestValidity(t *testing.T) {
-	tests := map[string]constructor{"count": Count, "gauge": Gauge, "histogram": Histogram}
+	tests := map[string]constructor{"count": Count, "gauge": Gauge, "histogram": Histogram, "distribution": Distribution}
 	for name, elt := range tests {
 		test := elt
 		t.Run(fmt.Sprintf("%s", name), func(t *testing.T) {
@@ -24,6 +217,75 @@ func TestValidity(t *testing.T) {
 	}
 }
 
+func TestDistribution(t *testing.T) {
+	sample := Distribution("foo", 1.5, nil)
+	assert.Equal(t, SSFSample_DISTRIBUTION, sample.Metric)
+	assert.Equal(t, float32(1.5), sample.Value)
+	assert.Equal(t, float32(1.0), sample.SampleRate)
+}
+
+func TestStatus(t *testing.T) {
+	sample := Status("foo.health", SSFSample_CRITICAL, map[string]string{"purpose": "testing"},
+		Message("disk is full"))
+
+	buf, err := sample.Marshal()
+	assert.NoError(t, err)
+	decoded := &SSFSample{}
+	assert.NoError(t, decoded.Unmarshal(buf))
+
+	assert.Equal(t, SSFSample_STATUS, decoded.Metric)
+	assert.Equal(t, SSFSample_CRITICAL, decoded.Status)
+	assert.Equal(t, "disk is full", decoded.Message)
+	assert.Equal(t, map[string]string{"purpose": "testing"}, decoded.Tags)
+}
+
+func TestEvent(t *testing.T) {
+	tags := map[string]string{"purpose": "testing"}
+	sample := Event("deploy", "deployed veneur", tags, AlertType("success"), Priority("low"))
+	assert.True(t, sample.IsEvent())
+	assert.Equal(t, "deploy", sample.Name)
+	assert.Equal(t, "deployed veneur", sample.Message)
+	assert.InDelta(t, time.Now().UnixNano(), sample.Timestamp, float64(time.Second))
+	assert.Equal(t, "success", sample.Tags[dogstatsd.EventAlertTypeTagKey])
+	assert.Equal(t, "low", sample.Tags[dogstatsd.EventPriorityTagKey])
+	assert.Equal(t, "testing", sample.Tags["purpose"])
+	assert.Len(t, tags, 1, "the tags passed in should not be modified")
+
+	sample = Event("deploy", "", nil, AlertType("catastrophe"), Priority("urgent"))
+	assert.NotContains(t, sample.Tags, dogstatsd.EventAlertTypeTagKey)
+	assert.NotContains(t, sample.Tags, dogstatsd.EventPriorityTagKey)
+
+	assert.False(t, Count("foo", 1, nil).IsEvent())
+}
+
+func TestEventNamePrefix(t *testing.T) {
+	NamePrefix = "prefix."
+	defer func() { NamePrefix = "" }()
+
+	assert.Equal(t, "deploy", Event("deploy", "", nil).Name, "the title shouldn't be prefixed")
+	assert.Equal(t, "", Event("", "", nil).Name, "an empty title should stay empty")
+
+	batch := NewPrefixedSamples("batch.")
+	batch.Add(Event("deploy", "", nil), Count("foo", 1, nil))
+	assert.Equal(t, "deploy", batch.Batch[0].Name)
+	assert.Equal(t, "batch.prefix.foo", batch.Batch[1].Name)
+}
+
+func TestIntConstructors(t *testing.T) {
+	const value = int64(1<<24 + 1) // not representable as a float32
+	for name, cons := range map[string]func(string, int64, map[string]string, ...SampleOption) *SSFSample{
+		"count": CountInt,
+		"gauge": GaugeInt,
+	} {
+		sample := cons("foo", value, nil)
+		assert.Equal(t, float64(value), sample.DoubleValue, name)
+		assert.NotEqual(t, float64(value), float64(sample.Value), name)
+		assert.Equal(t, float32(1.0), sample.SampleRate, name)
+	}
+	assert.Equal(t, SSFSample_COUNTER, CountInt("foo", 1, nil).Metric)
+	assert.Equal(t, SSFSample_GAUGE, GaugeInt("foo", 1, nil).Metric)
+}
+
 func TestTimingMS(t *testing.T) {
 	tests := []struct {
 		res  time.Duration
@@ -35,6 +297,8 @@ func TestTimingMS(t *testing.T) {
 		{time.Second, "s"},
 		{time.Minute, "min"},
 		{time.Hour, "h"},
+		{Day, "d"},
+		{Week, "wk"},
 	}
 	for _, elt := range tests {
 		test := elt
@@ -48,7 +312,58 @@ func TestTimingMS(t *testing.T) {
 	}
 }
 
-var testTypes = []string{"count", "gauge", "histogram", "set"}
+func TestTimingFractional(t *testing.T) {
+	tests := []struct {
+		value time.Duration
+		res   time.Duration
+		want  float32
+		unit  string
+	}{
+		{1500 * time.Microsecond, time.Millisecond, 1.5, "ms"},
+		{999 * time.Nanosecond, time.Microsecond, 0.999, "µs"},
+		{90 * time.Second, time.Minute, 1.5, "min"},
+		{90 * time.Minute, time.Hour, 1.5, "h"},
+		{36 * time.Hour, Day, 1.5, "d"},
+		// inexact resolutions get scaled to the next-smaller unit:
+		{90 * time.Minute, 90 * time.Minute, 1.5, "h"},
+		{3 * time.Second, 1500 * time.Millisecond, 3, "s"},
+		{3 * Week, 2 * Week, 3, "wk"},
+	}
+	for _, elt := range tests {
+		test := elt
+		t.Run(test.value.String()+"/"+test.res.String(), func(t *testing.T) {
+			t.Parallel()
+			sample := Timing("foo", test.value, test.res, nil)
+			assert.InDelta(t, test.want, sample.Value, 0.0001)
+			assert.Equal(t, test.unit, sample.Unit)
+		})
+	}
+}
+
+func TestResolutionFromString(t *testing.T) {
+	for res, unit := range resolutions {
+		got, ok := ResolutionFromString(unit)
+		assert.True(t, ok, unit)
+		assert.Equal(t, res, got, unit)
+	}
+
+	got, ok := ResolutionFromString("us")
+	assert.True(t, ok)
+	assert.Equal(t, time.Microsecond, got)
+
+	for _, unit := range []string{"", "m", "seconds", "MS"} {
+		_, ok := ResolutionFromString(unit)
+		assert.False(t, ok, unit)
+	}
+}
+
+func TestTimeUnitSubNanosecond(t *testing.T) {
+	sample := Histogram("foo", 20, nil, TimeUnit(0))
+	assert.Equal(t, float32(20), sample.Value)
+	assert.Equal(t, "", sample.Unit)
+}
+
+var testTypes = []string{"count", "gauge", "histogram", "distribution", "set", "status"}
 
 func testSample(t *testing.T, name string, args ...SampleOption) *SSFSample {
 	tags := map[string]string{"purpose": "testing"}
@@ -59,8 +374,12 @@ func testSample(t *testing.T, name string, args ...SampleOption) *SSFSample {
 		return Gauge("foo", 1, tags, args...)
 	case "histogram":
 		return Histogram("foo", 1, tags, args...)
+	case "distribution":
+		return Distribution("foo", 1, tags, args...)
 	case "set":
 		return Set("foo", "bar", tags, args...)
+	case "status":
+		return Status("foo", SSFSample_OK, tags, args...)
 	}
 	t.Fatalf("Unknown sample type %s", name)
 	return nil // not reached
@@ -80,6 +399,13 @@ func TestOptions(t *testing.T) {
 				assert.Equal(t, "frobnizzles", s.Unit)
 			},
 		},
+		{
+			"scope",
+			Scope(SSFSample_GLOBAL),
+			func(s *SSFSample) {
+				assert.Equal(t, SSFSample_GLOBAL, s.Scope)
+			},
+		},
 		{
 			"ts",
 			Timestamp(then),
@@ -104,8 +430,118 @@ func TestOptions(t *testing.T) {
 	}
 }
 
+func TestUnitAppliedDirectly(t *testing.T) {
+	sample := SSFSample{}
+	Unit("bytes")(&sample)
+	assert.NotEmpty(t, sample.Unit)
+	assert.Equal(t, "bytes", sample.Unit)
+}
+
+func TestMultipleOptions(t *testing.T) {
+	sample := Count("foo", 1, nil, SampleRate(0.1), Unit("requests"), Unit("bytes"))
+	assert.Equal(t, float32(0.1), sample.SampleRate)
+	assert.Equal(t, "bytes", sample.Unit, "the rightmost option should win")
+}
+
+func TestTagOptions(t *testing.T) {
+	sample := Gauge("q.depth", 1, nil, Tag("queue", "jobs"))
+	assert.Equal(t, map[string]string{"queue": "jobs"}, sample.Tags)
+
+	sample = Gauge("q.depth", 1, map[string]string{"queue": "mail", "env": "prod"},
+		Tags(map[string]string{"queue": "jobs", "region": "us"}),
+		Tag("env", "dev"))
+	assert.Equal(t, map[string]string{
+		"queue":  "jobs",
+		"env":    "dev",
+		"region": "us",
+	}, sample.Tags)
+}
+
+func TestTimestampRoundTrip(t *testing.T) {
+	then := time.Unix(1500000000, 123456789)
+	sample := Gauge("foo", 1, nil, Timestamp(then))
+
+	buf, err := sample.Marshal()
+	assert.NoError(t, err)
+	decoded := &SSFSample{}
+	assert.NoError(t, decoded.Unmarshal(buf))
+	assert.Equal(t, then.UnixNano(), decoded.Timestamp)
+}
+
+func TestSamplesMerge(t *testing.T) {
+	a := &Samples{}
+	a.Add(Count("a", 1, nil))
+	b := &Samples{}
+	b.Add(Count("b", 1, nil), Count("c", 1, nil))
+
+	a.Merge(b)
+	assert.Equal(t, 3, a.Len())
+	assert.Equal(t, 2, b.Len())
+	assert.Equal(t, "c", a.Batch[2].Name)
+
+	empty := &Samples{}
+	empty.Merge(b)
+	assert.Equal(t, 2, empty.Len())
+
+	// nil receivers and arguments are ignored
+	a.Merge(nil)
+	assert.Equal(t, 3, a.Len())
+	var nilSamples *Samples
+	nilSamples.Merge(a)
+	assert.Equal(t, 0, nilSamples.Len())
+}
+
+func TestSamplesReset(t *testing.T) {
+	s := &Samples{}
+	s.Add(Count("a", 1, nil), Count("b", 1, nil))
+	capacity := cap(s.Batch)
+
+	s.Reset()
+	assert.Equal(t, 0, s.Len())
+	assert.Equal(t, capacity, cap(s.Batch))
+
+	s.Add(Count("c", 1, nil))
+	assert.Equal(t, 1, s.Len())
+	assert.Equal(t, "c", s.Batch[0].Name)
+}
+
+func TestSyncSamplesConcurrentAdd(t *testing.T) {
+	const goroutines = 50
+	const perGoroutine = 100
+
+	s := &SyncSamples{}
+	var wg sync.WaitGroup
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < perGoroutine; j++ {
+				s.Add(Count("foo", 1, nil))
+				if j%10 == 0 {
+					s.Merge(&Samples{Batch: []*SSFSample{Count("bar", 1, nil)}})
+				}
+				for range s.Batch() {
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, goroutines*perGoroutine*11/10, s.Len())
+	assert.Len(t, s.Batch(), s.Len())
+}
+
+func TestSyncSamplesBatchIsCopy(t *testing.T) {
+	s := &SyncSamples{}
+	s.Add(Count("foo", 1, nil))
+	batch := s.Batch()
+	s.Add(Count("bar", 1, nil))
+	assert.Len(t, batch, 1)
+	assert.Equal(t, 2, s.Len())
+}
+
 func TestPrefix(t *testing.T) {
 	NamePrefix = "testing.the.prefix."
+	defer func() { NamePrefix = "" }()
 	for _, elt := range testTypes {
 		test := elt
 		t.Run(fmt.Sprintf("%s", test), func(t *testing.T) {
@@ -113,6 +549,59 @@ func TestPrefix(t *testing.T) {
 			assert.Equal(t, "testing.the.prefix.foo", sample.Name)
 		})
 	}
+
+	samples := NewPrefixedSamples("service.")
+	samples.Add(Count("foo", 1, nil))
+	assert.Equal(t, "service.testing.the.prefix.foo", samples.Batch[0].Name)
+}
+
+func TestRandomlySampleWith(t *testing.T) {
+	samples := func() []*SSFSample {
+		res := make([]*SSFSample, 100)
+		for i := range res {
+			res[i] = Count("testing.counter", float32(i), nil)
+		}
+		return res
+	}
+
+	first := RandomlySampleWith(rand.New(rand.NewSource(1)), 0.5, samples()...)
+	second := RandomlySampleWith(rand.New(rand.NewSource(1)), 0.5, samples()...)
+	assert.NotEmpty(t, first)
+	assert.True(t, len(first) < 100, "some samples should have been dropped")
+	if assert.Equal(t, len(first), len(second)) {
+		for i := range first {
+			assert.Equal(t, first[i].Value, second[i].Value)
+			assert.Equal(t, float32(0.5), first[i].SampleRate)
+		}
+	}
+
+	assert.Len(t, RandomlySampleWith(nil, 1, samples()...), 100)
+}
+
+func TestConsistentlySample(t *testing.T) {
+	kept := 0
+	for i := 0; i < 10000; i++ {
+		key := fmt.Sprintf("request-%d", i)
+		first := ConsistentlySample(0.25, key,
+			Count("requests", 1, nil),
+			Histogram("request.duration", 1, nil))
+		second := ConsistentlySample(0.25, key, Count("requests", 1, nil))
+
+		if len(first) == 0 {
+			assert.Empty(t, second, "key %q should always be rejected", key)
+			continue
+		}
+		kept++
+		assert.Len(t, first, 2, "all samples should be kept together")
+		assert.Len(t, second, 1, "key %q should always be kept", key)
+		for _, s := range first {
+			assert.Equal(t, float32(0.25), s.SampleRate)
+		}
+	}
+	assert.InDelta(t, 2500, kept, 250)
+
+	assert.Len(t, ConsistentlySample(1, "anything", Count("foo", 1, nil)), 1)
+	assert.Empty(t, ConsistentlySample(0, "anything", Count("foo", 1, nil)))
 }
 
 func BenchmarkRandomlySample(b *testing.B) {
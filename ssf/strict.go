@@ -0,0 +1,129 @@
+package ssf
+
+import "math"
+
+// The strict constructors in this file build samples just like their
+// permissive counterparts, but check the result with Validate: The
+// New* functions return an error describing invalid input (like a NaN
+// value or a sample rate outside (0..1]) and the Must* functions
+// panic. Use them when you'd rather find bugs in the code reporting
+// metrics early than have them show up as garbage at aggregation
+// time.
+
+// strictRateProbe is a NaN that strictly sets as a sample's rate
+// before it applies each option, so that it can tell which options are
+// SampleRate options: SampleRate replaces the probe with any rate, even
+// one that it would otherwise ignore.
+var strictRateProbe = math.Float32frombits(0x7fc0fa11)
+
+func isStrictRateProbe(rate float32) bool {
+	return math.Float32bits(rate) == math.Float32bits(strictRateProbe)
+}
+
+// strictly calls construct with opts, and returns the resulting
+// sample if it is valid. Unlike the permissive constructors, it keeps
+// the last sample rate that a SampleRate option asked for, even an
+// invalid one, so that validation rejects it.
+func strictly(construct func(opts ...SampleOption) *SSFSample, opts []SampleOption) (*SSFSample, error) {
+	var rate float32
+	requested := false
+	probed := make([]SampleOption, len(opts))
+	for i, opt := range opts {
+		opt := opt
+		probed[i] = func(s *SSFSample) {
+			prev := s.SampleRate
+			s.SampleRate = strictRateProbe
+			opt(s)
+			if isStrictRateProbe(s.SampleRate) {
+				s.SampleRate = prev
+				return
+			}
+			rate, requested = s.SampleRate, true
+		}
+	}
+	sample := construct(probed...)
+	if requested {
+		sample.SampleRate = rate
+	}
+	if err := sample.Validate(); err != nil {
+		return nil, err
+	}
+	return sample, nil
+}
+
+func must(sample *SSFSample, err error) *SSFSample {
+	if err != nil {
+		panic(err)
+	}
+	return sample
+}
+
+// NewCount works like Count, but returns an *InvalidSample error if
+// the resulting sample is not valid.
+func NewCount(name string, value float32, tags map[string]string, opts ...SampleOption) (*SSFSample, error) {
+	return strictly(func(opts ...SampleOption) *SSFSample {
+		return Count(name, value, tags, opts...)
+	}, opts)
+}
+
+// MustCount works like Count, but panics if the resulting sample is
+// not valid.
+func MustCount(name string, value float32, tags map[string]string, opts ...SampleOption) *SSFSample {
+	return must(NewCount(name, value, tags, opts...))
+}
+
+// NewGauge works like Gauge, but returns an *InvalidSample error if
+// the resulting sample is not valid.
+func NewGauge(name string, value float32, tags map[string]string, opts ...SampleOption) (*SSFSample, error) {
+	return strictly(func(opts ...SampleOption) *SSFSample {
+		return Gauge(name, value, tags, opts...)
+	}, opts)
+}
+
+// MustGauge works like Gauge, but panics if the resulting sample is
+// not valid.
+func MustGauge(name string, value float32, tags map[string]string, opts ...SampleOption) *SSFSample {
+	return must(NewGauge(name, value, tags, opts...))
+}
+
+// NewHistogram works like Histogram, but returns an *InvalidSample
+// error if the resulting sample is not valid.
+func NewHistogram(name string, value float32, tags map[string]string, opts ...SampleOption) (*SSFSample, error) {
+	return strictly(func(opts ...SampleOption) *SSFSample {
+		return Histogram(name, value, tags, opts...)
+	}, opts)
+}
+
+// MustHistogram works like Histogram, but panics if the resulting
+// sample is not valid.
+func MustHistogram(name string, value float32, tags map[string]string, opts ...SampleOption) *SSFSample {
+	return must(NewHistogram(name, value, tags, opts...))
+}
+
+// NewDistribution works like Distribution, but returns an
+// *InvalidSample error if the resulting sample is not valid.
+func NewDistribution(name string, value float32, tags map[string]string, opts ...SampleOption) (*SSFSample, error) {
+	return strictly(func(opts ...SampleOption) *SSFSample {
+		return Distribution(name, value, tags, opts...)
+	}, opts)
+}
+
+// MustDistribution works like Distribution, but panics if the
+// resulting sample is not valid.
+func MustDistribution(name string, value float32, tags map[string]string, opts ...SampleOption) *SSFSample {
+	return must(NewDistribution(name, value, tags, opts...))
+}
+
+// NewSet works like Set, but returns an *InvalidSample error if the
+// resulting sample is not valid.
+func NewSet(name string, value string, tags map[string]string, opts ...SampleOption) (*SSFSample, error) {
+	return strictly(func(opts ...SampleOption) *SSFSample {
+		return Set(name, value, tags, opts...)
+	}, opts)
+}
+
+// MustSet works like Set, but panics if the resulting sample is not
+// valid.
+func MustSet(name string, value string, tags map[string]string, opts ...SampleOption) *SSFSample {
+	return must(NewSet(name, value, tags, opts...))
+}
@@ -0,0 +1,73 @@
+package ssf
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStrictConstructors(t *testing.T) {
+	type constructor func(string, float32, map[string]string, ...SampleOption) (*SSFSample, error)
+	constructors := map[string]constructor{
+		"count":        NewCount,
+		"gauge":        NewGauge,
+		"histogram":    NewHistogram,
+		"distribution": NewDistribution,
+	}
+	for name, elt := range constructors {
+		cons := elt
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			sample, err := cons("foo", 1, nil, SampleRate(0.5))
+			if assert.NoError(t, err) {
+				assert.Equal(t, float32(0.5), sample.SampleRate)
+			}
+
+			_, err = cons("foo", float32(math.NaN()), nil)
+			assert.IsType(t, &InvalidSample{}, err, "NaN")
+			_, err = cons("foo", float32(math.Inf(1)), nil)
+			assert.IsType(t, &InvalidSample{}, err, "+Inf")
+			_, err = cons("foo", 1, nil, SampleRate(0))
+			assert.IsType(t, &InvalidSample{}, err, "rate=0")
+			_, err = cons("foo", 1, nil, SampleRate(0.5), SampleRate(2))
+			assert.IsType(t, &InvalidSample{}, err, "rate=2")
+			_, err = cons("foo", 1, nil, SampleRate(float32(math.NaN())))
+			assert.IsType(t, &InvalidSample{}, err, "rate=NaN")
+		})
+	}
+
+	_, err := NewSet("foo", "", nil)
+	assert.Error(t, err)
+	_, err = NewSet("foo", "bar", nil)
+	assert.NoError(t, err)
+}
+
+func TestMustConstructors(t *testing.T) {
+	assert.Panics(t, func() { MustCount("foo", float32(math.NaN()), nil) })
+	assert.Panics(t, func() { MustGauge("foo", float32(math.Inf(1)), nil) })
+	assert.Panics(t, func() { MustHistogram("foo", 1, nil, SampleRate(0)) })
+	assert.Panics(t, func() { MustDistribution("", 1, nil) })
+	assert.Panics(t, func() { MustSet("foo", "", nil) })
+
+	assert.NotPanics(t, func() { MustCount("foo", 1, nil) })
+}
+
+func TestPermissiveSampleRate(t *testing.T) {
+	assert.Equal(t, float32(1), Count("foo", 1, nil, SampleRate(0)).SampleRate)
+	assert.Equal(t, float32(1), Count("foo", 1, nil, SampleRate(-1)).SampleRate)
+	assert.Equal(t, float32(0.25), Count("foo", 1, nil, SampleRate(0.25)).SampleRate)
+	assert.Equal(t, float32(0.5), Count("foo", 1, nil, SampleRate(0.5), SampleRate(2)).SampleRate,
+		"an invalid rate should leave the previous one")
+
+	sample := &SSFSample{SampleRate: 0.5}
+	SampleRate(0)(sample)
+	SampleRate(3)(sample)
+	assert.Equal(t, float32(0.5), sample.SampleRate, "the option itself should ignore invalid rates")
+}
+
+func TestStrictSampleRateLast(t *testing.T) {
+	sample, err := NewCount("foo", 1, nil, SampleRate(2), SampleRate(0.5))
+	assert.NoError(t, err, "the last requested rate is valid")
+	assert.Equal(t, float32(0.5), sample.SampleRate)
+}
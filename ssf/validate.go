@@ -0,0 +1,149 @@
+package ssf
+
+import (
+	"fmt"
+	"math"
+)
+
+// InvalidSample is an error type indicating that an SSFSample is not
+// valid. Reason describes the first problem found with the sample.
+type InvalidSample struct {
+	Sample *SSFSample
+	Reason string
+}
+
+func (e *InvalidSample) Error() string {
+	return fmt.Sprintf("invalid sample %q: %s", e.Sample.Name, e.Reason)
+}
+
+// Validate checks that a sample can be aggregated meaningfully, and
+// returns an *InvalidSample error describing the first problem it
+// finds. A sample is valid if:
+//
+//   - it has a name,
+//   - its value is a finite number (for counters, gauges, histograms
+//     and distributions),
+//   - its sample rate is in the interval (0..1],
+//   - it has a non-empty message, if it is a set, and
+//   - any percentiles it requests are in the interval (0..1).
+func (s *SSFSample) Validate() error {
+	if s.Name == "" {
+		return &InvalidSample{s, "name is empty"}
+	}
+	switch s.Metric {
+	case SSFSample_COUNTER, SSFSample_GAUGE, SSFSample_HISTOGRAM, SSFSample_DISTRIBUTION:
+		for _, v := range []float64{float64(s.Value), s.DoubleValue} {
+			if math.IsNaN(v) || math.IsInf(v, 0) {
+				return &InvalidSample{s, fmt.Sprintf("value %v is not finite", v)}
+			}
+		}
+	case SSFSample_SET:
+		if s.Message == "" {
+			return &InvalidSample{s, "set value (message) is empty"}
+		}
+	}
+	if !(s.SampleRate > 0 && s.SampleRate <= 1) {
+		return &InvalidSample{s, fmt.Sprintf("sample rate %v is not in the interval (0..1]", s.SampleRate)}
+	}
+	for _, p := range s.Percentiles {
+		if !(p > 0 && p < 1) {
+			return &InvalidSample{s, fmt.Sprintf("percentile %v is not in the interval (0..1)", p)}
+		}
+	}
+	return nil
+}
+
+// InvalidSpan is an error type indicating that an SSFSpan is not a
+// valid part of a trace. Reason describes the first problem found with
+// the span.
+type InvalidSpan struct {
+	Span   *SSFSpan
+	Reason string
+}
+
+func (e *InvalidSpan) Error() string {
+	return fmt.Sprintf("invalid span %q: %s", e.Span.Name, e.Reason)
+}
+
+// UnknownService is the service that Repair gives spans without one.
+const UnknownService = "unknown"
+
+// Validate checks that a span is a well-formed part of a trace, and
+// returns an *InvalidSpan error describing the first problem it finds.
+// A span is valid if:
+//
+//   - its ID and trace ID are non-zero,
+//   - it has start and end timestamps, and doesn't end before it
+//     starts, and
+//   - it has a service and a name.
+func (s *SSFSpan) Validate() error {
+	switch {
+	case s.Id == 0:
+		return &InvalidSpan{s, "id is zero"}
+	case s.TraceId == 0:
+		return &InvalidSpan{s, "trace id is zero"}
+	case s.StartTimestamp == 0:
+		return &InvalidSpan{s, "start timestamp is zero"}
+	case s.EndTimestamp == 0:
+		return &InvalidSpan{s, "end timestamp is zero"}
+	case s.EndTimestamp < s.StartTimestamp:
+		return &InvalidSpan{s, fmt.Sprintf("ends at %d, before it starts at %d", s.EndTimestamp, s.StartTimestamp)}
+	case s.Service == "":
+		return &InvalidSpan{s, "service is empty"}
+	case s.Name == "":
+		return &InvalidSpan{s, "name is empty"}
+	}
+	return nil
+}
+
+// Repair fixes what it can of the problems that Validate finds, and
+// returns whether it changed the span: a span without a trace ID
+// becomes the root of its own trace, a span with only one of its
+// timestamps gets the other one too, a span that ends before it starts
+// has its timestamps swapped, and a span without a service gets
+// UnknownService. Spans without an ID or a name can't be repaired.
+func (s *SSFSpan) Repair() bool {
+	repaired := false
+	if s.TraceId == 0 && s.Id != 0 {
+		s.TraceId = s.Id
+		repaired = true
+	}
+	if s.StartTimestamp == 0 && s.EndTimestamp != 0 {
+		s.StartTimestamp = s.EndTimestamp
+		repaired = true
+	}
+	if s.EndTimestamp == 0 && s.StartTimestamp != 0 {
+		s.EndTimestamp = s.StartTimestamp
+		repaired = true
+	}
+	if s.EndTimestamp < s.StartTimestamp {
+		s.StartTimestamp, s.EndTimestamp = s.EndTimestamp, s.StartTimestamp
+		repaired = true
+	}
+	if s.Service == "" {
+		s.Service = UnknownService
+		repaired = true
+	}
+	return repaired
+}
+
+// ValidatingSamples is a batch of SSFSamples that only accepts valid
+// samples. It is useful in tests, to fail as soon as invalid samples
+// are reported.
+type ValidatingSamples struct {
+	Samples
+}
+
+// Add validates the samples passed and, if all are valid, appends
+// them to the batch. If any sample is invalid, none of the samples
+// are added, and the validation error of the first invalid sample is
+// returned.
+func (s *ValidatingSamples) Add(sample ...*SSFSample) error {
+	for _, elt := range sample {
+		if err := elt.Validate(); err != nil {
+			return err
+		}
+	}
+	s.Samples.Add(sample...)
+	return nil
+}
@@ -0,0 +1,141 @@
+package ssf
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		sample *SSFSample
+		valid  bool
+	}{
+		{"counter", Count("foo", 1, nil), true},
+		{"set", Set("foo", "bar", nil), true},
+		{"status", Status("foo", SSFSample_OK, nil), true},
+		{"event", Event("foo", "bar", nil), true},
+		{"empty name", &SSFSample{SampleRate: 1}, false},
+		{"NaN", Gauge("foo", float32(math.NaN()), nil), false},
+		{"+Inf", Histogram("foo", float32(math.Inf(1)), nil), false},
+		{"-Inf", Distribution("foo", float32(math.Inf(-1)), nil), false},
+		{"zero sample rate", &SSFSample{Name: "foo"}, false},
+		{"negative sample rate", &SSFSample{Name: "foo", SampleRate: -0.5}, false},
+		{"sample rate above 1", &SSFSample{Name: "foo", SampleRate: 1.5}, false},
+		{"empty set", Set("foo", "", nil), false},
+		{"percentiles", Histogram("foo", 1, nil, Percentiles(0.5, 0.99)), true},
+		{"percentile 0", Histogram("foo", 1, nil, Percentiles(0)), false},
+		{"percentile 1", Distribution("foo", 1, nil, Percentiles(0.5, 1)), false},
+	}
+	for _, elt := range tests {
+		test := elt
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			err := test.sample.Validate()
+			if test.valid {
+				assert.NoError(t, err)
+				return
+			}
+			if assert.Error(t, err) {
+				invalid, ok := err.(*InvalidSample)
+				if assert.True(t, ok, "error should be an *InvalidSample: %v", err) {
+					assert.Equal(t, test.sample, invalid.Sample)
+				}
+			}
+		})
+	}
+}
+
+func TestValidatingSamples(t *testing.T) {
+	s := &ValidatingSamples{}
+	assert.NoError(t, s.Add(Count("foo", 1, nil), Gauge("bar", 1, nil)))
+	assert.Equal(t, 2, s.Len())
+
+	assert.Error(t, s.Add(Count("baz", 1, nil), &SSFSample{SampleRate: 1}))
+	assert.Equal(t, 2, s.Len(), "no samples should be added if any is invalid")
+}
+
+func validSpan() *SSFSpan {
+	return &SSFSpan{
+		Id:             2,
+		TraceId:        1,
+		ParentId:       1,
+		StartTimestamp: 100,
+		EndTimestamp:   200,
+		Service:        "farm",
+		Name:           "harvest",
+	}
+}
+
+func TestValidateSpan(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(*SSFSpan)
+	}{
+		{"zero id", func(s *SSFSpan) { s.Id = 0 }},
+		{"zero trace id", func(s *SSFSpan) { s.TraceId = 0 }},
+		{"no start", func(s *SSFSpan) { s.StartTimestamp = 0 }},
+		{"no end", func(s *SSFSpan) { s.EndTimestamp = 0 }},
+		{"ends before it starts", func(s *SSFSpan) { s.EndTimestamp = 99 }},
+		{"no service", func(s *SSFSpan) { s.Service = "" }},
+		{"no name", func(s *SSFSpan) { s.Name = "" }},
+	}
+	assert.NoError(t, validSpan().Validate())
+	for _, elt := range tests {
+		test := elt
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			span := validSpan()
+			test.modify(span)
+			err := span.Validate()
+			if assert.Error(t, err) {
+				invalid, ok := err.(*InvalidSpan)
+				if assert.True(t, ok, "error should be an *InvalidSpan: %v", err) {
+					assert.Equal(t, span, invalid.Span)
+				}
+			}
+		})
+	}
+}
+
+func TestRepairSpan(t *testing.T) {
+	tests := []struct {
+		name       string
+		modify     func(*SSFSpan)
+		repairable bool
+	}{
+		{"zero trace id", func(s *SSFSpan) { s.TraceId = 0 }, true},
+		{"no start", func(s *SSFSpan) { s.StartTimestamp = 0 }, true},
+		{"no end", func(s *SSFSpan) { s.EndTimestamp = 0 }, true},
+		{"ends before it starts", func(s *SSFSpan) { s.StartTimestamp, s.EndTimestamp = 200, 100 }, true},
+		{"no service", func(s *SSFSpan) { s.Service = "" }, true},
+		{"zero id", func(s *SSFSpan) { s.Id = 0 }, false},
+		{"no name", func(s *SSFSpan) { s.Name = "" }, false},
+	}
+	span := validSpan()
+	assert.False(t, span.Repair(), "valid spans should be left alone")
+	assert.Equal(t, validSpan(), span)
+	for _, elt := range tests {
+		test := elt
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			span := validSpan()
+			test.modify(span)
+			span.Repair()
+			if test.repairable {
+				assert.NoError(t, span.Validate())
+			} else {
+				assert.Error(t, span.Validate())
+			}
+		})
+	}
+
+	span = validSpan()
+	span.TraceId = 0
+	span.Service = ""
+	assert.True(t, span.Repair())
+	assert.Equal(t, span.Id, span.TraceId, "a span without a trace should be the root of its own")
+	assert.Equal(t, UnknownService, span.Service)
+}
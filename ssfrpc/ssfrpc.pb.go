@@ -0,0 +1,415 @@
+// Code generated by protoc-gen-gogo. DO NOT EDIT.
+// source: ssfrpc/ssfrpc.proto
+
+/*
+	Package ssfrpc is a generated protocol buffer package.
+
+	It is generated from these files:
+		ssfrpc/ssfrpc.proto
+
+	It has these top-level messages:
+		StreamSpansAck
+*/
+package ssfrpc
+
+import proto "github.com/gogo/protobuf/proto"
+import fmt "fmt"
+import math "math"
+import ssf "github.com/stripe/veneur/ssf"
+
+import (
+	context "golang.org/x/net/context"
+	grpc "google.golang.org/grpc"
+)
+
+import io "io"
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the proto package it is being compiled against.
+// A compilation error at this line likely means your copy of the
+// proto package needs to be updated.
+const _ = proto.GoGoProtoPackageIsVersion2 // please upgrade the proto package
+
+// StreamSpansAck acknowledges the spans that have been ingested on a
+// stream.
+type StreamSpansAck struct {
+	// received is the number of spans ingested since the stream
+	// was opened.
+	Received int64 `protobuf:"varint,1,opt,name=received,proto3" json:"received,omitempty"`
+}
+
+func (m *StreamSpansAck) Reset()                    { *m = StreamSpansAck{} }
+func (m *StreamSpansAck) String() string            { return proto.CompactTextString(m) }
+func (*StreamSpansAck) ProtoMessage()               {}
+func (*StreamSpansAck) Descriptor() ([]byte, []int) { return fileDescriptorSsfrpc, []int{0} }
+
+func (m *StreamSpansAck) GetReceived() int64 {
+	if m != nil {
+		return m.Received
+	}
+	return 0
+}
+
+func init() {
+	proto.RegisterType((*StreamSpansAck)(nil), "ssfrpc.StreamSpansAck")
+}
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ context.Context
+var _ grpc.ClientConn
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+const _ = grpc.SupportPackageIsVersion4
+
+// Client API for SSFImport service
+
+type SSFImportClient interface {
+	// StreamSpans receives a stream of spans. Every so often, and
+	// once the client has closed its side of the stream, it
+	// acknowledges the spans that it has ingested so far.
+	StreamSpans(ctx context.Context, opts ...grpc.CallOption) (SSFImport_StreamSpansClient, error)
+}
+
+type sSFImportClient struct {
+	cc *grpc.ClientConn
+}
+
+func NewSSFImportClient(cc *grpc.ClientConn) SSFImportClient {
+	return &sSFImportClient{cc}
+}
+
+func (c *sSFImportClient) StreamSpans(ctx context.Context, opts ...grpc.CallOption) (SSFImport_StreamSpansClient, error) {
+	stream, err := grpc.NewClientStream(ctx, &_SSFImport_serviceDesc.Streams[0], c.cc, "/ssfrpc.SSFImport/StreamSpans", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &sSFImportStreamSpansClient{stream}
+	return x, nil
+}
+
+type SSFImport_StreamSpansClient interface {
+	Send(*ssf.SSFSpan) error
+	Recv() (*StreamSpansAck, error)
+	grpc.ClientStream
+}
+
+type sSFImportStreamSpansClient struct {
+	grpc.ClientStream
+}
+
+func (x *sSFImportStreamSpansClient) Send(m *ssf.SSFSpan) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *sSFImportStreamSpansClient) Recv() (*StreamSpansAck, error) {
+	m := new(StreamSpansAck)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Server API for SSFImport service
+
+type SSFImportServer interface {
+	// StreamSpans receives a stream of spans. Every so often, and
+	// once the client has closed its side of the stream, it
+	// acknowledges the spans that it has ingested so far.
+	StreamSpans(SSFImport_StreamSpansServer) error
+}
+
+func RegisterSSFImportServer(s *grpc.Server, srv SSFImportServer) {
+	s.RegisterService(&_SSFImport_serviceDesc, srv)
+}
+
+func _SSFImport_StreamSpans_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(SSFImportServer).StreamSpans(&sSFImportStreamSpansServer{stream})
+}
+
+type SSFImport_StreamSpansServer interface {
+	Send(*StreamSpansAck) error
+	Recv() (*ssf.SSFSpan, error)
+	grpc.ServerStream
+}
+
+type sSFImportStreamSpansServer struct {
+	grpc.ServerStream
+}
+
+func (x *sSFImportStreamSpansServer) Send(m *StreamSpansAck) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *sSFImportStreamSpansServer) Recv() (*ssf.SSFSpan, error) {
+	m := new(ssf.SSFSpan)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+var _SSFImport_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "ssfrpc.SSFImport",
+	HandlerType: (*SSFImportServer)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamSpans",
+			Handler:       _SSFImport_StreamSpans_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "ssfrpc/ssfrpc.proto",
+}
+
+func (m *StreamSpansAck) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalTo(dAtA)
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *StreamSpansAck) MarshalTo(dAtA []byte) (int, error) {
+	var i int
+	_ = i
+	var l int
+	_ = l
+	if m.Received != 0 {
+		dAtA[i] = 0x8
+		i++
+		i = encodeVarintSsfrpc(dAtA, i, uint64(m.Received))
+	}
+	return i, nil
+}
+
+func encodeVarintSsfrpc(dAtA []byte, offset int, v uint64) int {
+	for v >= 1<<7 {
+		dAtA[offset] = uint8(v&0x7f | 0x80)
+		v >>= 7
+		offset++
+	}
+	dAtA[offset] = uint8(v)
+	return offset + 1
+}
+func (m *StreamSpansAck) Size() (n int) {
+	var l int
+	_ = l
+	if m.Received != 0 {
+		n += 1 + sovSsfrpc(uint64(m.Received))
+	}
+	return n
+}
+
+func sovSsfrpc(x uint64) (n int) {
+	for {
+		n++
+		x >>= 7
+		if x == 0 {
+			break
+		}
+	}
+	return n
+}
+func sozSsfrpc(x uint64) (n int) {
+	return sovSsfrpc(uint64((x << 1) ^ uint64((int64(x) >> 63))))
+}
+func (m *StreamSpansAck) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowSsfrpc
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= (uint64(b) & 0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: StreamSpansAck: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: StreamSpansAck: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Received", wireType)
+			}
+			m.Received = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowSsfrpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.Received |= (int64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		default:
+			iNdEx = preIndex
+			skippy, err := skipSsfrpc(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if skippy < 0 {
+				return ErrInvalidLengthSsfrpc
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+func skipSsfrpc(dAtA []byte) (n int, err error) {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return 0, ErrIntOverflowSsfrpc
+			}
+			if iNdEx >= l {
+				return 0, io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= (uint64(b) & 0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		wireType := int(wire & 0x7)
+		switch wireType {
+		case 0:
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return 0, ErrIntOverflowSsfrpc
+				}
+				if iNdEx >= l {
+					return 0, io.ErrUnexpectedEOF
+				}
+				iNdEx++
+				if dAtA[iNdEx-1] < 0x80 {
+					break
+				}
+			}
+			return iNdEx, nil
+		case 1:
+			iNdEx += 8
+			return iNdEx, nil
+		case 2:
+			var length int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return 0, ErrIntOverflowSsfrpc
+				}
+				if iNdEx >= l {
+					return 0, io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				length |= (int(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			iNdEx += length
+			if length < 0 {
+				return 0, ErrInvalidLengthSsfrpc
+			}
+			return iNdEx, nil
+		case 3:
+			for {
+				var innerWire uint64
+				var start int = iNdEx
+				for shift := uint(0); ; shift += 7 {
+					if shift >= 64 {
+						return 0, ErrIntOverflowSsfrpc
+					}
+					if iNdEx >= l {
+						return 0, io.ErrUnexpectedEOF
+					}
+					b := dAtA[iNdEx]
+					iNdEx++
+					innerWire |= (uint64(b) & 0x7F) << shift
+					if b < 0x80 {
+						break
+					}
+				}
+				innerWireType := int(innerWire & 0x7)
+				if innerWireType == 4 {
+					break
+				}
+				next, err := skipSsfrpc(dAtA[start:])
+				if err != nil {
+					return 0, err
+				}
+				iNdEx = start + next
+			}
+			return iNdEx, nil
+		case 4:
+			return iNdEx, nil
+		case 5:
+			iNdEx += 4
+			return iNdEx, nil
+		default:
+			return 0, fmt.Errorf("proto: illegal wireType %d", wireType)
+		}
+	}
+	panic("unreachable")
+}
+
+var (
+	ErrInvalidLengthSsfrpc = fmt.Errorf("proto: negative length found during unmarshaling")
+	ErrIntOverflowSsfrpc   = fmt.Errorf("proto: integer overflow")
+)
+
+func init() { proto.RegisterFile("ssfrpc/ssfrpc.proto", fileDescriptorSsfrpc) }
+
+var fileDescriptorSsfrpc = []byte{
+	// 163 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xe2, 0x12, 0x2e, 0x2e, 0x4e, 0x2b,
+	0x2a, 0x48, 0xd6, 0x87, 0x50, 0x7a, 0x05, 0x45, 0xf9, 0x25, 0xf9, 0x42, 0x6c, 0x10, 0x9e, 0x94,
+	0x40, 0x71, 0x71, 0x9a, 0x7e, 0x71, 0x62, 0x6e, 0x41, 0x4e, 0x2a, 0x44, 0x46, 0x49, 0x87, 0x8b,
+	0x2f, 0xb8, 0xa4, 0x28, 0x35, 0x31, 0x37, 0xb8, 0x20, 0x31, 0xaf, 0xd8, 0x31, 0x39, 0x5b, 0x48,
+	0x8a, 0x8b, 0xa3, 0x28, 0x35, 0x39, 0x35, 0xb3, 0x2c, 0x35, 0x45, 0x82, 0x51, 0x81, 0x51, 0x83,
+	0x39, 0x08, 0xce, 0x37, 0x72, 0xe3, 0xe2, 0x0c, 0x0e, 0x76, 0xf3, 0xcc, 0x2d, 0xc8, 0x2f, 0x2a,
+	0x11, 0xb2, 0xe4, 0xe2, 0x46, 0xd2, 0x2a, 0xc4, 0xa3, 0x57, 0x5c, 0x9c, 0xa6, 0x17, 0x1c, 0xec,
+	0x06, 0xe2, 0x4a, 0x89, 0xe9, 0x41, 0x1d, 0x80, 0x6a, 0xba, 0x12, 0x83, 0x06, 0xa3, 0x01, 0xa3,
+	0x93, 0xc0, 0x89, 0x47, 0x72, 0x8c, 0x17, 0x1e, 0xc9, 0x31, 0x3e, 0x78, 0x24, 0xc7, 0x38, 0xe1,
+	0xb1, 0x1c, 0x43, 0x12, 0x1b, 0xd8, 0x39, 0xc6, 0x80, 0x01, 0x00, 0x80, 0x49, 0x65, 0xb8, 0xbf,
+	0x00, 0x00, 0x00,
+}
@@ -2,7 +2,9 @@ package tdigest
 
 import (
 	"encoding/base64"
+	"fmt"
 	"io/ioutil"
+	"math"
 	"math/rand"
 	"os"
 	"testing"
@@ -178,6 +180,215 @@ func TestMergingDigestData(t *testing.T) {
 	assert.Equal(t, td.ReciprocalSum(), td2.ReciprocalSum())
 }
 
+// TestMergeSinglePointDigests checks that merging many digests of one
+// point each, as a global veneur does with the digests that local
+// veneurs forward, gives the same quantiles as adding the points
+// directly.
+func TestMergeSinglePointDigests(t *testing.T) {
+	r := rand.New(rand.NewSource(time.Now().Unix()))
+
+	direct := NewMerging(100, false)
+	merged := NewMerging(100, false)
+	for i := 0; i < 1000; i++ {
+		v := r.ExpFloat64()
+		direct.Add(v, 1)
+		single := NewMerging(100, false)
+		single.Add(v, 1)
+		merged.Merge(single)
+	}
+	validateMergingDigest(t, merged)
+
+	assert.Equal(t, direct.Count(), merged.Count())
+	assert.Equal(t, direct.Min(), merged.Min())
+	assert.Equal(t, direct.Max(), merged.Max())
+	for _, q := range []float64{0.5, 0.9, 0.99, 0.999} {
+		assert.InEpsilon(t, direct.Quantile(q), merged.Quantile(q), 0.02, "quantile %v did not match", q)
+	}
+}
+
+// TestMergeKeepsExtremes checks that merging digests whose outermost
+// centroids hold several points keeps their minimum and maximum,
+// rather than taking them from the centroids' means.
+func TestMergeKeepsExtremes(t *testing.T) {
+	r := rand.New(rand.NewSource(time.Now().Unix()))
+
+	direct := NewMerging(20, false)
+	merged := NewMerging(20, false)
+	for i := 0; i < 10; i++ {
+		part := NewMerging(20, false)
+		for j := 0; j < 10000; j++ {
+			v := r.ExpFloat64()
+			direct.Add(v, 1)
+			part.Add(v, 1)
+		}
+		merged.Merge(part)
+	}
+	validateMergingDigest(t, merged)
+
+	assert.Equal(t, direct.Min(), merged.Min())
+	assert.Equal(t, direct.Max(), merged.Max())
+	assert.Equal(t, direct.Max(), merged.Quantile(1))
+	for _, q := range []float64{0.5, 0.9, 0.99} {
+		assert.InEpsilon(t, direct.Quantile(q), merged.Quantile(q), 0.05, "quantile %v did not match", q)
+	}
+}
+
+func TestCentroidCountBounded(t *testing.T) {
+	rand.Seed(time.Now().Unix())
+
+	for _, compression := range []float64{20, 100, 1000} {
+		td := NewMerging(compression, false)
+		for i := 0; i < 10000; i++ {
+			td.Add(rand.NormFloat64(), 1.0)
+		}
+		size := td.Size()
+		for i := 0; i < 1000000; i++ {
+			td.Add(rand.NormFloat64(), 1.0)
+		}
+
+		count := td.CentroidCount()
+		assert.True(t, float64(count) <= math.Pi*compression/2+0.5,
+			"%d centroids exceed the bound for compression %v", count, compression)
+		assert.True(t, float64(count) >= compression/2,
+			"%d centroids are too few for compression %v", count, compression)
+		assert.Equal(t, size, td.Size(), "the digest should not grow as more values are added")
+	}
+}
+
+func TestSize(t *testing.T) {
+	td := NewMerging(100, false)
+	empty := td.Size()
+	assert.True(t, empty > 0)
+
+	// The centroid lists are allocated up front:
+	td.Add(1, 1)
+	assert.Equal(t, empty, td.Size())
+
+	debug := NewMerging(100, true)
+	for i := 0; i < 1000; i++ {
+		debug.Add(float64(i), 1)
+	}
+	assert.True(t, debug.Size() >= empty+1000*8, "debug samples should be counted")
+}
+
+func TestMarshalBinary(t *testing.T) {
+	rand.Seed(time.Now().Unix())
+
+	td := NewMerging(100, false)
+	for i := 0; i < 10000; i++ {
+		td.Add(rand.ExpFloat64(), rand.Float64()+0.5)
+	}
+	buf, err := td.MarshalBinary()
+	require.NoError(t, err)
+
+	td2 := NewMerging(1000, false)
+	td2.Add(1, 1)
+	require.NoError(t, td2.UnmarshalBinary(buf))
+	assert.Equal(t, td.Count(), td2.Count())
+	assert.Equal(t, td.Min(), td2.Min())
+	assert.Equal(t, td.Max(), td2.Max())
+	assert.Equal(t, td.ReciprocalSum(), td2.ReciprocalSum())
+	for _, q := range []float64{0, 0.01, 0.25, 0.5, 0.75, 0.99, 1} {
+		assert.Equal(t, td.Quantile(q), td2.Quantile(q), "quantile %v did not match", q)
+	}
+
+	// The decoded digest should keep working:
+	td.Add(42, 1)
+	td2.Add(42, 1)
+	assert.Equal(t, td.Quantile(0.5), td2.Quantile(0.5))
+}
+
+func TestDecode(t *testing.T) {
+	td := NewMerging(100, false)
+	for i := 0; i < 10000; i++ {
+		td.Add(rand.NormFloat64(), 1)
+	}
+	gob, err := td.GobEncode()
+	require.NoError(t, err)
+	bin, err := td.MarshalBinary()
+	require.NoError(t, err)
+
+	for name, buf := range map[string][]byte{"gob": gob, "binary": bin} {
+		decoded, err := Decode(buf)
+		require.NoError(t, err, name)
+		assert.Equal(t, td.Count(), decoded.Count(), name)
+		assert.Equal(t, td.Quantile(0.5), decoded.Quantile(0.5), name)
+	}
+	_, err = Decode([]byte("td\x02"))
+	assert.Error(t, err)
+	_, err = Decode([]byte("garbage"))
+	assert.Error(t, err)
+}
+
+func TestMarshalBinaryEmpty(t *testing.T) {
+	buf, err := NewMerging(100, false).MarshalBinary()
+	require.NoError(t, err)
+
+	td := NewMerging(100, false)
+	require.NoError(t, td.UnmarshalBinary(buf))
+	assert.Equal(t, float64(0), td.Count())
+	assert.True(t, math.IsNaN(td.Quantile(0.5)))
+}
+
+func TestQuantileRoundingError(t *testing.T) {
+	// The centroid weights add up to less than the total weight:
+	td := NewMerging(100, false)
+	td.Add(1, 0.1)
+	td.Add(2, 0.2)
+	td.Add(3, 0.3)
+	td.mergeAllTemps()
+	td.mainWeight = math.Nextafter(td.mainWeight, math.Inf(+1))
+
+	assert.Equal(t, float64(3), td.Quantile(1))
+}
+
+func TestUnmarshalBinaryInvalid(t *testing.T) {
+	td := NewMerging(100, false)
+	td.Add(1, 1)
+	buf, err := td.MarshalBinary()
+	require.NoError(t, err)
+
+	assert.Error(t, NewMerging(100, false).UnmarshalBinary(nil))
+	assert.Error(t, NewMerging(100, false).UnmarshalBinary([]byte("gob")))
+	assert.Error(t, NewMerging(100, false).UnmarshalBinary(buf[:len(buf)-1]), "truncated")
+
+	future := append([]byte{}, buf...)
+	future[2] = binaryVersion + 1
+	assert.EqualError(t, NewMerging(100, false).UnmarshalBinary(future),
+		fmt.Sprintf("unsupported t-digest encoding version %d", binaryVersion+1))
+
+	// Fields appended by later veneurs are skipped:
+	extended := append(append([]byte{}, buf...), 1, 2, 3)
+	assert.NoError(t, NewMerging(100, false).UnmarshalBinary(extended))
+}
+
+// TestUnmarshalBinaryV1 ensures that digests encoded by veneurs that
+// used version 1 of the binary encoding can still be decoded. The
+// fixture holds the digest of the numbers 0 to 999; to record it
+// again, uncomment these lines.
+func TestUnmarshalBinaryV1(t *testing.T) {
+	//td := NewMerging(100, false)
+	//for i := 0; i < 1000; i++ {
+	//	td.Add(float64(i), 1.0)
+	//}
+	//buf, _ := td.MarshalBinary()
+	//require.NoError(t, serializeGob(t, buf, "binary_v1.base64"))
+
+	f, err := os.Open("binary_v1.base64")
+	require.NoError(t, err)
+	defer f.Close()
+	buf, err := ioutil.ReadAll(base64.NewDecoder(base64.StdEncoding, f))
+	require.NoError(t, err)
+
+	td := NewMerging(1000, false)
+	require.NoError(t, td.UnmarshalBinary(buf))
+	assert.Equal(t, float64(1000), td.Count())
+	assert.Equal(t, float64(0), td.Min())
+	assert.Equal(t, float64(999), td.Max())
+	assert.InEpsilon(t, 500, td.Quantile(0.5), 0.02, "50%% quantiles did not match")
+	assert.Equal(t, float64(499500), td.Sum())
+}
+
 func BenchmarkAdd(b *testing.B) {
 	rand.Seed(time.Now().Unix())
 	td := NewMerging(1000, false)
@@ -200,3 +411,23 @@ func BenchmarkQuantile(b *testing.B) {
 		td.Quantile(rand.Float64())
 	}
 }
+
+func TestCumulativeWeight(t *testing.T) {
+	td := NewMerging(100, false)
+	assert.Equal(t, 0.0, td.CumulativeWeight(1))
+
+	for _, v := range []float64{1, 2, 7, 8, 100} {
+		td.Add(v, 1)
+	}
+	td.Add(2, 2)
+	for value, want := range map[float64]float64{0.5: 0, 1: 1, 5: 4, 8: 6, 99.9: 6, 100: 7, math.Inf(1): 7} {
+		assert.Equal(t, want, td.CumulativeWeight(value), "weight at or below %v", value)
+	}
+
+	rand.Seed(time.Now().Unix())
+	big := NewMerging(100, false)
+	for i := 0; i < 100000; i++ {
+		big.Add(rand.Float64(), 1)
+	}
+	assert.InDelta(t, 50000, big.CumulativeWeight(0.5), 1000)
+}
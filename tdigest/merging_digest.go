@@ -9,12 +9,15 @@ package tdigest
 
 import (
 	"bytes"
+	"encoding"
+	"encoding/binary"
 	"encoding/gob"
 	"github.com/pkg/errors"
 	"io"
 	"math"
 	"math/rand"
 	"sort"
+	"unsafe"
 )
 
 // A t-digest using the merging implementation. MergingDigest is not safe for
@@ -297,6 +300,30 @@ func (td *MergingDigest) CDF(value float64) float64 {
 	return math.NaN()
 }
 
+// CumulativeWeight returns the approximate total weight of the values in td
+// that are less than or equal to value. Unlike CDF, it treats each centroid as
+// if all of its weight sat at its mean, so that it is exact for digests whose
+// centroids each hold a single distinct value.
+func (td *MergingDigest) CumulativeWeight(value float64) float64 {
+	td.mergeAllTemps()
+
+	if len(td.mainCentroids) == 0 || value < td.min {
+		return 0
+	}
+	if value >= td.max {
+		return td.mainWeight
+	}
+
+	weightSoFar := 0.0
+	for _, c := range td.mainCentroids {
+		if c.Mean > value {
+			break
+		}
+		weightSoFar += c.Weight
+	}
+	return weightSoFar
+}
+
 // Returns a value such that the fraction of values in td below that value is
 // approximately equal to quantile. Returns NaN if the digest is empty.
 func (td *MergingDigest) Quantile(quantile float64) float64 {
@@ -326,9 +353,13 @@ func (td *MergingDigest) Quantile(quantile float64) float64 {
 		lowerBound = upperBound
 	}
 
-	// should never be reached unless empty, since the final comparison is
-	// q <= td.mainWeight
-	return math.NaN()
+	if len(td.mainCentroids) == 0 {
+		return math.NaN()
+	}
+	// the weights of the centroids can add up to slightly less than
+	// td.mainWeight, which is accumulated in a different order, so the
+	// highest quantiles can fall past the last centroid
+	return td.max
 }
 
 func (td *MergingDigest) Min() float64 {
@@ -371,8 +402,14 @@ func (td *MergingDigest) centroidUpperBound(i int) float64 {
 
 // Merge another digest into this one. Neither td nor other can be shared
 // concurrently during the execution of this method.
+//
+// The other digest's centroids are added like weighted samples, but
+// its minimum and maximum are taken from the digest itself: the means
+// of its outermost centroids can lie well inside them, which would
+// otherwise pull in the extreme quantiles of the merged digest.
 func (td *MergingDigest) Merge(other *MergingDigest) {
 	oldReciprocalSum := td.reciprocalSum
+	oldMin, oldMax := td.min, td.max
 	shuffledIndices := rand.Perm(len(other.mainCentroids))
 
 	for _, i := range shuffledIndices {
@@ -386,6 +423,8 @@ func (td *MergingDigest) Merge(other *MergingDigest) {
 	}
 
 	td.reciprocalSum = oldReciprocalSum + other.reciprocalSum
+	td.min = math.Min(oldMin, other.min)
+	td.max = math.Max(oldMax, other.max)
 }
 
 var _ gob.GobEncoder = &MergingDigest{}
@@ -453,6 +492,116 @@ func (td *MergingDigest) GobDecode(b []byte) error {
 	return nil
 }
 
+var _ encoding.BinaryMarshaler = &MergingDigest{}
+var _ encoding.BinaryUnmarshaler = &MergingDigest{}
+
+// The binary encoding starts with binaryMagic followed by a version
+// byte. Version 1 continues with the compression, min, max, reciprocal
+// sum and total weight as big-endian float64s, then the number of
+// centroids as a uvarint, and then each centroid's mean and weight as
+// big-endian float64s.
+//
+// Decoders ignore any bytes after the fields that their version knows
+// of, so fields can be appended to the encoding without changing its
+// version, for older veneurs to skip. The version only changes when
+// existing fields change, which older veneurs can't decode.
+const (
+	binaryMagic   = "td"
+	binaryVersion = 1
+)
+
+// MarshalBinary encodes the digest in a versioned binary format that
+// preserves its centroids and total weight exactly, for forwarding
+// between veneurs that may run different versions. Debug samples are
+// not encoded.
+func (td *MergingDigest) MarshalBinary() ([]byte, error) {
+	td.mergeAllTemps()
+
+	buf := make([]byte, 0, len(binaryMagic)+1+5*8+binary.MaxVarintLen64+16*len(td.mainCentroids))
+	buf = append(buf, binaryMagic...)
+	buf = append(buf, binaryVersion)
+	for _, f := range []float64{td.compression, td.min, td.max, td.reciprocalSum, td.mainWeight} {
+		buf = appendFloat64(buf, f)
+	}
+	var n [binary.MaxVarintLen64]byte
+	buf = append(buf, n[:binary.PutUvarint(n[:], uint64(len(td.mainCentroids)))]...)
+	for _, c := range td.mainCentroids {
+		buf = appendFloat64(buf, c.Mean)
+		buf = appendFloat64(buf, c.Weight)
+	}
+	return buf, nil
+}
+
+// UnmarshalBinary replaces the digest with one encoded by
+// MarshalBinary. It returns an error if the encoding is truncated, or
+// of a version that it doesn't know.
+func (td *MergingDigest) UnmarshalBinary(b []byte) error {
+	if len(b) < len(binaryMagic)+1 || string(b[:len(binaryMagic)]) != binaryMagic {
+		return errors.New("not a binary-encoded t-digest")
+	}
+	if version := b[len(binaryMagic)]; version != binaryVersion {
+		return errors.Errorf("unsupported t-digest encoding version %d", version)
+	}
+	r := bytes.NewReader(b[len(binaryMagic)+1:])
+
+	var header [5]float64
+	if err := binary.Read(r, binary.BigEndian, &header); err != nil {
+		return errors.Wrap(err, "error decoding t-digest")
+	}
+	count, err := binary.ReadUvarint(r)
+	if err != nil {
+		return errors.Wrap(err, "error decoding t-digest")
+	}
+	// each centroid takes 16 bytes, so a count that the rest of the
+	// encoding can't hold is corrupt, and mustn't be allocated for.
+	if count > uint64(r.Len()/16) {
+		return errors.Errorf("error decoding t-digest: %d centroids in %d bytes", count, r.Len())
+	}
+	centroids := make([]Centroid, count)
+	for i := range centroids {
+		var c [2]float64
+		if err := binary.Read(r, binary.BigEndian, &c); err != nil {
+			return errors.Wrap(err, "error decoding t-digest")
+		}
+		centroids[i] = Centroid{Mean: c[0], Weight: c[1]}
+	}
+
+	td.compression, td.min, td.max, td.reciprocalSum, td.mainWeight =
+		header[0], header[1], header[2], header[3], header[4]
+	td.mainCentroids = centroids
+	td.tempWeight = 0
+	if tempSize := estimateTempBuffer(td.compression); cap(td.tempCentroids) != tempSize {
+		td.tempCentroids = make([]Centroid, 0, tempSize)
+	} else {
+		td.tempCentroids = td.tempCentroids[:0]
+	}
+	return nil
+}
+
+// Decode decodes a digest encoded by either MarshalBinary or GobEncode.
+// They are told apart by the binary encoding's magic, which a gob
+// encoding of a digest never starts with: gob encodings start with the
+// length of the definition of the centroids' type.
+func Decode(b []byte) (*MergingDigest, error) {
+	td := NewMerging(100, false)
+	var err error
+	if bytes.HasPrefix(b, []byte(binaryMagic)) {
+		err = td.UnmarshalBinary(b)
+	} else {
+		err = td.GobDecode(b)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return td, nil
+}
+
+func appendFloat64(b []byte, f float64) []byte {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], math.Float64bits(f))
+	return append(b, buf[:]...)
+}
+
 // This function provides direct access to the internal list of centroids in
 // this t-digest. Having access to this list is very important for analyzing the
 // t-digest's statistical properties. However, since it violates the encapsulation
@@ -468,6 +617,31 @@ func (td *MergingDigest) Centroids() []Centroid {
 	return td.mainCentroids
 }
 
+// CentroidCount returns the number of centroids in the digest, after
+// merging the values that were added since it last merged. It is at
+// most about π/2 times the compression, however many values are added.
+func (td *MergingDigest) CentroidCount() int {
+	td.mergeAllTemps()
+	return len(td.mainCentroids)
+}
+
+// Size estimates the number of bytes of memory that the digest takes
+// up: the digest itself and the space allocated for its lists of
+// centroids, plus their samples if debug is enabled.
+func (td *MergingDigest) Size() int {
+	size := int(unsafe.Sizeof(*td))
+	size += (cap(td.mainCentroids) + cap(td.tempCentroids)) * int(unsafe.Sizeof(Centroid{}))
+	if td.debug {
+		for _, c := range td.mainCentroids {
+			size += cap(c.Samples) * int(unsafe.Sizeof(float64(0)))
+		}
+		for _, c := range td.tempCentroids {
+			size += cap(c.Samples) * int(unsafe.Sizeof(float64(0)))
+		}
+	}
+	return size
+}
+
 // Data returns a MergingDigestData based on the MergingDigest (which contains
 // just a subset of the fields).  This can be used with proto.Marshal to
 // encode a MergingDigest as a protobuf.
@@ -0,0 +1,182 @@
+// Package tlsconfig builds TLS configurations for veneur's listeners
+// and clients from PEM files, and reloads their certificates without
+// a restart.
+//
+// Configurations built by a Reloadable pick up the certificates it
+// loaded last, so a freshly rotated certificate is used for every
+// handshake after Reload returns, without having to rebuild the
+// listeners and clients that use it.
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// MinVersion is the oldest version of TLS that is accepted.
+const MinVersion = tls.VersionTLS12
+
+// Files are the paths of the PEM files that make up a TLS
+// configuration.
+type Files struct {
+	// Certificate and Key are the certificate (chain) presented to
+	// peers and its private key.
+	Certificate string
+	Key         string
+
+	// Authority holds the certificates of the authorities that peers'
+	// certificates are verified against. Servers with an authority
+	// require clients to present a certificate signed by it; clients
+	// without one verify servers against the system's roots.
+	Authority string
+}
+
+// IsZero returns true if no files are set.
+func (f Files) IsZero() bool {
+	return f == Files{}
+}
+
+// Reloadable is a TLS configuration that can be reloaded from its
+// files.
+type Reloadable struct {
+	files Files
+
+	mtx       sync.RWMutex
+	cert      *tls.Certificate
+	authority *x509.CertPool
+}
+
+// Load reads the files of a TLS configuration. A certificate and a key
+// must be given together; servers need both.
+func Load(files Files) (*Reloadable, error) {
+	if (files.Certificate == "") != (files.Key == "") {
+		return nil, errors.New("a TLS certificate and key must be set together")
+	}
+	r := &Reloadable{files: files}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload reads the files again. If any of them can't be loaded, it
+// returns an error and keeps using the configuration it loaded
+// before.
+func (r *Reloadable) Reload() error {
+	var cert *tls.Certificate
+	if r.files.Certificate != "" {
+		c, err := tls.LoadX509KeyPair(r.files.Certificate, r.files.Key)
+		if err != nil {
+			return fmt.Errorf("could not load the TLS certificate: %v", err)
+		}
+		cert = &c
+	}
+
+	var authority *x509.CertPool
+	if r.files.Authority != "" {
+		pem, err := ioutil.ReadFile(r.files.Authority)
+		if err != nil {
+			return fmt.Errorf("could not read the TLS authority: %v", err)
+		}
+		authority = x509.NewCertPool()
+		if !authority.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("could not load any certificates from %s", r.files.Authority)
+		}
+	}
+
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.cert = cert
+	r.authority = authority
+	return nil
+}
+
+// ClientAuth returns the client authentication that servers using this
+// configuration require.
+func (r *Reloadable) ClientAuth() tls.ClientAuthType {
+	if r.files.Authority != "" {
+		return tls.RequireAndVerifyClientCert
+	}
+	return tls.NoClientCert
+}
+
+// ServerConfig returns a configuration for TLS servers. Every
+// handshake uses the certificate and authority that were loaded last.
+func (r *Reloadable) ServerConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: MinVersion,
+		ClientAuth: r.ClientAuth(),
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			r.mtx.RLock()
+			defer r.mtx.RUnlock()
+			if r.cert == nil {
+				return nil, errors.New("no TLS certificate is configured")
+			}
+			return &tls.Config{
+				MinVersion:   MinVersion,
+				Certificates: []tls.Certificate{*r.cert},
+				ClientAuth:   r.ClientAuth(),
+				ClientCAs:    r.authority,
+			}, nil
+		},
+	}
+}
+
+// ClientConfig returns a configuration for TLS clients. The client
+// certificate that was loaded last is presented to servers that ask
+// for one; servers are verified against the authority that was loaded
+// when ClientConfig was called.
+func (r *Reloadable) ClientConfig() *tls.Config {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+	return &tls.Config{
+		MinVersion: MinVersion,
+		RootCAs:    r.authority,
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			r.mtx.RLock()
+			defer r.mtx.RUnlock()
+			if r.cert == nil {
+				// send no certificate
+				return &tls.Certificate{}, nil
+			}
+			return r.cert, nil
+		},
+	}
+}
+
+// ReloadOnSignal reloads the configurations whenever the process
+// receives one of the signals, until stop is closed. Configurations
+// that fail to reload keep their previous certificates, and the error
+// is logged.
+func ReloadOnSignal(log *logrus.Entry, stop <-chan struct{}, configs []*Reloadable, sigs ...os.Signal) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, sigs...)
+	defer signal.Stop(ch)
+	for {
+		select {
+		case <-stop:
+			return
+		case sig := <-ch:
+			for _, c := range configs {
+				entry := log.WithFields(logrus.Fields{
+					"signal":      sig.String(),
+					"certificate": c.files.Certificate,
+					"authority":   c.files.Authority,
+				})
+				if err := c.Reload(); err != nil {
+					entry.WithError(err).Error("Could not reload the TLS configuration; keeping the previous one")
+					continue
+				}
+				entry.Info("Reloaded the TLS configuration")
+			}
+		}
+	}
+}
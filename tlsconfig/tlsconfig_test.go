@@ -0,0 +1,171 @@
+package tlsconfig_test
+
+import (
+	"crypto/tls"
+	"io/ioutil"
+	"net"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stripe/veneur/tlsconfig"
+	"github.com/stripe/veneur/tlsconfig/tlstest"
+)
+
+// tempDir creates a temporary directory that is removed when the test
+// is done.
+func tempDir(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "tlsconfig")
+	require.NoError(t, err)
+	return dir, func() { os.RemoveAll(dir) }
+}
+
+// serve accepts TLS connections until the listener is closed, and
+// completes their handshakes.
+func serve(t *testing.T, config *tls.Config) net.Listener {
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", config)
+	require.NoError(t, err)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				if conn.(*tls.Conn).Handshake() == nil {
+					conn.Write([]byte("ok"))
+				}
+			}()
+		}
+	}()
+	return ln
+}
+
+// dial connects to the server and returns an error if the handshake
+// fails or the server hangs up before responding.
+func dial(addr string, config *tls.Config) error {
+	conn, err := tls.Dial("tcp", addr, config)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Read(make([]byte, 2))
+	return err
+}
+
+func TestMutualTLS(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+
+	ca, err := tlstest.NewAuthority("veneur-ca")
+	require.NoError(t, err)
+	serverFiles, err := ca.WriteFiles(dir, "server")
+	require.NoError(t, err)
+	clientFiles, err := ca.WriteFiles(dir, "client")
+	require.NoError(t, err)
+	otherCA, err := tlstest.NewAuthority("other-ca")
+	require.NoError(t, err)
+	untrustedFiles, err := otherCA.WriteFiles(dir, "untrusted")
+	require.NoError(t, err)
+
+	server, err := tlsconfig.Load(serverFiles)
+	require.NoError(t, err)
+	assert.Equal(t, tls.RequireAndVerifyClientCert, server.ClientAuth())
+	ln := serve(t, server.ServerConfig())
+	defer ln.Close()
+
+	tests := []struct {
+		name  string
+		files tlsconfig.Files
+		ok    bool
+	}{
+		{"trusted client certificate", clientFiles, true},
+		{"no client certificate", tlsconfig.Files{Authority: clientFiles.Authority}, false},
+		{"untrusted client certificate", tlsconfig.Files{
+			Certificate: untrustedFiles.Certificate,
+			Key:         untrustedFiles.Key,
+			Authority:   clientFiles.Authority,
+		}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client, err := tlsconfig.Load(test.files)
+			require.NoError(t, err)
+			err = dial(ln.Addr().String(), client.ClientConfig())
+			if test.ok {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err, "the connection should have been rejected")
+			}
+		})
+	}
+}
+
+func TestMinVersion(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+
+	ca, err := tlstest.NewAuthority("veneur-ca")
+	require.NoError(t, err)
+	files, err := ca.WriteFiles(dir, "server")
+	require.NoError(t, err)
+	server, err := tlsconfig.Load(tlsconfig.Files{Certificate: files.Certificate, Key: files.Key})
+	require.NoError(t, err)
+	assert.Equal(t, tls.NoClientCert, server.ClientAuth())
+	ln := serve(t, server.ServerConfig())
+	defer ln.Close()
+
+	client, err := tlsconfig.Load(tlsconfig.Files{Authority: files.Authority})
+	require.NoError(t, err)
+	config := client.ClientConfig()
+	assert.NoError(t, dial(ln.Addr().String(), config))
+
+	config.MinVersion = tls.VersionTLS10
+	config.MaxVersion = tls.VersionTLS11
+	assert.Error(t, dial(ln.Addr().String(), config), "TLS 1.1 should be rejected")
+}
+
+func TestReload(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+
+	oldCA, err := tlstest.NewAuthority("old-ca")
+	require.NoError(t, err)
+	files, err := oldCA.WriteFiles(dir, "server")
+	require.NoError(t, err)
+	server, err := tlsconfig.Load(files)
+	require.NoError(t, err)
+	ln := serve(t, server.ServerConfig())
+	defer ln.Close()
+
+	newCA, err := tlstest.NewAuthority("new-ca")
+	require.NoError(t, err)
+	newDir, cleanupNew := tempDir(t)
+	defer cleanupNew()
+	clientFiles, err := newCA.WriteFiles(newDir, "client")
+	require.NoError(t, err)
+	client, err := tlsconfig.Load(clientFiles)
+	require.NoError(t, err)
+	assert.Error(t, dial(ln.Addr().String(), client.ClientConfig()), "the server shouldn't trust the new authority yet")
+
+	// rotate the server's certificates in place:
+	_, err = newCA.WriteFiles(dir, "server")
+	require.NoError(t, err)
+	require.NoError(t, server.Reload())
+	assert.NoError(t, dial(ln.Addr().String(), client.ClientConfig()), "the server should use its new certificates")
+
+	// a broken file keeps the current configuration:
+	require.NoError(t, ioutil.WriteFile(files.Key, []byte("garbage"), 0600))
+	assert.Error(t, server.Reload())
+	assert.NoError(t, dial(ln.Addr().String(), client.ClientConfig()))
+}
+
+func TestLoadErrors(t *testing.T) {
+	_, err := tlsconfig.Load(tlsconfig.Files{Certificate: "server.crt"})
+	assert.Error(t, err, "a certificate needs a key")
+	_, err = tlsconfig.Load(tlsconfig.Files{Authority: "/nonexistent/ca.crt"})
+	assert.Error(t, err)
+	assert.True(t, tlsconfig.Files{}.IsZero())
+}
@@ -0,0 +1,161 @@
+package trace
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	opentracing "github.com/opentracing/opentracing-go"
+)
+
+// The headers that carry a trace context in the B3 propagation format
+// (https://github.com/openzipkin/b3-propagation), used by Zipkin and
+// the services instrumented for it. B3Header holds the whole context
+// in a single header; the others are the multi-header encoding.
+const (
+	B3Header             = "b3"
+	B3TraceIDHeader      = "X-B3-TraceId"
+	B3SpanIDHeader       = "X-B3-SpanId"
+	B3ParentSpanIDHeader = "X-B3-ParentSpanId"
+	B3SampledHeader      = "X-B3-Sampled"
+	B3FlagsHeader        = "X-B3-Flags"
+)
+
+// The tags that record the parts of a propagated trace context that
+// SSF spans have no fields for. Spans inherit them from their parent,
+// so they are passed on to the services that a span calls.
+const (
+	// TraceIDHighTag holds the upper 64 bits of a 128-bit trace ID,
+	// as 16 hex digits. The span's TraceID holds the lower 64 bits.
+	TraceIDHighTag = "trace.id_high"
+	// SampledTag is "1" if the caller decided to sample the trace,
+	// and "0" if it decided not to. It is unset if the caller left
+	// the decision to its callees.
+	SampledTag = "trace.sampled"
+	// DebugTag is "1" if the caller asked for the trace to be
+	// recorded regardless of sampling.
+	DebugTag = "trace.debug"
+)
+
+// propagatedTags are the tags that child spans inherit.
+var propagatedTags = []string{TraceIDHighTag, SampledTag, DebugTag, TracestateTag}
+
+// TraceIDHigh returns the upper 64 bits of the trace ID of a span with
+// the given tags, or 0 if its trace ID has only 64 bits. Span sinks
+// whose formats have 128-bit trace IDs use it to emit the whole ID.
+func TraceIDHigh(tags map[string]string) uint64 {
+	high, err := strconv.ParseUint(tags[TraceIDHighTag], 16, 64)
+	if err != nil {
+		return 0
+	}
+	return high
+}
+
+// extractB3 returns the trace context in the B3 headers of tm, if
+// there is one. The single header takes precedence over the others.
+// If tm has no B3 headers with trace and span IDs, extractB3 returns
+// a nil context and no error.
+func extractB3(tm opentracing.TextMapReader) (*spanContext, error) {
+	var traceID, spanID, parentID, sampling string
+	if single := textMapReaderGet(tm, B3Header); single != "" {
+		parts := strings.Split(single, "-")
+		switch len(parts) {
+		case 1:
+			// Only a sampling decision, with no context to attach it to.
+			return nil, nil
+		case 2, 3, 4:
+		default:
+			return nil, fmt.Errorf("invalid b3 header %q", single)
+		}
+		traceID, spanID = parts[0], parts[1]
+		if len(parts) > 2 {
+			sampling = parts[2]
+		}
+		if len(parts) > 3 {
+			parentID = parts[3]
+		}
+	} else {
+		traceID = textMapReaderGet(tm, B3TraceIDHeader)
+		spanID = textMapReaderGet(tm, B3SpanIDHeader)
+		if traceID == "" && spanID == "" {
+			return nil, nil
+		}
+		parentID = textMapReaderGet(tm, B3ParentSpanIDHeader)
+		switch sampled := textMapReaderGet(tm, B3SampledHeader); sampled {
+		case "true":
+			sampling = "1"
+		case "false":
+			sampling = "0"
+		default:
+			sampling = sampled
+		}
+		if textMapReaderGet(tm, B3FlagsHeader) == "1" {
+			sampling = "d"
+		}
+	}
+
+	t := &Trace{Resource: textMapReaderGet(tm, ResourceKey)}
+	high, low, err := parseB3TraceID(traceID)
+	if err != nil {
+		return nil, err
+	}
+	t.TraceID = low
+	if t.SpanID, err = parseB3ID(spanID); err != nil {
+		return nil, err
+	}
+	if parentID != "" {
+		if t.ParentID, err = parseB3ID(parentID); err != nil {
+			return nil, err
+		}
+	}
+
+	c := t.context()
+	if high != 0 {
+		c.baggageItems[TraceIDHighTag] = fmt.Sprintf("%016x", uint64(high))
+	}
+	switch sampling {
+	case "":
+	case "0", "1":
+		c.baggageItems[SampledTag] = sampling
+	case "d":
+		c.baggageItems[SampledTag] = "1"
+		c.baggageItems[DebugTag] = "1"
+	default:
+		return nil, fmt.Errorf("invalid B3 sampling state %q", sampling)
+	}
+	return c, nil
+}
+
+// parseB3TraceID parses a 64- or 128-bit B3 trace ID, and returns its
+// upper and lower 64 bits. The upper bits of a 64-bit ID are 0.
+func parseB3TraceID(s string) (high, low int64, err error) {
+	if len(s) <= 16 {
+		low, err = parseB3ID(s)
+		return 0, low, err
+	}
+	if len(s) != 32 {
+		return 0, 0, fmt.Errorf("invalid B3 trace ID %q", s)
+	}
+	h, err := strconv.ParseUint(s[:16], 16, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid B3 trace ID %q", s)
+	}
+	low, err = parseB3ID(s[16:])
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid B3 trace ID %q", s)
+	}
+	return int64(h), low, nil
+}
+
+// parseB3ID parses a 64-bit B3 ID, which is up to 16 hex digits and
+// not 0.
+func parseB3ID(s string) (int64, error) {
+	if len(s) == 0 || len(s) > 16 {
+		return 0, fmt.Errorf("invalid B3 ID %q", s)
+	}
+	id, err := strconv.ParseUint(s, 16, 64)
+	if err != nil || id == 0 {
+		return 0, fmt.Errorf("invalid B3 ID %q", s)
+	}
+	return int64(id), nil
+}
@@ -0,0 +1,157 @@
+package trace
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTraceExtractHeaderB3(t *testing.T) {
+	tests := []struct {
+		name     string
+		headers  map[string]string
+		traceID  int64
+		spanID   int64
+		parentID int64
+		tags     map[string]string
+	}{
+		{
+			name: "multiple headers",
+			headers: map[string]string{
+				"X-B3-TraceId":      "463ac35c9f6413ad",
+				"X-B3-SpanId":       "a2fb4a1d1a96d312",
+				"X-B3-ParentSpanId": "0020000000000001",
+				"X-B3-Sampled":      "1",
+			},
+			traceID:  0x463ac35c9f6413ad,
+			spanID:   -0x5d04b5e2e5692cee, // 0xa2fb4a1d1a96d312
+			parentID: 0x0020000000000001,
+			tags:     map[string]string{SampledTag: "1"},
+		},
+		{
+			name: "multiple headers, 128-bit trace ID",
+			headers: map[string]string{
+				"x-b3-traceid": "80f198ee56343ba864fe8b2a57d3eff7",
+				"x-b3-spanid":  "e457b5a2e4d86bd1",
+				"x-b3-sampled": "0",
+			},
+			traceID: 0x64fe8b2a57d3eff7,
+			spanID:  -0x1ba84a5d1b27942f, // 0xe457b5a2e4d86bd1
+			tags:    map[string]string{TraceIDHighTag: "80f198ee56343ba8", SampledTag: "0"},
+		},
+		{
+			name: "multiple headers, debug flag",
+			headers: map[string]string{
+				"X-B3-TraceId": "463ac35c9f6413ad",
+				"X-B3-SpanId":  "1",
+				"X-B3-Flags":   "1",
+			},
+			traceID: 0x463ac35c9f6413ad,
+			spanID:  1,
+			tags:    map[string]string{SampledTag: "1", DebugTag: "1"},
+		},
+		{
+			name: "multiple headers, sampling deferred",
+			headers: map[string]string{
+				"X-B3-TraceId": "463ac35c9f6413ad",
+				"X-B3-SpanId":  "2",
+			},
+			traceID: 0x463ac35c9f6413ad,
+			spanID:  2,
+		},
+		{
+			name: "single header",
+			headers: map[string]string{
+				"b3": "463ac35c9f6413ad-0000000000000003-1-0020000000000001",
+			},
+			traceID:  0x463ac35c9f6413ad,
+			spanID:   3,
+			parentID: 0x0020000000000001,
+			tags:     map[string]string{SampledTag: "1"},
+		},
+		{
+			name: "single header, 128-bit trace ID and debug",
+			headers: map[string]string{
+				"b3": "80f198ee56343ba864fe8b2a57d3eff7-e457b5a2e4d86bd1-d",
+			},
+			traceID: 0x64fe8b2a57d3eff7,
+			spanID:  -0x1ba84a5d1b27942f,
+			tags:    map[string]string{TraceIDHighTag: "80f198ee56343ba8", SampledTag: "1", DebugTag: "1"},
+		},
+		{
+			name: "single header takes precedence",
+			headers: map[string]string{
+				"b3":           "463ac35c9f6413ad-0000000000000004",
+				"X-B3-TraceId": "1",
+				"X-B3-SpanId":  "1",
+			},
+			traceID: 0x463ac35c9f6413ad,
+			spanID:  4,
+		},
+	}
+	for _, elt := range tests {
+		test := elt
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			c, err := Tracer{}.Extract(opentracing.TextMap, textMapReaderWriter(test.headers))
+			require.NoError(t, err)
+			ctx := c.(*spanContext)
+			assert.Equal(t, test.traceID, ctx.TraceID())
+			assert.Equal(t, test.spanID, ctx.SpanID())
+			assert.Equal(t, test.parentID, ctx.ParentID())
+			assert.Equal(t, test.tags, ctx.propagatedTags())
+		})
+	}
+}
+
+func TestTraceExtractHeaderB3Invalid(t *testing.T) {
+	tests := map[string]map[string]string{
+		"too many fields":    {"b3": "463ac35c9f6413ad-0000000000000003-1-0020000000000001-1"},
+		"trace ID width":     {"b3": "63ac35c9f6413ad463ac35c9f6413ad-0000000000000003"},
+		"span ID not hex":    {"X-B3-TraceId": "463ac35c9f6413ad", "X-B3-SpanId": "xyz"},
+		"zero span ID":       {"X-B3-TraceId": "463ac35c9f6413ad", "X-B3-SpanId": "0000000000000000"},
+		"missing trace ID":   {"X-B3-SpanId": "a2fb4a1d1a96d312"},
+		"sampling state":     {"b3": "463ac35c9f6413ad-0000000000000003-yes"},
+		"parent ID too long": {"X-B3-TraceId": "1", "X-B3-SpanId": "2", "X-B3-ParentSpanId": "00000000000000003"},
+	}
+	for name, elt := range tests {
+		headers := elt
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			c, err := Tracer{}.Extract(opentracing.TextMap, textMapReaderWriter(headers))
+			assert.Error(t, err)
+			assert.Nil(t, c)
+		})
+	}
+}
+
+func TestTraceExtractHeaderB3SamplingOnly(t *testing.T) {
+	// A sampling decision alone doesn't identify a parent span:
+	c, err := Tracer{}.Extract(opentracing.TextMap, textMapReaderWriter{"b3": "0"})
+	assert.Nil(t, c)
+	assert.EqualError(t, err, "error parsing fields from TextMapReader")
+}
+
+func TestExtractRequestChildB3(t *testing.T) {
+	req, err := http.NewRequest(http.MethodPost, "/import", nil)
+	require.NoError(t, err)
+	req.Header.Set("b3", "80f198ee56343ba864fe8b2a57d3eff7-00000000000000a1-d-00000000000000a0")
+
+	span, err := Tracer{}.ExtractRequestChild("/import", req, "veneur.import")
+	require.NoError(t, err)
+	assert.Equal(t, int64(0x64fe8b2a57d3eff7), span.TraceID)
+	assert.Equal(t, int64(0xa1), span.ParentID, "the caller's span should be the parent")
+	assert.NotEqual(t, int64(0xa1), span.SpanID)
+	assert.Equal(t, map[string]string{TraceIDHighTag: "80f198ee56343ba8", SampledTag: "1", DebugTag: "1"},
+		span.SSFSpan().Tags)
+
+	// The context is passed on to the span's children:
+	child := Tracer{}.StartSpan("child", opentracing.ChildOf(span.Context())).(*Span)
+	assert.Equal(t, span.TraceID, child.TraceID)
+	assert.Equal(t, span.SpanID, child.ParentID)
+	assert.Equal(t, "80f198ee56343ba8", child.Tags[TraceIDHighTag])
+	assert.Equal(t, "1", child.Tags[DebugTag])
+}
@@ -177,6 +177,21 @@ func (c *spanContext) parseBaggageInt64(key string) int64 {
 	return val
 }
 
+// propagatedTags returns the tags that a child span inherits from
+// the context, or nil if there are none.
+func (c *spanContext) propagatedTags() map[string]string {
+	var tags map[string]string
+	for _, k := range propagatedTags {
+		if v, ok := c.baggageItems[k]; ok {
+			if tags == nil {
+				tags = map[string]string{}
+			}
+			tags[k] = v
+		}
+	}
+	return tags
+}
+
 // Resource returns the resource assocaited with the spanContext
 func (c *spanContext) Resource() string {
 	var resource string
@@ -262,6 +277,7 @@ func (s *Span) contextAsParent() *spanContext {
 	c.baggageItems["traceid"] = strconv.FormatInt(s.TraceID, 10)
 	c.baggageItems["parentid"] = strconv.FormatInt(s.ParentID, 10)
 	c.baggageItems[ResourceKey] = s.Resource
+	s.Trace.propagateTo(c)
 	return c
 }
 
@@ -415,6 +431,7 @@ func (t Tracer) StartSpan(operationName string, opts ...opentracing.StartSpanOpt
 
 		// First, let's extract the parent's information
 		parent := Trace{}
+		var tags map[string]string
 
 		// TODO don't assume that the ReferencedContext is a concrete spanContext
 		for _, ref := range sso.References {
@@ -431,6 +448,7 @@ func (t Tracer) StartSpan(operationName string, opts ...opentracing.StartSpanOpt
 				parent.TraceID = ctx.TraceID()
 				parent.SpanID = ctx.SpanID()
 				parent.Resource = ctx.Resource()
+				tags = ctx.propagatedTags()
 
 			default:
 				// TODO handle error
@@ -440,6 +458,7 @@ func (t Tracer) StartSpan(operationName string, opts ...opentracing.StartSpanOpt
 		// TODO allow us to start the trace as a separate operation
 		// to prevent measurement error in timing
 		trace := StartChildSpan(&parent)
+		trace.Tags = tags
 
 		if !sso.StartTime.IsZero() {
 			trace.Start = sso.StartTime
@@ -503,6 +522,7 @@ func (tracer Tracer) ExtractRequestChild(resource string, req *http.Request, nam
 		ParentID: parent.ParentID(),
 		Resource: resource,
 	})
+	t.Tags = parent.propagatedTags()
 
 	t.Name = name
 	return &Span{
@@ -547,6 +567,12 @@ func (t Tracer) Inject(sm opentracing.SpanContext, format interface{}, carrier i
 	if w, ok := carrier.(opentracing.TextMapWriter); ok {
 
 		textMapReaderWriter(sc.baggageItems).CloneTo(w)
+		if tp := sc.traceparent(); tp != "" {
+			w.Set(TraceparentHeader, tp)
+			if state, ok := sc.baggageItems[TracestateTag]; ok {
+				w.Set(TracestateHeader, state)
+			}
+		}
 		return nil
 	}
 
@@ -592,6 +618,17 @@ func (t Tracer) Extract(format interface{}, carrier interface{}) (ctx opentracin
 	if tm, ok := carrier.(opentracing.TextMapReader); ok {
 		// carrier is guaranteed to be an opentracing.TextMapReader by contract
 		// TODO support other TextMapReader implementations
+		if c, err := extractB3(tm); err != nil {
+			return nil, err
+		} else if c != nil {
+			return c, nil
+		}
+		if c, err := extractTraceparent(tm); err != nil {
+			return nil, err
+		} else if c != nil {
+			return c, nil
+		}
+
 		var traceID int64
 		var spanID int64
 		for _, headers := range HeaderFormats {
@@ -288,6 +288,7 @@ func (t *Trace) context() *spanContext {
 	c.baggageItems["parentid"] = strconv.FormatInt(t.ParentID, 10)
 	c.baggageItems["spanid"] = strconv.FormatInt(t.SpanID, 10)
 	c.baggageItems[ResourceKey] = t.Resource
+	t.propagateTo(c)
 	return c
 }
 
@@ -301,9 +302,20 @@ func (t *Trace) contextAsParent() *spanContext {
 	c.baggageItems["traceid"] = strconv.FormatInt(t.TraceID, 10)
 	c.baggageItems["parentid"] = strconv.FormatInt(t.SpanID, 10)
 	c.baggageItems[ResourceKey] = t.Resource
+	t.propagateTo(c)
 	return c
 }
 
+// propagateTo adds the trace's tags that its children inherit to the
+// context.
+func (t *Trace) propagateTo(c *spanContext) {
+	for _, k := range propagatedTags {
+		if v, ok := t.Tags[k]; ok {
+			c.baggageItems[k] = v
+		}
+	}
+}
+
 // StartTrace is called by to create the root-level span
 // for a trace
 func StartTrace(resource string) *Trace {
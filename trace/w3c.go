@@ -0,0 +1,116 @@
+package trace
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	opentracing "github.com/opentracing/opentracing-go"
+)
+
+// The headers that carry a trace context in the W3C Trace Context
+// format (https://www.w3.org/TR/trace-context/), used by OpenTelemetry.
+const (
+	TraceparentHeader = "traceparent"
+	TracestateHeader  = "tracestate"
+)
+
+// TracestateTag holds the vendor-specific trace state that the caller
+// sent in the tracestate header. Like the tags of the B3 context, it
+// is inherited by child spans, so that it is passed on unchanged.
+const TracestateTag = "trace.state"
+
+// traceparentVersion is the version of the traceparent format that
+// Veneur emits, and the only one whose length it checks exactly.
+const traceparentVersion = "00"
+
+// traceparentSampled is the bit in the traceparent flags that records
+// the caller's sampling decision.
+const traceparentSampled = 0x01
+
+// extractTraceparent returns the trace context in the W3C traceparent
+// header of tm, if there is one. If tm has no traceparent header,
+// extractTraceparent returns a nil context and no error.
+//
+// Headers of versions newer than 00 are parsed as far as version 00
+// defines them, and anything that follows is ignored, as the
+// specification asks.
+func extractTraceparent(tm opentracing.TextMapReader) (*spanContext, error) {
+	header := strings.TrimSpace(textMapReaderGet(tm, TraceparentHeader))
+	if header == "" {
+		return nil, nil
+	}
+	invalid := fmt.Errorf("invalid traceparent header %q", header)
+
+	// version-traceid-spanid-flags: 2+1+32+1+16+1+2 characters.
+	const length = 55
+	if len(header) < length {
+		return nil, invalid
+	}
+	version, err := strconv.ParseUint(header[:2], 16, 8)
+	if err != nil || header[:2] != strings.ToLower(header[:2]) || version == 0xff {
+		return nil, invalid
+	}
+	if header[:2] == traceparentVersion && len(header) != length {
+		return nil, invalid
+	}
+	if len(header) > length && header[length] != '-' {
+		return nil, invalid
+	}
+	parts := strings.Split(header[:length], "-")
+	if len(parts) != 4 || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return nil, invalid
+	}
+	for _, part := range parts[1:] {
+		if part != strings.ToLower(part) {
+			return nil, invalid
+		}
+	}
+
+	high, low, err := parseB3TraceID(parts[1])
+	if err != nil {
+		return nil, invalid
+	}
+	spanID, err := parseB3ID(parts[2])
+	if err != nil {
+		return nil, invalid
+	}
+	flags, err := strconv.ParseUint(parts[3], 16, 8)
+	if err != nil {
+		return nil, invalid
+	}
+
+	t := &Trace{
+		TraceID:  low,
+		SpanID:   spanID,
+		Resource: textMapReaderGet(tm, ResourceKey),
+	}
+	c := t.context()
+	if high != 0 {
+		c.baggageItems[TraceIDHighTag] = fmt.Sprintf("%016x", uint64(high))
+	}
+	if flags&traceparentSampled != 0 {
+		c.baggageItems[SampledTag] = "1"
+	} else {
+		c.baggageItems[SampledTag] = "0"
+	}
+	if state := strings.TrimSpace(textMapReaderGet(tm, TracestateHeader)); state != "" {
+		c.baggageItems[TracestateTag] = state
+	}
+	return c, nil
+}
+
+// traceparent formats the context as a version 00 traceparent header.
+// It returns an empty string if the context has no trace or span ID.
+func (c *spanContext) traceparent() string {
+	traceID, spanID := c.TraceID(), c.SpanID()
+	if traceID == 0 || spanID == 0 {
+		return ""
+	}
+	var flags byte
+	if c.baggageItems[SampledTag] != "0" {
+		flags |= traceparentSampled
+	}
+	return fmt.Sprintf("%s-%016x%016x-%016x-%02x", traceparentVersion,
+		TraceIDHigh(c.baggageItems), uint64(traceID), uint64(spanID), flags)
+}
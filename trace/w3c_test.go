@@ -0,0 +1,113 @@
+package trace
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTraceparentRoundTrip(t *testing.T) {
+	tests := []struct {
+		name    string
+		header  string
+		traceID int64
+		spanID  int64
+		tags    map[string]string
+	}{
+		{
+			name:    "sampled",
+			header:  "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			traceID: -0x5c316d62f1f1b8ca, // 0xa3ce929d0e0e4736
+			spanID:  0x00f067aa0ba902b7,
+			tags:    map[string]string{TraceIDHighTag: "4bf92f3577b34da6", SampledTag: "1"},
+		},
+		{
+			name:    "not sampled",
+			header:  "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00",
+			traceID: -0x5c316d62f1f1b8ca,
+			spanID:  0x00f067aa0ba902b7,
+			tags:    map[string]string{TraceIDHighTag: "4bf92f3577b34da6", SampledTag: "0"},
+		},
+		{
+			name:    "64-bit trace ID",
+			header:  "00-0000000000000000463ac35c9f6413ad-0000000000000001-01",
+			traceID: 0x463ac35c9f6413ad,
+			spanID:  1,
+			tags:    map[string]string{SampledTag: "1"},
+		},
+	}
+	for _, elt := range tests {
+		test := elt
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			c, err := Tracer{}.Extract(opentracing.TextMap, textMapReaderWriter{"traceparent": test.header})
+			require.NoError(t, err)
+			ctx := c.(*spanContext)
+			assert.Equal(t, test.traceID, ctx.TraceID())
+			assert.Equal(t, test.spanID, ctx.SpanID())
+			assert.Equal(t, test.tags, ctx.propagatedTags())
+
+			tm := textMapReaderWriter{}
+			require.NoError(t, Tracer{}.Inject(ctx, opentracing.TextMap, tm))
+			assert.Equal(t, test.header, tm[TraceparentHeader])
+		})
+	}
+}
+
+func TestTraceparentFutureVersion(t *testing.T) {
+	// Later versions may append fields, which are ignored:
+	c, err := Tracer{}.Extract(opentracing.TextMap, textMapReaderWriter{
+		"traceparent": "cc-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-what-the-future-holds",
+	})
+	require.NoError(t, err)
+	ctx := c.(*spanContext)
+	assert.Equal(t, int64(0x00f067aa0ba902b7), ctx.SpanID())
+	assert.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", ctx.traceparent(),
+		"the context should be passed on in the version that veneur knows")
+}
+
+func TestTraceparentInvalid(t *testing.T) {
+	tests := map[string]string{
+		"version ff":          "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"version not hex":     "0x-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"version 00 too long": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-00",
+		"too short":           "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-1",
+		"zero trace ID":       "00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"zero span ID":        "00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"upper case":          "00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"flags not hex":       "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-0g",
+		"future version":      "01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01.",
+	}
+	for name, elt := range tests {
+		header := elt
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			c, err := Tracer{}.Extract(opentracing.TextMap, textMapReaderWriter{"traceparent": header})
+			assert.Error(t, err)
+			assert.Nil(t, c)
+		})
+	}
+}
+
+func TestTraceparentPropagatesTracestate(t *testing.T) {
+	req, err := http.NewRequest(http.MethodPost, "/spans", nil)
+	require.NoError(t, err)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	req.Header.Set("tracestate", "congo=t61rcWkgMzE,rojo=00f067aa0ba902b7")
+
+	span, err := Tracer{}.ExtractRequestChild("/spans", req, "veneur.spans")
+	require.NoError(t, err)
+	assert.Equal(t, int64(0x00f067aa0ba902b7), span.ParentID)
+	assert.Equal(t, "congo=t61rcWkgMzE,rojo=00f067aa0ba902b7", span.Tags[TracestateTag])
+
+	out := http.Header{}
+	require.NoError(t, Tracer{}.InjectHeader(span.Trace, out))
+	assert.Equal(t, "congo=t61rcWkgMzE,rojo=00f067aa0ba902b7", out.Get("tracestate"))
+	c, err := Tracer{}.Extract(opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(out))
+	require.NoError(t, err)
+	assert.Equal(t, span.SpanID, c.(*spanContext).SpanID())
+	assert.Equal(t, "4bf92f3577b34da6", c.(*spanContext).baggageItems[TraceIDHighTag])
+}
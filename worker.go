@@ -32,13 +32,30 @@ type Worker struct {
 	ImportChan       chan []samplers.JSONMetric
 	ImportMetricChan chan []*metricpb.Metric
 	QuitChan         chan struct{}
-	processed        int64
-	imported         int64
-	mutex            *sync.Mutex
-	traceClient      *trace.Client
-	logger           *logrus.Logger
-	wm               WorkerMetrics
-	stats            *statsd.Client
+	// barriers receives the barriers of Server.drain.
+	barriers     chan barrier
+	processed    int64
+	imported     int64
+	mutex        *sync.Mutex
+	traceClient  *trace.Client
+	logger       *logrus.Logger
+	wm           WorkerMetrics
+	stats        *statsd.Client
+	compression  *samplers.HistogramCompression
+	setPrecision int
+	// maxExemplars is the number of exemplars that each histogram and
+	// timer keeps at most, or 0 for samplers.DefaultMaxExemplars.
+	maxExemplars int
+	// gaugeTTL is how long a gauge keeps being flushed with its last
+	// value after it was last updated, or 0 to flush gauges only in
+	// the intervals that update them. retainGlobalGauges applies it
+	// to global gauges too, on the veneurs that flush them instead of
+	// forwarding them.
+	gaugeTTL           time.Duration
+	retainGlobalGauges bool
+	// reservoirs decides which histograms and timers keep a
+	// reservoir of their raw values.
+	reservoirs samplers.HistogramReservoirs
 }
 
 // IngestUDP on a Worker feeds the metric into the worker's PacketChan.
@@ -75,6 +92,22 @@ type WorkerMetrics struct {
 	localSets         map[samplers.MetricKey]*samplers.Set
 	localTimers       map[samplers.MetricKey]*samplers.Histo
 	localStatusChecks map[samplers.MetricKey]*samplers.StatusCheck
+
+	// staleGauges and staleGlobalGauges hold the times that the
+	// gauges which were carried over from earlier intervals, and not
+	// updated since, were last updated at.
+	staleGauges       map[samplers.MetricKey]time.Time
+	staleGlobalGauges map[samplers.MetricKey]time.Time
+
+	// compression decides the t-digest compression of new histograms
+	compression *samplers.HistogramCompression
+	// setPrecision is the HyperLogLog precision of new sets
+	setPrecision int
+
+	// started is when the worker began collecting these metrics, and
+	// elapsed the time they were collected over, once flushed
+	started time.Time
+	elapsed time.Duration
 }
 
 // NewWorkerMetrics initializes a WorkerMetrics struct
@@ -93,6 +126,9 @@ func NewWorkerMetrics() WorkerMetrics {
 		localSets:         map[samplers.MetricKey]*samplers.Set{},
 		localTimers:       map[samplers.MetricKey]*samplers.Histo{},
 		localStatusChecks: map[samplers.MetricKey]*samplers.StatusCheck{},
+		staleGauges:       map[samplers.MetricKey]time.Time{},
+		staleGlobalGauges: map[samplers.MetricKey]time.Time{},
+		started:           time.Now(),
 	}
 }
 
@@ -125,39 +161,39 @@ func (wm WorkerMetrics) Upsert(mk samplers.MetricKey, Scope samplers.MetricScope
 	case histogramTypeName:
 		if Scope == samplers.LocalOnly {
 			if _, present = wm.localHistograms[mk]; !present {
-				wm.localHistograms[mk] = samplers.NewHist(mk.Name, tags)
+				wm.localHistograms[mk] = samplers.NewHistWithCompression(mk.Name, tags, wm.compression.ForName(mk.Name))
 			}
 		} else if Scope == samplers.GlobalOnly {
 			if _, present = wm.globalHistograms[mk]; !present {
-				wm.globalHistograms[mk] = samplers.NewHist(mk.Name, tags)
+				wm.globalHistograms[mk] = samplers.NewHistWithCompression(mk.Name, tags, wm.compression.ForName(mk.Name))
 			}
 		} else {
 			if _, present = wm.histograms[mk]; !present {
-				wm.histograms[mk] = samplers.NewHist(mk.Name, tags)
+				wm.histograms[mk] = samplers.NewHistWithCompression(mk.Name, tags, wm.compression.ForName(mk.Name))
 			}
 		}
 	case setTypeName:
 		if Scope == samplers.LocalOnly {
 			if _, present = wm.localSets[mk]; !present {
-				wm.localSets[mk] = samplers.NewSet(mk.Name, tags)
+				wm.localSets[mk] = samplers.NewSetWithPrecision(mk.Name, tags, wm.setPrecision)
 			}
 		} else {
 			if _, present = wm.sets[mk]; !present {
-				wm.sets[mk] = samplers.NewSet(mk.Name, tags)
+				wm.sets[mk] = samplers.NewSetWithPrecision(mk.Name, tags, wm.setPrecision)
 			}
 		}
 	case timerTypeName:
 		if Scope == samplers.LocalOnly {
 			if _, present = wm.localTimers[mk]; !present {
-				wm.localTimers[mk] = samplers.NewHist(mk.Name, tags)
+				wm.localTimers[mk] = samplers.NewHistWithCompression(mk.Name, tags, wm.compression.ForName(mk.Name))
 			}
 		} else if Scope == samplers.GlobalOnly {
 			if _, present = wm.globalTimers[mk]; !present {
-				wm.globalTimers[mk] = samplers.NewHist(mk.Name, tags)
+				wm.globalTimers[mk] = samplers.NewHistWithCompression(mk.Name, tags, wm.compression.ForName(mk.Name))
 			}
 		} else {
 			if _, present = wm.timers[mk]; !present {
-				wm.timers[mk] = samplers.NewHist(mk.Name, tags)
+				wm.timers[mk] = samplers.NewHistWithCompression(mk.Name, tags, wm.compression.ForName(mk.Name))
 			}
 		}
 	case statusTypeName:
@@ -170,6 +206,22 @@ func (wm WorkerMetrics) Upsert(mk samplers.MetricKey, Scope samplers.MetricScope
 	return !present
 }
 
+// histogramBytes estimates the number of bytes of memory that the
+// t-digests of the histograms and timers in wm take up.
+func (wm WorkerMetrics) histogramBytes() int {
+	size := 0
+	for _, histos := range []map[samplers.MetricKey]*samplers.Histo{
+		wm.histograms, wm.timers,
+		wm.globalHistograms, wm.globalTimers,
+		wm.localHistograms, wm.localTimers,
+	} {
+		for _, h := range histos {
+			size += h.Value.Size()
+		}
+	}
+	return size
+}
+
 // ForwardableMetrics converts all metrics that should be forwarded to
 // metricpb.Metric (protobuf-compatible).
 func (wm WorkerMetrics) ForwardableMetrics(cl *trace.Client) []*metricpb.Metric {
@@ -232,22 +284,39 @@ func (wm WorkerMetrics) appendExportedMetric(res []*metricpb.Metric, exp metricE
 	return append(res, m)
 }
 
-// NewWorker creates, and returns a new Worker object.
-func NewWorker(id int, cl *trace.Client, logger *logrus.Logger, stats *statsd.Client) *Worker {
-	return &Worker{
+// NewWorker creates, and returns a new Worker object. The worker
+// creates histograms with the t-digest compression that compression
+// decides on; if it is nil, all histograms get the default
+// compression. Sets are created with the HyperLogLog precision
+// setPrecision, or the default precision if it is 0.
+func NewWorker(id int, cl *trace.Client, logger *logrus.Logger, stats *statsd.Client, compression *samplers.HistogramCompression, setPrecision int) *Worker {
+	w := &Worker{
 		id:               id,
 		PacketChan:       make(chan samplers.UDPMetric, 32),
 		ImportChan:       make(chan []samplers.JSONMetric, 32),
 		ImportMetricChan: make(chan []*metricpb.Metric, 32),
 		QuitChan:         make(chan struct{}),
+		barriers:         make(chan barrier),
 		processed:        0,
 		imported:         0,
 		mutex:            &sync.Mutex{},
 		traceClient:      cl,
 		logger:           logger,
-		wm:               NewWorkerMetrics(),
 		stats:            stats,
+		compression:      compression,
+		setPrecision:     setPrecision,
 	}
+	w.wm = w.newWorkerMetrics()
+	return w
+}
+
+// newWorkerMetrics returns an empty WorkerMetrics that creates
+// samplers with the worker's settings.
+func (w *Worker) newWorkerMetrics() WorkerMetrics {
+	wm := NewWorkerMetrics()
+	wm.compression = w.compression
+	wm.setPrecision = w.setPrecision
+	return wm
 }
 
 // Work will start the worker listening for metrics to process or import.
@@ -265,6 +334,8 @@ func (w *Worker) Work() {
 			for _, m := range ms {
 				w.ImportMetricGRPC(m)
 			}
+		case b := <-w.barriers:
+			b.wait()
 		case <-w.QuitChan:
 			// We have been asked to stop.
 			log.WithField("worker", w.id).Error("Stopping")
@@ -287,7 +358,7 @@ func (w *Worker) ProcessMetric(m *samplers.UDPMetric) {
 	w.mutex.Lock()
 	defer w.mutex.Unlock()
 	w.processed++
-	w.wm.Upsert(m.MetricKey, m.Scope, m.Tags)
+	created := w.wm.Upsert(m.MetricKey, m.Scope, m.Tags)
 
 	switch m.Type {
 	case counterTypeName:
@@ -298,18 +369,25 @@ func (w *Worker) ProcessMetric(m *samplers.UDPMetric) {
 		}
 	case gaugeTypeName:
 		if m.Scope == samplers.GlobalOnly {
-			w.wm.globalGauges[m.MetricKey].Sample(m.Value.(float64), m.SampleRate)
+			w.wm.globalGauges[m.MetricKey].SampleAt(m.Value.(float64), m.SampleRate, m.Timestamp)
+			delete(w.wm.staleGlobalGauges, m.MetricKey)
 		} else {
-			w.wm.gauges[m.MetricKey].Sample(m.Value.(float64), m.SampleRate)
+			w.wm.gauges[m.MetricKey].SampleAt(m.Value.(float64), m.SampleRate, m.Timestamp)
+			delete(w.wm.staleGauges, m.MetricKey)
 		}
 	case histogramTypeName:
+		histo := w.wm.histograms[m.MetricKey]
 		if m.Scope == samplers.LocalOnly {
-			w.wm.localHistograms[m.MetricKey].Sample(m.Value.(float64), m.SampleRate)
+			histo = w.wm.localHistograms[m.MetricKey]
 		} else if m.Scope == samplers.GlobalOnly {
-			w.wm.globalHistograms[m.MetricKey].Sample(m.Value.(float64), m.SampleRate)
-		} else {
-			w.wm.histograms[m.MetricKey].Sample(m.Value.(float64), m.SampleRate)
+			histo = w.wm.globalHistograms[m.MetricKey]
 		}
+		if created {
+			w.addReservoir(histo)
+		}
+		histo.Sample(m.Value.(float64), m.SampleRate)
+		histo.RequestPercentiles(m.Percentiles)
+		w.addExemplar(histo, m)
 	case setTypeName:
 		if m.Scope == samplers.LocalOnly {
 			w.wm.localSets[m.MetricKey].Sample(m.Value.(string), m.SampleRate)
@@ -317,13 +395,17 @@ func (w *Worker) ProcessMetric(m *samplers.UDPMetric) {
 			w.wm.sets[m.MetricKey].Sample(m.Value.(string), m.SampleRate)
 		}
 	case timerTypeName:
+		timer := w.wm.timers[m.MetricKey]
 		if m.Scope == samplers.LocalOnly {
-			w.wm.localTimers[m.MetricKey].Sample(m.Value.(float64), m.SampleRate)
+			timer = w.wm.localTimers[m.MetricKey]
 		} else if m.Scope == samplers.GlobalOnly {
-			w.wm.globalTimers[m.MetricKey].Sample(m.Value.(float64), m.SampleRate)
-		} else {
-			w.wm.timers[m.MetricKey].Sample(m.Value.(float64), m.SampleRate)
+			timer = w.wm.globalTimers[m.MetricKey]
 		}
+		if created {
+			w.addReservoir(timer)
+		}
+		timer.Sample(m.Value.(float64), m.SampleRate)
+		w.addExemplar(timer, m)
 	case statusTypeName:
 		v := float64(m.Value.(ssf.SSFSample_Status))
 		w.wm.localStatusChecks[m.MetricKey].Sample(v, m.SampleRate, m.Message, m.HostName)
@@ -332,6 +414,31 @@ func (w *Worker) ProcessMetric(m *samplers.UDPMetric) {
 	}
 }
 
+// addReservoir gives a new histogram or timer a reservoir of its raw
+// values, if the worker's reservoirs configure one for its name.
+func (w *Worker) addReservoir(histo *samplers.Histo) {
+	if size := w.reservoirs.ForName(histo.Name); size > 0 {
+		histo.Reservoir = samplers.NewReservoir(size)
+	}
+}
+
+// addExemplar records a histogram or timer sample that carries a trace
+// ID as an exemplar of histo. w.mutex must be held.
+func (w *Worker) addExemplar(histo *samplers.Histo, m *samplers.UDPMetric) {
+	if m.TraceID == "" {
+		return
+	}
+	ts := time.Now().UnixNano()
+	if m.Timestamp != 0 {
+		ts = time.Unix(m.Timestamp, 0).UnixNano()
+	}
+	histo.AddExemplar(samplers.Exemplar{
+		Value:     m.Value.(float64),
+		TraceID:   m.TraceID,
+		Timestamp: ts,
+	}, w.maxExemplars)
+}
+
 // ImportMetric receives a metric from another veneur instance
 func (w *Worker) ImportMetric(other samplers.JSONMetric) {
 	w.mutex.Lock()
@@ -356,6 +463,7 @@ func (w *Worker) ImportMetric(other samplers.JSONMetric) {
 		if err := w.wm.globalGauges[other.MetricKey].Combine(other.Value); err != nil {
 			log.WithError(err).Error("Could not merge gauges")
 		}
+		delete(w.wm.staleGlobalGauges, other.MetricKey)
 	case setTypeName:
 		if err := w.wm.sets[other.MetricKey].Combine(other.Value); err != nil {
 			log.WithError(err).Error("Could not merge sets")
@@ -400,6 +508,7 @@ func (w *Worker) ImportMetricGRPC(other *metricpb.Metric) (err error) {
 		w.wm.globalCounters[key].Merge(v.Counter)
 	case *metricpb.Metric_Gauge:
 		w.wm.globalGauges[key].Merge(v.Gauge)
+		delete(w.wm.staleGlobalGauges, key)
 	case *metricpb.Metric_Set:
 		if merr := w.wm.sets[key].Merge(v.Set); merr != nil {
 			err = fmt.Errorf("could not merge a set: %v", err)
@@ -441,9 +550,10 @@ func (w *Worker) Flush() WorkerMetrics {
 	// This is a critical spot. The worker can't process metrics while this
 	// mutex is held! So we try and minimize it by copying the maps of values
 	// and assigning new ones.
-	wm := NewWorkerMetrics()
+	wm := w.newWorkerMetrics()
 	w.mutex.Lock()
 	ret := w.wm
+	ret.elapsed = wm.started.Sub(ret.started)
 	processed := w.processed
 	imported := w.imported
 
@@ -455,9 +565,76 @@ func (w *Worker) Flush() WorkerMetrics {
 	w.stats.Count("worker.metrics_processed_total", processed, []string{}, 1.0)
 	w.stats.Count("worker.metrics_imported_total", imported, []string{}, 1.0)
 
+	if w.gaugeTTL > 0 {
+		w.retainGauges(ret, wm.started)
+	}
 	return ret
 }
 
+// retainGauges carries the gauges of flushed that were updated less
+// than the worker's gauge TTL before now over into the worker's
+// current interval, so that they are flushed again with their last
+// value, and drops the others. Gauges that were updated since the
+// flush are left alone. The worker's lock is only held to add the
+// carried-over gauges.
+func (w *Worker) retainGauges(flushed WorkerMetrics, now time.Time) {
+	gauges, expired := w.expireGauges(flushed.gauges, flushed.staleGauges, now)
+	var globalGauges map[samplers.MetricKey]staleGauge
+	if w.retainGlobalGauges {
+		var expiredGlobal int64
+		globalGauges, expiredGlobal = w.expireGauges(flushed.globalGauges, flushed.staleGlobalGauges, now)
+		expired += expiredGlobal
+	}
+
+	w.mutex.Lock()
+	for key, g := range gauges {
+		if _, ok := w.wm.gauges[key]; !ok {
+			w.wm.gauges[key] = g.gauge
+			w.wm.staleGauges[key] = g.updated
+		}
+	}
+	for key, g := range globalGauges {
+		if _, ok := w.wm.globalGauges[key]; !ok {
+			w.wm.globalGauges[key] = g.gauge
+			w.wm.staleGlobalGauges[key] = g.updated
+		}
+	}
+	w.mutex.Unlock()
+
+	w.stats.Count("worker.gauges_expired_total", expired, []string{}, 1.0)
+}
+
+// staleGauge is a copy of a gauge that is carried over into the next
+// interval, and the time it was last updated at.
+type staleGauge struct {
+	gauge   *samplers.Gauge
+	updated time.Time
+}
+
+// expireGauges returns copies of the gauges that were updated less
+// than the worker's gauge TTL before now, and the number of gauges that
+// weren't. Gauges that aren't in stale were updated in the interval
+// that ended at now.
+func (w *Worker) expireGauges(gauges map[samplers.MetricKey]*samplers.Gauge, stale map[samplers.MetricKey]time.Time, now time.Time) (map[samplers.MetricKey]staleGauge, int64) {
+	retained := make(map[samplers.MetricKey]staleGauge, len(gauges))
+	var expired int64
+	for key, g := range gauges {
+		updated, ok := stale[key]
+		if !ok {
+			updated = now
+		}
+		if now.Sub(updated) >= w.gaugeTTL {
+			expired++
+			continue
+		}
+		// the flushed gauge is still being flushed, so the next
+		// interval gets its own copy:
+		cp := *g
+		retained[key] = staleGauge{gauge: &cp, updated: updated}
+	}
+	return retained, expired
+}
+
 // Stop tells the worker to stop listening for work requests.
 //
 // Note that the worker will only stop *after* it has finished its work.
@@ -484,6 +661,12 @@ func NewEventWorker(cl *trace.Client, stats *statsd.Client) *EventWorker {
 	}
 }
 
+// IngestEvent on an EventWorker feeds the event into the worker's
+// sample channel.
+func (ew *EventWorker) IngestEvent(sample ssf.SSFSample) {
+	ew.sampleChan <- sample
+}
+
 // Work will start the EventWorker listening for events and service checks.
 // This function will never return.
 func (ew *EventWorker) Work() {
@@ -516,10 +699,15 @@ func (ew *EventWorker) Flush() []ssf.SSFSample {
 // SpanWorker is similar to a Worker but it collects events and service checks instead of metrics.
 type SpanWorker struct {
 	SpanChan   <-chan *ssf.SSFSpan
-	sinkTags   []map[string]string
 	commonTags map[string]string
-	sinks      []sinks.SpanSink
-
+	// barriers receives the barriers of Server.drain.
+	barriers chan barrier
+
+	// mtx protects the sinks, their tags and cumulative times, which
+	// are replaced by SetSinks.
+	mtx      sync.RWMutex
+	sinkTags []map[string]string
+	sinks    []sinks.SpanSink
 	// cumulative time spent per sink, in nanoseconds
 	cumulativeTimes []int64
 	traceClient     *trace.Client
@@ -529,22 +717,40 @@ type SpanWorker struct {
 
 // NewSpanWorker creates a SpanWorker ready to collect events and service checks.
 func NewSpanWorker(sinks []sinks.SpanSink, cl *trace.Client, statsd *statsd.Client, spanChan <-chan *ssf.SSFSpan, commonTags map[string]string) *SpanWorker {
-	tags := make([]map[string]string, len(sinks))
-	for i, sink := range sinks {
+	tw := &SpanWorker{
+		SpanChan:    spanChan,
+		commonTags:  commonTags,
+		barriers:    make(chan barrier),
+		traceClient: cl,
+		statsd:      statsd,
+	}
+	tw.SetSinks(sinks)
+	return tw
+}
+
+// SetSinks replaces the sinks that the SpanWorker sends spans to.
+// Spans that are being ingested when it is called go to the previous
+// sinks.
+func (tw *SpanWorker) SetSinks(spanSinks []sinks.SpanSink) {
+	tags := make([]map[string]string, len(spanSinks))
+	for i, sink := range spanSinks {
 		tags[i] = map[string]string{
 			"sink": sink.Name(),
 		}
 	}
 
-	return &SpanWorker{
-		SpanChan:        spanChan,
-		sinks:           sinks,
-		sinkTags:        tags,
-		commonTags:      commonTags,
-		cumulativeTimes: make([]int64, len(sinks)),
-		traceClient:     cl,
-		statsd:          statsd,
-	}
+	tw.mtx.Lock()
+	defer tw.mtx.Unlock()
+	tw.sinks = spanSinks
+	tw.sinkTags = tags
+	tw.cumulativeTimes = make([]int64, len(spanSinks))
+}
+
+// currentSinks returns the sinks, their tags and cumulative times.
+func (tw *SpanWorker) currentSinks() ([]sinks.SpanSink, []map[string]string, []int64) {
+	tw.mtx.RLock()
+	defer tw.mtx.RUnlock()
+	return tw.sinks, tw.sinkTags, tw.cumulativeTimes
 }
 
 // Work will start the SpanWorker listening for spans.
@@ -552,7 +758,19 @@ func NewSpanWorker(sinks []sinks.SpanSink, cl *trace.Client, statsd *statsd.Clie
 func (tw *SpanWorker) Work() {
 	const Timeout = 9 * time.Second
 	capcmp := cap(tw.SpanChan) - 1
-	for m := range tw.SpanChan {
+	for {
+		var m *ssf.SSFSpan
+		select {
+		case span, ok := <-tw.SpanChan:
+			if !ok {
+				return
+			}
+			m = span
+		case b := <-tw.barriers:
+			b.wait()
+			continue
+		}
+
 		// If we are at or one below cap, increment the counter.
 		if len(tw.SpanChan) >= capcmp {
 			atomic.AddInt64(&tw.capCount, 1)
@@ -568,9 +786,10 @@ func (tw *SpanWorker) Work() {
 			}
 		}
 
+		spanSinks, sinkTags, cumulativeTimes := tw.currentSinks()
 		var wg sync.WaitGroup
-		for i, s := range tw.sinks {
-			tags := tw.sinkTags[i]
+		for i, s := range spanSinks {
+			tags := sinkTags[i]
 			wg.Add(1)
 			go func(i int, sink sinks.SpanSink, span *ssf.SSFSpan, wg *sync.WaitGroup) {
 				defer wg.Done()
@@ -614,7 +833,7 @@ func (tw *SpanWorker) Work() {
 					t = append(t, "sink:"+sink.Name())
 					tw.statsd.Incr("worker.span.ingest_timeout_total", t, 1.0)
 				}
-				atomic.AddInt64(&tw.cumulativeTimes[i], int64(time.Since(start)/time.Nanosecond))
+				atomic.AddInt64(&cumulativeTimes[i], int64(time.Since(start)/time.Nanosecond))
 			}(i, s, m, &wg)
 		}
 		wg.Wait()
@@ -626,9 +845,10 @@ func (tw *SpanWorker) Flush() {
 	samples := &ssf.Samples{}
 
 	// Flush and time each sink.
-	for i, s := range tw.sinks {
-		tags := make([]string, 0, len(tw.sinkTags[i]))
-		for k, v := range tw.sinkTags[i] {
+	spanSinks, sinkTags, cumulativeTimes := tw.currentSinks()
+	for i, s := range spanSinks {
+		tags := make([]string, 0, len(sinkTags[i]))
+		for k, v := range sinkTags[i] {
 			tags = append(tags, fmt.Sprintf("%s:%s", k, v))
 		}
 		sinkFlushStart := time.Now()
@@ -636,7 +856,7 @@ func (tw *SpanWorker) Flush() {
 		tw.statsd.Timing("worker.span.flush_duration_ns", time.Since(sinkFlushStart), tags, 1.0)
 
 		// cumulative time is measured in nanoseconds
-		cumulative := time.Duration(atomic.SwapInt64(&tw.cumulativeTimes[i], 0)) * time.Nanosecond
+		cumulative := time.Duration(atomic.SwapInt64(&cumulativeTimes[i], 0)) * time.Nanosecond
 		tw.statsd.Timing(sinks.MetricKeySpanIngestDuration, cumulative, tags, 1.0)
 	}
 
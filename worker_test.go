@@ -1,6 +1,7 @@
 package veneur
 
 import (
+	"math/rand"
 	"strings"
 	"sync"
 	"testing"
@@ -19,7 +20,7 @@ import (
 )
 
 func TestWorker(t *testing.T) {
-	w := NewWorker(1, nil, logrus.New(), nil)
+	w := NewWorker(1, nil, logrus.New(), nil, nil, 0)
 
 	m := samplers.UDPMetric{
 		MetricKey: samplers.MetricKey{
@@ -39,8 +40,122 @@ func TestWorker(t *testing.T) {
 	assert.Len(t, nometrics.counters, 0, "Should flush no metrics")
 }
 
+func TestWorkerGaugeTTL(t *testing.T) {
+	w := NewWorker(1, nil, logrus.New(), nil, nil, 0)
+	w.gaugeTTL = 100 * time.Millisecond
+
+	gauge := func(name string, value float64) {
+		w.ProcessMetric(&samplers.UDPMetric{
+			MetricKey:  samplers.MetricKey{Name: name, Type: "gauge"},
+			Value:      value,
+			SampleRate: 1.0,
+		})
+	}
+	values := func(wm WorkerMetrics) map[string]float64 {
+		ret := map[string]float64{}
+		for _, g := range wm.gauges {
+			ret[g.Name] = g.Value()
+		}
+		return ret
+	}
+
+	gauge("a.dead.host", 1)
+	gauge("a.live.host", 2)
+	assert.Equal(t, map[string]float64{"a.dead.host": 1, "a.live.host": 2}, values(w.Flush()))
+
+	// both are still within the TTL, and the live one is updated:
+	gauge("a.live.host", 3)
+	assert.Equal(t, map[string]float64{"a.dead.host": 1, "a.live.host": 3}, values(w.Flush()))
+
+	time.Sleep(150 * time.Millisecond)
+	gauge("a.live.host", 4)
+	assert.Equal(t, map[string]float64{"a.dead.host": 1, "a.live.host": 4}, values(w.Flush()),
+		"the dead host's gauge should be flushed once more, and expire with this flush")
+	assert.Equal(t, map[string]float64{"a.live.host": 4}, values(w.Flush()),
+		"the gauge that wasn't updated for longer than the TTL should not be flushed")
+
+	time.Sleep(150 * time.Millisecond)
+	w.Flush()
+	assert.Empty(t, values(w.Flush()))
+}
+
+func TestWorkerGaugeNoTTL(t *testing.T) {
+	w := NewWorker(1, nil, logrus.New(), nil, nil, 0)
+	w.ProcessMetric(&samplers.UDPMetric{
+		MetricKey:  samplers.MetricKey{Name: "a.b.c", Type: "gauge"},
+		Value:      1.0,
+		SampleRate: 1.0,
+	})
+	assert.Len(t, w.Flush().gauges, 1)
+	assert.Len(t, w.Flush().gauges, 0, "without a TTL, gauges should only be flushed in the interval that updates them")
+}
+
+func TestWorkerHistogramCompression(t *testing.T) {
+	compression := &samplers.HistogramCompression{
+		Default: 20,
+		Overrides: []samplers.CompressionOverride{
+			{Pattern: "critical.*", Compression: 500},
+		},
+	}
+	w := NewWorker(1, nil, logrus.New(), nil, compression, 0)
+
+	for _, name := range []string{"critical.latency", "boring.latency"} {
+		for i := 0; i < 10000; i++ {
+			m := samplers.UDPMetric{
+				MetricKey: samplers.MetricKey{
+					Name: name,
+					Type: "histogram",
+				},
+				Value:      rand.NormFloat64(),
+				SampleRate: 1.0,
+			}
+			w.ProcessMetric(&m)
+		}
+	}
+
+	// compression must survive flushes:
+	for flush := 0; flush < 2; flush++ {
+		sizes := map[string]int{}
+		for key, h := range w.Flush().histograms {
+			sizes[key.Name] = len(h.Value.Data().MainCentroids)
+			assert.Equal(t, compression.ForName(key.Name), h.Value.Data().Compression)
+		}
+		if flush == 0 {
+			require.Len(t, sizes, 2)
+			assert.True(t, sizes["critical.latency"] > 2*sizes["boring.latency"],
+				"critical histogram should have more centroids: %v", sizes)
+		}
+		m := samplers.UDPMetric{
+			MetricKey:  samplers.MetricKey{Name: "boring.latency", Type: "histogram"},
+			Value:      1.0,
+			SampleRate: 1.0,
+		}
+		w.ProcessMetric(&m)
+	}
+}
+
+func TestWorkerMetricsHistogramBytes(t *testing.T) {
+	w := NewWorker(1, nil, logrus.New(), nil, nil, 0)
+	assert.Equal(t, 0, w.Flush().histogramBytes())
+
+	for _, typ := range []string{"histogram", "timer"} {
+		for _, scope := range []samplers.MetricScope{samplers.MixedScope, samplers.LocalOnly, samplers.GlobalOnly} {
+			m := samplers.UDPMetric{
+				MetricKey:  samplers.MetricKey{Name: "a.b.c", Type: typ},
+				Value:      1.0,
+				SampleRate: 1.0,
+				Scope:      scope,
+			}
+			w.ProcessMetric(&m)
+		}
+	}
+	wm := w.Flush()
+	one := samplers.NewHist("a.b.c", nil).Value.Size()
+	assert.Equal(t, 6*one, wm.histogramBytes())
+}
+
 func TestWorkerLocal(t *testing.T) {
-	w := NewWorker(1, nil, logrus.New(), nil)
+	w := NewWorker(1, nil, logrus.New(), nil, nil, 0)
 
 	m := samplers.UDPMetric{
 		MetricKey: samplers.MetricKey{
@@ -60,7 +175,7 @@ func TestWorkerLocal(t *testing.T) {
 }
 
 func TestWorkerGlobal(t *testing.T) {
-	w := NewWorker(1, nil, logrus.New(), nil)
+	w := NewWorker(1, nil, logrus.New(), nil, nil, 0)
 
 	gc := samplers.UDPMetric{
 		MetricKey: samplers.MetricKey{
@@ -93,7 +208,7 @@ func TestWorkerGlobal(t *testing.T) {
 }
 
 func TestWorkerImportSet(t *testing.T) {
-	w := NewWorker(1, nil, logrus.New(), nil)
+	w := NewWorker(1, nil, logrus.New(), nil, nil, 0)
 	testset := samplers.NewSet("a.b.c", nil)
 	testset.Sample("foo", 1.0)
 	testset.Sample("bar", 1.0)
@@ -108,7 +223,7 @@ func TestWorkerImportSet(t *testing.T) {
 }
 
 func TestWorkerImportHistogram(t *testing.T) {
-	w := NewWorker(1, nil, logrus.New(), nil)
+	w := NewWorker(1, nil, logrus.New(), nil, nil, 0)
 	testhisto := samplers.NewHist("a.b.c", nil)
 	testhisto.Sample(1.0, 1.0)
 	testhisto.Sample(2.0, 1.0)
@@ -123,7 +238,7 @@ func TestWorkerImportHistogram(t *testing.T) {
 }
 
 func TestWorkerStatusMetric(t *testing.T) {
-	w := NewWorker(1, nil, logrus.New(), nil)
+	w := NewWorker(1, nil, logrus.New(), nil, nil, 0)
 
 	m := samplers.UDPMetric{
 		MetricKey: samplers.MetricKey{
@@ -264,7 +379,7 @@ type testMetricExporter interface {
 }
 
 func exportMetricAndFlush(t testing.TB, exp testMetricExporter) WorkerMetrics {
-	w := NewWorker(1, nil, logrus.New(), nil)
+	w := NewWorker(1, nil, logrus.New(), nil, nil, 0)
 	m, err := exp.Metric()
 	assert.NoErrorf(t, err, "exporting the metric '%s' shouldn't have failed",
 		exp.GetName())
@@ -301,7 +416,7 @@ func TestWorkerImportMetricGRPC(t *testing.T) {
 	})
 	t.Run("timer", func(t *testing.T) {
 		t.Parallel()
-		w := NewWorker(1, nil, logrus.New(), nil)
+		w := NewWorker(1, nil, logrus.New(), nil, nil, 0)
 		h := samplers.NewHist("test.timer", nil)
 		h.Sample(1.0, 1.0)
 
@@ -327,7 +442,7 @@ func TestWorkerImportMetricGRPC(t *testing.T) {
 func TestWorkerImportMetricGRPCNilValue(t *testing.T) {
 	t.Parallel()
 
-	w := NewWorker(1, nil, logrus.New(), nil)
+	w := NewWorker(1, nil, logrus.New(), nil, nil, 0)
 	metric := &metricpb.Metric{
 		Name:  "test",
 		Type:  metricpb.Type_Histogram,